@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"vibe-drop/internal/mailingest"
+)
+
+func main() {
+	go mailingest.Start()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	mailingest.Stop()
+}
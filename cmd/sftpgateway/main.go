@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"vibe-drop/internal/sftpgateway"
+)
+
+func main() {
+	go sftpgateway.Start()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	sftpgateway.Stop()
+}
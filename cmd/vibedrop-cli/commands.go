@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+func runLogin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	server := fs.String("server", "", "API gateway URL (default "+defaultServer+")")
+	email := fs.String("email", "", "account email")
+	password := fs.String("password", "", "account password (prompted if omitted)")
+	totp := fs.String("totp", "", "two-factor code (prompted if the account needs one)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if *server != "" {
+		cfg.Server = *server
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	if *email == "" {
+		fmt.Fprint(os.Stderr, "Email: ")
+		line, _ := reader.ReadString('\n')
+		*email = strings.TrimSpace(line)
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, _ := reader.ReadString('\n')
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	client := vibedrop.NewClient(cfg.Server, vibedrop.WithClientInfo("vibedrop-cli", version))
+	result, err := client.LoginWithTOTP(ctx, *email, *password, *totp)
+	var apiErr *vibedrop.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == vibedrop.ErrTOTPRequired {
+		fmt.Fprint(os.Stderr, "Two-factor code: ")
+		line, _ := reader.ReadString('\n')
+		result, err = client.LoginWithTOTP(ctx, *email, *password, strings.TrimSpace(line))
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg.Token, cfg.RefreshToken, cfg.ExpiresAt = result.Token, result.RefreshToken, result.ExpiresAt
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in as %s (%s)\n", result.User.Username, result.User.Email)
+	return nil
+}
+
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	fs.Parse(args)
+
+	client, err := authedClient()
+	if err != nil {
+		return err
+	}
+
+	files, err := client.ListFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSIZE\tUPLOADED")
+	for _, file := range files {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", file.ID, file.Filename, formatBytes(file.Size), file.UploadedAt.Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+func runRemove(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: vibedrop-cli rm <file-id>...")
+	}
+
+	client, err := authedClient()
+	if err != nil {
+		return err
+	}
+
+	for _, fileID := range fs.Args() {
+		if err := client.DeleteFile(ctx, fileID); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", fileID, err)
+		}
+		fmt.Printf("Deleted %s\n", fileID)
+	}
+	return nil
+}
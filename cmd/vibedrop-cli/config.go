@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// cliConfig is persisted between runs so commands don't need credentials every time
+type cliConfig struct {
+	Server       string    `json:"server"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"` // When Token expires
+}
+
+// configDir returns the directory holding the CLI's config and upload sessions
+func configDir() (string, error) {
+	if dir := os.Getenv("VIBEDROP_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(base, "vibedrop"), nil
+}
+
+func loadConfig() (*cliConfig, error) {
+	cfg := &cliConfig{Server: defaultServer}
+
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+	}
+
+	if server := os.Getenv("VIBEDROP_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	return cfg, nil
+}
+
+func saveConfig(cfg *cliConfig) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(dir, "config.json"), cfg)
+}
+
+// writeJSONFile writes v atomically with owner-only permissions (it may contain tokens)
+func writeJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// authedClient builds an SDK client from the saved config, failing if not logged in. An
+// access token that has expired or is about to is refreshed first and the new pair saved.
+func authedClient() (*vibedrop.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("not logged in; run \"vibedrop-cli login\" first")
+	}
+
+	client := vibedrop.NewClient(cfg.Server, vibedrop.WithToken(cfg.Token), vibedrop.WithRefreshToken(cfg.RefreshToken),
+		vibedrop.WithClientInfo("vibedrop-cli", version))
+	if cfg.RefreshToken != "" && time.Until(cfg.ExpiresAt) < time.Minute {
+		result, err := client.Refresh(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("session expired; run \"vibedrop-cli login\" again: %w", err)
+		}
+		cfg.Token, cfg.RefreshToken, cfg.ExpiresAt = result.Token, result.RefreshToken, result.ExpiresAt
+		if err := saveConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+// downloadState is the persisted progress of a parallel download: the parts already
+// written to the .part file and checked
+type downloadState struct {
+	FileID string       `json:"file_id"`
+	Size   int64        `json:"size"`
+	Done   map[int]bool `json:"done"` // By part number
+}
+
+func runGet(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	output := fs.String("o", "", "output path (default: the file's stored name)")
+	parallel := fs.Int("parallel", 1, "number of parts to download concurrently, each checked against its SHA-256 (0: server recommendation)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vibedrop-cli get [-o path] [--parallel n] <file-id>")
+	}
+	if *parallel < 0 {
+		return fmt.Errorf("--parallel cannot be negative")
+	}
+	fileID := fs.Arg(0)
+
+	client, err := authedClient()
+	if err != nil {
+		return err
+	}
+
+	file, err := client.GetFile(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = file.Filename
+	}
+	if *parallel != 1 {
+		return getParallel(ctx, client, file, *output, *parallel)
+	}
+	if _, err := os.Stat(*output + ".part.json"); err == nil {
+		return fmt.Errorf("a parallel download of %s is in progress; re-run with --parallel to resume it", *output)
+	}
+
+	link, err := client.DownloadURL(ctx, fileID)
+	if err != nil {
+		return err
+	}
+
+	// Download into a .part file so an interrupted transfer can resume with a range request
+	partPath := *output + ".part"
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	offset := info.Size()
+	if offset > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming download at %s\n", formatBytes(offset))
+	}
+
+	bar := newProgressBar(file.Filename, file.Size, offset)
+	etag, err := client.DownloadPresigned(ctx, link.URL, offset, out, bar.Add)
+	bar.Finish()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w (partial download kept; re-run to resume)", err)
+	}
+
+	if err := verifyDownload(ctx, client, fileID, partPath, etag); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	if err := os.Rename(partPath, *output); err != nil {
+		return err
+	}
+	fmt.Printf("Downloaded %s to %s\n", fileID, *output)
+	return nil
+}
+
+// verifyDownload recomputes the object's ETag from the downloaded bytes. A multipart ETag
+// is computed assuming the upload's standard chunk size; if it doesn't match, the object
+// may have parts of other sizes, as a delta upload's do, and the part map is checked instead.
+func verifyDownload(ctx context.Context, client *vibedrop.Client, fileID, path, etag string) error {
+	etag = strings.Trim(etag, `"`)
+	if etag == "" {
+		fmt.Fprintln(os.Stderr, "Warning: storage returned no ETag; skipping checksum verification")
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	parts := vibedrop.ParseETagParts(etag)
+	got, err := vibedrop.ComputeETag(file, info.Size(), vibedrop.DefaultChunkSize, parts)
+	if err != nil {
+		return fmt.Errorf("failed to checksum download: %w", err)
+	}
+	if got == etag {
+		return nil
+	}
+	if parts > 1 {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return verifyParts(ctx, client, fileID, file)
+	}
+	return errors.New("checksum mismatch: downloaded file is corrupt (ETag " + etag + ", computed " + got + ")")
+}
+
+// verifyParts checks downloaded content against the SHA-256 of each part in its part map
+func verifyParts(ctx context.Context, client *vibedrop.Client, fileID string, content io.Reader) error {
+	partMap, err := client.FileParts(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to get part map to verify download: %w", err)
+	}
+	for _, part := range partMap.Parts {
+		hash := sha256.New()
+		if _, err := io.CopyN(hash, content, part.Size); err != nil {
+			return fmt.Errorf("failed to checksum download: %w", err)
+		}
+		if got := hex.EncodeToString(hash.Sum(nil)); got != part.SHA256 {
+			return fmt.Errorf("checksum mismatch: downloaded file is corrupt (part %d has SHA-256 %s, want %s)", part.PartNumber, got, part.SHA256)
+		}
+	}
+	return nil
+}
+
+// getParallel downloads a file's parts concurrently into a .part file, checking each
+// against the part map. The parts done are saved alongside, so a re-run fetches the rest.
+func getParallel(ctx context.Context, client *vibedrop.Client, file *vibedrop.File, output string, parallel int) error {
+	partMap, err := client.FileParts(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+	if parallel == 0 {
+		parallel = defaultParallelParts
+		if partMap.Hints != nil && partMap.Hints.MaxParallelParts > 0 {
+			parallel = partMap.Hints.MaxParallelParts
+		}
+	}
+	policy := defaultRetryPolicy
+	if partMap.Hints != nil && partMap.Hints.Retry.MaxAttempts > 0 {
+		policy = partMap.Hints.Retry
+	}
+
+	partPath, statePath := output+".part", output+".part.json"
+	state, err := loadDownloadState(statePath)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.FileID != partMap.FileID || state.Size != partMap.Size || state.Done == nil {
+		state = &downloadState{FileID: partMap.FileID, Size: partMap.Size, Done: map[int]bool{}}
+	}
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := out.Truncate(partMap.Size); err != nil {
+		out.Close()
+		return err
+	}
+
+	var doneBytes int64
+	for _, part := range partMap.Parts {
+		if state.Done[part.PartNumber] {
+			doneBytes += part.Size
+		}
+	}
+	if doneBytes > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming download (%d/%d parts done)\n", len(state.Done), partMap.TotalParts)
+	}
+	bar := newProgressBar(file.Filename, partMap.Size, doneBytes)
+	err = getParts(ctx, client, &downloadLink{client: client, fileID: file.ID}, out, partMap, state, statePath, parallel, policy, bar)
+	bar.Finish()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w (progress saved; re-run the same command to resume)", err)
+	}
+
+	if err := os.Rename(partPath, output); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	fmt.Printf("Downloaded %s to %s\n", file.ID, output)
+	return nil
+}
+
+// getParts fetches every part not yet done with bounded parallelism, persisting progress
+// after each one
+func getParts(ctx context.Context, client *vibedrop.Client, link *downloadLink, out *os.File, partMap *vibedrop.FilePartMap, state *downloadState, statePath string, parallel int, policy vibedrop.RetryPolicy, bar *progressBar) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	pending := make(chan vibedrop.FilePart)
+
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range pending {
+				err := getPart(ctx, client, link, out, part, policy, bar)
+				mu.Lock()
+				if err == nil {
+					state.Done[part.PartNumber] = true
+					err = writeJSONFile(statePath, state)
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, part := range partMap.Parts {
+		if state.Done[part.PartNumber] {
+			continue
+		}
+		select {
+		case pending <- part:
+		case <-ctx.Done():
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// getPart downloads one part into place with retries; a failed attempt's progress is
+// rolled back since the part is fetched again from its start
+func getPart(ctx context.Context, client *vibedrop.Client, link *downloadLink, out *os.File, part vibedrop.FilePart, policy vibedrop.RetryPolicy, bar *progressBar) error {
+	for attempt := 1; ; attempt++ {
+		presignedURL, err := link.url(ctx)
+		if err != nil {
+			return err
+		}
+
+		var got int64
+		err = client.DownloadPart(ctx, presignedURL, part, io.NewOffsetWriter(out, part.Offset), func(n int64) {
+			got += n
+			bar.Add(n)
+		})
+		if err == nil {
+			return nil
+		}
+		bar.Add(-got)
+		if attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+			return fmt.Errorf("part %d: %w", part.PartNumber, err)
+		}
+
+		delay := policy.Backoff(attempt)
+		fmt.Fprintf(os.Stderr, "\nPart %d failed (%v); retrying in %s\n", part.PartNumber, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// downloadLink hands out a file's presigned download URL, asking for a new one when the
+// current one is within urlRefreshMargin of expiring
+type downloadLink struct {
+	client  *vibedrop.Client
+	fileID  string
+	mu      sync.Mutex
+	current *vibedrop.DownloadURL
+}
+
+func (l *downloadLink) url(ctx context.Context) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || time.Until(l.current.ExpiresAt) < urlRefreshMargin {
+		fresh, err := l.client.DownloadURL(ctx, l.fileID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get download URL: %w", err)
+		}
+		l.current = fresh
+	}
+	return l.current.URL, nil
+}
+
+func loadDownloadState(path string) (*downloadState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download progress: %w", err)
+	}
+
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse download progress %s: %w", path, err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// version is reported to the server in X-Client-Info; release builds set it with
+// -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+const usage = `Usage: vibedrop-cli <command> [flags]
+
+Commands:
+  login   Authenticate and store a token locally
+  put     Upload a file (large files upload in parallel chunks and resume after interruption)
+          or, with --delta, only what changed since an uploaded version
+  get     Download a file (partial downloads resume automatically; --parallel fetches
+          checked parts concurrently)
+  ls      List your files
+  rm      Delete one or more files
+
+Run "vibedrop-cli <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// Cancel in-flight transfers on Ctrl-C; upload progress is persisted so it can resume
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "login":
+		err = runLogin(ctx, os.Args[2:])
+	case "put":
+		err = runPut(ctx, os.Args[2:])
+	case "get":
+		err = runGet(ctx, os.Args[2:])
+	case "ls":
+		err = runList(ctx, os.Args[2:])
+	case "rm":
+		err = runRemove(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
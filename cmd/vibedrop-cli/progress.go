@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// progressBar renders transfer progress to stderr, safe for concurrent chunk workers
+type progressBar struct {
+	label    string
+	total    int64
+	done     int64
+	started  time.Time
+	rendered time.Time
+	mu       sync.Mutex
+}
+
+func newProgressBar(label string, total, alreadyDone int64) *progressBar {
+	return &progressBar{label: label, total: total, done: alreadyDone, started: time.Now()}
+}
+
+// Add records n more bytes transferred
+func (p *progressBar) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if time.Since(p.rendered) >= 200*time.Millisecond {
+		p.render()
+	}
+}
+
+// Finish draws the final state and moves to a new line
+func (p *progressBar) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.render()
+	fmt.Fprintln(os.Stderr)
+}
+
+func (p *progressBar) render() {
+	p.rendered = time.Now()
+
+	fraction := 1.0
+	if p.total > 0 {
+		fraction = float64(p.done) / float64(p.total)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	rate := float64(p.done) / time.Since(p.started).Seconds()
+	fmt.Fprintf(os.Stderr, "\r%s [%s] %5.1f%% %s/%s %s/s   ",
+		p.label, bar, fraction*100, formatBytes(p.done), formatBytes(p.total), formatBytes(int64(rate)))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+// defaultParallelParts is used when the server sends no parallelism hint
+const defaultParallelParts = 4
+
+// defaultRetryPolicy is used when the server sends no retry hint
+var defaultRetryPolicy = vibedrop.RetryPolicy{
+	MaxAttempts:          3,
+	InitialBackoffMillis: 1000,
+	MaxBackoffMillis:     30000,
+	RetryableStatusCodes: []int{408, 429, 500, 502, 503, 504},
+}
+
+// uploadSession is the persisted state of a multipart upload, so an interrupted
+// transfer can pick up where it left off instead of starting over
+type uploadSession struct {
+	Path    string                `json:"path"`
+	Size    int64                 `json:"size"`
+	ModTime time.Time             `json:"mod_time"`
+	FileID  string                `json:"file_id"`
+	Hints   *vibedrop.UploadHints `json:"hints,omitempty"`
+	Chunks  []sessionChunk        `json:"chunks"`
+	// For a delta upload: the bytes the server copied from the base, which aren't chunks
+	CopiedBytes int64 `json:"copied_bytes,omitempty"`
+}
+
+type sessionChunk struct {
+	vibedrop.ChunkURL
+	Offset int64  `json:"offset"`
+	ETag   string `json:"etag,omitempty"`
+	Done   bool   `json:"done"`
+}
+
+func runPut(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	name := fs.String("name", "", "name to store the file as (default: local filename)")
+	parallel := fs.Int("parallel", 0, "number of chunks to upload concurrently (default: server recommendation)")
+	restart := fs.Bool("restart", false, "discard any saved progress and start a new upload")
+	deltaBase := fs.String("delta", "", "ID of an uploaded version of the file; send only the blocks that changed since, as a new version")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vibedrop-cli put [flags] <path>")
+	}
+	if *parallel < 0 {
+		return fmt.Errorf("--parallel cannot be negative")
+	}
+	if *deltaBase != "" && *name != "" {
+		return fmt.Errorf("--name can't be used with --delta; the new version keeps the earlier version's name")
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = filepath.Base(path)
+	}
+
+	client, err := authedClient()
+	if err != nil {
+		return err
+	}
+
+	sessionPath, err := sessionFile(path, info)
+	if err != nil {
+		return err
+	}
+	if *restart {
+		os.Remove(sessionPath)
+	}
+
+	session, err := loadSession(sessionPath)
+	if err != nil {
+		return err
+	}
+
+	if session == nil && *deltaBase != "" {
+		upload, err := requestDelta(ctx, client, path, info.Size(), *deltaBase)
+		if err != nil {
+			return err
+		}
+		session = newDeltaSession(path, info, upload)
+		if err := writeJSONFile(sessionPath, session); err != nil {
+			return err
+		}
+	} else if session == nil {
+		upload, err := client.RequestUpload(ctx, *name, info.Size())
+		if err != nil {
+			return err
+		}
+		if c := upload.Collision; c != nil {
+			if c.Strategy == "version" {
+				fmt.Printf("%s already exists; storing this as version %d\n", c.RequestedFilename, c.Version)
+			} else {
+				fmt.Printf("%s already exists; storing this as %s\n", c.RequestedFilename, upload.Filename)
+			}
+		}
+
+		if upload.UploadType != "multipart" {
+			return putSingle(ctx, client, path, info.Size(), upload)
+		}
+
+		session = newSession(path, info, upload)
+		if err := writeJSONFile(sessionPath, session); err != nil {
+			return err
+		}
+	} else {
+		if err := syncSession(ctx, client, session); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not check chunk status with the server (%v); resuming from local progress\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Resuming upload %s (%d/%d chunks done)\n", session.FileID, countDone(session), len(session.Chunks))
+	}
+
+	if *parallel == 0 {
+		*parallel = defaultParallelParts
+		if session.Hints != nil && session.Hints.MaxParallelParts > 0 {
+			*parallel = session.Hints.MaxParallelParts
+		}
+	}
+
+	if err := putChunks(ctx, client, session, sessionPath, *parallel); err != nil {
+		return fmt.Errorf("%w (progress saved; re-run the same command to resume)", err)
+	}
+
+	if err := client.CompleteUpload(ctx, session.FileID); err != nil {
+		return fmt.Errorf("failed to complete upload: %w (progress saved; re-run to retry)", err)
+	}
+
+	os.Remove(sessionPath)
+	fmt.Printf("Uploaded %s as %s\n", filepath.Base(path), session.FileID)
+	return nil
+}
+
+func putSingle(ctx context.Context, client *vibedrop.Client, path string, size int64, upload *vibedrop.UploadURLResponse) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bar := newProgressBar(filepath.Base(path), size, 0)
+	if _, err := client.PutPresigned(ctx, upload.URL, file, size, bar.Add); err != nil {
+		return err
+	}
+	bar.Finish()
+
+	fmt.Printf("Uploaded %s as %s\n", filepath.Base(path), upload.FileID)
+	return nil
+}
+
+// putChunks uploads every pending chunk with bounded parallelism, persisting progress after each one
+func putChunks(ctx context.Context, client *vibedrop.Client, session *uploadSession, sessionPath string, parallel int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	doneBytes := session.CopiedBytes
+	for _, chunk := range session.Chunks {
+		if chunk.Done {
+			doneBytes += chunk.Size
+		}
+	}
+	bar := newProgressBar(filepath.Base(session.Path), session.Size, doneBytes)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	pending := make(chan int)
+
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				etag, err := putChunk(ctx, client, session, i, bar)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					session.Chunks[i].ETag = etag
+					session.Chunks[i].Done = true
+					if saveErr := writeJSONFile(sessionPath, session); saveErr != nil && firstErr == nil {
+						firstErr = saveErr
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, chunk := range session.Chunks {
+		if chunk.Done {
+			continue
+		}
+		select {
+		case pending <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(pending)
+	wg.Wait()
+	bar.Finish()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// urlRefreshMargin is how close to expiry a chunk's URL may be before it is replaced
+const urlRefreshMargin = time.Minute
+
+func putChunk(ctx context.Context, client *vibedrop.Client, session *uploadSession, i int, bar *progressBar) (string, error) {
+	chunk := session.Chunks[i]
+
+	policy := defaultRetryPolicy
+	if session.Hints != nil && session.Hints.Retry.MaxAttempts > 0 {
+		policy = session.Hints.Retry
+	}
+
+	var etag string
+	var err error
+	for attempt := 1; ; attempt++ {
+		// Chunks queued behind a long upload can outlive their URL; the fresh one is only
+		// kept in memory since resuming asks the server for new URLs anyway
+		if time.Until(chunk.ExpiresAt) < urlRefreshMargin {
+			fresh, refreshErr := client.RefreshChunkURL(ctx, session.FileID, chunk.ChunkNumber)
+			if refreshErr != nil {
+				return "", fmt.Errorf("chunk %d: failed to refresh upload URL: %w", chunk.ChunkNumber, refreshErr)
+			}
+			chunk.URL, chunk.ExpiresAt = fresh.URL, fresh.ExpiresAt
+		}
+
+		etag, err = putChunkOnce(ctx, client, session.Path, chunk, bar)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+			break
+		}
+
+		delay := policy.Backoff(attempt)
+		fmt.Fprintf(os.Stderr, "\nChunk %d failed (%v); retrying in %s\n", chunk.ChunkNumber, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("chunk %d: %w", chunk.ChunkNumber, err)
+	}
+
+	if _, err := client.CompleteChunk(ctx, session.FileID, chunk.ChunkNumber, etag); err != nil {
+		bar.Add(-chunk.Size)
+		return "", fmt.Errorf("chunk %d: failed to report completion: %w", chunk.ChunkNumber, err)
+	}
+
+	return etag, nil
+}
+
+// putChunkOnce sends one chunk; on failure its progress is rolled back since it will be re-sent from the start
+func putChunkOnce(ctx context.Context, client *vibedrop.Client, path string, chunk sessionChunk, bar *progressBar) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	section := io.NewSectionReader(file, chunk.Offset, chunk.Size)
+	var sent int64
+	etag, err := client.PutPresigned(ctx, chunk.URL, section, chunk.Size, func(n int64) {
+		sent += n
+		bar.Add(n)
+	})
+	if err != nil {
+		bar.Add(-sent)
+		return "", err
+	}
+	return etag, nil
+}
+
+func newSession(path string, info os.FileInfo, upload *vibedrop.UploadURLResponse) *uploadSession {
+	session := &uploadSession{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		FileID:  upload.FileID,
+		Hints:   upload.Hints,
+	}
+
+	var offset int64
+	for _, chunk := range upload.Chunks {
+		session.Chunks = append(session.Chunks, sessionChunk{ChunkURL: chunk, Offset: offset})
+		offset += chunk.Size
+	}
+	return session
+}
+
+// requestDelta plans the file against the block manifest of version baseID and starts a
+// delta upload of it, which sends only what the plan couldn't copy from that version
+func requestDelta(ctx context.Context, client *vibedrop.Client, path string, size int64, baseID string) (*vibedrop.DeltaUploadResponse, error) {
+	manifest, err := client.BlockManifest(ctx, baseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block manifest of %s: %w", baseID, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	parts, err := vibedrop.PlanDelta(file, size, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan delta upload: %w", err)
+	}
+
+	upload, err := client.RequestDeltaUpload(ctx, baseID, parts)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Reusing %d of %d bytes from %s; storing this as version %d of %s\n", upload.CopiedBytes, size, baseID, upload.Version, upload.Filename)
+	return upload, nil
+}
+
+func newDeltaSession(path string, info os.FileInfo, upload *vibedrop.DeltaUploadResponse) *uploadSession {
+	session := &uploadSession{
+		Path:        path,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		FileID:      upload.FileID,
+		Hints:       upload.Hints,
+		Chunks:      []sessionChunk{},
+		CopiedBytes: upload.CopiedBytes,
+	}
+	for _, chunk := range upload.Chunks {
+		session.Chunks = append(session.Chunks, sessionChunk{ChunkURL: chunk.ChunkURL, Offset: chunk.Offset})
+	}
+	return session
+}
+
+// syncSession takes the server's chunk records as the truth about which parts are done,
+// so chunks reported after the session was last saved are skipped and chunks the server
+// has since marked failed are sent again. Chunks still to send get the fresh URLs the
+// server issues, since the saved ones may have expired.
+func syncSession(ctx context.Context, client *vibedrop.Client, session *uploadSession) error {
+	status, err := client.UploadStatus(ctx, session.FileID)
+	if err != nil {
+		return err
+	}
+
+	byNumber := make(map[int]vibedrop.ChunkStatus, len(status.Chunks))
+	for _, chunk := range status.Chunks {
+		byNumber[chunk.ChunkNumber] = chunk
+	}
+	urls := make(map[int]vibedrop.ChunkURL, len(status.RemainingURLs))
+	for _, chunkURL := range status.RemainingURLs {
+		urls[chunkURL.ChunkNumber] = chunkURL
+	}
+	for i := range session.Chunks {
+		chunk := &session.Chunks[i]
+		remote, ok := byNumber[chunk.ChunkNumber]
+		chunk.Done = ok && remote.Status == "uploaded"
+		if chunk.Done {
+			chunk.ETag = remote.ETag
+		} else if fresh, ok := urls[chunk.ChunkNumber]; ok {
+			chunk.URL = fresh.URL
+			chunk.ExpiresAt = fresh.ExpiresAt
+		}
+	}
+	return nil
+}
+
+// sessionFile identifies a session by the file's path, size and modification time,
+// so a changed file never resumes onto stale parts
+func sessionFile(path string, info os.FileInfo) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	id := sha256.Sum256([]byte(path + "|" + strconv.FormatInt(info.Size(), 10) + "|" + info.ModTime().UTC().Format(time.RFC3339Nano)))
+	return filepath.Join(dir, "sessions", hex.EncodeToString(id[:16])+".json"), nil
+}
+
+func loadSession(path string) (*uploadSession, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload session: %w", err)
+	}
+
+	var session uploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse upload session %s: %w", path, err)
+	}
+	return &session, nil
+}
+
+func countDone(session *uploadSession) int {
+	done := 0
+	for _, chunk := range session.Chunks {
+		if chunk.Done {
+			done++
+		}
+	}
+	return done
+}
@@ -0,0 +1,75 @@
+// vibedrop-gen generates the TypeScript and Python API clients from the gateway's
+// OpenAPI spec. By default it uses the spec compiled into the gateway; pass
+// -spec with a file path or a running gateway's /openapi.json URL to use another.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/apigateway/openapi"
+	"vibe-drop/internal/codegen"
+	"vibe-drop/internal/registry"
+)
+
+func main() {
+	specSource := flag.String("spec", "", "OpenAPI spec file or URL (default: the gateway's built-in spec)")
+	outDir := flag.String("out", "clients", "output directory for generated clients")
+	flag.Parse()
+
+	data, err := readSpec(*specSource)
+	if err != nil {
+		log.Fatalf("Failed to read OpenAPI spec: %v", err)
+	}
+
+	doc, err := codegen.Parse(data)
+	if err != nil {
+		log.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	// A spec from another build may describe routes this one's registry doesn't have
+	if err := registry.CheckSpec(doc); err != nil {
+		log.Printf("Warning: OpenAPI spec differs from the route registry:\n%v", err)
+	}
+
+	outputs := map[string]string{
+		filepath.Join("typescript", "vibedrop.ts"):    codegen.TypeScript(doc),
+		filepath.Join("python", "vibedrop_client.py"): codegen.Python(doc),
+	}
+	for name, content := range outputs {
+		path := filepath.Join(*outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Fatalf("Failed to create output directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		fmt.Printf("Generated %s\n", path)
+	}
+}
+
+func readSpec(source string) ([]byte, error) {
+	switch {
+	case source == "":
+		return openapi.Spec(), nil
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned %s", source, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	default:
+		return os.ReadFile(source)
+	}
+}
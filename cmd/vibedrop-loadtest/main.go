@@ -0,0 +1,249 @@
+// vibedrop-loadtest simulates concurrent users uploading and downloading a mix of
+// file sizes through the API Gateway and reports latency percentiles and error
+// rates per operation, for capacity planning before releases.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+// sizeWeight is one entry of the file size mix, e.g. "1MB:30"
+type sizeWeight struct {
+	size   int64
+	weight int
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "API gateway URL")
+	users := flag.Int("users", 10, "number of concurrent virtual users")
+	duration := flag.Duration("duration", time.Minute, "how long to generate load")
+	sizes := flag.String("sizes", "4KB:60,1MB:30,25MB:10", "file size mix as size:weight pairs")
+	apiKey := flag.String("api-key", "", "gateway API key shared by all users (default: register a throwaway account per user)")
+	think := flag.Duration("think", 0, "pause between iterations of each user")
+	cleanup := flag.Bool("cleanup", true, "delete each file after downloading it")
+	flag.Parse()
+
+	mix, err := parseSizeMix(*sizes)
+	if err != nil {
+		log.Fatalf("Invalid -sizes: %v", err)
+	}
+	if *users < 1 {
+		log.Fatal("-users must be at least 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// One random buffer sized for the largest file; each upload reads a prefix of it
+	var maxSize int64
+	for _, entry := range mix {
+		if entry.size > maxSize {
+			maxSize = entry.size
+		}
+	}
+	payload := make([]byte, maxSize)
+	if _, err := rand.Read(payload); err != nil {
+		log.Fatalf("Failed to generate payload: %v", err)
+	}
+
+	log.Printf("Preparing %d virtual users against %s", *users, *server)
+	clients, err := setupClients(ctx, *server, *users, *apiKey)
+	if err != nil {
+		log.Fatalf("Setup failed: %v", err)
+	}
+
+	log.Printf("Running for %s with size mix %s", *duration, *sizes)
+	rec := newRecorder()
+	var iterations int64
+
+	runCtx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(id int, client *vibedrop.Client) {
+			defer wg.Done()
+			rng := mathrand.New(mathrand.NewSource(time.Now().UnixNano() + int64(id)))
+			for runCtx.Err() == nil {
+				size := pickSize(rng, mix)
+				runIteration(runCtx, client, rec, payload[:size], fmt.Sprintf("loadtest-%d-%d.bin", id, rng.Int63()), *cleanup)
+				atomic.AddInt64(&iterations, 1)
+
+				if *think > 0 {
+					select {
+					case <-time.After(*think):
+					case <-runCtx.Done():
+					}
+				}
+			}
+		}(i, client)
+	}
+	wg.Wait()
+
+	fmt.Println()
+	rec.report(os.Stdout, time.Since(start), atomic.LoadInt64(&iterations))
+}
+
+// runIteration performs one upload → download (→ delete) cycle, recording each step.
+// Steps cut short by the end of the run are not counted as errors.
+func runIteration(ctx context.Context, client *vibedrop.Client, rec *recorder, data []byte, filename string, cleanup bool) {
+	measure := func(op string, fn func() error) error {
+		start := time.Now()
+		err := fn()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rec.record(op, time.Since(start), err)
+		return err
+	}
+
+	var upload *vibedrop.UploadURLResponse
+	if err := measure(opRequestUpload, func() (err error) {
+		upload, err = client.RequestUpload(ctx, filename, int64(len(data)))
+		return err
+	}); err != nil {
+		return
+	}
+	if upload.UploadType != "single" {
+		return // the mix only contains sizes below the multipart threshold
+	}
+
+	if err := measure(opPutObject, func() error {
+		_, err := client.PutPresigned(ctx, upload.URL, bytes.NewReader(data), int64(len(data)), nil)
+		return err
+	}); err != nil {
+		return
+	}
+	rec.addBytes(int64(len(data)), 0)
+
+	var link *vibedrop.DownloadURL
+	if err := measure(opDownloadURL, func() (err error) {
+		link, err = client.DownloadURL(ctx, upload.FileID)
+		return err
+	}); err != nil {
+		return
+	}
+
+	var received countingWriter
+	if err := measure(opGetObject, func() error {
+		_, err := client.DownloadPresigned(ctx, link.URL, 0, &received, nil)
+		if err == nil && int64(received) != int64(len(data)) {
+			err = fmt.Errorf("downloaded %d bytes, expected %d", received, len(data))
+		}
+		return err
+	}); err != nil {
+		return
+	}
+	rec.addBytes(0, int64(received))
+
+	if cleanup {
+		measure(opDelete, func() error {
+			return client.DeleteFile(ctx, upload.FileID)
+		})
+	}
+}
+
+// setupClients gives every virtual user its own authenticated client
+func setupClients(ctx context.Context, server string, users int, apiKey string) ([]*vibedrop.Client, error) {
+	clients := make([]*vibedrop.Client, users)
+	if apiKey != "" {
+		for i := range clients {
+			clients[i] = vibedrop.NewClient(server, vibedrop.WithAPIKey(apiKey))
+		}
+		return clients, nil
+	}
+
+	runID := strconv.FormatInt(time.Now().Unix(), 36)
+	for i := range clients {
+		client := vibedrop.NewClient(server)
+		username := fmt.Sprintf("loadtest-%s-%d", runID, i)
+		if _, err := client.Register(ctx, username, username+"@loadtest.invalid", "LoadTest-1"+runID+"!"); err != nil {
+			return nil, fmt.Errorf("registering %s: %w", username, err)
+		}
+		clients[i] = client
+	}
+	return clients, nil
+}
+
+func parseSizeMix(spec string) ([]sizeWeight, error) {
+	var mix []sizeWeight
+	for _, part := range strings.Split(spec, ",") {
+		sizeStr, weightStr, found := strings.Cut(strings.TrimSpace(part), ":")
+		weight := 1
+		if found {
+			w, err := strconv.Atoi(weightStr)
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("invalid weight %q", weightStr)
+			}
+			weight = w
+		}
+		size, err := parseSize(sizeStr)
+		if err != nil {
+			return nil, err
+		}
+		mix = append(mix, sizeWeight{size: size, weight: weight})
+	}
+	return mix, nil
+}
+
+// parseSize accepts plain bytes or a KB/MB/GB suffix (powers of 1024)
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(s, suffix) {
+			multiplier = m
+			s = strings.TrimSuffix(s, suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(s, "B"), 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+func pickSize(rng *mathrand.Rand, mix []sizeWeight) int64 {
+	total := 0
+	for _, entry := range mix {
+		total += entry.weight
+	}
+	n := rng.Intn(total)
+	for _, entry := range mix {
+		if n < entry.weight {
+			return entry.size
+		}
+		n -= entry.weight
+	}
+	return mix[len(mix)-1].size
+}
+
+// countingWriter discards downloaded bytes, counting them
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+var _ io.Writer = (*countingWriter)(nil)
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Operations measured by the harness, in the order a virtual user performs them
+const (
+	opRequestUpload = "request-upload"
+	opPutObject     = "put-object"
+	opDownloadURL   = "download-url"
+	opGetObject     = "get-object"
+	opDelete        = "delete"
+)
+
+var reportOrder = []string{opRequestUpload, opPutObject, opDownloadURL, opGetObject, opDelete}
+
+// recorder collects latencies and errors per operation from concurrent users
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	lastError map[string]string
+	bytesUp   int64
+	bytesDown int64
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		lastError: make(map[string]string),
+	}
+}
+
+// record stores one operation's latency, or its error
+func (r *recorder) record(op string, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors[op]++
+		r.lastError[op] = err.Error()
+	} else {
+		r.latencies[op] = append(r.latencies[op], elapsed)
+	}
+}
+
+func (r *recorder) addBytes(up, down int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytesUp += up
+	r.bytesDown += down
+}
+
+// percentile returns the p-th percentile (0-100) of sorted durations using nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// report writes a latency/error table and overall throughput
+func (r *recorder) report(w io.Writer, elapsed time.Duration, iterations int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\tok\terrors\terror %\tp50\tp90\tp99\tmax\t")
+
+	var totalOK, totalErr int
+	for _, op := range reportOrder {
+		latencies := r.latencies[op]
+		errors := r.errors[op]
+		if len(latencies) == 0 && errors == 0 {
+			continue
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		totalOK += len(latencies)
+		totalErr += errors
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%s\t%s\t%s\t%s\t\n", op, len(latencies), errors,
+			errorRate(len(latencies), errors),
+			round(percentile(latencies, 50)), round(percentile(latencies, 90)),
+			round(percentile(latencies, 99)), round(percentile(latencies, 100)))
+	}
+	tw.Flush()
+
+	seconds := elapsed.Seconds()
+	fmt.Fprintf(w, "\nDuration:     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Iterations:   %d (%.2f/s)\n", iterations, float64(iterations)/seconds)
+	fmt.Fprintf(w, "Requests:     %d (%.2f/s), %.2f%% errors\n", totalOK+totalErr, float64(totalOK+totalErr)/seconds, errorRate(totalOK, totalErr))
+	fmt.Fprintf(w, "Uploaded:     %s (%s/s)\n", formatBytes(r.bytesUp), formatBytes(int64(float64(r.bytesUp)/seconds)))
+	fmt.Fprintf(w, "Downloaded:   %s (%s/s)\n", formatBytes(r.bytesDown), formatBytes(int64(float64(r.bytesDown)/seconds)))
+
+	if len(r.lastError) > 0 {
+		fmt.Fprintln(w, "\nLast error per operation:")
+		for _, op := range reportOrder {
+			if msg, ok := r.lastError[op]; ok {
+				fmt.Fprintf(w, "  %s: %s\n", op, msg)
+			}
+		}
+	}
+}
+
+func errorRate(ok, errors int) float64 {
+	if ok+errors == 0 {
+		return 0
+	}
+	return float64(errors) / float64(ok+errors) * 100
+}
+
+func round(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(10 * time.Millisecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -3,15 +3,88 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"vibe-drop/internal/auth"
 )
 
 type Config struct {
 	Port           string
 	FileServiceURL string
 	Environment    string // dev, staging, prod
+	APIKeysFile    string // JSON file of third-party API keys (API key auth disabled if empty)
+	JWTSecret      string // Must match the file service's signing secret
+	AdminAPIKey    string // Operator key for the gateway's own /admin endpoints (disabled if empty)
+
+	// Secret the S3-compatible API's secret access keys are derived from, one per API key
+	// (the API is disabled if empty). Changing it changes every key's S3 credentials.
+	S3CredentialsSecret string
+
+	// Token signing keys and issuer, as on the file service (see its config). Tokens the
+	// gateway mints for API-key requests are signed with the first key.
+	JWTKeys   []auth.SigningKey
+	JWTIssuer string
+
+	// The file service's JWKS, e.g. http://file-service:8081/.well-known/jwks.json, so
+	// tokens it signs with RS256 or ES256 are checked without a shared secret
+	JWTJWKSURL string
+
+	// Whether the gateway checks the token and scope of requests to signed-in routes itself,
+	// turning bad ones away before they reach the file service
+	GatewayAuth bool
+
+	// How file and auth operations reach the file service: "http" proxies them to
+	// FileServiceURL, "grpc" calls its gRPC API on the same host at FileServiceGRPCPort.
+	// Other operations are proxied over HTTP either way.
+	FileServiceProtocol string
+	FileServiceGRPCPort int
+
+	// Traffic mirroring: a percentage of read requests is also sent to a second
+	// file service, whose responses are discarded (disabled if the URL is empty)
+	ShadowFileServiceURL string
+	ShadowPercent        int
+
+	// Canary routing: a percentage of requests, plus any sent with X-VD-Canary: true,
+	// is served by a second file service instead of the primary (disabled if the URL is empty)
+	CanaryFileServiceURL string
+	CanaryPercent        int
+
+	// Automatic failover: the primary's health is checked every FailoverCheckInterval, and
+	// after FailoverThreshold failed checks in a row traffic moves to the standby file
+	// service, then back after FailbackThreshold passed checks. Each switch is posted to
+	// FailoverAlertWebhookURL (no alert if empty). Disabled if the standby URL is empty.
+	StandbyFileServiceURL   string
+	FailoverCheckInterval   time.Duration
+	FailoverThreshold       int
+	FailbackThreshold       int
+	FailoverAlertWebhookURL string
+
+	// Tracing: spans are exported to an OTLP/HTTP collector at this base URL, e.g.
+	// http://localhost:4318 (export disabled if empty)
+	OTLPEndpoint       string
+	TraceSamplePercent int // Share of new traces recorded; traces started upstream keep their decision
+
+	LogLevel string // Least severe level logged: debug, info, warn or error
+
+	// Access logs: a line per request on stdout, as "json" or "clf" (disabled if empty),
+	// with the JSON fields listed (all if empty), and for the routes in AccessLogSampling
+	// only that percent of requests, e.g. {"GET /files": 10}
+	AccessLogFormat   string
+	AccessLogFields   []string
+	AccessLogSampling map[string]int
+
+	// Rate limiting: "ip" limits every request by client IP; "user" limits requests with a
+	// valid JWT by its user, up to the UserRateLimit* counts per UserRateLimitWindow for
+	// each class of route, and the rest by IP
+	RateLimitMode         string
+	UserRateLimitWindow   time.Duration
+	UserRateLimitAuth     int
+	UserRateLimitUpload   int
+	UserRateLimitDownload int
+	UserRateLimitDefault  int
 }
 
 func Load() *Config {
@@ -25,12 +98,62 @@ func Load() *Config {
 		Port:           getEnv("API_GATEWAY_PORT", getDefaultPort(env)),
 		FileServiceURL: getRequiredEnv("FILE_SERVICE_URL"),
 		Environment:    env,
+		APIKeysFile:    os.Getenv("API_KEYS_FILE"),
+		AdminAPIKey:    os.Getenv("ADMIN_API_KEY"),
+		JWTKeys:        getSigningKeysEnv("JWT_KEYS"),
+		JWTIssuer:      os.Getenv("JWT_ISSUER"),
+		JWTJWKSURL:     os.Getenv("JWT_JWKS_URL"),
+		GatewayAuth:    getBoolEnv("GATEWAY_AUTH", false),
+
+		S3CredentialsSecret: os.Getenv("S3_CREDENTIALS_SECRET"),
+
+		FileServiceProtocol: getEnv("FILE_SERVICE_PROTOCOL", "http"),
+		FileServiceGRPCPort: getPortEnv("FILE_SERVICE_GRPC_PORT", 9081),
+
+		ShadowFileServiceURL: os.Getenv("SHADOW_FILE_SERVICE_URL"),
+		ShadowPercent:        getPercentEnv("SHADOW_PERCENT", 0),
+		CanaryFileServiceURL: os.Getenv("CANARY_FILE_SERVICE_URL"),
+		CanaryPercent:        getPercentEnv("CANARY_PERCENT", 0),
+
+		StandbyFileServiceURL:   os.Getenv("STANDBY_FILE_SERVICE_URL"),
+		FailoverCheckInterval:   getDurationEnv("FAILOVER_CHECK_INTERVAL", 5*time.Second),
+		FailoverThreshold:       getCountEnv("FAILOVER_THRESHOLD", 3),
+		FailbackThreshold:       getCountEnv("FAILBACK_THRESHOLD", 6),
+		FailoverAlertWebhookURL: os.Getenv("FAILOVER_ALERT_WEBHOOK_URL"),
+
+		OTLPEndpoint:       os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		TraceSamplePercent: getPercentEnv("TRACE_SAMPLE_PERCENT", 100),
+
+		LogLevel: getEnv("LOG_LEVEL", "info"),
+
+		AccessLogFormat:   os.Getenv("ACCESS_LOG_FORMAT"),
+		AccessLogFields:   getListEnv("ACCESS_LOG_FIELDS"),
+		AccessLogSampling: getSamplingEnv("ACCESS_LOG_SAMPLE"),
+
+		RateLimitMode:         getEnv("RATE_LIMIT_MODE", "ip"),
+		UserRateLimitWindow:   getDurationEnv("USER_RATE_LIMIT_WINDOW", time.Minute),
+		UserRateLimitAuth:     getCountEnv("USER_RATE_LIMIT_AUTH", 10),
+		UserRateLimitUpload:   getCountEnv("USER_RATE_LIMIT_UPLOAD", 120),
+		UserRateLimitDownload: getCountEnv("USER_RATE_LIMIT_DOWNLOAD", 120),
+		UserRateLimitDefault:  getCountEnv("USER_RATE_LIMIT_DEFAULT", 120),
+	}
+
+	// With keys, an unset secret means tokens must carry a key ID
+	cfg.JWTSecret = os.Getenv("JWT_SECRET")
+	if cfg.JWTSecret == "" && len(cfg.JWTKeys) == 0 && cfg.JWTJWKSURL == "" {
+		cfg.JWTSecret = auth.DevelopmentSecret
 	}
 
 	validateConfig(cfg)
 	return cfg
 }
 
+// JWT is how tokens are checked and, for API-key requests, signed. The gateway only mints
+// scoped tokens, which set their own expiry.
+func (c *Config) JWT() auth.JWTConfig {
+	return auth.JWTConfig{Secret: c.JWTSecret, Keys: c.JWTKeys, Issuer: c.JWTIssuer, JWKSURL: c.JWTJWKSURL}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -38,6 +161,100 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getSigningKeysEnv reads JWT signing keys written as comma-separated id:secret pairs
+func getSigningKeysEnv(key string) []auth.SigningKey {
+	keys, err := auth.ParseSigningKeys(os.Getenv(key))
+	if err != nil {
+		log.Fatalf("Invalid value for %s: %v", key, err)
+	}
+	return keys
+}
+
+// getListEnv splits a comma-separated variable, dropping empty entries
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getSamplingEnv reads comma-separated route=percent pairs, e.g. "GET /files=10"
+func getSamplingEnv(key string) map[string]int {
+	sampling := make(map[string]int)
+	for _, entry := range getListEnv(key) {
+		route, value, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || n < 0 || n > 100 {
+			log.Fatalf("Invalid value for %s: %q must be a route and a percentage, e.g. GET /files=10", key, entry)
+		}
+		sampling[strings.TrimSpace(route)] = n
+	}
+	return sampling
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid value for %s: must be true or false", key)
+	}
+	return b
+}
+
+func getPercentEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > 100 {
+		log.Fatalf("Invalid value for %s: must be an integer from 0 to 100", key)
+	}
+	return n
+}
+
+func getCountEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Fatalf("Invalid value for %s: must be a positive integer", key)
+	}
+	return n
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Invalid value for %s: must be a positive duration such as 1m", key)
+	}
+	return d
+}
+
+func getPortEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 65535 {
+		log.Fatalf("Invalid value for %s: must be a port number", key)
+	}
+	return n
+}
+
 func getRequiredEnv(key string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -68,7 +285,73 @@ func validateConfig(cfg *Config) {
 		errors = append(errors, "FILE_SERVICE_URL should not use localhost in non-dev environments")
 	}
 	
+	if cfg.Environment != "dev" && cfg.APIKeysFile != "" && usesDevelopmentSecret(cfg) {
+		errors = append(errors, "JWT_SECRET or JWT_KEYS must be set when API keys are enabled outside dev")
+	}
+	
+	if cfg.APIKeysFile != "" && cfg.JWTSecret == "" && len(cfg.JWTKeys) == 0 {
+		errors = append(errors, "API keys need JWT_SECRET or JWT_KEYS to sign their tokens, even with JWT_JWKS_URL")
+	}
+	
+	if cfg.S3CredentialsSecret != "" && cfg.APIKeysFile == "" {
+		errors = append(errors, "API_KEYS_FILE must be set when S3_CREDENTIALS_SECRET is, since S3 credentials belong to API keys")
+	}
+	
+	if cfg.JWTJWKSURL != "" && !strings.HasPrefix(cfg.JWTJWKSURL, "http://") && !strings.HasPrefix(cfg.JWTJWKSURL, "https://") {
+		errors = append(errors, "JWT_JWKS_URL must be an http:// or https:// URL")
+	}
+	
+	if cfg.FileServiceProtocol != "http" && cfg.FileServiceProtocol != "grpc" {
+		errors = append(errors, "FILE_SERVICE_PROTOCOL must be http or grpc")
+	}
+	
+	if cfg.ShadowPercent > 0 && cfg.ShadowFileServiceURL == "" {
+		errors = append(errors, "SHADOW_FILE_SERVICE_URL must be set when SHADOW_PERCENT is above 0")
+	}
+	
+	if cfg.CanaryPercent > 0 && cfg.CanaryFileServiceURL == "" {
+		errors = append(errors, "CANARY_FILE_SERVICE_URL must be set when CANARY_PERCENT is above 0")
+	}
+	
+	if cfg.StandbyFileServiceURL != "" && cfg.StandbyFileServiceURL == cfg.FileServiceURL {
+		errors = append(errors, "STANDBY_FILE_SERVICE_URL must differ from FILE_SERVICE_URL")
+	}
+	
+	if cfg.RateLimitMode != "ip" && cfg.RateLimitMode != "user" {
+		errors = append(errors, "RATE_LIMIT_MODE must be ip or user")
+	}
+	
+	if cfg.Environment != "dev" && cfg.RateLimitMode == "user" && usesDevelopmentSecret(cfg) {
+		errors = append(errors, "JWT_SECRET or JWT_KEYS must be set when RATE_LIMIT_MODE is user outside dev")
+	}
+	
+	if cfg.Environment != "dev" && cfg.GatewayAuth && usesDevelopmentSecret(cfg) {
+		errors = append(errors, "JWT_SECRET, JWT_KEYS or JWT_JWKS_URL must be set when GATEWAY_AUTH is on outside dev")
+	}
+	
+	if cfg.AccessLogFormat != "" && cfg.AccessLogFormat != "json" && cfg.AccessLogFormat != "clf" {
+		errors = append(errors, "ACCESS_LOG_FORMAT must be empty, json or clf")
+	}
+	
+	if cfg.OTLPEndpoint != "" && !strings.HasPrefix(cfg.OTLPEndpoint, "http://") && !strings.HasPrefix(cfg.OTLPEndpoint, "https://") {
+		errors = append(errors, "OTEL_EXPORTER_OTLP_ENDPOINT must be an http:// or https:// URL")
+	}
+	
 	if len(errors) > 0 {
 		log.Fatalf("Configuration validation failed:\n%s", strings.Join(errors, "\n"))
 	}
-}
\ No newline at end of file
+}
+
+// usesDevelopmentSecret reports whether tokens would be signed or accepted with
+// auth.DevelopmentSecret, which anyone can read in the source
+func usesDevelopmentSecret(cfg *Config) bool {
+	if cfg.JWTSecret == auth.DevelopmentSecret {
+		return true
+	}
+	for _, key := range cfg.JWTKeys {
+		if key.Secret == auth.DevelopmentSecret {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"vibe-drop/internal/apigateway/middleware"
+	"vibe-drop/internal/apigateway/services"
+	"vibe-drop/internal/common"
+)
+
+// SwitchBackendRequest names the file service the gateway should send traffic to
+type SwitchBackendRequest struct {
+	URL string `json:"url"`
+}
+
+// BackendStatusHandler reports the gateway's active file service, any still draining and,
+// with a standby configured, the primary's health
+func BackendStatusHandler(w http.ResponseWriter, r *http.Request) {
+	common.WriteOKResponse(w, backendStatus())
+}
+
+func backendStatus() services.BackendStatus {
+	status := fileServiceBackend.Status()
+	if failover != nil {
+		failoverStatus := failover.Status()
+		status.Failover = &failoverStatus
+	}
+	return status
+}
+
+// SwitchBackendHandler points the gateway at a different file service without a restart.
+// In-flight requests finish on the old backend; new requests go to the new one.
+func SwitchBackendHandler(w http.ResponseWriter, r *http.Request) {
+	var req SwitchBackendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		common.WriteValidationError(w, "Invalid request body", err.Error())
+		return
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		common.WriteValidationError(w, "Invalid backend URL", "url must be an absolute http or https URL")
+		return
+	}
+
+	if err := fileServiceBackend.SwitchTo(req.URL); err != nil {
+		common.WriteErrorResponse(w, http.StatusBadGateway, common.ErrorCodeServiceUnavailable,
+			"New backend is not healthy", err.Error())
+		return
+	}
+	common.WriteOKResponse(w, backendStatus())
+}
+
+// RateLimitStatus is how many clients the gateway's rate limiters are tracking
+type RateLimitStatus struct {
+	Tracked  int                            `json:"tracked"` // Across all limiters
+	Limiters []middleware.RateLimiterStatus `json:"limiters"`
+}
+
+// RateLimitStatusHandler reports how many clients each rate limiter is tracking against
+// its capacity, for watching the gateway's memory
+func RateLimitStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := RateLimitStatus{Limiters: middleware.RateLimiters()}
+	for _, limiter := range status.Limiters {
+		status.Tracked += limiter.Tracked
+	}
+	common.WriteOKResponse(w, status)
+}
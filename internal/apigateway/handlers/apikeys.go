@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"vibe-drop/internal/apigateway/middleware"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/s3compat"
+)
+
+// APIKeyUsage is an API key's consumption of its request quotas
+type APIKeyUsage struct {
+	KeyID  string                  `json:"key_id"`
+	Tier   string                  `json:"tier"`
+	Quotas []middleware.QuotaUsage `json:"quotas"`
+}
+
+// APIKeyUsageHandler reports the calling API key's daily and monthly quota usage.
+// keyStore is nil when API key auth is disabled.
+func APIKeyUsageHandler(keyStore *middleware.APIKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if keyStore == nil {
+			common.WriteForbiddenError(w, "API keys are disabled", "API_KEYS_FILE is not configured")
+			return
+		}
+		keyID := middleware.APIKeyID(r)
+		if keyID == "" {
+			common.WriteUnauthorizedError(w, "API key required", "Send the key in the "+middleware.APIKeyHeader+" header")
+			return
+		}
+
+		key, quotas, ok := keyStore.QuotaUsage(keyID)
+		if !ok {
+			common.WriteNotFoundError(w, "API key not found", "No API key with ID "+keyID)
+			return
+		}
+		common.WriteOKResponse(w, APIKeyUsage{KeyID: key.ID, Tier: key.Tier, Quotas: quotas})
+	}
+}
+
+// S3Credentials are an API key's credentials for the S3-compatible API, with an rclone
+// remote configured to use them
+type S3Credentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	RcloneConfig    string `json:"rclone_config"`
+}
+
+// S3CredentialsHandler returns the calling API key's S3 credentials, derived with secret.
+// keyStore is nil when API key auth is disabled, and secret is empty when the
+// S3-compatible API is.
+func S3CredentialsHandler(keyStore *middleware.APIKeyStore, secret []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if keyStore == nil {
+			common.WriteForbiddenError(w, "API keys are disabled", "API_KEYS_FILE is not configured")
+			return
+		}
+		if len(secret) == 0 {
+			common.WriteForbiddenError(w, "The S3-compatible API is disabled", "S3_CREDENTIALS_SECRET is not configured")
+			return
+		}
+		keyID := middleware.APIKeyID(r)
+		if keyID == "" {
+			common.WriteUnauthorizedError(w, "API key required", "Send the key in the "+middleware.APIKeyHeader+" header")
+			return
+		}
+		key, ok := keyStore.LookupID(keyID)
+		if !ok {
+			common.WriteNotFoundError(w, "API key not found", "No API key with ID "+keyID)
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		credentials := S3Credentials{
+			AccessKeyID:     key.ID,
+			SecretAccessKey: s3compat.SecretKey(secret, key.ID, key.KeyHash),
+			Endpoint:        scheme + "://" + r.Host + s3compat.Path,
+			Region:          s3compat.Region,
+			Bucket:          s3compat.Bucket,
+		}
+		// Multipart uploads aren't supported, and there is only the one bucket to check for
+		credentials.RcloneConfig = fmt.Sprintf("[vibe-drop]\ntype = s3\nprovider = Other\n"+
+			"access_key_id = %s\nsecret_access_key = %s\nendpoint = %s\nregion = %s\n"+
+			"force_path_style = true\nno_check_bucket = true\nlist_version = 2\nuse_multipart_uploads = false\n",
+			credentials.AccessKeyID, credentials.SecretAccessKey, credentials.Endpoint, credentials.Region)
+		common.WriteOKResponse(w, credentials)
+	}
+}
@@ -2,8 +2,9 @@ package handlers
 
 import (
 	"io"
-	"log"
+	"net"
 	"net/http"
+	"strings"
 	"vibe-drop/internal/common"
 )
 
@@ -11,7 +12,7 @@ func proxyToFileServiceAuth(w http.ResponseWriter, r *http.Request, path string)
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Failed to read request body: %v", err)
+		common.Logger(r.Context()).Warn("Failed to read request body", "error", err)
 		common.WriteBadRequestError(w, "Failed to read request body", err.Error())
 		return
 	}
@@ -24,18 +25,21 @@ func proxyToFileServiceAuth(w http.ResponseWriter, r *http.Request, path string)
 			headers[key] = values[0]
 		}
 	}
+	// The file service counts failed sign-ins per client address
+	headers["X-Forwarded-For"] = forwardedFor(r)
 	
 	// Make request to file service (which handles auth)
-	resp, err := fileServiceClient.ProxyRequest(r.Method, path, body, headers)
+	resp, err := backendFor(w, r).ProxyRequest(r.Context(), r.Method, path, body, headers)
 	if err != nil {
-		log.Printf("File service auth request failed: %v", err)
+		common.Logger(r.Context()).Error("File service auth request failed", "error", err)
 		common.WriteErrorResponse(w, http.StatusServiceUnavailable, common.ErrorCodeServiceUnavailable, 
 			"Authentication service is currently unavailable", err.Error())
 		return
 	}
 	defer resp.Body.Close()
 	
-	// Copy response headers
+	// Copy response headers; the file service echoes the gateway's own request ID
+	resp.Header.Del("X-Request-ID")
 	for key, values := range resp.Header {
 		for _, value := range values {
 			w.Header().Add(key, value)
@@ -47,20 +51,18 @@ func proxyToFileServiceAuth(w http.ResponseWriter, r *http.Request, path string)
 	
 	// Copy response body
 	if _, err := io.Copy(w, resp.Body); err != nil {
-		log.Printf("Failed to copy auth response body: %v", err)
+		common.Logger(r.Context()).Warn("Failed to copy auth response body", "error", err)
 	}
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	proxyToFileServiceAuth(w, r, "/auth/login")
-}
-
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	proxyToFileServiceAuth(w, r, "/auth/register")
+// forwardedFor is the request's X-Forwarded-For with the gateway's peer appended
+func forwardedFor(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if prior := strings.Join(r.Header.Values("X-Forwarded-For"), ", "); prior != "" {
+		return prior + ", " + peer
+	}
+	return peer
 }
-
-func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-	// This endpoint doesn't exist yet in file service, so return not implemented
-	common.WriteErrorResponse(w, http.StatusNotImplemented, common.ErrorCode("NOT_IMPLEMENTED"), 
-		"Token refresh not yet implemented", "This feature will be available in a future release")
-}
\ No newline at end of file
@@ -1,38 +1,89 @@
 package handlers
 
 import (
+	"context"
 	"io"
-	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"vibe-drop/internal/apigateway/services"
 	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
 )
 
 
-var fileServiceClient *services.FileServiceClient
+// fileServiceBackend holds the primary file service, which can be switched at runtime
+var fileServiceBackend *services.BackendSwitch
+
+// shadowClient mirrors read traffic to a secondary file service; nil when mirroring is off
+var shadowClient *services.ShadowClient
 
 func InitializeFileServiceClient(fileServiceURL string) {
-	fileServiceClient = services.NewFileServiceClient(fileServiceURL)
+	fileServiceBackend = services.NewBackendSwitch(services.NewFileServiceClient(fileServiceURL))
 }
 
-func getRequestID(r *http.Request) string {
-	if id := r.Context().Value("request_id"); id != nil {
-		if requestID, ok := id.(string); ok {
-			return requestID
-		}
+// failover moves fileServiceBackend to a standby while the primary is failing its health
+// checks; nil when no standby is configured
+var failover *services.Failover
+
+// InitializeFailover watches the primary file service every interval and fails over to
+// standbyURL after failAfter failed health checks in a row, back after recoverAfter passed.
+// Each switch is posted to alertWebhookURL, if set. Call it after InitializeFileServiceClient.
+func InitializeFailover(primaryURL, standbyURL string, interval time.Duration, failAfter, recoverAfter int, alertWebhookURL string) {
+	failover = services.NewFailover(fileServiceBackend, primaryURL, standbyURL, failAfter, recoverAfter)
+	if alertWebhookURL != "" {
+		failover.OnSwitch(services.NewFailoverWebhook(alertWebhookURL))
 	}
-	return ""
+	go failover.Run(context.Background(), interval)
+}
+
+// canaryRouter splits traffic between the primary and a canary file service; nil when canary routing is off
+var canaryRouter *services.CanaryRouter
+
+// InitializeCanaryRouter sends percent of requests (or any request with X-VD-Canary: true) to canaryURL
+func InitializeCanaryRouter(canaryURL string, percent int) {
+	canaryRouter = services.NewCanaryRouter(services.NewFileServiceClient(canaryURL), percent)
+}
+
+// backendFor picks the file service for a request and, with canary routing on, labels the response with it
+func backendFor(w http.ResponseWriter, r *http.Request) *services.FileServiceClient {
+	primary := fileServiceBackend.Current()
+	if canaryRouter == nil {
+		return primary
+	}
+	client, canary := canaryRouter.Pick(r, primary)
+	if canary {
+		w.Header().Set(services.BackendHeader, "canary")
+	} else {
+		w.Header().Set(services.BackendHeader, "primary")
+	}
+	return client
+}
+
+// InitializeShadowClient starts mirroring percent of read requests to shadowURL
+func InitializeShadowClient(shadowURL string, percent int) {
+	shadowClient = services.NewShadowClient(shadowURL, percent)
 }
 
-func proxyToFileService(w http.ResponseWriter, r *http.Request, path string) {
-	requestID := getRequestID(r)
+// coalescer collapses concurrent identical GETs of routes ProxyHandler marks coalesced
+var coalescer = services.NewCoalescer()
+
+// proxyToFileService forwards r to the file service at path. With coalesce, a GET
+// identical to one already in flight waits for and shares that one's response.
+func proxyToFileService(w http.ResponseWriter, r *http.Request, path string, coalesce bool) {
+	logger := common.Logger(r.Context())
+	
+	if services.IsStreaming(r) {
+		streamFromFileService(w, r, path)
+		return
+	}
 	
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("[%s] Failed to read request body: %v", requestID, err)
+		logger.Warn("Failed to read request body", "error", err)
 		common.WriteBadRequestError(w, "Failed to read request body", err.Error())
 		return
 	}
@@ -46,17 +97,32 @@ func proxyToFileService(w http.ResponseWriter, r *http.Request, path string) {
 		}
 	}
 	
+	// Preserve query parameters (e.g. pagination, limits)
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+	
+	if shadowClient != nil {
+		shadowClient.Mirror(r.Context(), r.Method, path, body, headers)
+	}
+	
+	if coalesce && r.Method == "GET" && len(body) == 0 {
+		proxyCoalesced(w, r, path, headers)
+		return
+	}
+	
 	// Make request to file service
-	resp, err := fileServiceClient.ProxyRequest(r.Method, path, body, headers)
+	resp, err := backendFor(w, r).ProxyRequest(r.Context(), r.Method, path, body, headers)
 	if err != nil {
-		log.Printf("[%s] File service request failed: %v", requestID, err)
+		logger.Error("File service request failed", "error", err)
 		common.WriteErrorResponse(w, http.StatusServiceUnavailable, common.ErrorCodeServiceUnavailable, 
 			"File service is currently unavailable", err.Error())
 		return
 	}
 	defer resp.Body.Close()
 	
-	// Copy response headers
+	// Copy response headers; the file service echoes the gateway's own request ID
+	resp.Header.Del("X-Request-ID")
 	for key, values := range resp.Header {
 		for _, value := range values {
 			w.Header().Add(key, value)
@@ -68,32 +134,72 @@ func proxyToFileService(w http.ResponseWriter, r *http.Request, path string) {
 	
 	// Copy response body
 	if _, err := io.Copy(w, resp.Body); err != nil {
-		log.Printf("[%s] Failed to copy response body: %v", requestID, err)
+		logger.Warn("Failed to copy response body", "error", err)
 	}
 }
 
-func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
-	proxyToFileService(w, r, "/files/upload-url")
-}
+// proxyCoalesced serves a GET from the file service through the coalescer
+func proxyCoalesced(w http.ResponseWriter, r *http.Request, path string, headers map[string]string) {
+	resp, shared, err := coalescer.Get(r.Context(), backendFor(w, r), path, headers)
+	if err != nil {
+		common.Logger(r.Context()).Error("File service request failed", "error", err, "coalesced", shared)
+		common.WriteErrorResponse(w, http.StatusServiceUnavailable, common.ErrorCodeServiceUnavailable,
+			"File service is currently unavailable", err.Error())
+		return
+	}
+	if shared {
+		common.Logger(r.Context()).Debug("Shared a coalesced file service response")
+	}
 
-func DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	fileID := vars["id"]
-	proxyToFileService(w, r, "/files/"+fileID+"/download-url")
+	// The file service echoes the request ID of whichever request was sent
+	for key, values := range resp.Header {
+		if key == "X-Request-Id" {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(resp.Body); err != nil {
+		common.Logger(r.Context()).Warn("Failed to copy response body", "error", err)
+	}
 }
 
-func GetFileMetadataHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	fileID := vars["id"]
-	proxyToFileService(w, r, "/files/"+fileID)
+// streamFromFileService passes a WebSocket upgrade or event stream through to the file
+// service unbuffered. Streams aren't mirrored to the shadow backend, which would hold a
+// second connection open for a response nobody reads.
+func streamFromFileService(w http.ResponseWriter, r *http.Request, path string) {
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+	backendFor(w, r).Stream(w, r, path, func(w http.ResponseWriter, r *http.Request, err error) {
+		common.Logger(r.Context()).Error("File service stream failed", "error", err)
+		common.WriteErrorResponse(w, http.StatusServiceUnavailable, common.ErrorCodeServiceUnavailable,
+			"File service is currently unavailable", err.Error())
+	})
 }
 
-func ListFilesHandler(w http.ResponseWriter, r *http.Request) {
-	proxyToFileService(w, r, "/files")
+// ProxyHandler serves a registry route by forwarding it to the file service at its service
+// path. Authentication routes skip shadow mirroring, so credentials only reach the primary.
+// Concurrent identical GETs are coalesced, except on upload and download routes, whose
+// responses carry presigned URLs issued to each request.
+func ProxyHandler(route registry.Route) http.HandlerFunc {
+	if strings.HasPrefix(route.Path, "/auth/") {
+		return func(w http.ResponseWriter, r *http.Request) {
+			proxyToFileServiceAuth(w, r, route.ServiceURL(mux.Vars(r)))
+		}
+	}
+	coalesce := route.Method == "GET" && route.UserLimit == registry.LimitDefault
+	return func(w http.ResponseWriter, r *http.Request) {
+		proxyToFileService(w, r, route.ServiceURL(mux.Vars(r)), coalesce)
+	}
 }
 
-func DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	fileID := vars["id"]
-	proxyToFileService(w, r, "/files/"+fileID)
-}
\ No newline at end of file
+// S3ProxyHandler forwards the S3-compatible API to the file service at the same path.
+// Objects are streamed both ways, since they can be up to 5 GiB.
+func S3ProxyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamFromFileService(w, r, r.URL.EscapedPath())
+	}
+}
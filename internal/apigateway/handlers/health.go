@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"time"
 	"vibe-drop/internal/common"
+	"vibe-drop/internal/health"
 )
 
 type HealthResponse struct {
@@ -12,6 +14,7 @@ type HealthResponse struct {
 	Service   string    `json:"service"`
 }
 
+// HealthHandler answers the liveness probe; it checks nothing beyond the gateway serving
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:    "healthy",
@@ -20,4 +23,23 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	common.WriteOKResponse(w, response)
-}
\ No newline at end of file
+}
+
+// ReadinessHandler answers the readiness probe. The gateway is ready while the active
+// file service answers its health check; a canary, shadow or standby backend that doesn't
+// only degrades it, since traffic can do without them. Call it after the backends are set up.
+func ReadinessHandler() http.Handler {
+	checks := []health.Check{{Name: "file-service", Ping: func(ctx context.Context) error {
+		return fileServiceBackend.Current().Ping(ctx)
+	}}}
+	if canaryRouter != nil {
+		checks = append(checks, health.Check{Name: "file-service-canary", Optional: true, Ping: canaryRouter.Ping})
+	}
+	if failover != nil {
+		checks = append(checks, health.Check{Name: "file-service-standby", Optional: true, Ping: failover.PingStandby})
+	}
+	if shadowClient != nil {
+		checks = append(checks, health.Check{Name: "file-service-shadow", Optional: true, Ping: shadowClient.Ping})
+	}
+	return health.NewChecker("api-gateway", checks...)
+}
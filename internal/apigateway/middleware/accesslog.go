@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
+)
+
+// Access log formats
+const (
+	AccessLogJSON = "json" // One JSON object per request, with the configured fields
+	AccessLogCLF  = "clf"  // Common Log Format, as written by Apache and nginx
+)
+
+// AccessLogFields are the fields a JSON access log line can have, in the order written
+var AccessLogFields = []string{
+	"time", "request_id", "client_ip", "method", "url", "route", "protocol",
+	"status", "bytes", "duration_ms", "user_agent", "referer",
+}
+
+// AccessLogOptions configures an AccessLog
+type AccessLogOptions struct {
+	Format string   // AccessLogJSON or AccessLogCLF
+	Fields []string // JSON fields to write, from AccessLogFields; all of them if empty
+
+	// Percent (0-100) of requests to each route that are logged, by route key such as
+	// "GET /files". Routes not listed are always logged, and so are server errors.
+	Sampling map[string]int
+}
+
+// AccessLog writes a machine-readable line for each request, apart from the task logs
+// RequestLogging writes. URLs and referers are logged with common.RedactURL and
+// common.RedactString, so tokens in query parameters and email addresses never reach it.
+type AccessLog struct {
+	format   string
+	fields   []string
+	sampling map[string]int
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewAccessLog writes access logs to out. Sampled routes must be in routes.
+func NewAccessLog(out io.Writer, routes []registry.Route, opts AccessLogOptions) (*AccessLog, error) {
+	if opts.Format != AccessLogJSON && opts.Format != AccessLogCLF {
+		return nil, fmt.Errorf("access log format must be %s or %s", AccessLogJSON, AccessLogCLF)
+	}
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = AccessLogFields
+	}
+	known := make(map[string]bool, len(AccessLogFields))
+	for _, field := range AccessLogFields {
+		known[field] = true
+	}
+	for _, field := range fields {
+		if !known[field] {
+			return nil, fmt.Errorf("unknown access log field %q: must be one of %s", field, strings.Join(AccessLogFields, ", "))
+		}
+	}
+
+	keys := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		keys[route.Key()] = true
+	}
+	for key, percent := range opts.Sampling {
+		if !keys[key] {
+			return nil, fmt.Errorf("access log sampling names unknown route %q", key)
+		}
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("access log sampling for %s must be from 0 to 100", key)
+		}
+	}
+	return &AccessLog{format: opts.Format, fields: fields, sampling: opts.Sampling, out: out}, nil
+}
+
+// accessLogEntry is what's known about a request once it has been served
+type accessLogEntry struct {
+	r        *http.Request
+	route    string // Path template, or "" if no route matched
+	status   int
+	bytes    int
+	start    time.Time
+	duration time.Duration
+}
+
+// log writes e's line, unless its route is sampled and this request isn't picked
+func (a *AccessLog) log(e accessLogEntry) {
+	percent, sampled := a.sampling[e.r.Method+" "+e.route]
+	if sampled && e.status < http.StatusInternalServerError && rand.Intn(100) >= percent {
+		return
+	}
+
+	var line []byte
+	if a.format == AccessLogCLF {
+		line = a.clfLine(e)
+	} else {
+		line = a.jsonLine(e)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.out.Write(line)
+}
+
+func (a *AccessLog) jsonLine(e accessLogEntry) []byte {
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, field := range a.fields {
+		var value interface{}
+		switch field {
+		case "time":
+			value = e.start.UTC().Format(time.RFC3339Nano)
+		case "request_id":
+			value = common.GetRequestIDFromContext(e.r.Context())
+		case "client_ip":
+			value = accessLogClient(e.r)
+		case "method":
+			value = e.r.Method
+		case "url":
+			value = common.RedactURL(e.r.URL)
+		case "route":
+			value = e.route
+		case "protocol":
+			value = e.r.Proto
+		case "status":
+			value = e.status
+		case "bytes":
+			value = e.bytes
+		case "duration_ms":
+			value = e.duration.Milliseconds()
+		case "user_agent":
+			value = e.r.UserAgent()
+		case "referer":
+			value = common.RedactString(e.r.Referer())
+		}
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		encoded, _ := json.Marshal(value)
+		fmt.Fprintf(&line, "%q:%s", field, encoded)
+	}
+	line.WriteString("}\n")
+	return line.Bytes()
+}
+
+// clfLine is e in Common Log Format: host ident user [time] "request" status bytes
+func (a *AccessLog) clfLine(e accessLogEntry) []byte {
+	size := "-"
+	if e.bytes > 0 {
+		size = strconv.Itoa(e.bytes)
+	}
+	return []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s\n",
+		accessLogClient(e.r), e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.r.Method, common.RedactURL(e.r.URL), e.r.Proto, e.status, size))
+}
+
+// accessLogClient is the client's address without its port: the first X-Forwarded-For
+// address if there is one, so the field never holds spaces
+func accessLogClient(r *http.Request) string {
+	client, _, _ := strings.Cut(getIP(r), ",")
+	return strings.TrimSpace(client)
+}
+
+// accessLogRoute is the matched route's path template, or "" if none matched
+func accessLogRoute(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
+)
+
+func TestAccessLog(t *testing.T) {
+	routes := []registry.Route{
+		{Method: "GET", Path: "/files/{id}"},
+		{Method: "GET", Path: "/health"},
+	}
+	serve := func(opts AccessLogOptions, path string, status int) string {
+		var out bytes.Buffer
+		accessLog, err := NewAccessLog(&out, routes, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := mux.NewRouter()
+		r.Use(RequestLogging(accessLog))
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte("body"))
+		}
+		r.HandleFunc("/files/{id}", handler).Methods("GET")
+		r.HandleFunc("/health", handler).Methods("GET")
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		req.Header.Set("Referer", "https://app.example.com/share?token=abc")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		return out.String()
+	}
+
+	line := serve(AccessLogOptions{Format: AccessLogJSON}, "/files/f1?token=secret&owner=ann%40example.com&sort=name", http.StatusOK)
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("JSON line %q: %v", line, err)
+	}
+	want := map[string]interface{}{
+		"client_ip": "203.0.113.7",
+		"url":       "/files/f1?token=[redacted]&owner=" + common.MaskEmail("ann@example.com") + "&sort=name",
+		"route":     "/files/{id}",
+		"status":    float64(200),
+		"bytes":     float64(4),
+		"referer":   "https://app.example.com/share?token=[redacted]",
+	}
+	for field, value := range want {
+		if entry[field] != value {
+			t.Errorf("%s = %v, want %v", field, entry[field], value)
+		}
+	}
+	if len(entry) != len(AccessLogFields) {
+		t.Errorf("line has %d fields, want all %d", len(entry), len(AccessLogFields))
+	}
+
+	line = serve(AccessLogOptions{Format: AccessLogJSON, Fields: []string{"method", "status"}}, "/health", http.StatusOK)
+	if line != `{"method":"GET","status":200}`+"\n" {
+		t.Errorf("line with chosen fields = %q", line)
+	}
+
+	line = serve(AccessLogOptions{Format: AccessLogCLF}, "/files/ann@example.com", http.StatusNotFound)
+	if !strings.HasPrefix(line, "203.0.113.7 - - [") || !strings.HasSuffix(line, `] "GET /files/`+common.MaskEmail("ann@example.com")+` HTTP/1.1" 404 4`+"\n") {
+		t.Errorf("CLF line = %q", line)
+	}
+
+	// A route sampled at 0% is only logged when it fails
+	sampled := AccessLogOptions{Format: AccessLogCLF, Sampling: map[string]int{"GET /health": 0}}
+	if line := serve(sampled, "/health", http.StatusOK); line != "" {
+		t.Errorf("sampled-out request logged: %q", line)
+	}
+	if line := serve(sampled, "/health", http.StatusServiceUnavailable); line == "" {
+		t.Error("server error on a sampled route not logged")
+	}
+
+	for _, opts := range []AccessLogOptions{
+		{Format: "xml"},
+		{Format: AccessLogJSON, Fields: []string{"password"}},
+		{Format: AccessLogJSON, Sampling: map[string]int{"GET /nowhere": 10}},
+		{Format: AccessLogJSON, Sampling: map[string]int{"GET /health": 101}},
+	} {
+		if _, err := NewAccessLog(&bytes.Buffer{}, routes, opts); err == nil {
+			t.Errorf("NewAccessLog(%+v) succeeded, want an error", opts)
+		}
+	}
+}
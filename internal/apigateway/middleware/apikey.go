@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+
+	"golang.org/x/time/rate"
+)
+
+// APIKeyHeader carries a third-party integration's API key
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyTokenExpiry is the lifetime of the token minted for each API-key request
+const apiKeyTokenExpiry = 5 * time.Minute
+
+// apiKeyContextKey marks requests authenticated with an API key
+type apiKeyContextKey struct{}
+
+// RateTier defines the request rate and request quotas allowed for an API key
+type RateTier struct {
+	RequestsPerSecond float64
+	Burst             int
+	DailyQuota        int64 // requests per UTC day
+	MonthlyQuota      int64 // requests per UTC calendar month
+}
+
+// RateTiers are the named rate tiers an API key can be assigned
+var RateTiers = map[string]RateTier{
+	"standard": {RequestsPerSecond: 5, Burst: 10, DailyQuota: 10_000, MonthlyQuota: 200_000},
+	"partner":  {RequestsPerSecond: 25, Burst: 50, DailyQuota: 100_000, MonthlyQuota: 2_000_000},
+	"premium":  {RequestsPerSecond: 100, Burst: 200, DailyQuota: 1_000_000, MonthlyQuota: 20_000_000},
+}
+
+// APIKey is a server-to-server credential acting on behalf of a user with limited scopes
+type APIKey struct {
+	ID      string   `json:"id"`
+	KeyHash string   `json:"key_hash"` // hex SHA-256 of the raw key; raw keys are never stored
+	UserID  string   `json:"user_id"`  // User whose files the key operates on
+	Scopes  []string `json:"scopes"`
+	Tier    string   `json:"tier"`
+
+	// Optional overrides of the tier's quotas; 0 keeps the tier default
+	DailyQuota   int64 `json:"daily_quota,omitempty"`
+	MonthlyQuota int64 `json:"monthly_quota,omitempty"`
+}
+
+// APIKeyStore looks up API keys by hash and tracks per-key rate limiters and quotas
+type APIKeyStore struct {
+	keys     map[string]APIKey // keyed by KeyHash
+	byID     map[string]APIKey
+	limiters map[string]*rate.Limiter
+	quotas   QuotaStore
+	mu       sync.Mutex
+}
+
+// NewAPIKeyStore validates the keys and builds a store that counts quotas in memory
+func NewAPIKeyStore(keys []APIKey) (*APIKeyStore, error) {
+	store := &APIKeyStore{
+		keys:     make(map[string]APIKey),
+		byID:     make(map[string]APIKey),
+		limiters: make(map[string]*rate.Limiter),
+		quotas:   NewMemoryQuotaStore(),
+	}
+
+	for _, key := range keys {
+		if key.ID == "" || key.KeyHash == "" || key.UserID == "" {
+			return nil, fmt.Errorf("API key entries require id, key_hash and user_id")
+		}
+		if err := auth.ValidateScopes(key.Scopes); err != nil {
+			return nil, fmt.Errorf("API key %s: %w", key.ID, err)
+		}
+		tier, ok := RateTiers[key.Tier]
+		if !ok {
+			return nil, fmt.Errorf("API key %s: unknown rate tier %q", key.ID, key.Tier)
+		}
+		if key.DailyQuota < 0 || key.MonthlyQuota < 0 {
+			return nil, fmt.Errorf("API key %s: quotas cannot be negative", key.ID)
+		}
+
+		store.keys[key.KeyHash] = key
+		store.byID[key.ID] = key
+		store.limiters[key.ID] = rate.NewLimiter(rate.Limit(tier.RequestsPerSecond), tier.Burst)
+	}
+
+	return store, nil
+}
+
+// LoadAPIKeyStore reads API key definitions from a JSON file
+func LoadAPIKeyStore(path string) (*APIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	return NewAPIKeyStore(keys)
+}
+
+// HashAPIKey returns the hex SHA-256 used to store and look up a raw key
+func HashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup finds the API key matching a raw key
+func (s *APIKeyStore) Lookup(rawKey string) (APIKey, bool) {
+	key, ok := s.keys[HashAPIKey(rawKey)]
+	return key, ok
+}
+
+// LookupID finds the API key with an ID
+func (s *APIKeyStore) LookupID(keyID string) (APIKey, bool) {
+	key, ok := s.byID[keyID]
+	return key, ok
+}
+
+// Allow applies the key's rate tier
+func (s *APIKeyStore) Allow(key APIKey) bool {
+	s.mu.Lock()
+	limiter := s.limiters[key.ID]
+	s.mu.Unlock()
+	return limiter.Allow()
+}
+
+// quotaPeriods returns the key's current quota windows, applying any per-key overrides
+func (s *APIKeyStore) quotaPeriods(key APIKey, now time.Time) []QuotaPeriod {
+	tier := RateTiers[key.Tier]
+	daily, monthly := tier.DailyQuota, tier.MonthlyQuota
+	if key.DailyQuota > 0 {
+		daily = key.DailyQuota
+	}
+	if key.MonthlyQuota > 0 {
+		monthly = key.MonthlyQuota
+	}
+	return quotaPeriods(daily, monthly, now)
+}
+
+// ConsumeQuota counts a request against the key's quotas, reporting false once any is used up
+func (s *APIKeyStore) ConsumeQuota(key APIKey) ([]QuotaUsage, bool) {
+	periods := s.quotaPeriods(key, time.Now())
+	used, ok := s.quotas.Consume(key.ID, periods)
+	return quotaUsage(periods, used), ok
+}
+
+// QuotaUsage returns the key's current quota usage
+func (s *APIKeyStore) QuotaUsage(keyID string) (APIKey, []QuotaUsage, bool) {
+	key, ok := s.byID[keyID]
+	if !ok {
+		return APIKey{}, nil, false
+	}
+	periods := s.quotaPeriods(key, time.Now())
+	return key, quotaUsage(periods, s.quotas.Usage(key.ID, periods)), true
+}
+
+// APIKeyAuth authenticates requests carrying X-API-Key. Valid keys are rate limited and
+// held to daily and monthly request quotas by tier, and exchanged for a short-lived token
+// scoped to the key's scopes, so the file service enforces the same per-route scopes as for
+// user tokens. Requests without an API key pass through untouched.
+func APIKeyAuth(store *APIKeyStore, jwtService *auth.JWTService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rawKey := r.Header.Get(APIKeyHeader)
+			if rawKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, ok := store.Lookup(rawKey)
+			if !ok {
+				common.WriteUnauthorizedError(w, "Invalid API key", "The provided API key is not recognised")
+				return
+			}
+
+			// Never forward the raw key
+			r.Header.Del(APIKeyHeader)
+			if r, ok = authorizeKey(w, r, store, jwtService, key); ok {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// authorizeKey applies an authenticated key's rate tier and quotas and, if the request is
+// within them, returns it with a token minted for the key in place of any user credentials
+// and the key in its context. Otherwise it writes the error and returns false.
+func authorizeKey(w http.ResponseWriter, r *http.Request, store *APIKeyStore, jwtService *auth.JWTService, key APIKey) (*http.Request, bool) {
+	if !store.Allow(key) {
+		common.WriteErrorResponse(w, http.StatusTooManyRequests, common.ErrorCodeTooManyRequests,
+			"Too many requests", "API key rate limit exceeded for tier "+key.Tier)
+		return nil, false
+	}
+
+	usage, ok := store.ConsumeQuota(key)
+	setQuotaHeaders(w, usage)
+	if !ok {
+		for _, u := range usage {
+			if u.Remaining == 0 {
+				w.Header().Set("Retry-After", strconv.FormatInt(int64(time.Until(u.ResetsAt).Seconds())+1, 10))
+				common.WriteErrorResponse(w, http.StatusTooManyRequests, common.ErrorCodeTooManyRequests,
+					"Request quota exceeded", "The "+u.Period+" request quota for this API key is used up")
+				return nil, false
+			}
+		}
+	}
+
+	token, err := jwtService.GenerateScopedToken(key.UserID, auth.APIKeyUsername(key.ID), key.Scopes, apiKeyTokenExpiry)
+	if err != nil {
+		common.Logger(r.Context()).Error("Failed to mint token for API key", "api_key_id", key.ID, "error", err)
+		common.WriteInternalServerError(w, "Authentication failed", "Unable to authorize API key")
+		return nil, false
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	ctx := context.WithValue(r.Context(), apiKeyContextKey{}, key.ID)
+	ctx = common.WithLogger(ctx, common.Logger(ctx).With("api_key_id", key.ID, "user_id", key.UserID))
+	return r.WithContext(ctx), true
+}
+
+// APIKeyID returns the API key ID if the request was authenticated with one
+func APIKeyID(r *http.Request) string {
+	id, _ := r.Context().Value(apiKeyContextKey{}).(string)
+	return id
+}
@@ -35,9 +35,25 @@ func DefaultCORSConfig() CORSConfig {
 			"Authorization",
 			"X-Requested-With",
 			"X-Request-ID",
+			"X-API-Key",
+			"X-VD-Canary",
+			"X-Client-Info",
 		},
 		ExposedHeaders: []string{
 			"X-Request-ID",
+			"X-Upstream-Request-ID",
+			"X-VD-Backend",
+			"X-Quota-Daily-Limit",
+			"X-Quota-Daily-Remaining",
+			"X-Quota-Daily-Reset",
+			"X-Quota-Monthly-Limit",
+			"X-Quota-Monthly-Remaining",
+			"X-Quota-Monthly-Reset",
+			"Retry-After",
+			"Deprecation",
+			"Sunset",
+			"Link",
+			"Warning",
 		},
 		AllowCredentials: true,
 		MaxAge:           86400, // 24 hours
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/apigateway/services"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
+)
+
+// WarningCodeDeprecatedRoute marks the envelope warning added to deprecated routes' responses
+const WarningCodeDeprecatedRoute = "DEPRECATED_ROUTE"
+
+// DeprecationWarning is the entry a deprecated route adds to the response's "warnings"
+type DeprecationWarning struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Successor string `json:"successor,omitempty"`
+	Sunset    string `json:"sunset,omitempty"` // RFC 3339
+}
+
+// Deprecation marks responses from the routes in the table that have a Deprecation as
+// deprecated. They get a Deprecation header (RFC 9745), a Sunset header (RFC 8594) once a
+// removal date is set, a successor-version Link and a Warning header, and JSON responses a
+// "warnings" entry in the envelope. Streams get only the headers, since their responses
+// can't be held back. The route itself is served as usual.
+func Deprecation(routes []registry.Route) func(http.Handler) http.Handler {
+	table := make(map[string]registry.Route)
+	for _, route := range routes {
+		if route.Deprecation != nil {
+			table[route.Key()] = route
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := mux.CurrentRoute(r)
+			if current == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			template, err := current.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route, ok := table[r.Method+" "+template]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			deprecation := route.Deprecation
+
+			warning := deprecationWarning(route, mux.Vars(r))
+			header := w.Header()
+			header.Set("Deprecation", fmt.Sprintf("@%d", deprecation.Deprecated.Unix()))
+			if !deprecation.Sunset.IsZero() {
+				header.Set("Sunset", deprecation.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if warning.Successor != "" {
+				header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, warning.Successor))
+			}
+			header.Add("Warning", fmt.Sprintf(`299 - %q`, warning.Message))
+			if client := r.Header.Get(common.ClientInfoHeader); client != "" {
+				common.Logger(r.Context()).Info("Deprecated route called", "client", client)
+			}
+
+			// A stream can't be held back, so it gets the headers but no envelope warning
+			if services.IsStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ww := &warningWriter{ResponseWriter: w}
+			next.ServeHTTP(ww, r)
+			ww.flush(warning)
+		})
+	}
+}
+
+// deprecationWarning describes a route's deprecation, with the successor's variables filled
+// in from vars
+func deprecationWarning(route registry.Route, vars map[string]string) DeprecationWarning {
+	d := route.Deprecation
+	warning := DeprecationWarning{Code: WarningCodeDeprecatedRoute}
+	message := fmt.Sprintf("%s %s is deprecated", route.Method, route.Path)
+	if d.Successor != "" {
+		warning.Successor = d.Successor
+		for name, value := range vars {
+			warning.Successor = strings.ReplaceAll(warning.Successor, "{"+name+"}", value)
+		}
+		message += fmt.Sprintf("; use %s %s instead", route.Method, d.Successor)
+	}
+	if !d.Sunset.IsZero() {
+		warning.Sunset = d.Sunset.UTC().Format(time.RFC3339)
+		message += fmt.Sprintf(". It will be removed on %s", d.Sunset.UTC().Format("2006-01-02"))
+	}
+	warning.Message = message
+	return warning
+}
+
+// warningWriter holds back the response so a warning can be added to its JSON envelope
+type warningWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (ww *warningWriter) WriteHeader(code int) {
+	if ww.status == 0 {
+		ww.status = code
+	}
+}
+
+func (ww *warningWriter) Write(b []byte) (int, error) {
+	if ww.status == 0 {
+		ww.status = http.StatusOK
+	}
+	return ww.body.Write(b)
+}
+
+// Unwrap exposes the underlying writer to the error helpers
+func (ww *warningWriter) Unwrap() http.ResponseWriter {
+	return ww.ResponseWriter
+}
+
+// flush sends the held response, with the warning appended to the envelope's "warnings" if
+// the body is a JSON object. Anything else is sent unchanged.
+func (ww *warningWriter) flush(warning DeprecationWarning) {
+	if ww.status == 0 {
+		ww.status = http.StatusOK
+	}
+	body := ww.body.Bytes()
+	if strings.HasPrefix(ww.Header().Get("Content-Type"), "application/json") {
+		if withWarning, err := addWarning(body, warning); err == nil {
+			body = withWarning
+			ww.Header().Del("Content-Length")
+		}
+	}
+	ww.ResponseWriter.WriteHeader(ww.status)
+	ww.ResponseWriter.Write(body)
+}
+
+func addWarning(body []byte, warning DeprecationWarning) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	var warnings []json.RawMessage
+	if existing, ok := envelope["warnings"]; ok {
+		if err := json.Unmarshal(existing, &warnings); err != nil {
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(warning)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, encoded)
+	if envelope["warnings"], err = json.Marshal(warnings); err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
+)
+
+func TestDeprecation(t *testing.T) {
+	deprecated := time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+	r := mux.NewRouter()
+	r.Use(Deprecation([]registry.Route{
+		{Method: "GET", Path: "/files/{id}/download", Deprecation: &registry.Deprecation{Deprecated: deprecated, Sunset: sunset, Successor: "/files/{id}/download-url"}},
+		{Method: "GET", Path: "/files/{id}/download-url"},
+	}))
+	r.HandleFunc("/files/{id}/download", func(w http.ResponseWriter, r *http.Request) {
+		common.WriteOKResponse(w, map[string]string{"url": "https://download"})
+	}).Methods("GET")
+	r.HandleFunc("/files/{id}/download-url", func(w http.ResponseWriter, r *http.Request) {
+		common.WriteOKResponse(w, map[string]string{"url": "https://download"})
+	}).Methods("GET")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/abc/download", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	headers := map[string]string{
+		"Deprecation": "@1791936000",
+		"Sunset":      "Thu, 01 Apr 2027 00:00:00 GMT",
+		"Link":        `</files/abc/download-url>; rel="successor-version"`,
+	}
+	for name, want := range headers {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if rec.Header().Get("Warning") == "" {
+		t.Error("no Warning header")
+	}
+
+	var resp struct {
+		Success  bool                 `json:"success"`
+		Data     map[string]string    `json:"data"`
+		Warnings []DeprecationWarning `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Data["url"] != "https://download" {
+		t.Errorf("envelope = %+v, want the handler's response intact", resp)
+	}
+	if len(resp.Warnings) != 1 || resp.Warnings[0].Code != WarningCodeDeprecatedRoute || resp.Warnings[0].Sunset != "2027-04-01T00:00:00Z" {
+		t.Errorf("warnings = %+v, want one deprecation warning with the sunset", resp.Warnings)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/abc/download-url", nil))
+	if rec.Header().Get("Deprecation") != "" || strings.Contains(rec.Body.String(), "warnings") {
+		t.Error("a route not in the table was marked deprecated")
+	}
+}
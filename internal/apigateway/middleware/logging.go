@@ -1,12 +1,13 @@
 package middleware
 
 import (
-	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"log"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"vibe-drop/internal/common"
 )
 
 type responseWriter struct {
@@ -26,10 +27,9 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
-func generateRequestID() string {
-	bytes := make([]byte, 8)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
+// Unwrap exposes the underlying writer to http.ResponseController and error helpers
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
 func getClientIP(r *http.Request) string {
@@ -46,40 +46,48 @@ func getClientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
-func RequestLogging() func(http.Handler) http.Handler {
+// RequestLogging logs each request's start and outcome with the request-scoped logger,
+// so both lines carry the request ID and route. With accessLog, each request also gets
+// an access log line; nil writes none. A storage failure's upstream request IDs, passed
+// on by the file service, are logged and put on the request's span, so an AWS support
+// case can be traced from the gateway's request ID.
+func RequestLogging(accessLog *AccessLog) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			requestID := generateRequestID()
-			
-			// Add request ID to context and response headers
-			ctx := context.WithValue(r.Context(), "request_id", requestID)
-			r = r.WithContext(ctx)
-			w.Header().Set("X-Request-ID", requestID)
-			
+			logger := common.Logger(r.Context()).With("client_ip", getClientIP(r), "path", r.URL.Path)
+
 			// Wrap response writer to capture status code and size
 			wrapped := &responseWriter{
 				ResponseWriter: w,
 				statusCode:     200, // default status code
 			}
-			
-			// Log incoming request
-			log.Printf("[%s] %s %s %s - Started", requestID, getClientIP(r), r.Method, r.URL.Path)
-			
+
+			logger.Info("Request started")
+
 			// Process request
 			next.ServeHTTP(wrapped, r)
-			
-			// Log completed request
-			duration := time.Since(start)
-			log.Printf("[%s] %s %s %s - Completed %d %d bytes in %v", 
-				requestID, 
-				getClientIP(r), 
-				r.Method, 
-				r.URL.Path, 
-				wrapped.statusCode, 
-				wrapped.size, 
-				duration,
-			)
+
+			completed := []any{
+				"status", wrapped.statusCode,
+				"bytes", wrapped.size,
+				"duration_ms", time.Since(start).Milliseconds(),
+			}
+			if upstream := wrapped.Header().Values(common.UpstreamRequestIDHeader); len(upstream) > 0 {
+				completed = append(completed, "upstream_request_ids", upstream)
+				trace.SpanFromContext(r.Context()).SetAttributes(attribute.StringSlice("vibe_drop.upstream_request_ids", upstream))
+			}
+			logger.Info("Request completed", completed...)
+			if accessLog != nil {
+				accessLog.log(accessLogEntry{
+					r:        r,
+					route:    accessLogRoute(r),
+					status:   wrapped.statusCode,
+					bytes:    wrapped.size,
+					start:    start,
+					duration: time.Since(start),
+				})
+			}
 		})
 	}
-}
\ No newline at end of file
+}
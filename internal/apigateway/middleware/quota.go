@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaPeriod is one quota window (a UTC day or month) and its request limit
+type QuotaPeriod struct {
+	Name    string    // "daily" or "monthly"
+	Start   time.Time // inclusive
+	ResetAt time.Time // when the next window starts
+	Limit   int64
+}
+
+// QuotaStore counts API key requests per quota window
+type QuotaStore interface {
+	// Consume counts one request in every period unless one is already at its limit,
+	// and returns each period's usage after the call
+	Consume(keyID string, periods []QuotaPeriod) (used []int64, allowed bool)
+	// Usage returns each period's usage without counting a request
+	Usage(keyID string, periods []QuotaPeriod) []int64
+}
+
+// QuotaUsage is an API key's consumption of one quota period
+type QuotaUsage struct {
+	Period    string    `json:"period"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// quotaPeriods returns the limited periods containing now; a zero limit means unlimited
+func quotaPeriods(daily, monthly int64, now time.Time) []QuotaPeriod {
+	now = now.UTC()
+	var periods []QuotaPeriod
+	if daily > 0 {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		periods = append(periods, QuotaPeriod{Name: "daily", Start: start, ResetAt: start.AddDate(0, 0, 1), Limit: daily})
+	}
+	if monthly > 0 {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		periods = append(periods, QuotaPeriod{Name: "monthly", Start: start, ResetAt: start.AddDate(0, 1, 0), Limit: monthly})
+	}
+	return periods
+}
+
+func quotaUsage(periods []QuotaPeriod, used []int64) []QuotaUsage {
+	usage := make([]QuotaUsage, len(periods))
+	for i, p := range periods {
+		remaining := p.Limit - used[i]
+		if remaining < 0 {
+			remaining = 0
+		}
+		usage[i] = QuotaUsage{Period: p.Name, Limit: p.Limit, Used: used[i], Remaining: remaining, ResetsAt: p.ResetAt}
+	}
+	return usage
+}
+
+// setQuotaHeaders reports each period as X-Quota-<Period>-Limit, -Remaining and -Reset (Unix seconds)
+func setQuotaHeaders(w http.ResponseWriter, usage []QuotaUsage) {
+	for _, u := range usage {
+		prefix := "X-Quota-" + strings.ToUpper(u.Period[:1]) + u.Period[1:]
+		w.Header().Set(prefix+"-Limit", strconv.FormatInt(u.Limit, 10))
+		w.Header().Set(prefix+"-Remaining", strconv.FormatInt(u.Remaining, 10))
+		w.Header().Set(prefix+"-Reset", strconv.FormatInt(u.ResetsAt.Unix(), 10))
+	}
+}
+
+// MemoryQuotaStore keeps quota counters in process memory. Counts reset when the
+// gateway restarts and are not shared between gateway replicas.
+type MemoryQuotaStore struct {
+	mu       sync.Mutex
+	counters map[string]quotaCounter // keyed by key ID and period name
+}
+
+type quotaCounter struct {
+	start time.Time
+	count int64
+}
+
+// NewMemoryQuotaStore creates an empty in-memory quota store
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counters: make(map[string]quotaCounter)}
+}
+
+func (s *MemoryQuotaStore) Consume(keyID string, periods []QuotaPeriod) ([]int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := s.current(keyID, periods)
+	for i, p := range periods {
+		if used[i] >= p.Limit {
+			return used, false
+		}
+	}
+	for i, p := range periods {
+		used[i]++
+		s.counters[keyID+"|"+p.Name] = quotaCounter{start: p.Start, count: used[i]}
+	}
+	return used, true
+}
+
+func (s *MemoryQuotaStore) Usage(keyID string, periods []QuotaPeriod) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current(keyID, periods)
+}
+
+// current reads each period's count, treating counters from an earlier window as zero
+func (s *MemoryQuotaStore) current(keyID string, periods []QuotaPeriod) []int64 {
+	used := make([]int64, len(periods))
+	for i, p := range periods {
+		if c, ok := s.counters[keyID+"|"+p.Name]; ok && c.start.Equal(p.Start) {
+			used[i] = c.count
+		}
+	}
+	return used
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/auth"
+)
+
+func TestMemoryQuotaStoreResetsEachWindow(t *testing.T) {
+	store := NewMemoryQuotaStore()
+	day1 := quotaPeriods(2, 3, time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC))
+	day2 := quotaPeriods(2, 3, time.Date(2026, 4, 1, 1, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 2; i++ {
+		if _, ok := store.Consume("k1", day1); !ok {
+			t.Fatalf("request %d rejected within quota", i+1)
+		}
+	}
+	if used, ok := store.Consume("k1", day1); ok || used[0] != 2 {
+		t.Fatalf("third request: allowed=%v used=%v, want rejected at 2", ok, used)
+	}
+
+	// A new day (and month) starts both counters again; other keys are independent
+	if used, ok := store.Consume("k1", day2); !ok || used[0] != 1 || used[1] != 1 {
+		t.Errorf("next window: allowed=%v used=%v, want [1 1]", ok, used)
+	}
+	if used := store.Usage("k2", day1); used[0] != 0 {
+		t.Errorf("k2 usage = %v, want 0", used)
+	}
+}
+
+func TestAPIKeyAuthEnforcesQuota(t *testing.T) {
+	store, err := NewAPIKeyStore([]APIKey{{
+		ID: "k1", KeyHash: HashAPIKey("secret"), UserID: "u1",
+		Scopes: []string{auth.ScopeFilesRead}, Tier: "premium", DailyQuota: 2,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := APIKeyAuth(store, auth.NewJWTService("test-secret", time.Hour))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files", nil)
+		req.Header.Set(APIKeyHeader, "secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusNoContent || rec.Header().Get("X-Quota-Daily-Remaining") != "1" ||
+		rec.Header().Get("X-Quota-Monthly-Limit") != "20000000" {
+		t.Fatalf("first request: status %d, headers %v", rec.Code, rec.Header())
+	}
+	send()
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over-quota status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-Quota-Daily-Remaining") != "0" {
+		t.Errorf("over-quota headers = %v", rec.Header())
+	}
+
+	_, usage, ok := store.QuotaUsage("k1")
+	if !ok || len(usage) != 2 || usage[0].Used != 2 || usage[1].Used != 2 {
+		t.Errorf("usage = %+v, want 2 requests counted in each period", usage)
+	}
+}
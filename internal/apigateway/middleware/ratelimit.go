@@ -1,55 +1,156 @@
 package middleware
 
 import (
+	"container/list"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+	"vibe-drop/internal/auth"
 	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
 
+	"github.com/gorilla/mux"
 	"golang.org/x/time/rate"
 )
 
 
+// DefaultLimiterCapacity is how many clients an IPRateLimiter tracks at most. Past it the
+// least recently seen client is forgotten, so a flood from many addresses can't exhaust
+// the gateway's memory.
+const DefaultLimiterCapacity = 100000
+
+// IPRateLimiter keeps a token bucket per client, keyed by IP or user ID. A client idle
+// long enough for its bucket to refill is forgotten, since a new bucket would be the
+// same, and the store never holds more than its capacity.
 type IPRateLimiter struct {
-	ips map[string]*rate.Limiter
-	mu  *sync.RWMutex
-	r   rate.Limit
-	b   int
+	mu       sync.Mutex
+	clients  map[string]*list.Element
+	lru      *list.List // *limiterEntry, most recently seen first
+	r        rate.Limit
+	b        int
+	idle     time.Duration // How long a bucket takes to refill; 0 keeps idle clients
+	capacity int
+}
+
+type limiterEntry struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
 }
 
 func NewIPRateLimiter(r rate.Limit, b int) *IPRateLimiter {
-	return &IPRateLimiter{
-		ips: make(map[string]*rate.Limiter),
-		mu:  &sync.RWMutex{},
-		r:   r,
-		b:   b,
+	i := &IPRateLimiter{
+		clients:  make(map[string]*list.Element),
+		lru:      list.New(),
+		r:        r,
+		b:        b,
+		capacity: DefaultLimiterCapacity,
 	}
+	if r > 0 && r != rate.Inf {
+		i.idle = time.Duration(float64(b) / float64(r) * float64(time.Second))
+	}
+	return i
 }
 
 func (i *IPRateLimiter) AddIP(ip string) *rate.Limiter {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	limiter := rate.NewLimiter(i.r, i.b)
-	i.ips[ip] = limiter
-
-	return limiter
+	if element, exists := i.clients[ip]; exists {
+		i.lru.Remove(element)
+		delete(i.clients, ip)
+	}
+	return i.add(ip, time.Now())
 }
 
 func (i *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
 	i.mu.Lock()
-	limiter, exists := i.ips[ip]
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	i.evictIdle(now)
+	if element, exists := i.clients[ip]; exists {
+		entry := element.Value.(*limiterEntry)
+		entry.lastSeen = now
+		i.lru.MoveToFront(element)
+		return entry.limiter
+	}
+	return i.add(ip, now)
+}
+
+// Len is how many clients are being tracked
+func (i *IPRateLimiter) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.evictIdle(time.Now())
+	return i.lru.Len()
+}
+
+// Capacity is the most clients the limiter tracks at once
+func (i *IPRateLimiter) Capacity() int {
+	return i.capacity
+}
+
+// add tracks a new client, forgetting the least recently seen if the store is full
+func (i *IPRateLimiter) add(ip string, now time.Time) *rate.Limiter {
+	entry := &limiterEntry{key: ip, limiter: rate.NewLimiter(i.r, i.b), lastSeen: now}
+	i.clients[ip] = i.lru.PushFront(entry)
+	for i.lru.Len() > i.capacity {
+		i.remove(i.lru.Back())
+	}
+	return entry.limiter
+}
 
-	if !exists {
-		i.mu.Unlock()
-		return i.AddIP(ip)
+// evictIdle forgets clients whose buckets have refilled, oldest first
+func (i *IPRateLimiter) evictIdle(now time.Time) {
+	if i.idle == 0 {
+		return
+	}
+	for back := i.lru.Back(); back != nil && now.Sub(back.Value.(*limiterEntry).lastSeen) >= i.idle; back = i.lru.Back() {
+		i.remove(back)
 	}
+}
+
+func (i *IPRateLimiter) remove(element *list.Element) {
+	i.lru.Remove(element)
+	delete(i.clients, element.Value.(*limiterEntry).key)
+}
+
+// RateLimiterStatus is how many clients one of the gateway's rate limiters is tracking
+type RateLimiterStatus struct {
+	Name     string `json:"name"`
+	Tracked  int    `json:"tracked"`
+	Capacity int    `json:"capacity"`
+}
+
+var (
+	trackedMu sync.Mutex
+	tracked   = make(map[string]*IPRateLimiter)
+)
 
-	i.mu.Unlock()
+// track names limiter in RateLimiters' report, in place of any earlier limiter of that name
+func track(name string, limiter *IPRateLimiter) *IPRateLimiter {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+	tracked[name] = limiter
 	return limiter
 }
 
+// RateLimiters reports the limiters set up by DefaultRateLimit and UserRateLimit, by name
+func RateLimiters() []RateLimiterStatus {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+	statuses := make([]RateLimiterStatus, 0, len(tracked))
+	for name, limiter := range tracked {
+		statuses = append(statuses, RateLimiterStatus{Name: name, Tracked: limiter.Len(), Capacity: limiter.Capacity()})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
 func getIP(r *http.Request) string {
 	forwarded := r.Header.Get("X-Forwarded-For")
 	if forwarded != "" {
@@ -70,8 +171,38 @@ func getIP(r *http.Request) string {
 }
 
 func RateLimit(limiter *IPRateLimiter) func(http.Handler) http.Handler {
+	return TieredRateLimit(nil, map[registry.RateTier]*IPRateLimiter{registry.TierStandard: limiter})
+}
+
+// TieredRateLimit limits each route by the limiter for its rate tier in routes. Routes
+// not in the table get the standard tier, and tiers without a limiter aren't limited.
+func TieredRateLimit(routes []registry.Route, limiters map[registry.RateTier]*IPRateLimiter) func(http.Handler) http.Handler {
+	tiers := make(map[string]registry.RateTier, len(routes))
+	for _, route := range routes {
+		tiers[route.Key()] = route.RateTier
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// API-key requests are limited by their own tier instead
+			if APIKeyID(r) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			
+			tier := registry.TierStandard
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					if routeTier, ok := tiers[r.Method+" "+template]; ok {
+						tier = routeTier
+					}
+				}
+			}
+			limiter, ok := limiters[tier]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			ip := getIP(r)
 			rateLimiter := limiter.GetLimiter(ip)
 			
@@ -86,7 +217,94 @@ func RateLimit(limiter *IPRateLimiter) func(http.Handler) http.Handler {
 	}
 }
 
-func DefaultRateLimit() func(http.Handler) http.Handler {
-	limiter := NewIPRateLimiter(rate.Every(time.Second), 5)
-	return RateLimit(limiter)
-}
\ No newline at end of file
+// DefaultRateLimit allows each IP a burst of 5 requests, refilled at one a second, and
+// on credential routes one every 12 seconds. Exempt routes aren't limited. Its limiters
+// are reported by RateLimiters as ip_standard and ip_credentials.
+func DefaultRateLimit(routes []registry.Route) func(http.Handler) http.Handler {
+	return TieredRateLimit(routes, map[registry.RateTier]*IPRateLimiter{
+		registry.TierStandard:    track("ip_standard", NewIPRateLimiter(rate.Every(time.Second), 5)),
+		registry.TierCredentials: track("ip_credentials", NewIPRateLimiter(rate.Every(12*time.Second), 5)),
+	})
+}
+// UserRateLimits is how many requests each user may make to each class of route within
+// Window, refilled evenly over it
+type UserRateLimits struct {
+	Window   time.Duration
+	Auth     int
+	Upload   int
+	Download int
+	Default  int // Routes in no other class
+}
+
+// UserRateLimit limits requests carrying a valid JWT by the user it was issued to, so
+// users sharing an IP don't share a limit and spoofing X-Forwarded-For doesn't escape it.
+// Each user has a limit per class of route (registry.UserLimit). Requests without a
+// valid token fall back to the per-IP limits of DefaultRateLimit, exempt routes aren't
+// limited, and API-key requests are limited by their own tier. The per-user limiters are
+// reported by RateLimiters as user_auth, user_upload, user_download and user_default.
+func UserRateLimit(routes []registry.Route, jwtService *auth.JWTService, limits UserRateLimits) func(http.Handler) http.Handler {
+	perUser := func(name string, n int) *IPRateLimiter {
+		return track("user_"+name, NewIPRateLimiter(rate.Limit(float64(n)/limits.Window.Seconds()), n))
+	}
+	limiters := map[registry.UserLimit]*IPRateLimiter{
+		registry.LimitAuth:     perUser("auth", limits.Auth),
+		registry.LimitUpload:   perUser("upload", limits.Upload),
+		registry.LimitDownload: perUser("download", limits.Download),
+		registry.LimitDefault:  perUser("default", limits.Default),
+	}
+	byRoute := make(map[string]registry.Route, len(routes))
+	for _, route := range routes {
+		byRoute[route.Key()] = route
+	}
+	byIP := DefaultRateLimit(routes)
+
+	return func(next http.Handler) http.Handler {
+		ipLimited := byIP(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// API-key requests are limited by their own tier instead
+			if APIKeyID(r) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID := tokenUser(r, jwtService)
+			if userID == "" {
+				ipLimited.ServeHTTP(w, r)
+				return
+			}
+
+			var route registry.Route
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = byRoute[r.Method+" "+template]
+				}
+			}
+			if route.RateTier == registry.TierExempt {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limiter, ok := limiters[route.UserLimit]
+			if !ok {
+				limiter = limiters[registry.LimitDefault]
+			}
+			if !limiter.GetLimiter(userID).Allow() {
+				common.WriteErrorResponse(w, http.StatusTooManyRequests, common.ErrorCodeTooManyRequests,
+					"Too many requests", "Please try again later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenUser is the user a request's bearer token was issued to, or "" without a valid one
+func tokenUser(r *http.Request, jwtService *auth.JWTService) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	claims, err := jwtService.ValidateToken(token)
+	if err != nil {
+		return ""
+	}
+	return claims.UserID
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/registry"
+)
+
+func TestUserRateLimit(t *testing.T) {
+	jwtService := auth.NewJWTService("test-secret", time.Hour)
+	routes := []registry.Route{
+		{Method: "GET", Path: "/files", RateTier: registry.TierStandard},
+		{Method: "POST", Path: "/files/upload-url", RateTier: registry.TierStandard, UserLimit: registry.LimitUpload},
+		{Method: "GET", Path: "/health", RateTier: registry.TierExempt},
+	}
+	r := mux.NewRouter()
+	r.Use(UserRateLimit(routes, jwtService, UserRateLimits{Window: time.Hour, Auth: 1, Upload: 2, Download: 1, Default: 3}))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/files", ok).Methods("GET")
+	r.HandleFunc("/files/upload-url", ok).Methods("POST")
+	r.HandleFunc("/health", ok).Methods("GET")
+
+	tokenFor := func(userID string) string {
+		token, err := jwtService.GenerateToken(userID, userID, auth.RoleUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	alice, bob := tokenFor("alice"), tokenFor("bob")
+	send := func(method, path, token, forwardedFor string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "203.0.113.7:4000" // Everyone shares one NAT address
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A user's limit holds whatever X-Forwarded-For says
+	for i, forwardedFor := range []string{"", "198.51.100.1", "198.51.100.2"} {
+		if code := send("GET", "/files", alice, forwardedFor); code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, code)
+		}
+	}
+	if code := send("GET", "/files", alice, "198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Errorf("request over the limit with a new X-Forwarded-For: status %d, want 429", code)
+	}
+
+	// Another user behind the same address has their own limit, and each class is separate
+	if code := send("GET", "/files", bob, ""); code != http.StatusOK {
+		t.Errorf("second user: status %d, want 200", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := send("POST", "/files/upload-url", alice, ""); code != http.StatusOK {
+			t.Errorf("upload %d: status %d, want 200", i+1, code)
+		}
+	}
+	if code := send("POST", "/files/upload-url", alice, ""); code != http.StatusTooManyRequests {
+		t.Errorf("upload over the limit: status %d, want 429", code)
+	}
+	if code := send("GET", "/health", alice, ""); code != http.StatusOK {
+		t.Errorf("exempt route: status %d, want 200", code)
+	}
+
+	// Without a valid token the per-IP limit applies: a burst of 5
+	for i := 0; i < 5; i++ {
+		send("GET", "/files", "not-a-token", "")
+	}
+	if code := send("GET", "/files", "", ""); code != http.StatusTooManyRequests {
+		t.Errorf("unauthenticated request over the IP limit: status %d, want 429", code)
+	}
+}
+
+func TestIPRateLimiterEvicts(t *testing.T) {
+	// A bucket of 2 refilled at 100/s is full again after 20ms idle
+	limiter := NewIPRateLimiter(rate.Limit(100), 2)
+	limiter.capacity = 3
+
+	first := limiter.GetLimiter("198.51.100.1")
+	if limiter.GetLimiter("198.51.100.1") != first {
+		t.Fatal("a client seen again got a new bucket")
+	}
+	for _, ip := range []string{"198.51.100.2", "198.51.100.3", "198.51.100.4"} {
+		limiter.GetLimiter(ip)
+	}
+	if n := limiter.Len(); n > 3 {
+		t.Errorf("tracking %d clients, want at most the capacity of 3", n)
+	}
+	if _, ok := limiter.clients["198.51.100.1"]; ok {
+		t.Error("least recently seen client kept past the capacity")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := limiter.Len(); n != 0 {
+		t.Errorf("tracking %d clients after they went idle, want 0", n)
+	}
+}
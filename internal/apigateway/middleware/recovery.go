@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 	"runtime"
 	"runtime/debug"
+
+	"vibe-drop/internal/common"
 )
 
 type RecoveryResponse struct {
@@ -15,12 +17,7 @@ type RecoveryResponse struct {
 }
 
 func getRequestID(r *http.Request) string {
-	if id := r.Context().Value("request_id"); id != nil {
-		if requestID, ok := id.(string); ok {
-			return requestID
-		}
-	}
-	return ""
+	return common.GetRequestIDFromContext(r.Context())
 }
 
 func Recovery() func(http.Handler) http.Handler {
@@ -29,13 +26,10 @@ func Recovery() func(http.Handler) http.Handler {
 			defer func() {
 				if err := recover(); err != nil {
 					requestID := getRequestID(r)
-					
-					// Get stack trace
-					stack := debug.Stack()
-					
-					// Log the panic with context
-					log.Printf("[%s] PANIC RECOVERED: %v\nStack trace:\n%s", 
-						requestID, err, string(stack))
+					logger := common.Logger(r.Context())
+
+					// Log the panic with its stack trace
+					logger.Error("Panic recovered", "panic", fmt.Sprint(err), "stack", string(debug.Stack()))
 					
 					// Prepare error response
 					response := RecoveryResponse{
@@ -51,7 +45,7 @@ func Recovery() func(http.Handler) http.Handler {
 					// Send JSON error response
 					if encodeErr := json.NewEncoder(w).Encode(response); encodeErr != nil {
 						// If JSON encoding fails, fall back to plain text
-						log.Printf("[%s] Failed to encode recovery response: %v", requestID, encodeErr)
+						logger.Error("Failed to encode recovery response", "error", encodeErr)
 						w.Header().Set("Content-Type", "text/plain")
 						w.Write([]byte("Internal Server Error"))
 					}
@@ -59,8 +53,8 @@ func Recovery() func(http.Handler) http.Handler {
 					// Log memory stats if panic might be memory-related
 					var m runtime.MemStats
 					runtime.ReadMemStats(&m)
-					log.Printf("[%s] Memory stats after panic - Alloc: %d KB, TotalAlloc: %d KB, Sys: %d KB",
-						requestID, m.Alloc/1024, m.TotalAlloc/1024, m.Sys/1024)
+					logger.Error("Memory stats after panic",
+						"alloc_kb", m.Alloc/1024, "total_alloc_kb", m.TotalAlloc/1024, "sys_kb", m.Sys/1024)
 				}
 			}()
 			
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/s3compat"
+)
+
+// IsS3Request reports whether r is for the S3-compatible API
+func IsS3Request(r *http.Request) bool {
+	return r.URL.Path == s3compat.Path || strings.HasPrefix(r.URL.Path, s3compat.Path+"/")
+}
+
+// S3Auth authenticates requests to the S3-compatible API by their AWS Signature Version 4.
+// The access key ID is an API key's ID and the secret access key is derived from the key
+// with secret (see s3compat.SecretKey), so no S3 credentials are stored. A signed request
+// is then handled as one carrying the API key: rate limited, held to the key's quotas and
+// sent on with a token scoped to the key's scopes. Errors are sent as S3 error documents.
+// Requests to the rest of the API pass through untouched.
+func S3Auth(store *APIKeyStore, jwtService *auth.JWTService, secret []byte) func(http.Handler) http.Handler {
+	secretKey := func(accessKeyID string) (string, bool) {
+		key, ok := store.LookupID(accessKeyID)
+		if !ok {
+			return "", false
+		}
+		return s3compat.SecretKey(secret, key.ID, key.KeyHash), true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return s3Errors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyID, s3Err := s3compat.Verify(r, secretKey, time.Now())
+			if s3Err != nil {
+				common.Logger(r.Context()).Info("S3 request refused", "code", s3Err.Code)
+				s3compat.WriteError(w, r, s3Err)
+				return
+			}
+			key, _ := store.LookupID(keyID)
+
+			// API keys aren't forwarded, even alongside a signature
+			r.Header.Del(APIKeyHeader)
+			if r, ok := authorizeKey(w, r, store, jwtService, key); ok {
+				next.ServeHTTP(w, r)
+			}
+		}), next)
+	}
+}
+
+// s3Errors sends S3 requests to s3 with their errors written as S3 error documents, and
+// the rest to next
+func s3Errors(s3, next http.Handler) http.Handler {
+	s3 = s3compat.Errors(s3)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsS3Request(r) {
+			s3.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"vibe-drop/internal/codegen"
+	"vibe-drop/internal/common"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestSchemaValidation rejects JSON bodies that don't match the operation's request
+// schema in the OpenAPI document, before the request is proxied. Each violation is
+// reported with a JSON pointer to the offending value (e.g. "/scopes/0").
+func RequestSchemaValidation(doc *codegen.Document) func(http.Handler) http.Handler {
+	validator := newSchemaValidator(doc)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			template, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, ok := validator.bodies[r.Method+" "+template]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			raw, err := io.ReadAll(r.Body)
+			if err != nil {
+				common.WriteBadRequestError(w, "Failed to read request body", err.Error())
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+
+			if len(bytes.TrimSpace(raw)) == 0 {
+				if body.required {
+					common.WriteValidationErrors(w, []common.ValidationError{{
+						Field:   "",
+						Code:    common.ErrorCodeFieldRequired,
+						Message: "Request body is required",
+					}})
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			decoder := json.NewDecoder(bytes.NewReader(raw))
+			decoder.UseNumber() // keep integers distinguishable from floats
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				common.WriteValidationError(w, "Invalid JSON format", err.Error())
+				return
+			}
+			if errs := validator.validate(body.schema, value, ""); len(errs) > 0 {
+				common.WriteValidationErrors(w, errs)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type requestBody struct {
+	schema   *codegen.Schema
+	required bool
+}
+
+// schemaValidator checks JSON values against the document's schemas
+type schemaValidator struct {
+	doc    *codegen.Document
+	bodies map[string]requestBody // keyed by "METHOD /path/{template}"
+}
+
+func newSchemaValidator(doc *codegen.Document) *schemaValidator {
+	v := &schemaValidator{doc: doc, bodies: make(map[string]requestBody)}
+	for _, ep := range doc.Endpoints() {
+		if schema := ep.RequestSchema(); schema != nil {
+			v.bodies[ep.Method+" "+ep.Path] = requestBody{schema: schema, required: ep.RequestBody.Required}
+		}
+	}
+	return v
+}
+
+func (v *schemaValidator) validate(s *codegen.Schema, value interface{}, pointer string) []common.ValidationError {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		ref, ok := v.doc.Components.Schemas[codegen.RefName(s.Ref)]
+		if !ok {
+			return nil
+		}
+		return v.validate(ref, value, pointer)
+	}
+
+	var errs []common.ValidationError
+	for _, part := range s.AllOf {
+		errs = append(errs, v.validate(part, value, pointer)...)
+	}
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, variant := range s.OneOf {
+			if len(v.validate(variant, value, pointer)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			errs = append(errs, violation(pointer, common.ErrorCodeInvalidValue, "must match exactly one allowed schema"))
+		}
+	}
+	if s.Type != "" && !hasType(value, s.Type) {
+		return append(errs, violation(pointer, common.ErrorCodeInvalidType, "must be "+article(s.Type)))
+	}
+	if len(s.Enum) > 0 {
+		str, _ := value.(string)
+		if !contains(s.Enum, str) {
+			errs = append(errs, violation(pointer, common.ErrorCodeInvalidValue,
+				"must be one of: "+strings.Join(s.Enum, ", ")))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				errs = append(errs, violation(pointer+"/"+escapePointer(name), common.ErrorCodeFieldRequired, "is required"))
+			}
+		}
+		extra, allowExtra := s.MapValues()
+		closed := string(s.AdditionalProperties) == "false"
+		for _, name := range sortedKeys(value) {
+			child := pointer + "/" + escapePointer(name)
+			if prop, ok := s.Properties[name]; ok {
+				errs = append(errs, v.validate(prop, value[name], child)...)
+			} else if closed {
+				errs = append(errs, violation(child, common.ErrorCodeUnknownField, "is not a recognised field"))
+			} else if allowExtra && extra != nil {
+				errs = append(errs, v.validate(extra, value[name], child)...)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			errs = append(errs, v.validate(s.Items, item, fmt.Sprintf("%s/%d", pointer, i))...)
+		}
+	}
+	return errs
+}
+
+func violation(pointer string, code common.ErrorCode, message string) common.ValidationError {
+	field := pointer
+	if field == "" {
+		field = "/"
+	}
+	return common.ValidationError{Field: pointer, Code: code, Message: field + " " + message}
+}
+
+// hasType reports whether a decoded JSON value has the given JSON schema type
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return true
+}
+
+func article(schemaType string) string {
+	switch schemaType {
+	case "object", "array", "integer":
+		return "an " + schemaType
+	}
+	return "a " + schemaType
+}
+
+// escapePointer escapes a property name for use as a JSON pointer segment (RFC 6901)
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
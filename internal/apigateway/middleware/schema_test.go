@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/apigateway/openapi"
+	"vibe-drop/internal/codegen"
+	"vibe-drop/internal/common"
+)
+
+func TestRequestSchemaValidation(t *testing.T) {
+	doc, err := codegen.Parse(openapi.Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received string
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	r := mux.NewRouter()
+	r.Use(RequestSchemaValidation(doc))
+	r.HandleFunc("/files/upload-url", echo).Methods("POST")
+	r.HandleFunc("/auth/tokens", echo).Methods("POST")
+	r.HandleFunc("/admin/reconciliation", echo).Methods("POST")
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		errors string // "pointer:code" pairs
+	}{
+		{"valid upload", "/files/upload-url", `{"filename": "a.pdf", "size": 10}`, http.StatusNoContent, ""},
+		{"wrong types", "/files/upload-url", `{"filename": 7, "size": "10"}`, http.StatusBadRequest,
+			"/filename:INVALID_TYPE,/size:INVALID_TYPE"},
+		{"fractional integer", "/files/upload-url", `{"filename": "a.pdf", "size": 1.5}`, http.StatusBadRequest,
+			"/size:INVALID_TYPE"},
+		{"missing field", "/files/upload-url", `{"filename": "a.pdf"}`, http.StatusBadRequest, "/size:FIELD_REQUIRED"},
+		{"missing body", "/files/upload-url", ``, http.StatusBadRequest, ":FIELD_REQUIRED"},
+		{"not an object", "/files/upload-url", `[]`, http.StatusBadRequest, ":INVALID_TYPE"},
+		{"bad enum in array", "/auth/tokens", `{"scopes": ["files:read", "files:nuke"]}`, http.StatusBadRequest,
+			"/scopes/1:INVALID_VALUE"},
+		{"optional body omitted", "/admin/reconciliation", ``, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusNoContent {
+				if received != tt.body {
+					t.Errorf("handler received %q, want the original body", received)
+				}
+				return
+			}
+
+			var resp common.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range resp.Error.Errors {
+				got = append(got, e.Field+":"+string(e.Code))
+			}
+			if strings.Join(got, ",") != tt.errors {
+				t.Errorf("errors = %v, want %s", got, tt.errors)
+			}
+		})
+	}
+}
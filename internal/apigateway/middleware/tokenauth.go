@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/registry"
+)
+
+// UserIDHeader carries the user ID the gateway verified a request's token for, so services
+// behind it can tell who is calling without parsing the token. Clients can't set it: any
+// they send is removed.
+const UserIDHeader = "X-VD-User-ID"
+
+// TokenAuth checks the bearer token on routes that need a signed-in user before they are
+// proxied, with the same rules the file service applies: a valid token with the route's
+// scope, or a full-access token where the route requires one. Rejected requests never
+// reach the file service; accepted ones go on with UserIDHeader set. With a nil jwtService
+// tokens are left to the file service, and the header is only removed.
+func TokenAuth(routes []registry.Route, jwtService *auth.JWTService) func(http.Handler) http.Handler {
+	byRoute := make(map[string]registry.Route, len(routes))
+	for _, route := range routes {
+		if route.Auth == registry.AuthUser || route.Auth == registry.AuthFullAccess {
+			byRoute[route.Key()] = route
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		// Each route's checks are built once, around the rest of the chain
+		forward := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID, err := auth.GetUserIDFromContext(r.Context()); err == nil {
+				r.Header.Set(UserIDHeader, userID)
+			}
+			next.ServeHTTP(w, r)
+		})
+		checked := make(map[string]http.Handler, len(byRoute))
+		if jwtService != nil {
+			authenticate := auth.AuthMiddleware(jwtService)
+			for key, route := range byRoute {
+				if route.Auth == registry.AuthFullAccess {
+					checked[key] = authenticate(auth.RequireFullAccess()(forward))
+				} else {
+					checked[key] = authenticate(auth.RequireScope(route.Scope)(forward))
+				}
+			}
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del(UserIDHeader)
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					if handler, ok := checked[r.Method+" "+template]; ok {
+						handler.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
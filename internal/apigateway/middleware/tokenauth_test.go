@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/registry"
+)
+
+func TestTokenAuth(t *testing.T) {
+	jwtService := auth.NewJWTService("test-secret", time.Hour)
+	routes := []registry.Route{
+		{Method: "GET", Path: "/files", Auth: registry.AuthUser, Scope: auth.ScopeFilesRead},
+		{Method: "POST", Path: "/auth/tokens", Auth: registry.AuthFullAccess},
+		{Method: "GET", Path: "/health", Auth: registry.AuthNone},
+	}
+	newRouter := func(jwtService *auth.JWTService) *mux.Router {
+		r := mux.NewRouter()
+		r.Use(TokenAuth(routes, jwtService))
+		echo := func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get(UserIDHeader)))
+		}
+		r.HandleFunc("/files", echo).Methods("GET")
+		r.HandleFunc("/auth/tokens", echo).Methods("POST")
+		r.HandleFunc("/health", echo).Methods("GET")
+		return r
+	}
+	r := newRouter(jwtService)
+
+	full, _ := jwtService.GenerateToken("user-1", "alice", auth.RoleUser)
+	writeOnly, _ := jwtService.GenerateScopedToken("user-1", "alice", []string{auth.ScopeFilesWrite}, time.Hour)
+	readOnly, _ := jwtService.GenerateScopedToken("user-1", "alice", []string{auth.ScopeFilesRead}, time.Hour)
+	tests := []struct {
+		name, method, path, token string
+		wantStatus                int
+		wantUser                  string
+	}{
+		{"no token", "GET", "/files", "", http.StatusUnauthorized, ""},
+		{"invalid token", "GET", "/files", "not-a-token", http.StatusUnauthorized, ""},
+		{"full access", "GET", "/files", full, http.StatusOK, "user-1"},
+		{"missing scope", "GET", "/files", writeOnly, http.StatusForbidden, ""},
+		{"scoped token for a full-access route", "POST", "/auth/tokens", readOnly, http.StatusForbidden, ""},
+		{"public route", "GET", "/health", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(UserIDHeader, "someone-else")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != tt.wantUser {
+				t.Errorf("forwarded user %q, want %q", rec.Body.String(), tt.wantUser)
+			}
+		})
+	}
+
+	// Without a verifier requests pass, but a client's own header is still dropped
+	req := httptest.NewRequest("GET", "/files", nil)
+	req.Header.Set(UserIDHeader, "someone-else")
+	rec := httptest.NewRecorder()
+	newRouter(nil).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "" {
+		t.Errorf("without a verifier: status %d, forwarded user %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,23 @@
+// Package openapi serves the gateway's OpenAPI specification, which is also the
+// source for the generated TypeScript and Python clients (see cmd/vibedrop-gen)
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the raw OpenAPI document
+func Spec() []byte {
+	return spec
+}
+
+// Handler serves the OpenAPI document
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec)
+}
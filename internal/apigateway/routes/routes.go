@@ -1,36 +1,157 @@
 package routes
 
 import (
+	"log"
 	"net/http"
+	"os"
 	
 	"github.com/gorilla/mux"
 	"vibe-drop/internal/apigateway/config"
 	"vibe-drop/internal/apigateway/handlers"
 	"vibe-drop/internal/apigateway/middleware"
+	"vibe-drop/internal/apigateway/openapi"
+	"vibe-drop/internal/apigateway/services"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/codegen"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/registry"
+	"vibe-drop/internal/s3compat"
+	"vibe-drop/internal/telemetry"
 )
 
 func SetupRoutes(cfg *config.Config) *mux.Router {
 	// Initialize handlers with config
+	if cfg.FileServiceProtocol == "grpc" {
+		services.UseGRPC(cfg.FileServiceGRPCPort)
+		log.Printf("Calling file service operations over gRPC on port %d", cfg.FileServiceGRPCPort)
+	}
 	handlers.InitializeFileServiceClient(cfg.FileServiceURL)
+	if cfg.StandbyFileServiceURL != "" {
+		handlers.InitializeFailover(cfg.FileServiceURL, cfg.StandbyFileServiceURL, cfg.FailoverCheckInterval,
+			cfg.FailoverThreshold, cfg.FailbackThreshold, cfg.FailoverAlertWebhookURL)
+		log.Printf("Failing over to %s after %d failed health checks of %s", cfg.StandbyFileServiceURL, cfg.FailoverThreshold, cfg.FileServiceURL)
+	}
+	if cfg.ShadowFileServiceURL != "" && cfg.ShadowPercent > 0 {
+		handlers.InitializeShadowClient(cfg.ShadowFileServiceURL, cfg.ShadowPercent)
+		log.Printf("Mirroring %d%% of read traffic to %s", cfg.ShadowPercent, cfg.ShadowFileServiceURL)
+	}
+	if cfg.CanaryFileServiceURL != "" {
+		handlers.InitializeCanaryRouter(cfg.CanaryFileServiceURL, cfg.CanaryPercent)
+		log.Printf("Routing %d%% of traffic to canary %s", cfg.CanaryPercent, cfg.CanaryFileServiceURL)
+	}
 	r := mux.NewRouter()
 
 	// Apply middleware to all routes (order matters!)
+	r.Use(common.RequestLoggerMiddleware())
 	r.Use(middleware.Recovery())
+	r.Use(telemetry.Middleware("vibe-drop-gateway"))
+	r.Use(common.LocaleMiddleware())
+	r.Use(common.SizeFormatMiddleware())
 	r.Use(middleware.DefaultCORS())
-	r.Use(middleware.RequestLogging())
-	r.Use(middleware.DefaultRateLimit())
-
-	// Health check
-	r.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
-
-	// File service routes
-	fileRouter := r.PathPrefix("/files").Subrouter()
-	fileRouter.HandleFunc("", handlers.ListFilesHandler).Methods("GET")
-	fileRouter.HandleFunc("", handlers.UploadFileHandler).Methods("POST")
-	fileRouter.HandleFunc("/{id}", handlers.GetFileMetadataHandler).Methods("GET")
-	fileRouter.HandleFunc("/{id}/download", handlers.DownloadFileHandler).Methods("GET")
-	fileRouter.HandleFunc("/{id}", handlers.DeleteFileHandler).Methods("DELETE")
-	
+	var accessLog *middleware.AccessLog
+	if cfg.AccessLogFormat != "" {
+		var err error
+		accessLog, err = middleware.NewAccessLog(os.Stdout, registry.Routes, middleware.AccessLogOptions{
+			Format:   cfg.AccessLogFormat,
+			Fields:   cfg.AccessLogFields,
+			Sampling: cfg.AccessLogSampling,
+		})
+		if err != nil {
+			log.Fatalf("Invalid access log configuration: %v", err)
+		}
+	}
+	r.Use(middleware.RequestLogging(accessLog))
+	r.Use(middleware.Deprecation(registry.Routes))
+	jwtService := auth.NewJWTServiceFromConfig(cfg.JWT())
+	if keys := jwtService.RemoteKeys(); keys != nil && (cfg.GatewayAuth || cfg.APIKeysFile != "" || cfg.RateLimitMode == "user") {
+		// The file service may not be up yet; keys are fetched again when a token needs them
+		if err := keys.Refresh(); err != nil {
+			log.Printf("Token keys not fetched yet: %v", err)
+		}
+	}
+	var keyStore *middleware.APIKeyStore
+	if cfg.APIKeysFile != "" {
+		var err error
+		keyStore, err = middleware.LoadAPIKeyStore(cfg.APIKeysFile)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		r.Use(middleware.APIKeyAuth(keyStore, jwtService))
+		if cfg.S3CredentialsSecret != "" {
+			r.Use(middleware.S3Auth(keyStore, jwtService, []byte(cfg.S3CredentialsSecret)))
+		}
+	}
+	if cfg.RateLimitMode == "user" {
+		r.Use(middleware.UserRateLimit(registry.Routes, jwtService, middleware.UserRateLimits{
+			Window:   cfg.UserRateLimitWindow,
+			Auth:     cfg.UserRateLimitAuth,
+			Upload:   cfg.UserRateLimitUpload,
+			Download: cfg.UserRateLimitDownload,
+			Default:  cfg.UserRateLimitDefault,
+		}))
+	} else {
+		r.Use(middleware.DefaultRateLimit(registry.Routes))
+	}
+
+	// Tokens are checked here too when GATEWAY_AUTH is on, after rate limiting so a flood of
+	// bad tokens is still limited
+	var verifier *auth.JWTService
+	if cfg.GatewayAuth {
+		verifier = jwtService
+	}
+	r.Use(middleware.TokenAuth(registry.Routes, verifier))
+
+	// Malformed IDs and chunk numbers are turned away here, with the same rules the file
+	// service applies, so they are never proxied
+	r.Use(common.PathParamValidationMiddleware())
+
+	// Request bodies are checked against the same spec the clients are generated from
+	spec, err := codegen.Parse(openapi.Spec())
+	if err != nil {
+		log.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	r.Use(middleware.RequestSchemaValidation(spec))
+
+	// The gateway serves these routes itself; the rest of the registry is proxied to the
+	// file service. Admin routes served here are authenticated here, since they never reach
+	// the file service.
+	local := map[string]http.Handler{
+		"getHealth":          http.HandlerFunc(handlers.HealthHandler),
+		"getLiveness":        http.HandlerFunc(handlers.HealthHandler),
+		"getReadiness":       handlers.ReadinessHandler(),
+		"getAPISpec":         http.HandlerFunc(openapi.Handler),
+		"getAPIKeyUsage":     handlers.APIKeyUsageHandler(keyStore),
+		"getS3Credentials":   handlers.S3CredentialsHandler(keyStore, []byte(cfg.S3CredentialsSecret)),
+		"getUserProfile":     http.HandlerFunc(handlers.GetUserProfileHandler),
+		"updateUserProfile":  http.HandlerFunc(handlers.UpdateUserProfileHandler),
+		"getBackendStatus":   http.HandlerFunc(handlers.BackendStatusHandler),
+		"switchBackend":      http.HandlerFunc(handlers.SwitchBackendHandler),
+		"getRateLimitStatus": http.HandlerFunc(handlers.RateLimitStatusHandler),
+	}
+	requireAdmin := auth.AdminMiddleware(cfg.AdminAPIKey, jwtService)
+	for _, route := range registry.Routes {
+		var handler http.Handler
+		switch {
+		case route.ServicePath != "":
+			handler = handlers.ProxyHandler(route)
+		case local[route.Name] == nil:
+			log.Fatalf("No gateway handler for %s (%s)", route.Key(), route.Name)
+		case route.Auth == registry.AuthAdmin:
+			handler = requireAdmin(local[route.Name])
+		default:
+			handler = local[route.Name]
+		}
+		r.Handle(route.Path, handler).Methods(route.Method).Name(route.Name)
+	}
+
+	// The S3-compatible API isn't in the registry: S3 clients name buckets and objects in
+	// the path, and S3Auth has checked their signatures
+	if keyStore != nil && cfg.S3CredentialsSecret != "" {
+		s3 := handlers.S3ProxyHandler()
+		r.Handle(s3compat.Path, s3)
+		r.PathPrefix(s3compat.Path + "/").Handler(s3)
+	}
+
 	// Add OPTIONS support for all routes (handled by CORS middleware)
 	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// This will be handled by CORS middleware for OPTIONS requests
@@ -38,17 +159,5 @@ func SetupRoutes(cfg *config.Config) *mux.Router {
 		w.WriteHeader(404)
 	}).Methods("OPTIONS")
 
-	// Auth service routes
-	authRouter := r.PathPrefix("/auth").Subrouter()
-	authRouter.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
-	authRouter.HandleFunc("/register", handlers.RegisterHandler).Methods("POST")
-	authRouter.HandleFunc("/refresh", handlers.RefreshTokenHandler).Methods("POST")
-
-	// User service routes
-	userRouter := r.PathPrefix("/users").Subrouter()
-	userRouter.HandleFunc("/me", handlers.GetCurrentUserHandler).Methods("GET")
-	userRouter.HandleFunc("/{id}", handlers.GetUserProfileHandler).Methods("GET")
-	userRouter.HandleFunc("/{id}", handlers.UpdateUserProfileHandler).Methods("PUT")
-
 	return r
-}
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/apigateway/config"
+	"vibe-drop/internal/apigateway/openapi"
+)
+
+// TestOpenAPISpecMatchesRoutes keeps openapi.json in step with the router: every
+// registered route must be documented and every documented operation must exist
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	router := SetupRoutes(&config.Config{FileServiceURL: "http://localhost:8081"})
+
+	routes := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // subrouter prefixes have no methods of their own
+		}
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue // CORS preflight catch-all
+			}
+			routes[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking routes: %v", err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec(), &spec); err != nil {
+		t.Fatalf("parsing openapi.json: %v", err)
+	}
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var missing, stale []string
+	for route := range routes {
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+	for op := range documented {
+		if !routes[op] {
+			stale = append(stale, op)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+
+	for _, route := range missing {
+		t.Errorf("route %s is not documented in openapi.json", route)
+	}
+	for _, op := range stale {
+		t.Errorf("openapi.json documents %s but no route serves it", op)
+	}
+}
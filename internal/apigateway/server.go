@@ -8,12 +8,29 @@ import (
 
 	"vibe-drop/internal/apigateway/config"
 	"vibe-drop/internal/apigateway/routes"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/telemetry"
 )
 
 var server *http.Server
+var shutdownTracing func(context.Context) error
 
 func Start() {
 	cfg := config.Load()
+	if err := common.SetupLogging("vibe-drop-gateway", cfg.LogLevel); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	var err error
+	shutdownTracing, err = telemetry.Setup(context.Background(), telemetry.Config{
+		ServiceName:   "vibe-drop-gateway",
+		OTLPEndpoint:  cfg.OTLPEndpoint,
+		SamplePercent: cfg.TraceSamplePercent,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	router := routes.SetupRoutes(cfg)
 
 	server = &http.Server{
@@ -40,4 +57,12 @@ func Stop() {
 			log.Println("API Gateway stopped gracefully")
 		}
 	}
+
+	if shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}
 }
\ No newline at end of file
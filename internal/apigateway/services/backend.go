@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drainTimeout bounds how long a replaced backend is given to finish its requests. It
+// matches the client timeout, which already caps each proxied request.
+const drainTimeout = 30 * time.Second
+
+const drainPollInterval = 100 * time.Millisecond
+
+// BackendSwitch holds the primary file service and lets it be replaced at runtime
+// (blue/green). New requests go to the new backend at once; the old one keeps
+// serving the requests it already has until they finish, then its connections close.
+type BackendSwitch struct {
+	current atomic.Pointer[FileServiceClient]
+
+	mu       sync.Mutex
+	draining map[*FileServiceClient]time.Time // replaced backends and when they were replaced
+}
+
+// BackendStatus describes the active backend and any still draining
+type BackendStatus struct {
+	URL      string            `json:"url"`
+	InFlight int64             `json:"in_flight"`
+	Draining []DrainingBackend `json:"draining"`
+	Failover *FailoverStatus   `json:"failover,omitempty"` // Set when a standby is configured
+}
+
+// DrainingBackend is a replaced backend still finishing its requests
+type DrainingBackend struct {
+	URL        string    `json:"url"`
+	InFlight   int64     `json:"in_flight"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// NewBackendSwitch starts with initial as the active backend
+func NewBackendSwitch(initial *FileServiceClient) *BackendSwitch {
+	s := &BackendSwitch{draining: make(map[*FileServiceClient]time.Time)}
+	s.current.Store(initial)
+	return s
+}
+
+// Current returns the backend new requests should use
+func (s *BackendSwitch) Current() *FileServiceClient {
+	return s.current.Load()
+}
+
+// SwitchTo makes baseURL the active backend once it passes a health check, and
+// drains the previous backend in the background
+func (s *BackendSwitch) SwitchTo(baseURL string) error {
+	next := NewFileServiceClient(baseURL)
+	if err := next.Ping(context.Background()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.current.Swap(next)
+	s.draining[previous] = time.Now()
+	s.mu.Unlock()
+
+	log.Printf("File service switched from %s to %s; draining %d in-flight requests",
+		previous.BaseURL(), baseURL, previous.InFlight())
+	go s.drain(previous)
+	return nil
+}
+
+// drain waits for a replaced backend's requests to finish, then releases its connections
+func (s *BackendSwitch) drain(old *FileServiceClient) {
+	deadline := time.Now().Add(drainTimeout)
+	for old.InFlight() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+	if n := old.InFlight(); n > 0 {
+		log.Printf("Drain timeout for %s with %d requests still in flight", old.BaseURL(), n)
+	}
+	old.httpClient.CloseIdleConnections()
+
+	s.mu.Lock()
+	delete(s.draining, old)
+	s.mu.Unlock()
+}
+
+// Status reports the active backend and any still draining
+func (s *BackendSwitch) Status() BackendStatus {
+	current := s.Current()
+	status := BackendStatus{URL: current.BaseURL(), InFlight: current.InFlight(), Draining: []DrainingBackend{}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client, replacedAt := range s.draining {
+		status.Draining = append(status.Draining, DrainingBackend{
+			URL:        client.BaseURL(),
+			InFlight:   client.InFlight(),
+			ReplacedAt: replacedAt,
+		})
+	}
+	sort.Slice(status.Draining, func(i, j int) bool {
+		return status.Draining[i].ReplacedAt.Before(status.Draining[j].ReplacedAt)
+	})
+	return status
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackendSwitchDrainsPreviousBackend(t *testing.T) {
+	release := make(chan struct{})
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("blue"))
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("green"))
+	}))
+	defer green.Close()
+
+	s := NewBackendSwitch(NewFileServiceClient(blue.URL))
+
+	// Start a slow request on blue, then switch while it is in flight
+	done := make(chan string)
+	go func() {
+		resp, err := s.Current().ProxyRequest(context.Background(), "GET", "/files", nil, nil)
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		done <- string(body)
+	}()
+	for s.Current().InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.SwitchTo(green.URL); err != nil {
+		t.Fatalf("SwitchTo: %v", err)
+	}
+	if got := s.Current().BaseURL(); got != green.URL {
+		t.Fatalf("current = %s, want green", got)
+	}
+	status := s.Status()
+	if len(status.Draining) != 1 || status.Draining[0].URL != blue.URL || status.Draining[0].InFlight != 1 {
+		t.Fatalf("draining = %+v, want blue with one request", status.Draining)
+	}
+
+	// The in-flight request still completes on blue, after which blue stops draining
+	close(release)
+	if got := <-done; got != "blue" {
+		t.Errorf("in-flight request got %q, want blue", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.Status().Draining) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(s.Status().Draining); n != 0 {
+		t.Errorf("%d backends still draining after their requests finished", n)
+	}
+}
+
+func TestBackendSwitchRejectsUnhealthyBackend(t *testing.T) {
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer sick.Close()
+
+	s := NewBackendSwitch(NewFileServiceClient("http://blue"))
+	if err := s.SwitchTo(sick.URL); err == nil {
+		t.Fatal("switched to a backend failing its health check")
+	}
+	if got := s.Current().BaseURL(); got != "http://blue" {
+		t.Errorf("current = %s, want the original backend", got)
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// CanaryHeader lets a client force its request to the canary ("true") or the primary ("false")
+	CanaryHeader = "X-VD-Canary"
+	// BackendHeader tells the client which backend served the request
+	BackendHeader = "X-VD-Backend"
+)
+
+// CanaryRouter splits traffic between the primary file service and a canary release
+type CanaryRouter struct {
+	canary  *FileServiceClient
+	percent int
+}
+
+// NewCanaryRouter sends percent (0-100) of requests to canary and the rest to the primary
+func NewCanaryRouter(canary *FileServiceClient, percent int) *CanaryRouter {
+	return &CanaryRouter{canary: canary, percent: percent}
+}
+
+// Ping checks the canary answers its health check
+func (c *CanaryRouter) Ping(ctx context.Context) error {
+	return c.canary.Ping(ctx)
+}
+
+// Pick chooses between primary and the canary for a request, honouring CanaryHeader
+// before the weighting. It reports whether the canary was chosen.
+func (c *CanaryRouter) Pick(r *http.Request, primary *FileServiceClient) (*FileServiceClient, bool) {
+	if forced, err := strconv.ParseBool(r.Header.Get(CanaryHeader)); err == nil {
+		if forced {
+			return c.canary, true
+		}
+		return primary, false
+	}
+	if rand.Intn(100) < c.percent {
+		return c.canary, true
+	}
+	return primary, false
+}
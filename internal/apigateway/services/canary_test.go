@@ -0,0 +1,37 @@
+package services
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanaryRouterPick(t *testing.T) {
+	primary := NewFileServiceClient("http://primary")
+	canary := NewFileServiceClient("http://canary")
+
+	tests := []struct {
+		name    string
+		percent int
+		header  string
+		want    *FileServiceClient
+	}{
+		{"no traffic by default", 0, "", primary},
+		{"all traffic", 100, "", canary},
+		{"forced to canary", 0, "true", canary},
+		{"forced to primary", 100, "false", primary},
+		{"unrecognised header falls back to weighting", 0, "maybe", primary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewCanaryRouter(canary, tt.percent)
+			req := httptest.NewRequest("GET", "/files", nil)
+			if tt.header != "" {
+				req.Header.Set(CanaryHeader, tt.header)
+			}
+			got, isCanary := router.Pick(req, primary)
+			if got != tt.want || isCanary != (tt.want == canary) {
+				t.Errorf("Pick() = %s (canary=%v), want %s", got.baseURL, isCanary, tt.want.baseURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// uncoalescedHeaders differ between otherwise identical requests without changing the
+// response, so they're left out when deciding whether two requests are the same
+var uncoalescedHeaders = map[string]bool{
+	"X-Request-Id": true,
+	"Traceparent":  true,
+	"Tracestate":   true,
+}
+
+// SharedResponse is a file service response read in full, so it can be written to every
+// caller that asked for it
+type SharedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Coalescer collapses concurrent identical requests into one, so many clients refreshing
+// the same page at once cost the file service a single request. Requests are identical
+// when they go to the same backend with the same path, query and headers, which includes
+// the caller's credentials: users never share a response.
+type Coalescer struct {
+	group singleflight.Group
+}
+
+// NewCoalescer creates an empty Coalescer
+func NewCoalescer() *Coalescer {
+	return &Coalescer{}
+}
+
+// Get sends a GET for path to client unless an identical one is already in flight, in
+// which case it waits for that one's response. It reports whether the response was
+// shared with other callers. The request isn't cancelled when the caller that sent it
+// goes away, since others may be waiting on it; the client timeout still bounds it.
+func (c *Coalescer) Get(ctx context.Context, client *FileServiceClient, path string, headers map[string]string) (*SharedResponse, bool, error) {
+	result, err, shared := c.group.Do(coalesceKey(client, path, headers), func() (interface{}, error) {
+		resp, err := client.ProxyRequest(context.WithoutCancel(ctx), "GET", path, nil, headers)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file service response: %w", err)
+		}
+		return &SharedResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+	})
+	if err != nil {
+		return nil, shared, err
+	}
+	return result.(*SharedResponse), shared, nil
+}
+
+func coalesceKey(client *FileServiceClient, path string, headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if !uncoalescedHeaders[http.CanonicalHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(client.BaseURL() + path)
+	for _, name := range names {
+		fmt.Fprintf(&key, "\n%s: %s", name, headers[name])
+	}
+	return key.String()
+}
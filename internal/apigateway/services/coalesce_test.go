@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescerSharesIdenticalRequests(t *testing.T) {
+	var hits atomic.Int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer backend.Close()
+
+	client := NewFileServiceClient(backend.URL)
+	c := NewCoalescer()
+	get := func(token, requestID string) (string, bool) {
+		resp, shared, err := c.Get(context.Background(), client, "/files?limit=5", map[string]string{
+			"Authorization": token,
+			"X-Request-ID":  requestID,
+		})
+		if err != nil {
+			t.Error(err)
+			return "", shared
+		}
+		return string(resp.Body), shared
+	}
+
+	// Four requests for alice's files while the first is in flight, and one for bob's
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	wg.Add(1)
+	go func() { defer wg.Done(); bodies[0], _ = get("alice", "req-0") }()
+	<-arrived
+	for i := 1; i < 4; i++ {
+		wg.Add(1)
+		go func() { defer wg.Done(); bodies[i], _ = get("alice", "req-"+strconv.Itoa(i)) }()
+	}
+	wg.Add(1)
+	go func() { defer wg.Done(); bodies[4], _ = get("bob", "req-4") }()
+	<-arrived
+	time.Sleep(50 * time.Millisecond) // Let the other requests for alice's files join
+	close(release)
+	wg.Wait()
+
+	if n := hits.Load(); n != 2 {
+		t.Errorf("file service got %d requests, want one per user", n)
+	}
+	for i, want := range []string{"alice", "alice", "alice", "alice", "bob"} {
+		if bodies[i] != want {
+			t.Errorf("response %d = %q, want %s's", i, bodies[i], want)
+		}
+	}
+
+	// Once the response is in, the next request goes to the file service again
+	if _, shared := get("alice", "req-5"); shared {
+		t.Error("a later request shared a finished response")
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("file service got %d requests, want 3", n)
+	}
+}
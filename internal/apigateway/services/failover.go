@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"vibe-drop/internal/common"
+)
+
+// failoverPingTimeout bounds each health check of the primary, as readiness does
+const failoverPingTimeout = 2 * time.Second
+
+// Kinds of FailoverEvent
+const (
+	FailoverKindFailover = "failover" // Traffic moved from the primary to the standby
+	FailoverKindFailback = "failback" // Traffic moved back to the primary
+)
+
+// FailoverEvent is an automatic switch between the primary and standby file services
+type FailoverEvent struct {
+	Kind   string    `json:"kind"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Checks int       `json:"checks"`          // Consecutive health checks of the primary that led to the switch
+	Error  string    `json:"error,omitempty"` // The primary's last health check error, on failover
+	At     time.Time `json:"at"`
+}
+
+// FailoverNotifier is told of each automatic switch
+type FailoverNotifier interface {
+	Notify(ctx context.Context, event FailoverEvent)
+}
+
+// FailoverStatus describes automatic failover for GET /admin/backend
+type FailoverStatus struct {
+	PrimaryURL  string         `json:"primary_url"`
+	StandbyURL  string         `json:"standby_url"`
+	FailedOver  bool           `json:"failed_over"`          // Whether traffic is on the standby because the primary failed
+	Failures    int            `json:"consecutive_failures"` // The primary's consecutive failed health checks
+	Passes      int            `json:"consecutive_passes"`   // The primary's consecutive passed health checks
+	LastError   string         `json:"last_error,omitempty"`
+	LastCheckAt *time.Time     `json:"last_check_at,omitempty"`
+	LastEvent   *FailoverEvent `json:"last_event,omitempty"`
+}
+
+// Failover watches the primary file service's health and moves a BackendSwitch to a standby
+// when the primary fails failAfter checks in a row, then back once it passes recoverAfter in
+// a row. It only fails over while the primary is the active backend and only fails back
+// from the standby it moved to, so a blue/green switch by an operator is left alone.
+type Failover struct {
+	backends     *BackendSwitch
+	primary      *FileServiceClient // Checked whichever backend is active
+	standby      *FileServiceClient // Pinged for readiness; SwitchTo makes its own client
+	failAfter    int
+	recoverAfter int
+	notifiers    []FailoverNotifier
+
+	mu         sync.Mutex
+	failedOver bool
+	failures   int
+	passes     int
+	lastErr    error
+	lastCheck  time.Time
+	lastEvent  *FailoverEvent
+}
+
+// NewFailover fails backends over from primaryURL to standbyURL
+func NewFailover(backends *BackendSwitch, primaryURL, standbyURL string, failAfter, recoverAfter int) *Failover {
+	return &Failover{
+		backends:     backends,
+		primary:      NewFileServiceClient(primaryURL),
+		standby:      NewFileServiceClient(standbyURL),
+		failAfter:    failAfter,
+		recoverAfter: recoverAfter,
+	}
+}
+
+// OnSwitch has notifier told of each automatic switch
+func (f *Failover) OnSwitch(notifier FailoverNotifier) {
+	f.notifiers = append(f.notifiers, notifier)
+}
+
+// PingStandby checks the standby answers its health check
+func (f *Failover) PingStandby(ctx context.Context) error {
+	return f.standby.Ping(ctx)
+}
+
+// Run checks the primary every interval until ctx is cancelled
+func (f *Failover) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.Check(ctx)
+		}
+	}
+}
+
+// Check runs one health check of the primary and switches backends if it tips the count
+// either way. A standby that fails its own health check isn't switched to; the next failed
+// check of the primary tries again.
+func (f *Failover) Check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, failoverPingTimeout)
+	err := f.primary.Ping(pingCtx)
+	cancel()
+
+	f.mu.Lock()
+	f.lastCheck = time.Now()
+	f.lastErr = err
+	if err != nil {
+		f.failures++
+		f.passes = 0
+	} else {
+		f.passes++
+		f.failures = 0
+	}
+	current := f.backends.Current().BaseURL()
+	if f.failedOver && current != f.standby.BaseURL() {
+		// An operator has switched backends since; the choice is theirs now
+		f.failedOver = false
+	}
+	var event *FailoverEvent
+	switch {
+	case !f.failedOver && current == f.primary.BaseURL() && f.failures >= f.failAfter:
+		event = &FailoverEvent{Kind: FailoverKindFailover, From: current, To: f.standby.BaseURL(), Checks: f.failures, Error: err.Error()}
+	case f.failedOver && f.passes >= f.recoverAfter:
+		event = &FailoverEvent{Kind: FailoverKindFailback, From: current, To: f.primary.BaseURL(), Checks: f.passes}
+	}
+	f.mu.Unlock()
+	if event == nil {
+		return
+	}
+
+	if err := f.backends.SwitchTo(event.To); err != nil {
+		log.Printf("Automatic %s from %s to %s failed: %v", event.Kind, event.From, event.To, err)
+		return
+	}
+	event.At = time.Now()
+	f.mu.Lock()
+	f.failedOver = event.Kind == FailoverKindFailover
+	f.lastEvent = event
+	f.mu.Unlock()
+
+	if event.Kind == FailoverKindFailover {
+		log.Printf("ALERT: file service %s failed %d health checks (%s); failed over to standby %s", event.From, event.Checks, event.Error, event.To)
+	} else {
+		log.Printf("ALERT: file service %s passed %d health checks; failed back from standby %s", event.To, event.Checks, event.From)
+	}
+	for _, notifier := range f.notifiers {
+		notifier.Notify(ctx, *event)
+	}
+}
+
+// Status reports the primary's recent health and whether traffic is on the standby
+func (f *Failover) Status() FailoverStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := FailoverStatus{
+		PrimaryURL: f.primary.BaseURL(),
+		StandbyURL: f.standby.BaseURL(),
+		FailedOver: f.failedOver,
+		Failures:   f.failures,
+		Passes:     f.passes,
+		LastEvent:  f.lastEvent,
+	}
+	if f.lastErr != nil {
+		status.LastError = f.lastErr.Error()
+	}
+	if !f.lastCheck.IsZero() {
+		lastCheck := f.lastCheck
+		status.LastCheckAt = &lastCheck
+	}
+	return status
+}
+
+// FailoverWebhook posts each automatic switch as JSON to an alert webhook, with the switch
+// in "event"
+type FailoverWebhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewFailoverWebhook creates a notifier that posts to url
+func NewFailoverWebhook(url string) *FailoverWebhook {
+	return &FailoverWebhook{url: url, client: common.NewWebhookClient()}
+}
+
+func (n *FailoverWebhook) Notify(ctx context.Context, event FailoverEvent) {
+	text := fmt.Sprintf("File service failed back to %s after %d passed health checks", event.To, event.Checks)
+	if event.Kind == FailoverKindFailover {
+		text = fmt.Sprintf("File service %s failed %d health checks (%s); failed over to %s", event.From, event.Checks, event.Error, event.To)
+	}
+	if err := common.PostWebhook(ctx, n.client, n.url, map[string]interface{}{"text": text, "event": event}); err != nil {
+		log.Printf("Failed to send failover alert: %v", err)
+	}
+}
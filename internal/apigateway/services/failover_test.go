@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// healthServer answers /health with 200 while healthy is set, and 503 otherwise
+func healthServer(t *testing.T, healthy *atomic.Bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type recordedSwitches []FailoverEvent
+
+func (r *recordedSwitches) Notify(_ context.Context, event FailoverEvent) {
+	*r = append(*r, event)
+}
+
+func TestFailoverAndFailback(t *testing.T) {
+	var primaryUp, standbyUp atomic.Bool
+	standbyUp.Store(true)
+	primary, standby := healthServer(t, &primaryUp), healthServer(t, &standbyUp)
+
+	backends := NewBackendSwitch(NewFileServiceClient(primary.URL))
+	f := NewFailover(backends, primary.URL, standby.URL, 2, 3)
+	var switches recordedSwitches
+	f.OnSwitch(&switches)
+	ctx := context.Background()
+
+	f.Check(ctx)
+	if got := backends.Current().BaseURL(); got != primary.URL {
+		t.Fatalf("failed over after one failed check, to %s", got)
+	}
+	f.Check(ctx)
+	if got := backends.Current().BaseURL(); got != standby.URL {
+		t.Fatalf("current = %s after two failed checks, want the standby", got)
+	}
+	if len(switches) != 1 || switches[0].Kind != FailoverKindFailover || switches[0].Checks != 2 || switches[0].Error == "" {
+		t.Fatalf("alerts = %+v, want one failover with the primary's error", switches)
+	}
+	if status := f.Status(); !status.FailedOver || status.Failures != 2 {
+		t.Errorf("status = %+v, want failed over after 2 failures", status)
+	}
+
+	// A flapping primary doesn't take traffic back until it passes enough checks in a row
+	primaryUp.Store(true)
+	f.Check(ctx)
+	f.Check(ctx)
+	primaryUp.Store(false)
+	f.Check(ctx)
+	primaryUp.Store(true)
+	f.Check(ctx)
+	f.Check(ctx)
+	if got := backends.Current().BaseURL(); got != standby.URL {
+		t.Fatalf("failed back to a flapping primary")
+	}
+	f.Check(ctx)
+	if got := backends.Current().BaseURL(); got != primary.URL {
+		t.Fatalf("current = %s after three passed checks, want the primary", got)
+	}
+	if len(switches) != 2 || switches[1].Kind != FailoverKindFailback || switches[1].To != primary.URL {
+		t.Fatalf("alerts = %+v, want a failback after the failover", switches)
+	}
+	if f.Status().FailedOver {
+		t.Error("status still failed over after failing back")
+	}
+}
+
+func TestFailoverNeedsHealthyStandby(t *testing.T) {
+	var primaryUp, standbyUp atomic.Bool
+	primary, standby := healthServer(t, &primaryUp), healthServer(t, &standbyUp)
+
+	backends := NewBackendSwitch(NewFileServiceClient(primary.URL))
+	f := NewFailover(backends, primary.URL, standby.URL, 1, 1)
+	var switches recordedSwitches
+	f.OnSwitch(&switches)
+
+	f.Check(context.Background())
+	if got := backends.Current().BaseURL(); got != primary.URL || len(switches) != 0 {
+		t.Fatalf("failed over to an unhealthy standby")
+	}
+	standbyUp.Store(true)
+	f.Check(context.Background())
+	if got := backends.Current().BaseURL(); got != standby.URL {
+		t.Fatalf("current = %s once the standby recovered, want the standby", got)
+	}
+}
+
+func TestFailoverLeavesOperatorSwitchAlone(t *testing.T) {
+	var primaryUp, otherUp atomic.Bool
+	otherUp.Store(true)
+	primary, standby, green := healthServer(t, &primaryUp), healthServer(t, &otherUp), healthServer(t, &otherUp)
+
+	backends := NewBackendSwitch(NewFileServiceClient(primary.URL))
+	f := NewFailover(backends, primary.URL, standby.URL, 1, 1)
+	if err := backends.SwitchTo(green.URL); err != nil {
+		t.Fatal(err)
+	}
+	f.Check(context.Background())
+	if got := backends.Current().BaseURL(); got != green.URL {
+		t.Fatalf("current = %s, want the backend an operator switched to", got)
+	}
+}
@@ -2,27 +2,53 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"vibe-drop/internal/telemetry"
 )
 
 type FileServiceClient struct {
 	baseURL    string
 	httpClient *http.Client
+	inFlight   atomic.Int64 // requests whose response body is still open
+
+	// streamTransport carries Stream's requests, which always go over HTTP
+	streamTransport http.RoundTripper
 }
 
+// NewFileServiceClient creates a client for the file service at baseURL. After UseGRPC, the
+// operations its gRPC API defines are sent there instead.
 func NewFileServiceClient(baseURL string) *FileServiceClient {
+	httpTransport := telemetry.Transport(http.DefaultTransport)
+	transport := httpTransport
+	if grpcPort > 0 {
+		if grpcTransport, err := newGRPCTransport(baseURL, grpcPort, transport); err != nil {
+			log.Printf("Warning: Proxying to %s over HTTP only: %v", baseURL, err)
+		} else {
+			transport = grpcTransport
+		}
+	}
+
 	return &FileServiceClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
+		streamTransport: httpTransport,
 	}
 }
 
-func (f *FileServiceClient) ProxyRequest(method, path string, body []byte, headers map[string]string) (*http.Response, error) {
+// ProxyRequest sends a request to the file service. ctx carries the caller's trace, which
+// the request continues.
+func (f *FileServiceClient) ProxyRequest(ctx context.Context, method, path string, body []byte, headers map[string]string) (*http.Response, error) {
 	url := f.baseURL + path
 	
 	var bodyReader io.Reader
@@ -30,7 +56,7 @@ func (f *FileServiceClient) ProxyRequest(method, path string, body []byte, heade
 		bodyReader = bytes.NewReader(body)
 	}
 	
-	req, err := http.NewRequest(method, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -45,14 +71,49 @@ func (f *FileServiceClient) ProxyRequest(method, path string, body []byte, heade
 		req.Header.Set("Content-Type", "application/json")
 	}
 	
+	f.inFlight.Add(1)
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
+		f.inFlight.Add(-1)
 		return nil, fmt.Errorf("failed to make request to file service: %w", err)
 	}
 	
+	// The request stays in flight until the caller has finished reading the response
+	resp.Body = &trackedBody{ReadCloser: resp.Body, client: f}
 	return resp, nil
 }
 
-func (f *FileServiceClient) Health() (*http.Response, error) {
-	return f.ProxyRequest("GET", "/health", nil, nil)
+// BaseURL returns the file service URL requests are sent to
+func (f *FileServiceClient) BaseURL() string {
+	return f.baseURL
+}
+
+// InFlight returns how many requests are still being served
+func (f *FileServiceClient) InFlight() int64 {
+	return f.inFlight.Load()
+}
+
+// trackedBody marks its request finished when the response body is closed
+type trackedBody struct {
+	io.ReadCloser
+	client *FileServiceClient
+	once   sync.Once
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(func() { b.client.inFlight.Add(-1) })
+	return b.ReadCloser.Close()
+}
+
+// Ping checks the file service answers its health check with 200
+func (f *FileServiceClient) Ping(ctx context.Context) error {
+	resp, err := f.ProxyRequest(ctx, "GET", "/health", nil, nil)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"vibe-drop/internal/filepb"
+	"vibe-drop/internal/registry"
+)
+
+// maxResponseSize is the largest reply accepted from the file service over gRPC. HTTP sets
+// no limit, so this is well above what a long file listing needs.
+const maxResponseSize = 64 << 20
+
+// grpcPort is the port every file service serves gRPC on; 0 sends all requests over HTTP
+var grpcPort int
+
+// UseGRPC makes file service clients created from now on send the operations
+// filepb.FileService defines to gRPC on port of each file service's host, instead of
+// proxying them over HTTP. Other operations, such as admin ones, and health checks stay on
+// HTTP.
+func UseGRPC(port int) {
+	grpcPort = port
+}
+
+// rpcMethods maps the operations filepb.FileService defines, by route name, to their RPCs'
+// full method names. Each RPC is named after its route, e.g. CreateUploadURL for
+// createUploadURL.
+var rpcMethods = func() map[string]string {
+	methods := make(map[string]string)
+	for _, method := range filepb.FileService_ServiceDesc.Methods {
+		name := strings.ToLower(method.MethodName[:1]) + method.MethodName[1:]
+		methods[name] = "/" + filepb.FileService_ServiceDesc.ServiceName + "/" + method.MethodName
+	}
+	return methods
+}()
+
+// grpcTransport makes a file service request as a call of its operation's RPC when there
+// is one, and over HTTP otherwise. FileServiceClient uses it in place of its HTTP
+// transport, so routing, draining and in-flight counts work the same on both protocols.
+type grpcTransport struct {
+	conn *grpc.ClientConn
+	http http.RoundTripper
+}
+
+// newGRPCTransport connects to gRPC on port of baseURL's host, with TLS if baseURL is
+// https. The connection is made on first use.
+func newGRPCTransport(baseURL string, port int, fallback http.RoundTripper) (*grpcTransport, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file service URL: %w", err)
+	}
+	creds := insecure.NewCredentials()
+	if u.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(net.JoinHostPort(u.Hostname(), strconv.Itoa(port)),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxResponseSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	return &grpcTransport{conn: conn, http: fallback}, nil
+}
+
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route, vars, ok := registry.MatchService(req.Method, req.URL.Path)
+	method := rpcMethods[route.Name]
+	if !ok || method == "" {
+		return t.http.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var resp filepb.Response
+	call := &filepb.Request{PathParams: vars, Query: req.URL.RawQuery, Body: body}
+	if err := t.conn.Invoke(requestMetadata(req), method, call, &resp); err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	for _, h := range resp.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.Status, http.StatusText(int(resp.Status))),
+		StatusCode:    int(resp.Status),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
+
+// requestMetadata returns req's context carrying its headers as gRPC metadata. Headers
+// that only describe the HTTP connection or body are left out, as are values gRPC can't
+// carry (it allows printable ASCII only).
+func requestMetadata(req *http.Request) context.Context {
+	md := metadata.MD{}
+	for key, values := range req.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Connection", "Content-Length", "Content-Type", "Host", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade":
+			continue
+		}
+		for _, value := range values {
+			if printableASCII(value) {
+				md.Append(key, value)
+			}
+		}
+	}
+	return metadata.NewOutgoingContext(req.Context(), md)
+}
+
+func printableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// CloseIdleConnections closes the gRPC connection along with the HTTP transport's idle
+// ones. http.Client calls it when a replaced backend has drained.
+func (t *grpcTransport) CloseIdleConnections() {
+	t.conn.Close()
+	if closer, ok := t.http.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
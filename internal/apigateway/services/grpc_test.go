@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"vibe-drop/internal/fileservice/grpcserver"
+)
+
+func TestGRPCTransport(t *testing.T) {
+	// A file service router with one operation the gRPC API defines and one it doesn't
+	router := mux.NewRouter()
+	router.HandleFunc("/files/{fileId}/chunks/{chunkNumber}/complete", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, "%s %s %s %s %s %s", r.Method, mux.Vars(r)["fileId"], mux.Vars(r)["chunkNumber"],
+			r.URL.RawQuery, r.Header.Get("Authorization"), body)
+	}).Methods("POST")
+	router.HandleFunc("/admin/metrics", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "metrics")
+	}).Methods("GET")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpcserver.New(router)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	var overHTTP []string
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		overHTTP = append(overHTTP, r.URL.Path)
+		router.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+
+	UseGRPC(listener.Addr().(*net.TCPAddr).Port)
+	defer UseGRPC(0)
+	client := NewFileServiceClient(httpServer.URL)
+
+	resp, err := client.ProxyRequest(context.Background(), "POST", "/files/file-1/chunks/3/complete?verify=true",
+		[]byte(`{"etag":"abc"}`), map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("status %d, Retry-After %q, want the REST response's 409 and header", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if want := `POST file-1 3 verify=true Bearer token {"etag":"abc"}`; string(body) != want {
+		t.Errorf("handler saw %q, want %q", body, want)
+	}
+
+	resp, err = client.ProxyRequest(context.Background(), "GET", "/admin/metrics", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "metrics" {
+		t.Errorf("admin body = %q, want metrics", body)
+	}
+
+	if len(overHTTP) != 1 || overHTTP[0] != "/admin/metrics" {
+		t.Errorf("requests over HTTP = %v, want only the admin one", overHTTP)
+	}
+	if n := client.InFlight(); n != 0 {
+		t.Errorf("%d requests still in flight", n)
+	}
+}
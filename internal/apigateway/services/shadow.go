@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+)
+
+// maxInFlightShadows caps concurrent mirrored requests so a slow shadow backend
+// can't pile up goroutines; requests beyond the cap are simply not mirrored
+const maxInFlightShadows = 64
+
+// ShadowClient mirrors a sample of read requests to a secondary file service and
+// discards its responses, for trying a new release against production traffic
+type ShadowClient struct {
+	client   *FileServiceClient
+	percent  int
+	inFlight chan struct{}
+}
+
+// NewShadowClient mirrors percent (0-100) of read requests to baseURL
+func NewShadowClient(baseURL string, percent int) *ShadowClient {
+	client := NewFileServiceClient(baseURL)
+	client.httpClient.Timeout = 10 * time.Second
+	return &ShadowClient{
+		client:   client,
+		percent:  percent,
+		inFlight: make(chan struct{}, maxInFlightShadows),
+	}
+}
+
+// Ping checks the shadow backend answers its health check
+func (s *ShadowClient) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx)
+}
+
+// Mirror sends a copy of the request to the shadow backend in the background when it
+// is a read and falls in the sample. It never blocks and never affects the caller; the
+// copy joins ctx's trace but isn't cancelled with it.
+func (s *ShadowClient) Mirror(ctx context.Context, method, path string, body []byte, headers map[string]string) {
+	if method != http.MethodGet && method != http.MethodHead {
+		return // writes would duplicate side effects such as uploads and deletes
+	}
+	if rand.Intn(100) >= s.percent {
+		return
+	}
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-s.inFlight }()
+		resp, err := s.client.ProxyRequest(ctx, method, path, body, headers)
+		if err != nil {
+			common.Logger(ctx).Warn("Shadow request failed", "method", method, "path", path, "error", err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShadowClientMirrorsReadsOnly(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("Authorization"))
+		mu.Unlock()
+	}))
+	defer shadow.Close()
+
+	s := NewShadowClient(shadow.URL, 100)
+	s.Mirror(context.Background(), http.MethodPost, "/files/upload-url", []byte(`{}`), nil)
+	s.Mirror(context.Background(), http.MethodDelete, "/files/f1", nil, nil)
+	s.Mirror(context.Background(), http.MethodGet, "/files?limit=5", nil, map[string]string{"Authorization": "Bearer t"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(seen)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // let any unexpected write mirrors arrive
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 1 || seen[0] != "GET /files?limit=5 Bearer t" {
+		t.Errorf("shadow saw %v, want only the GET with its headers", seen)
+	}
+}
+
+func TestShadowClientSkipsWhenDisabled(t *testing.T) {
+	called := make(chan struct{}, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer shadow.Close()
+
+	s := NewShadowClient(shadow.URL, 0)
+	for i := 0; i < 50; i++ {
+		s.Mirror(context.Background(), http.MethodGet, "/files", nil, nil)
+	}
+	select {
+	case <-called:
+		t.Error("request mirrored at 0 percent")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// IsStreaming reports whether r asks for a long-lived response: a protocol upgrade such
+// as WebSocket, or a server-sent event stream. These can't be buffered like other
+// responses, so they go through Stream.
+func IsStreaming(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" && headerHasToken(r.Header, "Connection", "upgrade") {
+		return true
+	}
+	return headerHasToken(r.Header, "Accept", "text/event-stream")
+}
+
+// headerHasToken reports whether any of the comma-separated values of header key is token,
+// ignoring case and parameters such as ";q=0.9"
+func headerHasToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			part, _, _ = strings.Cut(part, ";")
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Stream forwards r to the file service at path and passes the response through as it
+// arrives. An upgraded connection is tunnelled both ways until either side closes it, and
+// an event stream is flushed after every write. Neither is bound by the client timeout,
+// only by r's context, and both always go over HTTP. onError writes the response when the
+// file service can't be reached.
+func (f *FileServiceClient) Stream(w http.ResponseWriter, r *http.Request, path string, onError func(http.ResponseWriter, *http.Request, error)) {
+	target, err := url.Parse(f.baseURL + path)
+	if err != nil {
+		onError(w, r, err)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = target
+			pr.Out.Host = ""
+			pr.SetXForwarded()
+		},
+		Transport: f.streamTransport,
+		ModifyResponse: func(resp *http.Response) error {
+			// The file service echoes the gateway's own request ID
+			resp.Header.Del("X-Request-ID")
+			return nil
+		},
+		ErrorHandler: onError,
+	}
+
+	// A stream counts as in flight for as long as it's open, so a drain waits on it
+	f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamFlushesEventStream(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" || r.URL.RawQuery != "since=1" {
+			t.Errorf("backend got %s, want /events?since=1", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Request-ID", "backend-id")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	client := NewFileServiceClient(backend.URL)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.Stream(w, r, "/events?since=1", func(w http.ResponseWriter, r *http.Request, err error) {
+			t.Errorf("stream failed: %v", err)
+		})
+	}))
+	defer gateway.Close()
+
+	req, _ := http.NewRequest("GET", gateway.URL+"/stream", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	if !IsStreaming(req) {
+		t.Fatal("event stream request not recognized as streaming")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("X-Request-ID"); got != "" {
+		t.Errorf("X-Request-ID = %q, want the backend's removed", got)
+	}
+
+	// The first event arrives while the backend is still holding the stream open
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Fatalf("first line = %q, %v; want the first event", line, err)
+	}
+	if n := client.InFlight(); n != 1 {
+		t.Errorf("in flight = %d while streaming, want 1", n)
+	}
+}
+
+func TestStreamTunnelsUpgrade(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Upgrade", "echo")
+		w.WriteHeader(http.StatusSwitchingProtocols)
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString(strings.ToUpper(line))
+		rw.Flush()
+	}))
+	defer backend.Close()
+
+	client := NewFileServiceClient(backend.URL)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.Stream(w, r, "/ws", func(w http.ResponseWriter, r *http.Request, err error) {
+			t.Errorf("stream failed: %v", err)
+		})
+	}))
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d, want 101", resp.StatusCode)
+	}
+
+	fmt.Fprint(conn, "hello\n")
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if line != "HELLO\n" {
+		t.Errorf("echo = %q, want HELLO", line)
+	}
+}
+
+func TestStreamReportsUnreachableBackend(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	client := NewFileServiceClient(backend.URL)
+	backend.Close()
+
+	var failed error
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	client.Stream(rec, req, "/events", func(w http.ResponseWriter, r *http.Request, err error) {
+		failed = err
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if failed == nil || rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, error %v; want onError to answer 503", rec.Code, failed)
+	}
+	if n := client.InFlight(); n != 0 {
+		t.Errorf("in flight = %d after a failed stream, want 0", n)
+	}
+}
+
+func TestIsStreaming(t *testing.T) {
+	tests := []struct {
+		headers map[string]string
+		want    bool
+	}{
+		{map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket"}, true},
+		{map[string]string{"Upgrade": "websocket"}, false},
+		{map[string]string{"Accept": "application/json, text/event-stream;q=0.9"}, true},
+		{map[string]string{"Accept": "application/json"}, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for key, value := range tt.headers {
+			req.Header.Set(key, value)
+		}
+		if got := IsStreaming(req); got != tt.want {
+			t.Errorf("IsStreaming(%v) = %v, want %v", tt.headers, got, tt.want)
+		}
+	}
+}
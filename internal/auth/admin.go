@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"vibe-drop/internal/common"
+)
+
+// AdminKeyHeader carries the operator API key for admin endpoints
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminKeyMiddleware restricts routes to operators presenting the configured admin API key.
+// If no key is configured, admin routes are disabled entirely.
+func AdminKeyMiddleware(adminKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminKey == "" {
+				common.WriteForbiddenError(w, "Admin API disabled", "ADMIN_API_KEY is not configured")
+				return
+			}
+
+			provided := r.Header.Get(AdminKeyHeader)
+			if provided == "" {
+				common.WriteUnauthorizedError(w, "Admin authentication required", "Missing "+AdminKeyHeader+" header")
+				return
+			}
+
+			// Constant-time comparison so the key can't be guessed byte by byte
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+				common.WriteForbiddenError(w, "Invalid admin key", "The provided admin key is not valid")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdminMiddleware restricts routes to operators presenting adminKey or to users with the
+// admin role. A request with X-Admin-Key is checked as AdminKeyMiddleware checks it; one
+// with a bearer token instead must carry RoleAdmin. Without an admin key configured only
+// admins' tokens are accepted.
+func AdminMiddleware(adminKey string, jwtService *JWTService) func(http.Handler) http.Handler {
+	byKey := AdminKeyMiddleware(adminKey)
+	byRole := func(next http.Handler) http.Handler {
+		return AuthMiddleware(jwtService)(RequireRole(RoleAdmin)(next))
+	}
+	return func(next http.Handler) http.Handler {
+		keyed, tokened := byKey(next), byRole(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(AdminKeyHeader) == "" && r.Header.Get("Authorization") != "" {
+				tokened.ServeHTTP(w, r)
+				return
+			}
+			keyed.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	j := NewJWTService("secret", time.Hour)
+	token := func(role string) string {
+		signed, err := j.GenerateToken("user-1", "alice", role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + signed
+	}
+	scoped, err := j.GenerateScopedToken("user-1", "alice", []string{ScopeFilesRead}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	tests := []struct {
+		name     string
+		adminKey string
+		headers  map[string]string
+		want     int
+	}{
+		{"admin key", "op-key", map[string]string{AdminKeyHeader: "op-key"}, http.StatusNoContent},
+		{"wrong admin key", "op-key", map[string]string{AdminKeyHeader: "guess"}, http.StatusForbidden},
+		{"admin token", "op-key", map[string]string{"Authorization": token(RoleAdmin)}, http.StatusNoContent},
+		{"admin token without a key configured", "", map[string]string{"Authorization": token(RoleAdmin)}, http.StatusNoContent},
+		{"user token", "op-key", map[string]string{"Authorization": token(RoleUser)}, http.StatusForbidden},
+		{"scoped token", "op-key", map[string]string{"Authorization": "Bearer " + scoped}, http.StatusForbidden},
+		{"admin key checked before a token", "op-key", map[string]string{AdminKeyHeader: "guess", "Authorization": token(RoleAdmin)}, http.StatusForbidden},
+		{"nothing", "op-key", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			AdminMiddleware(tt.adminKey, j)(ok).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body: %s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
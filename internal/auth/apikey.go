@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"vibe-drop/internal/common"
+)
+
+// apiKeyUsernamePrefix marks the tokens the gateway mints for API keys: their username is
+// the prefix followed by the key's ID. Usernames can't contain a colon, so no user can
+// claim one.
+const apiKeyUsernamePrefix = "api-key:"
+
+// APIKeyUsername is the username of tokens minted for the API key keyID
+func APIKeyUsername(keyID string) string {
+	return apiKeyUsernamePrefix + keyID
+}
+
+// GetAPIKeyIDFromContext returns the ID of the API key the request's token was minted for,
+// if it was
+func GetAPIKeyIDFromContext(ctx context.Context) (string, bool) {
+	username, err := GetUsernameFromContext(ctx)
+	if err != nil || !strings.HasPrefix(username, apiKeyUsernamePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(username, apiKeyUsernamePrefix), true
+}
+
+// RequireAPIKey rejects requests whose token wasn't minted for an API key.
+// It must run after AuthMiddleware.
+func RequireAPIKey() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := GetAPIKeyIDFromContext(r.Context()); !ok {
+				common.WriteUnauthorizedError(w, "API key required", "Send the key in the X-API-Key header")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrivateKey is an RSA or P-256 ECDSA key tokens can be signed with (RS256 or ES256),
+// named by the key ID in their header. Services without it check those tokens with its
+// public half, published as a JWKS.
+type PrivateKey struct {
+	ID  string
+	Key crypto.Signer
+}
+
+// minRSABits is the smallest RSA key accepted for signing
+const minRSABits = 2048
+
+// ParsePrivateKeys reads a list of private keys written as comma-separated "id:path"
+// pairs, each path a PEM file, the key to sign with first
+func ParsePrivateKeys(value string) ([]PrivateKey, error) {
+	var keys []PrivateKey
+	seen := make(map[string]bool)
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, path, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("key %d must be written as id:path", i+1)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("key ID %q is listed twice", id)
+		}
+		seen[id] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		key, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys = append(keys, PrivateKey{ID: id, Key: key})
+	}
+	return keys, nil
+}
+
+// ParsePrivateKeyPEM reads an RSA key of at least 2048 bits or a P-256 ECDSA key, in
+// PKCS #8, PKCS #1 or SEC 1 form
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key has %d bits, need at least %d", key.N.BitLen(), minRSABits)
+		}
+		return key, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ECDSA key must be on P-256 for ES256")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T: must be RSA or ECDSA", key)
+}
+
+// keyAlgorithm is the JWT algorithm tokens checked with key must use: an HMAC secret is
+// HS256, an RSA key RS256 and a P-256 key ES256
+func keyAlgorithm(key interface{}) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return "RS256"
+	case *ecdsa.PublicKey:
+		return "ES256"
+	}
+	return "HS256"
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // EC curve
+	X         string `json:"x,omitempty"`   // EC point
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// newJWK describes the public half of a signing key
+func newJWK(id string, key crypto.PublicKey) JWK {
+	jwk := JWK{KeyID: id, Use: "sig", Algorithm: keyAlgorithm(key)}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))
+	}
+	return jwk
+}
+
+// PublicKey is the key jwk describes
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := func(field, value string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("key %q has an invalid %s", jwk.KeyID, field)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch {
+	case jwk.KeyType == "RSA" && jwk.Algorithm == "RS256":
+		n, err := decode("n", jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e", jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < minRSABits || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %q is not a usable RSA key", jwk.KeyID)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case jwk.KeyType == "EC" && jwk.Algorithm == "ES256" && jwk.Curve == "P-256":
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %q is not a point on P-256", jwk.KeyID)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("key %q is %s/%s, want RSA/RS256 or EC/ES256 on P-256", jwk.KeyID, jwk.KeyType, jwk.Algorithm)
+}
+
+// How long a RemoteKeySet trusts what it fetched, and how often at most it fetches again
+// for a key ID it doesn't know
+const (
+	jwksMaxAge     = 5 * time.Minute
+	jwksMinRefetch = 10 * time.Second
+	jwksTimeout    = 5 * time.Second
+)
+
+// RemoteKeySet is the public keys another service publishes as a JWKS, fetched when
+// first needed and again every few minutes, or sooner when a token names a key it
+// hasn't seen, so keys rotated in on the signing service are picked up. If a fetch
+// fails the keys from the last one are kept.
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetched     time.Time // When keys were last fetched successfully
+	lastAttempt time.Time
+}
+
+// NewRemoteKeySet reads keys from the JWKS at url
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{url: url, client: &http.Client{Timeout: jwksTimeout}}
+}
+
+// Key returns the public key with ID kid
+func (s *RemoteKeySet) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[kid]
+	stale := time.Since(s.fetched) > jwksMaxAge
+	if (stale || !ok) && time.Since(s.lastAttempt) > jwksMinRefetch {
+		if err := s.refresh(); err != nil && len(s.keys) == 0 {
+			return nil, err
+		}
+		key, ok = s.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// Refresh fetches the keys now, e.g. at startup to find a misconfigured URL early
+func (s *RemoteKeySet) Refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refresh()
+}
+
+func (s *RemoteKeySet) refresh() error {
+	s.lastAttempt = time.Now()
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: %s returned status %d", s.url, resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return fmt.Errorf("invalid JWKS: %w", err)
+		}
+		keys[jwk.KeyID] = key
+	}
+	s.keys = keys
+	s.fetched = time.Now()
+	return nil
+}
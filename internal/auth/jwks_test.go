@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signing service publishes both keys and signs with the first
+	signer := NewJWTServiceFromConfig(JWTConfig{
+		PrivateKeys: []PrivateKey{{ID: "ec-2", Key: ecKey}, {ID: "rsa-1", Key: rsaKey}},
+		Expiry:      time.Hour,
+	})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(signer.JWKS())
+	}))
+	defer jwks.Close()
+	checker := NewJWTServiceFromConfig(JWTConfig{JWKSURL: jwks.URL})
+
+	token, err := signer.GenerateToken("user-1", "alice", RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if parsed.Method.Alg() != "ES256" || parsed.Header["kid"] != "ec-2" {
+		t.Errorf("token signed with %v under key %v, want ES256 under ec-2", parsed.Method.Alg(), parsed.Header["kid"])
+	}
+	for name, j := range map[string]*JWTService{"signer": signer, "JWKS": checker} {
+		if claims, err := j.ValidateToken(token); err != nil || claims.UserID != "user-1" {
+			t.Errorf("ES256 token checked by %s: %+v, %v", name, claims, err)
+		}
+	}
+
+	// Tokens from the older RSA key are still accepted
+	older := NewJWTServiceFromConfig(JWTConfig{PrivateKeys: []PrivateKey{{ID: "rsa-1", Key: rsaKey}}, Expiry: time.Hour})
+	rsaToken, _ := older.GenerateToken("user-1", "alice", RoleUser)
+	if _, err := checker.ValidateToken(rsaToken); err != nil {
+		t.Errorf("RS256 token from a published key refused: %v", err)
+	}
+
+	// An HMAC token keyed with the public key's bytes isn't taken for an RS256 one
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "user-1"})
+	forged.Header["kid"] = "rsa-1"
+	forgedToken, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if _, err := checker.ValidateToken(forgedToken); err == nil {
+		t.Error("HS256 token naming an RSA key accepted")
+	}
+
+	// A service holding only public keys can't sign
+	if _, err := checker.GenerateToken("user-1", "alice", RoleUser); err == nil {
+		t.Error("service without a signing key signed a token")
+	}
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	encode := func(key interface{}) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	if _, err := ParsePrivateKeyPEM(encode(p256)); err != nil {
+		t.Errorf("P-256 key refused: %v", err)
+	}
+	sec1, _ := x509.MarshalECPrivateKey(p256)
+	if _, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})); err != nil {
+		t.Errorf("SEC 1 key refused: %v", err)
+	}
+	for name, data := range map[string][]byte{
+		"P-384 key":    encode(p384),
+		"1024-bit RSA": encode(small),
+		"not PEM":      []byte("secret"),
+	} {
+		if _, err := ParsePrivateKeyPEM(data); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
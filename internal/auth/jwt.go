@@ -2,51 +2,187 @@ package auth
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// DevelopmentSecret is the signing secret used when none is configured (never use in production!)
+const DevelopmentSecret = "your-jwt-secret-key-change-in-production"
+
 // JWTService handles JWT token creation and validation
 type JWTService struct {
-	secretKey []byte        // Secret key for signing tokens (keep this safe!)
+	secretKey []byte        // Secret key for tokens without a key ID; nil to refuse them (keep this safe!)
 	expiry    time.Duration // How long tokens are valid
+
+	keys       map[string][]byte // Secrets by key ID (the "kid" header)
+	signingKID string            // Key new tokens are signed with; "" signs with secretKey
+	issuer     string            // Set as "iss" on new tokens and required on validation, if not ""
+
+	// Asymmetric keys: private ones this service signs with, in the order configured, and
+	// the public keys of another service that signs
+	privateKeys []PrivateKey
+	remoteKeys  *RemoteKeySet
+}
+
+// SigningKey is a secret tokens can be signed with, named by the key ID in their header
+type SigningKey struct {
+	ID     string
+	Secret string
+}
+
+// JWTConfig is how a JWTService signs and checks tokens. Listing several keys lets the
+// secret be rotated: tokens signed with an older key are accepted until they expire, so
+// nobody is signed out.
+type JWTConfig struct {
+	Secret string        // Checks tokens without a key ID, and signs new ones if Keys is empty; "" refuses them
+	Keys   []SigningKey  // The first signs new tokens; all are accepted
+	Issuer string        // Optional
+	Expiry time.Duration // How long full-access tokens are valid
+
+	// RS256 and ES256 keys. With PrivateKeys the first signs new tokens instead of Keys,
+	// and all are accepted and published by JWKS. JWKSURL is another service's JWKS, whose
+	// keys are accepted, so tokens can be checked without holding any secret.
+	PrivateKeys []PrivateKey
+	JWKSURL     string
 }
 
 // Claims represents the data we store inside JWT tokens
 type Claims struct {
-	UserID   string `json:"user_id"`   // Which user this token belongs to
-	Username string `json:"username"`  // Username for convenience
-	jwt.RegisteredClaims                // Standard JWT fields (expiry, issued at, etc.)
+	UserID               string           `json:"user_id"`             // Which user this token belongs to
+	Username             string           `json:"username"`            // Username for convenience
+	Scopes               []string         `json:"scopes,omitempty"`    // Capabilities granted; empty means full access
+	Role                 string           `json:"role,omitempty"`      // The user's role when the token was issued; only full-access tokens carry one
+	AuthTime             *jwt.NumericDate `json:"auth_time,omitempty"` // When the user last signed in with a password; kept across refreshes
+	jwt.RegisteredClaims                  // Standard JWT fields (expiry, issued at, etc.)
 }
 
 // NewJWTService creates a new JWT service with the given secret and expiry
 func NewJWTService(secretKey string, expiry time.Duration) *JWTService {
-	return &JWTService{
-		secretKey: []byte(secretKey), // Convert string to bytes
-		expiry:    expiry,
+	return NewJWTServiceFromConfig(JWTConfig{Secret: secretKey, Expiry: expiry})
+}
+
+// NewJWTServiceFromConfig creates a JWT service that signs with cfg's first private key,
+// or else its first key, or its secret if it has no keys
+func NewJWTServiceFromConfig(cfg JWTConfig) *JWTService {
+	j := &JWTService{
+		expiry:      cfg.Expiry,
+		keys:        make(map[string][]byte, len(cfg.Keys)),
+		issuer:      cfg.Issuer,
+		privateKeys: cfg.PrivateKeys,
+	}
+	if cfg.JWKSURL != "" {
+		j.remoteKeys = NewRemoteKeySet(cfg.JWKSURL)
+	}
+	if cfg.Secret != "" {
+		j.secretKey = []byte(cfg.Secret) // Convert string to bytes
+	}
+	for i, key := range cfg.Keys {
+		if i == 0 {
+			j.signingKID = key.ID
+		}
+		j.keys[key.ID] = []byte(key.Secret)
+	}
+	if len(cfg.PrivateKeys) > 0 {
+		j.signingKID = cfg.PrivateKeys[0].ID
+	}
+	return j
+}
+
+// ParseSigningKeys reads a list of signing keys written as comma-separated "id:secret"
+// pairs, the key to sign with first. Secrets may contain colons but not commas.
+func ParseSigningKeys(value string) ([]SigningKey, error) {
+	var keys []SigningKey
+	seen := make(map[string]bool)
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("key %d must be written as id:secret", i+1)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("key ID %q is listed twice", id)
+		}
+		seen[id] = true
+		keys = append(keys, SigningKey{ID: id, Secret: secret})
+	}
+	return keys, nil
+}
+
+// JWKS is the public half of each private key, for services that check this one's tokens
+func (j *JWTService) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range j.privateKeys {
+		set.Keys = append(set.Keys, newJWK(key.ID, key.Key.Public()))
+	}
+	return set
+}
+
+// RemoteKeys is the key set fetched from JWKSURL, or nil if none was configured
+func (j *JWTService) RemoteKeys() *RemoteKeySet {
+	return j.remoteKeys
+}
+
+// Expiry returns how long full-access tokens are valid
+func (j *JWTService) Expiry() time.Duration {
+	return j.expiry
+}
+
+// GenerateToken creates a new JWT token for a user with role who has just signed in
+func (j *JWTService) GenerateToken(userID, username, role string) (string, error) {
+	return j.generateToken(userID, username, role, nil, time.Now(), j.expiry)
+}
+
+// GenerateRefreshedToken creates a full-access token in exchange for a refresh token,
+// keeping the time of the sign-in that started the session. role is the user's current
+// one, so a change of role takes effect at the next refresh.
+func (j *JWTService) GenerateRefreshedToken(userID, username, role string, authTime time.Time) (string, error) {
+	return j.generateToken(userID, username, role, nil, authTime, j.expiry)
+}
+
+// GenerateScopedToken creates a token limited to the given scopes, e.g. for integrations
+// that should only be able to upload or only read
+func (j *JWTService) GenerateScopedToken(userID, username string, scopes []string, expiry time.Duration) (string, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", err
 	}
+	return j.generateToken(userID, username, "", scopes, time.Time{}, expiry)
 }
 
-// GenerateToken creates a new JWT token for the given user
-func (j *JWTService) GenerateToken(userID, username string) (string, error) {
+func (j *JWTService) generateToken(userID, username, role string, scopes []string, authTime time.Time, expiry time.Duration) (string, error) {
 	// Create the claims (the data we want to store in the token)
 	now := time.Now()
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
+		Scopes:   scopes,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),           // When token was created
-			ExpiresAt: jwt.NewNumericDate(now.Add(j.expiry)), // When token expires
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)), // When token expires
 			Subject:   userID,                            // Who the token is for
+			Issuer:    j.issuer,
 		},
 	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
 
-	// Create the token with our claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	
-	// Sign the token with our secret key (this creates the signature)
-	tokenString, err := token.SignedString(j.secretKey)
+	// Sign the token with our signing key (this creates the signature), naming the key if
+	// there are several
+	method, key := j.signingKey()
+	if key == nil {
+		return "", fmt.Errorf("failed to sign token: no signing key configured")
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if j.signingKID != "" {
+		token.Header["kid"] = j.signingKID
+	}
+	tokenString, err := token.SignedString(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -58,12 +194,16 @@ func (j *JWTService) GenerateToken(userID, username string) (string, error) {
 func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	// Parse the token and verify the signature
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Make sure the token was signed with the method we expect
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		key, err := j.verificationKey(token)
+		if err != nil {
+			return nil, err
+		}
+		// Make sure the token was signed with the method its key is for
+		if token.Method.Alg() != keyAlgorithm(key) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return j.secretKey, nil // Return our secret key for validation
-	})
+		return key, nil
+	}, j.parserOptions()...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -83,14 +223,53 @@ func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-// RefreshToken creates a new token with extended expiry (optional feature)
-func (j *JWTService) RefreshToken(oldTokenString string) (string, error) {
-	// First validate the old token
-	claims, err := j.ValidateToken(oldTokenString)
-	if err != nil {
-		return "", fmt.Errorf("cannot refresh invalid token: %w", err)
+// signingKey is how new tokens are signed: the first private key, or else the HMAC
+// secret for signingKID. The key is nil if there's nothing to sign with.
+func (j *JWTService) signingKey() (jwt.SigningMethod, interface{}) {
+	for _, key := range j.privateKeys {
+		if key.ID == j.signingKID {
+			if keyAlgorithm(key.Key.Public()) == "ES256" {
+				return jwt.SigningMethodES256, key.Key
+			}
+			return jwt.SigningMethodRS256, key.Key
+		}
 	}
+	if j.signingKID != "" {
+		return jwt.SigningMethodHS256, j.keys[j.signingKID]
+	}
+	if j.secretKey == nil {
+		return jwt.SigningMethodHS256, nil
+	}
+	return jwt.SigningMethodHS256, j.secretKey
+}
 
-	// Create a new token with the same user info but new expiry
-	return j.GenerateToken(claims.UserID, claims.Username)
-}
\ No newline at end of file
+// verificationKey is the secret or public key a token says it was signed with
+func (j *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if j.secretKey == nil {
+			return nil, fmt.Errorf("token has no key ID")
+		}
+		return j.secretKey, nil
+	}
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	for _, key := range j.privateKeys {
+		if key.ID == kid {
+			return key.Key.Public(), nil
+		}
+	}
+	if j.remoteKeys != nil {
+		return j.remoteKeys.Key(kid)
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+func (j *JWTService) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"})}
+	if j.issuer != "" {
+		options = append(options, jwt.WithIssuer(j.issuer))
+	}
+	return options
+}
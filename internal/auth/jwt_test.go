@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	legacy := NewJWTService("old-secret", time.Hour)
+	before := NewJWTServiceFromConfig(JWTConfig{
+		Secret: "old-secret",
+		Keys:   []SigningKey{{ID: "k1", Secret: "first-key"}},
+		Expiry: time.Hour,
+	})
+	after := NewJWTServiceFromConfig(JWTConfig{
+		Keys:   []SigningKey{{ID: "k2", Secret: "second-key"}, {ID: "k1", Secret: "first-key"}},
+		Expiry: time.Hour,
+	})
+
+	sign := func(j *JWTService) string {
+		token, err := j.GenerateToken("user-1", "alice", RoleUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	unkeyed, k1, k2 := sign(legacy), sign(before), sign(after)
+
+	// A token signed before keys were introduced is accepted while the secret is kept
+	if _, err := before.ValidateToken(unkeyed); err != nil {
+		t.Errorf("token without a key ID refused alongside its secret: %v", err)
+	}
+	if _, err := after.ValidateToken(unkeyed); err == nil {
+		t.Error("token without a key ID accepted once the secret was dropped")
+	}
+
+	// Rotating to k2 keeps k1's tokens valid, and new tokens are signed with k2
+	if claims, err := after.ValidateToken(k1); err != nil || claims.UserID != "user-1" {
+		t.Errorf("k1 token after rotation: %+v, %v", claims, err)
+	}
+	if _, err := before.ValidateToken(k2); err == nil {
+		t.Error("k2 token accepted by a service without k2")
+	}
+
+	// A token naming a known key but signed with another secret is refused
+	forged := NewJWTServiceFromConfig(JWTConfig{Keys: []SigningKey{{ID: "k2", Secret: "guess"}}, Expiry: time.Hour})
+	if _, err := after.ValidateToken(sign(forged)); err == nil {
+		t.Error("token signed with the wrong secret for its key ID accepted")
+	}
+}
+
+func TestJWTIssuer(t *testing.T) {
+	issuing := NewJWTServiceFromConfig(JWTConfig{Secret: "secret", Issuer: "https://vibedrop.example", Expiry: time.Hour})
+	token, err := issuing.GenerateToken("user-1", "alice", RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuing.ValidateToken(token); err != nil {
+		t.Errorf("token from the configured issuer refused: %v", err)
+	}
+	untagged, _ := NewJWTService("secret", time.Hour).GenerateToken("user-1", "alice", RoleUser)
+	if _, err := issuing.ValidateToken(untagged); err == nil {
+		t.Error("token without the issuer accepted")
+	}
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	keys, err := ParseSigningKeys(" k2:new:with:colons , k1:old,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != (SigningKey{ID: "k2", Secret: "new:with:colons"}) || keys[1].ID != "k1" {
+		t.Errorf("keys = %+v", keys)
+	}
+	for _, value := range []string{"no-separator", ":secret", "k1:", "k1:a,k1:b"} {
+		if _, err := ParseSigningKeys(value); err == nil {
+			t.Errorf("ParseSigningKeys(%q) accepted", value)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 	"vibe-drop/internal/common"
 )
 
@@ -15,6 +16,8 @@ type UserContextKey string
 const (
 	UserIDKey   UserContextKey = "user_id"
 	UsernameKey UserContextKey = "username"
+	IssuedAtKey UserContextKey = "issued_at"
+	AuthTimeKey UserContextKey = "auth_time"
 )
 
 // AuthMiddleware creates middleware that validates JWT tokens
@@ -52,6 +55,34 @@ func AuthMiddleware(jwtService *JWTService) func(http.Handler) http.Handler {
 	}
 }
 
+// BasicTokenMiddleware authenticates clients that can only send a username and password,
+// such as WebDAV drives, by taking the password as the token; the username is ignored. A
+// Bearer token works too. Failures are challenged for Basic credentials in realm, so the
+// client prompts for them.
+func BasicTokenMiddleware(jwtService *JWTService, realm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := extractTokenFromHeader(r)
+			if _, password, ok := r.BasicAuth(); ok {
+				token, err = password, nil
+			}
+			if err == nil && token == "" {
+				err = fmt.Errorf("empty token")
+			}
+			var claims *Claims
+			if err == nil {
+				claims, err = jwtService.ValidateToken(token)
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+				common.WriteUnauthorizedError(w, "Authentication required", err.Error())
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(addUserToContext(r.Context(), claims)))
+		})
+	}
+}
+
 // extractTokenFromHeader gets the JWT token from the Authorization header
 func extractTokenFromHeader(r *http.Request) (string, error) {
 	// Look for: Authorization: Bearer <token>
@@ -85,6 +116,20 @@ func addUserToContext(ctx context.Context, claims *Claims) context.Context {
 	ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
 	// Add username to context  
 	ctx = context.WithValue(ctx, UsernameKey, claims.Username)
+	// Add scopes to context (nil for full-access tokens)
+	ctx = context.WithValue(ctx, ScopesKey, claims.Scopes)
+	// Add the role the user had when the token was issued
+	ctx = context.WithValue(ctx, RoleKey, claims.Role)
+	// Add when the token was issued, so handlers can ask for a recent sign-in
+	if claims.IssuedAt != nil {
+		ctx = context.WithValue(ctx, IssuedAtKey, claims.IssuedAt.Time)
+	}
+	// Add when the user signed in; refreshed tokens keep the original sign-in time
+	if claims.AuthTime != nil {
+		ctx = context.WithValue(ctx, AuthTimeKey, claims.AuthTime.Time)
+	}
+	// Tag the request's log lines with the user from here on
+	ctx = common.WithLogger(ctx, common.Logger(ctx).With("user_id", claims.UserID))
 	return ctx
 }
 
@@ -109,6 +154,21 @@ func GetUsernameFromContext(ctx context.Context) (string, error) {
 	return username, nil
 }
 
+// GetTokenIssuedAtFromContext extracts when the request's token was issued
+func GetTokenIssuedAtFromContext(ctx context.Context) (time.Time, bool) {
+	issuedAt, ok := ctx.Value(IssuedAtKey).(time.Time)
+	return issuedAt, ok
+}
+
+// GetAuthTimeFromContext extracts when the user last signed in with a password. Tokens
+// without an auth_time claim were issued at sign-in, so their issue time is used.
+func GetAuthTimeFromContext(ctx context.Context) (time.Time, bool) {
+	if authTime, ok := ctx.Value(AuthTimeKey).(time.Time); ok {
+		return authTime, true
+	}
+	return GetTokenIssuedAtFromContext(ctx)
+}
+
 // GetUserFromContext extracts both user ID and username from context
 func GetUserFromContext(ctx context.Context) (userID, username string, err error) {
 	userID, err = GetUserIDFromContext(ctx)
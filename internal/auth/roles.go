@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"vibe-drop/internal/common"
+)
+
+// Roles say what a user may do beyond their own files. Full-access tokens carry the user's
+// role from when they were issued; scoped tokens and API keys never carry one.
+const (
+	RoleUser  = "user"  // Their own files only
+	RoleAdmin = "admin" // The admin API too, as an X-Admin-Key would allow
+)
+
+// KnownRoles lists every role a user can be given
+var KnownRoles = []string{RoleUser, RoleAdmin}
+
+// RoleKey stores the token's role in request context
+const RoleKey UserContextKey = "role"
+
+// IsKnownRole reports whether role is one of KnownRoles
+func IsKnownRole(role string) bool {
+	for _, known := range KnownRoles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRoleFromContext extracts the token's role from request context (empty means RoleUser)
+func GetRoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(RoleKey).(string)
+	return role
+}
+
+// RequireRole rejects requests whose token wasn't issued to a user with role.
+// It must run after AuthMiddleware, which puts the token's role in context.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := GetUserIDFromContext(r.Context()); err != nil {
+				common.WriteUnauthorizedError(w, "Authentication required", err.Error())
+				return
+			}
+			if GetRoleFromContext(r.Context()) != role {
+				common.WriteForbiddenError(w, "Insufficient role", "This operation requires the '"+role+"' role")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
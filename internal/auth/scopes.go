@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"vibe-drop/internal/common"
+)
+
+// Scopes limit what a token may be used for. Tokens issued at login carry no
+// scopes and have full access; scoped tokens can only do what they list.
+const (
+	ScopeFilesRead  = "files:read"  // List files, read metadata, issue download URLs
+	ScopeFilesWrite = "files:write" // Upload, complete and delete files
+	ScopeFilesShare = "files:share" // Share files with others
+)
+
+// KnownScopes lists every scope that can be granted to a token
+var KnownScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeFilesShare}
+
+// ScopesKey stores the token's scopes in request context
+const ScopesKey UserContextKey = "scopes"
+
+// ValidateScopes checks that every requested scope is known and at least one is given
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+
+	return nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the claims grant the scope (unscoped tokens grant everything)
+func (c *Claims) HasScope(scope string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects requests whose token doesn't grant the given scope.
+// It must run after AuthMiddleware, which puts the token's scopes in context.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := GetUserIDFromContext(r.Context()); err != nil {
+				common.WriteUnauthorizedError(w, "Authentication required", err.Error())
+				return
+			}
+
+			claims := &Claims{Scopes: GetScopesFromContext(r.Context())}
+			if !claims.HasScope(scope) {
+				common.WriteForbiddenError(w, "Insufficient scope", "This token does not grant the '"+scope+"' scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireFullAccess rejects scoped tokens, for operations like minting new tokens
+func RequireFullAccess() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(GetScopesFromContext(r.Context())) > 0 {
+				common.WriteForbiddenError(w, "Insufficient scope", "Scoped tokens cannot perform this operation")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetScopesFromContext extracts the token's scopes from request context (nil means unrestricted)
+func GetScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(ScopesKey).([]string)
+	return scopes
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTOTP(t *testing.T) {
+	// RFC 6238 test vectors for the SHA1 secret "12345678901234567890", last six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924"} {
+		step, ok := VerifyTOTP(secret, code, time.Unix(unix, 0), 0)
+		if !ok || step != unix/30 {
+			t.Errorf("VerifyTOTP(%s at %d) = %d, %v", code, unix, step, ok)
+		}
+	}
+
+	at := time.Unix(1111111109, 0)
+	// One period of drift either way is allowed, but no more
+	if _, ok := VerifyTOTP(secret, "081804", at.Add(30*time.Second), 0); !ok {
+		t.Error("code from the previous period rejected")
+	}
+	if _, ok := VerifyTOTP(secret, "081804", at.Add(90*time.Second), 0); ok {
+		t.Error("code from three periods ago accepted")
+	}
+	// A code can't be used twice
+	step, _ := VerifyTOTP(secret, "081804", at, 0)
+	if _, ok := VerifyTOTP(secret, "081804", at, step); ok {
+		t.Error("code accepted again")
+	}
+	for _, bad := range []string{"", "08180", "0818045", "000000"} {
+		if _, ok := VerifyTOTP(secret, bad, at, 0); ok {
+			t.Errorf("VerifyTOTP(%q) accepted", bad)
+		}
+	}
+
+	generated, err := GenerateTOTPSecret()
+	if err != nil || len(generated) != 32 {
+		t.Fatalf("GenerateTOTPSecret = %q, %v", generated, err)
+	}
+	uri := TOTPProvisioningURI("Vibe Drop", "alice@example.com", generated)
+	if !strings.HasPrefix(uri, "otpauth://totp/Vibe%20Drop:alice@example.com?") || !strings.Contains(uri, "secret="+generated) {
+		t.Errorf("TOTPProvisioningURI = %q", uri)
+	}
+}
+
+func TestSecretBox(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	box, err := NewSecretBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal("GEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "GEZDGNBVGY3TQOJQ") {
+		t.Fatal("sealed secret contains the plaintext")
+	}
+	if opened, err := box.Open(sealed); err != nil || opened != "GEZDGNBVGY3TQOJQ" {
+		t.Errorf("Open = %q, %v", opened, err)
+	}
+
+	other, _ := NewSecretBox(base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")))
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("opened with another key")
+	}
+	if _, err := NewSecretBox("c2hvcnQ="); err == nil {
+		t.Error("accepted a short key")
+	}
+}
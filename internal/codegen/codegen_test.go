@@ -0,0 +1,63 @@
+package codegen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vibe-drop/internal/apigateway/openapi"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestGeneratedClients compares generated clients against testdata/*.golden.
+// After an intentional change run: go test ./internal/codegen -update
+func TestGeneratedClients(t *testing.T) {
+	doc, err := Parse(openapi.Spec())
+	if err != nil {
+		t.Fatalf("parsing gateway spec: %v", err)
+	}
+
+	tests := []struct {
+		golden string
+		got    string
+	}{
+		{golden: "vibedrop.ts.golden", got: TypeScript(doc)},
+		{golden: "vibedrop_client.py.golden", got: Python(doc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, []byte(tt.got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading golden file: %v (run with -update to create it)", err)
+			}
+			if string(want) != tt.got {
+				t.Errorf("generated client differs from %s; run go test ./internal/codegen -update and review the diff", path)
+			}
+		})
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := map[string]string{
+		"getDownloadURL":       "get_download_url",
+		"getDownloadURLLegacy": "get_download_url_legacy",
+		"chunkNumber":          "chunk_number",
+		"file_id":              "file_id",
+		"getAPISpec":           "get_api_spec",
+	}
+	for in, want := range tests {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Python generates a standard-library-only Python client (urllib + TypedDict)
+func Python(doc *Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Code generated by vibedrop-gen from %s %s. DO NOT EDIT.\n", doc.Info.Title, doc.Info.Version)
+	b.WriteString(pyPrelude)
+
+	for _, name := range doc.SchemaNames() {
+		schema := doc.Components.Schemas[name]
+		if len(schema.Properties) == 0 {
+			fmt.Fprintf(&b, "\n%s = %s\n", name, pyType(schema))
+			continue
+		}
+
+		// Required keys live on the class, optional keys on a total=False base
+		var required, optional []string
+		for _, prop := range schema.SortedProperties() {
+			if schema.IsRequired(prop) {
+				required = append(required, prop)
+			} else {
+				optional = append(optional, prop)
+			}
+		}
+
+		base := "TypedDict"
+		if len(optional) > 0 {
+			base = "_" + name + "Optional"
+			fmt.Fprintf(&b, "\n\nclass %s(TypedDict, total=False):\n", base)
+			for _, prop := range optional {
+				fmt.Fprintf(&b, "    %s: %s\n", prop, pyType(schema.Properties[prop]))
+			}
+		}
+
+		fmt.Fprintf(&b, "\n\nclass %s(%s):\n", name, base)
+		if schema.Description != "" {
+			fmt.Fprintf(&b, "    %q\n", schema.Description)
+		}
+		if len(required) == 0 && schema.Description == "" {
+			b.WriteString("    pass\n")
+		}
+		for _, prop := range required {
+			fmt.Fprintf(&b, "    %s: %s\n", prop, pyType(schema.Properties[prop]))
+		}
+	}
+
+	b.WriteString(pyRuntime)
+
+	for _, ep := range doc.Endpoints() {
+		writePyMethod(&b, ep)
+	}
+	return b.String()
+}
+
+func pyType(s *Schema) string {
+	if s == nil {
+		return "None"
+	}
+	if s.Ref != "" {
+		return "\"" + RefName(s.Ref) + "\""
+	}
+	if len(s.Enum) > 0 {
+		values := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			values[i] = fmt.Sprintf("%q", v)
+		}
+		return "Literal[" + strings.Join(values, ", ") + "]"
+	}
+	if len(s.OneOf) > 0 {
+		variants := make([]string, len(s.OneOf))
+		for i, v := range s.OneOf {
+			variants[i] = pyType(v)
+		}
+		return "Union[" + strings.Join(variants, ", ") + "]"
+	}
+	switch s.Type {
+	case "string":
+		return "str"
+	case "integer":
+		return "int"
+	case "number":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "List[" + pyType(s.Items) + "]"
+	case "object":
+		if values, ok := s.MapValues(); ok && values != nil {
+			return "Dict[str, " + pyType(values) + "]"
+		}
+		return "Dict[str, Any]"
+	}
+	return "Any"
+}
+
+func writePyMethod(b *strings.Builder, ep Endpoint) {
+	args := []string{"self"}
+	pathParams := ep.ParamsIn("path")
+	for _, p := range pathParams {
+		args = append(args, snakeCase(p.Name)+": "+pyType(p.Schema))
+	}
+	body := ep.RequestSchema()
+	if body != nil {
+		args = append(args, "body: "+pyType(body))
+	}
+	query := ep.ParamsIn("query")
+	for _, p := range query {
+		if p.Required {
+			args = append(args, snakeCase(p.Name)+": "+pyType(p.Schema))
+		} else {
+			args = append(args, snakeCase(p.Name)+": Optional["+pyType(p.Schema)+"] = None")
+		}
+	}
+
+	path := ep.Path
+	for _, p := range pathParams {
+		path = strings.ReplaceAll(path, "{"+p.Name+"}", "{"+snakeCase(p.Name)+"}")
+	}
+	pathExpr := fmt.Sprintf("%q", path)
+	if len(pathParams) > 0 {
+		var fmtArgs []string
+		for _, p := range pathParams {
+			name := snakeCase(p.Name)
+			fmtArgs = append(fmtArgs, name+"=_quote(str("+name+"))")
+		}
+		pathExpr += ".format(" + strings.Join(fmtArgs, ", ") + ")"
+	}
+
+	returnType := pyType(ep.ResponseSchema())
+	fmt.Fprintf(b, "\n    def %s(%s) -> %s:\n", snakeCase(ep.OperationID), strings.Join(args, ", "), returnType)
+	doc := ep.Summary + "\n\n        ``" + ep.Method + " " + ep.Path + "``"
+	if ep.Deprecated {
+		doc += "\n\n        .. deprecated::"
+	}
+	fmt.Fprintf(b, "        \"\"\"%s\n        \"\"\"\n", doc)
+
+	call := fmt.Sprintf("self._request(%q, %s", ep.Method, pathExpr)
+	if body != nil {
+		call += ", body=body"
+	}
+	if len(query) > 0 {
+		var fields []string
+		for _, p := range query {
+			fields = append(fields, fmt.Sprintf("%q: %s", p.Name, snakeCase(p.Name)))
+		}
+		call += ", query={" + strings.Join(fields, ", ") + "}"
+	}
+	call += ")"
+
+	if returnType == "None" {
+		fmt.Fprintf(b, "        %s\n", call)
+	} else {
+		fmt.Fprintf(b, "        return %s  # type: ignore[no-any-return]\n", call)
+	}
+}
+
+const pyPrelude = `
+from __future__ import annotations
+
+import json
+import urllib.error
+import urllib.parse
+import urllib.request
+from typing import Any, Dict, List, Literal, Optional, TypedDict, Union
+
+
+def _quote(value: str) -> str:
+    return urllib.parse.quote(value, safe="")
+`
+
+const pyRuntime = `
+
+
+class VibeDropError(Exception):
+    """Raised for any non-2xx response; fields mirror the API's error envelope."""
+
+    def __init__(
+        self,
+        status: int,
+        code: str,
+        message: str,
+        details: Optional[str] = None,
+        errors: Optional[List[Dict[str, str]]] = None,
+    ) -> None:
+        super().__init__(message)
+        self.status = status
+        self.code = code
+        self.message = message
+        self.details = details
+        # Every field that failed validation, when the request was rejected as invalid
+        self.errors = errors or []
+
+
+class VibeDropClient:
+    def __init__(
+        self,
+        base_url: str,
+        token: Optional[str] = None,
+        api_key: Optional[str] = None,
+        timeout: float = 30.0,
+    ) -> None:
+        self.base_url = base_url.rstrip("/")
+        self.token = token
+        self.api_key = api_key
+        self.timeout = timeout
+
+    def _request(
+        self,
+        method: str,
+        path: str,
+        body: Any = None,
+        query: Optional[Dict[str, Any]] = None,
+    ) -> Any:
+        url = self.base_url + path
+        params = {k: v for k, v in (query or {}).items() if v is not None}
+        if params:
+            url += "?" + urllib.parse.urlencode(params)
+
+        headers = {"Accept": "application/json"}
+        if self.token:
+            headers["Authorization"] = "Bearer " + self.token
+        if self.api_key:
+            headers["X-API-Key"] = self.api_key
+        data = None
+        if body is not None:
+            headers["Content-Type"] = "application/json"
+            data = json.dumps(body).encode()
+
+        request = urllib.request.Request(url, data=data, headers=headers, method=method)
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout) as response:
+                raw = response.read()
+                status = response.status
+        except urllib.error.HTTPError as err:
+            raw = err.read()
+            status = err.code
+
+        payload = json.loads(raw) if raw else {}
+        if status >= 300:
+            error = payload.get("error", {}) if isinstance(payload, dict) else {}
+            raise VibeDropError(
+                status,
+                error.get("code", ""),
+                error.get("message", "request failed"),
+                error.get("details"),
+                error.get("errors"),
+            )
+        if isinstance(payload, dict) and "success" in payload and "data" in payload:
+            return payload["data"]
+        return payload
+`
@@ -0,0 +1,262 @@
+// Package codegen generates API clients from the gateway's OpenAPI document.
+// It understands the subset of OpenAPI 3 the spec uses: JSON bodies, path and
+// query parameters, component schemas, oneOf unions and the standard response envelope.
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Document is the part of an OpenAPI 3 document the generators need
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Deprecated  bool                  `json:"deprecated"`
+	Security    []map[string][]string `json:"security"` // nil when the document's default applies
+	Parameters  []Parameter           `json:"parameters"`
+	RequestBody *RequestBody          `json:"requestBody"`
+	Responses   map[string]*Response  `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON schema; AdditionalProperties may be a bool or a schema
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Enum                 []string           `json:"enum"`
+	Items                *Schema            `json:"items"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AllOf                []*Schema          `json:"allOf"`
+	OneOf                []*Schema          `json:"oneOf"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+}
+
+// Endpoint is an operation flattened with its method and path
+type Endpoint struct {
+	Method string
+	Path   string
+	*Operation
+}
+
+// Parse decodes an OpenAPI document and checks every operation can be generated
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+
+	seen := make(map[string]string)
+	for _, ep := range doc.Endpoints() {
+		if ep.OperationID == "" {
+			return nil, fmt.Errorf("%s %s has no operationId", ep.Method, ep.Path)
+		}
+		if prev, ok := seen[ep.OperationID]; ok {
+			return nil, fmt.Errorf("operationId %q used by both %s and %s %s", ep.OperationID, prev, ep.Method, ep.Path)
+		}
+		seen[ep.OperationID] = ep.Method + " " + ep.Path
+	}
+	return &doc, nil
+}
+
+// Endpoints returns every operation sorted by path then method, so output is stable
+func (d *Document) Endpoints() []Endpoint {
+	var endpoints []Endpoint
+	for path, item := range d.Paths {
+		for method, op := range item {
+			endpoints = append(endpoints, Endpoint{Method: strings.ToUpper(method), Path: path, Operation: op})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+// SchemaNames returns component schema names in sorted order
+func (d *Document) SchemaNames() []string {
+	names := make([]string, 0, len(d.Components.Schemas))
+	for name := range d.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RequestSchema returns the JSON request body schema, or nil if the operation takes no body
+func (e Endpoint) RequestSchema() *Schema {
+	if e.RequestBody == nil {
+		return nil
+	}
+	return e.RequestBody.Content["application/json"].Schema
+}
+
+// ResponseSchema returns the schema of the envelope's data for the first 2xx response,
+// or nil when the response has no body
+func (e Endpoint) ResponseSchema() *Schema {
+	codes := make([]string, 0, len(e.Responses))
+	for code := range e.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	if len(codes) == 0 {
+		return nil
+	}
+
+	schema := e.Responses[codes[0]].Content["application/json"].Schema
+	if schema == nil {
+		return nil
+	}
+	// Enveloped responses are allOf [Envelope, {properties: {data: ...}}]
+	for _, part := range schema.AllOf {
+		if data, ok := part.Properties["data"]; ok {
+			return data
+		}
+	}
+	return schema
+}
+
+// IsEnveloped reports whether the response is wrapped in the standard envelope
+func (e Endpoint) IsEnveloped() bool {
+	for code, resp := range e.Responses {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		if schema := resp.Content["application/json"].Schema; schema != nil && len(schema.AllOf) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParamsIn returns the operation's parameters of the given location ("path" or "query")
+func (e Endpoint) ParamsIn(in string) []Parameter {
+	var params []Parameter
+	for _, p := range e.Parameters {
+		if p.In == in {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// RefName returns the component name a $ref points to
+func RefName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// MapValues returns the schema of additionalProperties values, or nil if it is untyped
+func (s *Schema) MapValues() (*Schema, bool) {
+	if len(s.AdditionalProperties) == 0 {
+		return nil, false
+	}
+	var value Schema
+	if err := json.Unmarshal(s.AdditionalProperties, &value); err != nil {
+		return nil, true // additionalProperties: true
+	}
+	return &value, true
+}
+
+// IsRequired reports whether the named property is required
+func (s *Schema) IsRequired(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SortedProperties returns property names in sorted order
+func (s *Schema) SortedProperties() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitWords breaks identifiers like "chunkNumber", "getDownloadURL" or "file_id" into lowercase words
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+	isUpper := func(r rune) bool { return r >= 'A' && r <= 'Z' }
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == '.' {
+			if len(current) > 0 {
+				words = append(words, string(current))
+				current = nil
+			}
+			continue
+		}
+		if isUpper(r) && len(current) > 0 {
+			prevLower := !isUpper(runes[i-1])
+			acronymEnd := i+1 < len(runes) && !isUpper(runes[i+1]) && runes[i+1] != '_'
+			if prevLower || acronymEnd {
+				words = append(words, string(current))
+				current = nil
+			}
+		}
+		if isUpper(r) {
+			r += 'a' - 'A'
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return words
+}
+
+func snakeCase(s string) string {
+	return strings.Join(splitWords(s), "_")
+}
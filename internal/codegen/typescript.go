@@ -0,0 +1,221 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeScript generates a dependency-free TypeScript client using the Fetch API
+func TypeScript(doc *Document) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by vibedrop-gen from %s %s. DO NOT EDIT.\n\n", doc.Info.Title, doc.Info.Version)
+
+	for _, name := range doc.SchemaNames() {
+		schema := doc.Components.Schemas[name]
+		if schema.Description != "" {
+			fmt.Fprintf(&b, "/** %s */\n", schema.Description)
+		}
+		if len(schema.Properties) == 0 {
+			fmt.Fprintf(&b, "export type %s = %s;\n\n", name, tsType(schema))
+			continue
+		}
+		fmt.Fprintf(&b, "export interface %s {\n", name)
+		writeTSProperties(&b, schema, "  ")
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString(tsRuntime)
+
+	for _, ep := range doc.Endpoints() {
+		writeTSMethod(&b, ep)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func writeTSProperties(b *strings.Builder, schema *Schema, indent string) {
+	for _, prop := range schema.SortedProperties() {
+		optional := "?"
+		if schema.IsRequired(prop) {
+			optional = ""
+		}
+		fmt.Fprintf(b, "%s%s%s: %s;\n", indent, prop, optional, tsType(schema.Properties[prop]))
+	}
+}
+
+func tsType(s *Schema) string {
+	if s == nil {
+		return "void"
+	}
+	if s.Ref != "" {
+		return RefName(s.Ref)
+	}
+	if len(s.Enum) > 0 {
+		values := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			values[i] = fmt.Sprintf("%q", v)
+		}
+		return strings.Join(values, " | ")
+	}
+	if len(s.OneOf) > 0 {
+		variants := make([]string, len(s.OneOf))
+		for i, v := range s.OneOf {
+			variants[i] = tsType(v)
+		}
+		return strings.Join(variants, " | ")
+	}
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		return "Array<" + tsType(s.Items) + ">"
+	case "object":
+		if values, ok := s.MapValues(); ok {
+			if values == nil {
+				return "Record<string, unknown>"
+			}
+			return "Record<string, " + tsType(values) + ">"
+		}
+		if len(s.Properties) > 0 {
+			var inner strings.Builder
+			inner.WriteString("{ ")
+			for _, prop := range s.SortedProperties() {
+				optional := "?"
+				if s.IsRequired(prop) {
+					optional = ""
+				}
+				fmt.Fprintf(&inner, "%s%s: %s; ", prop, optional, tsType(s.Properties[prop]))
+			}
+			inner.WriteString("}")
+			return inner.String()
+		}
+		return "Record<string, unknown>"
+	}
+	return "unknown"
+}
+
+func writeTSMethod(b *strings.Builder, ep Endpoint) {
+	var args []string
+	for _, p := range ep.ParamsIn("path") {
+		args = append(args, p.Name+": "+tsType(p.Schema))
+	}
+	body := ep.RequestSchema()
+	if body != nil {
+		args = append(args, "body: "+tsType(body))
+	}
+	query := ep.ParamsIn("query")
+	if len(query) > 0 {
+		var fields []string
+		for _, p := range query {
+			optional := "?"
+			if p.Required {
+				optional = ""
+			}
+			fields = append(fields, p.Name+optional+": "+tsType(p.Schema))
+		}
+		args = append(args, "query: { "+strings.Join(fields, "; ")+" } = {}")
+	}
+
+	path := "`" + ep.Path + "`"
+	for _, p := range ep.ParamsIn("path") {
+		path = strings.ReplaceAll(path, "{"+p.Name+"}", "${encodeURIComponent(String("+p.Name+"))}")
+	}
+
+	b.WriteString("\n  /**\n")
+	fmt.Fprintf(b, "   * %s\n", ep.Summary)
+	fmt.Fprintf(b, "   *\n   * `%s %s`\n", ep.Method, ep.Path)
+	if ep.Deprecated {
+		b.WriteString("   * @deprecated\n")
+	}
+	b.WriteString("   */\n")
+
+	returnType := tsType(ep.ResponseSchema())
+	fmt.Fprintf(b, "  %s(%s): Promise<%s> {\n", ep.OperationID, strings.Join(args, ", "), returnType)
+
+	var opts []string
+	if body != nil {
+		opts = append(opts, "body")
+	}
+	if len(query) > 0 {
+		opts = append(opts, "query")
+	}
+	options := "{}"
+	if len(opts) > 0 {
+		options = "{ " + strings.Join(opts, ", ") + " }"
+	}
+	fmt.Fprintf(b, "    return this.request<%s>(%q, %s, %s);\n", returnType, ep.Method, path, options)
+	b.WriteString("  }\n")
+}
+
+const tsRuntime = `/** Raised for any non-2xx response; fields mirror the API's error envelope */
+export class VibeDropError extends Error {
+  constructor(
+    public readonly status: number,
+    public readonly code: string,
+    message: string,
+    public readonly details?: string,
+    /** Every field that failed validation, when the request was rejected as invalid */
+    public readonly errors: Array<{ field: string; code: string; message: string }> = [],
+  ) {
+    super(message);
+    this.name = "VibeDropError";
+  }
+}
+
+export interface ClientOptions {
+  /** Bearer token sent in the Authorization header */
+  token?: string;
+  /** API key sent in the X-API-Key header, for server-to-server integrations */
+  apiKey?: string;
+  /** Custom fetch implementation (defaults to the global fetch) */
+  fetch?: typeof fetch;
+}
+
+interface RequestOptions {
+  body?: unknown;
+  query?: Record<string, string | number | boolean | undefined>;
+}
+
+export class VibeDropClient {
+  private readonly baseUrl: string;
+  private readonly fetchImpl: typeof fetch;
+  token?: string;
+  apiKey?: string;
+
+  constructor(baseUrl: string, options: ClientOptions = {}) {
+    this.baseUrl = baseUrl.replace(/\/+$/, "");
+    this.token = options.token;
+    this.apiKey = options.apiKey;
+    this.fetchImpl = options.fetch ?? fetch;
+  }
+
+  private async request<T>(method: string, path: string, options: RequestOptions): Promise<T> {
+    const url = new URL(this.baseUrl + path);
+    for (const [key, value] of Object.entries(options.query ?? {})) {
+      if (value !== undefined) url.searchParams.set(key, String(value));
+    }
+
+    const headers: Record<string, string> = { Accept: "application/json" };
+    if (this.token) headers["Authorization"] = "Bearer " + this.token;
+    if (this.apiKey) headers["X-API-Key"] = this.apiKey;
+    if (options.body !== undefined) headers["Content-Type"] = "application/json";
+
+    const response = await this.fetchImpl(url.toString(), {
+      method,
+      headers,
+      body: options.body === undefined ? undefined : JSON.stringify(options.body),
+    });
+
+    if (response.status === 204) return undefined as T;
+    const payload = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      const error = payload.error ?? {};
+      throw new VibeDropError(response.status, error.code ?? "", error.message ?? response.statusText, error.details, error.errors ?? []);
+    }
+    return (payload.success !== undefined && "data" in payload ? payload.data : payload) as T;
+  }
+`
@@ -0,0 +1,109 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ClientInfoHeader identifies the client making a request, e.g.
+// "app=vibedrop-cli; version=1.4.2; platform=linux/amd64"
+const ClientInfoHeader = "X-Client-Info"
+
+// ClientInfoKey holds the request's parsed *ClientInfo in its context
+const ClientInfoKey ContextKey = "client_info"
+
+// maxClientInfoValue bounds each field so the header can't bloat stored records
+const maxClientInfoValue = 64
+
+// ClientInfo is the app, version and platform a client declared in X-Client-Info
+type ClientInfo struct {
+	App      string `json:"app" dynamodbav:"app"`
+	Version  string `json:"version" dynamodbav:"version"`
+	Platform string `json:"platform,omitempty" dynamodbav:"platform,omitempty"`
+}
+
+// String formats the client as "app/version (platform)"
+func (c ClientInfo) String() string {
+	if c.Platform == "" {
+		return c.App + "/" + c.Version
+	}
+	return fmt.Sprintf("%s/%s (%s)", c.App, c.Version, c.Platform)
+}
+
+// ParseClientInfo parses an X-Client-Info value: semicolon-separated key=value pairs, of
+// which app and version are required and platform is optional. Unknown keys are ignored so
+// clients can send more than the server records.
+func ParseClientInfo(header string) (*ClientInfo, error) {
+	var info ClientInfo
+	for _, pair := range strings.Split(header, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if err := validateClientInfoValue(key, value); err != nil {
+			return nil, err
+		}
+		switch key {
+		case "app":
+			info.App = value
+		case "version":
+			info.Version = value
+		case "platform":
+			info.Platform = value
+		}
+	}
+	if info.App == "" || info.Version == "" {
+		return nil, fmt.Errorf("app and version are required")
+	}
+	return &info, nil
+}
+
+// validateClientInfoValue allows letters, digits and . _ + - / : up to maxClientInfoValue
+func validateClientInfoValue(key, value string) error {
+	if value == "" || len(value) > maxClientInfoValue {
+		return fmt.Errorf("%s must be 1 to %d characters", key, maxClientInfoValue)
+	}
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._+-/:", r):
+		default:
+			return fmt.Errorf("%s contains %q", key, r)
+		}
+	}
+	return nil
+}
+
+// ClientInfoMiddleware parses X-Client-Info into the request context. Requests without the
+// header pass through; a malformed header is rejected so bad values never reach stored
+// records.
+func ClientInfoMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get(ClientInfoHeader)
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			info, err := ParseClientInfo(header)
+			if err != nil {
+				WriteValidationError(w, "Invalid "+ClientInfoHeader+" header", err.Error())
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientInfoKey, info)))
+		})
+	}
+}
+
+// ClientInfoFromContext returns the client the request declared, or nil
+func ClientInfoFromContext(ctx context.Context) *ClientInfo {
+	info, _ := ctx.Value(ClientInfoKey).(*ClientInfo)
+	return info
+}
@@ -0,0 +1,34 @@
+package common
+
+import "testing"
+
+func TestParseClientInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    ClientInfo
+		wantErr bool
+	}{
+		{"all fields", "app=vibedrop-cli; version=1.4.2; platform=linux/amd64", ClientInfo{"vibedrop-cli", "1.4.2", "linux/amd64"}, false},
+		{"platform optional", "app=web;version=2", ClientInfo{"web", "2", ""}, false},
+		{"keys case insensitive, unknown ignored", "App=ios; Version=3.0.1; build=77", ClientInfo{"ios", "3.0.1", ""}, false},
+		{"missing version", "app=web", ClientInfo{}, true},
+		{"not a pair", "vibedrop-cli/1.4.2", ClientInfo{}, true},
+		{"invalid character", "app=web app; version=1", ClientInfo{}, true},
+		{"empty value", "app=; version=1", ClientInfo{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClientInfo(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseClientInfo(%q) = %+v, want an error", tt.header, got)
+				}
+				return
+			}
+			if err != nil || *got != tt.want {
+				t.Errorf("ParseClientInfo(%q) = %+v, %v; want %+v", tt.header, got, err, tt.want)
+			}
+		})
+	}
+}
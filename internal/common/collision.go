@@ -0,0 +1,17 @@
+package common
+
+// Strategies for an upload whose filename matches one of the user's existing files
+const (
+	CollisionReject  = "reject"  // Refuse the upload with 409
+	CollisionRename  = "rename"  // Store it as "report (2).pdf"
+	CollisionVersion = "version" // Keep the name and record it as the file's next version
+)
+
+// ValidCollisionStrategy reports whether strategy names a collision strategy
+func ValidCollisionStrategy(strategy string) bool {
+	switch strategy {
+	case CollisionReject, CollisionRename, CollisionVersion:
+		return true
+	}
+	return false
+}
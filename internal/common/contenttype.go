@@ -0,0 +1,132 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Content type policy modes
+const (
+	PolicyModeAllowlist = "allowlist" // Only types with a rule are accepted
+	PolicyModeDenylist  = "denylist"  // Every type is accepted unless a rule blocks it
+)
+
+// DefaultContentType is recorded for uploads whose type can't be worked out
+const DefaultContentType = "application/octet-stream"
+
+// ContentTypeRule is a policy's treatment of one MIME type, or of a whole family with a
+// wildcard such as "video/*". An exact type takes precedence over its family's wildcard.
+type ContentTypeRule struct {
+	Type    string `json:"type"`
+	Blocked bool   `json:"blocked,omitempty"`
+	MaxSize int64  `json:"max_size,omitempty"` // Bytes; 0 leaves the global MaxFileSize limit
+}
+
+// ContentTypePolicy decides which file types a deployment accepts and how large each may be
+type ContentTypePolicy struct {
+	Mode  string            `json:"mode"`
+	Rules []ContentTypeRule `json:"rules,omitempty"`
+}
+
+// DefaultContentTypePolicy accepts every type up to MaxFileSize
+func DefaultContentTypePolicy() ContentTypePolicy {
+	return ContentTypePolicy{Mode: PolicyModeDenylist}
+}
+
+// ParseContentTypePolicy decodes a JSON policy and checks it is well formed
+func ParseContentTypePolicy(data []byte) (ContentTypePolicy, error) {
+	var policy ContentTypePolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return ContentTypePolicy{}, fmt.Errorf("invalid content type policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return ContentTypePolicy{}, err
+	}
+	return policy, nil
+}
+
+// Validate reports the first problem with the policy's mode or rules
+func (p ContentTypePolicy) Validate() error {
+	if p.Mode != PolicyModeAllowlist && p.Mode != PolicyModeDenylist {
+		return fmt.Errorf("mode must be %q or %q", PolicyModeAllowlist, PolicyModeDenylist)
+	}
+
+	seen := make(map[string]bool, len(p.Rules))
+	for _, rule := range p.Rules {
+		major, minor, ok := strings.Cut(rule.Type, "/")
+		if !ok || major == "" || minor == "" || major == "*" || strings.Contains(minor, "/") || rule.Type != strings.ToLower(rule.Type) {
+			return fmt.Errorf("rule type %q must be a lowercase MIME type such as video/mp4 or video/*", rule.Type)
+		}
+		if seen[rule.Type] {
+			return fmt.Errorf("type %q has more than one rule", rule.Type)
+		}
+		seen[rule.Type] = true
+
+		if rule.MaxSize < 0 || rule.MaxSize > MaxFileSize {
+			return fmt.Errorf("max_size for %q must be between 0 and %d bytes", rule.Type, int64(MaxFileSize))
+		}
+		if rule.Blocked && rule.MaxSize > 0 {
+			return fmt.Errorf("type %q is blocked, so it can't have a max_size", rule.Type)
+		}
+	}
+	return nil
+}
+
+// rule returns the rule governing mimeType: its exact rule, else its family's wildcard
+func (p ContentTypePolicy) rule(mimeType string) *ContentTypeRule {
+	family, _, _ := strings.Cut(mimeType, "/")
+	var wildcard *ContentTypeRule
+	for i := range p.Rules {
+		switch p.Rules[i].Type {
+		case mimeType:
+			return &p.Rules[i]
+		case family + "/*":
+			wildcard = &p.Rules[i]
+		}
+	}
+	return wildcard
+}
+
+// Check validates an upload of size bytes with the given type against the policy
+func (p ContentTypePolicy) Check(mimeType string, size int64) []ValidationError {
+	rule := p.rule(mimeType)
+	allowed := rule != nil && !rule.Blocked
+	if rule == nil {
+		allowed = p.Mode == PolicyModeDenylist
+	}
+	if !allowed {
+		return []ValidationError{{
+			Field:   "content_type",
+			Code:    ErrorCodeInvalidFileType,
+			Message: fmt.Sprintf("File type '%s' is not allowed", mimeType),
+		}}
+	}
+
+	if rule != nil && rule.MaxSize > 0 && size > rule.MaxSize {
+		return []ValidationError{{
+			Field:   "size",
+			Code:    ErrorCodeFileTooLarge,
+			Message: fmt.Sprintf("Files of type '%s' cannot exceed %d bytes (%.1f GB)", mimeType, rule.MaxSize, float64(rule.MaxSize)/(1024*1024*1024)),
+		}}
+	}
+	return nil
+}
+
+// DetectContentType returns the media type of an upload: the one the client declared, or
+// else the one its extension maps to. Parameters such as charset are dropped.
+func DetectContentType(filename, declared string) string {
+	if declared == "" {
+		declared = mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	}
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return DefaultContentType
+	}
+	return mediaType
+}
@@ -0,0 +1,64 @@
+package common
+
+import "testing"
+
+func TestContentTypePolicyCheck(t *testing.T) {
+	policy := ContentTypePolicy{Mode: PolicyModeAllowlist, Rules: []ContentTypeRule{
+		{Type: "video/*", MaxSize: 1000},
+		{Type: "video/mp4"},
+		{Type: "image/svg+xml", Blocked: true},
+		{Type: "image/*"},
+	}}
+
+	tests := []struct {
+		mimeType string
+		size     int64
+		wantCode ErrorCode
+	}{
+		{"video/webm", 1000, ""},
+		{"video/webm", 1001, ErrorCodeFileTooLarge},
+		{"video/mp4", 1001, ""}, // The exact rule beats the wildcard's limit
+		{"image/png", 5, ""},
+		{"image/svg+xml", 5, ErrorCodeInvalidFileType},
+		{"application/pdf", 5, ErrorCodeInvalidFileType}, // Not on the allowlist
+	}
+	for _, tt := range tests {
+		errs := policy.Check(tt.mimeType, tt.size)
+		var got ErrorCode
+		if len(errs) > 0 {
+			got = errs[0].Code
+		}
+		if got != tt.wantCode {
+			t.Errorf("Check(%s, %d) = %q, want %q", tt.mimeType, tt.size, got, tt.wantCode)
+		}
+	}
+
+	if errs := DefaultContentTypePolicy().Check("application/x-anything", MaxFileSize); len(errs) != 0 {
+		t.Errorf("default policy rejected an upload: %v", errs)
+	}
+}
+
+func TestParseContentTypePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"valid", `{"mode": "denylist", "rules": [{"type": "application/x-msdownload", "blocked": true}, {"type": "video/*", "max_size": 1024}]}`, false},
+		{"unknown mode", `{"mode": "blocklist"}`, true},
+		{"unknown field", `{"mode": "denylist", "limit": 5}`, true},
+		{"bare wildcard", `{"mode": "allowlist", "rules": [{"type": "*/*"}]}`, true},
+		{"uppercase type", `{"mode": "allowlist", "rules": [{"type": "Video/MP4"}]}`, true},
+		{"duplicate type", `{"mode": "allowlist", "rules": [{"type": "image/png"}, {"type": "image/png"}]}`, true},
+		{"limit over the global maximum", `{"mode": "allowlist", "rules": [{"type": "video/*", "max_size": 60000000000}]}`, true},
+		{"blocked with a limit", `{"mode": "denylist", "rules": [{"type": "video/*", "blocked": true, "max_size": 5}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseContentTypePolicy([]byte(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseContentTypePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
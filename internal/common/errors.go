@@ -2,7 +2,7 @@ package common
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -21,6 +21,16 @@ const (
 	ErrorCodeConflict       ErrorCode = "CONFLICT"
 	ErrorCodeValidation     ErrorCode = "VALIDATION_ERROR"
 	ErrorCodeTooManyRequests ErrorCode = "TOO_MANY_REQUESTS"
+	ErrorCodeReauthenticationRequired ErrorCode = "REAUTHENTICATION_REQUIRED"
+	ErrorCodeQuotaExceeded  ErrorCode = "STORAGE_QUOTA_EXCEEDED"
+	ErrorCodeFileQuarantined ErrorCode = "FILE_QUARANTINED"
+	ErrorCodeFileCorrupt    ErrorCode = "FILE_CORRUPT"
+	ErrorCodeFileInfected   ErrorCode = "FILE_INFECTED"
+	ErrorCodeScanPending    ErrorCode = "SCAN_PENDING"
+	ErrorCodeTOTPRequired   ErrorCode = "TOTP_REQUIRED"
+	ErrorCodeInvalidTOTPCode ErrorCode = "INVALID_TOTP_CODE"
+	ErrorCodeMethodNotAllowed ErrorCode = "METHOD_NOT_ALLOWED"
+	ErrorCodeAccountSuspended ErrorCode = "ACCOUNT_SUSPENDED"
 	
 	// Server errors (5xx)
 	ErrorCodeInternalServer ErrorCode = "INTERNAL_SERVER_ERROR"
@@ -42,6 +52,8 @@ type ErrorInfo struct {
 	Code    ErrorCode `json:"code"`
 	Message string    `json:"message"`
 	Details string    `json:"details,omitempty"`
+	Errors  []ValidationError `json:"errors,omitempty"` // Every field error, for validation failures
+	Upstream []UpstreamRequest `json:"upstream,omitempty"` // The provider calls a storage failure came from
 }
 
 // SuccessCode represents specific success types for better client handling
@@ -65,28 +77,58 @@ type SuccessResponse struct {
 
 // WriteErrorResponse sends a standardized error response
 func WriteErrorResponse(w http.ResponseWriter, statusCode int, errorCode ErrorCode, message, details string) {
-	requestID := generateRequestID()
+	writeErrorInfo(w, statusCode, ErrorInfo{
+		Code:    errorCode,
+		Message: message,
+		Details: details,
+	})
+}
+
+// WriteValidationErrors sends a 400 Bad Request listing every field that failed validation.
+// Code, message and details summarise the errors as FormatValidationErrors does.
+func WriteValidationErrors(w http.ResponseWriter, errors []ValidationError) {
+	errorCode, message, details := FormatValidationErrors(errors)
+	writeErrorInfo(w, http.StatusBadRequest, ErrorInfo{
+		Code:    errorCode,
+		Message: message,
+		Details: details,
+		Errors:  errors,
+	})
+}
+
+func writeErrorInfo(w http.ResponseWriter, statusCode int, info ErrorInfo) {
+	requestID := responseRequestID(w)
+	
+	// Messages follow the negotiated language; codes and details stay as written
+	if locale := localeOf(w); locale != DefaultLocale {
+		info = localize(info, locale)
+		w.Header().Set("Content-Language", locale)
+	}
+	
+	// Storage failures name the provider requests behind them, for support tickets
+	if upstream := upstreamRequestsOf(w); len(upstream) > 0 {
+		info.Upstream = upstream
+		for _, request := range upstream {
+			w.Header().Add(UpstreamRequestIDHeader, request.String())
+		}
+	}
 	
 	errorResponse := ErrorResponse{
-		Success: false,
-		Error: ErrorInfo{
-			Code:    errorCode,
-			Message: message,
-			Details: details,
-		},
+		Success:   false,
+		Error:     info,
 		RequestID: requestID,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 	
 	// Log the error for debugging
-	log.Printf("[%s] Error %d: %s - %s (Details: %s)", 
-		requestID, statusCode, errorCode, message, details)
+	slog.Warn("Error response", "request_id", requestID, "status", statusCode,
+		"code", info.Code, "message", info.Message, "details", info.Details, "upstream", info.Upstream)
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	
 	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
-		log.Printf("[%s] Failed to encode error response: %v", requestID, err)
+		slog.Error("Failed to encode error response", "request_id", requestID, "error", err)
 		// Fallback to plain text if JSON encoding fails
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte("Internal Server Error"))
@@ -95,7 +137,18 @@ func WriteErrorResponse(w http.ResponseWriter, statusCode int, errorCode ErrorCo
 
 // WriteSuccessResponse sends a standardized success response
 func WriteSuccessResponse(w http.ResponseWriter, statusCode int, successCode SuccessCode, data interface{}) {
-	requestID := generateRequestID()
+	requestID := responseRequestID(w)
+	
+	// Byte counts are written as the client negotiated (see SizeFormatMiddleware)
+	contentType := "application/json"
+	if format := sizeFormatOf(w); format != SizesNumber && data != nil {
+		if raw, err := json.Marshal(data); err == nil {
+			if formatted, err := FormatSizes(raw, format); err == nil {
+				data = json.RawMessage(formatted)
+				contentType = "application/json; sizes=" + format
+			}
+		}
+	}
 	
 	successResponse := SuccessResponse{
 		Success:   true,
@@ -105,11 +158,11 @@ func WriteSuccessResponse(w http.ResponseWriter, statusCode int, successCode Suc
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(statusCode)
 	
 	if err := json.NewEncoder(w).Encode(successResponse); err != nil {
-		log.Printf("[%s] Failed to encode success response: %v", requestID, err)
+		slog.Error("Failed to encode success response", "request_id", requestID, "error", err)
 		WriteErrorResponse(w, http.StatusInternalServerError, ErrorCodeInternalServer, 
 			"Failed to encode response", "JSON encoding error")
 	}
@@ -189,6 +242,15 @@ func generateRequestID() string {
 	return "req-" + uuid.New().String()[:8]
 }
 
+// responseRequestID is the ID RequestLoggerMiddleware gave the request, so a response's
+// request_id matches its log lines, or a fresh one outside that middleware
+func responseRequestID(w http.ResponseWriter) string {
+	if requestID := w.Header().Get("X-Request-ID"); requestID != "" {
+		return requestID
+	}
+	return generateRequestID()
+}
+
 // ValidateJSONRequest validates that request body contains valid JSON
 func ValidateJSONRequest(r *http.Request, target interface{}) error {
 	if r.Header.Get("Content-Type") != "application/json" {
@@ -222,6 +284,17 @@ func (e *ValidationError) Error() string {
 	return e.Message
 }
 
+// ValidationErrors is a set of field errors returned together as one error
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	_, message, details := FormatValidationErrors(e)
+	if details == "" {
+		return message
+	}
+	return message + ": " + details
+}
+
 // IsValidationError checks if an error is a validation error
 func IsValidationError(err error) (*ValidationError, bool) {
 	if validationErr, ok := err.(*ValidationError); ok {
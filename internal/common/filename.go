@@ -0,0 +1,39 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeFilename returns the form a filename is stored, matched and searched under: NFC
+// composed, with control and invisible formatting characters (bidi overrides, zero-width
+// spaces) removed and each run of whitespace collapsed to a single space. It never fails;
+// a name that normalizes to nothing is caught by ValidateFilename.
+func NormalizeFilename(filename string) string {
+	var b strings.Builder
+	b.Grow(len(filename))
+	space := false
+	for _, r := range norm.NFC.String(filename) {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			// Dropped: bidi overrides can disguise a name's real extension, and
+			// zero-width characters make identical-looking names differ
+		default:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// FilenameSearchKey is the form filenames are compared in for search: normalized and case folded
+func FilenameSearchKey(filename string) string {
+	return strings.ToLower(NormalizeFilename(filename))
+}
@@ -0,0 +1,26 @@
+package common
+
+import "testing"
+
+func TestNormalizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"already normal", "report.pdf", "report.pdf"},
+		{"decomposed accent composed", "cafe\u0301.txt", "caf\u00e9.txt"},
+		{"bidi override removed", "invoice\u202egpj.exe", "invoicegpj.exe"},
+		{"zero-width space removed", "re\u200bport.pdf", "report.pdf"},
+		{"control characters removed", "a\x00b\x7f.txt", "ab.txt"},
+		{"whitespace collapsed and trimmed", "  my \t\n  notes .txt ", "my notes .txt"},
+		{"only invisible characters", "\u200e\u200f", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeFilename(tt.filename); got != tt.want {
+				t.Errorf("NormalizeFilename(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
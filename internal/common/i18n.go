@@ -0,0 +1,194 @@
+package common
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the language handlers write their messages in
+const DefaultLocale = "en"
+
+// messageCatalog holds translated error messages keyed by locale then ErrorCode.
+// English needs no entries: handlers already write specific English messages,
+// so they are only replaced when the client asks for another language.
+var messageCatalog = map[string]map[ErrorCode]string{
+	"es": {
+		ErrorCodeBadRequest:               "Solicitud no válida",
+		ErrorCodeUnauthorized:             "Autenticación requerida",
+		ErrorCodeForbidden:                "No tiene permiso para realizar esta acción",
+		ErrorCodeNotFound:                 "Recurso no encontrado",
+		ErrorCodeConflict:                 "La solicitud entra en conflicto con el estado actual",
+		ErrorCodeValidation:               "La validación ha fallado",
+		ErrorCodeTooManyRequests:          "Demasiadas solicitudes, inténtelo más tarde",
+		ErrorCodeReauthenticationRequired: "Se detectó actividad inusual; inicie sesión de nuevo para continuar",
+		ErrorCodeQuotaExceeded:            "Se ha superado la cuota de almacenamiento",
+		ErrorCodeFileQuarantined:          "El archivo está en cuarentena",
+		ErrorCodeFileCorrupt:              "El contenido del archivo no coincide con su suma de verificación",
+		ErrorCodeFileInfected:             "Se ha detectado un virus en el archivo",
+		ErrorCodeScanPending:              "El archivo aún no se ha analizado en busca de virus",
+		ErrorCodeTOTPRequired:             "Se requiere el código de verificación en dos pasos",
+		ErrorCodeInvalidTOTPCode:          "Código de verificación en dos pasos no válido",
+		ErrorCodeMethodNotAllowed:         "Método no permitido",
+		ErrorCodeAccountSuspended:         "La cuenta está suspendida",
+		ErrorCodeInternalServer:           "Error interno del servidor",
+		ErrorCodeServiceUnavailable:       "Servicio no disponible temporalmente",
+		ErrorCodeDatabaseError:            "Error de base de datos",
+		ErrorCodeS3Error:                  "Error de almacenamiento",
+
+		ErrorCodeFileTooLarge:     "El archivo es demasiado grande",
+		ErrorCodeInvalidFilename:  "Nombre de archivo no válido",
+		ErrorCodeInvalidFileType:  "Tipo de archivo no permitido",
+		ErrorCodeFilenameRequired: "El nombre de archivo es obligatorio",
+		ErrorCodeSizeRequired:     "El tamaño del archivo es obligatorio",
+		ErrorCodeInvalidSize:      "Tamaño de archivo no válido",
+		ErrorCodeTooManyTags:      "El archivo tiene demasiadas etiquetas",
+		ErrorCodeInvalidTag:       "Etiqueta no válida",
+		ErrorCodeUsernameRequired: "El nombre de usuario es obligatorio",
+		ErrorCodeUsernameTooShort: "El nombre de usuario es demasiado corto",
+		ErrorCodeUsernameTooLong:  "El nombre de usuario es demasiado largo",
+		ErrorCodeInvalidUsername:  "Nombre de usuario no válido",
+		ErrorCodeEmailRequired:    "El correo electrónico es obligatorio",
+		ErrorCodeInvalidEmail:     "Correo electrónico no válido",
+		ErrorCodePasswordRequired: "La contraseña es obligatoria",
+		ErrorCodePasswordTooShort: "La contraseña es demasiado corta",
+		ErrorCodePasswordTooLong:  "La contraseña es demasiado larga",
+		ErrorCodePasswordTooWeak:  "La contraseña es demasiado débil",
+
+		ErrorCodeFieldRequired: "El campo es obligatorio",
+		ErrorCodeInvalidType:   "El campo tiene un tipo no válido",
+		ErrorCodeInvalidValue:  "El campo tiene un valor no permitido",
+		ErrorCodeUnknownField:  "Campo no reconocido",
+	},
+	"fr": {
+		ErrorCodeBadRequest:               "Requête invalide",
+		ErrorCodeUnauthorized:             "Authentification requise",
+		ErrorCodeForbidden:                "Vous n'avez pas l'autorisation d'effectuer cette action",
+		ErrorCodeNotFound:                 "Ressource introuvable",
+		ErrorCodeConflict:                 "La requête est en conflit avec l'état actuel",
+		ErrorCodeValidation:               "La validation a échoué",
+		ErrorCodeTooManyRequests:          "Trop de requêtes, réessayez plus tard",
+		ErrorCodeReauthenticationRequired: "Activité inhabituelle détectée ; reconnectez-vous pour continuer",
+		ErrorCodeQuotaExceeded:            "Quota de stockage dépassé",
+		ErrorCodeFileQuarantined:          "Le fichier est en quarantaine",
+		ErrorCodeFileCorrupt:              "Le contenu du fichier ne correspond pas à sa somme de contrôle",
+		ErrorCodeFileInfected:             "Un virus a été détecté dans le fichier",
+		ErrorCodeScanPending:              "Le fichier n'a pas encore été analysé",
+		ErrorCodeTOTPRequired:             "Le code de validation en deux étapes est requis",
+		ErrorCodeInvalidTOTPCode:          "Code de validation en deux étapes invalide",
+		ErrorCodeMethodNotAllowed:         "Méthode non autorisée",
+		ErrorCodeAccountSuspended:         "Le compte est suspendu",
+		ErrorCodeInternalServer:           "Erreur interne du serveur",
+		ErrorCodeServiceUnavailable:       "Service temporairement indisponible",
+		ErrorCodeDatabaseError:            "Erreur de base de données",
+		ErrorCodeS3Error:                  "Erreur de stockage",
+
+		ErrorCodeFileTooLarge:     "Le fichier est trop volumineux",
+		ErrorCodeInvalidFilename:  "Nom de fichier invalide",
+		ErrorCodeInvalidFileType:  "Type de fichier non autorisé",
+		ErrorCodeFilenameRequired: "Le nom de fichier est obligatoire",
+		ErrorCodeSizeRequired:     "La taille du fichier est obligatoire",
+		ErrorCodeInvalidSize:      "Taille de fichier invalide",
+		ErrorCodeTooManyTags:      "Le fichier a trop d'étiquettes",
+		ErrorCodeInvalidTag:       "Étiquette invalide",
+		ErrorCodeUsernameRequired: "Le nom d'utilisateur est obligatoire",
+		ErrorCodeUsernameTooShort: "Le nom d'utilisateur est trop court",
+		ErrorCodeUsernameTooLong:  "Le nom d'utilisateur est trop long",
+		ErrorCodeInvalidUsername:  "Nom d'utilisateur invalide",
+		ErrorCodeEmailRequired:    "L'adresse e-mail est obligatoire",
+		ErrorCodeInvalidEmail:     "Adresse e-mail invalide",
+		ErrorCodePasswordRequired: "Le mot de passe est obligatoire",
+		ErrorCodePasswordTooShort: "Le mot de passe est trop court",
+		ErrorCodePasswordTooLong:  "Le mot de passe est trop long",
+		ErrorCodePasswordTooWeak:  "Le mot de passe est trop faible",
+
+		ErrorCodeFieldRequired: "Le champ est obligatoire",
+		ErrorCodeInvalidType:   "Le champ a un type invalide",
+		ErrorCodeInvalidValue:  "Le champ a une valeur non autorisée",
+		ErrorCodeUnknownField:  "Champ non reconnu",
+	},
+}
+
+// NegotiateLocale picks the best supported locale for an Accept-Language header,
+// honouring q-values and falling back from regional tags ("es-MX") to the base language
+func NegotiateLocale(acceptLanguage string) string {
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= bestQ {
+			continue
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := messageCatalog[base]; ok || base == DefaultLocale {
+			best, bestQ = base, q
+		}
+	}
+	return best
+}
+
+// LocaleMiddleware negotiates the response language from Accept-Language so error
+// responses are written in it. Error codes are never translated.
+func LocaleMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Language")
+			locale := NegotiateLocale(r.Header.Get("Accept-Language"))
+			next.ServeHTTP(&localeWriter{ResponseWriter: w, locale: locale}, r)
+		})
+	}
+}
+
+// localeWriter carries the negotiated locale to the error helpers, which only see the writer
+type localeWriter struct {
+	http.ResponseWriter
+	locale string
+}
+
+func (w *localeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// localeOf finds the negotiated locale on a writer, looking through any wrappers
+func localeOf(w http.ResponseWriter) string {
+	for w != nil {
+		if lw, ok := w.(*localeWriter); ok {
+			return lw.locale
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = unwrapper.Unwrap()
+	}
+	return DefaultLocale
+}
+
+// localize translates an error's messages into the locale, leaving any without a catalog entry unchanged
+func localize(info ErrorInfo, locale string) ErrorInfo {
+	catalog, ok := messageCatalog[locale]
+	if !ok {
+		return info
+	}
+	if message, ok := catalog[info.Code]; ok {
+		info.Message = message
+	}
+	if len(info.Errors) > 0 {
+		errors := make([]ValidationError, len(info.Errors))
+		for i, e := range info.Errors {
+			if message, ok := catalog[e.Code]; ok {
+				e.Message = message
+			}
+			errors[i] = e
+		}
+		info.Errors = errors
+	}
+	return info
+}
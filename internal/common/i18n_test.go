@@ -0,0 +1,66 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"fr", "fr"},
+		{"es-MX,es;q=0.9", "es"},
+		{"de-DE,fr;q=0.8,es;q=0.9", "es"},
+		{"ja, en;q=0.5", "en"},
+		{"fr;q=0.4, en;q=0.9", "en"},
+		{"fr;q=bogus", "en"},
+	}
+	for _, tt := range tests {
+		if got := NegotiateLocale(tt.header); got != tt.want {
+			t.Errorf("NegotiateLocale(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLocalizedErrorResponse(t *testing.T) {
+	h := LocaleMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteValidationErrors(w, []ValidationError{
+			{Field: "email", Code: ErrorCodeInvalidEmail, Message: "Invalid email format"},
+			{Field: "password", Code: ErrorCodePasswordRequired, Message: "Password is required"},
+		})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.Header.Set("Accept-Language", "fr-CA")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Language"); got != "fr" {
+		t.Errorf("Content-Language = %q, want fr", got)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error.Code != ErrorCodeValidation || resp.Error.Message != "La validation a échoué" {
+		t.Errorf("error = %s %q, want a French validation message", resp.Error.Code, resp.Error.Message)
+	}
+	if len(resp.Error.Errors) != 2 || resp.Error.Errors[1].Message != "Le mot de passe est obligatoire" {
+		t.Errorf("field errors = %+v, want French messages", resp.Error.Errors)
+	}
+
+	// Without a preference the handler's own English messages are kept
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error.Message != "Multiple validation errors" || rec.Header().Get("Content-Language") != "" {
+		t.Errorf("default locale message = %q, want the original", resp.Error.Message)
+	}
+}
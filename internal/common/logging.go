@@ -1,177 +1,101 @@
 package common
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"runtime"
-	"time"
-)
-
-// LogLevel represents different log levels
-type LogLevel string
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
 
-const (
-	LogLevelDebug LogLevel = "DEBUG"
-	LogLevelInfo  LogLevel = "INFO"
-	LogLevelWarn  LogLevel = "WARN"
-	LogLevelError LogLevel = "ERROR"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
-// StructuredLogger provides structured logging with request context
-type StructuredLogger struct {
-	requestID string
-	userID    string
-	service   string
+// Log levels selectable with LOG_LEVEL
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
 }
 
-// NewStructuredLogger creates a new structured logger
-func NewStructuredLogger(requestID, userID, service string) *StructuredLogger {
-	return &StructuredLogger{
-		requestID: requestID,
-		userID:    userID,
-		service:   service,
-	}
+// SetupLogging makes the default logger write JSON lines to stderr, each tagged with
+// service, at level (debug, info, warn or error) and above. The standard log package
+// writes through it too, so code still calling log.Printf logs JSON at info level.
+// Every field, the message included, goes through RedactAttr.
+func SetupLogging(service, level string) error {
+	minLevel, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		return fmt.Errorf("unknown log level %q: must be debug, info, warn or error", level)
+	}
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: minLevel, ReplaceAttr: RedactAttr})
+	slog.SetDefault(slog.New(handler).With("service", service))
+	return nil
 }
 
-// logMessage formats and logs a structured message
-func (sl *StructuredLogger) logMessage(level LogLevel, message string, fields map[string]interface{}) {
-	timestamp := time.Now().UTC().Format(time.RFC3339)
-	
-	// Get caller information
-	_, file, line, ok := runtime.Caller(2)
-	caller := "unknown"
-	if ok {
-		// Extract just the filename, not the full path
-		for i := len(file) - 1; i >= 0; i-- {
-			if file[i] == '/' {
-				caller = fmt.Sprintf("%s:%d", file[i+1:], line)
-				break
-			}
-		}
-	}
-	
-	// Build log entry
-	logEntry := fmt.Sprintf("[%s] %s [%s] [%s]", timestamp, level, sl.service, caller)
-	
-	if sl.requestID != "" {
-		logEntry += fmt.Sprintf(" [req:%s]", sl.requestID)
-	}
-	
-	if sl.userID != "" {
-		logEntry += fmt.Sprintf(" [user:%s]", sl.userID)
-	}
-	
-	logEntry += fmt.Sprintf(" %s", message)
-	
-	// Add additional fields
-	if len(fields) > 0 {
-		logEntry += " |"
-		for key, value := range fields {
-			logEntry += fmt.Sprintf(" %s=%v", key, value)
-		}
-	}
-	
-	log.Println(logEntry)
-}
+type loggerKey struct{}
 
-// Debug logs a debug message
-func (sl *StructuredLogger) Debug(message string, fields ...map[string]interface{}) {
-	f := make(map[string]interface{})
-	if len(fields) > 0 {
-		f = fields[0]
-	}
-	sl.logMessage(LogLevelDebug, message, f)
+// WithLogger returns a copy of ctx carrying logger, for Logger to find
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
-// Info logs an info message
-func (sl *StructuredLogger) Info(message string, fields ...map[string]interface{}) {
-	f := make(map[string]interface{})
-	if len(fields) > 0 {
-		f = fields[0]
+// Logger returns the request-scoped logger RequestLoggerMiddleware put in ctx, or the
+// default logger outside a request
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
 	}
-	sl.logMessage(LogLevelInfo, message, f)
+	return slog.Default()
 }
 
-// Warn logs a warning message
-func (sl *StructuredLogger) Warn(message string, fields ...map[string]interface{}) {
-	f := make(map[string]interface{})
-	if len(fields) > 0 {
-		f = fields[0]
-	}
-	sl.logMessage(LogLevelWarn, message, f)
-}
+// maxRequestIDLength bounds a caller-supplied X-Request-ID that is kept
+const maxRequestIDLength = 128
 
-// Error logs an error message
-func (sl *StructuredLogger) Error(message string, fields ...map[string]interface{}) {
-	f := make(map[string]interface{})
-	if len(fields) > 0 {
-		f = fields[0]
-	}
-	sl.logMessage(LogLevelError, message, f)
-}
+// RequestLoggerMiddleware gives each request an ID and a logger carrying it, with the
+// method and matched route. The ID comes from X-Request-ID when the caller sent a usable
+// one, so the gateway's ID follows a request into the file service, and is echoed in the
+// response. Authentication adds the user ID to the logger once it is known.
+func RequestLoggerMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get("X-Request-ID")
+			if !validRequestID(requestID) {
+				requestID = "req-" + uuid.New().String()[:8]
+			}
+			// Set on the request too, so proxied calls pass it on
+			r.Header.Set("X-Request-ID", requestID)
+			w.Header().Set("X-Request-ID", requestID)
 
-// LogValidationError logs validation errors with structured format
-func (sl *StructuredLogger) LogValidationError(endpoint string, errors []ValidationError) {
-	fields := map[string]interface{}{
-		"endpoint":     endpoint,
-		"error_count":  len(errors),
-		"error_fields": make([]string, len(errors)),
-	}
-	
-	errorFields := make([]string, len(errors))
-	for i, err := range errors {
-		errorFields[i] = err.Field
+			logger := Logger(r.Context()).With("request_id", requestID, "method", r.Method, "route", routeTemplate(r))
+			ctx := context.WithValue(r.Context(), RequestIDKey, requestID)
+			next.ServeHTTP(w, r.WithContext(WithLogger(ctx, logger)))
+		})
 	}
-	fields["error_fields"] = errorFields
-	
-	sl.Warn("Validation failed", fields)
 }
 
-// LogAuthenticationAttempt logs authentication attempts
-func (sl *StructuredLogger) LogAuthenticationAttempt(email string, success bool, reason string) {
-	fields := map[string]interface{}{
-		"email":   email,
-		"success": success,
-	}
-	
-	if reason != "" {
-		fields["reason"] = reason
-	}
-	
-	if success {
-		sl.Info("Authentication successful", fields)
-	} else {
-		sl.Warn("Authentication failed", fields)
-	}
-}
-
-// LogFileOperation logs file operations
-func (sl *StructuredLogger) LogFileOperation(operation, filename, fileID string, size *int64) {
-	fields := map[string]interface{}{
-		"operation": operation,
-		"filename":  filename,
-		"file_id":   fileID,
-	}
-	
-	if size != nil {
-		fields["file_size"] = *size
+// validRequestID accepts short IDs of printable ASCII, so a caller can't write
+// arbitrary text into every log line
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
 	}
-	
-	sl.Info("File operation", fields)
+	return true
 }
 
-// LogError logs errors with additional context
-func (sl *StructuredLogger) LogError(operation string, err error, fields ...map[string]interface{}) {
-	f := map[string]interface{}{
-		"operation": operation,
-		"error":     err.Error(),
-	}
-	
-	if len(fields) > 0 {
-		for key, value := range fields[0] {
-			f[key] = value
+// routeTemplate is the matched route's path template, e.g. /files/{id}, so log lines
+// group by route rather than by path
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
 		}
 	}
-	
-	sl.Error("Operation failed", f)
-}
\ No newline at end of file
+	return r.URL.Path
+}
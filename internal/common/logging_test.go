@@ -0,0 +1,74 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	r := mux.NewRouter()
+	r.Use(RequestLoggerMiddleware())
+	r.HandleFunc("/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Logger(r.Context()).Info("handled")
+		WriteNotFoundError(w, "File not found", "")
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantKept  bool
+	}{
+		{"caller's ID kept", "req-abc12345", true},
+		{"missing ID generated", "", false},
+		{"unprintable ID replaced", "forged\nline", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/files/file-1", nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get("X-Request-ID")
+			if tt.wantKept != (requestID == tt.requestID) || !strings.HasPrefix(requestID, "req-") {
+				t.Errorf("X-Request-ID = %q for %q", requestID, tt.requestID)
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.RequestID != requestID {
+				t.Errorf("response request_id = %q, want %q (%v)", body.RequestID, requestID, err)
+			}
+
+			var line map[string]any
+			if err := json.Unmarshal(bytes.SplitN(logs.Bytes(), []byte("\n"), 2)[0], &line); err != nil {
+				t.Fatal(err)
+			}
+			if line["msg"] != "handled" || line["request_id"] != requestID || line["route"] != "/files/{id}" || line["method"] != http.MethodGet {
+				t.Errorf("log line %v, want request_id %s and route /files/{id}", line, requestID)
+			}
+		})
+	}
+}
+
+func TestSetupLoggingRejectsUnknownLevel(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	if err := SetupLogging("test", "verbose"); err == nil {
+		t.Error("SetupLogging accepted level verbose")
+	}
+	if err := SetupLogging("test", "WARN"); err != nil {
+		t.Errorf("SetupLogging(WARN) = %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 // Request context keys
@@ -118,6 +119,22 @@ func FileSizeValidationMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
+// PathParamValidationMiddleware rejects requests whose path parameters fail
+// ValidatePathParams with 400, before the route's handler runs. It must be added to the
+// router with Use, so the route has been matched.
+func PathParamValidationMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if errors := ValidatePathParams(mux.Vars(r)); len(errors) > 0 {
+				WriteValidationErrors(w, errors)
+				return
+			}
+			
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // SecurityHeadersMiddleware adds security headers
 func SecurityHeadersMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
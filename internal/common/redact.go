@@ -0,0 +1,124 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// credentialParams are query parameters whose values are secrets, lowercased: tokens,
+// keys and the signatures of presigned URLs
+var credentialParams = map[string]bool{
+	"token":                true,
+	"access_token":         true,
+	"refresh_token":        true,
+	"id_token":             true,
+	"api_key":              true,
+	"apikey":               true,
+	"key":                  true,
+	"password":             true,
+	"secret":               true,
+	"code":                 true,
+	"signature":            true,
+	"x-amz-signature":      true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"x-vd-signature":       true,
+}
+
+// credentialAttrs are log attribute keys whose values are secrets, lowercased
+var credentialAttrs = map[string]bool{
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"api_key":       true,
+	"password":      true,
+	"secret":        true,
+	"signature":     true,
+	"authorization": true,
+}
+
+// escapedEmail matches an email address in a URL, with the @ written plainly or
+// percent-encoded
+var escapedEmail = regexp.MustCompile(`[A-Za-z0-9._%+\-]+(?:@|%40)[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// bearerToken, jwtToken and absoluteURL match what RedactString looks for in free text
+var (
+	bearerToken = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/\-]+=*`)
+	jwtToken    = regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]*\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	absoluteURL = regexp.MustCompile(`https?://[^\s"'<>]+`)
+)
+
+// MaskEmail replaces an email address with a short hash of it, so lines about one
+// address can still be matched up without the address being readable
+func MaskEmail(email string) string {
+	if decoded, err := url.QueryUnescape(email); err == nil {
+		email = decoded
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return "[email:" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+func maskEmails(s string) string {
+	return escapedEmail.ReplaceAllStringFunc(s, MaskEmail)
+}
+
+// RedactURL is u's path and query as they should be logged. Credential parameters keep
+// their names but not their values, and email addresses anywhere are masked, so a log
+// line can't be used to sign in or to find out who made a request. The result stays
+// percent-encoded.
+func RedactURL(u *url.URL) string {
+	redacted := maskEmails(u.EscapedPath())
+	if u.RawQuery == "" {
+		return redacted
+	}
+
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		name, _, hasValue := strings.Cut(param, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil && hasValue && credentialParams[strings.ToLower(decoded)] {
+			params[i] = name + "=[redacted]"
+			continue
+		}
+		params[i] = maskEmails(param)
+	}
+	return redacted + "?" + strings.Join(params, "&")
+}
+
+// RedactString masks what shouldn't be logged wherever it appears in s: email addresses,
+// bearer tokens and JWTs, and the credentials in URLs such as presigned ones. Absolute
+// URLs keep their scheme, host and path but lose any user info.
+func RedactString(s string) string {
+	s = absoluteURL.ReplaceAllStringFunc(s, func(match string) string {
+		u, err := url.Parse(match)
+		if err != nil || u.Host == "" {
+			return maskEmails(match)
+		}
+		return u.Scheme + "://" + u.Host + RedactURL(u)
+	})
+	s = bearerToken.ReplaceAllString(s, "Bearer [redacted]")
+	s = jwtToken.ReplaceAllString(s, "[redacted]")
+	return maskEmails(s)
+}
+
+// RedactAttr is a slog ReplaceAttr function that applies RedactString to string and
+// error values, and drops the values of attributes named like credentials outright
+func RedactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if credentialAttrs[strings.ToLower(a.Key)] {
+			return slog.String(a.Key, "[redacted]")
+		}
+		if redacted := RedactString(a.Value.String()); redacted != a.Value.String() {
+			return slog.String(a.Key, redacted)
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,185 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Size formats, negotiated with a "sizes" parameter on the Accept header, e.g.
+// "Accept: application/json; sizes=string". JavaScript numbers lose precision past 2^53,
+// so clients that may see sizes that large ask for strings.
+const (
+	SizesNumber = "number" // Byte counts are JSON numbers, the default
+	SizesString = "string" // Byte counts are decimal strings
+	SizesBoth   = "both"   // Byte counts are numbers, each followed by a "<name>_string" copy
+)
+
+// NegotiateSizeFormat picks the size format an Accept header asks for. Only the sizes
+// parameter of a range that covers application/json counts; anything else is SizesNumber.
+func NegotiateSizeFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType != "application/json" && mediaType != "application/*" && mediaType != "*/*" {
+			continue
+		}
+		switch format := strings.ToLower(params["sizes"]); format {
+		case SizesString, SizesBoth:
+			return format
+		}
+	}
+	return SizesNumber
+}
+
+// SizeFormatMiddleware negotiates how success responses write byte counts, from the
+// Accept header
+func SizeFormatMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept")
+			format := NegotiateSizeFormat(r.Header.Get("Accept"))
+			if format == SizesNumber {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(&sizeFormatWriter{ResponseWriter: w, format: format}, r)
+		})
+	}
+}
+
+// sizeFormatWriter carries the negotiated size format to WriteSuccessResponse
+type sizeFormatWriter struct {
+	http.ResponseWriter
+	format string
+}
+
+func (w *sizeFormatWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// sizeFormatOf finds the negotiated size format on a writer, looking through any wrappers
+func sizeFormatOf(w http.ResponseWriter) string {
+	for w != nil {
+		if sw, ok := w.(*sizeFormatWriter); ok {
+			return sw.format
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = unwrapper.Unwrap()
+	}
+	return SizesNumber
+}
+
+// isSizeField reports whether a JSON field holds a byte count: "size" and "bytes", and
+// names ending in "_size" or "_bytes" or starting with "bytes_"
+func isSizeField(name string) bool {
+	return name == "size" || name == "bytes" || strings.HasSuffix(name, "_size") ||
+		strings.HasSuffix(name, "_bytes") || strings.HasPrefix(name, "bytes_")
+}
+
+// FormatSizes rewrites the byte counts in a JSON document for format, keeping everything
+// else, field order included, as it was. Only integers in size fields are changed.
+func FormatSizes(data []byte, format string) ([]byte, error) {
+	if format != SizesString && format != SizesBoth {
+		return data, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var out bytes.Buffer
+	if err := formatSizesValue(decoder, &out, "", format); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// formatSizesValue copies the next value from decoder to out. name is the field the value
+// is in, or "" outside an object. A size written in both forms gets its "_string" copy
+// from the enclosing object, which sees the returned number.
+func formatSizesValue(decoder *json.Decoder, out *bytes.Buffer, name, format string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			out.WriteByte('[')
+			for i := 0; decoder.More(); i++ {
+				if i > 0 {
+					out.WriteByte(',')
+				}
+				if err := formatSizesValue(decoder, out, "", format); err != nil {
+					return err
+				}
+			}
+			out.WriteByte(']')
+		} else {
+			out.WriteByte('{')
+			for i := 0; decoder.More(); i++ {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				field, ok := key.(string)
+				if !ok {
+					return fmt.Errorf("unexpected object key %v", key)
+				}
+				if i > 0 {
+					out.WriteByte(',')
+				}
+				encoded, _ := json.Marshal(field)
+				out.Write(encoded)
+				out.WriteByte(':')
+				start := out.Len()
+				if err := formatSizesValue(decoder, out, field, format); err != nil {
+					return err
+				}
+				if format == SizesBoth && isSizeField(field) && isInteger(out.Bytes()[start:]) {
+					number := string(out.Bytes()[start:])
+					fmt.Fprintf(out, `,"%s_string":"%s"`, field, number)
+				}
+			}
+			out.WriteByte('}')
+		}
+		// The closing delimiter
+		_, err := decoder.Token()
+		return err
+	case json.Number:
+		if format == SizesString && isSizeField(name) && isInteger([]byte(token)) {
+			out.WriteString(`"` + token.String() + `"`)
+			return nil
+		}
+		out.WriteString(token.String())
+	default:
+		encoded, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		out.Write(encoded)
+	}
+	return nil
+}
+
+// isInteger reports whether a JSON number is written as a plain integer
+func isInteger(number []byte) bool {
+	if len(number) > 0 && number[0] == '-' {
+		number = number[1:]
+	}
+	if len(number) == 0 {
+		return false
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
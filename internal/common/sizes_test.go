@@ -0,0 +1,88 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateSizeFormat(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", SizesNumber},
+		{"application/json", SizesNumber},
+		{"application/json; sizes=string", SizesString},
+		{"application/json;sizes=BOTH", SizesBoth},
+		{"text/html, */*; sizes=string", SizesString},
+		{"text/plain; sizes=string", SizesNumber},
+		{"application/json; sizes=hex", SizesNumber},
+	}
+	for _, tt := range tests {
+		if got := NegotiateSizeFormat(tt.header); got != tt.want {
+			t.Errorf("NegotiateSizeFormat(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSizes(t *testing.T) {
+	doc := `{"file_id":"f1","size":9007199254740993,"tags":{"size":"large"},"chunks":[{"chunk_number":2,"chunk_size":5242880}],"ratio":1.5,"used_bytes":-1,"total_size":null}`
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{SizesNumber, doc},
+		{SizesString, `{"file_id":"f1","size":"9007199254740993","tags":{"size":"large"},"chunks":[{"chunk_number":2,"chunk_size":"5242880"}],"ratio":1.5,"used_bytes":"-1","total_size":null}`},
+		{SizesBoth, `{"file_id":"f1","size":9007199254740993,"size_string":"9007199254740993","tags":{"size":"large"},"chunks":[{"chunk_number":2,"chunk_size":5242880,"chunk_size_string":"5242880"}],"ratio":1.5,"used_bytes":-1,"used_bytes_string":"-1","total_size":null}`},
+	}
+	for _, tt := range tests {
+		got, err := FormatSizes([]byte(doc), tt.format)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestSuccessResponseSizes(t *testing.T) {
+	type file struct {
+		FileID string `json:"file_id"`
+		Size   int64  `json:"size"`
+	}
+	h := SizeFormatMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteOKResponse(w, file{FileID: "f1", Size: 1<<53 + 1})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/files/f1", nil)
+	req.Header.Set("Accept", "application/json; sizes=string")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json; sizes=string" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.Contains(rec.Header().Get("Vary"), "Accept") {
+		t.Errorf("Vary = %q, want Accept", rec.Header().Get("Vary"))
+	}
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["size"] != "9007199254740993" {
+		t.Errorf("size = %#v, want the exact value as a string", resp.Data["size"])
+	}
+
+	// Without the parameter sizes stay numbers
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/f1", nil))
+	if !strings.Contains(rec.Body.String(), `"size":9007199254740993`) || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("default response = %s (%s)", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+}
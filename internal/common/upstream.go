@@ -0,0 +1,65 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+)
+
+// UpstreamRequestIDHeader carries the upstream requests behind an error response, one
+// value per request as UpstreamRequest.String writes it, so the gateway can log them
+// against its own request ID
+const UpstreamRequestIDHeader = "X-Upstream-Request-ID"
+
+// UpstreamRequest is a call to a storage provider that a request failed in, with the IDs
+// the provider's support looks it up by
+type UpstreamRequest struct {
+	Service   string `json:"service"` // The AWS service, e.g. "S3" or "DynamoDB"
+	Operation string `json:"operation"`
+	RequestID string `json:"request_id"`
+	HostID    string `json:"host_id,omitempty"` // S3's extended request ID (x-amz-id-2)
+}
+
+// String is the request as sent in UpstreamRequestIDHeader, e.g.
+// "S3 GetObject request_id=4442587FB7D0A2F9 host_id=gyB+3jRPnrkN..."
+func (u UpstreamRequest) String() string {
+	var b strings.Builder
+	b.WriteString(u.Service + " " + u.Operation + " request_id=" + u.RequestID)
+	if u.HostID != "" {
+		b.WriteString(" host_id=" + u.HostID)
+	}
+	return b.String()
+}
+
+// upstreamWriter is a ResponseWriter whose error response names the upstream requests
+type upstreamWriter struct {
+	http.ResponseWriter
+	requests []UpstreamRequest
+}
+
+func (u *upstreamWriter) Unwrap() http.ResponseWriter {
+	return u.ResponseWriter
+}
+
+// WithUpstreamRequests has an error response written to w list requests in its upstream
+// field and UpstreamRequestIDHeader. No requests returns w unchanged.
+func WithUpstreamRequests(w http.ResponseWriter, requests []UpstreamRequest) http.ResponseWriter {
+	if len(requests) == 0 {
+		return w
+	}
+	return &upstreamWriter{ResponseWriter: w, requests: requests}
+}
+
+// upstreamRequestsOf returns the upstream requests WithUpstreamRequests attached to w
+func upstreamRequestsOf(w http.ResponseWriter) []UpstreamRequest {
+	for w != nil {
+		if uw, ok := w.(*upstreamWriter); ok {
+			return uw.requests
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = unwrapper.Unwrap()
+	}
+	return nil
+}
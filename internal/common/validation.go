@@ -5,7 +5,13 @@ import (
 	"mime"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
 )
 
 // Validation constants
@@ -24,6 +30,11 @@ const (
 	// Request limits
 	MaxChunkSize         = 5 * 1024 * 1024 * 1024 // 5GB per chunk
 	MaxMultipartParts    = 10000 // AWS S3 limit
+	
+	// File tag limits, in characters
+	MaxFileTags          = 20
+	MaxTagKeyLength      = 128
+	MaxTagValueLength    = 256
 )
 
 // File validation error codes
@@ -34,6 +45,8 @@ const (
 	ErrorCodeFilenameRequired  ErrorCode = "FILENAME_REQUIRED"
 	ErrorCodeSizeRequired      ErrorCode = "SIZE_REQUIRED"
 	ErrorCodeInvalidSize       ErrorCode = "INVALID_SIZE"
+	ErrorCodeTooManyTags       ErrorCode = "TOO_MANY_TAGS"
+	ErrorCodeInvalidTag        ErrorCode = "INVALID_TAG"
 	
 	// User validation error codes
 	ErrorCodeUsernameRequired  ErrorCode = "USERNAME_REQUIRED"
@@ -46,63 +59,14 @@ const (
 	ErrorCodePasswordTooShort  ErrorCode = "PASSWORD_TOO_SHORT"
 	ErrorCodePasswordTooLong   ErrorCode = "PASSWORD_TOO_LONG"
 	ErrorCodePasswordTooWeak   ErrorCode = "PASSWORD_TOO_WEAK"
+	
+	// Request schema error codes
+	ErrorCodeFieldRequired     ErrorCode = "FIELD_REQUIRED"
+	ErrorCodeInvalidType       ErrorCode = "INVALID_TYPE"
+	ErrorCodeInvalidValue      ErrorCode = "INVALID_VALUE"
+	ErrorCodeUnknownField      ErrorCode = "UNKNOWN_FIELD"
 )
 
-// Allowed file types (MIME types)
-var AllowedMimeTypes = map[string]bool{
-	// Documents
-	"application/pdf":                                        true,
-	"application/msword":                                     true,
-	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
-	"application/vnd.ms-excel":                               true,
-	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
-	"application/vnd.ms-powerpoint":                          true,
-	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
-	"text/plain":                                             true,
-	"text/csv":                                               true,
-	"text/rtf":                                               true,
-	
-	// Images
-	"image/jpeg":                                             true,
-	"image/png":                                              true,
-	"image/gif":                                              true,
-	"image/webp":                                             true,
-	"image/svg+xml":                                          true,
-	"image/bmp":                                              true,
-	"image/tiff":                                             true,
-	
-	// Audio
-	"audio/mpeg":                                             true,
-	"audio/wav":                                              true,
-	"audio/ogg":                                              true,
-	"audio/mp4":                                              true,
-	"audio/aac":                                              true,
-	"audio/flac":                                             true,
-	
-	// Video
-	"video/mp4":                                              true,
-	"video/mpeg":                                             true,
-	"video/quicktime":                                        true,
-	"video/x-msvideo":                                        true,
-	"video/webm":                                             true,
-	"video/ogg":                                              true,
-	
-	// Archives
-	"application/zip":                                        true,
-	"application/x-tar":                                      true,
-	"application/gzip":                                       true,
-	"application/x-7z-compressed":                            true,
-	"application/x-rar-compressed":                           true,
-	
-	// Code/Text
-	"application/json":                                       true,
-	"application/xml":                                        true,
-	"text/html":                                              true,
-	"text/css":                                               true,
-	"text/javascript":                                        true,
-	"application/javascript":                                 true,
-}
-
 // File validation functions
 
 // ValidateFileUpload validates file upload request parameters
@@ -213,23 +177,88 @@ func ValidateFileSize(size *int64) []ValidationError {
 	return errors
 }
 
+// ValidateFileTags checks a file's tags. A tag is a key with a value, which may be empty
+// for a plain label. Keys must not be blank or start or end with spaces, and neither keys
+// nor values may contain control characters.
+func ValidateFileTags(tags map[string]string) []ValidationError {
+	var errors []ValidationError
+	
+	if len(tags) > MaxFileTags {
+		errors = append(errors, ValidationError{
+			Field:   "tags",
+			Code:    ErrorCodeTooManyTags,
+			Message: fmt.Sprintf("A file can have at most %d tags", MaxFileTags),
+		})
+	}
+	
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		invalid := func(message string, args ...interface{}) {
+			errors = append(errors, ValidationError{
+				Field:   "tags",
+				Code:    ErrorCodeInvalidTag,
+				Message: fmt.Sprintf("Tag %q: ", key) + fmt.Sprintf(message, args...),
+			})
+		}
+		switch {
+		case strings.TrimSpace(key) == "":
+			invalid("key must not be blank")
+		case strings.TrimSpace(key) != key:
+			invalid("key must not start or end with spaces")
+		case utf8.RuneCountInString(key) > MaxTagKeyLength:
+			invalid("key must be at most %d characters", MaxTagKeyLength)
+		case !printable(key):
+			invalid("key contains invalid characters")
+		}
+		value := tags[key]
+		switch {
+		case utf8.RuneCountInString(value) > MaxTagValueLength:
+			invalid("value must be at most %d characters", MaxTagValueLength)
+		case !printable(value):
+			invalid("value contains invalid characters")
+		}
+	}
+	
+	return errors
+}
+
+// printable reports whether s is valid UTF-8 without control characters
+func printable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateMimeType checks a declared MIME type is well formed and matches the file's
+// extension. Whether the type is accepted at all is up to the ContentTypePolicy.
 func ValidateMimeType(mimeType, filename string) []ValidationError {
 	var errors []ValidationError
 	
-	// Check if MIME type is allowed
-	if !AllowedMimeTypes[mimeType] {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
 		errors = append(errors, ValidationError{
 			Field:   "mime_type",
 			Code:    ErrorCodeInvalidFileType,
-			Message: fmt.Sprintf("File type '%s' is not allowed", mimeType),
+			Message: fmt.Sprintf("'%s' is not a valid MIME type", mimeType),
 		})
+		return errors
 	}
 	
 	// Validate MIME type matches file extension
 	if filename != "" {
 		ext := strings.ToLower(filepath.Ext(filename))
-		expectedMimeType := mime.TypeByExtension(ext)
-		if expectedMimeType != "" && expectedMimeType != mimeType {
+		expectedMimeType := DetectContentType(filename, "")
+		if mime.TypeByExtension(ext) != "" && expectedMimeType != mediaType {
 			errors = append(errors, ValidationError{
 				Field:   "mime_type",
 				Code:    ErrorCodeInvalidFileType,
@@ -241,6 +270,57 @@ func ValidateMimeType(mimeType, filename string) []ValidationError {
 	return errors
 }
 
+// Path parameter validation functions
+
+// uuidPathParams are the path parameters that hold IDs, all of which are UUIDs
+var uuidPathParams = map[string]bool{
+	"id":         true,
+	"fileId":     true,
+	"userId":     true,
+	"transferId": true,
+}
+
+// chunkNumberPattern is a chunk number as written in a path: digits, no sign or leading zeros
+var chunkNumberPattern = regexp.MustCompile(`^[1-9][0-9]*$`)
+
+// ValidatePathParams checks a route's path parameters, as returned by mux.Vars, so
+// malformed IDs are rejected before they reach the storage layer. IDs must be UUIDs in
+// their usual 36-character form, and chunk numbers from 1 to MaxMultipartParts.
+// Parameters it doesn't know are left alone.
+func ValidatePathParams(vars map[string]string) []ValidationError {
+	var errors []ValidationError
+	
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := vars[name]
+		switch {
+		case uuidPathParams[name]:
+			if _, err := uuid.Parse(value); err != nil || len(value) != len(uuid.Nil.String()) {
+				errors = append(errors, ValidationError{
+					Field:   name,
+					Code:    ErrorCodeInvalidValue,
+					Message: fmt.Sprintf("%s must be a UUID", name),
+				})
+			}
+		case name == "chunkNumber":
+			number, err := strconv.Atoi(value)
+			if !chunkNumberPattern.MatchString(value) || err != nil || number > MaxMultipartParts {
+				errors = append(errors, ValidationError{
+					Field:   name,
+					Code:    ErrorCodeInvalidValue,
+					Message: fmt.Sprintf("chunkNumber must be a whole number from 1 to %d", MaxMultipartParts),
+				})
+			}
+		}
+	}
+	
+	return errors
+}
+
 // User validation functions
 
 type UserRegistrationRequest struct {
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -115,6 +117,84 @@ func TestValidateUserRegistration(t *testing.T) {
 	}
 }
 
+func TestValidateFileTags(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxFileTags; i++ {
+		tooMany[fmt.Sprintf("tag-%d", i)] = ""
+	}
+
+	tests := []struct {
+		name     string
+		tags     map[string]string
+		wantCode ErrorCode
+	}{
+		{"labels and values", map[string]string{"project": "apollo", "reviewed": "", "état": "brouillon"}, ""},
+		{"no tags", map[string]string{}, ""},
+		{"too many", tooMany, ErrorCodeTooManyTags},
+		{"blank key", map[string]string{" ": "x"}, ErrorCodeInvalidTag},
+		{"padded key", map[string]string{"project ": "x"}, ErrorCodeInvalidTag},
+		{"long key", map[string]string{strings.Repeat("k", MaxTagKeyLength+1): ""}, ErrorCodeInvalidTag},
+		{"long value", map[string]string{"k": strings.Repeat("é", MaxTagValueLength+1)}, ErrorCodeInvalidTag},
+		{"control character", map[string]string{"k": "line\nbreak"}, ErrorCodeInvalidTag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateFileTags(tt.tags)
+			if tt.wantCode == "" {
+				if len(errors) != 0 {
+					t.Errorf("ValidateFileTags() = %+v, want no errors", errors)
+				}
+				return
+			}
+			if len(errors) != 1 || errors[0].Code != tt.wantCode {
+				t.Errorf("ValidateFileTags() = %+v, want one %s", errors, tt.wantCode)
+			}
+		})
+	}
+
+	// Exactly at the limits is allowed
+	atLimit := map[string]string{strings.Repeat("k", MaxTagKeyLength): strings.Repeat("v", MaxTagValueLength)}
+	if errors := ValidateFileTags(atLimit); len(errors) != 0 {
+		t.Errorf("tag at the length limits rejected: %+v", errors)
+	}
+}
+
+func TestValidatePathParams(t *testing.T) {
+	const fileID = "3f2b8c1e-7d4a-4e5b-9c6d-0a1b2c3d4e5f"
+	tests := []struct {
+		name      string
+		vars      map[string]string
+		wantField string
+	}{
+		{"valid file and chunk", map[string]string{"fileId": fileID, "chunkNumber": "10000"}, ""},
+		{"unknown parameter", map[string]string{"name": "anything"}, ""},
+		{"not a UUID", map[string]string{"id": "../../etc/passwd"}, "id"},
+		{"UUID without hyphens", map[string]string{"id": strings.ReplaceAll(fileID, "-", "")}, "id"},
+		{"braced UUID", map[string]string{"fileId": "{" + fileID + "}"}, "fileId"},
+		{"chunk zero", map[string]string{"id": fileID, "chunkNumber": "0"}, "chunkNumber"},
+		{"chunk past the part limit", map[string]string{"id": fileID, "chunkNumber": "10001"}, "chunkNumber"},
+		{"signed chunk", map[string]string{"id": fileID, "chunkNumber": "+3"}, "chunkNumber"},
+		{"leading zero", map[string]string{"id": fileID, "chunkNumber": "03"}, "chunkNumber"},
+		{"huge chunk", map[string]string{"id": fileID, "chunkNumber": "99999999999999999999"}, "chunkNumber"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidatePathParams(tt.vars)
+			if tt.wantField == "" {
+				if len(errors) != 0 {
+					t.Errorf("ValidatePathParams() = %+v, want no errors", errors)
+				}
+				return
+			}
+			if len(errors) != 1 || errors[0].Field != tt.wantField || errors[0].Code != ErrorCodeInvalidValue {
+				t.Errorf("ValidatePathParams() = %+v, want one error for %s", errors, tt.wantField)
+			}
+		})
+	}
+}
+
 func intPtr(i int64) *int64 {
 	return &i
 }
\ No newline at end of file
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NewWebhookClient creates the client webhook notifiers post with, which gives up on a
+// receiver after 10 seconds
+func NewWebhookClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// PostWebhook posts payload as JSON to url with client, returning an error unless the
+// receiver answers 2xx. The service's alert and notice webhooks put a "text" field in their
+// payloads, which makes them render in Slack-compatible incoming webhooks, next to the
+// fields with the details.
+func PostWebhook(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostWebhook(t *testing.T) {
+	status := http.StatusOK
+	var got map[string]string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	if err := PostWebhook(context.Background(), NewWebhookClient(), receiver.URL, map[string]string{"text": "hello"}); err != nil {
+		t.Fatalf("PostWebhook: %v", err)
+	}
+	if got["text"] != "hello" {
+		t.Errorf("receiver got %v", got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := PostWebhook(context.Background(), NewWebhookClient(), receiver.URL, map[string]string{"text": "hello"}); err == nil {
+		t.Error("a 500 from the receiver wasn't reported")
+	}
+}
@@ -0,0 +1,331 @@
+// The file service's gRPC API, which the gateway can use instead of proxying HTTP (see
+// FILE_SERVICE_PROTOCOL). Regenerate the Go code with `make proto`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: internal/filepb/fileservice.proto
+
+package filepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Request is one call of an operation
+type Request struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The operation's path variables, named as in its file service path, e.g. fileId
+	PathParams map[string]string `protobuf:"bytes,1,rep,name=path_params,json=pathParams,proto3" json:"path_params,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// The raw query string, without the leading "?"
+	Query string `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	// The JSON request body openapi.json describes; empty if the operation takes none
+	Body          []byte `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Request) Reset() {
+	*x = Request{}
+	mi := &file_internal_filepb_fileservice_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Request) ProtoMessage() {}
+
+func (x *Request) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_filepb_fileservice_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Request.ProtoReflect.Descriptor instead.
+func (*Request) Descriptor() ([]byte, []int) {
+	return file_internal_filepb_fileservice_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Request) GetPathParams() map[string]string {
+	if x != nil {
+		return x.PathParams
+	}
+	return nil
+}
+
+func (x *Request) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *Request) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+// Response is the operation's REST response. Errors the operation reports, such as a
+// missing file, are responses too; an RPC fails only if the call couldn't be made.
+type Response struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"` // HTTP status code
+	Headers       []*Header              `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty"`
+	Body          []byte                 `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"` // Usually JSON
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	mi := &file_internal_filepb_fileservice_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_filepb_fileservice_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_internal_filepb_fileservice_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Response) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *Response) GetHeaders() []*Header {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *Response) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type Header struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Header) Reset() {
+	*x = Header{}
+	mi := &file_internal_filepb_fileservice_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Header) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Header) ProtoMessage() {}
+
+func (x *Header) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_filepb_fileservice_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Header.ProtoReflect.Descriptor instead.
+func (*Header) Descriptor() ([]byte, []int) {
+	return file_internal_filepb_fileservice_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Header) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Header) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+var File_internal_filepb_fileservice_proto protoreflect.FileDescriptor
+
+const file_internal_filepb_fileservice_proto_rawDesc = "" +
+	"\n" +
+	"!internal/filepb/fileservice.proto\x12\vvibedrop.v1\"\xb9\x01\n" +
+	"\aRequest\x12E\n" +
+	"\vpath_params\x18\x01 \x03(\v2$.vibedrop.v1.Request.PathParamsEntryR\n" +
+	"pathParams\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x12\n" +
+	"\x04body\x18\x03 \x01(\fR\x04body\x1a=\n" +
+	"\x0fPathParamsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"e\n" +
+	"\bResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\x05R\x06status\x12-\n" +
+	"\aheaders\x18\x02 \x03(\v2\x13.vibedrop.v1.HeaderR\aheaders\x12\x12\n" +
+	"\x04body\x18\x03 \x01(\fR\x04body\"2\n" +
+	"\x06Header\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value2\x92\b\n" +
+	"\vFileService\x127\n" +
+	"\bRegister\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x124\n" +
+	"\x05Login\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12;\n" +
+	"\fRefreshToken\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x125\n" +
+	"\x06Logout\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12@\n" +
+	"\x11CreateScopedToken\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x128\n" +
+	"\tListFiles\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12>\n" +
+	"\x0fCreateUploadURL\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12>\n" +
+	"\x0fListRecentFiles\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x126\n" +
+	"\aGetFile\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12=\n" +
+	"\x0eGetDownloadURL\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x129\n" +
+	"\n" +
+	"ListChunks\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12>\n" +
+	"\x0fGetUploadStatus\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12>\n" +
+	"\x0fRefreshChunkURL\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12<\n" +
+	"\rCompleteChunk\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12=\n" +
+	"\x0eCompleteUpload\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x12:\n" +
+	"\vAbortUpload\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.Response\x129\n" +
+	"\n" +
+	"DeleteFile\x12\x14.vibedrop.v1.Request\x1a\x15.vibedrop.v1.ResponseB\x1bZ\x19vibe-drop/internal/filepbb\x06proto3"
+
+var (
+	file_internal_filepb_fileservice_proto_rawDescOnce sync.Once
+	file_internal_filepb_fileservice_proto_rawDescData []byte
+)
+
+func file_internal_filepb_fileservice_proto_rawDescGZIP() []byte {
+	file_internal_filepb_fileservice_proto_rawDescOnce.Do(func() {
+		file_internal_filepb_fileservice_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_filepb_fileservice_proto_rawDesc), len(file_internal_filepb_fileservice_proto_rawDesc)))
+	})
+	return file_internal_filepb_fileservice_proto_rawDescData
+}
+
+var file_internal_filepb_fileservice_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_internal_filepb_fileservice_proto_goTypes = []any{
+	(*Request)(nil),  // 0: vibedrop.v1.Request
+	(*Response)(nil), // 1: vibedrop.v1.Response
+	(*Header)(nil),   // 2: vibedrop.v1.Header
+	nil,              // 3: vibedrop.v1.Request.PathParamsEntry
+}
+var file_internal_filepb_fileservice_proto_depIdxs = []int32{
+	3,  // 0: vibedrop.v1.Request.path_params:type_name -> vibedrop.v1.Request.PathParamsEntry
+	2,  // 1: vibedrop.v1.Response.headers:type_name -> vibedrop.v1.Header
+	0,  // 2: vibedrop.v1.FileService.Register:input_type -> vibedrop.v1.Request
+	0,  // 3: vibedrop.v1.FileService.Login:input_type -> vibedrop.v1.Request
+	0,  // 4: vibedrop.v1.FileService.RefreshToken:input_type -> vibedrop.v1.Request
+	0,  // 5: vibedrop.v1.FileService.Logout:input_type -> vibedrop.v1.Request
+	0,  // 6: vibedrop.v1.FileService.CreateScopedToken:input_type -> vibedrop.v1.Request
+	0,  // 7: vibedrop.v1.FileService.ListFiles:input_type -> vibedrop.v1.Request
+	0,  // 8: vibedrop.v1.FileService.CreateUploadURL:input_type -> vibedrop.v1.Request
+	0,  // 9: vibedrop.v1.FileService.ListRecentFiles:input_type -> vibedrop.v1.Request
+	0,  // 10: vibedrop.v1.FileService.GetFile:input_type -> vibedrop.v1.Request
+	0,  // 11: vibedrop.v1.FileService.GetDownloadURL:input_type -> vibedrop.v1.Request
+	0,  // 12: vibedrop.v1.FileService.ListChunks:input_type -> vibedrop.v1.Request
+	0,  // 13: vibedrop.v1.FileService.GetUploadStatus:input_type -> vibedrop.v1.Request
+	0,  // 14: vibedrop.v1.FileService.RefreshChunkURL:input_type -> vibedrop.v1.Request
+	0,  // 15: vibedrop.v1.FileService.CompleteChunk:input_type -> vibedrop.v1.Request
+	0,  // 16: vibedrop.v1.FileService.CompleteUpload:input_type -> vibedrop.v1.Request
+	0,  // 17: vibedrop.v1.FileService.AbortUpload:input_type -> vibedrop.v1.Request
+	0,  // 18: vibedrop.v1.FileService.DeleteFile:input_type -> vibedrop.v1.Request
+	1,  // 19: vibedrop.v1.FileService.Register:output_type -> vibedrop.v1.Response
+	1,  // 20: vibedrop.v1.FileService.Login:output_type -> vibedrop.v1.Response
+	1,  // 21: vibedrop.v1.FileService.RefreshToken:output_type -> vibedrop.v1.Response
+	1,  // 22: vibedrop.v1.FileService.Logout:output_type -> vibedrop.v1.Response
+	1,  // 23: vibedrop.v1.FileService.CreateScopedToken:output_type -> vibedrop.v1.Response
+	1,  // 24: vibedrop.v1.FileService.ListFiles:output_type -> vibedrop.v1.Response
+	1,  // 25: vibedrop.v1.FileService.CreateUploadURL:output_type -> vibedrop.v1.Response
+	1,  // 26: vibedrop.v1.FileService.ListRecentFiles:output_type -> vibedrop.v1.Response
+	1,  // 27: vibedrop.v1.FileService.GetFile:output_type -> vibedrop.v1.Response
+	1,  // 28: vibedrop.v1.FileService.GetDownloadURL:output_type -> vibedrop.v1.Response
+	1,  // 29: vibedrop.v1.FileService.ListChunks:output_type -> vibedrop.v1.Response
+	1,  // 30: vibedrop.v1.FileService.GetUploadStatus:output_type -> vibedrop.v1.Response
+	1,  // 31: vibedrop.v1.FileService.RefreshChunkURL:output_type -> vibedrop.v1.Response
+	1,  // 32: vibedrop.v1.FileService.CompleteChunk:output_type -> vibedrop.v1.Response
+	1,  // 33: vibedrop.v1.FileService.CompleteUpload:output_type -> vibedrop.v1.Response
+	1,  // 34: vibedrop.v1.FileService.AbortUpload:output_type -> vibedrop.v1.Response
+	1,  // 35: vibedrop.v1.FileService.DeleteFile:output_type -> vibedrop.v1.Response
+	19, // [19:36] is the sub-list for method output_type
+	2,  // [2:19] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_internal_filepb_fileservice_proto_init() }
+func file_internal_filepb_fileservice_proto_init() {
+	if File_internal_filepb_fileservice_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_filepb_fileservice_proto_rawDesc), len(file_internal_filepb_fileservice_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_filepb_fileservice_proto_goTypes,
+		DependencyIndexes: file_internal_filepb_fileservice_proto_depIdxs,
+		MessageInfos:      file_internal_filepb_fileservice_proto_msgTypes,
+	}.Build()
+	File_internal_filepb_fileservice_proto = out.File
+	file_internal_filepb_fileservice_proto_goTypes = nil
+	file_internal_filepb_fileservice_proto_depIdxs = nil
+}
@@ -0,0 +1,128 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+const (
+	mb = 1024 * 1024
+	gb = 1024 * mb
+)
+
+// sizeBuckets defines the size histogram boundaries shown on dashboards
+var sizeBuckets = []storage.HistogramBucket{
+	{Label: "<1MB", MinBytes: 0, MaxBytes: mb},
+	{Label: "1MB-10MB", MinBytes: mb, MaxBytes: 10 * mb},
+	{Label: "10MB-100MB", MinBytes: 10 * mb, MaxBytes: 100 * mb},
+	{Label: "100MB-1GB", MinBytes: 100 * mb, MaxBytes: gb},
+	{Label: "1GB-5GB", MinBytes: gb, MaxBytes: 5 * gb},
+	{Label: ">=5GB", MinBytes: 5 * gb},
+}
+
+// Aggregator recomputes per-user storage analytics snapshots; the scheduler runs it periodically
+type Aggregator struct {
+	dynamoClient   storage.MetadataStore
+	stuckThreshold time.Duration // Uploads older than this still "uploading" are reported as stuck
+}
+
+// NewAggregator creates an aggregator
+func NewAggregator(dynamoClient storage.MetadataStore, stuckThreshold time.Duration) *Aggregator {
+	return &Aggregator{
+		dynamoClient:   dynamoClient,
+		stuckThreshold: stuckThreshold,
+	}
+}
+
+// RunOnce computes and stores a fresh snapshot for every user with files, plus system-wide metrics
+func (a *Aggregator) RunOnce(ctx context.Context) error {
+	files, err := a.dynamoClient.ListAllFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	system := ComputeSystemMetrics(files, now, a.stuckThreshold)
+	system.ComputedAt = now.Format(time.RFC3339)
+	if err := a.dynamoClient.SaveSystemMetrics(ctx, system); err != nil {
+		log.Printf("Warning: Failed to save system metrics: %v", err)
+	}
+
+	byUser := make(map[string][]storage.FileMetadata)
+	for _, file := range files {
+		byUser[file.UserID] = append(byUser[file.UserID], file)
+	}
+
+	computedAt := now.Format(time.RFC3339)
+	for userID, userFiles := range byUser {
+		snapshot := ComputeUserAnalytics(userID, userFiles)
+		snapshot.ComputedAt = computedAt
+		if err := a.dynamoClient.SaveUserAnalytics(ctx, snapshot); err != nil {
+			log.Printf("Warning: Failed to save analytics for user %s: %v", userID, err)
+		}
+	}
+
+	log.Printf("Analytics aggregation complete: %d files across %d users", len(files), len(byUser))
+	return nil
+}
+
+// ComputeUserAnalytics builds the content type breakdown, size histogram and growth series for a user's files
+func ComputeUserAnalytics(userID string, files []storage.FileMetadata) *storage.UserAnalytics {
+	analytics := &storage.UserAnalytics{
+		UserID:        userID,
+		ByContentType: make(map[string]storage.ContentTypeStats),
+		SizeHistogram: make([]storage.HistogramBucket, len(sizeBuckets)),
+	}
+	copy(analytics.SizeHistogram, sizeBuckets)
+
+	daily := make(map[string]*storage.GrowthPoint)
+	for _, file := range files {
+		analytics.TotalBytes += file.TotalSize
+		analytics.FileCount++
+
+		stats := analytics.ByContentType[file.ContentType]
+		stats.Count++
+		stats.Bytes += file.TotalSize
+		analytics.ByContentType[file.ContentType] = stats
+
+		for i := range analytics.SizeHistogram {
+			bucket := &analytics.SizeHistogram[i]
+			if file.TotalSize >= bucket.MinBytes && (bucket.MaxBytes == 0 || file.TotalSize < bucket.MaxBytes) {
+				bucket.Count++
+				break
+			}
+		}
+
+		uploadedAt, err := time.Parse(time.RFC3339, file.UploadedAt)
+		if err != nil {
+			continue
+		}
+		date := uploadedAt.UTC().Format("2006-01-02")
+		point, ok := daily[date]
+		if !ok {
+			point = &storage.GrowthPoint{Date: date}
+			daily[date] = point
+		}
+		point.FilesAdded++
+		point.BytesAdded += file.TotalSize
+	}
+
+	for _, point := range daily {
+		analytics.Growth = append(analytics.Growth, *point)
+	}
+	sort.Slice(analytics.Growth, func(i, j int) bool {
+		return analytics.Growth[i].Date < analytics.Growth[j].Date
+	})
+
+	var cumulative int64
+	for i := range analytics.Growth {
+		cumulative += analytics.Growth[i].BytesAdded
+		analytics.Growth[i].CumulativeBytes = cumulative
+	}
+
+	return analytics
+}
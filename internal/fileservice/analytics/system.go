@@ -0,0 +1,136 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+const (
+	// uploadsPerDayWindow is how many days of upload counts are reported
+	uploadsPerDayWindow = 30
+	// topUsersLimit is how many users are included in the top-by-storage list
+	topUsersLimit = 10
+)
+
+// ComputeSystemMetrics summarises operational metrics across all files
+func ComputeSystemMetrics(files []storage.FileMetadata, now time.Time, stuckThreshold time.Duration) *storage.SystemMetrics {
+	metrics := &storage.SystemMetrics{}
+
+	windowStart := now.AddDate(0, 0, -(uploadsPerDayWindow - 1)).UTC().Format("2006-01-02")
+	perDay := make(map[string]int)
+	perUser := make(map[string]*storage.UserStorage)
+	perClient := make(map[common.ClientInfo]*clientUsage)
+
+	for _, file := range files {
+		metrics.TotalBytes += file.TotalSize
+		metrics.TotalFiles++
+
+		usage, ok := perUser[file.UserID]
+		if !ok {
+			usage = &storage.UserStorage{UserID: file.UserID}
+			perUser[file.UserID] = usage
+		}
+		usage.TotalBytes += file.TotalSize
+		usage.FileCount++
+
+		if file.Status == storage.FileStatusCompletionFailed {
+			metrics.FailedCompletions++
+		}
+
+		uploadedAt, err := time.Parse(time.RFC3339, file.UploadedAt)
+		if err != nil {
+			continue
+		}
+
+		if date := uploadedAt.UTC().Format("2006-01-02"); date >= windowStart {
+			perDay[date]++
+			if file.Client == nil {
+				metrics.UnidentifiedUploads++
+			} else {
+				countClientUpload(perClient, file)
+			}
+		}
+
+		if file.Status == storage.FileStatusUploading && now.Sub(uploadedAt) > stuckThreshold {
+			metrics.StuckUploads = append(metrics.StuckUploads, storage.StuckUpload{
+				FileID:     file.FileID,
+				UserID:     file.UserID,
+				UploadType: file.UploadType,
+				UploadedAt: file.UploadedAt,
+			})
+		}
+	}
+
+	metrics.TotalUsers = len(perUser)
+
+	for date, count := range perDay {
+		metrics.UploadsPerDay = append(metrics.UploadsPerDay, storage.DailyCount{Date: date, Count: count})
+	}
+	sort.Slice(metrics.UploadsPerDay, func(i, j int) bool {
+		return metrics.UploadsPerDay[i].Date < metrics.UploadsPerDay[j].Date
+	})
+
+	sort.Slice(metrics.StuckUploads, func(i, j int) bool {
+		return metrics.StuckUploads[i].UploadedAt < metrics.StuckUploads[j].UploadedAt
+	})
+
+	metrics.ClientVersions = clientVersions(perClient)
+
+	for _, usage := range perUser {
+		metrics.TopUsers = append(metrics.TopUsers, *usage)
+	}
+	sort.Slice(metrics.TopUsers, func(i, j int) bool {
+		return metrics.TopUsers[i].TotalBytes > metrics.TopUsers[j].TotalBytes
+	})
+	if len(metrics.TopUsers) > topUsersLimit {
+		metrics.TopUsers = metrics.TopUsers[:topUsersLimit]
+	}
+
+	return metrics
+}
+
+// clientUsage accumulates one client version's uploads
+type clientUsage struct {
+	usage storage.ClientVersionUsage
+	users map[string]bool
+}
+
+func countClientUpload(perClient map[common.ClientInfo]*clientUsage, file storage.FileMetadata) {
+	client := *file.Client
+	c, ok := perClient[client]
+	if !ok {
+		c = &clientUsage{
+			usage: storage.ClientVersionUsage{App: client.App, Version: client.Version, Platform: client.Platform},
+			users: make(map[string]bool),
+		}
+		perClient[client] = c
+	}
+	c.usage.Uploads++
+	c.users[file.UserID] = true
+	if file.UploadedAt > c.usage.LastSeenAt {
+		c.usage.LastSeenAt = file.UploadedAt
+	}
+}
+
+// clientVersions lists the counted client versions by app, then version, then platform
+func clientVersions(perClient map[common.ClientInfo]*clientUsage) []storage.ClientVersionUsage {
+	versions := make([]storage.ClientVersionUsage, 0, len(perClient))
+	for _, c := range perClient {
+		c.usage.Users = len(c.users)
+		versions = append(versions, c.usage)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := versions[i], versions[j]
+		if a.App != b.App {
+			return a.App < b.App
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Platform < b.Platform
+	})
+	return versions
+}
@@ -0,0 +1,282 @@
+// Package anomaly flags unusual per-user activity, such as one account issuing thousands of
+// download URLs or deleting files en masse, and locks the watched actions for that account
+// until the lock expires or the user signs in again.
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+)
+
+// Actions the detector can watch
+const (
+	ActionDownloadURL = "download_url"
+	ActionDelete      = "delete"
+)
+
+// maxEvents caps how many detections are kept for the admin endpoint
+const maxEvents = 200
+
+// Rule flags a user who performs Action more than Limit times within Window
+type Rule struct {
+	Action string
+	Limit  int
+	Window time.Duration
+}
+
+// Event is one detection
+type Event struct {
+	UserID      string    `json:"user_id"`
+	Action      string    `json:"action"`
+	Count       int       `json:"count"`  // Actions seen within the window, including the one that tripped the rule
+	Window      string    `json:"window"` // The rule's window, e.g. "1h0m0s"
+	DetectedAt  time.Time `json:"detected_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Lock blocks a user's watched actions until LockedUntil or a fresh sign-in
+type Lock struct {
+	UserID      string    `json:"user_id"`
+	Action      string    `json:"action"` // The action that tripped the lock
+	LockedAt    time.Time `json:"locked_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Notifier is told about each detection, e.g. to alert admins. It is called in its own
+// goroutine so a slow notifier never delays the request.
+type Notifier interface {
+	Notify(ctx context.Context, event Event)
+}
+
+// Detector counts watched actions per user in sliding windows. Counters and locks live in
+// process memory, so each replica detects on the traffic it serves.
+type Detector struct {
+	rules     map[string]Rule
+	lockFor   time.Duration
+	notifiers []Notifier
+	now       func() time.Time
+
+	mu     sync.Mutex
+	hits   map[string][]time.Time // keyed by user ID and action, oldest first
+	locks  map[string]Lock        // keyed by user ID
+	events []Event                // oldest first
+}
+
+// NewDetector creates a detector that locks a flagged user for lockFor
+func NewDetector(lockFor time.Duration, rules ...Rule) *Detector {
+	d := &Detector{
+		rules:   make(map[string]Rule, len(rules)),
+		lockFor: lockFor,
+		now:     time.Now,
+		hits:    make(map[string][]time.Time),
+		locks:   make(map[string]Lock),
+	}
+	for _, rule := range rules {
+		d.rules[rule.Action] = rule
+	}
+	return d
+}
+
+// OnDetection registers a notifier for future detections
+func (d *Detector) OnDetection(n Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append(d.notifiers, n)
+}
+
+// Record counts one action by the user. It reports the detection when the action pushes
+// the user over the rule's limit; the user is then locked.
+func (d *Detector) Record(userID, action string) (Event, bool) {
+	return d.RecordN(userID, action, 1)
+}
+
+// RecordN counts n actions by the user at once, such as the files of a batch delete, and
+// reports the detection as Record does
+func (d *Detector) RecordN(userID, action string, n int) (Event, bool) {
+	rule, ok := d.rules[action]
+	if !ok || n < 1 {
+		return Event{}, false
+	}
+
+	d.mu.Lock()
+	now := d.now()
+	key := userID + "|" + action
+	hits := d.hits[key]
+	cutoff := now.Add(-rule.Window)
+	for len(hits) > 0 && !hits[0].After(cutoff) {
+		hits = hits[1:]
+	}
+	for i := 0; i < n; i++ {
+		hits = append(hits, now)
+	}
+	d.hits[key] = hits
+
+	if len(hits) <= rule.Limit {
+		d.mu.Unlock()
+		return Event{}, false
+	}
+	if lock, locked := d.locks[userID]; locked && now.Before(lock.LockedUntil) {
+		d.mu.Unlock()
+		return Event{}, false // Already flagged; don't alert on every blocked attempt
+	}
+
+	event := Event{
+		UserID:      userID,
+		Action:      action,
+		Count:       len(hits),
+		Window:      rule.Window.String(),
+		DetectedAt:  now,
+		LockedUntil: now.Add(d.lockFor),
+	}
+	d.locks[userID] = Lock{UserID: userID, Action: action, LockedAt: now, LockedUntil: event.LockedUntil}
+	d.events = append(d.events, event)
+	if len(d.events) > maxEvents {
+		d.events = d.events[len(d.events)-maxEvents:]
+	}
+	notifiers := d.notifiers
+	d.mu.Unlock()
+
+	log.Printf("Anomaly: user %s performed %s %d times within %s; locked until %s",
+		userID, action, event.Count, event.Window, event.LockedUntil.Format(time.RFC3339))
+	for _, n := range notifiers {
+		go n.Notify(context.Background(), event)
+	}
+	return event, true
+}
+
+// Check returns the user's lock while it is in force
+func (d *Detector) Check(userID string) (Lock, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lock, ok := d.locks[userID]
+	if !ok {
+		return Lock{}, false
+	}
+	if !d.now().Before(lock.LockedUntil) {
+		delete(d.locks, userID)
+		return Lock{}, false
+	}
+	return lock, true
+}
+
+// Unlock lifts the user's lock and clears their counters. It reports whether a lock was in force.
+func (d *Detector) Unlock(userID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lock, ok := d.locks[userID]
+	delete(d.locks, userID)
+	for action := range d.rules {
+		delete(d.hits, userID+"|"+action)
+	}
+	return ok && d.now().Before(lock.LockedUntil)
+}
+
+// Events returns the recent detections, newest first
+func (d *Detector) Events() []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	events := make([]Event, len(d.events))
+	for i, event := range d.events {
+		events[len(d.events)-1-i] = event
+	}
+	return events
+}
+
+// Locks returns the locks in force, soonest to expire first
+func (d *Detector) Locks() []Lock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	locks := make([]Lock, 0, len(d.locks))
+	for _, lock := range d.locks {
+		if now.Before(lock.LockedUntil) {
+			locks = append(locks, lock)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].LockedUntil.Before(locks[j].LockedUntil) })
+	return locks
+}
+
+// Middleware watches action on the wrapped route. It must run after auth.AuthMiddleware.
+// A locked user is rejected unless they present a full-access token issued after the lock,
+// i.e. they have signed in again (step-up); that lifts the lock.
+func (d *Detector) Middleware(action string) func(http.Handler) http.Handler {
+	return d.middleware(action)
+}
+
+// LockMiddleware rejects locked users as Middleware does, without counting the request. It
+// is for routes whose handler counts its actions itself with RecordN and rejects the request
+// with WriteLocked on a detection.
+func (d *Detector) LockMiddleware() func(http.Handler) http.Handler {
+	return d.middleware("")
+}
+
+// middleware checks the lock and, unless action is empty, counts the request
+func (d *Detector) middleware(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := auth.GetUserIDFromContext(r.Context())
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if lock, locked := d.Check(userID); locked {
+				if !steppedUp(r, lock) {
+					writeLocked(w, lock, d.now())
+					return
+				}
+				d.Unlock(userID)
+				log.Printf("Anomaly: user %s re-authenticated; lock lifted", userID)
+			}
+
+			if action == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, detected := d.Record(userID, action); detected {
+				lock, _ := d.Check(userID)
+				writeLocked(w, lock, d.now())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// steppedUp reports whether the request's token comes from a sign-in newer than the lock.
+// Scoped tokens don't count, since any full-access token can mint them, and neither do
+// refreshed tokens, which keep the time of the original sign-in.
+func steppedUp(r *http.Request, lock Lock) bool {
+	if len(auth.GetScopesFromContext(r.Context())) > 0 {
+		return false
+	}
+	authTime, ok := auth.GetAuthTimeFromContext(r.Context())
+	return ok && authTime.After(lock.LockedAt)
+}
+
+// WriteLocked rejects a request whose actions led to event, with the user now locked
+func (d *Detector) WriteLocked(w http.ResponseWriter, event Event) {
+	writeLocked(w, Lock{UserID: event.UserID, Action: event.Action, LockedAt: event.DetectedAt, LockedUntil: event.LockedUntil}, d.now())
+}
+
+func writeLocked(w http.ResponseWriter, lock Lock, now time.Time) {
+	retryAfter := int(math.Ceil(lock.LockedUntil.Sub(now).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	common.WriteErrorResponse(w, http.StatusForbidden, common.ErrorCodeReauthenticationRequired,
+		"Unusual activity detected; sign in again to continue",
+		fmt.Sprintf("Too many %s requests; locked until %s unless you sign in again", lock.Action, lock.LockedUntil.Format(time.RFC3339)))
+}
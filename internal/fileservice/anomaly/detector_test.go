@@ -0,0 +1,87 @@
+package anomaly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/auth"
+)
+
+func TestDetectorLocksUntilSignIn(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDetector(time.Hour, Rule{Action: ActionDelete, Limit: 2, Window: time.Minute})
+	d.now = func() time.Time { return now }
+
+	calls := 0
+	handler := d.Middleware(ActionDelete)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	refreshedAt := time.Time{}
+	request := func(issuedAt time.Time, scopes []string) int {
+		ctx := context.WithValue(context.Background(), auth.UserIDKey, "user-1")
+		ctx = context.WithValue(ctx, auth.IssuedAtKey, issuedAt)
+		ctx = context.WithValue(ctx, auth.ScopesKey, scopes)
+		if !refreshedAt.IsZero() {
+			ctx = context.WithValue(ctx, auth.IssuedAtKey, refreshedAt)
+			ctx = context.WithValue(ctx, auth.AuthTimeKey, issuedAt)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil).WithContext(ctx))
+		return rec.Code
+	}
+
+	oldToken := now.Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		if code := request(oldToken, nil); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200 within the limit", i+1, code)
+		}
+	}
+	if code := request(oldToken, nil); code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 once over the limit", code)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+	if events := d.Events(); len(events) != 1 || events[0].Count != 3 {
+		t.Errorf("events = %+v, want one detection of 3 deletes", events)
+	}
+
+	// Old, scoped and refreshed tokens stay locked out; a fresh sign-in lifts the lock
+	now = now.Add(time.Second)
+	if code := request(oldToken, nil); code != http.StatusForbidden {
+		t.Errorf("old token: status = %d, want 403", code)
+	}
+	if code := request(now, []string{auth.ScopeFilesWrite}); code != http.StatusForbidden {
+		t.Errorf("scoped token: status = %d, want 403", code)
+	}
+	refreshedAt = now
+	if code := request(oldToken, nil); code != http.StatusForbidden {
+		t.Errorf("refreshed token: status = %d, want 403", code)
+	}
+	refreshedAt = time.Time{}
+	if code := request(now, nil); code != http.StatusOK {
+		t.Errorf("fresh sign-in: status = %d, want 200", code)
+	}
+	if locks := d.Locks(); len(locks) != 0 {
+		t.Errorf("locks = %+v, want none after sign-in", locks)
+	}
+}
+
+func TestDetectorWindowSlides(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDetector(time.Hour, Rule{Action: ActionDownloadURL, Limit: 2, Window: time.Minute})
+	d.now = func() time.Time { return now }
+
+	d.Record("user-1", ActionDownloadURL)
+	d.Record("user-1", ActionDownloadURL)
+	now = now.Add(2 * time.Minute)
+	if _, detected := d.Record("user-1", ActionDownloadURL); detected {
+		t.Error("detected after the earlier requests left the window")
+	}
+	if _, detected := d.Record("user-2", ActionDelete); detected {
+		t.Error("detected an action without a rule")
+	}
+}
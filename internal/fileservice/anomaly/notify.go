@@ -0,0 +1,34 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+)
+
+// WebhookNotifier posts each detection as JSON to an admin alert webhook, with the
+// detection in "event"
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: common.NewWebhookClient()}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) {
+	err := common.PostWebhook(ctx, n.client, n.url, map[string]interface{}{
+		"text": fmt.Sprintf("Anomaly: user %s performed %s %d times within %s; locked until %s",
+			event.UserID, event.Action, event.Count, event.Window, event.LockedUntil.Format(time.RFC3339)),
+		"event": event,
+	})
+	if err != nil {
+		log.Printf("Failed to send anomaly alert: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package callbacks tells API key integrations when the uploads they started complete, so
+// partner backends needn't poll. Each key may register one URL, which is sent a signed
+// upload.completed event for every upload made with the key.
+package callbacks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// Headers each delivery is sent with
+const (
+	SignatureHeader = "X-Vibe-Drop-Signature"
+	EventHeader     = "X-Vibe-Drop-Event"
+	DeliveryHeader  = "X-Vibe-Drop-Delivery"
+)
+
+// EventUploadCompleted is the type of the event sent when an upload completes
+const EventUploadCompleted = "upload.completed"
+
+// Store is where the callbacks are registered.
+// storage.MetadataStore implements it.
+type Store interface {
+	GetUploadCallback(ctx context.Context, apiKeyID string) (*storage.UploadCallback, error)
+}
+
+// Objects opens uploaded files, to checksum those that didn't declare one.
+// storage.BlobStore implements it.
+type Objects interface {
+	OpenObject(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error)
+}
+
+var (
+	_ Store   = storage.MetadataStore(nil)
+	_ Objects = storage.BlobStore(nil)
+)
+
+// Event is the JSON body of a delivery
+type Event struct {
+	Type              string    `json:"type"`
+	DeliveryID        string    `json:"delivery_id"`
+	APIKeyID          string    `json:"api_key_id"`
+	FileID            string    `json:"file_id"`
+	Filename          string    `json:"filename"`
+	Size              int64     `json:"size"`
+	ContentType       string    `json:"content_type"`
+	ChecksumAlgorithm string    `json:"checksum_algorithm,omitempty"`
+	Checksum          string    `json:"checksum,omitempty"` // Base64 encoded
+	CompletedAt       time.Time `json:"completed_at"`
+}
+
+// Secret is the key callback's deliveries are signed with, derived from the deployment's
+// key so it needn't be stored. Registering the URL again draws a new nonce, which rotates it.
+func Secret(key []byte, callback *storage.UploadCallback) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(callback.APIKeyID + ":" + callback.Nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign is the signature header value for body sent at t: the Unix time and the hex HMAC-SHA256
+// of "<time>.<body>" with secret, as "t=<time>,v1=<signature>". Receivers recompute it and
+// should reject old timestamps, so a captured delivery can't be replayed.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckURL validates a callback URL: absolute and https, or http too if allowHTTP is set.
+// A host that is an internal address, or localhost, is refused; names that resolve to one
+// are refused when a delivery dials them.
+func CheckURL(raw string, allowHTTP bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && allowHTTP:
+	default:
+		return errors.New("must be an https URL")
+	}
+	if u.User != nil {
+		return errors.New("must not contain credentials")
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("must not point at an internal address")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return errors.New("must not point at an internal address")
+	}
+	return nil
+}
+
+// publicAddr reports whether deliveries may be sent to addr: not loopback, private,
+// link-local or unspecified, so a callback can't reach the service's own network or the
+// cloud metadata endpoint
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified())
+}
+
+// newDeliveryClient is the client deliveries are sent with. It only connects to addresses
+// allowed reports true for, checked after DNS resolution so a name can't be pointed at an
+// internal address, and doesn't follow redirects, so a receiver can't bounce a delivery to one.
+func newDeliveryClient(allowed func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !allowed(addr) {
+				return fmt.Errorf("refusing to deliver to internal address %s", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would dial the receiver for us, unchecked
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// defaultRetryDelays are the waits before each retry of a delivery that failed
+var defaultRetryDelays = []time.Duration{time.Second, 10 * time.Second, time.Minute}
+
+// Notifier delivers upload.completed events. Delivery is at least once: a receiver that
+// doesn't answer with a 2xx within the timeout is sent the event again, so receivers should
+// deduplicate by file_id. Events aren't persisted; one whose retries run out, or that is
+// pending when the service stops, is logged and dropped. A nil *Notifier sends nothing.
+type Notifier struct {
+	store       Store
+	objects     Objects
+	key         []byte
+	client      *http.Client
+	retryDelays []time.Duration
+	now         func() time.Time
+}
+
+// NewNotifier creates a notifier that looks callbacks up in store and signs with key
+func NewNotifier(store Store, objects Objects, key []byte) *Notifier {
+	return &Notifier{
+		store:       store,
+		objects:     objects,
+		key:         key,
+		client:      newDeliveryClient(publicAddr),
+		retryDelays: defaultRetryDelays,
+		now:         time.Now,
+	}
+}
+
+// UploadCompleted sends the event for metadata's upload to its API key's callback, if the
+// upload was made with a key that has one. It returns at once; delivery happens in the
+// background.
+func (n *Notifier) UploadCompleted(ctx context.Context, metadata *storage.FileMetadata) {
+	if n == nil || metadata.APIKeyID == "" {
+		return
+	}
+	completed := *metadata
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := n.deliver(ctx, &completed); err != nil {
+			common.Logger(ctx).Warn("Failed to deliver upload callback", "file_id", completed.FileID, "api_key_id", completed.APIKeyID, "error", err)
+		}
+	}()
+}
+
+// deliver sends the event for metadata, retrying until it is accepted or the retries run out
+func (n *Notifier) deliver(ctx context.Context, metadata *storage.FileMetadata) error {
+	callback, err := n.store.GetUploadCallback(ctx, metadata.APIKeyID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// A key is only ever its user's, but a callback registered before the key was reissued
+	// to someone else mustn't hear about their uploads
+	if callback.UserID != metadata.UserID {
+		return nil
+	}
+
+	event, err := n.event(ctx, metadata)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload callback: %w", err)
+	}
+	secret := Secret(n.key, callback)
+
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, callback.URL, secret, event.DeliveryID, body)
+		if err == nil {
+			return nil
+		}
+		if attempt == len(n.retryDelays) {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt+1, err)
+		}
+		common.Logger(ctx).Info("Retrying upload callback", "file_id", metadata.FileID, "attempt", attempt+1, "error", err)
+		time.Sleep(n.retryDelays[attempt])
+	}
+}
+
+// event describes metadata's upload, checksumming the file if the upload didn't declare one
+func (n *Notifier) event(ctx context.Context, metadata *storage.FileMetadata) (*Event, error) {
+	event := &Event{
+		Type:              EventUploadCompleted,
+		DeliveryID:        uuid.New().String(),
+		APIKeyID:          metadata.APIKeyID,
+		FileID:            metadata.FileID,
+		Filename:          metadata.Filename,
+		Size:              metadata.TotalSize,
+		ContentType:       metadata.ContentType,
+		ChecksumAlgorithm: metadata.ChecksumAlgorithm,
+		Checksum:          metadata.Checksum,
+		CompletedAt:       n.now().UTC(),
+	}
+	if metadata.CompletedAt != nil {
+		if completedAt, err := time.Parse(time.RFC3339, *metadata.CompletedAt); err == nil {
+			event.CompletedAt = completedAt
+		}
+	}
+	if event.Checksum != "" {
+		return event, nil
+	}
+
+	object, err := n.objects.OpenObject(ctx, metadata.Bucket, metadata.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file to checksum it: %w", err)
+	}
+	defer object.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object); err != nil {
+		return nil, fmt.Errorf("failed to checksum file: %w", err)
+	}
+	event.ChecksumAlgorithm = storage.ChecksumSHA256
+	event.Checksum = base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	return event, nil
+}
+
+// post makes one delivery attempt
+func (n *Notifier) post(ctx context.Context, url, secret, deliveryID string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build upload callback: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, EventUploadCompleted)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(secret, n.now(), body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
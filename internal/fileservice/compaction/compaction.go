@@ -0,0 +1,137 @@
+// Package compaction rolls a completed multipart upload's chunk records into a summary on
+// its file metadata and then lets the records expire, so the chunks table doesn't keep a
+// record for every part of every file ever uploaded.
+package compaction
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// MetadataStore is the persistence expiring compacted chunk records needs
+type MetadataStore interface {
+	SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error
+	ExpireFileChunks(ctx context.Context, fileID string, expiresAt time.Time) error
+}
+
+// Summarize rolls a completed upload's chunk records up into the summary kept on its file
+func Summarize(chunks []storage.FileChunk, now time.Time) *storage.ChunkSummary {
+	summary := &storage.ChunkSummary{Chunks: len(chunks), CompactedAt: now.Format(time.RFC3339)}
+	var first, last time.Time
+	for _, chunk := range chunks {
+		summary.TotalSize += chunk.Size
+		uploadedAt, err := time.Parse(time.RFC3339, chunk.UploadedAt)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || uploadedAt.Before(first) {
+			first, summary.FirstUploadedAt = uploadedAt, chunk.UploadedAt
+		}
+		if uploadedAt.After(last) {
+			last, summary.LastUploadedAt = uploadedAt, chunk.UploadedAt
+		}
+	}
+	return summary
+}
+
+// ExpireRecords sets a compacted file's chunk records to expire retention after now and
+// notes when on its summary. The summary must already be saved, so the file is never left
+// without both.
+func ExpireRecords(ctx context.Context, dynamoClient MetadataStore, metadata *storage.FileMetadata, retention time.Duration, now time.Time) error {
+	if metadata.ChunkSummary == nil {
+		return fmt.Errorf("file %s has no chunk summary", metadata.FileID)
+	}
+
+	expiresAt := now.Add(retention)
+	if err := dynamoClient.ExpireFileChunks(ctx, metadata.FileID, expiresAt); err != nil {
+		return err
+	}
+	metadata.ChunkSummary.RecordsExpireAt = expiresAt.Format(time.RFC3339)
+	return dynamoClient.SaveFileMetadata(ctx, metadata)
+}
+
+// Compactor compacts the completed uploads the completion handler didn't, such as those
+// completed before compaction existed or whose records failed to expire, and purges
+// expired records from stores without a TTL; the scheduler runs it
+type Compactor struct {
+	dynamoClient storage.MetadataStore
+	retention    time.Duration
+}
+
+// NewCompactor creates a compactor. Chunk records expire retention after compaction; 0
+// keeps them.
+func NewCompactor(dynamoClient storage.MetadataStore, retention time.Duration) *Compactor {
+	return &Compactor{
+		dynamoClient: dynamoClient,
+		retention:    retention,
+	}
+}
+
+// RunOnce compacts every uncompacted upload, then purges expired chunk records. A failed
+// compaction is logged and retried on the next run rather than stopping the others.
+func (c *Compactor) RunOnce(ctx context.Context) error {
+	files, err := c.dynamoClient.ListAllFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	compacted, failed := 0, 0
+	for _, file := range Uncompacted(files, c.retention) {
+		if err := c.compact(ctx, &file, now); err != nil {
+			log.Printf("Compaction failed for file %s: %v", file.FileID, err)
+			failed++
+			continue
+		}
+		compacted++
+	}
+
+	purged, err := c.dynamoClient.PurgeExpiredChunks(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	if compacted > 0 || failed > 0 || purged > 0 {
+		log.Printf("Compaction summarized %d completed uploads (%d failed) and purged %d expired chunk records", compacted, failed, purged)
+	}
+	return nil
+}
+
+func (c *Compactor) compact(ctx context.Context, file *storage.FileMetadata, now time.Time) error {
+	if file.ChunkSummary == nil {
+		chunks, err := c.dynamoClient.GetFileChunks(ctx, file.FileID)
+		if err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return fmt.Errorf("no chunk records to summarize")
+		}
+		file.ChunkSummary = Summarize(chunks, now)
+		if err := c.dynamoClient.SaveFileMetadata(ctx, file); err != nil {
+			return err
+		}
+	}
+	if c.retention > 0 {
+		return ExpireRecords(ctx, c.dynamoClient, file, c.retention, now)
+	}
+	return nil
+}
+
+// Uncompacted returns the completed multipart uploads with no chunk summary yet, or, when
+// records are to expire, whose records haven't been set to
+func Uncompacted(files []storage.FileMetadata, retention time.Duration) []storage.FileMetadata {
+	var uncompacted []storage.FileMetadata
+	for _, file := range files {
+		if file.UploadType != "multipart" || file.Status != storage.FileStatusCompleted {
+			continue
+		}
+		if file.ChunkSummary == nil || (retention > 0 && file.ChunkSummary.RecordsExpireAt == "") {
+			uncompacted = append(uncompacted, file)
+		}
+	}
+	return uncompacted
+}
@@ -0,0 +1,54 @@
+package compaction
+
+import (
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+func TestSummarize(t *testing.T) {
+	now := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	chunks := []storage.FileChunk{
+		{ChunkNumber: 2, Size: 5, UploadedAt: "2025-06-01T12:10:00+02:00"},
+		{ChunkNumber: 1, Size: 5, UploadedAt: "2025-06-01T11:00:00Z"},
+		{ChunkNumber: 3, Size: 2, UploadedAt: "2025-06-01T11:30:00Z"},
+	}
+
+	summary := Summarize(chunks, now)
+	if summary.Chunks != 3 || summary.TotalSize != 12 {
+		t.Errorf("summary = %d chunks, %d bytes, want 3 chunks, 12 bytes", summary.Chunks, summary.TotalSize)
+	}
+	// Compared as times, not strings: 12:10+02:00 is the earliest
+	if summary.FirstUploadedAt != "2025-06-01T12:10:00+02:00" || summary.LastUploadedAt != "2025-06-01T11:30:00Z" {
+		t.Errorf("uploaded between %s and %s, want 12:10+02:00 and 11:30Z", summary.FirstUploadedAt, summary.LastUploadedAt)
+	}
+}
+
+func TestUncompacted(t *testing.T) {
+	summarized := &storage.ChunkSummary{Chunks: 1}
+	expiring := &storage.ChunkSummary{Chunks: 1, RecordsExpireAt: "2025-06-08T00:00:00Z"}
+
+	files := []storage.FileMetadata{
+		{FileID: "new", UploadType: "multipart", Status: storage.FileStatusCompleted},
+		{FileID: "summarized", UploadType: "multipart", Status: storage.FileStatusCompleted, ChunkSummary: summarized},
+		{FileID: "expiring", UploadType: "multipart", Status: storage.FileStatusCompleted, ChunkSummary: expiring},
+		{FileID: "uploading", UploadType: "multipart", Status: storage.FileStatusUploading},
+		{FileID: "quarantined", UploadType: "multipart", Status: storage.FileStatusQuarantined},
+		{FileID: "single", UploadType: "single", Status: storage.FileStatusCompleted},
+	}
+
+	ids := func(files []storage.FileMetadata) []string {
+		var ids []string
+		for _, file := range files {
+			ids = append(ids, file.FileID)
+		}
+		return ids
+	}
+	if got := ids(Uncompacted(files, 0)); len(got) != 1 || got[0] != "new" {
+		t.Errorf("keeping records: uncompacted = %v, want [new]", got)
+	}
+	if got := ids(Uncompacted(files, 24*time.Hour)); len(got) != 2 || got[0] != "new" || got[1] != "summarized" {
+		t.Errorf("expiring records: uncompacted = %v, want [new summarized]", got)
+	}
+}
@@ -0,0 +1,89 @@
+// Package delta computes the block manifests delta uploads are planned against. A file is
+// cut into fixed-size blocks, the last possibly short, and each block gets a weak rolling
+// checksum and a SHA-256. A client slides a window over its new content looking for weak
+// matches, confirms them with the SHA-256, and sends only the bytes that matched no block.
+package delta
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// BlockSize is the size of every block but a file's last. It is above S3's 5 MiB minimum
+// part size, so a run of matched blocks can always be copied as a part of its own, and
+// keeps a 50 GB file at 6400 blocks.
+const BlockSize = 8 * 1024 * 1024
+
+// recordSize is a block's size in an encoded manifest: its weak checksum, then its SHA-256
+const recordSize = 4 + sha256.Size
+
+// Block is one block of a file and its checksums
+type Block struct {
+	Offset int64
+	Size   int64
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+// Weak is rsync's rolling checksum of data: with a the sum of the bytes and b the sum of
+// each byte times its distance from the end (len(data) for the first byte), both modulo
+// 2^16, it is a | b<<16. Moving the window a byte on only needs the byte leaving and the
+// byte entering, so a client can check every offset of its content.
+func Weak(data []byte) uint32 {
+	var a, b uint32
+	n := uint32(len(data))
+	for i, c := range data {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a&0xffff | (b&0xffff)<<16
+}
+
+// Compute reads size bytes of content and returns its blocks of blockSize. Content that
+// ends early is an error, since the manifest would describe a different file.
+func Compute(content io.Reader, size, blockSize int64) ([]Block, error) {
+	blocks := make([]Block, 0, blockCount(size, blockSize))
+	buf := make([]byte, blockSize)
+	for offset := int64(0); offset < size; offset += blockSize {
+		n := min(blockSize, size-offset)
+		if _, err := io.ReadFull(content, buf[:n]); err != nil {
+			return nil, fmt.Errorf("failed to read block at %d: %w", offset, err)
+		}
+		blocks = append(blocks, Block{Offset: offset, Size: n, Weak: Weak(buf[:n]), Strong: sha256.Sum256(buf[:n])})
+	}
+	return blocks, nil
+}
+
+// Encode packs blocks' checksums for storage; their offsets and sizes follow from the
+// file's size and the block size
+func Encode(blocks []Block) []byte {
+	data := make([]byte, 0, len(blocks)*recordSize)
+	for _, block := range blocks {
+		data = binary.BigEndian.AppendUint32(data, block.Weak)
+		data = append(data, block.Strong[:]...)
+	}
+	return data
+}
+
+// Decode unpacks the blocks Encode packed for a file of size bytes cut into blockSize blocks
+func Decode(data []byte, size, blockSize int64) ([]Block, error) {
+	count := blockCount(size, blockSize)
+	if int64(len(data)) != count*recordSize {
+		return nil, fmt.Errorf("manifest holds %d bytes, want %d for %d blocks", len(data), count*recordSize, count)
+	}
+	blocks := make([]Block, count)
+	for i := range blocks {
+		record := data[i*recordSize : (i+1)*recordSize]
+		offset := int64(i) * blockSize
+		blocks[i] = Block{Offset: offset, Size: min(blockSize, size-offset), Weak: binary.BigEndian.Uint32(record)}
+		copy(blocks[i].Strong[:], record[4:])
+	}
+	return blocks, nil
+}
+
+// blockCount is how many blocks a file of size bytes has; an empty file has none
+func blockCount(size, blockSize int64) int64 {
+	return (size + blockSize - 1) / blockSize
+}
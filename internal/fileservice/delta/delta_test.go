@@ -0,0 +1,58 @@
+package delta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestComputeEncodeDecode(t *testing.T) {
+	content := []byte("the quick brown fox jumps")
+	blocks, err := Compute(bytes.NewReader(content), int64(len(content)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 || blocks[2].Offset != 20 || blocks[2].Size != 5 {
+		t.Fatalf("blocks = %+v, want 3 with a 5 byte last block at 20", blocks)
+	}
+	if blocks[1].Weak != Weak(content[10:20]) || blocks[1].Strong != sha256.Sum256(content[10:20]) {
+		t.Errorf("block 1 checksums don't match its bytes")
+	}
+
+	decoded, err := Decode(Encode(blocks), int64(len(content)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range blocks {
+		if decoded[i] != blocks[i] {
+			t.Errorf("decoded block %d = %+v, want %+v", i, decoded[i], blocks[i])
+		}
+	}
+	if _, err := Decode(Encode(blocks), 31, 10); err == nil {
+		t.Error("decoding a manifest for a different size succeeded")
+	}
+
+	if _, err := Compute(strings.NewReader("short"), 10, 4); err == nil {
+		t.Error("computing a manifest of truncated content succeeded")
+	}
+	if empty, err := Compute(strings.NewReader(""), 0, 4); err != nil || len(empty) != 0 {
+		t.Errorf("empty content = %v, %v; want no blocks", empty, err)
+	}
+}
+
+func TestWeakRolls(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	const window = 8
+	sum := Weak(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		// Roll the window on a byte: drop data[i-1], take in data[i+window-1]
+		out, in := uint32(data[i-1]), uint32(data[i+window-1])
+		a := (sum&0xffff - out + in) & 0xffff
+		b := (sum>>16 - window*out + a) & 0xffff
+		sum = a | b<<16
+		if want := Weak(data[i : i+window]); sum != want {
+			t.Fatalf("rolled checksum at %d = %#x, want %#x", i, sum, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package emailverify sends the tokens that confirm a change of a user's email address
+package emailverify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+)
+
+// WebhookNotifier posts each confirmation as JSON to a webhook that delivers it to the new
+// address, such as an email relay: "email" is the address to send it to and "token" the
+// token the user presents to confirm it
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: common.NewWebhookClient()}
+}
+
+// Notify sends token to email. Unlike an alert, a confirmation that isn't sent leaves the
+// user stuck, so failures are returned for the caller to report.
+func (n *WebhookNotifier) Notify(ctx context.Context, email, token string, expiresAt time.Time) error {
+	err := common.PostWebhook(ctx, n.client, n.url, map[string]interface{}{
+		"text":       fmt.Sprintf("Confirm %s as your Vibe-Drop email address with this token before %s: %s", email, expiresAt.Format(time.RFC3339), token),
+		"email":      email,
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email confirmation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SNSAPI is the part of the SNS client SNSPublisher uses
+type SNSAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SQSAPI is the part of the SQS client SQSPublisher uses
+type SQSAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+var (
+	_ SNSAPI = (*sns.Client)(nil)
+	_ SQSAPI = (*sqs.Client)(nil)
+)
+
+// SNSPublisher publishes each event as a JSON message to a standard SNS topic, with its
+// type in the TypeAttribute message attribute
+type SNSPublisher struct {
+	client   SNSAPI
+	topicARN string
+}
+
+// NewSNSPublisher creates a publisher to the topic topicARN
+func NewSNSPublisher(client SNSAPI, topicARN string) *SNSPublisher {
+	return &SNSPublisher{client: client, topicARN: topicARN}
+}
+
+func (p *SNSPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+	_, err = p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			TypeAttribute: {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish %s event %s: %w", event.Type, event.ID, err)
+	}
+	return nil
+}
+
+// SQSPublisher sends each event as a JSON message to a standard SQS queue, with its type in
+// the TypeAttribute message attribute
+type SQSPublisher struct {
+	client   SQSAPI
+	queueURL string
+}
+
+// NewSQSPublisher creates a publisher to the queue at queueURL
+func NewSQSPublisher(client SQSAPI, queueURL string) *SQSPublisher {
+	return &SQSPublisher{client: client, queueURL: queueURL}
+}
+
+func (p *SQSPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			TypeAttribute: {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send %s event %s: %w", event.Type, event.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package events publishes what happens to files and accounts to a bus: uploads completing,
+// files being deleted, users registering. Work that follows from those, such as thumbnails,
+// scans, webhooks and audit logs, can then consume the bus instead of running inline in the
+// handlers that made the change.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// Buses EVENT_BUS selects; empty publishes nothing
+const (
+	BusMemory = "memory" // In process, for development: each event is logged
+	BusSNS    = "sns"    // Published to an SNS topic, to fan out to queues and functions
+	BusSQS    = "sqs"    // Sent to one SQS queue
+)
+
+// Event types
+const (
+	TypeFileUploaded   = "file.uploaded"   // An upload completed and the file can be downloaded
+	TypeFileDeleted    = "file.deleted"    // A file was deleted, whatever its status
+	TypeUserRegistered = "user.registered" // An account was created
+)
+
+// TypeAttribute is the SNS and SQS message attribute carrying the event's type, for
+// subscription filter policies and consumers that route messages before parsing them
+const TypeAttribute = "event_type"
+
+// Event is something that happened, as published to the bus in JSON
+type Event struct {
+	ID         string    `json:"id"` // Unique, so consumers can drop redeliveries
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	UserID     string    `json:"user_id"`
+	File       *File     `json:"file,omitempty"` // File events
+	User       *User     `json:"user,omitempty"` // User events
+}
+
+// File is the file a file event is about
+type File struct {
+	FileID      string `json:"file_id"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	UploadType  string `json:"upload_type"`
+	Status      string `json:"status"`
+	Bucket      string `json:"bucket,omitempty"` // Empty for the default bucket
+	Key         string `json:"key"`
+	Version     int    `json:"version,omitempty"`
+	// The whole-object checksum the client declared, as S3 reports it
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	Checksum          string `json:"checksum,omitempty"`
+	APIKeyID          string `json:"api_key_id,omitempty"` // The API key the file was uploaded with
+}
+
+// User is the account a user event is about
+type User struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// Publisher sends events to a bus
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// FileUploaded is the event for metadata's upload completing
+func FileUploaded(metadata *storage.FileMetadata) Event {
+	return fileEvent(TypeFileUploaded, metadata)
+}
+
+// FileDeleted is the event for metadata's file being deleted
+func FileDeleted(metadata *storage.FileMetadata) Event {
+	return fileEvent(TypeFileDeleted, metadata)
+}
+
+// UserRegistered is the event for user's account being created
+func UserRegistered(user *storage.User) Event {
+	event := newEvent(TypeUserRegistered, user.UserID)
+	event.User = &User{Username: user.Username, Email: user.Email}
+	return event
+}
+
+func fileEvent(eventType string, metadata *storage.FileMetadata) Event {
+	event := newEvent(eventType, metadata.UserID)
+	event.File = &File{
+		FileID:            metadata.FileID,
+		Filename:          metadata.Filename,
+		Size:              metadata.TotalSize,
+		ContentType:       metadata.ContentType,
+		UploadType:        metadata.UploadType,
+		Status:            metadata.Status,
+		Bucket:            metadata.Bucket,
+		Key:               metadata.S3Key,
+		Version:           metadata.Version,
+		ChecksumAlgorithm: metadata.ChecksumAlgorithm,
+		Checksum:          metadata.Checksum,
+		APIKeyID:          metadata.APIKeyID,
+	}
+	return event
+}
+
+func newEvent(eventType, userID string) Event {
+	return Event{ID: uuid.New().String(), Type: eventType, OccurredAt: time.Now().UTC(), UserID: userID}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	var mu sync.Mutex
+	got := make(map[string][]string)
+	record := func(name string) Handler {
+		return func(_ context.Context, event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[name] = append(got[name], event.Type)
+		}
+	}
+	bus.Subscribe(TypeFileUploaded, record("uploads"))
+	bus.Subscribe("", record("all"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Handlers run even once the publishing request has gone
+	metadata := &storage.FileMetadata{FileID: "file-1", UserID: "user-1"}
+	for _, event := range []Event{FileUploaded(metadata), FileDeleted(metadata)} {
+		if err := bus.Publish(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bus.Wait()
+
+	if len(got["uploads"]) != 1 || got["uploads"][0] != TypeFileUploaded {
+		t.Errorf("upload subscriber got %v, want only %s", got["uploads"], TypeFileUploaded)
+	}
+	if len(got["all"]) != 2 {
+		t.Errorf("subscriber to every type got %v, want both events", got["all"])
+	}
+}
+
+type fakeSNS struct {
+	input *sns.PublishInput
+	err   error
+}
+
+func (f *fakeSNS) Publish(_ context.Context, input *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.input = input
+	return &sns.PublishOutput{}, f.err
+}
+
+type fakeSQS struct {
+	input *sqs.SendMessageInput
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, input *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.input = input
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestAWSPublishers(t *testing.T) {
+	event := UserRegistered(&storage.User{UserID: "user-1", Username: "ada", Email: "ada@example.com"})
+
+	topic := &fakeSNS{}
+	if err := NewSNSPublisher(topic, "arn:aws:sns:us-east-1:123456789012:vibe-drop-events").Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	var published Event
+	if err := json.Unmarshal([]byte(aws.ToString(topic.input.Message)), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.ID != event.ID || published.User == nil || published.User.Email != "ada@example.com" {
+		t.Errorf("published %+v, want %+v", published, event)
+	}
+	if attr := topic.input.MessageAttributes[TypeAttribute]; aws.ToString(attr.StringValue) != TypeUserRegistered {
+		t.Errorf("%s attribute = %q, want %q", TypeAttribute, aws.ToString(attr.StringValue), TypeUserRegistered)
+	}
+
+	queue := &fakeSQS{}
+	if err := NewSQSPublisher(queue, "https://sqs.us-east-1.amazonaws.com/123456789012/vibe-drop-events").Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(queue.input.MessageBody) != aws.ToString(topic.input.Message) {
+		t.Errorf("queue message %s, want the topic's %s", aws.ToString(queue.input.MessageBody), aws.ToString(topic.input.Message))
+	}
+	if attr := queue.input.MessageAttributes[TypeAttribute]; aws.ToString(attr.StringValue) != TypeUserRegistered {
+		t.Errorf("queue %s attribute = %q", TypeAttribute, aws.ToString(attr.StringValue))
+	}
+
+	topic.err = errors.New("topic gone")
+	if err := NewSNSPublisher(topic, "arn").Publish(context.Background(), event); !errors.Is(err, topic.err) {
+		t.Errorf("failed publish: err = %v, want the SNS error", err)
+	}
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"vibe-drop/internal/common"
+)
+
+// Handler consumes a Bus's events
+type Handler func(ctx context.Context, event Event)
+
+// Bus is a Publisher that hands each event to the handlers subscribed to it, in process.
+// Each handler runs in its own goroutine, so a slow consumer doesn't hold up the request
+// that published the event. Events aren't kept: a restart loses those still being handled.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler // By event type; "" is every type
+	running  sync.WaitGroup
+}
+
+// NewBus creates a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe has handler called with each event of eventType published from now on; an
+// empty eventType subscribes it to every event
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish starts each handler subscribed to event. The handlers outlive ctx's cancellation.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler(nil), b.handlers[event.Type]...), b.handlers[""]...)
+	b.mu.RUnlock()
+
+	ctx = context.WithoutCancel(ctx)
+	for _, handler := range handlers {
+		b.running.Add(1)
+		go func() {
+			defer b.running.Done()
+			handler(ctx, event)
+		}()
+	}
+	return nil
+}
+
+// Wait blocks until every handler started so far has returned
+func (b *Bus) Wait() {
+	b.running.Wait()
+}
+
+// LogEvent is a Handler that logs each event, to see them in development
+func LogEvent(ctx context.Context, event Event) {
+	attrs := []any{"type", event.Type, "event_id", event.ID, "user_id", event.UserID}
+	if event.File != nil {
+		attrs = append(attrs, "file_id", event.File.FileID)
+	}
+	common.Logger(ctx).Info("Event published", attrs...)
+}
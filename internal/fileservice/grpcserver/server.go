@@ -0,0 +1,185 @@
+// Package grpcserver serves the file service's gRPC API (filepb.FileService). Each call is
+// made as a request for its operation's route through the REST API's own router, so
+// authentication, validation and every response are exactly those of the REST API.
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"vibe-drop/internal/filepb"
+	"vibe-drop/internal/registry"
+)
+
+// New creates a gRPC server that serves FileService calls through handler, the REST router
+func New(handler http.Handler) *grpc.Server {
+	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	filepb.RegisterFileServiceServer(server, &service{handler: handler, routes: servedRoutes()})
+	return server
+}
+
+// servedRoutes returns the routes the file service serves, by name
+func servedRoutes() map[string]registry.Route {
+	routes := make(map[string]registry.Route)
+	for _, route := range registry.Served() {
+		routes[route.Name] = route
+	}
+	return routes
+}
+
+type service struct {
+	filepb.UnimplementedFileServiceServer
+	handler http.Handler
+	routes  map[string]registry.Route
+}
+
+// serve makes a call as a REST request for the named route. The call's metadata becomes
+// the request's headers.
+func (s *service) serve(ctx context.Context, operation string, req *filepb.Request) (*filepb.Response, error) {
+	route, ok := s.routes[operation]
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "the file service has no %s route", operation)
+	}
+
+	target := route.FillServicePath(req.PathParams)
+	if req.Query != "" {
+		target += "?" + req.Query
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, route.Method, target, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		// Pseudo-headers and gRPC's own headers describe the call, not the request
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || key == "content-type" {
+			continue
+		}
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+	if len(req.Body) > 0 {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		httpReq.RemoteAddr = p.Addr.String()
+	}
+
+	recorder := &responseRecorder{header: make(http.Header)}
+	s.handler.ServeHTTP(recorder, httpReq)
+	return recorder.response(), nil
+}
+
+func (s *service) Register(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "register", req)
+}
+
+func (s *service) Login(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "login", req)
+}
+
+func (s *service) RefreshToken(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "refreshToken", req)
+}
+
+func (s *service) Logout(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "logout", req)
+}
+
+func (s *service) CreateScopedToken(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "createScopedToken", req)
+}
+
+func (s *service) ListFiles(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "listFiles", req)
+}
+
+func (s *service) CreateUploadURL(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "createUploadURL", req)
+}
+
+func (s *service) ListRecentFiles(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "listRecentFiles", req)
+}
+
+func (s *service) GetFile(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "getFile", req)
+}
+
+func (s *service) GetDownloadURL(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "getDownloadURL", req)
+}
+
+func (s *service) ListChunks(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "listChunks", req)
+}
+
+func (s *service) GetUploadStatus(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "getUploadStatus", req)
+}
+
+func (s *service) RefreshChunkURL(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "refreshChunkURL", req)
+}
+
+func (s *service) CompleteChunk(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "completeChunk", req)
+}
+
+func (s *service) CompleteUpload(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "completeUpload", req)
+}
+
+func (s *service) AbortUpload(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "abortUpload", req)
+}
+
+func (s *service) DeleteFile(ctx context.Context, req *filepb.Request) (*filepb.Response, error) {
+	return s.serve(ctx, "deleteFile", req)
+}
+
+// responseRecorder collects the REST response to a call
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
+
+func (r *responseRecorder) response() *filepb.Response {
+	resp := &filepb.Response{Status: int32(r.status), Body: r.body.Bytes()}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for name, values := range r.header {
+		for _, value := range values {
+			resp.Headers = append(resp.Headers, &filepb.Header{Name: name, Value: value})
+		}
+	}
+	return resp
+}
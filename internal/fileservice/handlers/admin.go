@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/anomaly"
+	"vibe-drop/internal/fileservice/callbacks"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/loginguard"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// SystemMetricsHandler returns the latest system-wide operational metrics computed by the aggregator
+func SystemMetricsHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := dynamoClient.GetSystemMetrics(r.Context())
+		if err != nil {
+			writeNotFoundOr(w, err, "Metrics not available yet",
+				"Operational metrics are computed periodically; try again after the next aggregation run",
+				"Failed to load metrics")
+			return
+		}
+
+		common.WriteOKResponse(w, metrics)
+	}
+}
+
+// ClientVersionReport lists the client versions recent uploads came from, to show who still
+// uses an upload flow before it is retired
+type ClientVersionReport struct {
+	Versions            []storage.ClientVersionUsage `json:"versions"`
+	UnidentifiedUploads int                          `json:"unidentified_uploads"` // Sent without X-Client-Info
+	ComputedAt          string                       `json:"computed_at"`
+}
+
+// ClientVersionsHandler reports the client versions behind the last 30 days of uploads, from
+// the aggregator's latest metrics. ?app= narrows the report to one app.
+func ClientVersionsHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := dynamoClient.GetSystemMetrics(r.Context())
+		if err != nil {
+			writeNotFoundOr(w, err, "Client versions not available yet",
+				"Client versions are computed with the operational metrics; try again after the next aggregation run",
+				"Failed to load metrics")
+			return
+		}
+
+		report := ClientVersionReport{
+			Versions:            []storage.ClientVersionUsage{},
+			UnidentifiedUploads: metrics.UnidentifiedUploads,
+			ComputedAt:          metrics.ComputedAt,
+		}
+		app := r.URL.Query().Get("app")
+		for _, version := range metrics.ClientVersions {
+			if app == "" || version.App == app {
+				report.Versions = append(report.Versions, version)
+			}
+		}
+		common.WriteOKResponse(w, report)
+	}
+}
+
+// ReconciliationReportHandler returns the report from the most recent reconciliation run
+func ReconciliationReportHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := dynamoClient.GetReconciliationReport(r.Context())
+		if err != nil {
+			writeNotFoundOr(w, err, "No reconciliation report yet",
+				"Reconciliation runs on a schedule; trigger one now with POST /admin/reconciliation",
+				"Failed to load reconciliation report")
+			return
+		}
+
+		common.WriteOKResponse(w, report)
+	}
+}
+
+// RunReconciliationRequest is the optional body for an on-demand reconciliation
+type RunReconciliationRequest struct {
+	Repair bool `json:"repair"` // Delete orphan objects and dangling records instead of only reporting them
+}
+
+// RunReconciliationHandler reconciles the bucket with the metadata table now and returns the report
+func RunReconciliationHandler(reconciler ReconcileRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RunReconciliationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+
+		report, err := reconciler.RunOnce(r.Context(), req.Repair)
+		if err != nil {
+			common.WriteInternalServerError(w, "Reconciliation failed", err.Error())
+			return
+		}
+
+		common.WriteOKResponse(w, report)
+	}
+}
+
+// Per-chunk outcomes reported by a redrive
+const (
+	RedriveChunkOK       = "ok"       // record already matched S3
+	RedriveChunkRepaired = "repaired" // record updated from the part S3 holds
+	RedriveChunkMissing  = "missing"  // S3 has no such part; the client must re-upload it
+)
+
+// RedriveChunk is the redrive outcome for a single chunk record
+type RedriveChunk struct {
+	ChunkNumber int    `json:"chunk_number"`
+	Action      string `json:"action"`
+	ETag        string `json:"etag,omitempty"`
+}
+
+// RedriveResult reports what a redrive repaired and whether the upload now completes
+type RedriveResult struct {
+	FileID        string         `json:"file_id"`
+	Completed     bool           `json:"completed"`
+	CompletedAt   string         `json:"completed_at,omitempty"`
+	Repaired      int            `json:"repaired_chunks"`
+	MissingChunks []int          `json:"missing_chunks"`
+	Chunks        []RedriveChunk `json:"chunks"`
+}
+
+// RedriveUploadHandler re-validates a multipart upload's chunk records against the parts S3
+// actually holds, repairs missing or stale ETags, and retries CompleteMultipartUpload.
+// It is for operators unsticking uploads that failed to complete on a transient S3 error.
+func RedriveUploadHandler(s3Client ObjectStore, dynamoClient MetadataStore, uploadCallbacks *callbacks.Notifier, bus events.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+		ctx := r.Context()
+
+		metadata, err := dynamoClient.GetFileMetadata(ctx, fileID)
+		if err != nil {
+			writeNotFoundOr(w, err, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID), "Failed to load file")
+			return
+		}
+
+		if metadata.UploadType != "multipart" || metadata.S3UploadID == nil {
+			common.WriteBadRequestError(w, "Not a multipart upload", "Only multipart uploads can be re-driven")
+			return
+		}
+		if metadata.Status == storage.FileStatusCompleted {
+			common.WriteConflictError(w, "Upload already completed", "S3 has already assembled this file")
+			return
+		}
+		if err := storage.ValidateObjectKey(metadata.UserID, metadata.S3Key); err != nil {
+			common.Logger(ctx).Warn("Rejected redrive", "file_id", fileID, "error", err)
+			common.WriteForbiddenError(w, "Invalid upload key", "The upload's storage key does not belong to its owner")
+			return
+		}
+
+		chunks, err := dynamoClient.GetFileChunks(ctx, fileID)
+		if err != nil {
+			writeStorageError(w, "Failed to load chunk records", err, common.WriteDatabaseError)
+			return
+		}
+		if len(chunks) == 0 {
+			common.WriteBadRequestError(w, "No chunk records", "The upload has no chunk records to re-drive")
+			return
+		}
+
+		uploadInfo := &storage.MultipartUploadInfo{
+			FileID:   fileID,
+			UploadID: *metadata.S3UploadID,
+			Bucket:   metadata.Bucket,
+			Key:      metadata.S3Key,
+		}
+		uploaded, err := s3Client.ListParts(ctx, uploadInfo)
+		if err != nil {
+			writeStorageError(w, "Failed to list uploaded parts", err, common.WriteS3Error)
+			return
+		}
+		partsByNumber := make(map[int]storage.UploadedPart, len(uploaded))
+		for _, part := range uploaded {
+			partsByNumber[part.PartNumber] = part
+		}
+
+		result := RedriveResult{FileID: fileID, MissingChunks: []int{}}
+		parts := make([]storage.CompletedPart, 0, len(chunks))
+		for _, chunk := range chunks {
+			outcome, err := redriveChunk(ctx, dynamoClient, chunk, partsByNumber)
+			if err != nil {
+				writeStorageError(w, "Failed to repair chunk record", err, common.WriteDatabaseError)
+				return
+			}
+			result.Chunks = append(result.Chunks, outcome)
+
+			switch outcome.Action {
+			case RedriveChunkMissing:
+				result.MissingChunks = append(result.MissingChunks, chunk.ChunkNumber)
+				continue
+			case RedriveChunkRepaired:
+				result.Repaired++
+			}
+			parts = append(parts, storage.CompletedPart{PartNumber: chunk.S3PartNumber, ETag: outcome.ETag})
+		}
+
+		// Completing without every part would silently truncate the file
+		if len(result.MissingChunks) > 0 {
+			common.Logger(ctx).Warn("Redrive left chunks missing from S3", "file_id", fileID, "repaired", result.Repaired, "missing", len(result.MissingChunks))
+			common.WriteOKResponse(w, result)
+			return
+		}
+
+		if err := s3Client.CompleteMultipartUpload(ctx, uploadInfo, parts); err != nil {
+			common.Logger(ctx).Error("Redrive failed to complete multipart upload", "file_id", fileID, "error", err)
+			metadata.Status = storage.FileStatusCompletionFailed
+			if saveErr := dynamoClient.SaveFileMetadata(ctx, metadata); saveErr != nil {
+				common.Logger(ctx).Warn("Failed to record completion failure", "file_id", fileID, "error", saveErr)
+			}
+			writeStorageError(w, "Failed to complete upload", err, common.WriteS3Error)
+			return
+		}
+
+		completedAt := time.Now().Format(time.RFC3339)
+		metadata.Status = storage.FileStatusCompleted
+		metadata.CompletedAt = &completedAt
+		if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+			common.Logger(ctx).Warn("Failed to update file status", "file_id", fileID, "error", err)
+		}
+		uploadCallbacks.UploadCompleted(ctx, metadata)
+		publish(ctx, bus, events.FileUploaded(metadata))
+
+		result.Completed = true
+		result.CompletedAt = completedAt
+		common.Logger(ctx).Info("Redrive completed multipart upload", "file_id", fileID, "repaired", result.Repaired)
+		common.WriteOKResponse(w, result)
+	}
+}
+
+// redriveChunk reconciles one chunk record with the part S3 holds for it
+func redriveChunk(ctx context.Context, dynamoClient MetadataStore, chunk storage.FileChunk, parts map[int]storage.UploadedPart) (RedriveChunk, error) {
+	outcome := RedriveChunk{ChunkNumber: chunk.ChunkNumber}
+
+	part, ok := parts[chunk.S3PartNumber]
+	if !ok {
+		// Flag it failed so the client's next resume re-uploads it
+		outcome.Action = RedriveChunkMissing
+		if chunk.Status != "failed" {
+			if err := dynamoClient.UpdateChunkStatus(ctx, chunk.FileID, chunk.ChunkNumber, "failed", ""); err != nil {
+				return outcome, err
+			}
+		}
+		return outcome, nil
+	}
+
+	outcome.ETag = part.ETag
+	if chunk.Status == "uploaded" && normalizeETag(chunk.ETag) == normalizeETag(part.ETag) {
+		outcome.Action = RedriveChunkOK
+		return outcome, nil
+	}
+
+	outcome.Action = RedriveChunkRepaired
+	if err := dynamoClient.UpdateChunkStatus(ctx, chunk.FileID, chunk.ChunkNumber, "uploaded", part.ETag); err != nil {
+		return outcome, err
+	}
+	return outcome, nil
+}
+
+// normalizeETag strips the quotes S3 wraps ETags in, since clients report them either way
+func normalizeETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+// IssuedURLsResponse is the audit trail of presigned URLs issued for a file
+type IssuedURLsResponse struct {
+	FileID string              `json:"file_id"`
+	Active int                 `json:"active"` // Unexpired and not revoked
+	URLs   []storage.IssuedURL `json:"urls"`
+}
+
+// ListIssuedURLsHandler returns every presigned URL recorded for a file, oldest first
+func ListIssuedURLsHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+
+		issued, err := dynamoClient.ListIssuedURLs(r.Context(), fileID)
+		if err != nil {
+			writeStorageError(w, "Failed to load issued URLs", err, common.WriteDatabaseError)
+			return
+		}
+
+		response := IssuedURLsResponse{FileID: fileID, URLs: []storage.IssuedURL{}}
+		now := time.Now()
+		for _, record := range issued {
+			if record.Active(now) {
+				response.Active++
+			}
+			response.URLs = append(response.URLs, record)
+		}
+		common.WriteOKResponse(w, response)
+	}
+}
+
+// URLRevocationResult reports a file's move to a new object key
+type URLRevocationResult struct {
+	FileID      string `json:"file_id"`
+	S3Key       string `json:"s3_key"`       // The file's new key
+	RevokedURLs int    `json:"revoked_urls"` // Audit records that were still active
+	RotatedAt   string `json:"rotated_at"`
+}
+
+// RevokeFileURLsHandler invalidates every outstanding presigned URL for a file, for when a
+// link leaks. Presigned URLs can't be cancelled, so the object is copied to a new key and
+// the old one deleted; URLs signed for the old key then fail. Clients must request new URLs.
+func RevokeFileURLsHandler(s3Client ObjectStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+		ctx := r.Context()
+
+		metadata, err := dynamoClient.GetFileMetadata(ctx, fileID)
+		if err != nil {
+			writeNotFoundOr(w, err, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID), "Failed to load file")
+			return
+		}
+
+		// Parts of an unfinished multipart upload live under its upload ID and can't be moved
+		if metadata.UploadType == "multipart" && metadata.Status != storage.FileStatusCompleted {
+			common.WriteConflictError(w, "Upload still in progress",
+				"A multipart upload can only be moved once it has completed")
+			return
+		}
+		if err := storage.ValidateObjectKey(metadata.UserID, metadata.S3Key); err != nil {
+			common.Logger(ctx).Warn("Rejected URL revocation", "file_id", fileID, "error", err)
+			common.WriteForbiddenError(w, "Invalid object key", "The file's storage key does not belong to its owner")
+			return
+		}
+
+		oldKey := metadata.S3Key
+		newKey := storage.RotatedObjectKey(metadata.UserID, fileID, metadata.Filename)
+		if err := s3Client.CopyObject(ctx, metadata.Bucket, oldKey, newKey, metadata.TotalSize); err != nil {
+			writeStorageError(w, "Failed to copy object to a new key", err, common.WriteS3Error)
+			return
+		}
+
+		metadata.S3Key = newKey
+		if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+			if delErr := s3Client.DeleteObject(ctx, metadata.Bucket, newKey); delErr != nil {
+				common.Logger(ctx).Warn("Failed to remove copy after metadata update failed", "s3_key", newKey, "error", delErr)
+			}
+			writeStorageError(w, "Failed to update file metadata", err, common.WriteDatabaseError)
+			return
+		}
+
+		// Until the old object is gone its URLs still work, so this failing fails the revocation
+		if err := s3Client.DeleteObject(ctx, metadata.Bucket, oldKey); err != nil {
+			common.Logger(ctx).Error("Revocation moved file but left the old object in place", "file_id", fileID, "s3_key", newKey, "old_s3_key", oldKey, "error", err)
+			common.WriteS3Error(w, "Failed to delete the old object",
+				fmt.Sprintf("The file now lives at %s but %s still exists and must be deleted: %v", newKey, oldKey, err))
+			return
+		}
+
+		rotatedAt := time.Now()
+		revoked, err := dynamoClient.MarkURLsRevoked(ctx, fileID, rotatedAt)
+		if err != nil {
+			common.Logger(ctx).Warn("Failed to mark URLs revoked", "file_id", fileID, "error", err)
+		}
+
+		common.Logger(ctx).Info("Revoked presigned URLs", "file_id", fileID, "old_s3_key", oldKey, "s3_key", newKey)
+		common.WriteOKResponse(w, URLRevocationResult{
+			FileID:      fileID,
+			S3Key:       newKey,
+			RevokedURLs: revoked,
+			RotatedAt:   rotatedAt.Format(time.RFC3339),
+		})
+	}
+}
+
+// ReleaseQuarantinedFileHandler releases a file the executable policy quarantined, once an
+// admin has judged it safe; it moves back under its owner's prefix and can be downloaded
+func ReleaseQuarantinedFileHandler(s3Client ObjectStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+
+		metadata, err := dynamoClient.GetFileMetadata(r.Context(), fileID)
+		if err != nil {
+			writeNotFoundOr(w, err, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID), "Failed to load file")
+			return
+		}
+		if metadata.Status != storage.FileStatusQuarantined {
+			common.WriteConflictError(w, "File is not quarantined", fmt.Sprintf("File ID: %s has status %s", fileID, metadata.Status))
+			return
+		}
+
+		if err := quarantine.Release(r.Context(), s3Client, dynamoClient, metadata); err != nil {
+			writeStorageError(w, "Failed to release file", err, common.WriteS3Error)
+			return
+		}
+
+		common.WriteOKResponse(w, toFileMetadataResponse(metadata))
+	}
+}
+
+// AnomalyReport lists the locks in force and recent detections
+type AnomalyReport struct {
+	Locks  []anomaly.Lock  `json:"locks"`
+	Events []anomaly.Event `json:"events"` // Newest first
+}
+
+// AnomaliesHandler returns the users currently locked for unusual activity and recent detections
+func AnomaliesHandler(monitor AnomalyMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		common.WriteOKResponse(w, AnomalyReport{Locks: monitor.Locks(), Events: monitor.Events()})
+	}
+}
+
+// UnlockUserHandler lifts a user's anomaly lock, e.g. once an admin has confirmed the activity was legitimate
+func UnlockUserHandler(monitor AnomalyMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userId"]
+		if !monitor.Unlock(userID) {
+			common.WriteNotFoundError(w, "User is not locked", fmt.Sprintf("User %s has no lock in force", userID))
+			return
+		}
+
+		common.Logger(r.Context()).Info("Admin lifted anomaly lock", "locked_user_id", userID)
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// UnlockLoginHandler lifts the lock on a user's account after repeated failed sign-ins,
+// e.g. once the user has confirmed it was them. Locks on client addresses are left to expire.
+func UnlockLoginHandler(guard *loginguard.Guard, users UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userId"]
+		user, err := users.GetUserByID(r.Context(), userID)
+		if err != nil {
+			writeNotFoundOr(w, err, "User not found", fmt.Sprintf("User ID: %s does not exist", userID), "Failed to load user")
+			return
+		}
+
+		unlocked := false
+		if guard != nil {
+			unlocked, err = guard.Unlock(r.Context(), user.Email)
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to lift login lock", "locked_user_id", userID, "error", err)
+				writeStorageError(w, "Failed to lift login lock", err, common.WriteDatabaseError)
+				return
+			}
+		}
+		if !unlocked {
+			common.WriteNotFoundError(w, "User is not locked", fmt.Sprintf("User %s has no sign-in lock in force", userID))
+			return
+		}
+
+		common.Logger(r.Context()).Info("Admin lifted login lock", "security_event", "login_unlocked", "locked_user_id", userID)
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// maxTransferFiles caps the files one transfer request can name, keeping the record in one item
+const maxTransferFiles = 1000
+
+// CreateTransferRequest asks for files to move from one user to another
+type CreateTransferRequest struct {
+	FromUserID string   `json:"from_user_id"`
+	ToUserID   string   `json:"to_user_id"`
+	FileIDs    []string `json:"file_ids,omitempty"` // Omit to transfer every file the source user owns
+}
+
+// CreateTransferHandler queues an ownership transfer for the background job and returns it
+func CreateTransferHandler(queue TransferQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateTransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+
+		switch {
+		case req.FromUserID == "" || req.ToUserID == "":
+			common.WriteValidationError(w, "Missing user", "from_user_id and to_user_id are required")
+			return
+		case req.FromUserID == req.ToUserID:
+			common.WriteValidationError(w, "Invalid transfer", "from_user_id and to_user_id must differ")
+			return
+		case len(req.FileIDs) > maxTransferFiles:
+			common.WriteValidationError(w, "Too many files",
+				fmt.Sprintf("A transfer can name at most %d files; omit file_ids to transfer everything", maxTransferFiles))
+			return
+		}
+		for _, userID := range []string{req.FromUserID, req.ToUserID} {
+			if _, err := queue.GetUserByID(r.Context(), userID); err != nil {
+				writeNotFoundOr(w, err, "User not found", fmt.Sprintf("User ID: %s does not exist", userID), "Failed to load user")
+				return
+			}
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		transfer := &storage.OwnershipTransfer{
+			TransferID: uuid.New().String(),
+			FromUserID: req.FromUserID,
+			ToUserID:   req.ToUserID,
+			FileIDs:    req.FileIDs,
+			Status:     storage.TransferStatusPending,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if err := queue.CreateOwnershipTransfer(r.Context(), transfer); err != nil {
+			writeStorageError(w, "Failed to queue transfer", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.Logger(r.Context()).Info("Admin queued transfer", "transfer_id", transfer.TransferID, "from_user_id", req.FromUserID, "to_user_id", req.ToUserID)
+		common.WriteAcceptedResponse(w, transfer)
+	}
+}
+
+// GetTransferHandler returns an ownership transfer and its progress
+func GetTransferHandler(queue TransferQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transferID := mux.Vars(r)["transferId"]
+		transfer, err := queue.GetOwnershipTransfer(r.Context(), transferID)
+		if err != nil {
+			writeNotFoundOr(w, err, "Transfer not found", fmt.Sprintf("Transfer ID: %s does not exist", transferID), "Failed to load transfer")
+			return
+		}
+
+		common.WriteOKResponse(w, transfer)
+	}
+}
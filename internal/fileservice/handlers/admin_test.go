@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+func TestRedriveRepairsETagsAndCompletes(t *testing.T) {
+	file := multipartFile()
+	file.Status = storage.FileStatusCompletionFailed
+	db := newFakeMetadataStore(file)
+	db.chunks["file-2"] = []storage.FileChunk{
+		{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"aaa"`, Status: "uploaded"},
+		{FileID: "file-2", ChunkNumber: 2, S3PartNumber: 2, Status: "pending"},
+	}
+
+	var completed []storage.CompletedPart
+	s3 := &fakeObjectStore{
+		listParts: func(context.Context, *storage.MultipartUploadInfo) ([]storage.UploadedPart, error) {
+			return []storage.UploadedPart{{PartNumber: 1, ETag: `"aaa"`}, {PartNumber: 2, ETag: `"bbb"`}}, nil
+		},
+		completeMultipartUpload: func(_ context.Context, _ *storage.MultipartUploadInfo, parts []storage.CompletedPart) error {
+			completed = parts
+			return nil
+		},
+	}
+
+	rec := serve(RedriveUploadHandler(s3, db, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data RedriveResult `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Data.Completed || resp.Data.Repaired != 1 {
+		t.Errorf("result = %+v, want completed with 1 repaired chunk", resp.Data)
+	}
+	if len(completed) != 2 || completed[1].ETag != `"bbb"` {
+		t.Errorf("completed parts = %+v", completed)
+	}
+	if chunk := db.chunks["file-2"][1]; chunk.Status != "uploaded" || chunk.ETag != `"bbb"` {
+		t.Errorf("chunk 2 = %+v, want uploaded with the S3 ETag", chunk)
+	}
+	if status := db.files["file-2"].Status; status != storage.FileStatusCompleted {
+		t.Errorf("file status = %q, want %q", status, storage.FileStatusCompleted)
+	}
+}
+
+func TestRedriveDoesNotCompleteWithMissingParts(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{
+		{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"aaa"`, Status: "uploaded"},
+		{FileID: "file-2", ChunkNumber: 2, S3PartNumber: 2, ETag: `"bbb"`, Status: "uploaded"},
+	}
+	s3 := &fakeObjectStore{
+		listParts: func(context.Context, *storage.MultipartUploadInfo) ([]storage.UploadedPart, error) {
+			return []storage.UploadedPart{{PartNumber: 1, ETag: `"aaa"`}}, nil
+		},
+	}
+
+	rec := serve(RedriveUploadHandler(s3, db, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data RedriveResult `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Completed || len(resp.Data.MissingChunks) != 1 || resp.Data.MissingChunks[0] != 2 {
+		t.Errorf("result = %+v, want incomplete with chunk 2 missing", resp.Data)
+	}
+	if status := db.chunks["file-2"][1].Status; status != "failed" {
+		t.Errorf("missing chunk status = %q, want failed", status)
+	}
+}
+
+func TestRevokeURLsMovesObjectToNewKey(t *testing.T) {
+	file := singleFile()
+	oldKey := file.S3Key
+	db := newFakeMetadataStore(file)
+
+	var copiedTo string
+	var deleted []string
+	s3 := &fakeObjectStore{
+		generateDownloadURL: func(context.Context, string, string, storage.DownloadOptions) (string, error) {
+			return "https://example.test/download", nil
+		},
+		copyObject: func(_ context.Context, _, srcKey, dstKey string, _ int64) error {
+			if srcKey != oldKey {
+				t.Errorf("copied from %q, want %q", srcKey, oldKey)
+			}
+			copiedTo = dstKey
+			return nil
+		},
+		deleteObject: func(_ context.Context, _, s3Key string) error {
+			deleted = append(deleted, s3Key)
+			return nil
+		},
+	}
+
+	// Issuing a download URL records it in the audit trail
+	serve(GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, nil, storage.PresignedURLExpiry), http.MethodGet, map[string]string{"id": "file-1"}, "")
+	if len(db.urls["file-1"]) != 1 || db.urls["file-1"][0].Purpose != storage.URLPurposeDownload {
+		t.Fatalf("audit records = %+v, want one download URL", db.urls["file-1"])
+	}
+
+	rec := serve(RevokeFileURLsHandler(s3, db), http.MethodPost, map[string]string{"fileId": "file-1"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data URLRevocationResult `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.RevokedURLs != 1 || resp.Data.S3Key != copiedTo {
+		t.Errorf("result = %+v, want 1 revoked URL and new key %q", resp.Data, copiedTo)
+	}
+	if err := storage.ValidateObjectKey(file.UserID, copiedTo); err != nil || copiedTo == oldKey {
+		t.Errorf("new key %q is not a fresh key under the owner's prefix: %v", copiedTo, err)
+	}
+	if db.files["file-1"].S3Key != copiedTo {
+		t.Errorf("metadata key = %q, want %q", db.files["file-1"].S3Key, copiedTo)
+	}
+	if len(deleted) != 1 || deleted[0] != oldKey {
+		t.Errorf("deleted %v, want only the old key %q", deleted, oldKey)
+	}
+	if db.urls["file-1"][0].RevokedAt == nil {
+		t.Error("issued URL was not marked revoked")
+	}
+}
+
+func TestS3EventsRetireBackgroundUploadURL(t *testing.T) {
+	const fileID = "0b6d9b4e-1f2a-4c3d-9e8f-123456789abc"
+	file := singleFile()
+	file.FileID, file.Status, file.UploadURLTTL = fileID, storage.FileStatusUploading, 86400
+	file.S3Key = storage.ObjectKey(testUser, fileID, "my report.pdf")
+	uploadKey := file.S3Key
+	db := newFakeMetadataStore(file)
+	db.urls[fileID] = []storage.IssuedURL{*storage.NewIssuedURL(fileID, testUser, uploadKey, storage.URLPurposeUpload, 0, 24*time.Hour)}
+
+	var copiedTo string
+	var deleted []string
+	s3 := &fakeObjectStore{
+		copyObject: func(_ context.Context, _, _, dstKey string, _ int64) error {
+			copiedTo = dstKey
+			return nil
+		},
+		deleteObject: func(_ context.Context, _, s3Key string) error {
+			deleted = append(deleted, s3Key)
+			return nil
+		},
+	}
+	event := func(sequencer string) string {
+		return fmt.Sprintf(`{"Records": [{"eventName": "ObjectCreated:Put", "s3": {"object": {"key": %q, "size": 1024, "sequencer": %q}}}]}`,
+			url.QueryEscape(uploadKey), sequencer)
+	}
+	send := func(body string) S3EventResult {
+		t.Helper()
+		rec := serve(S3EventsHandler(s3, db, nil, nil), http.MethodPost, nil, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data S3EventResult `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	// The first PUT moves the object off the key the URL was signed for
+	if result := send(event("0A")); result.Consumed != 1 {
+		t.Fatalf("first PUT: result = %+v, want 1 consumed", result)
+	}
+	saved := db.files[fileID]
+	if saved.S3Key != copiedTo || saved.UploadConsumedAt == nil || len(deleted) != 1 || deleted[0] != uploadKey {
+		t.Fatalf("after first PUT: key %q (copied to %q), deleted %v", saved.S3Key, copiedTo, deleted)
+	}
+	if db.urls[fileID][0].RevokedAt == nil {
+		t.Error("upload URL was not marked revoked")
+	}
+
+	// A redelivered event changes nothing; a later PUT through the same URL is deleted
+	if result := send(event("0A")); result.Consumed+result.Rejected != 0 || len(deleted) != 1 {
+		t.Errorf("redelivery: result = %+v, deleted %v; want it ignored", result, deleted)
+	}
+	if result := send(event("0B")); result.Rejected != 1 || len(deleted) != 2 || deleted[1] != uploadKey {
+		t.Errorf("reuse: result = %+v, deleted %v; want the reused write deleted", result, deleted)
+	}
+	if db.files[fileID].S3Key != copiedTo {
+		t.Errorf("file key = %q, want it to stay %q", db.files[fileID].S3Key, copiedTo)
+	}
+}
+
+func TestS3EventsReportSingleUploadOnce(t *testing.T) {
+	const fileID = "0b6d9b4e-1f2a-4c3d-9e8f-123456789abc"
+	file := singleFile()
+	file.FileID, file.Status = fileID, storage.FileStatusUploading
+	file.S3Key = storage.ObjectKey(testUser, fileID, "report.pdf")
+	db := newFakeMetadataStore(file)
+	bus := make(fakePublisher, 4)
+
+	// A redelivered notification and a second PUT through the same URL aren't reported again
+	for _, sequencer := range []string{"0A", "0A", "0B"} {
+		body := fmt.Sprintf(`{"Records": [{"eventName": "ObjectCreated:Put", "s3": {"object": {"key": %q, "size": 1024, "sequencer": %q}}}]}`,
+			url.QueryEscape(file.S3Key), sequencer)
+		if rec := serve(S3EventsHandler(&fakeObjectStore{}, db, nil, bus), http.MethodPost, nil, body); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+		}
+	}
+	if event := bus.next(t); event.Type != events.TypeFileUploaded || event.File.FileID != fileID {
+		t.Errorf("event = %+v, want %s for %s", event, events.TypeFileUploaded, fileID)
+	}
+	select {
+	case event := <-bus:
+		t.Errorf("published %+v again", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if db.files[fileID].UploadReportedAt == nil {
+		t.Error("the report wasn't recorded on the file")
+	}
+}
+
+func TestRevokeURLsRejectsIncompleteMultipartUpload(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+
+	rec := serve(RevokeFileURLsHandler(&fakeObjectStore{}, db), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", rec.Code)
+	}
+}
+
+func TestClientVersionsReport(t *testing.T) {
+	db := newFakeMetadataStore()
+	h := ClientVersionsHandler(db)
+	if rec := serve(h, http.MethodGet, nil, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("before aggregation: status = %d, want 404", rec.Code)
+	}
+
+	db.metrics = &storage.SystemMetrics{
+		ClientVersions: []storage.ClientVersionUsage{
+			{App: "ios", Version: "3.0.1", Uploads: 4, Users: 2},
+			{App: "vibedrop-cli", Version: "1.4.2", Platform: "linux/amd64", Uploads: 9, Users: 1},
+		},
+		UnidentifiedUploads: 3,
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/client-versions?app=ios", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp struct {
+		Data ClientVersionReport `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Versions) != 1 || resp.Data.Versions[0].Version != "3.0.1" || resp.Data.UnidentifiedUploads != 3 {
+		t.Errorf("report = %+v, want only the ios version and 3 unidentified uploads", resp.Data)
+	}
+}
+
+func TestForceDeleteFile(t *testing.T) {
+	stray := &storage.FileMetadata{FileID: "file-3", TotalSize: 512, UploadType: "single", Status: storage.FileStatusCompleted,
+		UserID: "user-2", S3Key: storage.ObjectKey(testUser, "file-3", "notes.txt")}
+	db := newFakeMetadataStore(singleFile(), multipartFile(), stray)
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1}}
+	db.usage[testUser] = 1024
+	db.usage["user-2"] = 512
+
+	var deleted []string
+	aborted := false
+	s3 := &fakeObjectStore{
+		deleteObject: func(_ context.Context, _, s3Key string) error {
+			deleted = append(deleted, s3Key)
+			return nil
+		},
+		abortMultipartUpload: func(context.Context, *storage.MultipartUploadInfo) error {
+			aborted = true
+			return nil
+		},
+	}
+
+	// Another user's file can go, whatever the request's user
+	for _, fileID := range []string{"file-1", "file-2", "file-3"} {
+		rec := serve(ForceDeleteFileHandler(s3, db, nil), http.MethodDelete, map[string]string{"fileId": fileID}, "")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, want 204 (body: %s)", fileID, rec.Code, rec.Body.String())
+		}
+	}
+	if !aborted || db.chunks["file-2"] != nil {
+		t.Errorf("upload in progress wasn't aborted: aborted %v, chunks %v", aborted, db.chunks["file-2"])
+	}
+	if len(deleted) != 1 || deleted[0] != singleFile().S3Key {
+		t.Errorf("deleted objects %v, want only file-1's; file-3's key isn't its owner's", deleted)
+	}
+	if len(db.files) != 0 || db.usage[testUser] != 0 || db.usage["user-2"] != 0 {
+		t.Errorf("after deletes: files %v, usage %v", db.files, db.usage)
+	}
+
+	rec := serve(ForceDeleteFileHandler(s3, db, nil), http.MethodDelete, map[string]string{"fileId": "file-1"}, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("deleting again: status = %d, want 404", rec.Code)
+	}
+}
+
+type fakeUserStore struct {
+	users map[string]*storage.User
+}
+
+func (f *fakeUserStore) GetUserByID(_ context.Context, userID string) (*storage.User, error) {
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (f *fakeUserStore) ListUsers(context.Context) ([]storage.User, error) {
+	var users []storage.User
+	for _, user := range f.users {
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+func (f *fakeUserStore) UpdateUser(_ context.Context, user *storage.User) error {
+	copied := *user
+	f.users[user.UserID] = &copied
+	return nil
+}
+
+func TestSuspendAndUnsuspendUser(t *testing.T) {
+	users := &fakeUserStore{users: map[string]*storage.User{"user-2": {UserID: "user-2", Username: "bob"}}}
+	vars := map[string]string{"userId": "user-2"}
+
+	rec := serve(SuspendUserHandler(users), http.MethodPut, vars, `{"reason":"  chargeback  "}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("suspend: status = %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	suspendedAt := users.users["user-2"].SuspendedAt
+	if suspendedAt == "" || users.users["user-2"].SuspendedReason != "chargeback" {
+		t.Fatalf("after suspend: %+v", users.users["user-2"])
+	}
+
+	// Suspending again keeps when the suspension began
+	users.users["user-2"].SuspendedAt = "2024-01-01T00:00:00Z"
+	if rec := serve(SuspendUserHandler(users), http.MethodPut, vars, ""); rec.Code != http.StatusOK {
+		t.Fatalf("resuspend: status = %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if user := users.users["user-2"]; user.SuspendedAt != "2024-01-01T00:00:00Z" || user.SuspendedReason != "" {
+		t.Errorf("after resuspend: %+v", user)
+	}
+
+	if rec := serve(UnsuspendUserHandler(users), http.MethodDelete, vars, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("unsuspend: status = %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if users.users["user-2"].IsSuspended() {
+		t.Errorf("still suspended: %+v", users.users["user-2"])
+	}
+	if rec := serve(UnsuspendUserHandler(users), http.MethodDelete, vars, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unsuspending again: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestSetUserRoleRejectsUnknownRole(t *testing.T) {
+	users := &fakeUserStore{users: map[string]*storage.User{"user-2": {UserID: "user-2"}}}
+	vars := map[string]string{"userId": "user-2"}
+
+	if rec := serve(SetUserRoleHandler(users), http.MethodPut, vars, `{"role":"root"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown role: status = %d, want 400", rec.Code)
+	}
+	if rec := serve(SetUserRoleHandler(users), http.MethodPut, vars, `{"role":"admin"}`); rec.Code != http.StatusOK {
+		t.Fatalf("admin role: status = %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if role := users.users["user-2"].RoleOrDefault(); role != "admin" {
+		t.Errorf("role = %q, want admin", role)
+	}
+}
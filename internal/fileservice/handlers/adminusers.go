@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/janitor"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// maxSuspensionReason caps the reason an admin records with a suspension
+const maxSuspensionReason = 500
+
+// AdminUser is an account as admins see it: the profile plus any suspension
+type AdminUser struct {
+	UserProfile
+	SuspendedAt     string `json:"suspended_at,omitempty"`
+	SuspendedReason string `json:"suspended_reason,omitempty"`
+}
+
+// SuspendUserRequest records why an account is being suspended
+type SuspendUserRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// SetRoleRequest gives a user one of auth.KnownRoles
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func adminUser(user *storage.User) AdminUser {
+	return AdminUser{
+		UserProfile:     userProfile(user),
+		SuspendedAt:     user.SuspendedAt,
+		SuspendedReason: user.SuspendedReason,
+	}
+}
+
+// ListUsersHandler lists every account, oldest first
+func ListUsersHandler(users AdminUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all, err := users.ListUsers(r.Context())
+		if err != nil {
+			writeStorageError(w, "Failed to list users", err, common.WriteDatabaseError)
+			return
+		}
+
+		list := make([]AdminUser, len(all))
+		for i := range all {
+			list[i] = adminUser(&all[i])
+		}
+		common.WriteOKResponse(w, map[string]interface{}{
+			"users": list,
+			"count": len(list),
+		})
+	}
+}
+
+// AdminUserFilesHandler lists any user's files, in every status, for support and abuse reviews
+func AdminUserFilesHandler(users UserStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := adminTargetUser(w, r, users)
+		if !ok {
+			return
+		}
+
+		metadataList, err := dynamoClient.ListUserFiles(r.Context(), user.UserID)
+		if err != nil {
+			writeStorageError(w, "Failed to list files", err, common.WriteDatabaseError)
+			return
+		}
+
+		files := make([]FileMetadata, len(metadataList))
+		for i := range metadataList {
+			files[i] = toFileMetadataResponse(&metadataList[i])
+		}
+		common.WriteOKResponse(w, map[string]interface{}{
+			"files": files,
+			"count": len(files),
+		})
+	}
+}
+
+// AdminUserUsageHandler returns the bytes counted against any user's storage quota
+func AdminUserUsageHandler(users UserStore, dynamoClient MetadataStore, quotaBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := adminTargetUser(w, r, users)
+		if !ok {
+			return
+		}
+
+		usage, err := storageUsage(r.Context(), dynamoClient, user.UserID, quotaBytes)
+		if err != nil {
+			writeStorageError(w, "Failed to load storage usage", err, common.WriteDatabaseError)
+			return
+		}
+		common.WriteOKResponse(w, usage)
+	}
+}
+
+// ForceDeleteFileHandler deletes any user's file whatever its status: an upload in progress
+// is aborted, and otherwise the object goes first, then the chunk records and metadata, as
+// DeleteFileHandler does for the owner. An object key outside the owner's prefix isn't
+// theirs; only its records go. The file is published to bus as file.deleted.
+func ForceDeleteFileHandler(s3Client ObjectStore, dynamoClient MetadataStore, bus events.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+		metadata, err := dynamoClient.GetFileMetadata(r.Context(), fileID)
+		if err != nil {
+			writeNotFoundOr(w, err, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID), "Failed to load file")
+			return
+		}
+
+		if err := forceDeleteFile(r.Context(), s3Client, dynamoClient, metadata); err != nil {
+			common.Logger(r.Context()).Error("Failed to force-delete file", "file_id", fileID, "error", err)
+			writeStorageError(w, "Failed to delete file", err, common.WriteS3Error)
+			return
+		}
+		publish(r.Context(), bus, events.FileDeleted(metadata))
+
+		common.Logger(r.Context()).Info("Admin deleted file", "security_event", "file_force_deleted", "file_id", fileID, "owner_id", metadata.UserID)
+		common.WriteNoContentResponse(w)
+	}
+}
+
+func forceDeleteFile(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata) error {
+	if metadata.Status == storage.FileStatusUploading && metadata.S3UploadID != nil {
+		return janitor.AbortUpload(ctx, s3Client, dynamoClient, metadata)
+	}
+
+	if err := storage.ValidateObjectKey(metadata.UserID, metadata.S3Key); err != nil {
+		common.Logger(ctx).Warn("Not deleting object outside user's prefix", "file_id", metadata.FileID, "user_id", metadata.UserID)
+	} else if err := s3Client.DeleteObject(ctx, metadata.Bucket, metadata.S3Key); err != nil {
+		return err
+	}
+	if metadata.UploadType == "multipart" {
+		if err := dynamoClient.DeleteFileChunks(ctx, metadata.FileID); err != nil {
+			return err
+		}
+	}
+	if err := dynamoClient.DeleteFileMetadata(ctx, metadata.FileID); err != nil {
+		return err
+	}
+	releaseStorage(ctx, dynamoClient, metadata.UserID, metadata.TotalSize)
+	return nil
+}
+
+// SuspendUserHandler suspends an account: it can no longer sign in, refresh its session or
+// mint scoped tokens. Tokens already issued last until they expire. Suspending a suspended
+// account only replaces the reason.
+func SuspendUserHandler(users AdminUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SuspendUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if len(req.Reason) > maxSuspensionReason {
+			common.WriteValidationError(w, "Reason too long", fmt.Sprintf("reason must be at most %d characters", maxSuspensionReason))
+			return
+		}
+
+		user, ok := adminTargetUser(w, r, users)
+		if !ok {
+			return
+		}
+		if !user.IsSuspended() {
+			user.SuspendedAt = time.Now().UTC().Format(time.RFC3339)
+		}
+		user.SuspendedReason = req.Reason
+		if err := users.UpdateUser(r.Context(), user); err != nil {
+			writeStorageError(w, "Failed to suspend user", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.Logger(r.Context()).Info("Admin suspended account", "security_event", "account_suspended", "suspended_user_id", user.UserID)
+		common.WriteOKResponse(w, adminUser(user))
+	}
+}
+
+// UnsuspendUserHandler lifts an account's suspension
+func UnsuspendUserHandler(users AdminUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := adminTargetUser(w, r, users)
+		if !ok {
+			return
+		}
+		if !user.IsSuspended() {
+			common.WriteNotFoundError(w, "User is not suspended", fmt.Sprintf("User %s has no suspension in force", user.UserID))
+			return
+		}
+
+		user.SuspendedAt, user.SuspendedReason = "", ""
+		if err := users.UpdateUser(r.Context(), user); err != nil {
+			writeStorageError(w, "Failed to lift suspension", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.Logger(r.Context()).Info("Admin lifted suspension", "security_event", "account_unsuspended", "suspended_user_id", user.UserID)
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// SetUserRoleHandler changes a user's role. Tokens carry the role they were issued with, so
+// the change reaches the user's session at its next refresh.
+func SetUserRoleHandler(users AdminUserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SetRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		if !auth.IsKnownRole(req.Role) {
+			common.WriteValidationError(w, "Invalid role", "role must be one of: "+strings.Join(auth.KnownRoles, ", "))
+			return
+		}
+
+		user, ok := adminTargetUser(w, r, users)
+		if !ok {
+			return
+		}
+		user.Role = req.Role
+		if err := users.UpdateUser(r.Context(), user); err != nil {
+			writeStorageError(w, "Failed to set role", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.Logger(r.Context()).Info("Admin set user role", "security_event", "role_changed", "target_user_id", user.UserID, "role", req.Role)
+		common.WriteOKResponse(w, adminUser(user))
+	}
+}
+
+// adminTargetUser loads the user named by the route's userId, writing a 404 if there's none
+func adminTargetUser(w http.ResponseWriter, r *http.Request, users UserStore) (*storage.User, bool) {
+	userID := mux.Vars(r)["userId"]
+	user, err := users.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeNotFoundOr(w, err, "User not found", fmt.Sprintf("User ID: %s does not exist", userID), "Failed to load user")
+		return nil, false
+	}
+	return user, true
+}
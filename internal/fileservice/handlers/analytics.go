@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"vibe-drop/internal/common"
+)
+
+// UserAnalyticsHandler returns the latest precomputed storage analytics for the user
+func UserAnalyticsHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		analytics, err := dynamoClient.GetUserAnalytics(r.Context(), userID)
+		if err != nil {
+			writeNotFoundOr(w, err, "Analytics not available yet",
+				"Storage analytics are computed periodically; try again after the next aggregation run",
+				"Failed to load analytics")
+			return
+		}
+
+		common.WriteOKResponse(w, analytics)
+	}
+}
+
+// StorageUsage is a user's storage consumption against their quota
+type StorageUsage struct {
+	UserID         string `json:"user_id"`
+	UsedBytes      int64  `json:"used_bytes"`
+	LimitBytes     int64  `json:"limit_bytes"`
+	RemainingBytes int64  `json:"remaining_bytes"`
+}
+
+// UserUsageHandler returns the bytes counted against the user's storage quota, for storage meters
+func UserUsageHandler(dynamoClient MetadataStore, quotaBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		usage, err := storageUsage(r.Context(), dynamoClient, userID, quotaBytes)
+		if err != nil {
+			writeStorageError(w, "Failed to load storage usage", err, common.WriteDatabaseError)
+			return
+		}
+		common.WriteOKResponse(w, usage)
+	}
+}
+
+func storageUsage(ctx context.Context, dynamoClient MetadataStore, userID string, quotaBytes int64) (StorageUsage, error) {
+	used, err := dynamoClient.GetStorageUsage(ctx, userID)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+
+	remaining := quotaBytes - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return StorageUsage{
+		UserID:         userID,
+		UsedBytes:      used,
+		LimitBytes:     quotaBytes,
+		RemainingBytes: remaining,
+	}, nil
+}
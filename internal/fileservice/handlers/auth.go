@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"vibe-drop/internal/auth"
 	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/loginguard"
 	"vibe-drop/internal/fileservice/storage"
 )
 
@@ -22,8 +28,10 @@ type RegisterRequest struct {
 
 // RegisterResponse represents what we send back after successful registration
 type RegisterResponse struct {
-	User  UserInfo `json:"user"`
-	Token string   `json:"token"`
+	User         UserInfo  `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // When Token expires
 }
 
 // UserInfo represents user data we send to client (no password!)
@@ -38,7 +46,17 @@ type UserInfo struct {
 type AuthServices struct {
 	JWTService      *auth.JWTService
 	PasswordService *auth.PasswordService
-	DynamoClient    *storage.DynamoClient
+	DynamoClient    storage.MetadataStore
+	RefreshTokenTTL time.Duration     // How long a refresh token can be exchanged before the user must sign in again
+	LoginGuard      *loginguard.Guard // Locks out repeated failed sign-ins; nil turns lockout off
+	TOTPBox         *auth.SecretBox   // Encrypts TOTP secrets; nil turns two-factor enrollment off
+	TOTPIssuer      string            // Name authenticator apps list accounts under
+
+	// Sends the token confirming a new email address; nil turns email changes off
+	EmailVerifier        EmailVerifier
+	EmailVerificationTTL time.Duration // How long that token can be presented
+
+	Events events.Publisher // Receives user.registered; nil publishes nothing
 }
 
 // RegisterHandler handles user registration
@@ -59,8 +77,7 @@ func RegisterHandler(authServices *AuthServices) http.HandlerFunc {
 		}
 		
 		if validationErrors := common.ValidateUserRegistration(validationReq); len(validationErrors) > 0 {
-			errorCode, message, details := common.FormatValidationErrors(validationErrors)
-			common.WriteErrorResponse(w, http.StatusBadRequest, errorCode, message, details)
+			common.WriteValidationErrors(w, validationErrors)
 			return
 		}
 
@@ -68,15 +85,20 @@ func RegisterHandler(authServices *AuthServices) http.HandlerFunc {
 		existingUser, err := authServices.DynamoClient.GetUserByEmail(r.Context(), req.Email)
 		if err == nil && existingUser != nil {
 			// User exists - don't reveal this for security, but log it
-			log.Printf("Registration attempt for existing email: %s", req.Email)
+			common.Logger(r.Context()).Info("Registration attempt for existing email", "email", req.Email)
 			common.WriteConflictError(w, "User already exists", "A user with this email already exists")
 			return
 		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			common.Logger(r.Context()).Error("Failed to look up user by email", "error", err)
+			writeAuthDatabaseError(w, err, "Registration failed", "Unable to check for an existing account")
+			return
+		}
 
 		// Step 4: Hash the password securely
 		hashedPassword, err := authServices.PasswordService.HashPassword(req.Password)
 		if err != nil {
-			log.Printf("Failed to hash password: %v", err)
+			common.Logger(r.Context()).Error("Failed to hash password", "error", err)
 			common.WriteInternalServerError(w, "Registration failed", "Unable to process registration")
 			return
 		}
@@ -92,15 +114,21 @@ func RegisterHandler(authServices *AuthServices) http.HandlerFunc {
 
 		// Step 6: Save user to database
 		if err := authServices.DynamoClient.CreateUser(r.Context(), user); err != nil {
-			log.Printf("Failed to create user: %v", err)
-			common.WriteDatabaseError(w, "Registration failed", "Unable to create user account")
+			if errors.Is(err, storage.ErrConditionFailed) {
+				// Lost a race with another registration for the same email
+				common.WriteConflictError(w, "User already exists", "A user with this email already exists")
+				return
+			}
+			common.Logger(r.Context()).Error("Failed to create user", "error", err)
+			writeAuthDatabaseError(w, err, "Registration failed", "Unable to create user account")
 			return
 		}
+		publish(r.Context(), authServices.Events, events.UserRegistered(user))
 
-		// Step 7: Generate JWT token for immediate login
-		token, err := authServices.JWTService.GenerateToken(user.UserID, user.Username)
+		// Step 7: Start a session (access + refresh token) for immediate login
+		session, err := startSession(r.Context(), authServices, user)
 		if err != nil {
-			log.Printf("Failed to generate token for new user %s: %v", user.UserID, err)
+			common.Logger(r.Context()).Error("Failed to start session for new user", "user_id", user.UserID, "error", err)
 			common.WriteInternalServerError(w, "Registration failed", "Unable to generate access token")
 			return
 		}
@@ -113,11 +141,13 @@ func RegisterHandler(authServices *AuthServices) http.HandlerFunc {
 				Email:     user.Email,
 				CreatedAt: user.CreatedAt,
 			},
-			Token: token,
+			Token:        session.Token,
+			RefreshToken: session.RefreshToken,
+			ExpiresAt:    session.ExpiresAt,
 		}
 
 		common.WriteCreatedResponse(w, response)
-		log.Printf("Successfully registered new user: %s (%s)", user.Username, user.Email)
+		common.Logger(r.Context()).Info("Registered new user", "user_id", user.UserID, "username", user.Username, "email", user.Email)
 	}
 }
 
@@ -125,12 +155,15 @@ func RegisterHandler(authServices *AuthServices) http.HandlerFunc {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	TOTPCode string `json:"totp_code,omitempty"` // Required once two-factor authentication is enabled
 }
 
 // LoginResponse represents what we send back after successful login
 type LoginResponse struct {
-	User  UserInfo `json:"user"`
-	Token string   `json:"token"`
+	User         UserInfo  `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // When Token expires
 }
 
 // LoginHandler handles user login
@@ -144,46 +177,107 @@ func LoginHandler(authServices *AuthServices) http.HandlerFunc {
 		}
 
 		// Step 2: Validate input using comprehensive validation
-		if emailErrors := common.ValidateEmail(req.Email); len(emailErrors) > 0 {
-			firstError := emailErrors[0]
-			common.WriteErrorResponse(w, http.StatusBadRequest, firstError.Code, firstError.Message, 
-				fmt.Sprintf("Field: %s", firstError.Field))
-			return
-		}
-		
+		validationErrors := common.ValidateEmail(req.Email)
 		if req.Password == "" {
-			common.WriteErrorResponse(w, http.StatusBadRequest, common.ErrorCodePasswordRequired, 
-				"Password is required", "Field: password")
+			validationErrors = append(validationErrors, common.ValidationError{
+				Field:   "password",
+				Code:    common.ErrorCodePasswordRequired,
+				Message: "Password is required",
+			})
+		}
+		if len(validationErrors) > 0 {
+			common.WriteValidationErrors(w, validationErrors)
 			return
 		}
 
-		// Step 3: Find user by email
+		// Step 3: Refuse locked accounts and addresses before checking anything, the same
+		// way whether or not the account exists
+		address := authServices.LoginGuard.ClientAddress(r)
+		if authServices.LoginGuard != nil {
+			lock, err := authServices.LoginGuard.Check(r.Context(), req.Email, address)
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to check login lockout", "error", err)
+				writeAuthDatabaseError(w, err, "Login failed", "Unable to check sign-in attempts")
+				return
+			}
+			if lock != nil {
+				common.Logger(r.Context()).Warn("Login refused: locked out", "security_event", "login_refused",
+					"email", req.Email, "client_address", address, "lock_key", lock.Key, "locked_until", lock.Until)
+				writeLoginLocked(w, lock.Until)
+				return
+			}
+		}
+
+		// Step 4: Find user by email
 		user, err := authServices.DynamoClient.GetUserByEmail(r.Context(), req.Email)
-		if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
 			// Don't reveal whether user exists or not - security best practice
-			log.Printf("Login attempt for non-existent email: %s", req.Email)
+			common.Logger(r.Context()).Info("Login attempt for non-existent email", "security_event", "login_failure",
+				"email", req.Email, "client_address", address)
+			recordLoginFailure(r.Context(), authServices, req.Email, address)
 			common.WriteUnauthorizedError(w, "Invalid credentials", "Email or password is incorrect")
 			return
 		}
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to look up user by email", "error", err)
+			writeAuthDatabaseError(w, err, "Login failed", "Unable to look up account")
+			return
+		}
 
-		// Step 4: Verify password
+		// Step 5: Verify password
 		err = authServices.PasswordService.VerifyPassword(user.PasswordHash, req.Password)
 		if err != nil {
 			// Wrong password
-			log.Printf("Failed login attempt for user %s: invalid password", user.Email)
+			common.Logger(r.Context()).Warn("Failed login attempt: invalid password", "security_event", "login_failure",
+				"user_id", user.UserID, "email", user.Email, "client_address", address)
+			recordLoginFailure(r.Context(), authServices, req.Email, address)
 			common.WriteUnauthorizedError(w, "Invalid credentials", "Email or password is incorrect")
 			return
 		}
 
-		// Step 5: Generate JWT token
-		token, err := authServices.JWTService.GenerateToken(user.UserID, user.Username)
+		// Step 6: With two-factor authentication on, the password alone isn't enough
+		if user.TOTPEnabled {
+			if req.TOTPCode == "" {
+				common.WriteErrorResponse(w, http.StatusUnauthorized, common.ErrorCodeTOTPRequired,
+					"Two-factor code required", "Send the code from your authenticator app as totp_code")
+				return
+			}
+			valid, err := verifyLoginTOTP(r.Context(), authServices, user, req.TOTPCode)
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to check TOTP code", "user_id", user.UserID, "error", err)
+				writeAuthDatabaseError(w, err, "Login failed", "Unable to check the two-factor code")
+				return
+			}
+			if !valid {
+				common.Logger(r.Context()).Warn("Failed login attempt: invalid TOTP code", "security_event", "login_failure",
+					"user_id", user.UserID, "email", user.Email, "client_address", address)
+				recordLoginFailure(r.Context(), authServices, req.Email, address)
+				writeInvalidTOTPCode(w, http.StatusUnauthorized)
+				return
+			}
+		}
+		if authServices.LoginGuard != nil {
+			if err := authServices.LoginGuard.Succeeded(r.Context(), req.Email); err != nil {
+				common.Logger(r.Context()).Warn("Failed to clear login failures", "user_id", user.UserID, "error", err)
+			}
+		}
+		// Only tell the account's owner it is suspended, once they have proved they are
+		if user.IsSuspended() {
+			common.Logger(r.Context()).Warn("Login refused: account suspended", "security_event", "login_refused",
+				"user_id", user.UserID, "client_address", address)
+			writeAccountSuspended(w, user)
+			return
+		}
+
+		// Step 7: Start a session (access + refresh token)
+		session, err := startSession(r.Context(), authServices, user)
 		if err != nil {
-			log.Printf("Failed to generate token for user %s: %v", user.UserID, err)
+			common.Logger(r.Context()).Error("Failed to start session", "user_id", user.UserID, "error", err)
 			common.WriteInternalServerError(w, "Login failed", "Unable to generate access token")
 			return
 		}
 
-		// Step 6: Return success response
+		// Step 8: Return success response
 		response := LoginResponse{
 			User: UserInfo{
 				UserID:    user.UserID,
@@ -191,12 +285,333 @@ func LoginHandler(authServices *AuthServices) http.HandlerFunc {
 				Email:     user.Email,
 				CreatedAt: user.CreatedAt,
 			},
-			Token: token,
+			Token:        session.Token,
+			RefreshToken: session.RefreshToken,
+			ExpiresAt:    session.ExpiresAt,
 		}
 
 		common.WriteOKResponse(w, response)
-		log.Printf("Successful login for user: %s (%s)", user.Username, user.Email)
+		common.Logger(r.Context()).Info("Successful login", "user_id", user.UserID, "username", user.Username, "email", user.Email)
 	}
 }
 
+// recordLoginFailure counts a failed sign-in and logs any lock it starts. A failure to
+// count is logged but doesn't change the response.
+func recordLoginFailure(ctx context.Context, authServices *AuthServices, email, address string) {
+	if authServices.LoginGuard == nil {
+		return
+	}
+	locks, err := authServices.LoginGuard.Failed(ctx, email, address)
+	if err != nil {
+		common.Logger(ctx).Error("Failed to record login failure", "error", err)
+	}
+	for _, lock := range locks {
+		common.Logger(ctx).Warn("Login locked out after repeated failures", "security_event", "login_locked",
+			"email", email, "client_address", address, "lock_key", lock.Key, "locked_until", lock.Until)
+	}
+}
+
+// writeLoginLocked sends 429 with Retry-After for a sign-in refused until until
+func writeLoginLocked(w http.ResponseWriter, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	common.WriteErrorResponse(w, http.StatusTooManyRequests, common.ErrorCodeTooManyRequests,
+		"Too many failed sign-in attempts; try again later",
+		fmt.Sprintf("Sign-in is locked until %s", until.UTC().Format(time.RFC3339)))
+}
+
+// RefreshRequest carries the refresh token for /auth/refresh and /auth/logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// session is the token pair handed to a signed-in client
+type session struct {
+	Token        string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// startSession issues an access token and a refresh token that starts a new family
+func startSession(ctx context.Context, authServices *AuthServices, user *storage.User) (*session, error) {
+	now := time.Now()
+	token, err := authServices.JWTService.GenerateToken(user.UserID, user.Username, user.RoleOrDefault())
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, record, err := newRefreshToken(user.UserID, user.Username, uuid.New().String(), now, now, authServices.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := authServices.DynamoClient.SaveRefreshToken(ctx, record); err != nil {
+		return nil, err
+	}
+	return &session{Token: token, RefreshToken: refreshToken, ExpiresAt: now.Add(authServices.JWTService.Expiry())}, nil
+}
+
+// newRefreshToken generates a refresh token in familyID and the record to store for it
+func newRefreshToken(userID, username, familyID string, authTime, now time.Time, ttl time.Duration) (string, *storage.RefreshToken, error) {
+	token, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &storage.RefreshToken{
+		TokenHash: hash,
+		FamilyID:  familyID,
+		UserID:    userID,
+		Username:  username,
+		AuthTime:  authTime.Format(time.RFC3339),
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(ttl).Format(time.RFC3339),
+	}, nil
+}
 
+// RefreshHandler exchanges a refresh token for a new access token and a new refresh token.
+// The presented token is revoked as part of the rotation; presenting it again means it
+// was stolen or replayed, so the whole family is revoked and the user must sign in again.
+func RefreshHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteValidationError(w, "Invalid request body", err.Error())
+			return
+		}
+		if req.RefreshToken == "" {
+			common.WriteValidationError(w, "Invalid refresh token", "refresh_token is required")
+			return
+		}
+
+		oldHash := auth.HashRefreshToken(req.RefreshToken)
+		current, err := authServices.DynamoClient.GetRefreshToken(r.Context(), oldHash)
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			common.WriteUnauthorizedError(w, "Invalid refresh token", "Refresh token is not recognised")
+			return
+		}
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to look up refresh token", "error", err)
+			writeAuthDatabaseError(w, err, "Token refresh failed", "Unable to look up refresh token")
+			return
+		}
+
+		if current.RevokedAt != nil {
+			revokeFamilyOnReuse(r.Context(), authServices, current)
+			common.WriteUnauthorizedError(w, "Invalid refresh token", "Refresh token has been revoked; sign in again")
+			return
+		}
+		now := time.Now()
+		if current.Expired(now) {
+			common.WriteUnauthorizedError(w, "Invalid refresh token", "Refresh token has expired; sign in again")
+			return
+		}
+
+		user, err := authServices.DynamoClient.GetUserByID(r.Context(), current.UserID)
+		if errors.Is(err, storage.ErrNotFound) {
+			common.Logger(r.Context()).Warn("Refresh for missing user", "user_id", current.UserID, "error", err)
+			common.WriteUnauthorizedError(w, "Invalid refresh token", "Account no longer exists")
+			return
+		}
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to load user for refresh", "user_id", current.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Token refresh failed", "Unable to look up account")
+			return
+		}
+		if user.IsSuspended() {
+			// The session ends here; the user can't sign in again until it's lifted
+			if _, err := authServices.DynamoClient.RevokeRefreshTokenFamily(r.Context(), current.FamilyID); err != nil {
+				common.Logger(r.Context()).Warn("Failed to revoke suspended user's session", "user_id", user.UserID, "family_id", current.FamilyID, "error", err)
+			}
+			writeAccountSuspended(w, user)
+			return
+		}
+
+		authTime, err := time.Parse(time.RFC3339, current.AuthTime)
+		if err != nil {
+			authTime = now
+		}
+		refreshToken, next, err := newRefreshToken(user.UserID, user.Username, current.FamilyID, authTime, now, authServices.RefreshTokenTTL)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to generate refresh token", "user_id", user.UserID, "error", err)
+			common.WriteInternalServerError(w, "Token refresh failed", "Unable to generate refresh token")
+			return
+		}
+		if err := authServices.DynamoClient.RotateRefreshToken(r.Context(), oldHash, next); err != nil {
+			if errors.Is(err, storage.ErrRefreshTokenRevoked) {
+				// Lost a race with another refresh using the same token
+				revokeFamilyOnReuse(r.Context(), authServices, current)
+				common.WriteUnauthorizedError(w, "Invalid refresh token", "Refresh token has been revoked; sign in again")
+				return
+			}
+			common.Logger(r.Context()).Error("Failed to rotate refresh token", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Token refresh failed", "Unable to rotate refresh token")
+			return
+		}
+
+		token, err := authServices.JWTService.GenerateRefreshedToken(user.UserID, user.Username, user.RoleOrDefault(), authTime)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to generate token", "user_id", user.UserID, "error", err)
+			common.WriteInternalServerError(w, "Token refresh failed", "Unable to generate access token")
+			return
+		}
+
+		response := LoginResponse{
+			User: UserInfo{
+				UserID:    user.UserID,
+				Username:  user.Username,
+				Email:     user.Email,
+				CreatedAt: user.CreatedAt,
+			},
+			Token:        token,
+			RefreshToken: refreshToken,
+			ExpiresAt:    now.Add(authServices.JWTService.Expiry()),
+		}
+		common.WriteOKResponse(w, response)
+	}
+}
+
+// revokeFamilyOnReuse ends the session a replayed refresh token belongs to
+func revokeFamilyOnReuse(ctx context.Context, authServices *AuthServices, token *storage.RefreshToken) {
+	revoked, err := authServices.DynamoClient.RevokeRefreshTokenFamily(ctx, token.FamilyID)
+	if err != nil {
+		common.Logger(ctx).Error("Failed to revoke refresh token family", "family_id", token.FamilyID, "user_id", token.UserID, "error", err)
+		return
+	}
+	common.Logger(ctx).Warn("Refresh token reuse; revoked token family", "user_id", token.UserID, "family_id", token.FamilyID, "revoked", revoked)
+}
+
+// writeAccountSuspended sends 403 ACCOUNT_SUSPENDED for a suspended user, with the reason
+// the admin gave
+func writeAccountSuspended(w http.ResponseWriter, user *storage.User) {
+	details := "An administrator suspended this account"
+	if user.SuspendedReason != "" {
+		details += ": " + user.SuspendedReason
+	}
+	common.WriteErrorResponse(w, http.StatusForbidden, common.ErrorCodeAccountSuspended, "Account suspended", details)
+}
+
+// writeAuthDatabaseError sends 503 if the database is throttling or timed out and a 500
+// with details otherwise. Auth responses don't echo storage errors, which can name users or tokens.
+func writeAuthDatabaseError(w http.ResponseWriter, err error, message, details string) {
+	switch {
+	case errors.Is(err, storage.ErrThrottled):
+		writeThrottled(w, message)
+	case errors.Is(err, storage.ErrTimeout):
+		writeTimedOut(w, message)
+	default:
+		common.WriteDatabaseError(w, message, details)
+	}
+}
+
+// LogoutHandler revokes the presented refresh token so the session can't be extended.
+// Access tokens already issued stay valid until they expire, which is why they are short-lived.
+func LogoutHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteValidationError(w, "Invalid request body", err.Error())
+			return
+		}
+		if req.RefreshToken == "" {
+			common.WriteValidationError(w, "Invalid refresh token", "refresh_token is required")
+			return
+		}
+
+		if err := authServices.DynamoClient.RevokeRefreshToken(r.Context(), auth.HashRefreshToken(req.RefreshToken)); err != nil {
+			common.Logger(r.Context()).Error("Failed to revoke refresh token", "error", err)
+			writeAuthDatabaseError(w, err, "Logout failed", "Unable to revoke refresh token")
+			return
+		}
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// Scoped token lifetimes
+const (
+	defaultScopedTokenExpiry = 24 * time.Hour
+	maxScopedTokenExpiry     = 30 * 24 * time.Hour
+)
+
+// CreateTokenRequest represents a request for a capability-limited token
+type CreateTokenRequest struct {
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int64    `json:"expires_in,omitempty"` // Seconds; defaults to 24 hours
+}
+
+// CreateTokenResponse returns the scoped token and what it grants
+type CreateTokenResponse struct {
+	Token     string    `json:"token"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateScopedTokenHandler issues a token limited to the requested scopes for the authenticated user,
+// so integrations can be given upload-only or read-only credentials. A suspended user's login
+// token, still valid until it expires, can't be used to mint longer-lived ones.
+func CreateScopedTokenHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, username, err := auth.GetUserFromContext(r.Context())
+		if err != nil {
+			common.WriteUnauthorizedError(w, "Authentication required", err.Error())
+			return
+		}
+		user, ok := currentUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		if user.IsSuspended() {
+			writeAccountSuspended(w, user)
+			return
+		}
+
+		var req CreateTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteValidationError(w, "Invalid request body", err.Error())
+			return
+		}
+
+		if err := auth.ValidateScopes(req.Scopes); err != nil {
+			common.WriteValidationError(w, "Invalid scopes", err.Error())
+			return
+		}
+
+		expiry := defaultScopedTokenExpiry
+		if req.ExpiresIn != 0 {
+			expiry = time.Duration(req.ExpiresIn) * time.Second
+			if expiry <= 0 || expiry > maxScopedTokenExpiry {
+				common.WriteValidationError(w, "Invalid expires_in",
+					fmt.Sprintf("expires_in must be between 1 and %d seconds", int64(maxScopedTokenExpiry.Seconds())))
+				return
+			}
+		}
+
+		token, err := authServices.JWTService.GenerateScopedToken(userID, username, req.Scopes, expiry)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to generate scoped token", "user_id", userID, "error", err)
+			common.WriteInternalServerError(w, "Token creation failed", "Unable to generate access token")
+			return
+		}
+
+		response := CreateTokenResponse{
+			Token:     token,
+			Scopes:    req.Scopes,
+			ExpiresAt: time.Now().Add(expiry),
+		}
+
+		common.WriteCreatedResponse(w, response)
+		common.Logger(r.Context()).Info("Issued scoped token", "user_id", userID, "scopes", req.Scopes)
+	}
+}
+
+// JWKSHandler publishes the public keys RS256 and ES256 tokens are signed with, in the
+// standard JWKS form rather than the usual response envelope, so other services and off-the-
+// shelf JWT libraries can check tokens themselves. The set is empty with HMAC signing.
+func JWKSHandler(jwtService *auth.JWTService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// A new key should be listed for this long before it is moved first to sign
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(jwtService.JWKS())
+	}
+}
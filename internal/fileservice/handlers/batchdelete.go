@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/anomaly"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// maxBatchDelete caps the files one batch delete can name, S3's limit for one DeleteObjects call
+const maxBatchDelete = 1000
+
+// batchLookupConcurrency is how many files' metadata a batch delete reads at once
+const batchLookupConcurrency = 8
+
+// Outcomes of each file in a batch delete
+const (
+	batchDeleted  = "deleted"
+	batchNotFound = "not_found" // No such file, or not the caller's
+	batchFailed   = "failed"    // Storage failed; deleting the file again is safe
+)
+
+// BatchDeleteRequest names the files to delete
+type BatchDeleteRequest struct {
+	FileIDs []string `json:"file_ids"`
+}
+
+// BatchDeleteResult is what happened to one file of a batch delete
+type BatchDeleteResult struct {
+	FileID string `json:"file_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"` // Why a failed file wasn't deleted
+}
+
+// BatchDeleteResponse reports a batch delete file by file, in the order the files were named
+type BatchDeleteResponse struct {
+	Deleted  int                 `json:"deleted"`
+	NotFound int                 `json:"not_found"`
+	Failed   int                 `json:"failed"`
+	Results  []BatchDeleteResult `json:"results"`
+}
+
+// BatchDeleteFilesHandler deletes up to 1000 of the caller's files in one request. Objects
+// are deleted with DeleteObjects, one call per bucket, then the metadata of those deleted
+// in batches, so a file's metadata outlives its object only if the metadata delete fails.
+// One file failing doesn't stop the others; the response says what happened to each. Each
+// file deleted is published to bus as file.deleted. With a detector, each file named counts
+// as one delete, and a batch that takes the caller over the limit locks them and deletes nothing.
+func BatchDeleteFilesHandler(s3Client ObjectStore, dynamoClient MetadataStore, bus events.Publisher, detector *anomaly.Detector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req BatchDeleteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		fileIDs := uniqueFileIDs(req.FileIDs)
+		switch {
+		case len(fileIDs) == 0:
+			common.WriteValidationError(w, "No files", "file_ids must name at least one file")
+			return
+		case len(fileIDs) > maxBatchDelete:
+			common.WriteValidationError(w, "Too many files",
+				fmt.Sprintf("A batch delete can name at most %d files", maxBatchDelete))
+			return
+		}
+		if detector != nil {
+			if event, detected := detector.RecordN(userID, anomaly.ActionDelete, len(fileIDs)); detected {
+				detector.WriteLocked(w, event)
+				return
+			}
+		}
+
+		results := make(map[string]*BatchDeleteResult, len(fileIDs))
+		for _, fileID := range fileIDs {
+			results[fileID] = &BatchDeleteResult{FileID: fileID}
+		}
+		fail := func(fileID string, err error) {
+			common.Logger(r.Context()).Warn("Batch delete failed for file", "file_id", fileID, "error", err)
+			results[fileID].Status = batchFailed
+			results[fileID].Error = err.Error()
+		}
+
+		// Group the caller's files by the bucket their objects are in
+		files := lookupFiles(r, dynamoClient, fileIDs)
+		byBucket := make(map[string][]*storage.FileMetadata)
+		for i, fileID := range fileIDs {
+			switch metadata, err := files[i].metadata, files[i].err; {
+			case errors.Is(err, storage.ErrNotFound) || (err == nil && metadata.UserID != userID):
+				results[fileID].Status = batchNotFound
+			case err != nil:
+				fail(fileID, err)
+			default:
+				byBucket[metadata.Bucket] = append(byBucket[metadata.Bucket], metadata)
+			}
+		}
+
+		var removed []*storage.FileMetadata
+		for bucket, bucketFiles := range byBucket {
+			keys := make([]string, len(bucketFiles))
+			for i, metadata := range bucketFiles {
+				keys[i] = metadata.S3Key
+			}
+			failed := s3Client.DeleteObjects(r.Context(), bucket, keys)
+			for _, metadata := range bucketFiles {
+				if err, ok := failed[metadata.S3Key]; ok {
+					fail(metadata.FileID, err)
+					continue
+				}
+				removed = append(removed, metadata)
+			}
+		}
+
+		// Only metadata whose object is gone is deleted, so a failed file can be retried
+		var released int64
+		var deleted []events.Event
+		if len(removed) > 0 {
+			removedIDs := make([]string, len(removed))
+			for i, metadata := range removed {
+				removedIDs[i] = metadata.FileID
+			}
+			failed := dynamoClient.DeleteFilesMetadata(r.Context(), removedIDs)
+			for _, metadata := range removed {
+				if err, ok := failed[metadata.FileID]; ok {
+					fail(metadata.FileID, err)
+					continue
+				}
+				results[metadata.FileID].Status = batchDeleted
+				released += metadata.TotalSize
+				deleted = append(deleted, events.FileDeleted(metadata))
+			}
+		}
+		if released > 0 {
+			releaseStorage(r.Context(), dynamoClient, userID, released)
+		}
+		publish(r.Context(), bus, deleted...)
+
+		response := BatchDeleteResponse{Results: make([]BatchDeleteResult, len(fileIDs))}
+		for i, fileID := range fileIDs {
+			result := results[fileID]
+			switch result.Status {
+			case batchDeleted:
+				response.Deleted++
+			case batchNotFound:
+				response.NotFound++
+			case batchFailed:
+				response.Failed++
+			}
+			response.Results[i] = *result
+		}
+		common.Logger(r.Context()).Info("Batch deleted files", "deleted", response.Deleted, "not_found", response.NotFound, "failed", response.Failed)
+		common.WriteOKResponse(w, response)
+	}
+}
+
+// uniqueFileIDs drops empty and repeated IDs, keeping the first of each
+func uniqueFileIDs(fileIDs []string) []string {
+	seen := make(map[string]bool, len(fileIDs))
+	unique := make([]string, 0, len(fileIDs))
+	for _, fileID := range fileIDs {
+		if fileID != "" && !seen[fileID] {
+			seen[fileID] = true
+			unique = append(unique, fileID)
+		}
+	}
+	return unique
+}
+
+type fileLookup struct {
+	metadata *storage.FileMetadata
+	err      error
+}
+
+// lookupFiles reads each file's metadata, a few at a time, in the order of fileIDs
+func lookupFiles(r *http.Request, dynamoClient MetadataStore, fileIDs []string) []fileLookup {
+	lookups := make([]fileLookup, len(fileIDs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(batchLookupConcurrency, len(fileIDs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				metadata, err := dynamoClient.GetFileMetadata(r.Context(), fileIDs[i])
+				lookups[i] = fileLookup{metadata: metadata, err: err}
+			}
+		}()
+	}
+	for i := range fileIDs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return lookups
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/callbacks"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// UploadCallbackRequest registers the URL an API key's completed uploads are reported to
+type UploadCallbackRequest struct {
+	URL string `json:"url"`
+}
+
+// UploadCallbackResponse is an API key's registered callback. Secret, which verifies the
+// deliveries' signatures, is only returned when the URL is set.
+type UploadCallbackResponse struct {
+	URL       string `json:"url"`
+	Secret    string `json:"secret,omitempty"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// GetUploadCallbackHandler returns the calling API key's callback URL
+func GetUploadCallbackHandler(store UploadCallbackStore, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKeyID, ok := callbackKey(w, r, secret)
+		if !ok {
+			return
+		}
+
+		callback, err := store.GetUploadCallback(r.Context(), apiKeyID)
+		if err != nil {
+			writeNotFoundOr(w, err, "No upload callback", "This API key has no callback URL registered", "Failed to load upload callback")
+			return
+		}
+		common.WriteOKResponse(w, UploadCallbackResponse{URL: callback.URL, UpdatedAt: callback.UpdatedAt})
+	}
+}
+
+// SetUploadCallbackHandler registers the URL the calling API key's completed uploads are
+// reported to, replacing any before it. Each call returns a new signing secret; the old
+// one stops working at once. URLs must be https unless allowHTTP is set.
+func SetUploadCallbackHandler(store UploadCallbackStore, secret string, allowHTTP bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKeyID, ok := callbackKey(w, r, secret)
+		if !ok {
+			return
+		}
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req UploadCallbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		if err := callbacks.CheckURL(req.URL, allowHTTP); err != nil {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "url",
+				Code:    common.ErrorCodeInvalidValue,
+				Message: "url " + err.Error(),
+			}})
+			return
+		}
+
+		callback := &storage.UploadCallback{
+			APIKeyID:  apiKeyID,
+			UserID:    userID,
+			URL:       req.URL,
+			Nonce:     uuid.New().String(),
+			UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := store.SaveUploadCallback(r.Context(), callback); err != nil {
+			writeStorageError(w, "Failed to save upload callback", err, common.WriteDatabaseError)
+			return
+		}
+		common.Logger(r.Context()).Info("Registered upload callback", "api_key_id", apiKeyID)
+		common.WriteOKResponse(w, UploadCallbackResponse{
+			URL:       callback.URL,
+			Secret:    callbacks.Secret([]byte(secret), callback),
+			UpdatedAt: callback.UpdatedAt,
+		})
+	}
+}
+
+// DeleteUploadCallbackHandler stops reporting the calling API key's completed uploads
+func DeleteUploadCallbackHandler(store UploadCallbackStore, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKeyID, ok := callbackKey(w, r, secret)
+		if !ok {
+			return
+		}
+
+		if err := store.DeleteUploadCallback(r.Context(), apiKeyID); err != nil {
+			writeStorageError(w, "Failed to delete upload callback", err, common.WriteDatabaseError)
+			return
+		}
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// callbackKey is the API key the request was made with, writing a 404 if upload callbacks
+// aren't configured
+func callbackKey(w http.ResponseWriter, r *http.Request, secret string) (string, bool) {
+	if secret == "" {
+		common.WriteNotFoundError(w, "Upload callbacks are not enabled", "UPLOAD_CALLBACK_SECRET is not set on this deployment")
+		return "", false
+	}
+	apiKeyID, ok := auth.GetAPIKeyIDFromContext(r.Context())
+	if !ok {
+		// RequireAPIKey has already turned these away
+		common.WriteUnauthorizedError(w, "API key required", "Upload callbacks belong to API keys")
+		return "", false
+	}
+	return apiKeyID, true
+}
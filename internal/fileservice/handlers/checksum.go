@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// checksumSizes is the decoded length of each supported checksum
+var checksumSizes = map[string]int{
+	storage.ChecksumSHA256: 32,
+	storage.ChecksumCRC32C: 4,
+}
+
+// validateChecksum checks an upload's declared checksum. It is optional, but the algorithm
+// and value come together, and a multipart object can only be covered by CRC32C.
+func validateChecksum(req *uploadRequest) []common.ValidationError {
+	if req.ChecksumAlgorithm == "" && req.Checksum == "" {
+		return nil
+	}
+	size, ok := checksumSizes[req.ChecksumAlgorithm]
+	if !ok {
+		return []common.ValidationError{{
+			Field:   "checksum_algorithm",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("checksum_algorithm must be %q or %q when a checksum is given", storage.ChecksumSHA256, storage.ChecksumCRC32C),
+		}}
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(req.Checksum); err != nil || len(decoded) != size {
+		return []common.ValidationError{{
+			Field:   "checksum",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("checksum must be the base64 encoding of a %d byte %s digest", size, req.ChecksumAlgorithm),
+		}}
+	}
+	if shouldUseMultipart(req.Size) && req.ChecksumAlgorithm != storage.ChecksumCRC32C {
+		return []common.ValidationError{{
+			Field:   "checksum_algorithm",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("multipart uploads support only %q checksums", storage.ChecksumCRC32C),
+		}}
+	}
+	return nil
+}
+
+// verifyChecksum compares the checksum S3 computed for a file's object with the one its
+// client declared, marking the file corrupt if they differ. It reports whether the file
+// passed; files without a declared checksum always do. It returns storage.ErrObjectNotFound
+// if the content hasn't been uploaded yet.
+func verifyChecksum(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata) (bool, error) {
+	if metadata.ChecksumAlgorithm == "" {
+		return true, nil
+	}
+	reported, err := s3Client.ObjectChecksum(ctx, metadata.Bucket, metadata.S3Key, metadata.ChecksumAlgorithm)
+	if err != nil {
+		return false, err
+	}
+	if reported == metadata.Checksum {
+		return true, nil
+	}
+	if reported == "" {
+		reported = "none"
+	}
+	reason := fmt.Sprintf("%s checksum mismatch: declared %s, storage reported %s", metadata.ChecksumAlgorithm, metadata.Checksum, reported)
+	return false, markCorrupt(ctx, dynamoClient, metadata, reason)
+}
+
+// markCorrupt records that a file's content failed checksum verification
+func markCorrupt(ctx context.Context, dynamoClient MetadataStore, metadata *storage.FileMetadata, reason string) error {
+	completedAt := time.Now().Format(time.RFC3339)
+	metadata.Status = storage.FileStatusCorrupt
+	metadata.CorruptReason = &reason
+	metadata.CompletedAt = &completedAt
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to mark file %s corrupt: %w", metadata.FileID, err)
+	}
+	common.Logger(ctx).Warn("Marked file corrupt", "file_id", metadata.FileID, "reason", reason)
+	return nil
+}
+
+func writeCorruptError(w http.ResponseWriter, metadata *storage.FileMetadata) {
+	reason := "The file's content didn't match its checksum"
+	if metadata.CorruptReason != nil {
+		reason = *metadata.CorruptReason
+	}
+	common.WriteErrorResponse(w, http.StatusConflict, common.ErrorCodeFileCorrupt, "File corrupt", reason)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// FilenameCollision reports how an upload's filename clashed with an existing file
+type FilenameCollision struct {
+	Strategy          string `json:"strategy"`
+	RequestedFilename string `json:"requested_filename"`
+	ExistingFileID    string `json:"existing_file_id"`  // The latest file already using the name
+	Version           int    `json:"version,omitempty"` // For "version": the new upload's version number
+}
+
+// resolveCollision checks filename, already normalized, against the user's files' normalized
+// names, so names that differ only in Unicode form or invisible characters still collide.
+// It returns the name to store the upload under and, if the name was taken, how the clash
+// was resolved. Resolving with common.CollisionReject is left to the caller.
+func resolveCollision(files []storage.FileMetadata, filename, strategy string) (string, *FilenameCollision) {
+	taken := make(map[string]bool, len(files))
+	var latest *storage.FileMetadata
+	for i := range files {
+		// Files stored before normalization may not be normalized yet
+		name := common.NormalizeFilename(files[i].Filename)
+		taken[name] = true
+		if name == filename && (latest == nil || fileVersion(&files[i]) > fileVersion(latest)) {
+			latest = &files[i]
+		}
+	}
+	if latest == nil {
+		return filename, nil
+	}
+
+	collision := &FilenameCollision{Strategy: strategy, RequestedFilename: filename, ExistingFileID: latest.FileID}
+	switch strategy {
+	case common.CollisionRename:
+		return renamedFilename(filename, taken), collision
+	case common.CollisionVersion:
+		collision.Version = fileVersion(latest) + 1
+	}
+	return filename, collision
+}
+
+// setVersion records a new upload as the next version of the file it collided with
+func setVersion(metadata *storage.FileMetadata, collision *FilenameCollision) {
+	if collision != nil && collision.Strategy == common.CollisionVersion {
+		metadata.Version = collision.Version
+		metadata.PreviousVersionID = collision.ExistingFileID
+	}
+}
+
+// fileVersion is a file's version number; files stored before versioning are version 1
+func fileVersion(file *storage.FileMetadata) int {
+	if file.Version == 0 {
+		return 1
+	}
+	return file.Version
+}
+
+// renamedFilename numbers filename like "report (2).pdf", picking the first number not taken
+func renamedFilename(filename string, taken map[string]bool) string {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	if base == "" { // A dotfile such as ".env" is all name
+		base, ext = filename, ""
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/delta"
+	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/fileservice/writeretry"
+)
+
+// Sources of a delta upload's parts
+const (
+	DeltaSourceBase   = "base"   // Copied by the service from the base file
+	DeltaSourceUpload = "upload" // Uploaded by the client to a presigned URL
+)
+
+const (
+	minDeltaPartSize     = int64(5 * 1024 * 1024) // S3's smallest part, except the last
+	maxDeltaParts        = 10000                  // S3's most parts in an upload
+	deltaCopyConcurrency = 8                      // Part copies in flight at once
+)
+
+// BlockManifest is a file's checksums block by block, for planning a delta upload
+type BlockManifest struct {
+	FileID    string          `json:"file_id"`
+	Size      int64           `json:"size"`
+	BlockSize int64           `json:"block_size"`
+	Blocks    []BlockChecksum `json:"blocks"`
+}
+
+// BlockChecksum is one block of a file: its weak rolling checksum (delta.Weak) and SHA-256
+type BlockChecksum struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"` // Hex
+}
+
+// DeltaPart is one part of a delta upload's new content, in order
+type DeltaPart struct {
+	Source string `json:"source"`           // DeltaSourceBase or DeltaSourceUpload
+	Offset int64  `json:"offset,omitempty"` // For DeltaSourceBase: where the bytes start in the base file
+	Size   int64  `json:"size"`
+}
+
+// DeltaUploadRequest describes a new version of a file as parts of the old one and new bytes
+type DeltaUploadRequest struct {
+	Parts []DeltaPart `json:"parts"`
+}
+
+// DeltaChunkURL is the URL for a part of a delta upload the client sends, and where the
+// part's bytes start in the new content
+type DeltaChunkURL struct {
+	ChunkURL
+	Offset int64 `json:"offset"`
+}
+
+// DeltaUploadResponse is a delta upload under way: the base file's parts have been copied,
+// and Chunks are the parts left to upload. It then completes like any multipart upload.
+type DeltaUploadResponse struct {
+	FileID       string          `json:"file_id"`
+	BaseFileID   string          `json:"base_file_id"`
+	Filename     string          `json:"filename"`
+	Version      int             `json:"version"`
+	Size         int64           `json:"size"`
+	UploadType   string          `json:"upload_type"` // Always "multipart"
+	TotalChunks  int             `json:"total_chunks"`
+	CopiedChunks int             `json:"copied_chunks"`
+	CopiedBytes  int64           `json:"copied_bytes"`
+	Chunks       []DeltaChunkURL `json:"chunks"`
+	Hints        *UploadHints    `json:"hints,omitempty"`
+}
+
+// BlockManifestHandler returns a completed file's block manifest. The first request reads
+// the whole file to compute it; it is then kept in manifests, which failing to write only
+// costs the next request the same read.
+func BlockManifestHandler(s3Client ObjectStore, dynamoClient MetadataStore, manifests BlockManifestStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metadata, ok := completedFile(w, r, dynamoClient)
+		if !ok {
+			return
+		}
+
+		blocks, err := blockManifest(r.Context(), s3Client, manifests, metadata)
+		if err != nil {
+			writeStorageError(w, "Failed to compute block manifest", err, common.WriteS3Error)
+			return
+		}
+
+		manifest := BlockManifest{FileID: metadata.FileID, Size: metadata.TotalSize, BlockSize: delta.BlockSize, Blocks: make([]BlockChecksum, len(blocks))}
+		for i, block := range blocks {
+			manifest.Blocks[i] = BlockChecksum{Offset: block.Offset, Size: block.Size, Weak: block.Weak, Strong: hex.EncodeToString(block.Strong[:])}
+		}
+		common.WriteOKResponse(w, manifest)
+	}
+}
+
+// blockManifest loads a file's stored manifest, or computes and stores it
+func blockManifest(ctx context.Context, s3Client ObjectStore, manifests BlockManifestStore, metadata *storage.FileMetadata) ([]delta.Block, error) {
+	stored, err := manifests.GetBlockManifest(ctx, metadata.FileID)
+	if err == nil && stored.BlockSize == delta.BlockSize {
+		blocks, decodeErr := delta.Decode(stored.Blocks, metadata.TotalSize, stored.BlockSize)
+		if decodeErr == nil {
+			return blocks, nil
+		}
+		common.Logger(ctx).Warn("Recomputing unreadable block manifest", "file_id", metadata.FileID, "error", decodeErr)
+	} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		common.Logger(ctx).Warn("Failed to load block manifest", "file_id", metadata.FileID, "error", err)
+	}
+
+	content, err := s3Client.OpenObject(ctx, metadata.Bucket, metadata.S3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	blocks, err := delta.Compute(content, metadata.TotalSize, delta.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	manifest := &storage.BlockManifest{
+		FileID:    metadata.FileID,
+		BlockSize: delta.BlockSize,
+		Blocks:    delta.Encode(blocks),
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(storage.BlockManifestTTL).Unix(),
+	}
+	if err := manifests.SaveBlockManifest(ctx, manifest); err != nil {
+		common.Logger(ctx).Warn("Failed to save block manifest", "file_id", metadata.FileID, "error", err)
+	}
+	return blocks, nil
+}
+
+// DeltaUploadHandler starts a new version of a completed file from a plan of its parts:
+// runs of the file's own bytes, which are copied in storage, and new bytes, which get
+// upload URLs. The new version is reserved against the user's quota of quotaBytes and
+// checked against the content type policy as a full upload would be. If its metadata or
+// chunk records can't be saved the URLs are still returned and the writes are queued on
+// retries.
+func DeltaUploadHandler(s3Client ObjectStore, dynamoClient MetadataStore, hints UploadHints, quotaBytes int64, policies *ContentTypePolicies, retries *writeretry.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base, ok := completedFile(w, r, dynamoClient)
+		if !ok {
+			return
+		}
+
+		var req DeltaUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		size, validationErrors := validateDeltaParts(req.Parts, base.TotalSize)
+		if len(validationErrors) > 0 {
+			common.WriteValidationErrors(w, validationErrors)
+			return
+		}
+
+		current, err := policies.Current(r.Context())
+		if err != nil {
+			writeStorageError(w, "Failed to load content type policy", err, common.WriteDatabaseError)
+			return
+		}
+		if policyErrs := current.Policy.Check(base.ContentType, size); len(policyErrs) > 0 {
+			common.WriteValidationErrors(w, policyErrs)
+			return
+		}
+
+		// Numbered after the latest version, which needn't be the base
+		existing, err := dynamoClient.ListUserFiles(r.Context(), base.UserID)
+		if err != nil {
+			writeStorageError(w, "Failed to check for an existing file", err, common.WriteDatabaseError)
+			return
+		}
+		upload := &uploadRequest{
+			Size:        &size,
+			ContentType: base.ContentType,
+			urlExpiry:   storage.PresignedURLExpiry,
+			client:      common.ClientInfoFromContext(r.Context()),
+		}
+		upload.apiKeyID, _ = auth.GetAPIKeyIDFromContext(r.Context())
+		upload.Filename, upload.collision = resolveCollision(existing, common.NormalizeFilename(base.Filename), common.CollisionVersion)
+
+		if err := dynamoClient.ReserveStorage(r.Context(), base.UserID, size, quotaBytes); err != nil {
+			if errors.Is(err, storage.ErrQuotaExceeded) {
+				common.WriteErrorResponse(w, http.StatusForbidden, common.ErrorCodeQuotaExceeded, "Storage quota exceeded",
+					fmt.Sprintf("Uploading %d bytes would exceed your %d byte quota; delete files to free space", size, quotaBytes))
+				return
+			}
+			writeStorageError(w, "Failed to check storage quota", err, common.WriteDatabaseError)
+			return
+		}
+
+		response, err := startDeltaUpload(r.Context(), s3Client, dynamoClient, retries, base, upload, req.Parts, hints)
+		if err != nil {
+			releaseStorage(r.Context(), dynamoClient, base.UserID, size)
+			writeStorageError(w, "Failed to start delta upload", err, common.WriteS3Error)
+			return
+		}
+		common.WriteOKResponse(w, response)
+	}
+}
+
+// startDeltaUpload creates the multipart upload, copies the base's parts into it and issues
+// URLs for the rest. If any of that fails the upload is aborted.
+func startDeltaUpload(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, retries *writeretry.Queue, base *storage.FileMetadata, req *uploadRequest, parts []DeltaPart, hints UploadHints) (*DeltaUploadResponse, error) {
+	uploadInfo, err := s3Client.InitiateMultipartUpload(ctx, base.UserID, req.Filename, req.uploadOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+	response := &DeltaUploadResponse{
+		FileID:      uploadInfo.FileID,
+		BaseFileID:  base.FileID,
+		Filename:    req.Filename,
+		Size:        *req.Size,
+		UploadType:  "multipart",
+		TotalChunks: len(parts),
+		Chunks:      []DeltaChunkURL{},
+	}
+	records, err := stitchDeltaParts(ctx, s3Client, dynamoClient, uploadInfo, base, req, parts, response)
+	if err != nil {
+		if abortErr := s3Client.AbortMultipartUpload(ctx, uploadInfo); abortErr != nil {
+			common.Logger(ctx).Warn("Failed to abort delta upload", "file_id", uploadInfo.FileID, "error", abortErr)
+		}
+		return nil, err
+	}
+
+	if err := dynamoClient.SaveFileChunks(ctx, records); err != nil {
+		common.Logger(ctx).Warn("Failed to save chunk records", "file_id", uploadInfo.FileID, "error", err)
+		retries.RetryFileChunks(ctx, uploadInfo.FileID, records, err)
+	}
+	metadata := multipartMetadata(uploadInfo.FileID, base.UserID, req, uploadInfo.Bucket, uploadInfo.Key, uploadInfo.UploadID, 0, len(parts))
+	metadata.ChunkSize = nil // Parts vary in size
+	metadata.UploadedParts = response.CopiedChunks
+	response.Version = metadata.Version
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		common.Logger(ctx).Warn("Failed to save multipart metadata", "file_id", uploadInfo.FileID, "error", err)
+		retries.RetryFileMetadata(ctx, metadata, err)
+	}
+
+	hints.URLTTLSeconds = int64(req.urlExpiry / time.Second)
+	response.Hints = &hints
+	common.Logger(ctx).Info("Started delta upload", "file_id", uploadInfo.FileID, "base_file_id", base.FileID,
+		"copied_bytes", response.CopiedBytes, "upload_bytes", *req.Size-response.CopiedBytes)
+	return response, nil
+}
+
+// stitchDeltaParts issues URLs for the parts the client uploads, adding them to response,
+// and copies the rest from the base. It returns the chunk records for every part, with the
+// copies already uploaded.
+func stitchDeltaParts(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, uploadInfo *storage.MultipartUploadInfo, base *storage.FileMetadata, req *uploadRequest, parts []DeltaPart, response *DeltaUploadResponse) ([]storage.FileChunk, error) {
+	records := make([]storage.FileChunk, len(parts))
+	var offset int64
+	for i, part := range parts {
+		partNumber := i + 1
+		records[i] = storage.FileChunk{FileID: uploadInfo.FileID, ChunkNumber: partNumber, Size: part.Size, Status: "pending", S3PartNumber: partNumber}
+		if part.Source == DeltaSourceUpload {
+			chunkURL, err := s3Client.GenerateMultipartUploadURL(ctx, uploadInfo, partNumber)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate chunk upload URL: %w", err)
+			}
+			chunk := DeltaChunkURL{ChunkURL: ChunkURL{ChunkNumber: partNumber, URL: chunkURL, ExpiresAt: time.Now().Add(req.urlExpiry), Size: part.Size}, Offset: offset}
+			auditIssuedURL(ctx, dynamoClient, req.client, uploadInfo.FileID, base.UserID, uploadInfo.Key, storage.URLPurposeUploadPart, partNumber, req.urlExpiry)
+			records[i].URLExpiresAt = chunk.ExpiresAt.Format(time.RFC3339)
+			response.Chunks = append(response.Chunks, chunk)
+		}
+		offset += part.Size
+	}
+
+	etags, err := copyDeltaParts(ctx, s3Client, uploadInfo, base, parts)
+	if err != nil {
+		return nil, err
+	}
+	copiedAt := time.Now().Format(time.RFC3339)
+	for i, part := range parts {
+		if part.Source == DeltaSourceBase {
+			records[i].Status, records[i].ETag, records[i].UploadedAt = "uploaded", etags[i], copiedAt
+			response.CopiedChunks++
+			response.CopiedBytes += part.Size
+		}
+	}
+	return records, nil
+}
+
+// copyDeltaParts copies the parts taken from the base file, a few at a time, returning
+// each copied part's ETag by index
+func copyDeltaParts(ctx context.Context, s3Client ObjectStore, uploadInfo *storage.MultipartUploadInfo, base *storage.FileMetadata, parts []DeltaPart) ([]string, error) {
+	etags := make([]string, len(parts))
+	errs := make([]error, len(parts))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(deltaCopyConcurrency, len(parts)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				etags[i], errs[i] = s3Client.UploadPartCopy(ctx, uploadInfo, i+1, base.Bucket, base.S3Key, parts[i].Offset, parts[i].Size)
+			}
+		}()
+	}
+	for i, part := range parts {
+		if part.Source == DeltaSourceBase {
+			next <- i
+		}
+	}
+	close(next)
+	wg.Wait()
+	return etags, errors.Join(errs...)
+}
+
+// validateDeltaParts checks a plan's parts can be stitched by S3 from a base of baseSize
+// bytes and returns the new content's size
+func validateDeltaParts(parts []DeltaPart, baseSize int64) (int64, []common.ValidationError) {
+	if len(parts) == 0 || len(parts) > maxDeltaParts {
+		return 0, []common.ValidationError{{
+			Field:   "parts",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("parts must list between 1 and %d parts", maxDeltaParts),
+		}}
+	}
+
+	var size int64
+	var validationErrors []common.ValidationError
+	invalid := func(i int, field, message string) {
+		validationErrors = append(validationErrors, common.ValidationError{
+			Field:   fmt.Sprintf("parts[%d].%s", i, field),
+			Code:    common.ErrorCodeInvalidValue,
+			Message: message,
+		})
+	}
+	for i, part := range parts {
+		switch {
+		case part.Size <= 0 || part.Size > multipartChunkSize:
+			invalid(i, "size", fmt.Sprintf("size must be between 1 and %d bytes", multipartChunkSize))
+		case part.Size < minDeltaPartSize && i < len(parts)-1:
+			invalid(i, "size", fmt.Sprintf("every part but the last must be at least %d bytes", minDeltaPartSize))
+		}
+		switch part.Source {
+		case DeltaSourceBase:
+			if part.Offset < 0 || part.Offset > baseSize-part.Size { // Not Offset+Size, which can overflow
+				invalid(i, "offset", fmt.Sprintf("offset and size must fall within the base file's %d bytes", baseSize))
+			}
+		case DeltaSourceUpload:
+			if part.Offset != 0 {
+				invalid(i, "offset", "offset applies only to parts copied from the base file")
+			}
+		default:
+			invalid(i, "source", fmt.Sprintf("source must be %q or %q", DeltaSourceBase, DeltaSourceUpload))
+		}
+		size += part.Size
+	}
+	if len(validationErrors) == 0 && size > common.MaxFileSize {
+		validationErrors = append(validationErrors, common.ValidationError{
+			Field:   "parts",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("parts must add up to at most %d bytes", int64(common.MaxFileSize)),
+		})
+	}
+	return size, validationErrors
+}
+
+// completedFile loads the caller's file named by the route, writing a 409 unless its upload
+// has completed, as only a finished file's content can be read block by block
+func completedFile(w http.ResponseWriter, r *http.Request, dynamoClient MetadataStore) (*storage.FileMetadata, bool) {
+	metadata, ok := ownedFile(w, r, dynamoClient, mux.Vars(r)["fileId"])
+	if !ok {
+		return nil, false
+	}
+	if metadata.Status != storage.FileStatusCompleted {
+		common.WriteConflictError(w, "File not complete",
+			fmt.Sprintf("File %s is %s; its content can't be read until its upload completes", metadata.FileID, metadata.Status))
+		return nil, false
+	}
+	return metadata, true
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/delta"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// fakeBlockManifests is an in-memory BlockManifestStore
+type fakeBlockManifests map[string]*storage.BlockManifest
+
+func (f fakeBlockManifests) GetBlockManifest(ctx context.Context, fileID string) (*storage.BlockManifest, error) {
+	manifest, ok := f[fileID]
+	if !ok {
+		return nil, fmt.Errorf("block manifest %w: %s", storage.ErrNotFound, fileID)
+	}
+	return manifest, nil
+}
+
+func (f fakeBlockManifests) SaveBlockManifest(ctx context.Context, manifest *storage.BlockManifest) error {
+	f[manifest.FileID] = manifest
+	return nil
+}
+
+func TestBlockManifest(t *testing.T) {
+	content := "hello, world"
+	base := singleFile()
+	base.TotalSize = int64(len(content))
+	db := newFakeMetadataStore(base)
+	reads := 0
+	s3 := &fakeObjectStore{
+		openObject: func(context.Context, string, string) (io.ReadCloser, error) {
+			reads++
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+	manifests := fakeBlockManifests{}
+
+	for i := 0; i < 2; i++ {
+		rec := serve(BlockManifestHandler(s3, db, manifests), http.MethodGet, map[string]string{"fileId": "file-1"}, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data BlockManifest `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		strong := sha256.Sum256([]byte(content))
+		want := BlockChecksum{Size: int64(len(content)), Weak: delta.Weak([]byte(content)), Strong: hex.EncodeToString(strong[:])}
+		if resp.Data.BlockSize != delta.BlockSize || len(resp.Data.Blocks) != 1 || resp.Data.Blocks[0] != want {
+			t.Errorf("manifest = %+v, want one block %+v", resp.Data, want)
+		}
+	}
+	// The second request is answered from the stored manifest
+	if reads != 1 || manifests["file-1"] == nil {
+		t.Errorf("file read %d times, stored manifest %v; want one read and a stored manifest", reads, manifests["file-1"])
+	}
+
+	if rec := serve(BlockManifestHandler(s3, newFakeMetadataStore(multipartFile()), manifests), http.MethodGet, map[string]string{"fileId": "file-2"}, ""); rec.Code != http.StatusConflict {
+		t.Errorf("incomplete file: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestFileParts(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), delta.BlockSize+3)
+	base := singleFile()
+	base.TotalSize = int64(len(content))
+	s3 := &fakeObjectStore{
+		openObject: func(context.Context, string, string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		},
+	}
+	hints := NewUploadHints(8, 3, 250*time.Millisecond, 10*time.Second)
+
+	rec := serve(FilePartsHandler(s3, newFakeMetadataStore(base), fakeBlockManifests{}, hints), http.MethodGet, map[string]string{"fileId": "file-1"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data FilePartMap `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data
+	last := sha256.Sum256(content[delta.BlockSize:])
+	want := FilePart{PartNumber: 2, Offset: delta.BlockSize, Size: 3, SHA256: hex.EncodeToString(last[:])}
+	if got.PartSize != delta.BlockSize || got.TotalParts != 2 || len(got.Parts) != 2 || got.Parts[1] != want {
+		t.Errorf("part map = %+v, want a second part %+v", got, want)
+	}
+	if got.Hints == nil || got.Hints.MaxParallelParts != 8 || got.Hints.Retry.MaxAttempts != 3 {
+		t.Errorf("hints = %+v, want the configured parallelism and retries", got.Hints)
+	}
+}
+
+func TestDeltaUpload(t *testing.T) {
+	const mib = 1024 * 1024
+	base := singleFile()
+	base.Filename, base.TotalSize, base.S3Key = "disk.img", 20*mib, storage.ObjectKey(testUser, "file-1", "disk.img")
+
+	var mu sync.Mutex
+	var copies []string
+	aborted := false
+	copyErr := error(nil)
+	s3 := &fakeObjectStore{
+		initiateMultipartUpload: func(_ context.Context, userID, filename string, _ storage.UploadOptions) (*storage.MultipartUploadInfo, error) {
+			return &storage.MultipartUploadInfo{UploadID: "upload-3", Key: storage.ObjectKey(userID, "file-3", filename), FileID: "file-3"}, nil
+		},
+		generateMultipartUploadURL: func(_ context.Context, _ *storage.MultipartUploadInfo, partNumber int) (string, error) {
+			return fmt.Sprintf("https://s3.example/part/%d", partNumber), nil
+		},
+		uploadPartCopy: func(_ context.Context, _ *storage.MultipartUploadInfo, partNumber int, _, srcKey string, offset, length int64) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			copies = append(copies, fmt.Sprintf("%d:%s@%d+%d", partNumber, srcKey, offset, length))
+			return fmt.Sprintf("etag-%d", partNumber), copyErr
+		},
+		abortMultipartUpload: func(context.Context, *storage.MultipartUploadInfo) error {
+			aborted = true
+			return nil
+		},
+	}
+	plan := `{"parts": [
+		{"source": "base", "offset": 0, "size": 8388608},
+		{"source": "upload", "size": 6291456},
+		{"source": "base", "offset": 16777216, "size": 4194304}
+	]}`
+	vars := map[string]string{"fileId": "file-1"}
+
+	db := newFakeMetadataStore(base)
+	hints := NewUploadHints(8, 3, 250*time.Millisecond, 10*time.Second)
+	rec := serve(DeltaUploadHandler(s3, db, hints, testQuota, anyType(), nil), http.MethodPost, vars, plan)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data DeltaUploadResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data
+	if got.FileID != "file-3" || got.BaseFileID != "file-1" || got.Version != 2 || got.Size != 18*mib ||
+		got.TotalChunks != 3 || got.CopiedChunks != 2 || got.CopiedBytes != 12*mib {
+		t.Errorf("response = %+v", got)
+	}
+	if len(got.Chunks) != 1 || got.Chunks[0].ChunkNumber != 2 || got.Chunks[0].Offset != 8*mib || got.Chunks[0].Size != 6*mib {
+		t.Errorf("chunks = %+v, want part 2 at 8 MiB", got.Chunks)
+	}
+	if got.Hints == nil || got.Hints.URLTTLSeconds == 0 {
+		t.Errorf("hints = %+v, want the URL lifetime", got.Hints)
+	}
+
+	wantCopies := map[string]bool{
+		"1:" + base.S3Key + "@0+8388608":        true,
+		"3:" + base.S3Key + "@16777216+4194304": true,
+	}
+	if len(copies) != 2 || !wantCopies[copies[0]] || !wantCopies[copies[1]] {
+		t.Errorf("copies = %v, want parts 1 and 3 from the base", copies)
+	}
+	metadata := db.files["file-3"]
+	if metadata == nil || metadata.Version != 2 || metadata.PreviousVersionID != "file-1" || metadata.UploadedParts != 2 || metadata.TotalChunks == nil || *metadata.TotalChunks != 3 {
+		t.Fatalf("metadata = %+v, want version 2 of file-1 with 2 of 3 parts uploaded", metadata)
+	}
+	chunks := db.chunks["file-3"]
+	if len(chunks) != 3 || chunks[0].Status != "uploaded" || chunks[0].ETag != "etag-1" || chunks[1].Status != "pending" || chunks[2].ETag != "etag-3" {
+		t.Errorf("chunks = %+v, want the copies uploaded and part 2 pending", chunks)
+	}
+	if db.usage[testUser] != 18*mib {
+		t.Errorf("usage = %d, want the new version's %d bytes reserved", db.usage[testUser], 18*mib)
+	}
+
+	// A failed copy aborts the upload and gives back the reservation
+	db = newFakeMetadataStore(base)
+	copyErr = errors.New("copy failed")
+	if rec := serve(DeltaUploadHandler(s3, db, hints, testQuota, anyType(), nil), http.MethodPost, vars, plan); rec.Code != http.StatusInternalServerError {
+		t.Errorf("failed copy: status = %d, want 500", rec.Code)
+	}
+	if !aborted || db.usage[testUser] != 0 || db.files["file-3"] != nil {
+		t.Errorf("failed copy: aborted = %v, usage = %d, metadata = %v; want the upload undone", aborted, db.usage[testUser], db.files["file-3"])
+	}
+
+	invalid := []struct {
+		name  string
+		plan  string
+		field string
+	}{
+		{"small part", `{"parts": [{"source": "upload", "size": 1024}, {"source": "base", "size": 8388608}]}`, "parts[0].size"},
+		{"outside base", `{"parts": [{"source": "base", "offset": 16777216, "size": 8388608}]}`, "parts[0].offset"},
+		{"offset overflows", `{"parts": [{"source": "base", "offset": 9223372036854775000, "size": 8388608}]}`, "parts[0].offset"},
+		{"unknown source", `{"parts": [{"source": "cache", "size": 1024}]}`, "parts[0].source"},
+		{"no parts", `{"parts": []}`, "parts"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(DeltaUploadHandler(s3, newFakeMetadataStore(base), hints, testQuota, anyType(), nil), http.MethodPost, vars, tt.plan)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (body: %s)", rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), `"`+tt.field+`"`) {
+				t.Errorf("errors = %s, want one on %s", rec.Body.String(), tt.field)
+			}
+		})
+	}
+
+	if rec := serve(DeltaUploadHandler(s3, newFakeMetadataStore(multipartFile()), hints, testQuota, anyType(), nil), http.MethodPost, map[string]string{"fileId": "file-2"}, plan); rec.Code != http.StatusConflict {
+		t.Errorf("incomplete base: status = %d, want 409", rec.Code)
+	}
+}
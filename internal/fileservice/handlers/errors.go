@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// throttledRetryAfter is the Retry-After sent when the database or object store throttles a
+// request. Backends don't say how long to wait; a second is long enough for most bursts.
+const throttledRetryAfter = 1
+
+// writeStorageError sends the response for a storage call that failed with err: 404 if what
+// it asked for doesn't exist, 409 if a conditional write lost a race, 503 if the backend is
+// throttling or didn't answer in time, and otherwise whatever fallback
+// (common.WriteDatabaseError or common.WriteS3Error) sends. The AWS request IDs of the
+// calls that failed go with the response, to quote in a support ticket.
+func writeStorageError(w http.ResponseWriter, message string, err error, fallback func(http.ResponseWriter, string, string)) {
+	w = common.WithUpstreamRequests(w, storage.UpstreamRequests(err))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		common.WriteNotFoundError(w, message, err.Error())
+	case errors.Is(err, storage.ErrConditionFailed):
+		common.WriteConflictError(w, message, err.Error())
+	case errors.Is(err, storage.ErrThrottled):
+		writeThrottled(w, message)
+	case errors.Is(err, storage.ErrTimeout):
+		writeTimedOut(w, message)
+	default:
+		fallback(w, message, err.Error())
+	}
+}
+
+// writeNotFoundOr sends a 404 with message and details if err means the record doesn't
+// exist, and writeStorageError's response with failure otherwise. It is for lookups whose
+// 404 is worded for the client.
+func writeNotFoundOr(w http.ResponseWriter, err error, message, details, failure string) {
+	if errors.Is(err, storage.ErrNotFound) {
+		common.WriteNotFoundError(w, message, details)
+		return
+	}
+	writeStorageError(w, failure, err, common.WriteDatabaseError)
+}
+
+// writeTimedOut answers a request whose storage call ran out of time. The backend may be
+// having a bad moment, so the client is asked to retry as for throttling.
+func writeTimedOut(w http.ResponseWriter, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(throttledRetryAfter))
+	common.WriteErrorResponse(w, http.StatusServiceUnavailable, common.ErrorCodeServiceUnavailable, message,
+		"The storage backend didn't respond in time; retry shortly")
+}
+
+func writeThrottled(w http.ResponseWriter, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(throttledRetryAfter))
+	common.WriteErrorResponse(w, http.StatusServiceUnavailable, common.ErrorCodeServiceUnavailable, message,
+		"The storage backend is throttling requests; retry shortly")
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/events"
+)
+
+// publishTimeout bounds publishing each event
+const publishTimeout = 10 * time.Second
+
+// publish sends each event to bus in the background, in order; a nil bus publishes nothing.
+// The events describe changes already made, so they go out whether or not the client stays
+// connected, and a failure is logged instead of failing the request.
+func publish(ctx context.Context, bus events.Publisher, published ...events.Event) {
+	if bus == nil || len(published) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for _, event := range published {
+			publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+			if err := bus.Publish(publishCtx, event); err != nil {
+				common.Logger(ctx).Warn("Failed to publish event", "type", event.Type, "event_id", event.ID, "user_id", event.UserID, "error", err)
+			}
+			cancel()
+		}
+	}()
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// FileExistsRequest describes content a client is about to upload
+type FileExistsRequest struct {
+	Size              *int64 `json:"size"`
+	ChecksumAlgorithm string `json:"checksum_algorithm"`
+	Checksum          string `json:"checksum"` // Base64, as declared on upload
+}
+
+// FileExistsResponse says whether the caller already stores the content, and where
+type FileExistsResponse struct {
+	Exists bool          `json:"exists"`
+	File   *FileMetadata `json:"file,omitempty"` // The newest file with the content
+}
+
+// FileExistsHandler tells a sync client whether the caller already has a file with the
+// given size and checksum, so it can skip uploading it. Only files whose upload declared
+// that checksum can match, since it's the only content hash recorded: completed files, and
+// single uploads whose object S3 stored under the checksum. Other users' files are never
+// looked at.
+func FileExistsHandler(s3Client ObjectStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req FileExistsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		if validationErrors := validateFileExists(&req); len(validationErrors) > 0 {
+			common.WriteValidationErrors(w, validationErrors)
+			return
+		}
+
+		files, err := dynamoClient.ListUserFiles(r.Context(), userID)
+		if err != nil {
+			writeStorageError(w, "Failed to list files", err, common.WriteDatabaseError)
+			return
+		}
+		var candidates []*storage.FileMetadata
+		for i := range files {
+			metadata := &files[i]
+			if metadata.TotalSize == *req.Size && metadata.ChecksumAlgorithm == req.ChecksumAlgorithm && metadata.Checksum == req.Checksum {
+				candidates = append(candidates, metadata)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].UploadedAt > candidates[j].UploadedAt })
+
+		for _, metadata := range candidates {
+			stored, err := storesContent(r.Context(), s3Client, metadata)
+			if err != nil {
+				writeStorageError(w, "Failed to check file", err, common.WriteS3Error)
+				return
+			}
+			if stored {
+				response := toFileMetadataResponse(metadata)
+				common.WriteOKResponse(w, FileExistsResponse{Exists: true, File: &response})
+				return
+			}
+		}
+		common.WriteOKResponse(w, FileExistsResponse{})
+	}
+}
+
+// validateFileExists checks a pre-check names content as an upload would declare it
+func validateFileExists(req *FileExistsRequest) []common.ValidationError {
+	var validationErrors []common.ValidationError
+	if req.Size == nil || *req.Size < 0 {
+		validationErrors = append(validationErrors, common.ValidationError{
+			Field:   "size",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: "size must be given, in bytes",
+		})
+	}
+	size, ok := checksumSizes[req.ChecksumAlgorithm]
+	if !ok {
+		return append(validationErrors, common.ValidationError{
+			Field:   "checksum_algorithm",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("checksum_algorithm must be %q or %q", storage.ChecksumSHA256, storage.ChecksumCRC32C),
+		})
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(req.Checksum); err != nil || len(decoded) != size {
+		validationErrors = append(validationErrors, common.ValidationError{
+			Field:   "checksum",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("checksum must be the base64 encoding of a %d byte %s digest", size, req.ChecksumAlgorithm),
+		})
+	}
+	return validationErrors
+}
+
+// storesContent reports whether a file with a matching checksum holds its content. A
+// single upload stays "uploading" until its object is checked, so storage is asked.
+func storesContent(ctx context.Context, s3Client ObjectStore, metadata *storage.FileMetadata) (bool, error) {
+	switch {
+	case metadata.Status == storage.FileStatusCompleted:
+		return true, nil
+	case metadata.Status != storage.FileStatusUploading || metadata.UploadType != "single":
+		return false, nil
+	}
+	reported, err := s3Client.ObjectChecksum(ctx, metadata.Bucket, metadata.S3Key, metadata.ChecksumAlgorithm)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return false, nil
+	}
+	return reported == metadata.Checksum, err
+}
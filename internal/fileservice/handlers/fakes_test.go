@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+var errNotStubbed = errors.New("fake: method not stubbed")
+
+// fakeObjectStore implements ObjectStore; each method calls its func field if set
+type fakeObjectStore struct {
+	generateUploadURL          func(ctx context.Context, userID, filename string, opts storage.UploadOptions) (string, string, error)
+	generateDownloadURL        func(ctx context.Context, bucket, s3Key string, opts storage.DownloadOptions) (string, error)
+	deleteObject               func(ctx context.Context, bucket, s3Key string) error
+	deleteObjects              func(ctx context.Context, bucket string, s3Keys []string) map[string]error
+	copyObject                 func(ctx context.Context, bucket, srcKey, dstKey string, size int64) error
+	readObjectHeader           func(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error)
+	openObject                 func(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error)
+	openObjectRange            func(ctx context.Context, bucket, s3Key string, offset, length int64) (io.ReadCloser, error)
+	putObject                  func(ctx context.Context, bucket, s3Key string, content io.ReadSeeker, size int64) error
+	objectChecksum             func(ctx context.Context, bucket, s3Key, algorithm string) (string, error)
+	initiateMultipartUpload    func(ctx context.Context, userID, filename string, opts storage.UploadOptions) (*storage.MultipartUploadInfo, error)
+	generateMultipartUploadURL func(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (string, error)
+	uploadPartCopy             func(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int, srcBucket, srcKey string, offset, length int64) (string, error)
+	completeMultipartUpload    func(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, parts []storage.CompletedPart) error
+	listParts                  func(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) ([]storage.UploadedPart, error)
+	getPart                    func(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (*storage.UploadedPart, error)
+	abortMultipartUpload       func(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) error
+}
+
+func (f *fakeObjectStore) GenerateUploadURL(ctx context.Context, userID, filename string, opts storage.UploadOptions) (string, string, error) {
+	if f.generateUploadURL == nil {
+		return "", "", errNotStubbed
+	}
+	return f.generateUploadURL(ctx, userID, filename, opts)
+}
+
+func (f *fakeObjectStore) GenerateDownloadURL(ctx context.Context, bucket, s3Key string, opts storage.DownloadOptions) (string, error) {
+	if f.generateDownloadURL == nil {
+		return "", errNotStubbed
+	}
+	return f.generateDownloadURL(ctx, bucket, s3Key, opts)
+}
+
+func (f *fakeObjectStore) DeleteObject(ctx context.Context, bucket, s3Key string) error {
+	if f.deleteObject == nil {
+		return errNotStubbed
+	}
+	return f.deleteObject(ctx, bucket, s3Key)
+}
+
+func (f *fakeObjectStore) DeleteObjects(ctx context.Context, bucket string, s3Keys []string) map[string]error {
+	if f.deleteObjects == nil {
+		failed := make(map[string]error, len(s3Keys))
+		for _, s3Key := range s3Keys {
+			failed[s3Key] = errNotStubbed
+		}
+		return failed
+	}
+	return f.deleteObjects(ctx, bucket, s3Keys)
+}
+
+func (f *fakeObjectStore) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error {
+	if f.copyObject == nil {
+		return errNotStubbed
+	}
+	return f.copyObject(ctx, bucket, srcKey, dstKey, size)
+}
+
+func (f *fakeObjectStore) ReadObjectHeader(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error) {
+	if f.readObjectHeader == nil {
+		return nil, errNotStubbed
+	}
+	return f.readObjectHeader(ctx, bucket, s3Key, n)
+}
+
+func (f *fakeObjectStore) OpenObject(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error) {
+	if f.openObject == nil {
+		return nil, errNotStubbed
+	}
+	return f.openObject(ctx, bucket, s3Key)
+}
+
+func (f *fakeObjectStore) OpenObjectRange(ctx context.Context, bucket, s3Key string, offset, length int64) (io.ReadCloser, error) {
+	if f.openObjectRange == nil {
+		return nil, errNotStubbed
+	}
+	return f.openObjectRange(ctx, bucket, s3Key, offset, length)
+}
+
+func (f *fakeObjectStore) PutObject(ctx context.Context, bucket, s3Key string, content io.ReadSeeker, size int64) error {
+	if f.putObject == nil {
+		return errNotStubbed
+	}
+	return f.putObject(ctx, bucket, s3Key, content, size)
+}
+
+func (f *fakeObjectStore) ObjectChecksum(ctx context.Context, bucket, s3Key, algorithm string) (string, error) {
+	if f.objectChecksum == nil {
+		return "", errNotStubbed
+	}
+	return f.objectChecksum(ctx, bucket, s3Key, algorithm)
+}
+
+// BucketFor puts every file in a single fake bucket
+func (f *fakeObjectStore) BucketFor(fileID string) string {
+	return "fake-bucket"
+}
+
+func (f *fakeObjectStore) InitiateMultipartUpload(ctx context.Context, userID, filename string, opts storage.UploadOptions) (*storage.MultipartUploadInfo, error) {
+	if f.initiateMultipartUpload == nil {
+		return nil, errNotStubbed
+	}
+	return f.initiateMultipartUpload(ctx, userID, filename, opts)
+}
+
+func (f *fakeObjectStore) GenerateMultipartUploadURL(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (string, error) {
+	if f.generateMultipartUploadURL == nil {
+		return "", errNotStubbed
+	}
+	return f.generateMultipartUploadURL(ctx, uploadInfo, partNumber)
+}
+
+func (f *fakeObjectStore) UploadPartCopy(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int, srcBucket, srcKey string, offset, length int64) (string, error) {
+	if f.uploadPartCopy == nil {
+		return "", errNotStubbed
+	}
+	return f.uploadPartCopy(ctx, uploadInfo, partNumber, srcBucket, srcKey, offset, length)
+}
+
+func (f *fakeObjectStore) CompleteMultipartUpload(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, parts []storage.CompletedPart) error {
+	if f.completeMultipartUpload == nil {
+		return errNotStubbed
+	}
+	return f.completeMultipartUpload(ctx, uploadInfo, parts)
+}
+
+func (f *fakeObjectStore) ListParts(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) ([]storage.UploadedPart, error) {
+	if f.listParts == nil {
+		return nil, errNotStubbed
+	}
+	return f.listParts(ctx, uploadInfo)
+}
+
+func (f *fakeObjectStore) GetPart(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (*storage.UploadedPart, error) {
+	if f.getPart == nil {
+		return nil, errNotStubbed
+	}
+	return f.getPart(ctx, uploadInfo, partNumber)
+}
+
+func (f *fakeObjectStore) AbortMultipartUpload(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) error {
+	if f.abortMultipartUpload == nil {
+		return errNotStubbed
+	}
+	return f.abortMultipartUpload(ctx, uploadInfo)
+}
+
+// fakeMetadataStore is an in-memory MetadataStore. Set err to make every call fail.
+type fakeMetadataStore struct {
+	files  map[string]*storage.FileMetadata
+	chunks map[string][]storage.FileChunk
+	urls   map[string][]storage.IssuedURL
+	usage  map[string]int64
+	err    error
+
+	policy  *storage.ContentTypePolicyRecord // Admin-set content type policy; unaffected by err
+	metrics *storage.SystemMetrics           // The aggregator's latest snapshot, if any
+
+	updateChunkStatus func(ctx context.Context, fileID string, chunkNumber int, status string, etag string) error
+}
+
+func newFakeMetadataStore(files ...*storage.FileMetadata) *fakeMetadataStore {
+	f := &fakeMetadataStore{
+		files:  make(map[string]*storage.FileMetadata),
+		chunks: make(map[string][]storage.FileChunk),
+		urls:   make(map[string][]storage.IssuedURL),
+		usage:  make(map[string]int64),
+	}
+	for _, file := range files {
+		f.files[file.FileID] = file
+	}
+	return f
+}
+
+func (f *fakeMetadataStore) SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error {
+	if f.err != nil {
+		return f.err
+	}
+	stored := *metadata
+	f.files[metadata.FileID] = &stored
+	return nil
+}
+
+func (f *fakeMetadataStore) GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	metadata, ok := f.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("file %w", storage.ErrNotFound)
+	}
+	copied := *metadata
+	return &copied, nil
+}
+
+func (f *fakeMetadataStore) ListUserFiles(ctx context.Context, userID string) ([]storage.FileMetadata, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var files []storage.FileMetadata
+	for _, file := range f.files {
+		if file.UserID == userID {
+			files = append(files, *file)
+		}
+	}
+	return files, nil
+}
+
+func (f *fakeMetadataStore) ListRecentFiles(ctx context.Context, userID string, limit int) ([]storage.FileMetadata, error) {
+	files, err := f.ListUserFiles(ctx, userID)
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, err
+}
+
+// ListFilesByUploadTime pages through the user's files as the index does, newest first
+func (f *fakeMetadataStore) ListFilesByUploadTime(ctx context.Context, userID string, uploaded storage.UploadTimeRange, after *storage.FileCursor, limit int) (*storage.FilesPage, error) {
+	files, err := f.ListUserFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].UploadedAt != files[j].UploadedAt {
+			return files[i].UploadedAt > files[j].UploadedAt
+		}
+		return files[i].FileID > files[j].FileID
+	})
+	page := &storage.FilesPage{}
+	read := 0
+	for i := range files {
+		if after != nil && (files[i].UploadedAt > after.UploadedAt ||
+			(files[i].UploadedAt == after.UploadedAt && files[i].FileID >= after.FileID)) {
+			continue
+		}
+		if read == limit {
+			page.Next = storage.CursorFor(&files[i-1])
+			break
+		}
+		read++
+		if uploaded.Contains(files[i].UploadedAt) {
+			page.Files = append(page.Files, files[i])
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeMetadataStore) RecordFileAccess(ctx context.Context, fileID string) error {
+	return f.err
+}
+
+func (f *fakeMetadataStore) SetFileTags(ctx context.Context, fileID string, tags map[string]string) error {
+	if f.err != nil {
+		return f.err
+	}
+	metadata, ok := f.files[fileID]
+	if !ok {
+		return fmt.Errorf("file %w", storage.ErrNotFound)
+	}
+	metadata.Tags = tags
+	if len(tags) == 0 {
+		metadata.Tags = nil
+	}
+	return nil
+}
+
+func (f *fakeMetadataStore) DeleteFileMetadata(ctx context.Context, fileID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.files, fileID)
+	return nil
+}
+
+func (f *fakeMetadataStore) DeleteFilesMetadata(ctx context.Context, fileIDs []string) map[string]error {
+	failed := make(map[string]error)
+	for _, fileID := range fileIDs {
+		if err := f.DeleteFileMetadata(ctx, fileID); err != nil {
+			failed[fileID] = err
+		}
+	}
+	return failed
+}
+
+func (f *fakeMetadataStore) SaveFileChunk(ctx context.Context, chunk *storage.FileChunk) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.chunks[chunk.FileID] = append(f.chunks[chunk.FileID], *chunk)
+	return nil
+}
+
+func (f *fakeMetadataStore) SaveFileChunks(ctx context.Context, chunks []storage.FileChunk) error {
+	for i := range chunks {
+		if err := f.SaveFileChunk(ctx, &chunks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeMetadataStore) GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.chunks[fileID], nil
+}
+
+func (f *fakeMetadataStore) DeleteFileChunks(ctx context.Context, fileID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.chunks, fileID)
+	return nil
+}
+
+func (f *fakeMetadataStore) UpdateChunkStatus(ctx context.Context, fileID string, chunkNumber int, status string, etag string) error {
+	if f.updateChunkStatus != nil {
+		return f.updateChunkStatus(ctx, fileID, chunkNumber, status, etag)
+	}
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.chunks[fileID] {
+		if f.chunks[fileID][i].ChunkNumber == chunkNumber {
+			if file, ok := f.files[fileID]; ok {
+				switch previous := f.chunks[fileID][i].Status; {
+				case previous != "uploaded" && status == "uploaded":
+					file.UploadedParts++
+				case previous == "uploaded" && status != "uploaded":
+					file.UploadedParts--
+				}
+			}
+			f.chunks[fileID][i].Status = status
+			f.chunks[fileID][i].ETag = etag
+			return nil
+		}
+	}
+	return fmt.Errorf("chunk %w", storage.ErrNotFound)
+}
+
+func (f *fakeMetadataStore) RecordChunkURLExpiry(ctx context.Context, fileID string, chunkNumber int, expiresAt time.Time) error {
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.chunks[fileID] {
+		if f.chunks[fileID][i].ChunkNumber == chunkNumber {
+			f.chunks[fileID][i].URLExpiresAt = expiresAt.Format(time.RFC3339)
+			return nil
+		}
+	}
+	return fmt.Errorf("chunk %w", storage.ErrNotFound)
+}
+
+func (f *fakeMetadataStore) ExpireFileChunks(ctx context.Context, fileID string, expiresAt time.Time) error {
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.chunks[fileID] {
+		f.chunks[fileID][i].ExpiresAt = expiresAt.Unix()
+	}
+	return nil
+}
+
+func (f *fakeMetadataStore) CheckUploadComplete(ctx context.Context, fileID string) (bool, []storage.FileChunk, error) {
+	if f.err != nil {
+		return false, nil, f.err
+	}
+	chunks := f.chunks[fileID]
+	for _, chunk := range chunks {
+		if chunk.Status != "uploaded" {
+			return false, chunks, nil
+		}
+	}
+	return len(chunks) > 0, chunks, nil
+}
+
+func (f *fakeMetadataStore) GetUserAnalytics(ctx context.Context, userID string) (*storage.UserAnalytics, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return nil, fmt.Errorf("analytics %w", storage.ErrNotFound)
+}
+
+func (f *fakeMetadataStore) GetSystemMetrics(ctx context.Context) (*storage.SystemMetrics, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.metrics != nil {
+		return f.metrics, nil
+	}
+	return nil, fmt.Errorf("metrics %w", storage.ErrNotFound)
+}
+
+func (f *fakeMetadataStore) GetReconciliationReport(ctx context.Context) (*storage.ReconciliationReport, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return nil, fmt.Errorf("reconciliation has not run yet: %w", storage.ErrNotFound)
+}
+
+func (f *fakeMetadataStore) RecordIssuedURL(ctx context.Context, issued *storage.IssuedURL) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.urls[issued.FileID] = append(f.urls[issued.FileID], *issued)
+	return nil
+}
+
+func (f *fakeMetadataStore) ListIssuedURLs(ctx context.Context, fileID string) ([]storage.IssuedURL, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.urls[fileID], nil
+}
+
+func (f *fakeMetadataStore) MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	stamp := revokedAt.Format(time.RFC3339)
+	revoked := 0
+	for i, issued := range f.urls[fileID] {
+		if issued.Active(revokedAt) {
+			f.urls[fileID][i].RevokedAt = &stamp
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (f *fakeMetadataStore) ReserveStorage(ctx context.Context, userID string, bytes, limit int64) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.usage[userID]+bytes > limit {
+		return storage.ErrQuotaExceeded
+	}
+	f.usage[userID] += bytes
+	return nil
+}
+
+func (f *fakeMetadataStore) ReleaseStorage(ctx context.Context, userID string, bytes int64) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.usage[userID] = max(f.usage[userID]-bytes, 0)
+	return nil
+}
+
+func (f *fakeMetadataStore) GetStorageUsage(ctx context.Context, userID string) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.usage[userID], nil
+}
+
+func (f *fakeMetadataStore) GetContentTypePolicy(ctx context.Context) (*storage.ContentTypePolicyRecord, error) {
+	if f.policy == nil {
+		return nil, storage.ErrNoContentTypePolicy
+	}
+	return f.policy, nil
+}
+
+func (f *fakeMetadataStore) SaveContentTypePolicy(ctx context.Context, record *storage.ContentTypePolicyRecord) error {
+	f.policy = record
+	return nil
+}
+
+func (f *fakeMetadataStore) DeleteContentTypePolicy(ctx context.Context) error {
+	f.policy = nil
+	return nil
+}
+
+// fakePublisher receives the events handlers publish, which they do in the background
+type fakePublisher chan events.Event
+
+func (f fakePublisher) Publish(ctx context.Context, event events.Event) error {
+	f <- event
+	return nil
+}
+
+// next waits for the next event published
+func (f fakePublisher) next(t *testing.T) events.Event {
+	t.Helper()
+	select {
+	case event := <-f:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event published")
+		return events.Event{}
+	}
+}
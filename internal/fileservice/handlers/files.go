@@ -3,22 +3,44 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"vibe-drop/internal/auth"
 	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/callbacks"
+	"vibe-drop/internal/fileservice/compaction"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/janitor"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
 	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/fileservice/throttle"
+	"vibe-drop/internal/fileservice/writeretry"
 )
 
 type PresignedURLResponse struct {
-	URL        string    `json:"url,omitempty"`        // For single uploads
-	ExpiresAt  time.Time `json:"expires_at,omitempty"` // For single uploads  
-	FileID     string    `json:"file_id"`
-	UploadType string    `json:"upload_type"`          // "single" or "multipart"
-	Chunks     []ChunkURL `json:"chunks,omitempty"`    // For multipart uploads
+	URL        string             `json:"url,omitempty"`        // For single uploads
+	ExpiresAt  time.Time          `json:"expires_at,omitempty"` // For single uploads  
+	FileID     string             `json:"file_id"`
+	UploadType string             `json:"upload_type"`          // "single" or "multipart"
+	Chunks     []ChunkURL         `json:"chunks,omitempty"`     // For multipart uploads
+	Hints      *UploadHints       `json:"hints,omitempty"`      // For multipart uploads
+	Filename   string             `json:"filename"`             // The name stored, which a collision may have changed
+	Collision  *FilenameCollision `json:"collision,omitempty"`  // Set if the name matched an existing file
+
+	// For single uploads with a checksum: headers the PUT must send, or S3 rejects it
+	UploadHeaders map[string]string `json:"upload_headers,omitempty"`
+	// Set if the URLs are long-lived and each accepts only one upload
+	Background bool `json:"background,omitempty"`
 }
 
 type ChunkURL struct {
@@ -28,13 +50,68 @@ type ChunkURL struct {
 	Size        int64     `json:"size"` // Expected chunk size
 }
 
+// UploadHints are server-recommended transfer settings for multipart uploads, so all
+// clients chunk, parallelise and retry the same way and the server can tune them centrally
+type UploadHints struct {
+	ChunkSize        int64       `json:"chunk_size"`
+	MaxParallelParts int         `json:"max_parallel_parts"`
+	URLTTLSeconds    int64       `json:"url_ttl_seconds"`
+	Retry            RetryPolicy `json:"retry"`
+}
+
+// RetryPolicy describes exponential backoff for failed part uploads
+type RetryPolicy struct {
+	MaxAttempts          int   `json:"max_attempts"`
+	InitialBackoffMillis int64 `json:"initial_backoff_ms"`
+	MaxBackoffMillis     int64 `json:"max_backoff_ms"`
+	RetryableStatusCodes []int `json:"retryable_status_codes"`
+}
+
+// retryableStatusCodes are the part-upload responses worth retrying
+var retryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// NewUploadHints builds the hints sent with multipart uploads from operator-tunable settings
+func NewUploadHints(maxParallelParts, maxAttempts int, initialBackoff, maxBackoff time.Duration) UploadHints {
+	return UploadHints{
+		ChunkSize:        multipartChunkSize,
+		MaxParallelParts: maxParallelParts,
+		URLTTLSeconds:    int64(storage.PresignedURLExpiry / time.Second),
+		Retry: RetryPolicy{
+			MaxAttempts:          maxAttempts,
+			InitialBackoffMillis: initialBackoff.Milliseconds(),
+			MaxBackoffMillis:     maxBackoff.Milliseconds(),
+			RetryableStatusCodes: retryableStatusCodes,
+		},
+	}
+}
+
 type FileMetadata struct {
-	ID          string    `json:"id"`
-	Filename    string    `json:"filename"`
-	Size        int64     `json:"size"`
-	ContentType string    `json:"content_type"`
-	UploadedAt  time.Time `json:"uploaded_at"`
-	UserID      string    `json:"user_id"`
+	ID                string     `json:"id"`
+	Filename          string     `json:"filename"`
+	OriginalFilename  string     `json:"original_filename,omitempty"` // As uploaded, if normalizing changed it
+	Size              int64      `json:"size"`
+	ContentType       string     `json:"content_type"`
+	UploadedAt        time.Time  `json:"uploaded_at"`
+	UserID            string     `json:"user_id"`
+	LastAccessedAt    *time.Time `json:"last_accessed_at,omitempty"`
+	Version           int        `json:"version,omitempty"`             // Set from version 2 onwards
+	PreviousVersionID string     `json:"previous_version_id,omitempty"` // The version this one follows
+	QuarantineReason  string     `json:"quarantine_reason,omitempty"`   // Set while the file is quarantined
+	ChecksumAlgorithm string     `json:"checksum_algorithm,omitempty"`  // Set if the upload declared a checksum
+	Checksum          string     `json:"checksum,omitempty"`
+	CorruptReason     string     `json:"corrupt_reason,omitempty"` // Set if the content failed checksum verification
+	ScanStatus        string     `json:"scan_status,omitempty"`    // "pending", "clean" or "infected" once queued for a virus scan
+	ScanSignature     string     `json:"scan_signature,omitempty"` // What a virus scan found in an infected file
+
+	// The owner's tags; a plain label has an empty value
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -43,12 +120,29 @@ type ErrorResponse struct {
 }
 
 type uploadRequest struct {
-	Filename string `json:"filename"`
-	Size     *int64 `json:"size,omitempty"`
+	Filename    string `json:"filename"`
+	Size        *int64 `json:"size,omitempty"`
+	ContentType string `json:"content_type,omitempty"` // Detected from the extension if omitted
+	OnCollision string `json:"on_collision,omitempty"` // Overrides the deployment's collision strategy
+
+	// Optional whole-file checksum, base64 encoded; S3 rejects content that doesn't match
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	Checksum          string `json:"checksum,omitempty"`
+
+	// For mobile background transfer sessions, which can't fetch new URLs mid-transfer:
+	// URLs outlive the whole session but each accepts only one upload
+	Background bool `json:"background,omitempty"`
+
+	originalFilename string             // The filename as sent, if normalizing changed it
+	collision        *FilenameCollision // Set once the filename has been checked against the user's files
+	urlExpiry        time.Duration      // How long the upload's URLs stay valid
+	client           *common.ClientInfo // From X-Client-Info, if the client sent it
+	apiKeyID         string             // The API key the request was made with, if any
 }
 
 func parseUploadRequest(r *http.Request) (*uploadRequest, error) {
-	var req uploadRequest
+	req := uploadRequest{client: common.ClientInfoFromContext(r.Context())}
+	req.apiKeyID, _ = auth.GetAPIKeyIDFromContext(r.Context())
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return nil, &common.ValidationError{
 			Field:   "request_body",
@@ -57,72 +151,98 @@ func parseUploadRequest(r *http.Request) (*uploadRequest, error) {
 		}
 	}
 	
+	// Validate and store the normalized name, keeping the name as sent if it differs
+	if normalized := common.NormalizeFilename(req.Filename); normalized != req.Filename {
+		req.originalFilename, req.Filename = req.Filename, normalized
+	}
+
 	// Convert to validation request and validate
 	validationReq := &common.FileUploadRequest{
 		Filename: req.Filename,
 		Size:     req.Size,
+		MimeType: req.ContentType,
 	}
 	
-	if validationErrors := common.ValidateFileUpload(validationReq); len(validationErrors) > 0 {
-		// Return the first validation error for simplicity
-		firstError := validationErrors[0]
-		return nil, &common.ValidationError{
-			Field:   firstError.Field,
-			Code:    firstError.Code,
-			Message: firstError.Message,
-		}
+	validationErrors := append(common.ValidateFileUpload(validationReq), validateChecksum(&req)...)
+	if len(validationErrors) > 0 {
+		return nil, common.ValidationErrors(validationErrors)
 	}
 	
+	req.urlExpiry = storage.PresignedURLExpiry
 	return &req, nil
 }
 
+// checksum is the whole-file checksum the request declared, if any
+func (r *uploadRequest) checksum() storage.Checksum {
+	return storage.Checksum{Algorithm: r.ChecksumAlgorithm, Value: r.Checksum}
+}
+
+// uploadOptions are what the request's upload URLs are signed with
+func (r *uploadRequest) uploadOptions() storage.UploadOptions {
+	return storage.UploadOptions{Checksum: r.checksum(), URLExpiry: r.urlExpiry}
+}
+
+// uploadURLTTL is the URL lifetime recorded on a background upload's metadata, or 0
+func (r *uploadRequest) uploadURLTTL() int64 {
+	if !r.Background {
+		return 0
+	}
+	return int64(r.urlExpiry / time.Second)
+}
+
+const multipartChunkSize = int64(5 * 1024 * 1024 * 1024) // 5GB per chunk
+
 func shouldUseMultipart(size *int64) bool {
 	const multipartThreshold = 5 * 1024 * 1024 * 1024 // 5GB in bytes
 	return size != nil && *size >= multipartThreshold
 }
 
-func handleMultipartUpload(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient, req *uploadRequest) (PresignedURLResponse, error) {
-	uploadInfo, err := s3Client.InitiateMultipartUpload(context.Background(), req.Filename)
+func handleMultipartUpload(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, retries *writeretry.Queue, userID string, req *uploadRequest, hints UploadHints) (PresignedURLResponse, error) {
+	uploadInfo, err := s3Client.InitiateMultipartUpload(ctx, userID, req.Filename, req.uploadOptions())
 	if err != nil {
 		return PresignedURLResponse{}, fmt.Errorf("failed to initiate multipart upload: %w", err)
 	}
 
-	// Extract fileID from S3 key (format: uuid-filename)
-	if len(uploadInfo.Key) < 37 { // UUID(36) + dash(1) = 37 minimum
-		return PresignedURLResponse{}, fmt.Errorf("invalid S3 key format")
-	}
-	fileID := uploadInfo.Key[:36] // Extract the full UUID (36 characters)
+	fileID := uploadInfo.FileID
 	s3Key := uploadInfo.Key
 
 	// Calculate chunk details
-	chunkSize := int64(5 * 1024 * 1024 * 1024) // 5GB per chunk
+	chunkSize := multipartChunkSize
 	totalChunks := int((*req.Size + chunkSize - 1) / chunkSize) // Ceiling division
 
 	// Generate presigned URLs for each chunk and create chunk records
-	chunks, err := createChunksAndRecords(s3Client, dynamoClient, uploadInfo, fileID, totalChunks, chunkSize, *req.Size)
+	chunks, err := createChunksAndRecords(ctx, s3Client, dynamoClient, retries, uploadInfo, fileID, userID, totalChunks, chunkSize, *req.Size, req.urlExpiry, req.client)
 	if err != nil {
 		return PresignedURLResponse{}, err
 	}
+	hints.URLTTLSeconds = int64(req.urlExpiry / time.Second)
 
 	response := PresignedURLResponse{
 		FileID:     fileID,
 		UploadType: "multipart",
 		Chunks:     chunks,
+		Hints:      &hints,
+		Filename:   req.Filename,
+		Collision:  req.collision,
+		Background: req.Background,
 	}
 
 	// Save multipart metadata
-	if err := saveMultipartMetadata(dynamoClient, fileID, req.Filename, *req.Size, s3Key, uploadInfo.UploadID, chunkSize, totalChunks); err != nil {
-		log.Printf("Warning: Failed to save multipart metadata: %v", err)
+	metadata := multipartMetadata(fileID, userID, req, uploadInfo.Bucket, s3Key, uploadInfo.UploadID, chunkSize, totalChunks)
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		common.Logger(ctx).Warn("Failed to save multipart metadata", "file_id", fileID, "error", err)
+		retries.RetryFileMetadata(ctx, metadata, err)
 	}
 
 	return response, nil
 }
 
-func createChunksAndRecords(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient, uploadInfo *storage.MultipartUploadInfo, fileID string, totalChunks int, chunkSize int64, totalSize int64) ([]ChunkURL, error) {
+func createChunksAndRecords(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, retries *writeretry.Queue, uploadInfo *storage.MultipartUploadInfo, fileID, userID string, totalChunks int, chunkSize int64, totalSize int64, urlExpiry time.Duration, client *common.ClientInfo) ([]ChunkURL, error) {
 	chunks := make([]ChunkURL, totalChunks)
+	records := make([]storage.FileChunk, totalChunks)
 	for i := 0; i < totalChunks; i++ {
 		partNumber := i + 1 // S3 part numbers are 1-indexed
-		chunkURL, err := s3Client.GenerateMultipartUploadURL(context.Background(), uploadInfo, partNumber)
+		chunkURL, err := s3Client.GenerateMultipartUploadURL(ctx, uploadInfo, partNumber)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate chunk upload URL: %w", err)
 		}
@@ -136,57 +256,95 @@ func createChunksAndRecords(s3Client *storage.S3Client, dynamoClient *storage.Dy
 		chunks[i] = ChunkURL{
 			ChunkNumber: partNumber,
 			URL:         chunkURL,
-			ExpiresAt:   time.Now().Add(15 * time.Minute),
+			ExpiresAt:   time.Now().Add(urlExpiry),
 			Size:        currentChunkSize,
 		}
+		auditIssuedURL(ctx, dynamoClient, client, fileID, userID, uploadInfo.Key, storage.URLPurposeUploadPart, partNumber, urlExpiry)
 
-		// Create chunk record in DynamoDB
-		chunkRecord := &storage.FileChunk{
+		records[i] = storage.FileChunk{
 			FileID:       fileID,
 			ChunkNumber:  partNumber,
 			Size:         currentChunkSize,
 			Status:       "pending",
 			S3PartNumber: partNumber,
+			URLExpiresAt: chunks[i].ExpiresAt.Format(time.RFC3339),
 		}
-		if err := dynamoClient.SaveFileChunk(context.Background(), chunkRecord); err != nil {
-			log.Printf("Warning: Failed to save chunk record: %v", err)
-		}
+	}
+
+	// Saved together, as a large upload has thousands of chunks
+	if err := dynamoClient.SaveFileChunks(ctx, records); err != nil {
+		common.Logger(ctx).Warn("Failed to save chunk records", "file_id", fileID, "error", err)
+		retries.RetryFileChunks(ctx, fileID, records, err)
 	}
 	return chunks, nil
 }
 
-func saveMultipartMetadata(dynamoClient *storage.DynamoClient, fileID, filename string, totalSize int64, s3Key, uploadID string, chunkSize int64, totalChunks int) error {
+// auditIssuedURL records a presigned URL, and the client it went to, so operators can see
+// what was handed out if a link leaks. Revocation rotates the object key and so doesn't
+// depend on the record, which is why a failure to write it is logged rather than failing
+// the request.
+func auditIssuedURL(ctx context.Context, dynamoClient MetadataStore, client *common.ClientInfo, fileID, userID, s3Key, purpose string, partNumber int, expiry time.Duration) {
+	issued := storage.NewIssuedURL(fileID, userID, s3Key, purpose, partNumber, expiry)
+	issued.Client = client
+	if err := dynamoClient.RecordIssuedURL(ctx, issued); err != nil {
+		common.Logger(ctx).Warn("Failed to audit issued URL", "purpose", purpose, "file_id", fileID, "error", err)
+	}
+}
+
+// releaseStorage returns bytes to the user's quota; a failure only overstates their usage, so it is logged
+func releaseStorage(ctx context.Context, dynamoClient MetadataStore, userID string, bytes int64) {
+	if err := dynamoClient.ReleaseStorage(ctx, userID, bytes); err != nil {
+		common.Logger(ctx).Warn("Failed to release storage", "bytes", bytes, "user_id", userID, "error", err)
+	}
+}
+
+func multipartMetadata(fileID, userID string, req *uploadRequest, bucket, s3Key, uploadID string, chunkSize int64, totalChunks int) *storage.FileMetadata {
 	totalChunksInt := totalChunks
 	chunkSizeInt := chunkSize
 	metadata := &storage.FileMetadata{
-		FileID:      fileID,
-		Filename:    filename,
-		TotalSize:   totalSize,
-		ContentType: "application/octet-stream",
-		Status:      "uploading",
-		UploadType:  "multipart",
-		UploadedAt:  time.Now().Format(time.RFC3339),
-		UserID:      "default-user",
-		S3Key:       s3Key,
-		S3UploadID:  &uploadID,
-		ChunkSize:   &chunkSizeInt,
-		TotalChunks: &totalChunksInt,
-	}
-	return dynamoClient.SaveFileMetadata(context.Background(), metadata)
-}
-
-func handleSingleUpload(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient, req *uploadRequest) (PresignedURLResponse, error) {
-	url, fileID, err := s3Client.GenerateUploadURL(context.Background(), req.Filename)
+		FileID:            fileID,
+		Filename:          req.Filename,
+		OriginalFilename:  req.originalFilename,
+		TotalSize:         *req.Size,
+		ContentType:       req.ContentType,
+		Status:            storage.FileStatusUploading,
+		UploadType:        "multipart",
+		UploadedAt:        time.Now().Format(time.RFC3339),
+		UserID:            userID,
+		S3Key:             s3Key,
+		Bucket:            bucket,
+		S3UploadID:        &uploadID,
+		ChunkSize:         &chunkSizeInt,
+		TotalChunks:       &totalChunksInt,
+		ChecksumAlgorithm: req.ChecksumAlgorithm,
+		Checksum:          req.Checksum,
+		UploadURLTTL:      req.uploadURLTTL(),
+		Client:            req.client,
+		APIKeyID:          req.apiKeyID,
+	}
+	setVersion(metadata, req.collision)
+	return metadata
+}
+
+func handleSingleUpload(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, retries *writeretry.Queue, userID string, req *uploadRequest) (PresignedURLResponse, error) {
+	url, fileID, err := s3Client.GenerateUploadURL(ctx, userID, req.Filename, req.uploadOptions())
 	if err != nil {
 		return PresignedURLResponse{}, fmt.Errorf("failed to generate upload URL: %w", err)
 	}
 
-	s3Key := fileID + "-" + req.Filename
+	s3Key := storage.ObjectKey(userID, fileID, req.Filename)
+	auditIssuedURL(ctx, dynamoClient, req.client, fileID, userID, s3Key, storage.URLPurposeUpload, 0, req.urlExpiry)
 	response := PresignedURLResponse{
 		URL:        url,
-		ExpiresAt:  time.Now().Add(15 * time.Minute),
+		ExpiresAt:  time.Now().Add(req.urlExpiry),
 		FileID:     fileID,
 		UploadType: "single",
+		Filename:   req.Filename,
+		Collision:  req.collision,
+		Background: req.Background,
+	}
+	if checksum := req.checksum(); !checksum.IsZero() {
+		response.UploadHeaders = map[string]string{checksum.Header(): checksum.Value}
 	}
 
 	// Save single upload metadata
@@ -195,47 +353,160 @@ func handleSingleUpload(s3Client *storage.S3Client, dynamoClient *storage.Dynamo
 		totalSize = *req.Size
 	}
 	metadata := &storage.FileMetadata{
-		FileID:      fileID,
-		Filename:    req.Filename,
-		TotalSize:   totalSize,
-		ContentType: "application/octet-stream",
-		Status:      "uploading",
-		UploadType:  "single",
-		UploadedAt:  time.Now().Format(time.RFC3339),
-		UserID:      "default-user",
-		S3Key:       s3Key,
+		FileID:            fileID,
+		Filename:          req.Filename,
+		OriginalFilename:  req.originalFilename,
+		TotalSize:         totalSize,
+		ContentType:       req.ContentType,
+		Status:            storage.FileStatusUploading,
+		UploadType:        "single",
+		UploadedAt:        time.Now().Format(time.RFC3339),
+		UserID:            userID,
+		S3Key:             s3Key,
+		Bucket:            s3Client.BucketFor(fileID),
+		ChecksumAlgorithm: req.ChecksumAlgorithm,
+		Checksum:          req.Checksum,
+		UploadURLTTL:      req.uploadURLTTL(),
+		Client:            req.client,
+		APIKeyID:          req.apiKeyID,
 	}
+	setVersion(metadata, req.collision)
 
-	if err := dynamoClient.SaveFileMetadata(context.Background(), metadata); err != nil {
-		log.Printf("Warning: Failed to save file metadata: %v", err)
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		common.Logger(ctx).Warn("Failed to save file metadata", "file_id", fileID, "error", err)
+		retries.RetryFileMetadata(ctx, metadata, err)
 	}
 
 	return response, nil
 }
 
-func GenerateUploadURLHandler(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient) http.HandlerFunc {
+// UploadPlan is the strategy an upload would use, returned instead of URLs by a dry run
+type UploadPlan struct {
+	DryRun      bool               `json:"dry_run"`
+	Filename    string             `json:"filename"` // After any collision rename
+	Size        int64              `json:"size"`
+	ContentType string             `json:"content_type"`
+	UploadType  string             `json:"upload_type"`            // "single" or "multipart"
+	TotalChunks int                `json:"total_chunks,omitempty"` // For multipart uploads
+	ChunkSize   int64              `json:"chunk_size,omitempty"`   // For multipart uploads
+	Hints       *UploadHints       `json:"hints,omitempty"`        // For multipart uploads
+	Collision   *FilenameCollision `json:"collision,omitempty"`    // Set if the name matched an existing file
+}
+
+// planUpload works out how an already-validated request would be uploaded
+func planUpload(req *uploadRequest, hints UploadHints) UploadPlan {
+	plan := UploadPlan{DryRun: true, Filename: req.Filename, ContentType: req.ContentType, UploadType: "single", Collision: req.collision}
+	if req.Size != nil {
+		plan.Size = *req.Size
+	}
+	if shouldUseMultipart(req.Size) {
+		plan.UploadType = "multipart"
+		plan.ChunkSize = multipartChunkSize
+		plan.TotalChunks = int((plan.Size + multipartChunkSize - 1) / multipartChunkSize)
+		hints.URLTTLSeconds = int64(req.urlExpiry / time.Second)
+		plan.Hints = &hints
+	}
+	return plan
+}
+
+// GenerateUploadURLHandler issues upload URLs, first checking the file against the content
+// type policy and reserving its size against the user's storage quota of quotaBytes.
+// Background uploads get single-use URLs valid for backgroundURLExpiry. If the file's
+// metadata or chunk records can't be saved the URLs are still returned and the writes are
+// queued on retries.
+func GenerateUploadURLHandler(s3Client ObjectStore, dynamoClient MetadataStore, hints UploadHints, quotaBytes int64, policies *ContentTypePolicies, collisionStrategy string, backgroundURLExpiry time.Duration, retries *writeretry.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
 		req, err := parseUploadRequest(r)
 		if err != nil {
-			// Check if it's a validation error with specific code
-			if validationErr, ok := err.(*common.ValidationError); ok {
-				common.WriteErrorResponse(w, http.StatusBadRequest, validationErr.Code, validationErr.Message, 
-					fmt.Sprintf("Field: %s", validationErr.Field))
+			// Check if it's a validation error with specific codes
+			if validationErrs, ok := err.(common.ValidationErrors); ok {
+				common.WriteValidationErrors(w, validationErrs)
+			} else if validationErr, ok := err.(*common.ValidationError); ok {
+				common.WriteValidationErrors(w, []common.ValidationError{*validationErr})
 			} else {
 				common.WriteValidationError(w, "Invalid upload request", err.Error())
 			}
 			return
 		}
+		if req.Background {
+			req.urlExpiry = backgroundURLExpiry
+		}
+
+		// Check the file's type and size against the deployment's content type policy
+		req.ContentType = common.DetectContentType(req.Filename, req.ContentType)
+		current, err := policies.Current(r.Context())
+		if err != nil {
+			writeStorageError(w, "Failed to load content type policy", err, common.WriteDatabaseError)
+			return
+		}
+		if policyErrs := current.Policy.Check(req.ContentType, *req.Size); len(policyErrs) > 0 {
+			common.WriteValidationErrors(w, policyErrs)
+			return
+		}
+
+		// Settle what happens if the user already has a file by this name
+		strategy := collisionStrategy
+		if req.OnCollision != "" {
+			strategy = req.OnCollision
+		}
+		if !common.ValidCollisionStrategy(strategy) {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "on_collision",
+				Code:    common.ErrorCodeInvalidValue,
+				Message: fmt.Sprintf("on_collision must be %q, %q or %q", common.CollisionReject, common.CollisionRename, common.CollisionVersion),
+			}})
+			return
+		}
+		existing, err := dynamoClient.ListUserFiles(r.Context(), userID)
+		if err != nil {
+			writeStorageError(w, "Failed to check for an existing file", err, common.WriteDatabaseError)
+			return
+		}
+		req.Filename, req.collision = resolveCollision(existing, req.Filename, strategy)
+		if req.collision != nil && strategy == common.CollisionReject {
+			common.WriteConflictError(w, "Filename already exists",
+				fmt.Sprintf("File %s is already named %s; choose another name or a different on_collision strategy", req.collision.ExistingFileID, req.Filename))
+			return
+		}
+
+		// A dry run stops after validation and reports the plan without creating any state
+		if dryRun := r.URL.Query().Get("dry_run"); dryRun != "" {
+			enabled, err := strconv.ParseBool(dryRun)
+			if err != nil {
+				common.WriteBadRequestError(w, "Invalid dry_run value", "dry_run must be true or false")
+				return
+			}
+			if enabled {
+				common.WriteOKResponse(w, planUpload(req, hints))
+				return
+			}
+		}
+
+		if err := dynamoClient.ReserveStorage(r.Context(), userID, *req.Size, quotaBytes); err != nil {
+			if errors.Is(err, storage.ErrQuotaExceeded) {
+				common.WriteErrorResponse(w, http.StatusForbidden, common.ErrorCodeQuotaExceeded, "Storage quota exceeded",
+					fmt.Sprintf("Uploading %d bytes would exceed your %d byte quota; delete files to free space", *req.Size, quotaBytes))
+				return
+			}
+			writeStorageError(w, "Failed to check storage quota", err, common.WriteDatabaseError)
+			return
+		}
 
 		var response PresignedURLResponse
 		if shouldUseMultipart(req.Size) {
-			response, err = handleMultipartUpload(s3Client, dynamoClient, req)
+			response, err = handleMultipartUpload(r.Context(), s3Client, dynamoClient, retries, userID, req, hints)
 		} else {
-			response, err = handleSingleUpload(s3Client, dynamoClient, req)
+			response, err = handleSingleUpload(r.Context(), s3Client, dynamoClient, retries, userID, req)
 		}
 
 		if err != nil {
-			common.WriteS3Error(w, "Failed to generate upload URL", err.Error())
+			releaseStorage(r.Context(), dynamoClient, userID, *req.Size)
+			writeStorageError(w, "Failed to generate upload URL", err, common.WriteS3Error)
 			return
 		}
 
@@ -243,28 +514,58 @@ func GenerateUploadURLHandler(s3Client *storage.S3Client, dynamoClient *storage.
 	}
 }
 
-func GenerateDownloadURLHandler(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient) http.HandlerFunc {
+// GenerateDownloadURLHandler issues a presigned download URL. Quarantined and corrupt files
+// are refused, as are files not scanned clean when scans are enforced. Single uploads have
+// no completion step, so their checksum is verified, the executable policy screens them and
+// they are queued for a virus scan the first time a download is requested. perFile
+// throttles issuance for each file; it is checked only once the file is known to be the
+// caller's, so other users can't use up a file's allowance. The query can ask for a lifetime
+// of up to maxExpiry and how the browser should treat the file (see parseDownloadOptions).
+func GenerateDownloadURLHandler(s3Client ObjectStore, dynamoClient MetadataStore, executables quarantine.Policy, scans scan.Policy, perFile *throttle.Limiter, maxExpiry time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		fileID := vars["id"]
 
 		// Look up file metadata from DynamoDB to get the correct S3 key
-		metadata, err := dynamoClient.GetFileMetadata(context.Background(), fileID)
-		if err != nil {
-			common.WriteNotFoundError(w, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID))
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+		opts, validationErr := parseDownloadOptions(r, metadata, maxExpiry)
+		if validationErr != nil {
+			common.WriteValidationErrors(w, []common.ValidationError{*validationErr})
+			return
+		}
+
+		if !screenDownload(w, r, s3Client, dynamoClient, executables, scans, metadata) {
+			return
+		}
+
+		if ok, retryAfter := perFile.Allow(fileID); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			common.WriteErrorResponse(w, http.StatusTooManyRequests, common.ErrorCodeTooManyRequests,
+				"Too many download requests for this file",
+				fmt.Sprintf("Download URLs for this file are limited; retry in %s", retryAfter.Round(time.Second)))
 			return
 		}
 
 		// Generate presigned URL using the correct S3 key from metadata
-		url, err := s3Client.GenerateDownloadURL(context.Background(), metadata.S3Key)
+		url, err := s3Client.GenerateDownloadURL(r.Context(), metadata.Bucket, metadata.S3Key, opts)
 		if err != nil {
-			common.WriteS3Error(w, "Failed to generate download URL", err.Error())
+			writeStorageError(w, "Failed to generate download URL", err, common.WriteS3Error)
 			return
 		}
 
+		auditIssuedURL(r.Context(), dynamoClient, common.ClientInfoFromContext(r.Context()), fileID, metadata.UserID, metadata.S3Key, storage.URLPurposeDownload, 0, opts.URLExpiry)
+
+		// Track access for the recent files view; a failure here shouldn't block the download
+		if err := dynamoClient.RecordFileAccess(r.Context(), fileID); err != nil {
+			common.Logger(r.Context()).Warn("Failed to record access", "file_id", fileID, "error", err)
+		}
+
 		response := PresignedURLResponse{
 			URL:       url,
-			ExpiresAt: time.Now().Add(15 * time.Minute),
+			ExpiresAt: time.Now().Add(opts.URLExpiry),
 			FileID:    fileID,
 		}
 
@@ -272,53 +573,143 @@ func GenerateDownloadURLHandler(s3Client *storage.S3Client, dynamoClient *storag
 	}
 }
 
-func GetFileMetadataHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc {
+// screenDownload checks a file's content may be served, writing why not if it can't. A
+// single upload is verified, screened and queued for a virus scan the first time.
+func screenDownload(w http.ResponseWriter, r *http.Request, s3Client ObjectStore, dynamoClient MetadataStore, executables quarantine.Policy, scans scan.Policy, metadata *storage.FileMetadata) bool {
+	if metadata.UploadType == "single" && metadata.Status == storage.FileStatusUploading && (executables.Enabled() || scans.Enabled() || metadata.ChecksumAlgorithm != "") {
+		verified, err := verifyChecksum(r.Context(), s3Client, dynamoClient, metadata)
+		reason := ""
+		if err == nil && verified {
+			reason, err = quarantine.Screen(r.Context(), s3Client, dynamoClient, executables, metadata)
+		}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			common.WriteConflictError(w, "Upload not finished", "The file's content hasn't been uploaded yet")
+			return false
+		}
+		if err != nil {
+			writeStorageError(w, "Failed to check file", err, common.WriteS3Error)
+			return false
+		}
+		if verified && reason == "" {
+			metadata.Status = storage.FileStatusCompleted
+			metadata.CompletedAt = &[]string{time.Now().Format(time.RFC3339)}[0]
+			if scans.Enabled() {
+				scan.Enqueue(metadata)
+			}
+			if err := dynamoClient.SaveFileMetadata(r.Context(), metadata); err != nil {
+				common.Logger(r.Context()).Warn("Failed to update file status", "file_id", metadata.FileID, "error", err)
+			}
+		}
+	}
+	if metadata.Status == storage.FileStatusQuarantined {
+		writeQuarantinedError(w, metadata)
+		return false
+	}
+	if metadata.Status == storage.FileStatusCorrupt {
+		writeCorruptError(w, metadata)
+		return false
+	}
+	return !scans.Enforced() || checkScanned(r.Context(), w, dynamoClient, scans, metadata)
+}
+
+// Browser treatments a download URL can ask for with download=
+const (
+	dispositionAttachment = "attachment" // Save the file
+	dispositionInline     = "inline"     // Display it, if the browser can
+)
+
+// parseDownloadOptions reads a download URL request's query. expires_in is the URL's
+// lifetime in seconds, up to maxExpiry. download (attachment or inline) has the URL served
+// with a Content-Disposition naming the file and with its content type, so browsers save it
+// under its own name rather than the object key's; filename overrides that name and implies
+// attachment. Without either the object is served as stored.
+func parseDownloadOptions(r *http.Request, metadata *storage.FileMetadata, maxExpiry time.Duration) (storage.DownloadOptions, *common.ValidationError) {
+	query := r.URL.Query()
+	opts := storage.DownloadOptions{URLExpiry: storage.PresignedURLExpiry}
+
+	if expiresIn := query.Get("expires_in"); expiresIn != "" {
+		seconds, err := strconv.ParseInt(expiresIn, 10, 64)
+		if err != nil || seconds < 1 || seconds > int64(maxExpiry/time.Second) {
+			return opts, &common.ValidationError{
+				Field:   "expires_in",
+				Code:    common.ErrorCodeInvalidValue,
+				Message: fmt.Sprintf("expires_in must be a number of seconds between 1 and %d", int64(maxExpiry/time.Second)),
+			}
+		}
+		opts.URLExpiry = time.Duration(seconds) * time.Second
+	}
+
+	disposition := query.Get("download")
+	switch disposition {
+	case "", dispositionAttachment, dispositionInline:
+	default:
+		return opts, &common.ValidationError{
+			Field:   "download",
+			Code:    common.ErrorCodeInvalidValue,
+			Message: fmt.Sprintf("download must be %s or %s", dispositionAttachment, dispositionInline),
+		}
+	}
+
+	filename := metadata.Filename
+	if override := query.Get("filename"); override != "" {
+		filename = common.NormalizeFilename(override)
+		if errs := common.ValidateFilename(filename); len(errs) > 0 {
+			return opts, &errs[0]
+		}
+		if disposition == "" {
+			disposition = dispositionAttachment
+		}
+	}
+
+	if disposition != "" {
+		// Non-ASCII names are sent as filename* (RFC 6266), which browsers decode
+		opts.ContentDisposition = mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+		opts.ContentType = metadata.ContentType
+	}
+	return opts, nil
+}
+
+func GetFileMetadataHandler(dynamoClient MetadataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		fileID := vars["id"]
 
 		// Get real file metadata from DynamoDB
-		metadata, err := dynamoClient.GetFileMetadata(context.Background(), fileID)
-		if err != nil {
-			common.WriteNotFoundError(w, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID))
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
 			return
 		}
 
 		// Convert to response format (matches existing API)
-		response := FileMetadata{
-			ID:          metadata.FileID,
-			Filename:    metadata.Filename,
-			Size:        metadata.TotalSize,
-			ContentType: metadata.ContentType,
-			UploadedAt:  parseTime(metadata.UploadedAt),
-			UserID:      metadata.UserID,
-		}
+		response := toFileMetadataResponse(metadata)
 
 		common.WriteOKResponse(w, response)
 	}
 }
 
-func ListFilesHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc {
+// ListFilesHandler lists the user's files. With ?q= only files whose name contains the query
+// are listed, compared normalized and case-insensitively.
+func ListFilesHandler(dynamoClient MetadataStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get real files from DynamoDB for default user
-		// TODO: Replace with real user ID from auth
-		metadataList, err := dynamoClient.ListUserFiles(context.Background(), "default-user")
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		metadataList, err := dynamoClient.ListUserFiles(r.Context(), userID)
 		if err != nil {
-			common.WriteDatabaseError(w, "Failed to list files", err.Error())
+			writeStorageError(w, "Failed to list files", err, common.WriteDatabaseError)
 			return
 		}
 
 		// Convert to response format
-		files := make([]FileMetadata, len(metadataList))
-		for i, metadata := range metadataList {
-			files[i] = FileMetadata{
-				ID:          metadata.FileID,
-				Filename:    metadata.Filename,
-				Size:        metadata.TotalSize,
-				ContentType: metadata.ContentType,
-				UploadedAt:  parseTime(metadata.UploadedAt),
-				UserID:      metadata.UserID,
+		query := common.FilenameSearchKey(r.URL.Query().Get("q"))
+		files := make([]FileMetadata, 0, len(metadataList))
+		for i := range metadataList {
+			if query != "" && !strings.Contains(common.FilenameSearchKey(metadataList[i].Filename), query) {
+				continue
 			}
+			files = append(files, toFileMetadataResponse(&metadataList[i]))
 		}
 
 		responseData := map[string]interface{}{
@@ -330,38 +721,193 @@ func ListFilesHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc {
 	}
 }
 
-func DeleteFileHandler(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient) http.HandlerFunc {
+const (
+	defaultRecentFilesLimit = 10
+	maxRecentFilesLimit     = 100
+)
+
+// RecentFilesHandler returns the user's most recently accessed files for quick access views
+func RecentFilesHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		limit := defaultRecentFilesLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > maxRecentFilesLimit {
+				common.WriteValidationError(w, "Invalid limit",
+					fmt.Sprintf("limit must be an integer between 1 and %d", maxRecentFilesLimit))
+				return
+			}
+			limit = parsed
+		}
+
+		metadataList, err := dynamoClient.ListRecentFiles(r.Context(), userID, limit)
+		if err != nil {
+			writeStorageError(w, "Failed to list recent files", err, common.WriteDatabaseError)
+			return
+		}
+
+		files := make([]FileMetadata, len(metadataList))
+		for i := range metadataList {
+			files[i] = toFileMetadataResponse(&metadataList[i])
+		}
+
+		responseData := map[string]interface{}{
+			"files": files,
+			"count": len(files),
+		}
+
+		common.WriteOKResponse(w, responseData)
+	}
+}
+
+// toFileMetadataResponse converts a stored metadata record to the API response format
+func toFileMetadataResponse(metadata *storage.FileMetadata) FileMetadata {
+	response := FileMetadata{
+		ID:               metadata.FileID,
+		Filename:         metadata.Filename,
+		OriginalFilename: metadata.OriginalFilename,
+		Size:             metadata.TotalSize,
+		ContentType:      metadata.ContentType,
+		UploadedAt:       parseTime(metadata.UploadedAt),
+		UserID:           metadata.UserID,
+	}
+	if metadata.LastAccessedAt != nil {
+		accessedAt := parseTime(*metadata.LastAccessedAt)
+		response.LastAccessedAt = &accessedAt
+	}
+	if metadata.Version > 1 {
+		response.Version = metadata.Version
+		response.PreviousVersionID = metadata.PreviousVersionID
+	}
+	if metadata.QuarantineReason != nil {
+		response.QuarantineReason = *metadata.QuarantineReason
+	}
+	response.ChecksumAlgorithm = metadata.ChecksumAlgorithm
+	response.Checksum = metadata.Checksum
+	if metadata.CorruptReason != nil {
+		response.CorruptReason = *metadata.CorruptReason
+	}
+	response.ScanStatus = metadata.ScanStatus
+	response.ScanSignature = metadata.ScanSignature
+	response.Tags = metadata.Tags
+	return response
+}
+
+// DeleteFileHandler deletes one of the caller's files, publishing it to bus as file.deleted
+func DeleteFileHandler(s3Client ObjectStore, dynamoClient MetadataStore, bus events.Publisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		fileID := vars["id"]
 
 		// Get file metadata to find S3 key
-		metadata, err := dynamoClient.GetFileMetadata(context.Background(), fileID)
-		if err != nil {
-			common.WriteNotFoundError(w, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID))
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
 			return
 		}
 
 		// Delete from S3 first (fail fast if S3 deletion fails)
-		if err := s3Client.DeleteObject(context.Background(), metadata.S3Key); err != nil {
-			log.Printf("Failed to delete S3 object %s: %v", metadata.S3Key, err)
-			common.WriteS3Error(w, "Failed to delete file from storage", err.Error())
+		if err := s3Client.DeleteObject(r.Context(), metadata.Bucket, metadata.S3Key); err != nil {
+			common.Logger(r.Context()).Error("Failed to delete S3 object", "file_id", fileID, "s3_key", metadata.S3Key, "error", err)
+			writeStorageError(w, "Failed to delete file from storage", err, common.WriteS3Error)
 			return
 		}
 
 		// Delete metadata from DynamoDB (only after S3 deletion succeeds)
-		if err := dynamoClient.DeleteFileMetadata(context.Background(), fileID); err != nil {
-			log.Printf("Warning: S3 object deleted but DynamoDB cleanup failed for %s: %v", fileID, err)
-			common.WriteDatabaseError(w, "File deleted but metadata cleanup failed", err.Error())
+		if err := dynamoClient.DeleteFileMetadata(r.Context(), fileID); err != nil {
+			common.Logger(r.Context()).Warn("S3 object deleted but metadata cleanup failed", "file_id", fileID, "error", err)
+			writeStorageError(w, "File deleted but metadata cleanup failed", err, common.WriteDatabaseError)
 			return
 		}
 
+		releaseStorage(r.Context(), dynamoClient, metadata.UserID, metadata.TotalSize)
+		publish(r.Context(), bus, events.FileDeleted(metadata))
+
 		// For DELETE operations, 204 No Content is more appropriate than 200 OK
 		// since the resource has been successfully deleted and there's no content to return
 		common.WriteNoContentResponse(w)
 	}
 }
 
+// AbortMultipartUploadHandler abandons an in-progress multipart upload: S3 discards the
+// parts it holds and the upload's chunk records and metadata are removed. The file is
+// published to bus as file.deleted.
+func AbortMultipartUploadHandler(s3Client ObjectStore, dynamoClient MetadataStore, bus events.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+		if metadata.UploadType != "multipart" || metadata.S3UploadID == nil {
+			common.WriteBadRequestError(w, "Not a multipart upload", "Only multipart uploads can be aborted; delete the file instead")
+			return
+		}
+		if metadata.Status == storage.FileStatusCompleted {
+			common.WriteConflictError(w, "Upload already completed", "Delete the file instead")
+			return
+		}
+		if err := storage.ValidateObjectKey(metadata.UserID, metadata.S3Key); err != nil {
+			common.Logger(r.Context()).Warn("Rejected abort", "file_id", fileID, "error", err)
+			common.WriteForbiddenError(w, "Invalid upload key", "The upload's storage key does not belong to its owner")
+			return
+		}
+
+		if err := janitor.AbortUpload(r.Context(), s3Client, dynamoClient, metadata); err != nil {
+			common.Logger(r.Context()).Error("Failed to abort multipart upload", "file_id", fileID, "error", err)
+			writeStorageError(w, "Failed to abort upload", err, common.WriteS3Error)
+			return
+		}
+		publish(r.Context(), bus, events.FileDeleted(metadata))
+
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// writeQuarantinedError tells the owner their file is being held back, and why
+func writeQuarantinedError(w http.ResponseWriter, metadata *storage.FileMetadata) {
+	reason := "The file failed the executable policy"
+	if metadata.QuarantineReason != nil {
+		reason = *metadata.QuarantineReason
+	}
+	common.WriteErrorResponse(w, http.StatusForbidden, common.ErrorCodeFileQuarantined, "File quarantined", reason)
+}
+
+// requestUser returns the authenticated user's ID, writing a 401 if the request has none
+func requestUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		common.WriteUnauthorizedError(w, "Authentication required", err.Error())
+		return "", false
+	}
+	return userID, true
+}
+
+// ownedFile loads a file's metadata for the authenticated user. Another user's file is
+// reported as not found rather than forbidden, so file IDs can't be probed.
+func ownedFile(w http.ResponseWriter, r *http.Request, dynamoClient MetadataStore, fileID string) (*storage.FileMetadata, bool) {
+	userID, ok := requestUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	metadata, err := dynamoClient.GetFileMetadata(r.Context(), fileID)
+	if err != nil {
+		writeNotFoundOr(w, err, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID), "Failed to load file")
+		return nil, false
+	}
+	if metadata.UserID != userID {
+		common.WriteNotFoundError(w, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID))
+		return nil, false
+	}
+	return metadata, true
+}
+
 // parseTime converts RFC3339 string to time.Time, with fallback to current time
 func parseTime(timeStr string) time.Time {
 	if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
@@ -370,16 +916,19 @@ func parseTime(timeStr string) time.Time {
 	return time.Now() // Fallback
 }
 
-// CompleteMultipartUploadHandler handles completion of multipart uploads
-func CompleteMultipartUploadHandler(s3Client *storage.S3Client, dynamoClient *storage.DynamoClient) http.HandlerFunc {
+// CompleteMultipartUploadHandler handles completion of multipart uploads. S3 checks any
+// declared checksum as it assembles the object, which is then verified and screened
+// against the executable policy; a mismatch marks the file corrupt. A completed file is
+// queued for a virus scan if scans are enabled. Its chunk records are summarized on the
+// file and, with a retention set, expire that long afterwards.
+func CompleteMultipartUploadHandler(s3Client ObjectStore, dynamoClient MetadataStore, executables quarantine.Policy, scans scan.Policy, chunkRetention time.Duration, uploadCallbacks *callbacks.Notifier, bus events.Publisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		fileID := vars["fileId"]
 
 		// Get file metadata to retrieve upload info
-		metadata, err := dynamoClient.GetFileMetadata(context.Background(), fileID)
-		if err != nil {
-			common.WriteNotFoundError(w, "File not found", fmt.Sprintf("File ID: %s does not exist", fileID))
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
 			return
 		}
 
@@ -388,19 +937,61 @@ func CompleteMultipartUploadHandler(s3Client *storage.S3Client, dynamoClient *st
 			common.WriteBadRequestError(w, "Not a multipart upload", "This file was not initiated as a multipart upload")
 			return
 		}
+		// S3 no longer has the upload, so completing it again would fail and mark the file failed
+		if metadata.Status == storage.FileStatusCompleted {
+			common.WriteConflictError(w, "Upload already completed", "The file is ready to download")
+			return
+		}
+		if metadata.Status == storage.FileStatusQuarantined {
+			writeQuarantinedError(w, metadata)
+			return
+		}
+		if metadata.Status == storage.FileStatusCorrupt {
+			writeCorruptError(w, metadata)
+			return
+		}
+
+		// Refuse to complete an upload whose key escapes the owner's prefix
+		if err := storage.ValidateObjectKey(metadata.UserID, metadata.S3Key); err != nil {
+			common.Logger(r.Context()).Warn("Rejected completion", "file_id", fileID, "error", err)
+			common.WriteForbiddenError(w, "Invalid upload key", "The upload's storage key does not belong to its owner")
+			return
+		}
 
 		// Check that all chunks are uploaded
-		complete, chunks, err := dynamoClient.CheckUploadComplete(context.Background(), fileID)
+		complete, chunks, err := dynamoClient.CheckUploadComplete(r.Context(), fileID)
 		if err != nil {
-			common.WriteDatabaseError(w, "Failed to check upload status", err.Error())
+			writeStorageError(w, "Failed to check upload status", err, common.WriteDatabaseError)
 			return
 		}
 
-		if !complete {
+		// Every chunk record must be there too, so a short read can't pass for a finished upload
+		if !complete || (metadata.TotalChunks != nil && len(chunks) != *metadata.TotalChunks) {
 			common.WriteBadRequestError(w, "Not all chunks are uploaded yet", "Some chunks are still missing or failed")
 			return
 		}
 
+		// A background upload's part URLs are single-use, so a part S3 no longer holds with
+		// its confirmed ETag was overwritten by a reused URL and must be uploaded again
+		if metadata.IsBackgroundUpload() {
+			s3Parts, err := s3Client.ListParts(r.Context(), &storage.MultipartUploadInfo{UploadID: *metadata.S3UploadID, Bucket: metadata.Bucket, Key: metadata.S3Key})
+			if err != nil {
+				writeStorageError(w, "Failed to check uploaded parts", err, common.WriteS3Error)
+				return
+			}
+			if overwritten := overwrittenChunks(chunks, s3Parts); len(overwritten) > 0 {
+				for _, chunkNumber := range overwritten {
+					if err := dynamoClient.UpdateChunkStatus(r.Context(), fileID, chunkNumber, "failed", ""); err != nil {
+						common.Logger(r.Context()).Warn("Failed to mark chunk as failed", "file_id", fileID, "chunk_number", chunkNumber, "error", err)
+					}
+				}
+				common.Logger(r.Context()).Warn("Rejected completion: chunks were overwritten through single-use URLs", "file_id", fileID, "chunks", overwritten)
+				common.WriteConflictError(w, "Chunks uploaded more than once",
+					fmt.Sprintf("Chunks %v changed after they were confirmed; upload them again with URLs from refresh-url", overwritten))
+				return
+			}
+		}
+
 		// Prepare parts for S3 completion
 		parts := make([]storage.CompletedPart, len(chunks))
 		for i, chunk := range chunks {
@@ -413,21 +1004,75 @@ func CompleteMultipartUploadHandler(s3Client *storage.S3Client, dynamoClient *st
 		// Complete the multipart upload in S3
 		uploadInfo := &storage.MultipartUploadInfo{
 			UploadID: *metadata.S3UploadID,
+			Bucket:   metadata.Bucket,
 			Key:      metadata.S3Key,
+			Checksum: storage.ChecksumOf(metadata),
 		}
 
-		if err := s3Client.CompleteMultipartUpload(context.Background(), uploadInfo, parts); err != nil {
-			log.Printf("Failed to complete multipart upload: %v", err)
-			common.WriteS3Error(w, "Failed to complete upload", err.Error())
+		err = s3Client.CompleteMultipartUpload(r.Context(), uploadInfo, parts)
+		if errors.Is(err, storage.ErrChecksumMismatch) {
+			// The parts can't be reassembled into the declared content, so discard them
+			if abortErr := s3Client.AbortMultipartUpload(r.Context(), uploadInfo); abortErr != nil {
+				common.Logger(r.Context()).Warn("Failed to abort corrupt upload", "file_id", fileID, "error", abortErr)
+			}
+			if markErr := markCorrupt(r.Context(), dynamoClient, metadata, "S3 rejected the assembled object: "+err.Error()); markErr != nil {
+				common.Logger(r.Context()).Warn("Failed to mark file corrupt", "file_id", fileID, "error", markErr)
+			}
+			writeCorruptError(w, metadata)
+			return
+		}
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to complete multipart upload", "file_id", fileID, "error", err)
+			// Record the failure so operators can find it; the client may still retry
+			metadata.Status = storage.FileStatusCompletionFailed
+			if saveErr := dynamoClient.SaveFileMetadata(r.Context(), metadata); saveErr != nil {
+				common.Logger(r.Context()).Warn("Failed to record completion failure", "file_id", fileID, "error", saveErr)
+			}
+			writeStorageError(w, "Failed to complete upload", err, common.WriteS3Error)
+			return
+		}
+
+		// S3 has assembled the object now, so a file that can't be verified or screened is
+		// held back rather than accepted unchecked
+		verified, err := verifyChecksum(r.Context(), s3Client, dynamoClient, metadata)
+		if err != nil {
+			if markErr := markCorrupt(r.Context(), dynamoClient, metadata, "could not be verified: "+err.Error()); markErr != nil {
+				common.Logger(r.Context()).Warn("Failed to mark file corrupt", "file_id", fileID, "error", markErr)
+			}
+		}
+		if !verified {
+			writeCorruptError(w, metadata)
+			return
+		}
+		reason, err := quarantine.Screen(r.Context(), s3Client, dynamoClient, executables, metadata)
+		if err != nil {
+			reason = "could not be screened: " + err.Error()
+			if qErr := quarantine.Quarantine(r.Context(), s3Client, dynamoClient, metadata, reason); qErr != nil {
+				common.Logger(r.Context()).Warn("Failed to quarantine unscreened file", "file_id", fileID, "error", qErr)
+			}
+		}
+		if reason != "" {
+			writeQuarantinedError(w, metadata)
 			return
 		}
 
 		// Update file metadata status to "completed"
-		metadata.Status = "completed"
+		metadata.Status = storage.FileStatusCompleted
 		metadata.CompletedAt = &[]string{time.Now().Format(time.RFC3339)}[0]
-		if err := dynamoClient.SaveFileMetadata(context.Background(), metadata); err != nil {
-			log.Printf("Warning: Failed to update file status: %v", err)
+		metadata.ChunkSummary = compaction.Summarize(chunks, time.Now())
+		if scans.Enabled() {
+			scan.Enqueue(metadata)
 		}
+		if err := dynamoClient.SaveFileMetadata(r.Context(), metadata); err != nil {
+			common.Logger(r.Context()).Warn("Failed to update file status", "file_id", fileID, "error", err)
+		} else if chunkRetention > 0 {
+			// The compaction job retries this if it fails
+			if err := compaction.ExpireRecords(r.Context(), dynamoClient, metadata, chunkRetention, time.Now()); err != nil {
+				common.Logger(r.Context()).Warn("Failed to expire chunk records", "file_id", fileID, "error", err)
+			}
+		}
+		uploadCallbacks.UploadCompleted(r.Context(), metadata)
+		publish(r.Context(), bus, events.FileUploaded(metadata))
 
 		responseData := map[string]interface{}{
 			"message":       "Multipart upload completed successfully",
@@ -440,8 +1085,9 @@ func CompleteMultipartUploadHandler(s3Client *storage.S3Client, dynamoClient *st
 	}
 }
 
-// ChunkCompletionHandler handles chunk upload completion notifications
-func ChunkCompletionHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc {
+// ChunkCompletionHandler handles chunk upload completion notifications. With verifyParts set,
+// a chunk reported as uploaded is only accepted if S3 holds the part with a matching ETag and size.
+func ChunkCompletionHandler(s3Client ObjectStore, dynamoClient MetadataStore, verifyParts bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		fileID := vars["fileId"]
@@ -454,6 +1100,11 @@ func ChunkCompletionHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc
 			return
 		}
 
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+
 		// Parse request body for ETag
 		var req struct {
 			ETag   string `json:"etag"`
@@ -470,20 +1121,83 @@ func ChunkCompletionHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc
 			return
 		}
 
+		// A background upload's part URLs are single-use, so a confirmed chunk can't be
+		// uploaded again with different content
+		if metadata.IsBackgroundUpload() && req.Status == "uploaded" {
+			chunks, err := dynamoClient.GetFileChunks(r.Context(), fileID)
+			if err != nil {
+				writeStorageError(w, "Failed to load chunk record", err, common.WriteDatabaseError)
+				return
+			}
+			if chunk := findChunk(chunks, chunkNumber); chunk != nil && chunk.Status == "uploaded" && normalizeETag(chunk.ETag) != normalizeETag(req.ETag) {
+				common.Logger(r.Context()).Warn("Rejected chunk: already uploaded", "file_id", fileID, "chunk_number", chunkNumber, "etag", chunk.ETag)
+				if err := dynamoClient.UpdateChunkStatus(r.Context(), fileID, chunkNumber, "failed", ""); err != nil {
+					common.Logger(r.Context()).Warn("Failed to mark chunk as failed", "file_id", fileID, "chunk_number", chunkNumber, "error", err)
+				}
+				common.WriteConflictError(w, "Chunk uploaded more than once",
+					fmt.Sprintf("Chunk %d was already uploaded with ETag %s; upload it again with a URL from refresh-url", chunkNumber, chunk.ETag))
+				return
+			}
+		}
+
+		// Catch clients that report success for a PUT that never reached S3
+		if verifyParts && req.Status == "uploaded" {
+			if metadata.S3UploadID == nil {
+				common.WriteBadRequestError(w, "Not a multipart upload", "This file was not initiated as a multipart upload")
+				return
+			}
+
+			chunks, err := dynamoClient.GetFileChunks(r.Context(), fileID)
+			if err != nil {
+				writeStorageError(w, "Failed to load chunk record", err, common.WriteDatabaseError)
+				return
+			}
+			chunk := findChunk(chunks, chunkNumber)
+			if chunk == nil {
+				common.WriteNotFoundError(w, "Chunk not found", fmt.Sprintf("File %s has no chunk %d", fileID, chunkNumber))
+				return
+			}
+
+			uploadInfo := &storage.MultipartUploadInfo{UploadID: *metadata.S3UploadID, Bucket: metadata.Bucket, Key: metadata.S3Key}
+			part, err := s3Client.GetPart(r.Context(), uploadInfo, chunk.S3PartNumber)
+			if err != nil {
+				writeStorageError(w, "Failed to verify chunk", err, common.WriteS3Error)
+				return
+			}
+			if problem := partMismatch(part, chunk.Size, req.ETag); problem != "" {
+				common.Logger(r.Context()).Warn("Rejected chunk", "file_id", fileID, "chunk_number", chunkNumber, "problem", problem)
+				if err := dynamoClient.UpdateChunkStatus(r.Context(), fileID, chunkNumber, "failed", ""); err != nil {
+					common.Logger(r.Context()).Warn("Failed to mark chunk as failed", "file_id", fileID, "chunk_number", chunkNumber, "error", err)
+				}
+				common.WriteConflictError(w, "Chunk not confirmed by storage", problem)
+				return
+			}
+		}
+
 		// Update chunk status
-		if err := dynamoClient.UpdateChunkStatus(context.Background(), fileID, chunkNumber, req.Status, req.ETag); err != nil {
-			log.Printf("Failed to update chunk status: %v", err)
-			common.WriteDatabaseError(w, "Failed to update chunk status", err.Error())
+		if err := dynamoClient.UpdateChunkStatus(r.Context(), fileID, chunkNumber, req.Status, req.ETag); err != nil {
+			common.Logger(r.Context()).Error("Failed to update chunk status", "file_id", fileID, "chunk_number", chunkNumber, "error", err)
+			writeStorageError(w, "Failed to update chunk status", err, common.WriteDatabaseError)
 			return
 		}
 
-		// Check if upload is complete
-		complete, chunks, err := dynamoClient.CheckUploadComplete(context.Background(), fileID)
+		// The uploaded-parts counter answers for every chunk but the last; only once it
+		// reaches the chunk count are all the chunk records read to confirm
+		updated, err := dynamoClient.GetFileMetadata(r.Context(), fileID)
 		if err != nil {
-			log.Printf("Failed to check upload completion: %v", err)
-			common.WriteDatabaseError(w, "Failed to check upload status", err.Error())
+			common.Logger(r.Context()).Error("Failed to check upload completion", "file_id", fileID, "error", err)
+			writeStorageError(w, "Failed to check upload status", err, common.WriteDatabaseError)
 			return
 		}
+		complete, chunks := false, []storage.FileChunk(nil)
+		if updated.AllPartsCounted() {
+			complete, chunks, err = dynamoClient.CheckUploadComplete(r.Context(), fileID)
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to check upload completion", "file_id", fileID, "error", err)
+				writeStorageError(w, "Failed to check upload status", err, common.WriteDatabaseError)
+				return
+			}
+		}
 
 		responseData := map[string]interface{}{
 			"chunk_number": chunkNumber,
@@ -499,4 +1213,281 @@ func ChunkCompletionHandler(dynamoClient *storage.DynamoClient) http.HandlerFunc
 
 		common.WriteOKResponse(w, responseData)
 	}
-}
\ No newline at end of file
+}
+
+// ChunkStatus is a chunk's upload state as recorded by the server
+type ChunkStatus struct {
+	ChunkNumber  int    `json:"chunk_number"`
+	Status       string `json:"status"` // "pending", "uploaded" or "failed"
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag,omitempty"`
+	UploadedAt   string `json:"uploaded_at,omitempty"`
+	URLExpiresAt string `json:"url_expires_at,omitempty"` // When the latest presigned URL for the chunk expires
+}
+
+// ChunkStatusList is every chunk of a multipart upload, in chunk order
+type ChunkStatusList struct {
+	FileID         string        `json:"file_id"`
+	Status         string        `json:"status"`
+	TotalChunks    int           `json:"total_chunks"`
+	UploadedChunks int           `json:"uploaded_chunks"`
+	Chunks         []ChunkStatus `json:"chunks"`
+	// Set once a completed upload's chunks are summarized; Chunks is empty after the records expire
+	Summary *ChunkSummary `json:"summary,omitempty"`
+}
+
+// ChunkSummary is what a completed upload keeps of its chunks once their records expire
+type ChunkSummary struct {
+	TotalSize       int64  `json:"total_size"`
+	FirstUploadedAt string `json:"first_uploaded_at,omitempty"`
+	LastUploadedAt  string `json:"last_uploaded_at,omitempty"`
+	RecordsExpireAt string `json:"records_expire_at,omitempty"`
+}
+
+// ListChunksHandler returns each chunk's status, size and ETag so a resuming client
+// can tell exactly which parts still need uploading
+func ListChunksHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+		if metadata.UploadType != "multipart" {
+			common.WriteBadRequestError(w, "Not a multipart upload", "Only multipart uploads have chunks")
+			return
+		}
+
+		chunks, err := sortedChunks(r.Context(), dynamoClient, fileID)
+		if err != nil {
+			writeStorageError(w, "Failed to load chunks", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.WriteOKResponse(w, chunkStatusList(metadata, chunks))
+	}
+}
+
+// UploadStatus is a multipart upload's progress, with fresh URLs for the chunks still to
+// be uploaded so a restarted client can resume without requesting a new upload
+type UploadStatus struct {
+	ChunkStatusList
+	TotalBytes     int64      `json:"total_bytes"`
+	BytesConfirmed int64      `json:"bytes_confirmed"` // Total size of the uploaded chunks
+	RemainingURLs  []ChunkURL `json:"remaining_urls"`  // Empty once the upload has completed
+}
+
+// UploadStatusHandler reports a multipart upload's chunks and issues new presigned URLs for
+// every chunk not yet uploaded, since those handed out at the start may have expired
+func UploadStatusHandler(s3Client ObjectStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+		if metadata.UploadType != "multipart" || metadata.S3UploadID == nil {
+			common.WriteBadRequestError(w, "Not a multipart upload", "Only multipart uploads can be resumed")
+			return
+		}
+
+		chunks, err := sortedChunks(r.Context(), dynamoClient, fileID)
+		if err != nil {
+			writeStorageError(w, "Failed to load chunks", err, common.WriteDatabaseError)
+			return
+		}
+
+		response := UploadStatus{
+			ChunkStatusList: chunkStatusList(metadata, chunks),
+			TotalBytes:      metadata.TotalSize,
+			RemainingURLs:   []ChunkURL{},
+		}
+		if len(chunks) == 0 && metadata.ChunkSummary != nil {
+			response.BytesConfirmed = metadata.ChunkSummary.TotalSize
+		}
+		for _, chunk := range chunks {
+			if chunk.Status == "uploaded" {
+				response.BytesConfirmed += chunk.Size
+				continue
+			}
+			if metadata.Status == storage.FileStatusCompleted {
+				continue
+			}
+
+			chunkURL, err := reissueChunkURL(r.Context(), s3Client, dynamoClient, metadata, chunk)
+			if err != nil {
+				writeStorageError(w, "Failed to generate chunk upload URL", err, common.WriteS3Error)
+				return
+			}
+			response.RemainingURLs = append(response.RemainingURLs, chunkURL)
+		}
+
+		common.WriteOKResponse(w, response)
+	}
+}
+
+// RefreshChunkURLHandler issues a new presigned URL for one chunk not yet uploaded, for when
+// the URL handed out earlier has expired partway through a long upload
+func RefreshChunkURLHandler(s3Client ObjectStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		fileID := vars["fileId"]
+		chunkNumberStr := vars["chunkNumber"]
+
+		chunkNumber, err := strconv.Atoi(chunkNumberStr)
+		if err != nil {
+			common.WriteBadRequestError(w, "Invalid chunk number", fmt.Sprintf("Chunk number '%s' is not a valid integer", chunkNumberStr))
+			return
+		}
+
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+		if metadata.UploadType != "multipart" || metadata.S3UploadID == nil {
+			common.WriteBadRequestError(w, "Not a multipart upload", "Only multipart upload chunks have part URLs")
+			return
+		}
+		if metadata.Status == storage.FileStatusCompleted || metadata.Status == storage.FileStatusQuarantined {
+			common.WriteConflictError(w, "Upload already completed", "A completed upload takes no more parts")
+			return
+		}
+
+		chunks, err := dynamoClient.GetFileChunks(r.Context(), fileID)
+		if err != nil {
+			writeStorageError(w, "Failed to load chunks", err, common.WriteDatabaseError)
+			return
+		}
+		chunk := findChunk(chunks, chunkNumber)
+		if chunk == nil {
+			common.WriteNotFoundError(w, "Chunk not found", fmt.Sprintf("Upload %s has no chunk %d", fileID, chunkNumber))
+			return
+		}
+		if chunk.Status == "uploaded" {
+			common.WriteConflictError(w, "Chunk already uploaded", fmt.Sprintf("Chunk %d needs no new URL", chunkNumber))
+			return
+		}
+
+		chunkURL, err := reissueChunkURL(r.Context(), s3Client, dynamoClient, metadata, *chunk)
+		if err != nil {
+			writeStorageError(w, "Failed to generate chunk upload URL", err, common.WriteS3Error)
+			return
+		}
+
+		common.WriteOKResponse(w, chunkURL)
+	}
+}
+
+// reissueChunkURL presigns a new part URL for a chunk of an in-progress upload, then audits
+// it and records its expiry on the chunk. Only signing failures are returned.
+func reissueChunkURL(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata, chunk storage.FileChunk) (ChunkURL, error) {
+	uploadInfo := &storage.MultipartUploadInfo{UploadID: *metadata.S3UploadID, Bucket: metadata.Bucket, Key: metadata.S3Key, URLExpiry: metadata.UploadURLExpiry()}
+	url, err := s3Client.GenerateMultipartUploadURL(ctx, uploadInfo, chunk.S3PartNumber)
+	if err != nil {
+		return ChunkURL{}, err
+	}
+	expiresAt := time.Now().Add(uploadInfo.URLExpiry)
+
+	auditIssuedURL(ctx, dynamoClient, common.ClientInfoFromContext(ctx), metadata.FileID, metadata.UserID, metadata.S3Key, storage.URLPurposeUploadPart, chunk.S3PartNumber, uploadInfo.URLExpiry)
+	if err := dynamoClient.RecordChunkURLExpiry(ctx, metadata.FileID, chunk.ChunkNumber, expiresAt); err != nil {
+		common.Logger(ctx).Warn("Failed to record URL expiry", "file_id", metadata.FileID, "chunk_number", chunk.ChunkNumber, "error", err)
+	}
+
+	return ChunkURL{
+		ChunkNumber: chunk.ChunkNumber,
+		URL:         url,
+		ExpiresAt:   expiresAt,
+		Size:        chunk.Size,
+	}, nil
+}
+
+// sortedChunks loads a multipart upload's chunk records in chunk order
+func sortedChunks(ctx context.Context, dynamoClient MetadataStore, fileID string) ([]storage.FileChunk, error) {
+	chunks, err := dynamoClient.GetFileChunks(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].ChunkNumber < chunks[j].ChunkNumber
+	})
+	return chunks, nil
+}
+
+// chunkStatusList converts chunk records, already in chunk order, to the response format.
+// Once a compacted upload's records have expired, its counts come from the summary.
+func chunkStatusList(metadata *storage.FileMetadata, chunks []storage.FileChunk) ChunkStatusList {
+	list := ChunkStatusList{
+		FileID:      metadata.FileID,
+		Status:      metadata.Status,
+		TotalChunks: len(chunks),
+		Chunks:      make([]ChunkStatus, len(chunks)),
+	}
+	if summary := metadata.ChunkSummary; summary != nil {
+		list.Summary = &ChunkSummary{
+			TotalSize:       summary.TotalSize,
+			FirstUploadedAt: summary.FirstUploadedAt,
+			LastUploadedAt:  summary.LastUploadedAt,
+			RecordsExpireAt: summary.RecordsExpireAt,
+		}
+		if len(chunks) == 0 {
+			list.TotalChunks = summary.Chunks
+			list.UploadedChunks = summary.Chunks
+			return list
+		}
+	}
+	for i, chunk := range chunks {
+		list.Chunks[i] = ChunkStatus{
+			ChunkNumber:  chunk.ChunkNumber,
+			Status:       chunk.Status,
+			Size:         chunk.Size,
+			ETag:         chunk.ETag,
+			UploadedAt:   chunk.UploadedAt,
+			URLExpiresAt: chunk.URLExpiresAt,
+		}
+		if chunk.Status == "uploaded" {
+			list.UploadedChunks++
+		}
+	}
+	return list
+}
+
+func findChunk(chunks []storage.FileChunk, chunkNumber int) *storage.FileChunk {
+	for i := range chunks {
+		if chunks[i].ChunkNumber == chunkNumber {
+			return &chunks[i]
+		}
+	}
+	return nil
+}
+
+// overwrittenChunks lists the uploaded chunks whose S3 part no longer has the confirmed ETag
+func overwrittenChunks(chunks []storage.FileChunk, parts []storage.UploadedPart) []int {
+	etags := make(map[int]string, len(parts))
+	for _, part := range parts {
+		etags[part.PartNumber] = normalizeETag(part.ETag)
+	}
+	var overwritten []int
+	for _, chunk := range chunks {
+		if etag, ok := etags[chunk.S3PartNumber]; ok && etag != normalizeETag(chunk.ETag) {
+			overwritten = append(overwritten, chunk.ChunkNumber)
+		}
+	}
+	sort.Ints(overwritten)
+	return overwritten
+}
+
+// partMismatch describes why an S3 part does not back a reported chunk, or returns "" if it does
+func partMismatch(part *storage.UploadedPart, wantSize int64, reportedETag string) string {
+	if part == nil {
+		return "S3 has no part for this chunk; upload it again"
+	}
+	if normalizeETag(part.ETag) != normalizeETag(reportedETag) {
+		return fmt.Sprintf("reported ETag %s does not match the part's ETag %s", reportedETag, part.ETag)
+	}
+	if part.Size != wantSize {
+		return fmt.Sprintf("part is %d bytes, expected %d", part.Size, wantSize)
+	}
+	return ""
+}
@@ -0,0 +1,1618 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/anomaly"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/fileservice/throttle"
+)
+
+// testQuota is a storage quota no test upload reaches
+const testQuota = int64(1 << 50)
+
+// testUser is the authenticated user requests are made as; it owns the test files
+const testUser = "user-1"
+
+// anyType resolves to a content type policy that accepts every upload
+func anyType() *ContentTypePolicies {
+	return NewContentTypePolicies(newFakeMetadataStore(), common.DefaultContentTypePolicy())
+}
+
+// asUser attaches an authenticated user to a request, as the auth middleware would
+func asUser(req *http.Request, userID string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, userID))
+}
+
+// serve runs a handler as testUser with the given mux vars and JSON body
+func serve(h http.Handler, method string, vars map[string]string, body string) *httptest.ResponseRecorder {
+	req := asUser(httptest.NewRequest(method, "/", strings.NewReader(body)), testUser)
+	req = mux.SetURLVars(req, vars)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) common.ErrorCode {
+	t.Helper()
+	var resp common.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding error response %q: %v", rec.Body.String(), err)
+	}
+	return resp.Error.Code
+}
+
+func singleFile() *storage.FileMetadata {
+	return &storage.FileMetadata{
+		FileID:     "file-1",
+		Filename:   "report.pdf",
+		TotalSize:  1024,
+		UploadType: "single",
+		Status:     storage.FileStatusCompleted,
+		UserID:     testUser,
+		S3Key:      storage.ObjectKey(testUser, "file-1", "report.pdf"),
+	}
+}
+
+func multipartFile() *storage.FileMetadata {
+	uploadID := "upload-1"
+	return &storage.FileMetadata{
+		FileID:     "file-2",
+		Filename:   "video.mp4",
+		UploadType: "multipart",
+		Status:     storage.FileStatusUploading,
+		UserID:     testUser,
+		S3Key:      storage.ObjectKey(testUser, "file-2", "video.mp4"),
+		S3UploadID: &uploadID,
+	}
+}
+
+func TestErrorPaths(t *testing.T) {
+	s3Failure := errors.New("s3 unavailable")
+
+	tests := []struct {
+		name     string
+		handler  func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler
+		s3       *fakeObjectStore
+		db       *fakeMetadataStore
+		vars     map[string]string
+		body     string
+		method   string
+		wantCode int
+		wantErr  common.ErrorCode
+	}{
+		{
+			name: "upload url with S3 failure",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+			},
+			s3: &fakeObjectStore{generateUploadURL: func(context.Context, string, string, storage.UploadOptions) (string, string, error) {
+				return "", "", s3Failure
+			}},
+			db:       newFakeMetadataStore(),
+			body:     `{"filename": "report.pdf", "size": 1024}`,
+			method:   http.MethodPost,
+			wantCode: http.StatusInternalServerError,
+			wantErr:  common.ErrorCodeS3Error,
+		},
+		{
+			name: "upload url with S3 throttling",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+			},
+			s3: &fakeObjectStore{generateUploadURL: func(context.Context, string, string, storage.UploadOptions) (string, string, error) {
+				return "", "", fmt.Errorf("%w: slow down", storage.ErrThrottled)
+			}},
+			db:       newFakeMetadataStore(),
+			body:     `{"filename": "report.pdf", "size": 1024}`,
+			method:   http.MethodPost,
+			wantCode: http.StatusServiceUnavailable,
+			wantErr:  common.ErrorCodeServiceUnavailable,
+		},
+		{
+			name: "upload url over storage quota",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				db.usage[testUser] = 1000
+				return GenerateUploadURLHandler(s3, db, UploadHints{}, 1500, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+			},
+			s3:       &fakeObjectStore{},
+			db:       newFakeMetadataStore(),
+			body:     `{"filename": "report.pdf", "size": 1024}`,
+			method:   http.MethodPost,
+			wantCode: http.StatusForbidden,
+			wantErr:  common.ErrorCodeQuotaExceeded,
+		},
+		{
+			name: "upload url with malformed body",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+			},
+			s3:       &fakeObjectStore{},
+			db:       newFakeMetadataStore(),
+			body:     `{"filename":`,
+			method:   http.MethodPost,
+			wantCode: http.StatusBadRequest,
+			wantErr:  common.ErrorCodeBadRequest,
+		},
+		{
+			name: "metadata for missing file",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return GetFileMetadataHandler(db)
+			},
+			db:       newFakeMetadataStore(),
+			vars:     map[string]string{"id": "missing"},
+			method:   http.MethodGet,
+			wantCode: http.StatusNotFound,
+			wantErr:  common.ErrorCodeNotFound,
+		},
+		{
+			name: "metadata with database failure",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				db.err = errors.New("connection reset")
+				return GetFileMetadataHandler(db)
+			},
+			db:       newFakeMetadataStore(),
+			vars:     map[string]string{"id": "missing"},
+			method:   http.MethodGet,
+			wantCode: http.StatusInternalServerError,
+			wantErr:  common.ErrorCodeDatabaseError,
+		},
+		{
+			name: "metadata with database timeout",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				db.err = fmt.Errorf("%w: context deadline exceeded", storage.ErrTimeout)
+				return GetFileMetadataHandler(db)
+			},
+			db:       newFakeMetadataStore(),
+			vars:     map[string]string{"id": "file-1"},
+			method:   http.MethodGet,
+			wantCode: http.StatusServiceUnavailable,
+			wantErr:  common.ErrorCodeServiceUnavailable,
+		},
+		{
+			name: "download url for missing file",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, nil, storage.PresignedURLExpiry)
+			},
+			s3:       &fakeObjectStore{},
+			db:       newFakeMetadataStore(),
+			vars:     map[string]string{"id": "missing"},
+			method:   http.MethodGet,
+			wantCode: http.StatusNotFound,
+			wantErr:  common.ErrorCodeNotFound,
+		},
+		{
+			name: "download url with S3 failure",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, nil, storage.PresignedURLExpiry)
+			},
+			s3: &fakeObjectStore{generateDownloadURL: func(context.Context, string, string, storage.DownloadOptions) (string, error) {
+				return "", s3Failure
+			}},
+			db:       newFakeMetadataStore(singleFile()),
+			vars:     map[string]string{"id": "file-1"},
+			method:   http.MethodGet,
+			wantCode: http.StatusInternalServerError,
+			wantErr:  common.ErrorCodeS3Error,
+		},
+		{
+			name: "list files with database failure",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return ListFilesHandler(db)
+			},
+			db:       &fakeMetadataStore{err: errors.New("dynamo unavailable")},
+			method:   http.MethodGet,
+			wantCode: http.StatusInternalServerError,
+			wantErr:  common.ErrorCodeDatabaseError,
+		},
+		{
+			name: "delete with S3 failure",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return DeleteFileHandler(s3, db, nil)
+			},
+			s3: &fakeObjectStore{deleteObject: func(context.Context, string, string) error {
+				return s3Failure
+			}},
+			db:       newFakeMetadataStore(singleFile()),
+			vars:     map[string]string{"id": "file-1"},
+			method:   http.MethodDelete,
+			wantCode: http.StatusInternalServerError,
+			wantErr:  common.ErrorCodeS3Error,
+		},
+		{
+			name: "chunk completion with non-numeric chunk number",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return ChunkCompletionHandler(s3, db, false)
+			},
+			db:       newFakeMetadataStore(multipartFile()),
+			vars:     map[string]string{"fileId": "file-2", "chunkNumber": "abc"},
+			body:     `{"etag": "\"abc\"", "status": "uploaded"}`,
+			method:   http.MethodPost,
+			wantCode: http.StatusBadRequest,
+			wantErr:  common.ErrorCodeBadRequest,
+		},
+		{
+			name: "chunk completion with invalid status",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return ChunkCompletionHandler(s3, db, false)
+			},
+			db:       newFakeMetadataStore(multipartFile()),
+			vars:     map[string]string{"fileId": "file-2", "chunkNumber": "1"},
+			body:     `{"etag": "\"abc\"", "status": "done"}`,
+			method:   http.MethodPost,
+			wantCode: http.StatusBadRequest,
+			wantErr:  common.ErrorCodeValidation,
+		},
+		{
+			name: "chunk completion for unknown chunk",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return ChunkCompletionHandler(s3, db, false)
+			},
+			db:       newFakeMetadataStore(multipartFile()),
+			vars:     map[string]string{"fileId": "file-2", "chunkNumber": "7"},
+			body:     `{"etag": "\"abc\"", "status": "uploaded"}`,
+			method:   http.MethodPost,
+			wantCode: http.StatusNotFound,
+			wantErr:  common.ErrorCodeNotFound,
+		},
+		{
+			name: "list chunks for single upload",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return ListChunksHandler(db)
+			},
+			db:       newFakeMetadataStore(singleFile()),
+			vars:     map[string]string{"fileId": "file-1"},
+			method:   http.MethodGet,
+			wantCode: http.StatusBadRequest,
+			wantErr:  common.ErrorCodeBadRequest,
+		},
+		{
+			name: "complete upload for single upload",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 0, nil, nil)
+			},
+			s3:       &fakeObjectStore{},
+			db:       newFakeMetadataStore(singleFile()),
+			vars:     map[string]string{"fileId": "file-1"},
+			method:   http.MethodPost,
+			wantCode: http.StatusBadRequest,
+			wantErr:  common.ErrorCodeBadRequest,
+		},
+		{
+			name: "complete upload with chunks outstanding",
+			handler: func(s3 *fakeObjectStore, db *fakeMetadataStore) http.Handler {
+				return CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 0, nil, nil)
+			},
+			s3: &fakeObjectStore{},
+			db: func() *fakeMetadataStore {
+				db := newFakeMetadataStore(multipartFile())
+				db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, Status: "pending"}}
+				return db
+			}(),
+			vars:     map[string]string{"fileId": "file-2"},
+			method:   http.MethodPost,
+			wantCode: http.StatusBadRequest,
+			wantErr:  common.ErrorCodeBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.handler(tt.s3, tt.db), tt.method, tt.vars, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if got := errorCode(t, rec); got != tt.wantErr {
+				t.Errorf("error code = %s, want %s", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompleteMultipartUploadRecordsS3Failure(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"abc"`, Status: "uploaded"}}
+	s3 := &fakeObjectStore{completeMultipartUpload: func(context.Context, *storage.MultipartUploadInfo, []storage.CompletedPart) error {
+		return errors.New("InternalError")
+	}}
+
+	rec := serve(CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 0, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if status := db.files["file-2"].Status; status != storage.FileStatusCompletionFailed {
+		t.Errorf("file status = %q, want %q", status, storage.FileStatusCompletionFailed)
+	}
+}
+
+func TestCompleteMultipartUploadTwice(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"abc"`, Status: "uploaded"}}
+	completed := false
+	s3 := &fakeObjectStore{completeMultipartUpload: func(context.Context, *storage.MultipartUploadInfo, []storage.CompletedPart) error {
+		if completed {
+			return errors.New("NoSuchUpload")
+		}
+		completed = true
+		return nil
+	}}
+	handler := CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 0, nil, nil)
+
+	if rec := serve(handler, http.MethodPost, map[string]string{"fileId": "file-2"}, ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	rec := serve(handler, http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("second completion status = %d, want 409 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if status := db.files["file-2"].Status; status != storage.FileStatusCompleted {
+		t.Errorf("file status = %q after a second completion, want %q", status, storage.FileStatusCompleted)
+	}
+}
+
+func TestCompletedUploadChunksAreCompacted(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{
+		{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"abc"`, Status: "uploaded", Size: 6, UploadedAt: "2025-06-01T12:00:00Z"},
+		{FileID: "file-2", ChunkNumber: 2, S3PartNumber: 2, ETag: `"def"`, Status: "uploaded", Size: 4, UploadedAt: "2025-06-01T12:05:00Z"},
+	}
+	s3 := &fakeObjectStore{completeMultipartUpload: func(context.Context, *storage.MultipartUploadInfo, []storage.CompletedPart) error { return nil }}
+
+	rec := serve(CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 24*time.Hour, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	summary := db.files["file-2"].ChunkSummary
+	if summary == nil || summary.Chunks != 2 || summary.TotalSize != 10 || summary.LastUploadedAt != "2025-06-01T12:05:00Z" || summary.RecordsExpireAt == "" {
+		t.Fatalf("chunk summary = %+v, want both chunks summarized with the records' expiry", summary)
+	}
+	for _, chunk := range db.chunks["file-2"] {
+		if chunk.ExpiresAt == 0 {
+			t.Errorf("chunk %d has no expiry", chunk.ChunkNumber)
+		}
+	}
+
+	// Once the records have expired, the chunk list is reported from the summary
+	delete(db.chunks, "file-2")
+	rec = serve(ListChunksHandler(db), http.MethodGet, map[string]string{"fileId": "file-2"}, "")
+	var resp struct {
+		Data ChunkStatusList `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.TotalChunks != 2 || resp.Data.UploadedChunks != 2 || resp.Data.Summary == nil || resp.Data.Summary.TotalSize != 10 {
+		t.Errorf("chunk list = %+v, want the summarized counts", resp.Data)
+	}
+}
+
+func TestCompletedExecutableIsQuarantined(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"abc"`, Status: "uploaded"}}
+	originalKey := db.files["file-2"].S3Key
+	var copiedTo, deleted string
+	s3 := &fakeObjectStore{
+		completeMultipartUpload: func(context.Context, *storage.MultipartUploadInfo, []storage.CompletedPart) error { return nil },
+		// A Windows executable renamed to look like a video
+		readObjectHeader: func(context.Context, string, string, int64) ([]byte, error) { return []byte("MZ\x90\x00"), nil },
+		copyObject: func(_ context.Context, _, _, dstKey string, _ int64) error {
+			copiedTo = dstKey
+			return nil
+		},
+		deleteObject: func(_ context.Context, _, s3Key string) error {
+			deleted = s3Key
+			return nil
+		},
+		generateDownloadURL: func(context.Context, string, string, storage.DownloadOptions) (string, error) {
+			return "https://s3.test/get", nil
+		},
+	}
+	executables := quarantine.NewPolicy(true, nil)
+
+	rec := serve(CompleteMultipartUploadHandler(s3, db, executables, scan.Policy{}, 0, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != common.ErrorCodeFileQuarantined {
+		t.Fatalf("status = %d, want 403 FILE_QUARANTINED (body: %s)", rec.Code, rec.Body.String())
+	}
+	file := db.files["file-2"]
+	if file.Status != storage.FileStatusQuarantined || file.QuarantineReason == nil {
+		t.Fatalf("file status = %q, want quarantined with a reason", file.Status)
+	}
+	if copiedTo != storage.QuarantineKey(originalKey) || deleted != originalKey || file.S3Key != copiedTo {
+		t.Errorf("object moved from %s to %s (deleted %s), metadata key %s", originalKey, copiedTo, deleted, file.S3Key)
+	}
+
+	rec = serve(GenerateDownloadURLHandler(s3, db, executables, scan.Policy{}, nil, storage.PresignedURLExpiry), http.MethodGet, map[string]string{"id": "file-2"}, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("download url for quarantined file: status = %d, want 403", rec.Code)
+	}
+
+	rec = serve(ReleaseQuarantinedFileHandler(s3, db), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("release: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if file := db.files["file-2"]; file.Status != storage.FileStatusCompleted || file.S3Key != originalKey {
+		t.Errorf("released file = status %q key %s, want completed at %s", file.Status, file.S3Key, originalKey)
+	}
+}
+
+func TestSingleUploadIsScreenedOnFirstDownload(t *testing.T) {
+	file := singleFile()
+	file.Filename = "install.sh"
+	file.Status = storage.FileStatusUploading
+	db := newFakeMetadataStore(file)
+	s3 := &fakeObjectStore{
+		readObjectHeader: func(context.Context, string, string, int64) ([]byte, error) { return nil, storage.ErrObjectNotFound },
+		copyObject:       func(context.Context, string, string, string, int64) error { return nil },
+		deleteObject:     func(context.Context, string, string) error { return nil },
+	}
+	executables := quarantine.NewPolicy(true, nil)
+
+	rec := serve(GenerateDownloadURLHandler(s3, db, executables, scan.Policy{}, nil, storage.PresignedURLExpiry), http.MethodGet, map[string]string{"id": "file-1"}, "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("before the object exists: status = %d, want 409", rec.Code)
+	}
+
+	s3.readObjectHeader = func(context.Context, string, string, int64) ([]byte, error) { return []byte("echo hi\n"), nil }
+	rec = serve(GenerateDownloadURLHandler(s3, db, executables, scan.Policy{}, nil, storage.PresignedURLExpiry), http.MethodGet, map[string]string{"id": "file-1"}, "")
+	if rec.Code != http.StatusForbidden || db.files["file-1"].Status != storage.FileStatusQuarantined {
+		t.Errorf("blocked extension: status = %d and file %q, want 403 and quarantined", rec.Code, db.files["file-1"].Status)
+	}
+}
+
+func TestUploadChecksum(t *testing.T) {
+	const sha = "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=" // SHA-256 of "test"
+	var signed storage.Checksum
+	s3 := &fakeObjectStore{
+		generateUploadURL: func(_ context.Context, _, _ string, opts storage.UploadOptions) (string, string, error) {
+			signed = opts.Checksum
+			return "https://upload", "file-3", nil
+		},
+		generateDownloadURL: func(context.Context, string, string, storage.DownloadOptions) (string, error) {
+			return "https://download", nil
+		},
+	}
+	db := newFakeMetadataStore()
+	h := GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+
+	invalid := map[string]string{
+		"unknown algorithm":   `{"filename": "a.txt", "size": 4, "checksum_algorithm": "md5", "checksum": "` + sha + `"}`,
+		"missing value":       `{"filename": "a.txt", "size": 4, "checksum_algorithm": "sha256"}`,
+		"wrong length":        `{"filename": "a.txt", "size": 4, "checksum_algorithm": "crc32c", "checksum": "` + sha + `"}`,
+		"sha256 on multipart": `{"filename": "a.mp4", "size": 6000000000, "checksum_algorithm": "sha256", "checksum": "` + sha + `"}`,
+	}
+	for name, body := range invalid {
+		if rec := serve(h, http.MethodPost, nil, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+
+	rec := serve(h, http.MethodPost, nil, `{"filename": "a.txt", "size": 4, "checksum_algorithm": "sha256", "checksum": "`+sha+`"}`)
+	var resp struct {
+		Data PresignedURLResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if signed.Value != sha || resp.Data.UploadHeaders["x-amz-checksum-sha256"] != sha {
+		t.Fatalf("signed %+v, upload headers %v, want the sha256 checksum in both", signed, resp.Data.UploadHeaders)
+	}
+	if saved := db.files["file-3"]; saved.ChecksumAlgorithm != storage.ChecksumSHA256 || saved.Checksum != sha {
+		t.Errorf("saved checksum %s %q, want sha256 %q", saved.ChecksumAlgorithm, saved.Checksum, sha)
+	}
+
+	// The first download compares the checksum S3 reports
+	s3.objectChecksum = func(context.Context, string, string, string) (string, error) { return "AAAA", nil }
+	rec = serve(GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, nil, storage.PresignedURLExpiry), http.MethodGet, map[string]string{"id": "file-3"}, "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != common.ErrorCodeFileCorrupt {
+		t.Fatalf("mismatch: status = %d, want 409 FILE_CORRUPT (body: %s)", rec.Code, rec.Body.String())
+	}
+	if file := db.files["file-3"]; file.Status != storage.FileStatusCorrupt || file.CorruptReason == nil {
+		t.Errorf("file status = %q, want corrupt with a reason", file.Status)
+	}
+}
+
+func TestCompleteMultipartChecksumMismatch(t *testing.T) {
+	file := multipartFile()
+	file.ChecksumAlgorithm, file.Checksum = storage.ChecksumCRC32C, "AAAAAA=="
+	db := newFakeMetadataStore(file)
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"abc"`, Status: "uploaded"}}
+	aborted := false
+	s3 := &fakeObjectStore{
+		completeMultipartUpload: func(_ context.Context, info *storage.MultipartUploadInfo, _ []storage.CompletedPart) error {
+			if info.Checksum.Value != "AAAAAA==" {
+				t.Errorf("completed with checksum %+v, want the declared crc32c", info.Checksum)
+			}
+			return fmt.Errorf("failed to complete multipart upload: %w", storage.ErrChecksumMismatch)
+		},
+		abortMultipartUpload: func(context.Context, *storage.MultipartUploadInfo) error {
+			aborted = true
+			return nil
+		},
+	}
+
+	rec := serve(CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 0, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != common.ErrorCodeFileCorrupt {
+		t.Fatalf("status = %d, want 409 FILE_CORRUPT (body: %s)", rec.Code, rec.Body.String())
+	}
+	if !aborted || db.files["file-2"].Status != storage.FileStatusCorrupt {
+		t.Errorf("aborted %v, file status %q, want the upload aborted and the file corrupt", aborted, db.files["file-2"].Status)
+	}
+}
+
+func TestDownloadURLsAreThrottledPerFile(t *testing.T) {
+	db := newFakeMetadataStore(singleFile())
+	s3 := &fakeObjectStore{generateDownloadURL: func(context.Context, string, string, storage.DownloadOptions) (string, error) {
+		return "https://download", nil
+	}}
+	h := GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, throttle.NewLimiter(1, time.Minute), storage.PresignedURLExpiry)
+	vars := map[string]string{"id": "file-1"}
+
+	// Requests from other users are refused before they count against the file
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, mux.SetURLVars(asUser(httptest.NewRequest(http.MethodGet, "/", nil), "user-2"), vars))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("other user: status = %d, want 404", rec.Code)
+	}
+
+	if rec := serve(h, http.MethodGet, vars, ""); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	rec = serve(h, http.MethodGet, vars, "")
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != common.ErrorCodeTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429 TOO_MANY_REQUESTS", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+}
+
+func TestDownloadURLOptions(t *testing.T) {
+	metadata := singleFile()
+	metadata.ContentType = "application/pdf"
+	db := newFakeMetadataStore(metadata)
+	var signed storage.DownloadOptions
+	s3 := &fakeObjectStore{generateDownloadURL: func(_ context.Context, _, _ string, opts storage.DownloadOptions) (string, error) {
+		signed = opts
+		return "https://download", nil
+	}}
+	h := GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, nil, time.Hour)
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     storage.DownloadOptions
+	}{
+		{"", http.StatusOK, storage.DownloadOptions{URLExpiry: storage.PresignedURLExpiry}},
+		{"expires_in=3600", http.StatusOK, storage.DownloadOptions{URLExpiry: time.Hour}},
+		{"expires_in=3601", http.StatusBadRequest, storage.DownloadOptions{}},
+		{"expires_in=0", http.StatusBadRequest, storage.DownloadOptions{}},
+		{"download=inline", http.StatusOK, storage.DownloadOptions{URLExpiry: storage.PresignedURLExpiry, ContentDisposition: "inline; filename=report.pdf", ContentType: "application/pdf"}},
+		{"filename=Q3+r%C3%A9sum%C3%A9.pdf", http.StatusOK, storage.DownloadOptions{URLExpiry: storage.PresignedURLExpiry, ContentDisposition: "attachment; filename*=utf-8''Q3%20r%C3%A9sum%C3%A9.pdf", ContentType: "application/pdf"}},
+		{"download=save", http.StatusBadRequest, storage.DownloadOptions{}},
+		{"filename=..%2Fpasswd", http.StatusBadRequest, storage.DownloadOptions{}},
+	}
+	for _, tt := range tests {
+		signed = storage.DownloadOptions{}
+		req := asUser(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil), testUser)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, mux.SetURLVars(req, map[string]string{"id": "file-1"}))
+		if rec.Code != tt.wantCode || signed != tt.want {
+			t.Errorf("%q: status %d, signed with %+v; want %d and %+v", tt.query, rec.Code, signed, tt.wantCode, tt.want)
+		}
+	}
+}
+
+func TestVirusScanGatesDownloads(t *testing.T) {
+	scans := scan.NewPolicy(true, true, time.Minute)
+	db := newFakeMetadataStore(multipartFile(), singleFile())
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"abc"`, Status: "uploaded"}}
+	s3 := &fakeObjectStore{
+		completeMultipartUpload: func(context.Context, *storage.MultipartUploadInfo, []storage.CompletedPart) error { return nil },
+		generateDownloadURL: func(context.Context, string, string, storage.DownloadOptions) (string, error) {
+			return "https://download", nil
+		},
+	}
+	download := GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scans, nil, storage.PresignedURLExpiry)
+
+	// Completion queues the file, and it can't be downloaded until the scan is done
+	if rec := serve(CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scans, 0, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, ""); rec.Code != http.StatusOK {
+		t.Fatalf("completion: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if status := db.files["file-2"].ScanStatus; status != storage.ScanStatusPending {
+		t.Fatalf("scan status = %q, want pending", status)
+	}
+	rec := serve(download, http.MethodGet, map[string]string{"id": "file-2"}, "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != common.ErrorCodeScanPending || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("pending: status = %d, Retry-After %q, want 409 SCAN_PENDING after 60s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	db.files["file-2"].ScanStatus, db.files["file-2"].ScanSignature = storage.ScanStatusInfected, "EICAR"
+	if rec := serve(download, http.MethodGet, map[string]string{"id": "file-2"}, ""); rec.Code != http.StatusForbidden || errorCode(t, rec) != common.ErrorCodeFileInfected {
+		t.Errorf("infected: status = %d, want 403 FILE_INFECTED", rec.Code)
+	}
+	db.files["file-2"].ScanStatus = storage.ScanStatusClean
+	if rec := serve(download, http.MethodGet, map[string]string{"id": "file-2"}, ""); rec.Code != http.StatusOK {
+		t.Errorf("clean: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	// A file stored before scanning was enabled is queued on its first download
+	if rec := serve(download, http.MethodGet, map[string]string{"id": "file-1"}, ""); rec.Code != http.StatusConflict {
+		t.Errorf("unscanned file: status = %d, want 409", rec.Code)
+	}
+	if status := db.files["file-1"].ScanStatus; status != storage.ScanStatusPending {
+		t.Errorf("unscanned file scan status = %q, want pending", status)
+	}
+}
+
+func TestDeleteKeepsMetadataWhenS3Fails(t *testing.T) {
+	db := newFakeMetadataStore(singleFile())
+	s3 := &fakeObjectStore{deleteObject: func(context.Context, string, string) error {
+		return errors.New("AccessDenied")
+	}}
+
+	serve(DeleteFileHandler(s3, db, nil), http.MethodDelete, map[string]string{"id": "file-1"}, "")
+	if _, ok := db.files["file-1"]; !ok {
+		t.Error("metadata was deleted even though the S3 object was not")
+	}
+}
+
+func TestDeleteReleasesStorageQuota(t *testing.T) {
+	db := newFakeMetadataStore(singleFile())
+	db.usage[testUser] = 5000
+	s3 := &fakeObjectStore{deleteObject: func(context.Context, string, string) error { return nil }}
+
+	serve(DeleteFileHandler(s3, db, nil), http.MethodDelete, map[string]string{"id": "file-1"}, "")
+	if used := db.usage[testUser]; used != 5000-1024 {
+		t.Errorf("usage after delete = %d, want %d", used, 5000-1024)
+	}
+}
+
+func TestOtherUsersFilesAreNotFound(t *testing.T) {
+	db := newFakeMetadataStore(singleFile())
+	s3 := &fakeObjectStore{deleteObject: func(context.Context, string, string) error {
+		t.Error("deleted another user's object")
+		return nil
+	}}
+	vars := map[string]string{"id": "file-1"}
+
+	for name, h := range map[string]http.Handler{
+		"metadata":     GetFileMetadataHandler(db),
+		"download url": GenerateDownloadURLHandler(s3, db, quarantine.Policy{}, scan.Policy{}, nil, storage.PresignedURLExpiry),
+		"delete":       DeleteFileHandler(s3, db, nil),
+	} {
+		req := asUser(httptest.NewRequest(http.MethodGet, "/", nil), "user-2")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, mux.SetURLVars(req, vars))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", name, rec.Code)
+		}
+	}
+	if db.files["file-1"] == nil {
+		t.Error("another user deleted the file's metadata")
+	}
+}
+
+func TestBatchDeleteReportsEachFile(t *testing.T) {
+	failing := multipartFile()
+	failing.TotalSize = 2048
+	others := &storage.FileMetadata{FileID: "file-3", UserID: "user-2", S3Key: storage.ObjectKey("user-2", "file-3", "notes.txt")}
+	db := newFakeMetadataStore(singleFile(), failing, others)
+	db.usage[testUser] = 5000
+	s3 := &fakeObjectStore{deleteObjects: func(_ context.Context, _ string, s3Keys []string) map[string]error {
+		failed := make(map[string]error)
+		for _, s3Key := range s3Keys {
+			switch s3Key {
+			case others.S3Key:
+				t.Error("deleted another user's object")
+			case failing.S3Key:
+				failed[s3Key] = errors.New("InternalError")
+			}
+		}
+		return failed
+	}}
+
+	bus := make(fakePublisher, 4)
+	rec := serve(BatchDeleteFilesHandler(s3, db, bus, nil), http.MethodPost, nil,
+		`{"file_ids": ["file-1", "file-2", "file-3", "missing", "file-1"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data BatchDeleteResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{batchDeleted, batchFailed, batchNotFound, batchNotFound}
+	if len(resp.Data.Results) != len(want) {
+		t.Fatalf("results %+v, want one per distinct file", resp.Data.Results)
+	}
+	for i, result := range resp.Data.Results {
+		if result.Status != want[i] || (result.Status == batchFailed) != (result.Error != "") {
+			t.Errorf("%s: status %q error %q, want %s", result.FileID, result.Status, result.Error, want[i])
+		}
+	}
+	if resp.Data.Deleted != 1 || resp.Data.Failed != 1 || resp.Data.NotFound != 2 {
+		t.Errorf("counts %d deleted, %d failed, %d not found", resp.Data.Deleted, resp.Data.Failed, resp.Data.NotFound)
+	}
+
+	if db.files["file-1"] != nil || db.files["file-2"] == nil || db.files["file-3"] == nil {
+		t.Error("only file-1's metadata should be deleted")
+	}
+	if used := db.usage[testUser]; used != 5000-1024 {
+		t.Errorf("usage after batch delete = %d, want %d", used, 5000-1024)
+	}
+	if event := bus.next(t); event.Type != events.TypeFileDeleted || event.File.FileID != "file-1" || event.UserID != testUser {
+		t.Errorf("published %+v, want file-1 deleted", event)
+	}
+	select {
+	case event := <-bus:
+		t.Errorf("published %s for %s, want only the deleted file", event.Type, event.File.FileID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBatchDeleteLimitsFiles(t *testing.T) {
+	ids := make([]string, maxBatchDelete+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("file-%d", i)
+	}
+	body, _ := json.Marshal(BatchDeleteRequest{FileIDs: ids})
+
+	for name, body := range map[string]string{"none": `{"file_ids": []}`, "too many": string(body)} {
+		rec := serve(BatchDeleteFilesHandler(&fakeObjectStore{}, newFakeMetadataStore(), nil, nil), http.MethodPost, nil, body)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != common.ErrorCodeValidation {
+			t.Errorf("%s: status = %d, want a validation error", name, rec.Code)
+		}
+	}
+}
+
+func TestBatchDeleteCountsEachFileAsADelete(t *testing.T) {
+	ids := make([]string, 101)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("file-%d", i)
+	}
+	body, _ := json.Marshal(BatchDeleteRequest{FileIDs: ids})
+	s3 := &fakeObjectStore{deleteObjects: func(context.Context, string, []string) map[string]error {
+		t.Error("deleted objects in a batch that tripped the detector")
+		return nil
+	}}
+	detector := anomaly.NewDetector(time.Hour, anomaly.Rule{Action: anomaly.ActionDelete, Limit: 100, Window: time.Hour})
+
+	rec := serve(BatchDeleteFilesHandler(s3, newFakeMetadataStore(singleFile()), nil, detector), http.MethodPost, nil, string(body))
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != common.ErrorCodeReauthenticationRequired {
+		t.Fatalf("status = %d, want 403 for a 101-file batch over a limit of 100: %s", rec.Code, rec.Body)
+	}
+	if _, locked := detector.Check(testUser); !locked {
+		t.Error("account not locked after the batch")
+	}
+}
+
+func TestAbortMultipartUploadCleansUp(t *testing.T) {
+	file := multipartFile()
+	file.TotalSize = 2048
+	db := newFakeMetadataStore(file)
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, Status: "uploaded"}}
+	db.usage[testUser] = 2048
+
+	var abortedID string
+	s3 := &fakeObjectStore{abortMultipartUpload: func(_ context.Context, info *storage.MultipartUploadInfo) error {
+		abortedID = info.UploadID
+		return nil
+	}}
+
+	rec := serve(AbortMultipartUploadHandler(s3, db, nil), http.MethodDelete, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if abortedID != "upload-1" {
+		t.Errorf("aborted upload %q, want upload-1", abortedID)
+	}
+	if _, ok := db.files["file-2"]; ok {
+		t.Error("metadata survived the abort")
+	}
+	if len(db.chunks["file-2"]) != 0 {
+		t.Error("chunk records survived the abort")
+	}
+	if used := db.usage[testUser]; used != 0 {
+		t.Errorf("usage after abort = %d, want 0", used)
+	}
+}
+
+func TestMultipartUploadIncludesHints(t *testing.T) {
+	s3 := &fakeObjectStore{
+		initiateMultipartUpload: func(_ context.Context, userID, filename string, _ storage.UploadOptions) (*storage.MultipartUploadInfo, error) {
+			return &storage.MultipartUploadInfo{UploadID: "upload-1", Key: storage.ObjectKey(userID, "file-3", filename), FileID: "file-3"}, nil
+		},
+		generateMultipartUploadURL: func(_ context.Context, _ *storage.MultipartUploadInfo, partNumber int) (string, error) {
+			return "https://s3.example/part", nil
+		},
+	}
+	hints := NewUploadHints(8, 3, 250*time.Millisecond, 10*time.Second)
+
+	rec := serve(GenerateUploadURLHandler(s3, newFakeMetadataStore(), hints, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil), http.MethodPost, nil,
+		`{"filename": "disk.img", "size": 10737418240}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data PresignedURLResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data.Hints
+	if got == nil {
+		t.Fatal("multipart response has no hints")
+	}
+	if got.ChunkSize != multipartChunkSize || got.MaxParallelParts != 8 || got.Retry.MaxAttempts != 3 ||
+		got.Retry.InitialBackoffMillis != 250 || got.URLTTLSeconds != int64(storage.PresignedURLExpiry/time.Second) {
+		t.Errorf("hints = %+v", got)
+	}
+}
+
+func TestUploadRecordsClientInfo(t *testing.T) {
+	s3 := &fakeObjectStore{
+		generateUploadURL: func(context.Context, string, string, storage.UploadOptions) (string, string, error) {
+			return "https://s3.example/put", "file-3", nil
+		},
+	}
+	db := newFakeMetadataStore()
+	h := common.ClientInfoMiddleware()(GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil))
+	upload := func(clientInfo string) *httptest.ResponseRecorder {
+		req := asUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"filename": "notes.txt", "size": 100}`)), testUser)
+		req.Header.Set(common.ClientInfoHeader, clientInfo)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := upload("app=vibedrop-cli; version=1.4.2; platform=linux/amd64"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	want := common.ClientInfo{App: "vibedrop-cli", Version: "1.4.2", Platform: "linux/amd64"}
+	if client := db.files["file-3"].Client; client == nil || *client != want {
+		t.Errorf("file client = %+v, want %+v", client, want)
+	}
+	if urls := db.urls["file-3"]; len(urls) != 1 || urls[0].Client == nil || *urls[0].Client != want {
+		t.Errorf("audited URLs = %+v, want one issued to %+v", urls, want)
+	}
+
+	if rec := upload("vibedrop-cli 1.4.2"); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed header: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestBackgroundUploadURLs(t *testing.T) {
+	var signed storage.UploadOptions
+	s3 := &fakeObjectStore{
+		initiateMultipartUpload: func(_ context.Context, userID, filename string, opts storage.UploadOptions) (*storage.MultipartUploadInfo, error) {
+			signed = opts
+			return &storage.MultipartUploadInfo{UploadID: "upload-1", Key: storage.ObjectKey(userID, "file-3", filename), FileID: "file-3"}, nil
+		},
+		generateMultipartUploadURL: func(context.Context, *storage.MultipartUploadInfo, int) (string, error) {
+			return "https://s3.example/part", nil
+		},
+	}
+	db := newFakeMetadataStore()
+	h := GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+
+	rec := serve(h, http.MethodPost, nil, `{"filename": "disk.img", "size": 10737418240, "background": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data PresignedURLResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if signed.URLExpiry != 24*time.Hour || !resp.Data.Background || resp.Data.Hints.URLTTLSeconds != 86400 {
+		t.Errorf("signed for %s, background %v, hinted TTL %ds; want 24h background URLs", signed.URLExpiry, resp.Data.Background, resp.Data.Hints.URLTTLSeconds)
+	}
+	if expiresIn := time.Until(resp.Data.Chunks[0].ExpiresAt); expiresIn < 23*time.Hour {
+		t.Errorf("chunk URL expires in %s, want about 24h", expiresIn)
+	}
+	if saved := db.files["file-3"]; !saved.IsBackgroundUpload() || saved.UploadURLExpiry() != 24*time.Hour {
+		t.Errorf("saved URL TTL = %ds, want a 24h background upload", saved.UploadURLTTL)
+	}
+}
+
+func TestCompleteBackgroundUploadRejectsOverwrittenParts(t *testing.T) {
+	file := multipartFile()
+	file.UploadURLTTL = 86400
+	db := newFakeMetadataStore(file)
+	db.chunks["file-2"] = []storage.FileChunk{
+		{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, ETag: `"aaa"`, Status: "uploaded"},
+		{FileID: "file-2", ChunkNumber: 2, S3PartNumber: 2, ETag: `"bbb"`, Status: "uploaded"},
+	}
+	s3 := &fakeObjectStore{listParts: func(context.Context, *storage.MultipartUploadInfo) ([]storage.UploadedPart, error) {
+		return []storage.UploadedPart{{PartNumber: 1, ETag: `"aaa"`}, {PartNumber: 2, ETag: `"ccc"`}}, nil
+	}}
+
+	// Reporting different content for a confirmed chunk is refused
+	rec := serve(ChunkCompletionHandler(s3, db, false), http.MethodPost, map[string]string{"fileId": "file-2", "chunkNumber": "1"},
+		`{"etag": "\"ddd\"", "status": "uploaded"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("re-reported chunk: status = %d, want 409 (body: %s)", rec.Code, rec.Body.String())
+	}
+	db.chunks["file-2"][0].Status, db.chunks["file-2"][0].ETag = "uploaded", `"aaa"`
+
+	// A part overwritten in S3 through its reused URL blocks completion
+	rec = serve(CompleteMultipartUploadHandler(s3, db, quarantine.Policy{}, scan.Policy{}, 0, nil, nil), http.MethodPost, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("completion: status = %d, want 409 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if chunk := db.chunks["file-2"][1]; chunk.Status != "failed" {
+		t.Errorf("overwritten chunk status = %q, want failed so it can be uploaded again", chunk.Status)
+	}
+	if status := db.files["file-2"].Status; status != storage.FileStatusUploading {
+		t.Errorf("file status = %q, want still uploading", status)
+	}
+}
+
+func TestUploadStatusIssuesURLsForRemainingChunks(t *testing.T) {
+	file := multipartFile()
+	file.TotalSize = 3000
+	db := newFakeMetadataStore(file)
+	db.chunks["file-2"] = []storage.FileChunk{
+		{FileID: "file-2", ChunkNumber: 3, S3PartNumber: 3, Size: 1000, Status: "failed"},
+		{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, Size: 1000, Status: "uploaded", ETag: `"a"`},
+		{FileID: "file-2", ChunkNumber: 2, S3PartNumber: 2, Size: 1000, Status: "pending"},
+	}
+	var signed []int
+	s3 := &fakeObjectStore{generateMultipartUploadURL: func(_ context.Context, _ *storage.MultipartUploadInfo, partNumber int) (string, error) {
+		signed = append(signed, partNumber)
+		return fmt.Sprintf("https://s3.example/part-%d", partNumber), nil
+	}}
+
+	rec := serve(UploadStatusHandler(s3, db), http.MethodGet, map[string]string{"fileId": "file-2"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data UploadStatus `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	status := resp.Data
+	if status.UploadedChunks != 1 || status.BytesConfirmed != 1000 || status.TotalBytes != 3000 {
+		t.Errorf("status = %+v, want 1 chunk and 1000 of 3000 bytes confirmed", status)
+	}
+	if len(status.RemainingURLs) != 2 || status.RemainingURLs[0].ChunkNumber != 2 || status.RemainingURLs[1].URL != "https://s3.example/part-3" {
+		t.Errorf("remaining URLs = %+v, want chunks 2 and 3 in order", status.RemainingURLs)
+	}
+	if len(db.urls["file-2"]) != 2 {
+		t.Errorf("audited %d URLs, want 2", len(db.urls["file-2"]))
+	}
+
+	// A completed upload has nothing left to sign
+	file.Status = storage.FileStatusCompleted
+	signed = nil
+	serve(UploadStatusHandler(s3, db), http.MethodGet, map[string]string{"fileId": "file-2"}, "")
+	if len(signed) != 0 {
+		t.Errorf("signed parts %v for a completed upload", signed)
+	}
+}
+
+func TestRefreshChunkURL(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{
+		{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, Size: 1000, Status: "uploaded", ETag: `"a"`},
+		{FileID: "file-2", ChunkNumber: 2, S3PartNumber: 2, Size: 500, Status: "pending", URLExpiresAt: "2025-01-01T00:00:00Z"},
+	}
+	s3 := &fakeObjectStore{generateMultipartUploadURL: func(_ context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (string, error) {
+		if uploadInfo.UploadID != "upload-1" {
+			t.Errorf("signed for upload %q, want the stored upload-1", uploadInfo.UploadID)
+		}
+		return fmt.Sprintf("https://s3.example/part-%d", partNumber), nil
+	}}
+	refresh := func(chunkNumber string) *httptest.ResponseRecorder {
+		return serve(RefreshChunkURLHandler(s3, db), http.MethodPost, map[string]string{"fileId": "file-2", "chunkNumber": chunkNumber}, "")
+	}
+
+	rec := refresh("2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data ChunkURL `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.URL != "https://s3.example/part-2" || resp.Data.Size != 500 {
+		t.Errorf("chunk URL = %+v, want part 2 of 500 bytes", resp.Data)
+	}
+	if recorded := db.chunks["file-2"][1].URLExpiresAt; recorded != resp.Data.ExpiresAt.Format(time.RFC3339) {
+		t.Errorf("recorded expiry %s, want %s", recorded, resp.Data.ExpiresAt.Format(time.RFC3339))
+	}
+	if len(db.urls["file-2"]) != 1 {
+		t.Errorf("audited %d URLs, want 1", len(db.urls["file-2"]))
+	}
+
+	if rec := refresh("1"); rec.Code != http.StatusConflict {
+		t.Errorf("uploaded chunk: status = %d, want 409", rec.Code)
+	}
+	if rec := refresh("9"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing chunk: status = %d, want 404", rec.Code)
+	}
+	db.files["file-2"].Status = storage.FileStatusCompleted
+	if rec := refresh("2"); rec.Code != http.StatusConflict {
+		t.Errorf("completed upload: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestChunkCompletionRejectsUnconfirmedPart(t *testing.T) {
+	db := newFakeMetadataStore(multipartFile())
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1, S3PartNumber: 1, Size: 1024, Status: "pending"}}
+	s3 := &fakeObjectStore{getPart: func(context.Context, *storage.MultipartUploadInfo, int) (*storage.UploadedPart, error) {
+		return &storage.UploadedPart{PartNumber: 1, ETag: `"other"`, Size: 1024}, nil
+	}}
+
+	rec := serve(ChunkCompletionHandler(s3, db, true), http.MethodPost, map[string]string{"fileId": "file-2", "chunkNumber": "1"},
+		`{"etag": "\"abc\"", "status": "uploaded"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if status := db.chunks["file-2"][0].Status; status != "failed" {
+		t.Errorf("chunk status = %q, want failed", status)
+	}
+}
+
+// completionCountingStore counts the full chunk reads made to check completion
+type completionCountingStore struct {
+	*fakeMetadataStore
+	checks int
+}
+
+func (s *completionCountingStore) CheckUploadComplete(ctx context.Context, fileID string) (bool, []storage.FileChunk, error) {
+	s.checks++
+	return s.fakeMetadataStore.CheckUploadComplete(ctx, fileID)
+}
+
+func TestChunkCompletionCountsUploadedParts(t *testing.T) {
+	file := multipartFile()
+	totalChunks := 3
+	file.TotalChunks = &totalChunks
+	db := &completionCountingStore{fakeMetadataStore: newFakeMetadataStore(file)}
+	for i := 1; i <= totalChunks; i++ {
+		db.chunks["file-2"] = append(db.chunks["file-2"], storage.FileChunk{FileID: "file-2", ChunkNumber: i, S3PartNumber: i, Status: "pending"})
+	}
+
+	report := func(chunkNumber int, status string) bool {
+		t.Helper()
+		rec := serve(ChunkCompletionHandler(&fakeObjectStore{}, db, false), http.MethodPost,
+			map[string]string{"fileId": "file-2", "chunkNumber": fmt.Sprint(chunkNumber)}, `{"etag": "\"abc\"", "status": "`+status+`"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("chunk %d: status = %d, want 200 (body: %s)", chunkNumber, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				UploadComplete bool `json:"upload_complete"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data.UploadComplete
+	}
+
+	// Reported twice, failed and then uploaded again, chunk 2 is still counted once
+	for _, step := range []struct {
+		chunkNumber int
+		status      string
+	}{{1, "uploaded"}, {2, "uploaded"}, {2, "uploaded"}, {2, "failed"}, {2, "uploaded"}} {
+		if report(step.chunkNumber, step.status) {
+			t.Fatalf("chunk %d %s: upload reported complete with chunk 3 pending", step.chunkNumber, step.status)
+		}
+	}
+	if db.checks != 0 {
+		t.Errorf("%d full completion checks before every part was counted, want none", db.checks)
+	}
+	if !report(3, "uploaded") {
+		t.Error("last chunk: upload not reported complete")
+	}
+	if db.checks != 1 || db.files["file-2"].UploadedParts != totalChunks {
+		t.Errorf("%d full checks and %d parts counted, want 1 and %d", db.checks, db.files["file-2"].UploadedParts, totalChunks)
+	}
+}
+
+func TestUploadDryRunCreatesNothing(t *testing.T) {
+	db := newFakeMetadataStore()
+	h := GenerateUploadURLHandler(&fakeObjectStore{}, db, NewUploadHints(4, 3, time.Second, 10*time.Second), testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/files/upload-url?dry_run=true",
+		strings.NewReader(`{"filename": "disk.img", "size": 10737418240}`)), testUser)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data UploadPlan `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if plan := resp.Data; !plan.DryRun || plan.UploadType != "multipart" || plan.TotalChunks != 2 || plan.Hints == nil {
+		t.Errorf("plan = %+v, want a two-chunk multipart plan with hints", plan)
+	}
+	if len(db.files) != 0 || len(db.chunks) != 0 {
+		t.Errorf("dry run saved %d files and %d chunk lists", len(db.files), len(db.chunks))
+	}
+
+	// Validation still runs
+	req = asUser(httptest.NewRequest(http.MethodPost, "/files/upload-url?dry_run=true", strings.NewReader(`{"filename": ""}`)), testUser)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid dry run status = %d, want 400", rec.Code)
+	}
+}
+
+func TestUploadValidationReturnsEveryFieldError(t *testing.T) {
+	h := GenerateUploadURLHandler(&fakeObjectStore{}, newFakeMetadataStore(), UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/files/upload-url", strings.NewReader(`{"filename": "", "size": -1}`)), testUser)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+
+	var resp common.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error.Code != common.ErrorCodeValidation {
+		t.Errorf("code = %s, want %s", resp.Error.Code, common.ErrorCodeValidation)
+	}
+	var fields []string
+	for _, e := range resp.Error.Errors {
+		fields = append(fields, e.Field+":"+string(e.Code))
+	}
+	if got, want := strings.Join(fields, ","), "filename:FILENAME_REQUIRED,size:INVALID_SIZE"; got != want {
+		t.Errorf("errors = %s, want %s", got, want)
+	}
+}
+
+func TestUploadContentTypePolicy(t *testing.T) {
+	configured := common.ContentTypePolicy{Mode: common.PolicyModeDenylist, Rules: []common.ContentTypeRule{
+		{Type: "video/*", MaxSize: 1000},
+		{Type: "application/x-msdownload", Blocked: true},
+	}}
+	db := newFakeMetadataStore()
+	s3 := &fakeObjectStore{generateUploadURL: func(context.Context, string, string, storage.UploadOptions) (string, string, error) {
+		return "https://upload", "file-3", nil
+	}}
+	h := GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, NewContentTypePolicies(db, configured), common.CollisionVersion, 24*time.Hour, nil)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantErr  common.ErrorCode
+	}{
+		{"blocked type", `{"filename": "setup", "size": 10, "content_type": "application/x-msdownload"}`, http.StatusBadRequest, common.ErrorCodeInvalidFileType},
+		{"over the type's size limit", `{"filename": "clip", "size": 1001, "content_type": "video/mp4"}`, http.StatusBadRequest, common.ErrorCodeFileTooLarge},
+		{"within the type's size limit", `{"filename": "clip", "size": 1000, "content_type": "video/mp4"}`, http.StatusOK, ""},
+		{"type with no rule", `{"filename": "report.pdf", "size": 5000}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := asUser(httptest.NewRequest(http.MethodPost, "/files/upload-url?dry_run=true", strings.NewReader(tt.body)), testUser)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantErr != "" {
+				if code := errorCode(t, rec); code != tt.wantErr {
+					t.Errorf("code = %s, want %s", code, tt.wantErr)
+				}
+			}
+		})
+	}
+
+	// A policy set by an admin replaces the configured one
+	db.policy = &storage.ContentTypePolicyRecord{Policy: common.ContentTypePolicy{
+		Mode:  common.PolicyModeAllowlist,
+		Rules: []common.ContentTypeRule{{Type: "image/png"}},
+	}}
+	rec := serve(h, http.MethodPost, nil, `{"filename": "report.pdf", "size": 5000}`)
+	if rec.Code != http.StatusBadRequest || errorCode(t, rec) != common.ErrorCodeInvalidFileType {
+		t.Errorf("pdf under a png-only allowlist: status = %d, want 400 INVALID_FILE_TYPE", rec.Code)
+	}
+	rec = serve(h, http.MethodPost, nil, `{"filename": "photo.png", "size": 5000}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("png under a png-only allowlist: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	for _, file := range db.files {
+		if file.ContentType != "image/png" {
+			t.Errorf("stored content type = %q, want image/png", file.ContentType)
+		}
+	}
+}
+
+func TestUploadFilenameCollision(t *testing.T) {
+	renamed := singleFile()
+	renamed.FileID, renamed.Filename = "file-4", "report (2).pdf"
+	s3 := &fakeObjectStore{generateUploadURL: func(context.Context, string, string, storage.UploadOptions) (string, string, error) {
+		return "https://upload", "file-3", nil
+	}}
+	upload := func(h http.Handler, body string) (*httptest.ResponseRecorder, PresignedURLResponse) {
+		rec := serve(h, http.MethodPost, nil, body)
+		var resp struct {
+			Data PresignedURLResponse `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, resp.Data
+	}
+	const body = `{"filename": "report.pdf", "size": 10%s}`
+
+	// The deployment default keeps the name and records a new version
+	db := newFakeMetadataStore(singleFile(), renamed)
+	rec, resp := upload(GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil), fmt.Sprintf(body, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("version: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if resp.Filename != "report.pdf" || resp.Collision == nil || resp.Collision.Version != 2 || resp.Collision.ExistingFileID != "file-1" {
+		t.Errorf("version: response = %+v, collision %+v, want report.pdf as version 2 of file-1", resp, resp.Collision)
+	}
+	if saved := db.files["file-3"]; saved.Version != 2 || saved.PreviousVersionID != "file-1" {
+		t.Errorf("version: saved version %d after %q, want 2 after file-1", saved.Version, saved.PreviousVersionID)
+	}
+
+	// A request can pick another strategy; renaming skips names already taken
+	db = newFakeMetadataStore(singleFile(), renamed)
+	h := GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+	rec, resp = upload(h, fmt.Sprintf(body, `, "on_collision": "rename"`))
+	if rec.Code != http.StatusOK || resp.Filename != "report (3).pdf" || db.files["file-3"].Filename != "report (3).pdf" {
+		t.Errorf("rename: status %d, stored as %q, want 200 and report (3).pdf", rec.Code, resp.Filename)
+	}
+
+	if rec, _ := upload(h, fmt.Sprintf(body, `, "on_collision": "reject"`)); rec.Code != http.StatusConflict {
+		t.Errorf("reject: status = %d, want 409", rec.Code)
+	}
+	if rec, _ := upload(h, fmt.Sprintf(body, `, "on_collision": "merge"`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown strategy: status = %d, want 400", rec.Code)
+	}
+	if rec, resp := upload(h, `{"filename": "new.pdf", "size": 10, "on_collision": "reject"}`); rec.Code != http.StatusOK || resp.Collision != nil {
+		t.Errorf("unused name: status = %d, collision %+v, want 200 and none", rec.Code, resp.Collision)
+	}
+}
+
+func TestUploadNormalizesFilename(t *testing.T) {
+	existing := singleFile()
+	existing.Filename = "r\u00e9sum\u00e9.pdf"
+	db := newFakeMetadataStore(existing)
+	s3 := &fakeObjectStore{generateUploadURL: func(context.Context, string, string, storage.UploadOptions) (string, string, error) {
+		return "https://upload", "file-3", nil
+	}}
+	h := GenerateUploadURLHandler(s3, db, UploadHints{}, testQuota, anyType(), common.CollisionVersion, 24*time.Hour, nil)
+
+	// Decomposed accents and a zero-width space still name the existing file
+	const sent = "re\u0301sume\u0301\u200b.pdf"
+	body := `{"filename": "` + sent + `", "size": 10, "on_collision": "reject"}`
+	if rec := serve(h, http.MethodPost, nil, body); rec.Code != http.StatusConflict {
+		t.Fatalf("reject: status = %d, want 409 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	body = `{"filename": "` + sent + `", "size": 10}`
+	if rec := serve(h, http.MethodPost, nil, body); rec.Code != http.StatusOK {
+		t.Fatalf("version: status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	saved := db.files["file-3"]
+	if saved.Filename != existing.Filename || saved.OriginalFilename != sent || saved.Version != 2 {
+		t.Errorf("saved %q (original %q) as version %d, want %q as version 2 keeping the original", saved.Filename, saved.OriginalFilename, saved.Version, existing.Filename)
+	}
+
+	// Search matches the normalized name regardless of case or form
+	rec := httptest.NewRecorder()
+	ListFilesHandler(db).ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/files?q=SUME%CC%81", nil), testUser))
+	var resp struct {
+		Data struct {
+			Files []FileMetadata `json:"files"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Files) != 2 {
+		t.Errorf("search matched %d files, want 2", len(resp.Data.Files))
+	}
+	rec = httptest.NewRecorder()
+	ListFilesHandler(db).ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/files?q=invoice", nil), testUser))
+	if strings.Contains(rec.Body.String(), "file-") {
+		t.Errorf("search for an unused name matched files: %s", rec.Body.String())
+	}
+}
+
+func TestSearchFiles(t *testing.T) {
+	file := func(id, name, contentType string, size int64, uploadedAt string) *storage.FileMetadata {
+		return &storage.FileMetadata{FileID: id, UserID: testUser, Filename: name, ContentType: contentType, TotalSize: size, UploadedAt: uploadedAt}
+	}
+	db := newFakeMetadataStore(
+		file("file-1", "Invoice-Jan.pdf", "application/pdf", 2000, "2025-01-10T09:00:00Z"),
+		file("file-2", "beach.jpg", "image/jpeg", 5000, "2025-02-01T09:00:00Z"),
+		file("file-3", "invoice-feb.pdf", "application/pdf", 500, "2025-02-10T09:00:00Z"),
+		file("file-4", "invoice-mar.pdf", "application/pdf", 3000, "2025-03-10T10:00:00+01:00"),
+		file("file-5", "diagram.png", "image/png", 8000, "2025-03-20T09:00:00Z"),
+		&storage.FileMetadata{FileID: "file-6", UserID: "user-2", Filename: "invoice-other.pdf", ContentType: "application/pdf", UploadedAt: "2025-03-01T09:00:00Z"},
+	)
+	search := func(query string) ([]string, string, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		SearchFilesHandler(db).ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/files/search?"+query, nil), testUser))
+		var resp struct {
+			Data SearchResults `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, f := range resp.Data.Files {
+			ids = append(ids, f.ID)
+		}
+		return ids, resp.Data.NextCursor, rec.Code
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"q=INVOICE", []string{"file-4", "file-3", "file-1"}},
+		{"content_type=image/*", []string{"file-5", "file-2"}},
+		{"content_type=application/pdf&min_size=1000&max_size=3000", []string{"file-4", "file-1"}},
+		{"uploaded_after=2025-02-01T09:00:00Z&uploaded_before=2025-03-10T09:00:00Z", []string{"file-4", "file-3", "file-2"}},
+		{"q=invoice&uploaded_before=2025-03-10T08:59:59Z", []string{"file-3", "file-1"}},
+	} {
+		ids, next, code := search(tt.query)
+		if code != http.StatusOK || strings.Join(ids, ",") != strings.Join(tt.want, ",") || next != "" {
+			t.Errorf("%s: status %d, files %v (next %q), want %v", tt.query, code, ids, next, tt.want)
+		}
+	}
+
+	// Pages follow on from each other
+	var all []string
+	query := "q=invoice&limit=2"
+	for page := 0; page < 3; page++ {
+		ids, next, code := search(query)
+		if code != http.StatusOK {
+			t.Fatalf("page %d: status %d", page, code)
+		}
+		all = append(all, ids...)
+		if next == "" {
+			break
+		}
+		query = "q=invoice&limit=2&cursor=" + next
+	}
+	if strings.Join(all, ",") != "file-4,file-3,file-1" {
+		t.Errorf("paged search returned %v, want file-4, file-3, file-1", all)
+	}
+
+	for _, query := range []string{"content_type=pdf", "min_size=-1", "uploaded_after=yesterday", "limit=101", "cursor=bogus", "min_size=10&max_size=5"} {
+		if _, _, code := search(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, code)
+		}
+	}
+}
+
+func TestUpdateFileTags(t *testing.T) {
+	db := newFakeMetadataStore(
+		&storage.FileMetadata{FileID: "file-1", UserID: testUser, Filename: "plan.pdf", UploadedAt: "2025-01-10T09:00:00Z"},
+		&storage.FileMetadata{FileID: "file-2", UserID: "user-2", Filename: "theirs.pdf", UploadedAt: "2025-01-10T09:00:00Z"},
+	)
+	h := UpdateFileTagsHandler(db)
+	vars := map[string]string{"id": "file-1"}
+
+	rec := serve(h, http.MethodPut, vars, `{"tags": {"project": "apollo", "draft": ""}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data FileMetadata `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Tags["project"] != "apollo" || len(resp.Data.Tags) != 2 {
+		t.Errorf("response tags = %v, want project and draft", resp.Data.Tags)
+	}
+
+	// Tags show in listings
+	rec = httptest.NewRecorder()
+	ListFilesHandler(db).ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/files", nil), testUser))
+	if !strings.Contains(rec.Body.String(), `"tags":{"draft":"","project":"apollo"}`) {
+		t.Errorf("listing lacks the tags: %s", rec.Body.String())
+	}
+
+	if rec := serve(h, http.MethodPut, vars, `{"tags": {"project ": "apollo"}}`); errorCode(t, rec) != common.ErrorCodeInvalidTag {
+		t.Errorf("padded key: status = %d, want INVALID_TAG", rec.Code)
+	}
+	if rec := serve(h, http.MethodPut, vars, `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing tags: status = %d, want 400", rec.Code)
+	}
+	if rec := serve(h, http.MethodPut, map[string]string{"id": "file-2"}, `{"tags": {}}`); rec.Code != http.StatusNotFound {
+		t.Errorf("another user's file: status = %d, want 404", rec.Code)
+	}
+	if db.files["file-1"].Tags["project"] != "apollo" {
+		t.Error("a rejected update changed the tags")
+	}
+
+	if rec := serve(h, http.MethodPut, vars, `{"tags": {}}`); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "tags") {
+		t.Errorf("clearing tags: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if db.files["file-1"].Tags != nil {
+		t.Errorf("tags left after clearing: %v", db.files["file-1"].Tags)
+	}
+}
+
+func TestFileExists(t *testing.T) {
+	digest := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	completed := singleFile()
+	completed.ChecksumAlgorithm, completed.Checksum = storage.ChecksumSHA256, digest
+	pending := singleFile()
+	pending.FileID, pending.Status, pending.UploadedAt = "file-3", storage.FileStatusUploading, "2030-01-01T00:00:00Z"
+	pending.ChecksumAlgorithm, pending.Checksum = storage.ChecksumSHA256, digest
+	others := singleFile()
+	others.FileID, others.UserID, others.TotalSize = "file-4", "user-2", 2048
+	others.ChecksumAlgorithm, others.Checksum = storage.ChecksumSHA256, digest
+	db := newFakeMetadataStore(completed, pending, others)
+
+	uploaded := false
+	s3 := &fakeObjectStore{
+		objectChecksum: func(context.Context, string, string, string) (string, error) {
+			if !uploaded {
+				return "", storage.ErrObjectNotFound
+			}
+			return digest, nil
+		},
+	}
+	check := func(body string) FileExistsResponse {
+		t.Helper()
+		rec := serve(FileExistsHandler(s3, db), http.MethodPost, nil, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data FileExistsResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	// The newer single upload doesn't count until its object is stored
+	body := `{"size": 1024, "checksum_algorithm": "sha256", "checksum": "` + digest + `"}`
+	if resp := check(body); !resp.Exists || resp.File == nil || resp.File.ID != "file-1" {
+		t.Errorf("before the PUT: %+v, want file-1", resp)
+	}
+	uploaded = true
+	if resp := check(body); !resp.Exists || resp.File == nil || resp.File.ID != "file-3" {
+		t.Errorf("after the PUT: %+v, want file-3", resp)
+	}
+
+	// Another user's file with the content isn't found
+	if resp := check(`{"size": 2048, "checksum_algorithm": "sha256", "checksum": "` + digest + `"}`); resp.Exists {
+		t.Errorf("found another user's file: %+v", resp)
+	}
+	if resp := check(`{"size": 1024, "checksum_algorithm": "crc32c", "checksum": "AAAAAA=="}`); resp.Exists {
+		t.Errorf("matched another checksum: %+v", resp)
+	}
+
+	if rec := serve(FileExistsHandler(s3, db), http.MethodPost, nil, `{"checksum_algorithm": "md5", "checksum": "x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid request: status = %d, want 400", rec.Code)
+	}
+}
+
+// steppedChunks runs the next of steps each time an upload's chunks are read after the
+// first, to change the upload while a handler watches it
+type steppedChunks struct {
+	*fakeMetadataStore
+	steps []func()
+	reads int
+}
+
+func (s *steppedChunks) GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error) {
+	if s.reads > 0 && s.reads <= len(s.steps) {
+		s.steps[s.reads-1]()
+	}
+	s.reads++
+	return s.fakeMetadataStore.GetFileChunks(ctx, fileID)
+}
+
+func TestUploadEvents(t *testing.T) {
+	newStore := func() *fakeMetadataStore {
+		file := multipartFile()
+		file.TotalSize = 30
+		db := newFakeMetadataStore(file)
+		for i := 1; i <= 3; i++ {
+			db.chunks["file-2"] = append(db.chunks["file-2"], storage.FileChunk{FileID: "file-2", ChunkNumber: i, Size: 10, Status: "pending"})
+		}
+		return db
+	}
+	stream := func(db MetadataStore) []string {
+		req := asUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser)
+		req = mux.SetURLVars(req, map[string]string{"fileId": "file-2"})
+		req.Header.Set("Accept", "text/event-stream")
+		rec := httptest.NewRecorder()
+		UploadEventsHandler(db, time.Millisecond).ServeHTTP(rec, req)
+		if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", ct)
+		}
+		var events []string
+		for _, event := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+			events = append(events, strings.ReplaceAll(strings.TrimPrefix(event, "event: "), "\ndata: ", " "))
+		}
+		return events
+	}
+
+	db := newStore()
+	chunks := db.chunks["file-2"]
+	events := stream(&steppedChunks{fakeMetadataStore: db, steps: []func(){
+		func() { chunks[0].Status = "uploaded" },
+		func() {},
+		func() { chunks[1].Status, chunks[2].Status = "failed", "uploaded" },
+		func() { chunks[1].Status, db.files["file-2"].Status = "uploaded", storage.FileStatusCompleted },
+	}})
+	want := []string{
+		`progress {"file_id":"file-2","status":"uploading","total_chunks":3,"uploaded_chunks":0,"failed_chunks":0,"total_bytes":30,"bytes_uploaded":0}`,
+		`chunk {"chunk_number":1,"status":"uploaded","size":10}`,
+		`progress {"file_id":"file-2","status":"uploading","total_chunks":3,"uploaded_chunks":1,"failed_chunks":0,"total_bytes":30,"bytes_uploaded":10}`,
+		`: checked`,
+		`chunk {"chunk_number":2,"status":"failed","size":10}`,
+		`chunk {"chunk_number":3,"status":"uploaded","size":10}`,
+		`progress {"file_id":"file-2","status":"uploading","total_chunks":3,"uploaded_chunks":2,"failed_chunks":1,"total_bytes":30,"bytes_uploaded":20}`,
+		`chunk {"chunk_number":2,"status":"uploaded","size":10}`,
+		`progress {"file_id":"file-2","status":"uploading","total_chunks":3,"uploaded_chunks":3,"failed_chunks":0,"total_bytes":30,"bytes_uploaded":30}`,
+		`end {"file_id":"file-2","status":"completed","total_chunks":3,"uploaded_chunks":3,"failed_chunks":0,"total_bytes":30,"bytes_uploaded":30}`,
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+
+	// An aborted upload's record is gone, which ends its events
+	db = newStore()
+	events = stream(&steppedChunks{fakeMetadataStore: db, steps: []func(){
+		func() { delete(db.files, "file-2") },
+	}})
+	if last := events[len(events)-1]; !strings.HasPrefix(last, `end {"file_id":"file-2","status":"aborted"`) {
+		t.Errorf("aborted upload: last event = %s, want end with status aborted", last)
+	}
+
+	// Without text/event-stream, the progress so far
+	rec := serve(UploadEventsHandler(newStore(), time.Millisecond), http.MethodGet, map[string]string{"fileId": "file-2"}, "")
+	var resp struct {
+		Data UploadProgress `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || resp.Data.TotalChunks != 3 || resp.Data.TotalBytes != 30 {
+		t.Errorf("snapshot: status = %d, progress = %+v", rec.Code, resp.Data)
+	}
+}
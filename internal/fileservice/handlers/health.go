@@ -12,6 +12,8 @@ type HealthResponse struct {
 	Service   string    `json:"service"`
 }
 
+// HealthHandler answers the liveness probe; readiness, which pings the stores, is served
+// by a health.Checker
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:    "healthy",
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/inbox"
+)
+
+// InboxResponse is where a user can email files and who may do so
+type InboxResponse struct {
+	Address        string   `json:"address"`
+	AllowedSenders []string `json:"allowed_senders"` // Addresses, and "@domain" for everyone at a domain
+}
+
+// InboxSendersRequest replaces a user's allowlist
+type InboxSendersRequest struct {
+	AllowedSenders []string `json:"allowed_senders"`
+}
+
+// GetInboxHandler returns the user's inbox address and allowlist. Until the user sets an
+// allowlist, only their own email address may send.
+func GetInboxHandler(store InboxStore, domain, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok || !inboxEnabled(w, domain) {
+			return
+		}
+
+		senders, err := allowedSenders(r.Context(), store, userID)
+		if err != nil {
+			writeNotFoundOr(w, err, "User not found", "User ID: "+userID+" does not exist", "Failed to load inbox settings")
+			return
+		}
+		common.WriteOKResponse(w, InboxResponse{Address: inbox.Address([]byte(secret), domain, userID), AllowedSenders: senders})
+	}
+}
+
+// SetInboxSendersHandler replaces who may email files into the user's inbox. An empty
+// list turns upload by email off for the user.
+func SetInboxSendersHandler(store InboxStore, domain, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok || !inboxEnabled(w, domain) {
+			return
+		}
+
+		var req InboxSendersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		if req.AllowedSenders == nil {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "allowed_senders",
+				Code:    common.ErrorCodeFieldRequired,
+				Message: "allowed_senders is required; send [] to accept no mail",
+			}})
+			return
+		}
+		senders, err := inbox.NormalizeSenders(req.AllowedSenders)
+		if err != nil {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "allowed_senders",
+				Code:    common.ErrorCodeInvalidValue,
+				Message: err.Error(),
+			}})
+			return
+		}
+
+		settings := &storage.InboxSettings{UserID: userID, AllowedSenders: senders, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+		if err := store.SaveInboxSettings(r.Context(), settings); err != nil {
+			writeStorageError(w, "Failed to save inbox settings", err, common.WriteDatabaseError)
+			return
+		}
+		common.Logger(r.Context()).Info("Updated inbox senders", "senders", len(senders))
+		common.WriteOKResponse(w, InboxResponse{Address: inbox.Address([]byte(secret), domain, userID), AllowedSenders: senders})
+	}
+}
+
+// inboxEnabled writes a 404 if upload by email isn't configured
+func inboxEnabled(w http.ResponseWriter, domain string) bool {
+	if domain == "" {
+		common.WriteNotFoundError(w, "Upload by email is not enabled", "INBOX_DOMAIN is not set on this deployment")
+		return false
+	}
+	return true
+}
+
+// allowedSenders is the user's saved allowlist, or their own address if they never saved one
+func allowedSenders(ctx context.Context, store InboxStore, userID string) ([]string, error) {
+	settings, err := store.GetInboxSettings(ctx, userID)
+	if err == nil {
+		return settings.AllowedSenders, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	user, err := store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strings.ToLower(user.Email)}, nil
+}
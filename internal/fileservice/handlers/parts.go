@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/delta"
+)
+
+// FilePartMap lays a file out as parts a download client can fetch with ranged GETs in
+// parallel and check one by one, as a multipart upload sends them
+type FilePartMap struct {
+	FileID     string         `json:"file_id"`
+	Size       int64          `json:"size"`
+	PartSize   int64          `json:"part_size"` // Every part's size but the last
+	TotalParts int            `json:"total_parts"`
+	Parts      []FilePart     `json:"parts"`
+	Hints      *DownloadHints `json:"hints,omitempty"`
+}
+
+// FilePart is one range of a file and the SHA-256 of its bytes
+type FilePart struct {
+	PartNumber int    `json:"part_number"`
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"` // Hex
+}
+
+// DownloadHints are the server's recommended settings for parallel downloads
+type DownloadHints struct {
+	MaxParallelParts int         `json:"max_parallel_parts"`
+	Retry            RetryPolicy `json:"retry"`
+}
+
+// FilePartsHandler returns a completed file's part map. Its parts are the blocks of the
+// file's block manifest, so the first request for either reads the file and both are then
+// answered from the stored manifest. The download itself uses a URL from the download-url
+// endpoint with a Range header per part.
+func FilePartsHandler(s3Client ObjectStore, dynamoClient MetadataStore, manifests BlockManifestStore, hints UploadHints) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metadata, ok := completedFile(w, r, dynamoClient)
+		if !ok {
+			return
+		}
+
+		blocks, err := blockManifest(r.Context(), s3Client, manifests, metadata)
+		if err != nil {
+			writeStorageError(w, "Failed to compute part map", err, common.WriteS3Error)
+			return
+		}
+
+		partMap := FilePartMap{
+			FileID:     metadata.FileID,
+			Size:       metadata.TotalSize,
+			PartSize:   delta.BlockSize,
+			TotalParts: len(blocks),
+			Parts:      make([]FilePart, len(blocks)),
+			Hints:      &DownloadHints{MaxParallelParts: hints.MaxParallelParts, Retry: hints.Retry},
+		}
+		for i, block := range blocks {
+			partMap.Parts[i] = FilePart{PartNumber: i + 1, Offset: block.Offset, Size: block.Size, SHA256: hex.EncodeToString(block.Strong[:])}
+		}
+		common.WriteOKResponse(w, partMap)
+	}
+}
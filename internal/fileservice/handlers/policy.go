@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// Where the content type policy in effect came from
+const (
+	PolicySourceAdmin  = "admin"
+	PolicySourceConfig = "config"
+)
+
+// maxPolicyBytes bounds a content type policy request body
+const maxPolicyBytes = 64 * 1024
+
+// ContentTypePolicies resolves the content type policy uploads are checked against: the
+// one an admin set, or the deployment's configured policy if none has been
+type ContentTypePolicies struct {
+	store      PolicyStore
+	configured common.ContentTypePolicy
+}
+
+// NewContentTypePolicies creates a resolver that falls back to the configured policy
+func NewContentTypePolicies(store PolicyStore, configured common.ContentTypePolicy) *ContentTypePolicies {
+	return &ContentTypePolicies{store: store, configured: configured}
+}
+
+// ContentTypePolicyResponse is the policy in effect and where it came from
+type ContentTypePolicyResponse struct {
+	Source    string                   `json:"source"`               // "admin" or "config"
+	UpdatedAt string                   `json:"updated_at,omitempty"` // When an admin last set it
+	Policy    common.ContentTypePolicy `json:"policy"`
+}
+
+// Current returns the policy in effect. It is read on every call so a change made through
+// one replica applies to all of them at once.
+func (p *ContentTypePolicies) Current(ctx context.Context) (ContentTypePolicyResponse, error) {
+	record, err := p.store.GetContentTypePolicy(ctx)
+	if errors.Is(err, storage.ErrNoContentTypePolicy) {
+		return ContentTypePolicyResponse{Source: PolicySourceConfig, Policy: p.configured}, nil
+	}
+	if err != nil {
+		return ContentTypePolicyResponse{}, err
+	}
+	return ContentTypePolicyResponse{Source: PolicySourceAdmin, UpdatedAt: record.UpdatedAt, Policy: record.Policy}, nil
+}
+
+// GetContentTypePolicyHandler returns the content type policy uploads are checked against
+func GetContentTypePolicyHandler(policies *ContentTypePolicies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current, err := policies.Current(r.Context())
+		if err != nil {
+			writeStorageError(w, "Failed to load content type policy", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.WriteOKResponse(w, current)
+	}
+}
+
+// SetContentTypePolicyHandler replaces the configured content type policy for every replica
+func SetContentTypePolicyHandler(policies *ContentTypePolicies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPolicyBytes))
+		if err != nil {
+			common.WriteBadRequestError(w, "Invalid request body", err.Error())
+			return
+		}
+		policy, err := common.ParseContentTypePolicy(body)
+		if err != nil {
+			common.WriteValidationError(w, "Invalid content type policy", err.Error())
+			return
+		}
+
+		record := &storage.ContentTypePolicyRecord{Policy: policy, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+		if err := policies.store.SaveContentTypePolicy(r.Context(), record); err != nil {
+			writeStorageError(w, "Failed to save content type policy", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.WriteOKResponse(w, ContentTypePolicyResponse{Source: PolicySourceAdmin, UpdatedAt: record.UpdatedAt, Policy: policy})
+	}
+}
+
+// ResetContentTypePolicyHandler drops the admin-set policy so the configured one applies again
+func ResetContentTypePolicyHandler(policies *ContentTypePolicies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := policies.store.DeleteContentTypePolicy(r.Context()); err != nil {
+			writeStorageError(w, "Failed to reset content type policy", err, common.WriteDatabaseError)
+			return
+		}
+
+		common.WriteNoContentResponse(w)
+	}
+}
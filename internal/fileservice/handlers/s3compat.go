@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/callbacks"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/s3compat"
+)
+
+const (
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	// s3TimeFormat is how S3 writes times in XML
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+	// maxS3Keys is the most keys a listing returns, as on S3
+	maxS3Keys = 1000
+)
+
+// s3Subresources are the query parameters that make a request an S3 operation other than
+// listing, getting, putting or deleting. None is supported but location.
+var s3Subresources = []string{"acl", "cors", "delete", "lifecycle", "location", "object-lock", "partNumber",
+	"policy", "retention", "tagging", "uploadId", "uploads", "versionId", "versioning", "versions"}
+
+// s3Bucket serves a user's files as the one bucket of the S3-compatible API. Its objects
+// are the files the WebDAV drive shows, stored and deleted the same way; keys with a slash
+// name nothing, since files have no folders.
+type s3Bucket struct {
+	drive *webDAVDrive
+}
+
+// S3Handler serves the signed-in user's files under s3compat.Path as the bucket
+// s3compat.Bucket: ListObjects (V1 and V2), HeadObject, GetObject with a byte range,
+// PutObject and DeleteObject. Reads need the files:read scope and changes files:write.
+// Objects are put as WebDAV uploads are, checked against the content type policy, the
+// storage quota of quotaBytes and the executable policy, and queued for a virus scan; each
+// is reported to the callback of the API key that put it and published to bus. Errors are written as the rest of the API writes them; s3compat.Errors turns them into
+// S3 error documents. Multipart uploads and copies aren't supported.
+func S3Handler(s3Client ObjectStore, dynamoClient MetadataStore, policies *ContentTypePolicies, executables quarantine.Policy, scans scan.Policy, quotaBytes int64, uploadCallbacks *callbacks.Notifier, bus events.Publisher) http.Handler {
+	b := &s3Bucket{drive: &webDAVDrive{
+		s3Client:     s3Client,
+		dynamoClient: dynamoClient,
+		policies:     policies,
+		executables:  executables,
+		scans:        scans,
+		quotaBytes:   quotaBytes,
+
+		uploadCallbacks: uploadCallbacks,
+		bus:             bus,
+	}}
+	read := auth.RequireScope(auth.ScopeFilesRead)
+	write := auth.RequireScope(auth.ScopeFilesWrite)
+	listBuckets := read(http.HandlerFunc(b.listBuckets))
+	headBucket := read(http.HandlerFunc(b.headBucket))
+	listObjects := read(http.HandlerFunc(b.listObjects))
+	getObject := read(http.HandlerFunc(b.getObject))
+	putObject := write(http.HandlerFunc(b.putObject))
+	deleteObject := write(http.HandlerFunc(b.deleteObject))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key := s3compat.SplitPath(r.URL.Path)
+		query := r.URL.Query()
+		subresource := ""
+		for _, name := range s3Subresources {
+			if query.Has(name) {
+				subresource = name
+				break
+			}
+		}
+
+		switch {
+		case bucket == "" && r.Method == http.MethodGet:
+			listBuckets.ServeHTTP(w, r)
+		case bucket == "":
+			writeS3MethodNotAllowed(w, r)
+		case bucket != s3compat.Bucket:
+			s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusNotFound, Code: "NoSuchBucket",
+				Message: "The only bucket is " + s3compat.Bucket})
+		case key == "" && subresource == "location" && r.Method == http.MethodGet:
+			s3compat.WriteXML(w, http.StatusOK, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: s3Namespace})
+		case subresource != "" || r.Header.Get("X-Amz-Copy-Source") != "":
+			s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusNotImplemented, Code: "NotImplemented",
+				Message: "Only listing, getting, putting and deleting objects is supported; objects of up to 5 GiB are put in one request, not in parts"})
+		case key == "" && r.Method == http.MethodHead:
+			headBucket.ServeHTTP(w, r)
+		case key == "" && r.Method == http.MethodGet:
+			listObjects.ServeHTTP(w, r)
+		case key == "" && r.Method == http.MethodPut:
+			s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusConflict, Code: "BucketAlreadyOwnedByYou",
+				Message: "The " + s3compat.Bucket + " bucket already exists"})
+		case key == "":
+			writeS3MethodNotAllowed(w, r)
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			getObject.ServeHTTP(w, r)
+		case r.Method == http.MethodPut:
+			putObject.ServeHTTP(w, r)
+		case r.Method == http.MethodDelete:
+			deleteObject.ServeHTTP(w, r)
+		default:
+			writeS3MethodNotAllowed(w, r)
+		}
+	})
+}
+
+func writeS3MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusMethodNotAllowed, Code: "MethodNotAllowed",
+		Message: "The method isn't allowed on this resource"})
+}
+
+// s3Key returns the file name an object key names, or false if it names nothing because
+// it has a slash
+func s3Key(urlPath string) (string, bool) {
+	_, key := s3compat.SplitPath(urlPath)
+	if strings.Contains(key, "/") {
+		return "", false
+	}
+	return common.NormalizeFilename(key), true
+}
+
+func (b *s3Bucket) listBuckets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+	s3compat.WriteXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		OwnerID string   `xml:"Owner>ID"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{
+		Xmlns:   s3Namespace,
+		OwnerID: userID,
+		Buckets: []bucket{{Name: s3compat.Bucket, CreationDate: time.Unix(0, 0).UTC().Format(s3TimeFormat)}},
+	})
+}
+
+func (b *s3Bucket) headBucket(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestUser(w, r); ok {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listBucketResult is the answer to both versions of ListObjects: V1 pages with Marker and
+// NextMarker, V2 with ContinuationToken, NextContinuationToken and StartAfter
+type listBucketResult struct {
+	XMLName               xml.Name   `xml:"ListBucketResult"`
+	Xmlns                 string     `xml:"xmlns,attr"`
+	Name                  string     `xml:"Name"`
+	Prefix                string     `xml:"Prefix"`
+	Delimiter             string     `xml:"Delimiter,omitempty"`
+	EncodingType          string     `xml:"EncodingType,omitempty"`
+	MaxKeys               int        `xml:"MaxKeys"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	Marker                *string    `xml:"Marker"`
+	NextMarker            string     `xml:"NextMarker,omitempty"`
+	KeyCount              *int       `xml:"KeyCount"`
+	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string     `xml:"StartAfter,omitempty"`
+	Contents              []s3Object `xml:"Contents"`
+	CommonPrefixes        []s3Prefix `xml:"CommonPrefixes"`
+}
+
+// listObjects lists the objects after a marker, in key order, up to max-keys of them.
+// Keys sharing a prefix up to the delimiter are grouped as one common prefix, which counts
+// as one key. With encoding-type=url, keys and prefixes are URL-encoded, so any characters
+// survive XML.
+func (b *s3Bucket) listObjects(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v2 := query.Get("list-type") == "2"
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys := maxS3Keys
+	if value := query.Get("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			common.WriteBadRequestError(w, "Invalid max-keys", "max-keys must be a number from 0")
+			return
+		}
+		maxKeys = min(n, maxS3Keys)
+	}
+	encodeURL := query.Get("encoding-type") == "url"
+	encode := func(s string) string {
+		if encodeURL {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	result := listBucketResult{Xmlns: s3Namespace, Name: s3compat.Bucket, Prefix: encode(prefix),
+		Delimiter: encode(delimiter), MaxKeys: maxKeys}
+	if encodeURL {
+		result.EncodingType = "url"
+	}
+	after := ""
+	if v2 {
+		result.StartAfter = encode(query.Get("start-after"))
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				common.WriteBadRequestError(w, "Invalid continuation token", "Pass back the NextContinuationToken of the previous page")
+				return
+			}
+			result.ContinuationToken = token
+			after = string(decoded)
+		}
+	} else {
+		after = query.Get("marker")
+		marker := encode(after)
+		result.Marker = &marker
+	}
+
+	_, files, ok := b.drive.userDriveFiles(w, r)
+	if !ok {
+		return
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	last := ""
+	seen := make(map[string]bool)
+	count := 0
+	for _, name := range names {
+		if name <= after {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = name[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" && (seen[commonPrefix] || commonPrefix <= after) {
+			continue
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+		if commonPrefix != "" {
+			seen[commonPrefix] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{Prefix: encode(commonPrefix)})
+			last = commonPrefix
+			continue
+		}
+		file := files[name]
+		result.Contents = append(result.Contents, s3Object{
+			Key:          encode(name),
+			LastModified: fileModified(file).Format(s3TimeFormat),
+			ETag:         davETag(file),
+			Size:         file.TotalSize,
+			StorageClass: "STANDARD",
+		})
+		last = name
+	}
+
+	if v2 {
+		result.KeyCount = &count
+		if result.IsTruncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else if result.IsTruncated && delimiter != "" {
+		// Without a delimiter, clients carry on from the last key listed
+		result.NextMarker = encode(last)
+	}
+	s3compat.WriteXML(w, http.StatusOK, result)
+}
+
+// getObject serves an object's content, or one range of it, refused as a download URL
+// would be for quarantined, corrupt or unscanned files. HEAD describes it.
+func (b *s3Bucket) getObject(w http.ResponseWriter, r *http.Request) {
+	name, ok := s3Key(r.URL.Path)
+	if !ok {
+		common.WriteNotFoundError(w, "Object not found", "The bucket has no folders, so no key has a slash")
+		return
+	}
+	_, files, ok := b.drive.userDriveFiles(w, r)
+	if !ok {
+		return
+	}
+	metadata, ok := files[name]
+	if !ok {
+		common.WriteNotFoundError(w, "Object not found", fmt.Sprintf("No file is named %s", name))
+		return
+	}
+	if !screenDownload(w, r, b.drive.s3Client, b.drive.dynamoClient, b.drive.executables, b.drive.scans, metadata) {
+		return
+	}
+
+	size := metadata.TotalSize
+	offset, length := int64(0), size
+	partial := false
+	if header := r.Header.Get("Range"); header != "" {
+		var ok bool
+		offset, length, ok = parseS3Range(header, size)
+		if !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusRequestedRangeNotSatisfiable, Code: "InvalidRange",
+				Message: "The requested range is not satisfiable"})
+			return
+		}
+		partial = length != size
+	}
+
+	w.Header().Set("Content-Type", common.DetectContentType(metadata.Filename, metadata.ContentType))
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.Header().Set("ETag", davETag(metadata))
+	w.Header().Set("Last-Modified", fileModified(metadata).Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	status := http.StatusOK
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+		status = http.StatusPartialContent
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	var content io.ReadCloser
+	var err error
+	if partial {
+		content, err = b.drive.s3Client.OpenObjectRange(r.Context(), metadata.Bucket, metadata.S3Key, offset, length)
+	} else {
+		content, err = b.drive.s3Client.OpenObject(r.Context(), metadata.Bucket, metadata.S3Key)
+	}
+	if err != nil {
+		w.Header().Del("Content-Length")
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			common.WriteConflictError(w, "Upload not finished", "The file's content hasn't been uploaded yet")
+			return
+		}
+		writeStorageError(w, "Failed to read file", err, common.WriteS3Error)
+		return
+	}
+	defer content.Close()
+
+	if err := b.drive.dynamoClient.RecordFileAccess(r.Context(), metadata.FileID); err != nil {
+		common.Logger(r.Context()).Warn("Failed to record access", "file_id", metadata.FileID, "error", err)
+	}
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, content); err != nil {
+		common.Logger(r.Context()).Warn("Failed to send file", "file_id", metadata.FileID, "error", err)
+	}
+}
+
+// parseS3Range reads a Range header of one byte range of an object of size: "bytes=a-b",
+// "bytes=a-" or the last n bytes, "bytes=-n". Like S3, it ignores headers it can't read
+// or that ask for several ranges, serving the whole object, and reports false only for a
+// range that starts past the end.
+func parseS3Range(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, true
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, true
+		}
+		if n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, true
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, size, true
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
+
+// putObject stores an object. Over an existing key, it replaces the version listed, as on
+// the WebDAV drive. The content is staged on local disk first, since S3 needs to know the
+// length of content decoded from aws-chunked encoding and the hash of signed content must
+// be checked before anything is stored.
+func (b *s3Bucket) putObject(w http.ResponseWriter, r *http.Request) {
+	name, ok := s3Key(r.URL.Path)
+	if !ok {
+		s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusBadRequest, Code: "InvalidArgument",
+			Message: "The bucket has no folders, so keys can't have a slash"})
+		return
+	}
+	if errs := common.ValidateFilename(name); len(errs) > 0 {
+		common.WriteValidationErrors(w, errs)
+		return
+	}
+	body, length, bodyErr := s3compat.Body(r)
+	if bodyErr != nil {
+		s3compat.WriteError(w, r, bodyErr)
+		return
+	}
+	if length > maxWebDAVPutBytes {
+		s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusBadRequest, Code: "EntityTooLarge",
+			Message: fmt.Sprintf("Objects can be up to %d bytes", int64(maxWebDAVPutBytes))})
+		return
+	}
+
+	staged, err := os.CreateTemp("", "vibe-drop-s3-")
+	if err != nil {
+		common.Logger(r.Context()).Error("Failed to stage upload", "error", err)
+		common.WriteInternalServerError(w, "Failed to store file", "Unable to stage the upload")
+		return
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	size, err := io.Copy(staged, io.LimitReader(body, length+1))
+	if err != nil {
+		var s3Err *s3compat.Error
+		if errors.As(err, &s3Err) {
+			s3compat.WriteError(w, r, s3Err)
+			return
+		}
+		common.WriteBadRequestError(w, "Failed to read file", err.Error())
+		return
+	}
+	if size != length {
+		s3compat.WriteError(w, r, &s3compat.Error{Status: http.StatusBadRequest, Code: "IncompleteBody",
+			Message: fmt.Sprintf("The content is %d bytes, not the %d stated", size, length)})
+		return
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		common.WriteInternalServerError(w, "Failed to store file", err.Error())
+		return
+	}
+
+	metadata, _, ok := b.drive.store(w, r, name, staged, size)
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", davETag(metadata))
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteObject deletes every version of an object's file. As on S3, deleting a key with
+// no object succeeds.
+func (b *s3Bucket) deleteObject(w http.ResponseWriter, r *http.Request) {
+	name, ok := s3Key(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	userID, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+	files, err := b.drive.dynamoClient.ListUserFiles(r.Context(), userID)
+	if err != nil {
+		writeStorageError(w, "Failed to list files", err, common.WriteDatabaseError)
+		return
+	}
+	if b.drive.deleteVersions(w, r, files, name) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
+)
+
+func TestS3RoundTrip(t *testing.T) {
+	s3, objects := memoryObjects()
+	db := newFakeMetadataStore()
+	h := S3Handler(s3, db, anyType(), quarantine.NewPolicy(false, nil), scan.NewPolicy(false, false, 0), testQuota, nil, nil)
+
+	sum := sha256.Sum256([]byte("hello, world"))
+	put := map[string]string{"X-Amz-Content-Sha256": hex.EncodeToString(sum[:])}
+	if rec := davRequest(h, http.MethodPut, "/s3/files/a%20b.txt", "hello, world", put); rec.Code != http.StatusOK || rec.Header().Get("ETag") == "" {
+		t.Fatalf("PUT: status %d, ETag %q: %s", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+	if rec := davRequest(h, http.MethodPut, "/s3/files/c.txt", "tampered", put); rec.Code != http.StatusBadRequest ||
+		!strings.Contains(rec.Body.String(), "XAmzContentSHA256Mismatch") {
+		t.Errorf("PUT with the wrong hash: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(objects) != 1 {
+		t.Errorf("stored %d objects, want 1", len(objects))
+	}
+
+	rec := davRequest(h, http.MethodGet, "/s3/files?list-type=2&prefix=a", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<Key>a b.txt</Key><LastModified>") ||
+		!strings.Contains(rec.Body.String(), "<Size>12</Size>") || !strings.Contains(rec.Body.String(), "<KeyCount>1</KeyCount>") {
+		t.Errorf("ListObjectsV2: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := davRequest(h, http.MethodGet, "/s3/files?prefix=z", "", nil); strings.Contains(rec.Body.String(), "<Contents>") {
+		t.Errorf("ListObjects with another prefix listed %s", rec.Body.String())
+	}
+
+	rec = davRequest(h, http.MethodGet, "/s3/files/a%20b.txt", "", map[string]string{"Range": "bytes=7-"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "world" || rec.Header().Get("Content-Range") != "bytes 7-11/12" {
+		t.Errorf("ranged GET: status %d, Content-Range %q, body %q", rec.Code, rec.Header().Get("Content-Range"), rec.Body.String())
+	}
+	if rec := davRequest(h, http.MethodGet, "/s3/files/a%20b.txt", "", map[string]string{"Range": "bytes=20-"}); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("GET past the end: status %d, want 416", rec.Code)
+	}
+	if rec := davRequest(h, http.MethodGet, "/s3/bucket/a%20b.txt", "", nil); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "NoSuchBucket") {
+		t.Errorf("GET from another bucket: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := davRequest(h, http.MethodPost, "/s3/files/big.bin?uploads", "", nil); rec.Code != http.StatusNotImplemented {
+		t.Errorf("multipart upload: status %d, want 501", rec.Code)
+	}
+
+	if rec := davRequest(h, http.MethodDelete, "/s3/files/a%20b.txt", "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := davRequest(h, http.MethodHead, "/s3/files/a%20b.txt", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD after DELETE: status %d, want 404", rec.Code)
+	}
+}
+
+func TestParseS3Range(t *testing.T) {
+	tests := []struct {
+		header         string
+		offset, length int64
+		ok             bool
+	}{
+		{"bytes=0-9", 0, 10, true},
+		{"bytes=5-", 5, 95, true},
+		{"bytes=-10", 90, 10, true},
+		{"bytes=90-200", 90, 10, true},
+		{"bytes=100-", 0, 0, false},
+		{"bytes=0-1,5-6", 0, 100, true},
+		{"items=0-9", 0, 100, true},
+	}
+	for _, tt := range tests {
+		offset, length, ok := parseS3Range(tt.header, 100)
+		if offset != tt.offset || length != tt.length || ok != tt.ok {
+			t.Errorf("parseS3Range(%q) = %d, %d, %v, want %d, %d, %v", tt.header, offset, length, ok, tt.offset, tt.length, tt.ok)
+		}
+	}
+}
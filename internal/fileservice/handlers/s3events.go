@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/callbacks"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// S3EventResult summarises what an S3 event notification changed
+type S3EventResult struct {
+	Records  int `json:"records"`
+	Consumed int `json:"consumed"` // Background uploads whose single-use URL was retired
+	Rejected int `json:"rejected"` // Objects written through a retired URL, now deleted
+}
+
+// S3EventsHandler correlates S3 object-created events with background single uploads to make
+// their long-lived URLs single-use. The first PUT moves the object to a new key, which leaves
+// the URL pointing at a key the file no longer uses; anything written there later came through
+// the reused URL and is deleted. The first PUT of a single upload made with an API key is
+// reported to the key's callback, and the first PUT of any single upload is published to bus as
+// file.uploaded. Other events are ignored. A failure returns an error so the
+// forwarder redelivers the notification; records already handled are skipped the second time.
+func S3EventsHandler(s3Client ObjectStore, dynamoClient MetadataStore, uploadCallbacks *callbacks.Notifier, bus events.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var notification storage.S3EventNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			common.WriteValidationError(w, "Invalid event notification", err.Error())
+			return
+		}
+
+		result := S3EventResult{Records: len(notification.Records)}
+		for _, record := range notification.Records {
+			outcome, err := handleS3Event(r.Context(), s3Client, dynamoClient, uploadCallbacks, bus, record)
+			if err != nil {
+				writeStorageError(w, "Failed to process S3 event", err, common.WriteS3Error)
+				return
+			}
+			switch outcome {
+			case s3EventConsumed:
+				result.Consumed++
+			case s3EventRejected:
+				result.Rejected++
+			}
+		}
+
+		common.WriteOKResponse(w, result)
+	}
+}
+
+type s3EventOutcome int
+
+const (
+	s3EventIgnored s3EventOutcome = iota
+	s3EventConsumed
+	s3EventRejected
+)
+
+func handleS3Event(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, uploadCallbacks *callbacks.Notifier, bus events.Publisher, record storage.S3EventRecord) (s3EventOutcome, error) {
+	if !record.IsObjectCreated() {
+		return s3EventIgnored, nil
+	}
+	key, err := record.ObjectKey()
+	if err != nil {
+		common.Logger(ctx).Warn("Ignored S3 event with malformed key", "s3_key", record.S3.Object.Key, "error", err)
+		return s3EventIgnored, nil
+	}
+	fileID, ok := storage.FileIDFromKey(key)
+	if !ok {
+		return s3EventIgnored, nil
+	}
+	metadata, err := dynamoClient.GetFileMetadata(ctx, fileID)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Objects without metadata are left to the reconciler
+		return s3EventIgnored, nil
+	}
+	if err != nil {
+		return s3EventIgnored, fmt.Errorf("failed to load metadata for %s: %w", key, err)
+	}
+	if metadata.UploadType != "single" {
+		return s3EventIgnored, nil
+	}
+	if !metadata.IsBackgroundUpload() {
+		// Single uploads are otherwise only finished on first download, so this is when an
+		// API key's callback and the bus hear of them. The report is recorded first, so a
+		// redelivered event or a later PUT through the same URL isn't reported again.
+		if key == metadata.S3Key && metadata.UploadReportedAt == nil {
+			metadata.UploadReportedAt = &[]string{time.Now().Format(time.RFC3339)}[0]
+			if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+				return s3EventIgnored, fmt.Errorf("failed to record upload of file %s: %w", metadata.FileID, err)
+			}
+			metadata.TotalSize = record.S3.Object.Size
+			if metadata.APIKeyID != "" {
+				uploadCallbacks.UploadCompleted(ctx, metadata)
+			}
+			publish(ctx, bus, events.FileUploaded(metadata))
+		}
+		return s3EventIgnored, nil
+	}
+
+	switch {
+	case metadata.UploadConsumedAt == nil && key == metadata.S3Key:
+		if err := consumeUploadURL(ctx, s3Client, dynamoClient, metadata, record); err != nil {
+			return s3EventConsumed, err
+		}
+		metadata.TotalSize = record.S3.Object.Size
+		uploadCallbacks.UploadCompleted(ctx, metadata)
+		publish(ctx, bus, events.FileUploaded(metadata))
+		return s3EventConsumed, nil
+	case metadata.UploadConsumedAt != nil && key != metadata.S3Key && record.S3.Object.Sequencer != metadata.UploadSequencer:
+		// The file has moved on, so this is a later PUT through the retired URL
+		if err := s3Client.DeleteObject(ctx, metadata.Bucket, key); err != nil {
+			return s3EventIgnored, fmt.Errorf("failed to delete %s written through a retired upload URL: %w", key, err)
+		}
+		common.Logger(ctx).Warn("Rejected reuse of the single-use upload URL", "file_id", fileID, "s3_key", key)
+		return s3EventRejected, nil
+	}
+	// A redelivered event, or the copy that retired the URL
+	return s3EventIgnored, nil
+}
+
+// consumeUploadURL retires a background upload's URL after its first PUT by moving the
+// object to a new key, as revocation does
+func consumeUploadURL(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata, record storage.S3EventRecord) error {
+	oldKey := metadata.S3Key
+	newKey := storage.RotatedObjectKey(metadata.UserID, metadata.FileID, metadata.Filename)
+	if err := s3Client.CopyObject(ctx, metadata.Bucket, oldKey, newKey, record.S3.Object.Size); err != nil {
+		return fmt.Errorf("failed to move upload of file %s to a new key: %w", metadata.FileID, err)
+	}
+
+	consumedAt := time.Now()
+	metadata.S3Key = newKey
+	metadata.UploadConsumedAt = &[]string{consumedAt.Format(time.RFC3339)}[0]
+	metadata.UploadSequencer = record.S3.Object.Sequencer
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		if delErr := s3Client.DeleteObject(ctx, metadata.Bucket, newKey); delErr != nil {
+			common.Logger(ctx).Warn("Failed to remove copy after metadata update failed", "s3_key", newKey, "error", delErr)
+		}
+		return fmt.Errorf("failed to record consumed upload of file %s: %w", metadata.FileID, err)
+	}
+
+	// The file is safely at its new key, so a failure here only leaves a stray object
+	if err := s3Client.DeleteObject(ctx, metadata.Bucket, oldKey); err != nil {
+		common.Logger(ctx).Warn("Failed to delete object after retiring the upload URL", "file_id", metadata.FileID, "s3_key", oldKey, "error", err)
+	}
+	if _, err := dynamoClient.MarkURLsRevoked(ctx, metadata.FileID, consumedAt); err != nil {
+		common.Logger(ctx).Warn("Failed to mark URLs revoked", "file_id", metadata.FileID, "error", err)
+	}
+
+	common.Logger(ctx).Info("Retired the single-use upload URL", "file_id", metadata.FileID, "old_s3_key", oldKey, "s3_key", newKey)
+	return nil
+}
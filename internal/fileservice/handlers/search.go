@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 100
+)
+
+// searchPageSize is how many files a search reads from the index at a time
+const searchPageSize = 200
+
+// maxSearchPages caps the index pages one search request reads, so a narrow search over a
+// large library returns what it found so far with a cursor rather than reading it all
+const maxSearchPages = 25
+
+// SearchResults is a page of the files matching a search
+type SearchResults struct {
+	Files      []FileMetadata `json:"files"`
+	Count      int            `json:"count"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Continues the search; absent after the last page
+}
+
+// fileSearch is what a search matches files on; zero fields match every file
+type fileSearch struct {
+	name        string // Normalized with common.FilenameSearchKey
+	contentType string // A MIME type, or a family such as "video/*"
+	minSize     int64
+	maxSize     int64 // 0 for no maximum
+	uploaded    storage.UploadTimeRange
+}
+
+func (s *fileSearch) matches(metadata *storage.FileMetadata) bool {
+	if s.name != "" && !strings.Contains(common.FilenameSearchKey(metadata.Filename), s.name) {
+		return false
+	}
+	if s.contentType != "" {
+		contentType := strings.ToLower(metadata.ContentType)
+		if family, ok := strings.CutSuffix(s.contentType, "/*"); ok {
+			if !strings.HasPrefix(contentType, family+"/") {
+				return false
+			}
+		} else if contentType != s.contentType {
+			return false
+		}
+	}
+	if metadata.TotalSize < s.minSize || (s.maxSize > 0 && metadata.TotalSize > s.maxSize) {
+		return false
+	}
+	return true
+}
+
+// SearchFilesHandler searches the user's files by name, content type, size and upload time,
+// most recently uploaded first. Files are read from an index of the user's files by upload
+// time, narrowed to the upload range, and the other filters are applied as they're read.
+// Results are paged with an opaque cursor.
+func SearchFilesHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		search, limit, cursor, errs := parseFileSearch(r)
+		if len(errs) > 0 {
+			common.WriteValidationErrors(w, errs)
+			return
+		}
+
+		files := make([]FileMetadata, 0, limit)
+		var next *storage.FileCursor
+	read:
+		for pages := 1; ; pages++ {
+			page, err := dynamoClient.ListFilesByUploadTime(r.Context(), userID, search.uploaded, cursor, searchPageSize)
+			if err != nil {
+				writeStorageError(w, "Failed to search files", err, common.WriteDatabaseError)
+				return
+			}
+			for i := range page.Files {
+				if !search.matches(&page.Files[i]) {
+					continue
+				}
+				files = append(files, toFileMetadataResponse(&page.Files[i]))
+				if len(files) == limit {
+					if i < len(page.Files)-1 || page.Next != nil {
+						next = storage.CursorFor(&page.Files[i])
+					}
+					break read
+				}
+			}
+			if page.Next == nil || pages == maxSearchPages {
+				next = page.Next
+				break
+			}
+			cursor = page.Next
+		}
+
+		response := SearchResults{Files: files, Count: len(files)}
+		if next != nil {
+			response.NextCursor = encodeFileCursor(next)
+		}
+		common.WriteOKResponse(w, response)
+	}
+}
+
+// parseFileSearch reads a search from the request's query parameters
+func parseFileSearch(r *http.Request) (*fileSearch, int, *storage.FileCursor, []common.ValidationError) {
+	params := r.URL.Query()
+	search := &fileSearch{name: common.FilenameSearchKey(params.Get("q"))}
+	var errs []common.ValidationError
+	invalid := func(field, message string) {
+		errs = append(errs, common.ValidationError{Field: field, Code: common.ErrorCodeInvalidValue, Message: message})
+	}
+
+	if contentType := strings.ToLower(strings.TrimSpace(params.Get("content_type"))); contentType != "" {
+		if major, minor, ok := strings.Cut(contentType, "/"); !ok || major == "" || minor == "" || strings.Contains(minor, "/") {
+			invalid("content_type", "content_type must be a MIME type such as image/png, or a family such as image/*")
+		}
+		search.contentType = contentType
+	}
+
+	size := func(field string) int64 {
+		value := params.Get(field)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			invalid(field, field+" must be a non-negative number of bytes")
+			return 0
+		}
+		return n
+	}
+	search.minSize = size("min_size")
+	search.maxSize = size("max_size")
+	if search.maxSize > 0 && search.minSize > search.maxSize {
+		invalid("max_size", "max_size must not be less than min_size")
+	}
+
+	uploadTime := func(field string) time.Time {
+		value := params.Get(field)
+		if value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			invalid(field, field+" must be an RFC 3339 timestamp, e.g. 2025-01-02T15:04:05Z")
+			return time.Time{}
+		}
+		return t
+	}
+	search.uploaded.After = uploadTime("uploaded_after")
+	search.uploaded.Before = uploadTime("uploaded_before")
+	if !search.uploaded.After.IsZero() && !search.uploaded.Before.IsZero() && search.uploaded.Before.Before(search.uploaded.After) {
+		invalid("uploaded_before", "uploaded_before must not be earlier than uploaded_after")
+	}
+
+	limit := defaultSearchLimit
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			invalid("limit", fmt.Sprintf("limit must be an integer between 1 and %d", maxSearchLimit))
+		} else {
+			limit = parsed
+		}
+	}
+
+	var cursor *storage.FileCursor
+	if value := params.Get("cursor"); value != "" {
+		var err error
+		if cursor, err = decodeFileCursor(value); err != nil {
+			invalid("cursor", "cursor must be a next_cursor returned by an earlier search")
+		}
+	}
+	return search, limit, cursor, errs
+}
+
+func encodeFileCursor(cursor *storage.FileCursor) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeFileCursor(value string) (*storage.FileCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor storage.FileCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.UploadedAt == "" || cursor.FileID == "" {
+		return nil, fmt.Errorf("cursor is incomplete")
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"vibe-drop/internal/fileservice/anomaly"
+	"vibe-drop/internal/fileservice/emailverify"
+	"vibe-drop/internal/fileservice/reconcile"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// ObjectStore is the object storage the file handlers depend on.
+// storage.BlobStore covers it; tests substitute fakes.
+type ObjectStore interface {
+	GenerateUploadURL(ctx context.Context, userID, filename string, opts storage.UploadOptions) (string, string, error)
+	GenerateDownloadURL(ctx context.Context, bucket, s3Key string, opts storage.DownloadOptions) (string, error)
+	DeleteObject(ctx context.Context, bucket, s3Key string) error
+	DeleteObjects(ctx context.Context, bucket string, s3Keys []string) map[string]error
+	CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error
+	ReadObjectHeader(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error)
+	OpenObject(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error)
+	OpenObjectRange(ctx context.Context, bucket, s3Key string, offset, length int64) (io.ReadCloser, error)
+	PutObject(ctx context.Context, bucket, s3Key string, content io.ReadSeeker, size int64) error
+	ObjectChecksum(ctx context.Context, bucket, s3Key, algorithm string) (string, error)
+	BucketFor(fileID string) string
+	InitiateMultipartUpload(ctx context.Context, userID, filename string, opts storage.UploadOptions) (*storage.MultipartUploadInfo, error)
+	GenerateMultipartUploadURL(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (string, error)
+	UploadPartCopy(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int, srcBucket, srcKey string, offset, length int64) (string, error)
+	CompleteMultipartUpload(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, parts []storage.CompletedPart) error
+	ListParts(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) ([]storage.UploadedPart, error)
+	GetPart(ctx context.Context, uploadInfo *storage.MultipartUploadInfo, partNumber int) (*storage.UploadedPart, error)
+	AbortMultipartUpload(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) error
+}
+
+// MetadataStore is the file, chunk, analytics, URL audit and storage usage persistence the handlers depend on.
+// storage.MetadataStore implements it; tests substitute fakes.
+type MetadataStore interface {
+	SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error
+	GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error)
+	ListUserFiles(ctx context.Context, userID string) ([]storage.FileMetadata, error)
+	ListRecentFiles(ctx context.Context, userID string, limit int) ([]storage.FileMetadata, error)
+	ListFilesByUploadTime(ctx context.Context, userID string, uploaded storage.UploadTimeRange, after *storage.FileCursor, limit int) (*storage.FilesPage, error)
+	RecordFileAccess(ctx context.Context, fileID string) error
+	SetFileTags(ctx context.Context, fileID string, tags map[string]string) error
+	DeleteFileMetadata(ctx context.Context, fileID string) error
+	DeleteFilesMetadata(ctx context.Context, fileIDs []string) map[string]error
+	SaveFileChunk(ctx context.Context, chunk *storage.FileChunk) error
+	SaveFileChunks(ctx context.Context, chunks []storage.FileChunk) error
+	GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error)
+	DeleteFileChunks(ctx context.Context, fileID string) error
+	UpdateChunkStatus(ctx context.Context, fileID string, chunkNumber int, status string, etag string) error
+	RecordChunkURLExpiry(ctx context.Context, fileID string, chunkNumber int, expiresAt time.Time) error
+	CheckUploadComplete(ctx context.Context, fileID string) (bool, []storage.FileChunk, error)
+	ExpireFileChunks(ctx context.Context, fileID string, expiresAt time.Time) error
+	GetUserAnalytics(ctx context.Context, userID string) (*storage.UserAnalytics, error)
+	GetSystemMetrics(ctx context.Context) (*storage.SystemMetrics, error)
+	GetReconciliationReport(ctx context.Context) (*storage.ReconciliationReport, error)
+	RecordIssuedURL(ctx context.Context, issued *storage.IssuedURL) error
+	ListIssuedURLs(ctx context.Context, fileID string) ([]storage.IssuedURL, error)
+	MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error)
+	ReserveStorage(ctx context.Context, userID string, bytes, limit int64) error
+	ReleaseStorage(ctx context.Context, userID string, bytes int64) error
+	GetStorageUsage(ctx context.Context, userID string) (int64, error)
+}
+
+// ReconcileRunner runs an on-demand S3/DynamoDB reconciliation.
+// *reconcile.Reconciler implements it.
+type ReconcileRunner interface {
+	RunOnce(ctx context.Context, repair bool) (*storage.ReconciliationReport, error)
+}
+
+// AnomalyMonitor exposes the anomaly detector's detections and locks to admins.
+// *anomaly.Detector implements it.
+type AnomalyMonitor interface {
+	Events() []anomaly.Event
+	Locks() []anomaly.Lock
+	Unlock(userID string) bool
+}
+
+// TransferQueue queues ownership transfers for the background job and reports on them.
+// storage.MetadataStore implements it.
+type TransferQueue interface {
+	GetUserByID(ctx context.Context, userID string) (*storage.User, error)
+	CreateOwnershipTransfer(ctx context.Context, transfer *storage.OwnershipTransfer) error
+	GetOwnershipTransfer(ctx context.Context, transferID string) (*storage.OwnershipTransfer, error)
+}
+
+// UserStore looks users up by ID.
+// storage.MetadataStore implements it.
+type UserStore interface {
+	GetUserByID(ctx context.Context, userID string) (*storage.User, error)
+}
+
+// AdminUserStore lists and updates any account for the admin API.
+// storage.MetadataStore implements it.
+type AdminUserStore interface {
+	UserStore
+	ListUsers(ctx context.Context) ([]storage.User, error)
+	UpdateUser(ctx context.Context, user *storage.User) error
+}
+
+// InboxStore keeps users' upload by email settings.
+// storage.MetadataStore implements it.
+type InboxStore interface {
+	UserStore
+	GetInboxSettings(ctx context.Context, userID string) (*storage.InboxSettings, error)
+	SaveInboxSettings(ctx context.Context, settings *storage.InboxSettings) error
+}
+
+// UploadCallbackStore keeps the URLs API keys' completed uploads are reported to.
+// storage.MetadataStore implements it.
+type UploadCallbackStore interface {
+	GetUploadCallback(ctx context.Context, apiKeyID string) (*storage.UploadCallback, error)
+	SaveUploadCallback(ctx context.Context, callback *storage.UploadCallback) error
+	DeleteUploadCallback(ctx context.Context, apiKeyID string) error
+}
+
+// BlockManifestStore keeps files' block manifests for delta uploads.
+// storage.MetadataStore implements it.
+type BlockManifestStore interface {
+	GetBlockManifest(ctx context.Context, fileID string) (*storage.BlockManifest, error)
+	SaveBlockManifest(ctx context.Context, manifest *storage.BlockManifest) error
+}
+
+// EmailVerifier delivers the token confirming a new email address to that address.
+// *emailverify.WebhookNotifier implements it.
+type EmailVerifier interface {
+	Notify(ctx context.Context, email, token string, expiresAt time.Time) error
+}
+
+// PolicyStore persists the content type policy admins set at runtime.
+// storage.MetadataStore implements it.
+type PolicyStore interface {
+	GetContentTypePolicy(ctx context.Context) (*storage.ContentTypePolicyRecord, error)
+	SaveContentTypePolicy(ctx context.Context, record *storage.ContentTypePolicyRecord) error
+	DeleteContentTypePolicy(ctx context.Context) error
+}
+
+var (
+	_ ObjectStore     = storage.BlobStore(nil)
+	_ MetadataStore   = storage.MetadataStore(nil)
+	_ ReconcileRunner = (*reconcile.Reconciler)(nil)
+	_ AnomalyMonitor  = (*anomaly.Detector)(nil)
+	_ EmailVerifier   = (*emailverify.WebhookNotifier)(nil)
+	_ TransferQueue   = storage.MetadataStore(nil)
+	_ UserStore       = storage.MetadataStore(nil)
+	_ AdminUserStore  = storage.MetadataStore(nil)
+	_ InboxStore      = storage.MetadataStore(nil)
+	_ PolicyStore     = storage.MetadataStore(nil)
+
+	_ UploadCallbackStore = storage.MetadataStore(nil)
+	_ BlockManifestStore  = storage.MetadataStore(nil)
+)
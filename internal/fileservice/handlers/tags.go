@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"vibe-drop/internal/common"
+)
+
+// FileTagsRequest is a file's complete set of tags
+type FileTagsRequest struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// UpdateFileTagsHandler replaces the tags on one of the user's files with those given;
+// an empty set removes them all. It responds with the file's updated metadata.
+func UpdateFileTagsHandler(dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["id"]
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+
+		var req FileTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteBadRequestError(w, "Invalid JSON format", err.Error())
+			return
+		}
+		if req.Tags == nil {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "tags",
+				Code:    common.ErrorCodeFieldRequired,
+				Message: "tags is required; send {} to remove all tags",
+			}})
+			return
+		}
+		if errs := common.ValidateFileTags(req.Tags); len(errs) > 0 {
+			common.WriteValidationErrors(w, errs)
+			return
+		}
+
+		if err := dynamoClient.SetFileTags(r.Context(), fileID, req.Tags); err != nil {
+			writeStorageError(w, "Failed to update file tags", err, common.WriteDatabaseError)
+			return
+		}
+		common.Logger(r.Context()).Info("Updated file tags", "file_id", fileID, "tags", len(req.Tags))
+
+		metadata.Tags = req.Tags
+		if len(req.Tags) == 0 {
+			metadata.Tags = nil
+		}
+		common.WriteOKResponse(w, toFileMetadataResponse(metadata))
+	}
+}
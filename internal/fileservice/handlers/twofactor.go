@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// TOTPEnrollResponse is a new TOTP secret for the user's authenticator app
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`           // For typing into the app
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, to show as a QR code
+}
+
+// TOTPCodeRequest carries a code from the user's authenticator app
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPStatusResponse reports whether sign-in needs a TOTP code
+type TOTPStatusResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// EnrollTOTPHandler starts two-factor enrollment with a new secret. Sign-in doesn't need a
+// code until the first one is confirmed with VerifyTOTPHandler; enrolling again before that
+// replaces the secret.
+func EnrollTOTPHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := twoFactorUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		if user.TOTPEnabled {
+			common.WriteConflictError(w, "Two-factor authentication is already enabled", "Disable it before enrolling another authenticator")
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to generate TOTP secret", "error", err)
+			common.WriteInternalServerError(w, "Enrollment failed", "Unable to generate a secret")
+			return
+		}
+		sealed, err := authServices.TOTPBox.Seal(secret)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to encrypt TOTP secret", "error", err)
+			common.WriteInternalServerError(w, "Enrollment failed", "Unable to store the secret")
+			return
+		}
+
+		user.TOTPSecret, user.TOTPLastStep = sealed, 0
+		if err := authServices.DynamoClient.UpdateUser(r.Context(), user); err != nil {
+			common.Logger(r.Context()).Error("Failed to save TOTP enrollment", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Enrollment failed", "Unable to save the secret")
+			return
+		}
+		common.WriteOKResponse(w, TOTPEnrollResponse{
+			Secret:          secret,
+			ProvisioningURI: auth.TOTPProvisioningURI(authServices.TOTPIssuer, user.Email, secret),
+		})
+	}
+}
+
+// VerifyTOTPHandler confirms an enrollment with a code from the app and turns on
+// two-factor sign-in
+func VerifyTOTPHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := twoFactorUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		code, ok := decodeTOTPCode(w, r)
+		if !ok {
+			return
+		}
+		if user.TOTPEnabled {
+			common.WriteConflictError(w, "Two-factor authentication is already enabled", "")
+			return
+		}
+		if user.TOTPSecret == "" {
+			common.WriteConflictError(w, "No two-factor enrollment in progress", "Enroll first to get a secret")
+			return
+		}
+
+		valid, err := checkTOTP(authServices, user, code)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to check TOTP code", "user_id", user.UserID, "error", err)
+			common.WriteInternalServerError(w, "Verification failed", "Unable to check the code")
+			return
+		}
+		if !valid {
+			writeInvalidTOTPCode(w, http.StatusBadRequest)
+			return
+		}
+
+		user.TOTPEnabled = true
+		if err := authServices.DynamoClient.UpdateUser(r.Context(), user); err != nil {
+			common.Logger(r.Context()).Error("Failed to enable two-factor authentication", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Verification failed", "Unable to save the enrollment")
+			return
+		}
+		common.Logger(r.Context()).Info("Enabled two-factor authentication", "security_event", "totp_enabled", "user_id", user.UserID)
+		common.WriteOKResponse(w, TOTPStatusResponse{Enabled: true})
+	}
+}
+
+// DisableTOTPHandler turns two-factor sign-in off, given a current code. Wrong codes count
+// as failed sign-ins, so a stolen token can't be used to guess one.
+func DisableTOTPHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := twoFactorUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		code, ok := decodeTOTPCode(w, r)
+		if !ok {
+			return
+		}
+		if !user.TOTPEnabled {
+			common.WriteConflictError(w, "Two-factor authentication is not enabled", "")
+			return
+		}
+
+		address := authServices.LoginGuard.ClientAddress(r)
+		if authServices.LoginGuard != nil {
+			lock, err := authServices.LoginGuard.Check(r.Context(), user.Email, address)
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to check login lockout", "error", err)
+				writeAuthDatabaseError(w, err, "Disabling two-factor authentication failed", "Unable to check sign-in attempts")
+				return
+			}
+			if lock != nil {
+				writeLoginLocked(w, lock.Until)
+				return
+			}
+		}
+
+		valid, err := checkTOTP(authServices, user, code)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to check TOTP code", "user_id", user.UserID, "error", err)
+			common.WriteInternalServerError(w, "Disabling two-factor authentication failed", "Unable to check the code")
+			return
+		}
+		if !valid {
+			common.Logger(r.Context()).Warn("Invalid TOTP code to disable two-factor authentication", "security_event", "totp_failure",
+				"user_id", user.UserID, "client_address", address)
+			recordLoginFailure(r.Context(), authServices, user.Email, address)
+			writeInvalidTOTPCode(w, http.StatusBadRequest)
+			return
+		}
+
+		user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep = "", false, 0
+		if err := authServices.DynamoClient.UpdateUser(r.Context(), user); err != nil {
+			common.Logger(r.Context()).Error("Failed to disable two-factor authentication", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Disabling two-factor authentication failed", "Unable to save the change")
+			return
+		}
+		common.Logger(r.Context()).Warn("Disabled two-factor authentication", "security_event", "totp_disabled", "user_id", user.UserID)
+		common.WriteOKResponse(w, TOTPStatusResponse{Enabled: false})
+	}
+}
+
+// twoFactorUser loads the signed-in user, writing a 404 if two-factor authentication
+// isn't configured
+func twoFactorUser(w http.ResponseWriter, r *http.Request, authServices *AuthServices) (*storage.User, bool) {
+	if authServices.TOTPBox == nil {
+		common.WriteNotFoundError(w, "Two-factor authentication is not enabled", "TOTP_ENCRYPTION_KEY is not set on this deployment")
+		return nil, false
+	}
+	return currentUser(w, r, authServices)
+}
+
+func decodeTOTPCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		common.WriteValidationError(w, "Invalid request body", err.Error())
+		return "", false
+	}
+	if req.Code == "" {
+		common.WriteValidationErrors(w, []common.ValidationError{{
+			Field:   "code",
+			Code:    common.ErrorCodeFieldRequired,
+			Message: "code is required",
+		}})
+		return "", false
+	}
+	return req.Code, true
+}
+
+// checkTOTP reports whether code is valid for user's secret. An accepted code is recorded
+// on user, to be saved by the caller, so it can't be used again.
+func checkTOTP(authServices *AuthServices, user *storage.User, code string) (bool, error) {
+	if authServices.TOTPBox == nil {
+		return false, errors.New("TOTP_ENCRYPTION_KEY is not set")
+	}
+	secret, err := authServices.TOTPBox.Open(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := auth.VerifyTOTP(secret, code, time.Now(), user.TOTPLastStep)
+	if ok {
+		user.TOTPLastStep = step
+	}
+	return ok, nil
+}
+
+// verifyLoginTOTP checks the code sent with a sign-in and saves that it was used
+func verifyLoginTOTP(ctx context.Context, authServices *AuthServices, user *storage.User, code string) (bool, error) {
+	valid, err := checkTOTP(authServices, user, code)
+	if err != nil || !valid {
+		return valid, err
+	}
+	return true, authServices.DynamoClient.UpdateUser(ctx, user)
+}
+
+// writeInvalidTOTPCode refuses a wrong code: 401 at sign-in, 400 from a signed-in user,
+// whose token is still good
+func writeInvalidTOTPCode(w http.ResponseWriter, status int) {
+	common.WriteErrorResponse(w, status, common.ErrorCodeInvalidTOTPCode,
+		"Invalid two-factor code", "The code is wrong, expired or already used")
+}
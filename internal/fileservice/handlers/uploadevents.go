@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// UploadStatusAborted is the status an upload's events end with once its file is gone,
+// as when the upload is aborted
+const UploadStatusAborted = "aborted"
+
+// UploadProgress is how far a multipart upload has got
+type UploadProgress struct {
+	FileID         string `json:"file_id"`
+	Status         string `json:"status"` // The file's status, or "aborted"
+	TotalChunks    int    `json:"total_chunks"`
+	UploadedChunks int    `json:"uploaded_chunks"`
+	FailedChunks   int    `json:"failed_chunks"`
+	TotalBytes     int64  `json:"total_bytes"`
+	BytesUploaded  int64  `json:"bytes_uploaded"` // Total size of the uploaded chunks
+}
+
+// UploadEventsHandler reports a multipart upload's progress. A client that accepts
+// text/event-stream instead stays connected and is sent events as the upload's records
+// change, checked every poll: "progress" with the upload's new UploadProgress, "chunk"
+// with the ChunkStatus of each chunk that is uploaded or fails, and finally "end" with
+// the last UploadProgress once the upload has completed, been held back or gone. A
+// comment is sent on checks that find nothing new, so proxies keep the connection open.
+func UploadEventsHandler(dynamoClient MetadataStore, poll time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileID := mux.Vars(r)["fileId"]
+
+		metadata, ok := ownedFile(w, r, dynamoClient, fileID)
+		if !ok {
+			return
+		}
+		if metadata.UploadType != "multipart" {
+			common.WriteBadRequestError(w, "Not a multipart upload", "Only multipart uploads report progress")
+			return
+		}
+		chunks, err := sortedChunks(r.Context(), dynamoClient, fileID)
+		if err != nil {
+			writeStorageError(w, "Failed to load chunks", err, common.WriteDatabaseError)
+			return
+		}
+		list := chunkStatusList(metadata, chunks)
+		progress := uploadProgress(metadata, list)
+
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			common.WriteOKResponse(w, progress)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher := http.NewResponseController(w)
+
+		// Each chunk's last status sent, so only changes are
+		sent := make(map[int]string, len(list.Chunks))
+		for _, chunk := range list.Chunks {
+			sent[chunk.ChunkNumber] = chunk.Status
+		}
+		if uploadEnded(progress.Status) {
+			writeUploadEvent(w, "end", progress)
+			flusher.Flush()
+			return
+		}
+		writeUploadEvent(w, "progress", progress)
+
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		for {
+			if err := flusher.Flush(); err != nil {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+
+			metadata, err := dynamoClient.GetFileMetadata(r.Context(), fileID)
+			if errors.Is(err, storage.ErrNotFound) {
+				progress.Status = UploadStatusAborted
+				writeUploadEvent(w, "end", progress)
+				flusher.Flush()
+				return
+			}
+			if err == nil {
+				chunks, err = sortedChunks(r.Context(), dynamoClient, fileID)
+			}
+			if err != nil {
+				common.Logger(r.Context()).Warn("Failed to check upload progress", "file_id", fileID, "error", err)
+				fmt.Fprint(w, ": checked\n\n")
+				continue
+			}
+
+			list := chunkStatusList(metadata, chunks)
+			changed := false
+			for _, chunk := range list.Chunks {
+				if sent[chunk.ChunkNumber] == chunk.Status {
+					continue
+				}
+				sent[chunk.ChunkNumber] = chunk.Status
+				if chunk.Status != "pending" {
+					writeUploadEvent(w, "chunk", chunk)
+					changed = true
+				}
+			}
+
+			next := uploadProgress(metadata, list)
+			if uploadEnded(next.Status) {
+				writeUploadEvent(w, "end", next)
+				flusher.Flush()
+				return
+			}
+			if next != progress {
+				progress = next
+				writeUploadEvent(w, "progress", progress)
+				changed = true
+			}
+			if !changed {
+				fmt.Fprint(w, ": checked\n\n")
+			}
+		}
+	}
+}
+
+// uploadProgress totals a multipart upload's chunks. Once a compacted upload's records
+// have expired, its bytes come from the summary.
+func uploadProgress(metadata *storage.FileMetadata, list ChunkStatusList) UploadProgress {
+	progress := UploadProgress{
+		FileID:         metadata.FileID,
+		Status:         metadata.Status,
+		TotalChunks:    list.TotalChunks,
+		UploadedChunks: list.UploadedChunks,
+		TotalBytes:     metadata.TotalSize,
+	}
+	if len(list.Chunks) == 0 && list.Summary != nil {
+		progress.BytesUploaded = list.Summary.TotalSize
+	}
+	for _, chunk := range list.Chunks {
+		switch chunk.Status {
+		case "uploaded":
+			progress.BytesUploaded += chunk.Size
+		case "failed":
+			progress.FailedChunks++
+		}
+	}
+	return progress
+}
+
+// uploadEnded reports whether an upload in status will make no more progress. One whose
+// completion failed may still be completed, so its events go on.
+func uploadEnded(status string) bool {
+	return status != storage.FileStatusUploading && status != storage.FileStatusCompletionFailed
+}
+
+func writeUploadEvent(w http.ResponseWriter, event string, payload interface{}) {
+	data, _ := json.Marshal(payload)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/uploadwatch"
+)
+
+// UploadNoticeList is the signed-in user's uploads that are taking long or have stalled
+type UploadNoticeList struct {
+	Notices []uploadwatch.Notice `json:"notices"`
+}
+
+// UploadNoticesHandler lists the notices due now for the user's uploads in progress. A
+// client that accepts text/event-stream instead stays connected and gets each notice as
+// an "upload_notice" event as it comes due, checked every poll; a comment is sent on
+// every check too, so proxies keep the connection open.
+func UploadNoticesHandler(dynamoClient MetadataStore, thresholds uploadwatch.Thresholds, poll time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(w, r)
+		if !ok {
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			notices, err := userUploadNotices(r.Context(), dynamoClient, userID, thresholds)
+			if err != nil {
+				writeStorageError(w, "Failed to check uploads", err, common.WriteDatabaseError)
+				return
+			}
+			common.WriteOKResponse(w, UploadNoticeList{Notices: notices})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher := http.NewResponseController(w)
+
+		sent := make(map[string]bool)
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		for {
+			notices, err := userUploadNotices(r.Context(), dynamoClient, userID, thresholds)
+			if err != nil {
+				common.Logger(r.Context()).Warn("Failed to check uploads for notices", "error", err)
+			}
+			for _, notice := range notices {
+				if sent[notice.Key()] {
+					continue
+				}
+				sent[notice.Key()] = true
+				data, _ := json.Marshal(notice)
+				fmt.Fprintf(w, "event: upload_notice\ndata: %s\n\n", data)
+			}
+			fmt.Fprint(w, ": checked\n\n")
+			if err := flusher.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// userUploadNotices checks each of the user's uploads in progress
+func userUploadNotices(ctx context.Context, dynamoClient MetadataStore, userID string, thresholds uploadwatch.Thresholds) ([]uploadwatch.Notice, error) {
+	files, err := dynamoClient.ListUserFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	notices := []uploadwatch.Notice{}
+	now := time.Now()
+	for _, file := range files {
+		if !uploadwatch.InProgress(file) {
+			continue
+		}
+		due, err := uploadwatch.Check(ctx, dynamoClient, file, now, thresholds)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, due...)
+	}
+	return notices, nil
+}
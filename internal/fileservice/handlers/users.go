@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/janitor"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// UserProfile is the signed-in user's account
+type UserProfile struct {
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PendingEmail string `json:"pending_email,omitempty"` // Replaces Email once the token sent to it is confirmed
+	Role         string `json:"role"`                    // auth.RoleUser, or auth.RoleAdmin for the admin API
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// UpdateUserRequest changes the signed-in user's account. Fields left out are unchanged.
+type UpdateUserRequest struct {
+	Username        string `json:"username,omitempty"`
+	Email           string `json:"email,omitempty"`
+	CurrentPassword string `json:"current_password,omitempty"` // Required to change the email address
+}
+
+// VerifyEmailRequest carries the token sent to a new email address
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// DeleteAccountRequest confirms an account deletion with the user's credentials
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	TOTPCode string `json:"totp_code,omitempty"` // Required with two-factor authentication on
+}
+
+func userProfile(user *storage.User) UserProfile {
+	return UserProfile{
+		UserID:       user.UserID,
+		Username:     user.Username,
+		Email:        user.Email,
+		PendingEmail: user.PendingEmail,
+		Role:         user.RoleOrDefault(),
+		TOTPEnabled:  user.TOTPEnabled,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+	}
+}
+
+// GetCurrentUserHandler returns the signed-in user's account
+func GetCurrentUserHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		common.WriteOKResponse(w, userProfile(user))
+	}
+}
+
+// UpdateCurrentUserHandler changes the signed-in user's username or email address. A new
+// address, which needs the current password, only replaces the old one once the token sent
+// to it is confirmed with VerifyEmailHandler; until then the old address still signs in.
+// Sending the current address cancels a pending change.
+func UpdateCurrentUserHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteValidationError(w, "Invalid request body", err.Error())
+			return
+		}
+		if req.Username == "" && req.Email == "" {
+			common.WriteValidationError(w, "Nothing to update", "Send a username or email to change")
+			return
+		}
+		var validationErrors []common.ValidationError
+		if req.Username != "" {
+			validationErrors = append(validationErrors, common.ValidateUsername(req.Username)...)
+		}
+		if req.Email != "" {
+			validationErrors = append(validationErrors, common.ValidateEmail(req.Email)...)
+		}
+		if len(validationErrors) > 0 {
+			common.WriteValidationErrors(w, validationErrors)
+			return
+		}
+
+		user, ok := currentUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		if req.Username != "" {
+			user.Username = strings.TrimSpace(req.Username)
+		}
+
+		var token string
+		var expiresAt time.Time
+		email := strings.ToLower(strings.TrimSpace(req.Email))
+		switch {
+		case email == "":
+		case email == user.Email:
+			user.PendingEmail, user.EmailVerificationHash, user.EmailVerificationExpiresAt = "", "", ""
+		default:
+			if authServices.EmailVerifier == nil {
+				common.WriteForbiddenError(w, "Email changes are not enabled", "EMAIL_VERIFICATION_WEBHOOK_URL is not set on this deployment")
+				return
+			}
+			if !checkCurrentPassword(w, r, authServices, user, req.CurrentPassword, "current_password") {
+				return
+			}
+			if !emailAvailable(w, r, authServices, user, email) {
+				return
+			}
+			var hash string
+			var err error
+			token, hash, err = auth.NewRefreshToken()
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to generate email verification token", "error", err)
+				common.WriteInternalServerError(w, "Update failed", "Unable to generate a confirmation token")
+				return
+			}
+			expiresAt = time.Now().Add(authServices.EmailVerificationTTL)
+			user.PendingEmail, user.EmailVerificationHash = email, hash
+			user.EmailVerificationExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		}
+
+		if err := authServices.DynamoClient.UpdateUser(r.Context(), user); err != nil {
+			common.Logger(r.Context()).Error("Failed to update user", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Update failed", "Unable to save the changes")
+			return
+		}
+		if token != "" {
+			if err := authServices.EmailVerifier.Notify(r.Context(), email, token, expiresAt); err != nil {
+				common.Logger(r.Context()).Error("Failed to send email confirmation", "user_id", user.UserID, "error", err)
+				common.WriteErrorResponse(w, http.StatusBadGateway, common.ErrorCodeServiceUnavailable,
+					"Confirmation not sent", "The change is saved but its confirmation couldn't be sent; request it again")
+				return
+			}
+			common.Logger(r.Context()).Info("Requested email change", "security_event", "email_change_requested", "user_id", user.UserID)
+		}
+		common.WriteOKResponse(w, userProfile(user))
+	}
+}
+
+// VerifyEmailHandler confirms a pending email change with the token sent to the new
+// address, which then replaces the old one for signing in
+func VerifyEmailHandler(authServices *AuthServices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteValidationError(w, "Invalid request body", err.Error())
+			return
+		}
+		if req.Token == "" {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "token",
+				Code:    common.ErrorCodeFieldRequired,
+				Message: "token is required",
+			}})
+			return
+		}
+
+		user, ok := currentUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		if user.PendingEmail == "" {
+			common.WriteConflictError(w, "No email change in progress", "Change the email address first to get a token")
+			return
+		}
+		expiresAt, err := time.Parse(time.RFC3339, user.EmailVerificationExpiresAt)
+		if err != nil || time.Now().After(expiresAt) ||
+			subtle.ConstantTimeCompare([]byte(auth.HashRefreshToken(req.Token)), []byte(user.EmailVerificationHash)) != 1 {
+			common.WriteValidationErrors(w, []common.ValidationError{{
+				Field:   "token",
+				Code:    common.ErrorCodeInvalidValue,
+				Message: "The token is wrong or expired",
+			}})
+			return
+		}
+		// The address may have been registered since the change was requested
+		if !emailAvailable(w, r, authServices, user, user.PendingEmail) {
+			return
+		}
+
+		previous := user.Email
+		user.Email = user.PendingEmail
+		user.PendingEmail, user.EmailVerificationHash, user.EmailVerificationExpiresAt = "", "", ""
+		if err := authServices.DynamoClient.UpdateUser(r.Context(), user); err != nil {
+			if errors.Is(err, storage.ErrConditionFailed) {
+				common.WriteConflictError(w, "Email already in use", "Another account uses this email address")
+				return
+			}
+			common.Logger(r.Context()).Error("Failed to change email", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Verification failed", "Unable to save the new address")
+			return
+		}
+		common.Logger(r.Context()).Warn("Changed email address", "security_event", "email_changed",
+			"user_id", user.UserID, "previous_email", previous, "email", user.Email)
+		common.WriteOKResponse(w, userProfile(user))
+	}
+}
+
+// DeleteCurrentUserHandler deletes the signed-in user's account, given their password and,
+// with two-factor authentication on, a current code. Their files go first; if any can't be
+// deleted the account is kept, so deleting it again picks up where this left off. Wrong
+// credentials count as failed sign-ins.
+func DeleteCurrentUserHandler(authServices *AuthServices, s3Client ObjectStore, dynamoClient MetadataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			common.WriteValidationError(w, "Invalid request body", err.Error())
+			return
+		}
+
+		user, ok := currentUser(w, r, authServices)
+		if !ok {
+			return
+		}
+		if !checkCurrentPassword(w, r, authServices, user, req.Password, "password") {
+			return
+		}
+		if user.TOTPEnabled {
+			if req.TOTPCode == "" {
+				common.WriteErrorResponse(w, http.StatusBadRequest, common.ErrorCodeTOTPRequired,
+					"Two-factor code required", "Send the code from your authenticator app as totp_code")
+				return
+			}
+			valid, err := checkTOTP(authServices, user, req.TOTPCode)
+			if err != nil {
+				common.Logger(r.Context()).Error("Failed to check TOTP code", "user_id", user.UserID, "error", err)
+				common.WriteInternalServerError(w, "Account deletion failed", "Unable to check the code")
+				return
+			}
+			if !valid {
+				address := authServices.LoginGuard.ClientAddress(r)
+				common.Logger(r.Context()).Warn("Invalid TOTP code to delete account", "security_event", "totp_failure",
+					"user_id", user.UserID, "client_address", address)
+				recordLoginFailure(r.Context(), authServices, user.Email, address)
+				writeInvalidTOTPCode(w, http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := deleteUserFiles(r.Context(), s3Client, dynamoClient, user.UserID); err != nil {
+			common.Logger(r.Context()).Error("Failed to delete user's files", "user_id", user.UserID, "error", err)
+			writeStorageError(w, "Account deletion failed", err, common.WriteS3Error)
+			return
+		}
+		if err := authServices.DynamoClient.DeleteUser(r.Context(), user.UserID); err != nil {
+			common.Logger(r.Context()).Error("Failed to delete user", "user_id", user.UserID, "error", err)
+			writeAuthDatabaseError(w, err, "Account deletion failed", "Files were deleted but the account wasn't; try again")
+			return
+		}
+		common.Logger(r.Context()).Warn("Deleted account", "security_event", "account_deleted", "user_id", user.UserID, "email", user.Email)
+		common.WriteNoContentResponse(w)
+	}
+}
+
+// userObjectKey returns the key metadata's object would have under userID's prefix, which
+// for a quarantined file is its key with the quarantine/ root taken off
+func userObjectKey(userID string, metadata *storage.FileMetadata) string {
+	if metadata.Status == storage.FileStatusQuarantined && strings.HasPrefix(metadata.S3Key, storage.QuarantineKey(storage.UserKeyPrefix(userID))) {
+		return storage.ReleasedKey(metadata.S3Key)
+	}
+	return metadata.S3Key
+}
+
+// deleteUserFiles deletes every file userID owns: multipart uploads in progress are
+// aborted, and the rest have their objects deleted, then their chunk records and metadata.
+// A file whose object can't be deleted keeps its records, so it's found again on a retry.
+// An object key outside the user's prefix, or for a quarantined file their prefix under
+// quarantine/, isn't theirs to delete; only its records go.
+func deleteUserFiles(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, userID string) error {
+	files, err := dynamoClient.ListUserFiles(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	var firstErr error
+	fail := func(fileID string, err error) {
+		common.Logger(ctx).Warn("Failed to delete file of deleted account", "file_id", fileID, "error", err)
+		failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Objects are deleted per bucket, up to DeleteObjects' limit at a time
+	var removed []storage.FileMetadata
+	byBucket := make(map[string][]storage.FileMetadata)
+	for _, metadata := range files {
+		switch {
+		case metadata.Status == storage.FileStatusUploading && metadata.S3UploadID != nil:
+			if err := janitor.AbortUpload(ctx, s3Client, dynamoClient, &metadata); err != nil {
+				fail(metadata.FileID, err)
+			}
+		case storage.ValidateObjectKey(userID, userObjectKey(userID, &metadata)) != nil:
+			common.Logger(ctx).Warn("Not deleting object outside user's prefix", "file_id", metadata.FileID, "user_id", userID)
+			removed = append(removed, metadata)
+		default:
+			byBucket[metadata.Bucket] = append(byBucket[metadata.Bucket], metadata)
+		}
+	}
+	for bucket, bucketFiles := range byBucket {
+		for start := 0; start < len(bucketFiles); start += maxBatchDelete {
+			batch := bucketFiles[start:min(start+maxBatchDelete, len(bucketFiles))]
+			keys := make([]string, len(batch))
+			for i, metadata := range batch {
+				keys[i] = metadata.S3Key
+			}
+			objectErrors := s3Client.DeleteObjects(ctx, bucket, keys)
+			for _, metadata := range batch {
+				if err, ok := objectErrors[metadata.S3Key]; ok {
+					fail(metadata.FileID, err)
+					continue
+				}
+				removed = append(removed, metadata)
+			}
+		}
+	}
+
+	// Chunk records go before the metadata that leads a retry to them
+	var removedIDs []string
+	var released int64
+	sizes := make(map[string]int64, len(removed))
+	for _, metadata := range removed {
+		if metadata.UploadType == "multipart" {
+			if err := dynamoClient.DeleteFileChunks(ctx, metadata.FileID); err != nil {
+				fail(metadata.FileID, err)
+				continue
+			}
+		}
+		removedIDs = append(removedIDs, metadata.FileID)
+		sizes[metadata.FileID] = metadata.TotalSize
+		released += metadata.TotalSize
+	}
+	for start := 0; start < len(removedIDs); start += maxBatchDelete {
+		batch := removedIDs[start:min(start+maxBatchDelete, len(removedIDs))]
+		for fileID, err := range dynamoClient.DeleteFilesMetadata(ctx, batch) {
+			fail(fileID, err)
+			released -= sizes[fileID]
+		}
+	}
+	if released > 0 {
+		releaseStorage(ctx, dynamoClient, userID, released)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files not deleted: %w", failed, len(files), firstErr)
+	}
+	return nil
+}
+
+// currentUser loads the signed-in user
+func currentUser(w http.ResponseWriter, r *http.Request, authServices *AuthServices) (*storage.User, bool) {
+	userID, ok := requestUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	user, err := authServices.DynamoClient.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			common.WriteNotFoundError(w, "User not found", "User ID: "+userID+" does not exist")
+			return nil, false
+		}
+		common.Logger(r.Context()).Error("Failed to load user", "user_id", userID, "error", err)
+		writeAuthDatabaseError(w, err, "Failed to load user", "Unable to look up account")
+		return nil, false
+	}
+	return user, true
+}
+
+// checkCurrentPassword checks a signed-in user's password, sent in field, writing a 400 if
+// it's missing or wrong; the token is still good. Wrong passwords count as failed sign-ins,
+// so a stolen token can't be used to guess one.
+func checkCurrentPassword(w http.ResponseWriter, r *http.Request, authServices *AuthServices, user *storage.User, password, field string) bool {
+	if password == "" {
+		common.WriteValidationErrors(w, []common.ValidationError{{
+			Field:   field,
+			Code:    common.ErrorCodePasswordRequired,
+			Message: "The current password is required",
+		}})
+		return false
+	}
+
+	address := authServices.LoginGuard.ClientAddress(r)
+	if authServices.LoginGuard != nil {
+		lock, err := authServices.LoginGuard.Check(r.Context(), user.Email, address)
+		if err != nil {
+			common.Logger(r.Context()).Error("Failed to check login lockout", "error", err)
+			writeAuthDatabaseError(w, err, "Password check failed", "Unable to check sign-in attempts")
+			return false
+		}
+		if lock != nil {
+			writeLoginLocked(w, lock.Until)
+			return false
+		}
+	}
+
+	if err := authServices.PasswordService.VerifyPassword(user.PasswordHash, password); err != nil {
+		common.Logger(r.Context()).Warn("Invalid password from signed-in user", "security_event", "password_failure",
+			"user_id", user.UserID, "client_address", address)
+		recordLoginFailure(r.Context(), authServices, user.Email, address)
+		common.WriteValidationErrors(w, []common.ValidationError{{
+			Field:   field,
+			Code:    common.ErrorCodeInvalidValue,
+			Message: "The password is incorrect",
+		}})
+		return false
+	}
+	return true
+}
+
+// emailAvailable reports whether no other account uses email, writing a 409 if one does
+func emailAvailable(w http.ResponseWriter, r *http.Request, authServices *AuthServices, user *storage.User, email string) bool {
+	existing, err := authServices.DynamoClient.GetUserByEmail(r.Context(), email)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return true
+	case err != nil:
+		common.Logger(r.Context()).Error("Failed to look up user by email", "error", err)
+		writeAuthDatabaseError(w, err, "Email check failed", "Unable to check for an existing account")
+		return false
+	case existing.UserID != user.UserID:
+		common.WriteConflictError(w, "Email already in use", "Another account uses this email address")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+func TestDeleteUserFiles(t *testing.T) {
+	single := singleFile()
+	uploading := multipartFile()
+	uploading.TotalSize = 2048
+	completed := &storage.FileMetadata{FileID: "file-3", Filename: "archive.zip", TotalSize: 4096, UploadType: "multipart",
+		Status: storage.FileStatusCompleted, UserID: testUser, S3Key: storage.ObjectKey(testUser, "file-3", "archive.zip")}
+	others := &storage.FileMetadata{FileID: "file-4", UserID: "user-2", S3Key: storage.ObjectKey("user-2", "file-4", "notes.txt")}
+	quarantined := &storage.FileMetadata{FileID: "file-5", Filename: "setup.exe", TotalSize: 512, UploadType: "single",
+		Status: storage.FileStatusQuarantined, UserID: testUser, S3Key: storage.QuarantineKey(storage.ObjectKey(testUser, "file-5", "setup.exe"))}
+	db := newFakeMetadataStore(single, uploading, completed, others, quarantined)
+	db.chunks["file-2"] = []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1}}
+	db.chunks["file-3"] = []storage.FileChunk{{FileID: "file-3", ChunkNumber: 1}}
+	db.usage[testUser] = 1024 + 2048 + 4096 + 512
+
+	var aborted int
+	deleted := make(map[string]bool)
+	objectsDown := true
+	s3 := &fakeObjectStore{
+		abortMultipartUpload: func(context.Context, *storage.MultipartUploadInfo) error {
+			aborted++
+			return nil
+		},
+		deleteObjects: func(_ context.Context, _ string, s3Keys []string) map[string]error {
+			failed := make(map[string]error)
+			for _, s3Key := range s3Keys {
+				switch {
+				case s3Key == others.S3Key:
+					t.Error("deleted another user's object")
+				case s3Key == completed.S3Key && objectsDown:
+					failed[s3Key] = errors.New("InternalError")
+				default:
+					deleted[s3Key] = true
+				}
+			}
+			return failed
+		},
+	}
+
+	// A file whose object can't be deleted keeps its records for a retry
+	if err := deleteUserFiles(context.Background(), s3, db, testUser); err == nil {
+		t.Fatal("deleteUserFiles succeeded with an object left")
+	}
+	if aborted != 1 || db.files["file-1"] != nil || db.files["file-2"] != nil || db.chunks["file-2"] != nil {
+		t.Errorf("after first pass: %d aborted, files %v", aborted, db.files)
+	}
+	if db.files["file-3"] == nil || db.chunks["file-3"] == nil {
+		t.Error("file-3's records were deleted with its object still there")
+	}
+	if !deleted[quarantined.S3Key] || db.files["file-5"] != nil {
+		t.Error("quarantined file-5 wasn't deleted with its object")
+	}
+	if used := db.usage[testUser]; used != 4096 {
+		t.Errorf("usage after first pass = %d, want 4096", used)
+	}
+
+	objectsDown = false
+	if err := deleteUserFiles(context.Background(), s3, db, testUser); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(db.files) != 1 || db.files["file-4"] == nil || len(db.chunks) != 0 || db.usage[testUser] != 0 {
+		t.Errorf("after retry: files %v, chunks %v, %d bytes used", db.files, db.chunks, db.usage[testUser])
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// checkScanned reports whether a file has been scanned clean, writing the error if not. A
+// completed file that was never queued, such as one stored before scanning was enabled,
+// is queued now.
+func checkScanned(ctx context.Context, w http.ResponseWriter, dynamoClient MetadataStore, scans scan.Policy, metadata *storage.FileMetadata) bool {
+	switch metadata.ScanStatus {
+	case storage.ScanStatusClean:
+		return true
+	case storage.ScanStatusInfected:
+		common.WriteErrorResponse(w, http.StatusForbidden, common.ErrorCodeFileInfected, "File infected",
+			fmt.Sprintf("A virus scan found %s in this file", metadata.ScanSignature))
+		return false
+	case "":
+		if metadata.Status == storage.FileStatusCompleted {
+			scan.Enqueue(metadata)
+			if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+				common.Logger(ctx).Warn("Failed to queue file for a virus scan", "file_id", metadata.FileID, "error", err)
+			}
+		}
+	}
+
+	if retryAfter := scans.RetryAfter(); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	common.WriteErrorResponse(w, http.StatusConflict, common.ErrorCodeScanPending, "Virus scan pending",
+		"The file can be downloaded once a virus scan has found it clean; try again shortly")
+	return false
+}
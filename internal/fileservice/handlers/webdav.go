@@ -0,0 +1,684 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/callbacks"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// WebDAVPath is where the file service serves each user's files as a WebDAV drive
+const WebDAVPath = "/dav"
+
+const (
+	// maxWebDAVPutBytes is the largest file the drive takes, what S3 stores in one PUT;
+	// larger files need the API's multipart upload
+	maxWebDAVPutBytes = multipartChunkSize
+
+	// webDAVLockTimeout is how long the drive says a lock lasts
+	webDAVLockTimeout = time.Hour
+
+	// webDAVMethods are the methods the drive answers
+	webDAVMethods = "OPTIONS, PROPFIND, PROPPATCH, GET, HEAD, PUT, DELETE, LOCK, UNLOCK"
+)
+
+// webDAVDrive serves a user's files as one folder: the drive has no subfolders, since
+// files have none. Each name is listed once, as its latest version.
+type webDAVDrive struct {
+	s3Client     ObjectStore
+	dynamoClient MetadataStore
+	policies     *ContentTypePolicies
+	executables  quarantine.Policy
+	scans        scan.Policy
+	quotaBytes   int64
+
+	uploadCallbacks *callbacks.Notifier // Told of files stored with an API key (the S3-compatible API's)
+	bus             events.Publisher    // Receives file.uploaded and file.deleted
+}
+
+// WebDAVHandler serves the signed-in user's files under WebDAVPath, so they can be mounted
+// as a network drive. PROPFIND lists them, GET reads one, PUT stores one and DELETE removes
+// one. Reads need the files:read scope and changes files:write. Uploads are checked like
+// API uploads: against the content type policy, the storage quota of quotaBytes and the
+// executable policy, and they are queued for a virus scan. Stored and deleted files are
+// published to bus. Locks are granted, which Finder needs before it mounts a drive
+// writable, but not enforced.
+func WebDAVHandler(s3Client ObjectStore, dynamoClient MetadataStore, policies *ContentTypePolicies, executables quarantine.Policy, scans scan.Policy, quotaBytes int64, bus events.Publisher) http.Handler {
+	drive := &webDAVDrive{
+		s3Client:     s3Client,
+		dynamoClient: dynamoClient,
+		policies:     policies,
+		executables:  executables,
+		scans:        scans,
+		quotaBytes:   quotaBytes,
+		bus:          bus,
+	}
+	read := auth.RequireScope(auth.ScopeFilesRead)
+	write := auth.RequireScope(auth.ScopeFilesWrite)
+	methods := map[string]http.Handler{
+		http.MethodOptions: http.HandlerFunc(drive.options),
+		"PROPFIND":         read(http.HandlerFunc(drive.propfind)),
+		http.MethodGet:     read(http.HandlerFunc(drive.get)),
+		http.MethodHead:    read(http.HandlerFunc(drive.get)),
+		http.MethodPut:     write(http.HandlerFunc(drive.put)),
+		http.MethodDelete:  write(http.HandlerFunc(drive.delete)),
+		"PROPPATCH":        write(http.HandlerFunc(drive.proppatch)),
+		"LOCK":             write(http.HandlerFunc(drive.lock)),
+		"UNLOCK":           write(http.HandlerFunc(drive.unlock)),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := methods[r.Method]
+		if !ok {
+			w.Header().Set("Allow", webDAVMethods)
+			common.WriteErrorResponse(w, http.StatusMethodNotAllowed, common.ErrorCodeMethodNotAllowed,
+				"Method not supported", "The drive has no folders and doesn't move or copy files; use the API to rename them")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// davName returns the file name a request path names, "" for the drive itself. Paths
+// into folders name nothing, since there are none.
+func davName(urlPath string) (string, bool) {
+	name := strings.Trim(strings.TrimPrefix(urlPath, WebDAVPath), "/")
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	return common.NormalizeFilename(name), true
+}
+
+// davHref is the path a file is served at, or the drive's own for ""
+func davHref(name string) string {
+	return (&url.URL{Path: WebDAVPath + "/" + name}).EscapedPath()
+}
+
+// davETag identifies a file's content: storing new content gives the file a new ID
+func davETag(metadata *storage.FileMetadata) string {
+	return `"` + metadata.FileID + `"`
+}
+
+// driveFiles returns the user's files as the drive shows them, by name: the latest version
+// of each, leaving out multipart uploads that haven't completed
+func driveFiles(files []storage.FileMetadata) map[string]*storage.FileMetadata {
+	latest := make(map[string]*storage.FileMetadata, len(files))
+	for i := range files {
+		file := &files[i]
+		if file.UploadType == "multipart" && (file.Status == storage.FileStatusUploading || file.Status == storage.FileStatusCompletionFailed) {
+			continue
+		}
+		name := common.NormalizeFilename(file.Filename)
+		if current, ok := latest[name]; !ok || fileVersion(file) > fileVersion(current) {
+			latest[name] = file
+		}
+	}
+	return latest
+}
+
+// userDriveFiles loads the signed-in user's files as the drive shows them
+func (d *webDAVDrive) userDriveFiles(w http.ResponseWriter, r *http.Request) (string, map[string]*storage.FileMetadata, bool) {
+	userID, ok := requestUser(w, r)
+	if !ok {
+		return "", nil, false
+	}
+	files, err := d.dynamoClient.ListUserFiles(r.Context(), userID)
+	if err != nil {
+		writeStorageError(w, "Failed to list files", err, common.WriteDatabaseError)
+		return "", nil, false
+	}
+	return userID, driveFiles(files), true
+}
+
+// driveFile looks up the file a request names, writing a 404 if there is none
+func (d *webDAVDrive) driveFile(w http.ResponseWriter, r *http.Request) (*storage.FileMetadata, bool) {
+	name, ok := davName(r.URL.Path)
+	if !ok || name == "" {
+		common.WriteNotFoundError(w, "File not found", "The drive has no folders")
+		return nil, false
+	}
+	_, files, ok := d.userDriveFiles(w, r)
+	if !ok {
+		return nil, false
+	}
+	file, ok := files[name]
+	if !ok {
+		common.WriteNotFoundError(w, "File not found", fmt.Sprintf("No file is named %s", name))
+		return nil, false
+	}
+	return file, true
+}
+
+func (d *webDAVDrive) options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("MS-Author-Via", "DAV") // Windows won't write to the drive without it
+	w.Header().Set("Allow", webDAVMethods)
+	w.WriteHeader(http.StatusOK)
+}
+
+// get serves a file's content, refused as a download URL would be for quarantined,
+// corrupt or unscanned files
+func (d *webDAVDrive) get(w http.ResponseWriter, r *http.Request) {
+	if name, ok := davName(r.URL.Path); ok && name == "" {
+		w.Header().Set("Allow", webDAVMethods)
+		common.WriteErrorResponse(w, http.StatusMethodNotAllowed, common.ErrorCodeMethodNotAllowed,
+			"Method not supported", "Use PROPFIND to list the drive")
+		return
+	}
+	metadata, ok := d.driveFile(w, r)
+	if !ok {
+		return
+	}
+	if !screenDownload(w, r, d.s3Client, d.dynamoClient, d.executables, d.scans, metadata) {
+		return
+	}
+
+	w.Header().Set("Content-Type", common.DetectContentType(metadata.Filename, metadata.ContentType))
+	w.Header().Set("Content-Length", strconv.FormatInt(metadata.TotalSize, 10))
+	w.Header().Set("ETag", davETag(metadata))
+	w.Header().Set("Last-Modified", fileModified(metadata).Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	content, err := d.s3Client.OpenObject(r.Context(), metadata.Bucket, metadata.S3Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			common.WriteConflictError(w, "Upload not finished", "The file's content hasn't been uploaded yet")
+			return
+		}
+		writeStorageError(w, "Failed to read file", err, common.WriteS3Error)
+		return
+	}
+	defer content.Close()
+
+	if err := d.dynamoClient.RecordFileAccess(r.Context(), metadata.FileID); err != nil {
+		common.Logger(r.Context()).Warn("Failed to record access", "file_id", metadata.FileID, "error", err)
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		common.Logger(r.Context()).Warn("Failed to send file", "file_id", metadata.FileID, "error", err)
+	}
+}
+
+// put stores a file. Over an existing name, the new content replaces the version the
+// drive shows, keeping its version number and tags; older versions are left alone. The
+// body is staged on local disk first, since clients such as Finder don't say how long it
+// is and S3 needs to know.
+func (d *webDAVDrive) put(w http.ResponseWriter, r *http.Request) {
+	name, ok := davName(r.URL.Path)
+	if !ok || name == "" {
+		common.WriteConflictError(w, "Cannot store a file here", "The drive has no folders")
+		return
+	}
+	if errs := common.ValidateFilename(name); len(errs) > 0 {
+		common.WriteValidationErrors(w, errs)
+		return
+	}
+
+	staged, err := os.CreateTemp("", "vibe-drop-webdav-")
+	if err != nil {
+		common.Logger(r.Context()).Error("Failed to stage upload", "error", err)
+		common.WriteInternalServerError(w, "Failed to store file", "Unable to stage the upload")
+		return
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	size, err := io.Copy(staged, io.LimitReader(r.Body, maxWebDAVPutBytes+1))
+	if err != nil {
+		common.WriteBadRequestError(w, "Failed to read file", err.Error())
+		return
+	}
+	if size > maxWebDAVPutBytes {
+		common.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, common.ErrorCodeFileTooLarge, "File too large",
+			fmt.Sprintf("The drive takes files of up to %d bytes; upload larger ones through the API", int64(maxWebDAVPutBytes)))
+		return
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		common.WriteInternalServerError(w, "Failed to store file", err.Error())
+		return
+	}
+
+	metadata, replaced, ok := d.store(w, r, name, staged, size)
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", davETag(metadata))
+	if replaced == nil {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// store saves content as the file name, returning it and the version it replaced, if any,
+// which is then removed. It writes the response to a refused or failed upload.
+func (d *webDAVDrive) store(w http.ResponseWriter, r *http.Request, name string, content io.ReadSeeker, size int64) (*storage.FileMetadata, *storage.FileMetadata, bool) {
+	// Clients send whatever type they like, so it comes from the extension as for API uploads
+	contentType := common.DetectContentType(name, "")
+	current, err := d.policies.Current(r.Context())
+	if err != nil {
+		writeStorageError(w, "Failed to load content type policy", err, common.WriteDatabaseError)
+		return nil, nil, false
+	}
+	if policyErrs := current.Policy.Check(contentType, size); len(policyErrs) > 0 {
+		common.WriteValidationErrors(w, policyErrs)
+		return nil, nil, false
+	}
+
+	userID, files, ok := d.userDriveFiles(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	replaced := files[name]
+	if err := d.dynamoClient.ReserveStorage(r.Context(), userID, size, d.quotaBytes); err != nil {
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			common.WriteErrorResponse(w, http.StatusInsufficientStorage, common.ErrorCodeQuotaExceeded, "Storage quota exceeded",
+				fmt.Sprintf("Storing %d bytes would exceed your %d byte quota; delete files to free space", size, d.quotaBytes))
+			return nil, nil, false
+		}
+		writeStorageError(w, "Failed to check storage quota", err, common.WriteDatabaseError)
+		return nil, nil, false
+	}
+
+	fileID := uuid.New().String()
+	metadata := &storage.FileMetadata{
+		FileID:      fileID,
+		Filename:    name,
+		TotalSize:   size,
+		ContentType: contentType,
+		Status:      storage.FileStatusUploading,
+		UploadType:  "single",
+		UploadedAt:  time.Now().Format(time.RFC3339),
+		UserID:      userID,
+		S3Key:       storage.ObjectKey(userID, fileID, name),
+		Bucket:      d.s3Client.BucketFor(fileID),
+		Client:      common.ClientInfoFromContext(r.Context()),
+	}
+	metadata.APIKeyID, _ = auth.GetAPIKeyIDFromContext(r.Context())
+	if replaced != nil {
+		metadata.Version = replaced.Version
+		metadata.PreviousVersionID = replaced.PreviousVersionID
+		metadata.Tags = replaced.Tags
+	}
+	if err := d.s3Client.PutObject(r.Context(), metadata.Bucket, metadata.S3Key, content, size); err != nil {
+		releaseStorage(r.Context(), d.dynamoClient, userID, size)
+		writeStorageError(w, "Failed to store file", err, common.WriteS3Error)
+		return nil, nil, false
+	}
+
+	// The content is all there, so the file is finished here rather than on first download
+	reason, err := quarantine.Screen(r.Context(), d.s3Client, d.dynamoClient, d.executables, metadata)
+	if err == nil && reason == "" {
+		metadata.Status = storage.FileStatusCompleted
+		metadata.CompletedAt = &[]string{time.Now().Format(time.RFC3339)}[0]
+		if d.scans.Enabled() {
+			scan.Enqueue(metadata)
+		}
+		err = d.dynamoClient.SaveFileMetadata(r.Context(), metadata)
+	}
+	if err != nil {
+		common.Logger(r.Context()).Error("Failed to save stored file", "file_id", fileID, "error", err)
+		if deleteErr := d.s3Client.DeleteObject(r.Context(), metadata.Bucket, metadata.S3Key); deleteErr != nil {
+			common.Logger(r.Context()).Warn("Failed to delete unsaved file's content", "file_id", fileID, "error", deleteErr)
+		}
+		releaseStorage(r.Context(), d.dynamoClient, userID, size)
+		writeStorageError(w, "Failed to store file", err, common.WriteDatabaseError)
+		return nil, nil, false
+	}
+	if reason != "" {
+		// The file is kept for an admin to review; any version it would replace stays
+		writeQuarantinedError(w, metadata)
+		return nil, nil, false
+	}
+	if replaced != nil {
+		d.remove(r, replaced)
+	}
+	d.uploadCallbacks.UploadCompleted(r.Context(), metadata)
+	publish(r.Context(), d.bus, events.FileUploaded(metadata))
+	return metadata, replaced, true
+}
+
+// delete removes a file: every version of it, since the drive would otherwise show the
+// one before
+func (d *webDAVDrive) delete(w http.ResponseWriter, r *http.Request) {
+	name, ok := davName(r.URL.Path)
+	if ok && name == "" {
+		common.WriteForbiddenError(w, "Cannot delete the drive", "Delete the files in it instead")
+		return
+	}
+	if !ok {
+		common.WriteNotFoundError(w, "File not found", "The drive has no folders")
+		return
+	}
+	userID, ok := requestUser(w, r)
+	if !ok {
+		return
+	}
+	files, err := d.dynamoClient.ListUserFiles(r.Context(), userID)
+	if err != nil {
+		writeStorageError(w, "Failed to list files", err, common.WriteDatabaseError)
+		return
+	}
+	if _, ok := driveFiles(files)[name]; !ok {
+		common.WriteNotFoundError(w, "File not found", fmt.Sprintf("No file is named %s", name))
+		return
+	}
+	if d.deleteVersions(w, r, files, name) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteVersions deletes every version among files of the file name, writing the response
+// if one can't be deleted
+func (d *webDAVDrive) deleteVersions(w http.ResponseWriter, r *http.Request, files []storage.FileMetadata, name string) bool {
+	for i := range files {
+		file := &files[i]
+		if common.NormalizeFilename(file.Filename) != name {
+			continue
+		}
+		if err := d.s3Client.DeleteObject(r.Context(), file.Bucket, file.S3Key); err != nil {
+			common.Logger(r.Context()).Error("Failed to delete S3 object", "file_id", file.FileID, "s3_key", file.S3Key, "error", err)
+			writeStorageError(w, "Failed to delete file from storage", err, common.WriteS3Error)
+			return false
+		}
+		if err := d.dynamoClient.DeleteFileMetadata(r.Context(), file.FileID); err != nil {
+			common.Logger(r.Context()).Warn("S3 object deleted but metadata cleanup failed", "file_id", file.FileID, "error", err)
+			writeStorageError(w, "File deleted but metadata cleanup failed", err, common.WriteDatabaseError)
+			return false
+		}
+		releaseStorage(r.Context(), d.dynamoClient, file.UserID, file.TotalSize)
+		publish(r.Context(), d.bus, events.FileDeleted(file))
+	}
+	return true
+}
+
+// remove deletes a file whose content has been replaced. The new version is already
+// saved, so failures are only logged; the reconciler finds any object left behind.
+func (d *webDAVDrive) remove(r *http.Request, metadata *storage.FileMetadata) {
+	if err := d.s3Client.DeleteObject(r.Context(), metadata.Bucket, metadata.S3Key); err != nil {
+		common.Logger(r.Context()).Warn("Failed to delete replaced file's content", "file_id", metadata.FileID, "error", err)
+	}
+	if err := d.dynamoClient.DeleteFileMetadata(r.Context(), metadata.FileID); err != nil {
+		common.Logger(r.Context()).Warn("Failed to delete replaced file", "file_id", metadata.FileID, "error", err)
+		return
+	}
+	releaseStorage(r.Context(), d.dynamoClient, metadata.UserID, metadata.TotalSize)
+	publish(r.Context(), d.bus, events.FileDeleted(metadata))
+}
+
+// davPropNames are the properties named in a PROPFIND or PROPPATCH
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type propfindRequest struct {
+	XMLName  xml.Name      `xml:"DAV: propfind"`
+	AllProp  *struct{}     `xml:"DAV: allprop"`
+	PropName *struct{}     `xml:"DAV: propname"`
+	Prop     *davPropNames `xml:"DAV: prop"`
+}
+
+type proppatchRequest struct {
+	XMLName xml.Name       `xml:"DAV: propertyupdate"`
+	Set     []davPropNames `xml:"DAV: set>prop"`
+	Remove  []davPropNames `xml:"DAV: remove>prop"`
+}
+
+// davResource is the drive or a file, with the live properties it has as XML, by name in
+// the DAV: namespace
+type davResource struct {
+	href  string
+	props map[string]string
+}
+
+// Properties allprop leaves out, as RFC 4331 asks of the quota properties
+var davQuotaProps = map[string]bool{"quota-used-bytes": true, "quota-available-bytes": true}
+
+const davSupportedLock = "<D:lockentry><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockentry>"
+
+// propfind lists the drive and its files, or describes one file. The drive is flat, so
+// any depth but 0 lists every file.
+func (d *webDAVDrive) propfind(w http.ResponseWriter, r *http.Request) {
+	name, ok := davName(r.URL.Path)
+	if !ok {
+		common.WriteNotFoundError(w, "File not found", "The drive has no folders")
+		return
+	}
+	var req propfindRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.WriteBadRequestError(w, "Invalid PROPFIND body", err.Error())
+		return
+	}
+
+	userID, files, ok := d.userDriveFiles(w, r)
+	if !ok {
+		return
+	}
+	var resources []davResource
+	if name != "" {
+		file, ok := files[name]
+		if !ok {
+			common.WriteNotFoundError(w, "File not found", fmt.Sprintf("No file is named %s", name))
+			return
+		}
+		resources = append(resources, fileResource(file))
+	} else {
+		drive, err := d.driveResource(r, userID)
+		if err != nil {
+			writeStorageError(w, "Failed to load storage usage", err, common.WriteDatabaseError)
+			return
+		}
+		resources = append(resources, drive)
+		if r.Header.Get("Depth") != "0" {
+			names := make([]string, 0, len(files))
+			for name := range files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				resources = append(resources, fileResource(files[name]))
+			}
+		}
+	}
+
+	var body strings.Builder
+	for _, resource := range resources {
+		body.WriteString("<D:response><D:href>" + davEscape(resource.href) + "</D:href>")
+		switch {
+		case req.PropName != nil:
+			var names strings.Builder
+			for _, name := range sortedProps(resource.props) {
+				names.WriteString("<D:" + name + "/>")
+			}
+			writePropstat(&body, names.String(), http.StatusOK)
+		case req.Prop != nil:
+			var found, missing strings.Builder
+			for _, prop := range req.Prop.Names {
+				value, ok := resource.props[prop.XMLName.Local]
+				if prop.XMLName.Space != "DAV:" || !ok {
+					missing.WriteString(davEmptyElement(prop.XMLName))
+					continue
+				}
+				found.WriteString("<D:" + prop.XMLName.Local + ">" + value + "</D:" + prop.XMLName.Local + ">")
+			}
+			writePropstat(&body, found.String(), http.StatusOK)
+			writePropstat(&body, missing.String(), http.StatusNotFound)
+		default:
+			var all strings.Builder
+			for _, name := range sortedProps(resource.props) {
+				if !davQuotaProps[name] {
+					all.WriteString("<D:" + name + ">" + resource.props[name] + "</D:" + name + ">")
+				}
+			}
+			writePropstat(&body, all.String(), http.StatusOK)
+		}
+		body.WriteString("</D:response>")
+	}
+	writeMultistatus(w, body.String())
+}
+
+// driveResource describes the drive, with the user's storage use and what's left of their quota
+func (d *webDAVDrive) driveResource(r *http.Request, userID string) (davResource, error) {
+	used, err := d.dynamoClient.GetStorageUsage(r.Context(), userID)
+	if err != nil {
+		return davResource{}, err
+	}
+	props := map[string]string{
+		"resourcetype":     "<D:collection/>",
+		"displayname":      "Vibe-Drop",
+		"supportedlock":    davSupportedLock,
+		"lockdiscovery":    "",
+		"quota-used-bytes": strconv.FormatInt(used, 10),
+	}
+	if d.quotaBytes > 0 {
+		props["quota-available-bytes"] = strconv.FormatInt(max(d.quotaBytes-used, 0), 10)
+	}
+	return davResource{href: davHref(""), props: props}, nil
+}
+
+func fileResource(metadata *storage.FileMetadata) davResource {
+	uploaded := parseTime(metadata.UploadedAt)
+	return davResource{href: davHref(metadata.Filename), props: map[string]string{
+		"resourcetype":     "",
+		"displayname":      davEscape(metadata.Filename),
+		"getcontentlength": strconv.FormatInt(metadata.TotalSize, 10),
+		"getcontenttype":   davEscape(common.DetectContentType(metadata.Filename, metadata.ContentType)),
+		"getlastmodified":  fileModified(metadata).Format(http.TimeFormat),
+		"creationdate":     uploaded.UTC().Format(time.RFC3339),
+		"getetag":          davEscape(davETag(metadata)),
+		"supportedlock":    davSupportedLock,
+		"lockdiscovery":    "",
+	}}
+}
+
+// fileModified is when a file's content was last stored
+func fileModified(metadata *storage.FileMetadata) time.Time {
+	if metadata.CompletedAt != nil {
+		return parseTime(*metadata.CompletedAt).UTC()
+	}
+	return parseTime(metadata.UploadedAt).UTC()
+}
+
+// proppatch refuses to set or remove properties, which the drive doesn't store. Windows
+// sets its file times this way after copying a file and carries on when refused.
+func (d *webDAVDrive) proppatch(w http.ResponseWriter, r *http.Request) {
+	metadata, ok := d.driveFile(w, r)
+	if !ok {
+		return
+	}
+	var req proppatchRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		common.WriteBadRequestError(w, "Invalid PROPPATCH body", err.Error())
+		return
+	}
+	var refused strings.Builder
+	for _, props := range append(req.Set, req.Remove...) {
+		for _, prop := range props.Names {
+			refused.WriteString(davEmptyElement(prop.XMLName))
+		}
+	}
+
+	var body strings.Builder
+	body.WriteString("<D:response><D:href>" + davEscape(davHref(metadata.Filename)) + "</D:href>")
+	writePropstat(&body, refused.String(), http.StatusForbidden)
+	body.WriteString("</D:response>")
+	writeMultistatus(w, body.String())
+}
+
+// lockTokenPattern finds the lock token a lock refresh names in its If header
+var lockTokenPattern = regexp.MustCompile(`<(opaquelocktoken:[^>]+)>`)
+
+// lock grants an exclusive write lock, or refreshes one. Locks aren't recorded, so they
+// don't stop anyone else writing; Finder only mounts a drive writable if it can lock.
+func (d *webDAVDrive) lock(w http.ResponseWriter, r *http.Request) {
+	name, ok := davName(r.URL.Path)
+	if !ok {
+		common.WriteNotFoundError(w, "File not found", "The drive has no folders")
+		return
+	}
+	token := ""
+	if match := lockTokenPattern.FindStringSubmatch(r.Header.Get("If")); match != nil {
+		token = match[1]
+	} else {
+		token = "opaquelocktoken:" + uuid.New().String()
+		w.Header().Set("Lock-Token", "<"+token+">")
+	}
+
+	depth := "0"
+	if name == "" {
+		depth = "infinity"
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `%s<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>`+
+		`<D:depth>%s</D:depth><D:timeout>Second-%d</D:timeout>`+
+		`<D:locktoken><D:href>%s</D:href></D:locktoken><D:lockroot><D:href>%s</D:href></D:lockroot>`+
+		`</D:activelock></D:lockdiscovery></D:prop>`,
+		xml.Header, depth, int(webDAVLockTimeout.Seconds()), davEscape(token), davEscape(davHref(name)))
+}
+
+// unlock releases a lock, which there is nothing to do for
+func (d *webDAVDrive) unlock(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writePropstat adds a propstat of props with status, if there are any
+func writePropstat(body *strings.Builder, props string, status int) {
+	if props == "" {
+		return
+	}
+	body.WriteString("<D:propstat><D:prop>" + props + "</D:prop>")
+	body.WriteString(fmt.Sprintf("<D:status>HTTP/1.1 %d %s</D:status></D:propstat>", status, http.StatusText(status)))
+}
+
+func writeMultistatus(w http.ResponseWriter, responses string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header+`<D:multistatus xmlns:D="DAV:">`+responses+"</D:multistatus>")
+}
+
+// davEmptyElement writes a property name back, in its own namespace
+func davEmptyElement(name xml.Name) string {
+	if name.Space == "DAV:" {
+		return "<D:" + name.Local + "/>"
+	}
+	return `<x:` + name.Local + ` xmlns:x="` + davEscape(name.Space) + `"/>`
+}
+
+func davEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func sortedProps(props map[string]string) []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// memoryObjects stubs a fake object store's reads and writes with a map of content by key
+func memoryObjects() (*fakeObjectStore, map[string]string) {
+	objects := make(map[string]string)
+	s3 := &fakeObjectStore{
+		putObject: func(ctx context.Context, bucket, s3Key string, content io.ReadSeeker, size int64) error {
+			data, err := io.ReadAll(content)
+			objects[s3Key] = string(data)
+			return err
+		},
+		openObject: func(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error) {
+			data, ok := objects[s3Key]
+			if !ok {
+				return nil, storage.ErrObjectNotFound
+			}
+			return io.NopCloser(strings.NewReader(data)), nil
+		},
+		openObjectRange: func(ctx context.Context, bucket, s3Key string, offset, length int64) (io.ReadCloser, error) {
+			data, ok := objects[s3Key]
+			if !ok {
+				return nil, storage.ErrObjectNotFound
+			}
+			return io.NopCloser(strings.NewReader(data[offset : offset+length])), nil
+		},
+		deleteObject: func(ctx context.Context, bucket, s3Key string) error {
+			delete(objects, s3Key)
+			return nil
+		},
+	}
+	return s3, objects
+}
+
+func davRequest(h http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := asUser(httptest.NewRequest(method, path, strings.NewReader(body)), testUser)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebDAVRoundTrip(t *testing.T) {
+	s3, objects := memoryObjects()
+	db := newFakeMetadataStore()
+	h := WebDAVHandler(s3, db, anyType(), quarantine.NewPolicy(false, nil), scan.NewPolicy(false, false, 0), testQuota, nil)
+
+	if rec := davRequest(h, http.MethodPut, "/dav/notes%20one.txt", "first", nil); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT new: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := davRequest(h, http.MethodPut, "/dav/notes%20one.txt", "second", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT over: status %d: %s", rec.Code, rec.Body.String())
+	}
+	// Replacing keeps one file, and frees the old content's storage
+	if len(db.files) != 1 || len(objects) != 1 || db.usage[testUser] != int64(len("second")) {
+		t.Fatalf("after replace: %d files, %d objects, %d bytes used", len(db.files), len(objects), db.usage[testUser])
+	}
+
+	rec := davRequest(h, http.MethodGet, "/dav/notes%20one.txt", "", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "second" {
+		t.Fatalf("GET: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "text/plain" || rec.Header().Get("ETag") == "" {
+		t.Errorf("GET headers: %v", rec.Header())
+	}
+
+	if rec := davRequest(h, http.MethodDelete, "/dav/notes%20one.txt", "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(db.files) != 0 || len(objects) != 0 || db.usage[testUser] != 0 {
+		t.Errorf("after delete: %d files, %d objects, %d bytes used", len(db.files), len(objects), db.usage[testUser])
+	}
+	if rec := davRequest(h, http.MethodGet, "/dav/notes%20one.txt", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted: status %d", rec.Code)
+	}
+}
+
+func TestWebDAVPropfind(t *testing.T) {
+	completed := singleFile()
+	completed.Status = storage.FileStatusCompleted
+	older := *completed
+	older.FileID, older.Version = "file-0", 1
+	completed.Version = 2
+	unfinished := &storage.FileMetadata{FileID: "file-2", Filename: "big.iso", UserID: testUser,
+		UploadType: "multipart", Status: storage.FileStatusUploading, UploadedAt: completed.UploadedAt}
+	h := WebDAVHandler(&fakeObjectStore{}, newFakeMetadataStore(completed, &older, unfinished), anyType(),
+		quarantine.NewPolicy(false, nil), scan.NewPolicy(false, false, 0), testQuota, nil)
+
+	rec := davRequest(h, "PROPFIND", "/dav/", "", map[string]string{"Depth": "1"})
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	// The drive and the latest version of each finished file
+	if strings.Count(body, "<D:response>") != 2 || !strings.Contains(body, "<D:href>/dav/report.pdf</D:href>") ||
+		!strings.Contains(body, `<D:getetag>&#34;file-1&#34;</D:getetag>`) || strings.Contains(body, "big.iso") {
+		t.Errorf("listing: %s", body)
+	}
+
+	// Asked-for properties it doesn't have are reported missing
+	props := `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:quota-used-bytes/><D:foo/></D:prop></D:propfind>`
+	body = davRequest(h, "PROPFIND", "/dav", props, map[string]string{"Depth": "0"}).Body.String()
+	if !strings.Contains(body, "<D:quota-used-bytes>0</D:quota-used-bytes>") || !strings.Contains(body, "<D:foo/>") ||
+		!strings.Contains(body, "HTTP/1.1 404 Not Found") || strings.Count(body, "<D:response>") != 1 {
+		t.Errorf("prop request: %s", body)
+	}
+}
+
+func TestWebDAVRefusals(t *testing.T) {
+	s3, _ := memoryObjects()
+	db := newFakeMetadataStore()
+	h := WebDAVHandler(s3, db, anyType(), quarantine.NewPolicy(false, nil), scan.NewPolicy(false, false, 0), 4, nil)
+
+	tests := []struct {
+		method, path, body string
+		wantCode           int
+		wantErr            common.ErrorCode
+	}{
+		{"MKCOL", "/dav/folder", "", http.StatusMethodNotAllowed, common.ErrorCodeMethodNotAllowed},
+		{"MOVE", "/dav/a.txt", "", http.StatusMethodNotAllowed, common.ErrorCodeMethodNotAllowed},
+		{http.MethodPut, "/dav/over.txt", "too big", http.StatusInsufficientStorage, common.ErrorCodeQuotaExceeded},
+		{http.MethodPut, "/dav/folder/a.txt", "a", http.StatusConflict, common.ErrorCodeConflict},
+	}
+	for _, tt := range tests {
+		rec := davRequest(h, tt.method, tt.path, tt.body, nil)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantCode, rec.Body.String())
+			continue
+		}
+		if got := errorCode(t, rec); got != tt.wantErr {
+			t.Errorf("%s %s: code %s, want %s", tt.method, tt.path, got, tt.wantErr)
+		}
+	}
+	if len(db.files) != 0 || db.usage[testUser] != 0 {
+		t.Errorf("refused requests stored %d files, %d bytes", len(db.files), db.usage[testUser])
+	}
+
+	// An executable is quarantined rather than served
+	h = WebDAVHandler(s3, db, anyType(), quarantine.NewPolicy(true, nil), scan.NewPolicy(false, false, 0), testQuota, nil)
+	s3.readObjectHeader = func(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error) {
+		return []byte("MZ\x90\x00"), nil
+	}
+	s3.copyObject = func(ctx context.Context, bucket, srcKey, dstKey string, size int64) error { return nil }
+	rec := davRequest(h, http.MethodPut, "/dav/setup.exe", string(bytes.Repeat([]byte("x"), 8)), nil)
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != common.ErrorCodeFileQuarantined {
+		t.Errorf("executable PUT: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
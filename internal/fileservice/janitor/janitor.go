@@ -0,0 +1,109 @@
+// Package janitor aborts multipart uploads that were started but never finished, so the
+// parts S3 holds for them stop accruing storage costs.
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// ObjectStore is the object storage an abort needs
+type ObjectStore interface {
+	AbortMultipartUpload(ctx context.Context, uploadInfo *storage.MultipartUploadInfo) error
+}
+
+// MetadataStore is the persistence an abort needs
+type MetadataStore interface {
+	DeleteFileChunks(ctx context.Context, fileID string) error
+	DeleteFileMetadata(ctx context.Context, fileID string) error
+	ReleaseStorage(ctx context.Context, userID string, bytes int64) error
+}
+
+// AbortUpload aborts a multipart upload in S3, then removes its chunk records and file
+// metadata and returns its reserved bytes to the owner's quota. S3 goes first so a
+// failure leaves the records in place for a retry.
+func AbortUpload(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata) error {
+	if metadata.S3UploadID == nil {
+		return fmt.Errorf("file %s has no multipart upload", metadata.FileID)
+	}
+
+	uploadInfo := &storage.MultipartUploadInfo{
+		FileID:   metadata.FileID,
+		UploadID: *metadata.S3UploadID,
+		Bucket:   metadata.Bucket,
+		Key:      metadata.S3Key,
+	}
+	if err := s3Client.AbortMultipartUpload(ctx, uploadInfo); err != nil {
+		return err
+	}
+	if err := dynamoClient.DeleteFileChunks(ctx, metadata.FileID); err != nil {
+		return err
+	}
+	if err := dynamoClient.DeleteFileMetadata(ctx, metadata.FileID); err != nil {
+		return err
+	}
+	if err := dynamoClient.ReleaseStorage(ctx, metadata.UserID, metadata.TotalSize); err != nil {
+		log.Printf("Warning: Failed to release %d bytes of storage for user %s: %v", metadata.TotalSize, metadata.UserID, err)
+	}
+	return nil
+}
+
+// Janitor aborts multipart uploads still "uploading" after maxAge; the scheduler runs it
+type Janitor struct {
+	s3Client     ObjectStore
+	dynamoClient storage.MetadataStore
+	maxAge       time.Duration
+}
+
+// NewJanitor creates a janitor
+func NewJanitor(s3Client ObjectStore, dynamoClient storage.MetadataStore, maxAge time.Duration) *Janitor {
+	return &Janitor{
+		s3Client:     s3Client,
+		dynamoClient: dynamoClient,
+		maxAge:       maxAge,
+	}
+}
+
+// RunOnce aborts every stale multipart upload. A failed abort is logged and retried on
+// the next run rather than stopping the others.
+func (j *Janitor) RunOnce(ctx context.Context) error {
+	files, err := j.dynamoClient.ListAllFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	aborted, failed := 0, 0
+	for _, file := range StaleUploads(files, time.Now(), j.maxAge) {
+		if err := AbortUpload(ctx, j.s3Client, j.dynamoClient, &file); err != nil {
+			log.Printf("Janitor failed to abort upload %s: %v", file.FileID, err)
+			failed++
+			continue
+		}
+		aborted++
+	}
+
+	if aborted > 0 || failed > 0 {
+		log.Printf("Janitor aborted %d stale multipart uploads (%d failed)", aborted, failed)
+	}
+	return nil
+}
+
+// StaleUploads returns the multipart uploads still in progress that started more than maxAge before now
+func StaleUploads(files []storage.FileMetadata, now time.Time, maxAge time.Duration) []storage.FileMetadata {
+	var stale []storage.FileMetadata
+	for _, file := range files {
+		if file.UploadType != "multipart" || file.Status != storage.FileStatusUploading || file.S3UploadID == nil {
+			continue
+		}
+		startedAt, err := time.Parse(time.RFC3339, file.UploadedAt)
+		if err != nil || now.Sub(startedAt) < maxAge {
+			continue
+		}
+		stale = append(stale, file)
+	}
+	return stale
+}
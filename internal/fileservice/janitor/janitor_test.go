@@ -0,0 +1,28 @@
+package janitor
+
+import (
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+func TestStaleUploads(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-96 * time.Hour).Format(time.RFC3339)
+	recent := now.Add(-time.Hour).Format(time.RFC3339)
+	uploadID := "upload-1"
+
+	files := []storage.FileMetadata{
+		{FileID: "stale", UploadType: "multipart", Status: storage.FileStatusUploading, UploadedAt: old, S3UploadID: &uploadID},
+		{FileID: "recent", UploadType: "multipart", Status: storage.FileStatusUploading, UploadedAt: recent, S3UploadID: &uploadID},
+		{FileID: "completed", UploadType: "multipart", Status: storage.FileStatusCompleted, UploadedAt: old, S3UploadID: &uploadID},
+		{FileID: "failed", UploadType: "multipart", Status: storage.FileStatusCompletionFailed, UploadedAt: old, S3UploadID: &uploadID},
+		{FileID: "single", UploadType: "single", Status: storage.FileStatusUploading, UploadedAt: old},
+	}
+
+	stale := StaleUploads(files, now, 72*time.Hour)
+	if len(stale) != 1 || stale[0].FileID != "stale" {
+		t.Errorf("stale uploads = %+v, want only the old in-progress multipart upload", stale)
+	}
+}
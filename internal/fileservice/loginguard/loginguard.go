@@ -0,0 +1,234 @@
+// Package loginguard slows down password guessing against /auth/login. Failed sign-ins are
+// counted per account and per client address in the metadata store, so every replica sees
+// the same counts. An account or address with too many failures is locked for a while,
+// and for twice as long with each further failure, until the failures stop.
+package loginguard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// saveAttempts is how many times a failure is retried when concurrent failures for the
+// same key keep winning the write
+const saveAttempts = 5
+
+// Policy is when failed sign-ins lead to a lock
+type Policy struct {
+	AccountLimit int           // Failures on one account before it is locked; 0 turns account locks off
+	AddressLimit int           // Failures from one client address before it is locked; 0 turns address locks off
+	Window       time.Duration // Failures further apart than this start the count again
+	Lockout      time.Duration // The first lock, doubled with each further failure
+	MaxLockout   time.Duration // The longest lock
+	// Proxies in front of the gateway that append to X-Forwarded-For, e.g. a load balancer
+	TrustedProxies int
+}
+
+// lockFor is how long the failures'th failure locks for, or 0 if it doesn't
+func (p Policy) lockFor(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+	lock := p.Lockout
+	for i := limit; i < failures && lock < p.MaxLockout; i++ {
+		lock *= 2
+	}
+	if lock > p.MaxLockout {
+		lock = p.MaxLockout
+	}
+	return lock
+}
+
+// Store is the persistence a Guard needs. storage.MetadataStore implements it.
+type Store interface {
+	GetLoginAttempts(ctx context.Context, key string) (*storage.LoginAttempts, error)
+	SaveLoginAttempts(ctx context.Context, attempts *storage.LoginAttempts) error
+	DeleteLoginAttempts(ctx context.Context, key string) error
+	PurgeExpiredLoginAttempts(ctx context.Context, now time.Time) (int, error)
+}
+
+// Lock is a refusal to check a password until Until
+type Lock struct {
+	Key   string // AccountKey or AddressKey
+	Until time.Time
+}
+
+// Guard applies a Policy to sign-ins
+type Guard struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+// NewGuard creates a guard that keeps its counts in store
+func NewGuard(store Store, policy Policy) *Guard {
+	return &Guard{store: store, policy: policy, now: time.Now}
+}
+
+// AccountKey is the key an account's failures are counted under. It is derived from the
+// email address signed in with, whether or not an account has it, so a lock doesn't give
+// away which addresses are registered.
+func AccountKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "account:" + hex.EncodeToString(sum[:])
+}
+
+// AddressKey is the key a client address's failures are counted under
+func AddressKey(address string) string {
+	return "address:" + address
+}
+
+// ClientAddress is the address a request came from. The gateway appends its peer to
+// X-Forwarded-For, so that is the last entry, unless trusted proxies in front of the
+// gateway appended theirs first. Earlier entries are whatever the client sent. Without
+// the header it is the connection's address.
+func ClientAddress(r *http.Request, trustedProxies int) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		entries := strings.Split(strings.Join(forwarded, ","), ",")
+		i := len(entries) - 1 - trustedProxies
+		if i < 0 {
+			i = 0
+		}
+		if entry := strings.TrimSpace(entries[i]); entry != "" {
+			return entry
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientAddress is the address a request came from, trusting the policy's proxies. A nil
+// Guard trusts none.
+func (g *Guard) ClientAddress(r *http.Request) string {
+	if g == nil {
+		return ClientAddress(r, 0)
+	}
+	return ClientAddress(r, g.policy.TrustedProxies)
+}
+
+// keys are the counted keys for a sign-in with their limits
+func (g *Guard) keys(email, address string) map[string]int {
+	keys := make(map[string]int, 2)
+	if g.policy.AccountLimit > 0 {
+		keys[AccountKey(email)] = g.policy.AccountLimit
+	}
+	if g.policy.AddressLimit > 0 && address != "" {
+		keys[AddressKey(address)] = g.policy.AddressLimit
+	}
+	return keys
+}
+
+// Check returns the lock that stops a sign-in with email from address, if there is one.
+// When both are locked it returns the one that lasts longer.
+func (g *Guard) Check(ctx context.Context, email, address string) (*Lock, error) {
+	now := g.now()
+	var longest *Lock
+	for key := range g.keys(email, address) {
+		attempts, err := g.store.GetLoginAttempts(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if now.Before(attempts.LockedUntil) && (longest == nil || attempts.LockedUntil.After(longest.Until)) {
+			longest = &Lock{Key: key, Until: attempts.LockedUntil}
+		}
+	}
+	return longest, nil
+}
+
+// Failed counts a failed sign-in with email from address. It returns the locks the
+// failure started, if any.
+func (g *Guard) Failed(ctx context.Context, email, address string) ([]Lock, error) {
+	var locks []Lock
+	for key, limit := range g.keys(email, address) {
+		lock, err := g.fail(ctx, key, limit)
+		if err != nil {
+			return locks, err
+		}
+		if lock != nil {
+			locks = append(locks, *lock)
+		}
+	}
+	return locks, nil
+}
+
+// fail counts one failure against key, retrying if a concurrent failure saved first
+func (g *Guard) fail(ctx context.Context, key string, limit int) (*Lock, error) {
+	for attempt := 1; ; attempt++ {
+		attempts, err := g.store.GetLoginAttempts(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		now := g.now()
+		// The count starts again once the failures stop for a window and any lock is over
+		if now.Sub(attempts.LastFailureAt) > g.policy.Window && !now.Before(attempts.LockedUntil) {
+			attempts.Failures = 0
+			attempts.LockedUntil = time.Time{}
+		}
+		attempts.Failures++
+		attempts.LastFailureAt = now
+		var lock *Lock
+		if lockFor := g.policy.lockFor(attempts.Failures, limit); lockFor > 0 {
+			attempts.LockedUntil = now.Add(lockFor)
+			lock = &Lock{Key: key, Until: attempts.LockedUntil}
+		}
+		keepUntil := now.Add(g.policy.Window)
+		if attempts.LockedUntil.After(keepUntil) {
+			keepUntil = attempts.LockedUntil
+		}
+		attempts.ExpiresAt = keepUntil.Unix()
+		attempts.Version++
+
+		err = g.store.SaveLoginAttempts(ctx, attempts)
+		if errors.Is(err, storage.ErrConditionFailed) && attempt < saveAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return lock, nil
+	}
+}
+
+// Succeeded clears the failures on the account signed in to. Failures from the address
+// are kept, so one working password doesn't wipe the count for a guessing client.
+func (g *Guard) Succeeded(ctx context.Context, email string) error {
+	if g.policy.AccountLimit <= 0 {
+		return nil
+	}
+	return g.store.DeleteLoginAttempts(ctx, AccountKey(email))
+}
+
+// Unlock clears the failures and lock on the account with email. It reports whether a
+// lock was in force.
+func (g *Guard) Unlock(ctx context.Context, email string) (bool, error) {
+	key := AccountKey(email)
+	attempts, err := g.store.GetLoginAttempts(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if attempts.Version == 0 {
+		return false, nil
+	}
+	if err := g.store.DeleteLoginAttempts(ctx, key); err != nil {
+		return false, err
+	}
+	return g.now().Before(attempts.LockedUntil), nil
+}
+
+// Purge deletes expired records from stores without a TTL; the scheduler runs it
+func (g *Guard) Purge(ctx context.Context) error {
+	_, err := g.store.PurgeExpiredLoginAttempts(ctx, g.now())
+	return err
+}
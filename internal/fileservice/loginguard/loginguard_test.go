@@ -0,0 +1,196 @@
+package loginguard
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// fakeStore keeps records in memory with the stores' version check. conflicts makes that
+// many saves fail as if a concurrent failure had saved first.
+type fakeStore struct {
+	records   map[string]storage.LoginAttempts
+	conflicts int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{records: make(map[string]storage.LoginAttempts)}
+}
+
+func (s *fakeStore) GetLoginAttempts(ctx context.Context, key string) (*storage.LoginAttempts, error) {
+	if attempts, ok := s.records[key]; ok {
+		return &attempts, nil
+	}
+	return &storage.LoginAttempts{Key: key}, nil
+}
+
+func (s *fakeStore) SaveLoginAttempts(ctx context.Context, attempts *storage.LoginAttempts) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return storage.ErrConditionFailed
+	}
+	if s.records[attempts.Key].Version != attempts.Version-1 {
+		return storage.ErrConditionFailed
+	}
+	s.records[attempts.Key] = *attempts
+	return nil
+}
+
+func (s *fakeStore) DeleteLoginAttempts(ctx context.Context, key string) error {
+	delete(s.records, key)
+	return nil
+}
+
+func (s *fakeStore) PurgeExpiredLoginAttempts(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+var testPolicy = Policy{AccountLimit: 3, AddressLimit: 10, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: 5 * time.Minute}
+
+func newTestGuard(store Store) (*Guard, *time.Time) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	guard := NewGuard(store, testPolicy)
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestGuardLocksAfterLimit(t *testing.T) {
+	ctx := context.Background()
+	guard, now := newTestGuard(newFakeStore())
+
+	for i := 1; i < testPolicy.AccountLimit; i++ {
+		locks, err := guard.Failed(ctx, "user@example.com", "198.51.100.1")
+		if err != nil || len(locks) != 0 {
+			t.Fatalf("failure %d: locks %v, err %v; want none", i, locks, err)
+		}
+	}
+	if lock, err := guard.Check(ctx, "user@example.com", "198.51.100.1"); err != nil || lock != nil {
+		t.Fatalf("before the limit: lock %v, err %v; want none", lock, err)
+	}
+
+	// Each failure from the limit on locks for twice as long, up to the maximum
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		locks, err := guard.Failed(ctx, "User@Example.com", "198.51.100.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(locks) != 1 || locks[0].Key != AccountKey("user@example.com") || !locks[0].Until.Equal(now.Add(want)) {
+			t.Fatalf("locks %v, want the account locked for %s", locks, want)
+		}
+	}
+
+	lock, err := guard.Check(ctx, "user@example.com", "203.0.113.9")
+	if err != nil || lock == nil {
+		t.Fatalf("lock %v, err %v; want the account locked from any address", lock, err)
+	}
+	*now = lock.Until
+	if lock, err := guard.Check(ctx, "user@example.com", "203.0.113.9"); err != nil || lock != nil {
+		t.Errorf("after the lock: lock %v, err %v; want none", lock, err)
+	}
+}
+
+func TestGuardWindowResetsCount(t *testing.T) {
+	ctx := context.Background()
+	guard, now := newTestGuard(newFakeStore())
+
+	for i := 1; i < testPolicy.AccountLimit; i++ {
+		if _, err := guard.Failed(ctx, "user@example.com", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	*now = now.Add(testPolicy.Window + time.Second)
+	if locks, err := guard.Failed(ctx, "user@example.com", ""); err != nil || len(locks) != 0 {
+		t.Errorf("after the window: locks %v, err %v; want the count started again", locks, err)
+	}
+}
+
+func TestGuardSucceededAndUnlock(t *testing.T) {
+	ctx := context.Background()
+	guard, _ := newTestGuard(newFakeStore())
+
+	for i := 1; i < testPolicy.AccountLimit; i++ {
+		guard.Failed(ctx, "user@example.com", "198.51.100.1")
+	}
+	if err := guard.Succeeded(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if locks, _ := guard.Failed(ctx, "user@example.com", "198.51.100.1"); len(locks) != 0 {
+		t.Errorf("after a success: locks %v, want the account count cleared", locks)
+	}
+
+	if unlocked, err := guard.Unlock(ctx, "user@example.com"); err != nil || unlocked {
+		t.Errorf("unlock without a lock: %v, %v; want false", unlocked, err)
+	}
+	for i := 0; i < testPolicy.AccountLimit; i++ {
+		guard.Failed(ctx, "user@example.com", "")
+	}
+	if unlocked, err := guard.Unlock(ctx, "user@example.com"); err != nil || !unlocked {
+		t.Fatalf("unlock: %v, %v; want true", unlocked, err)
+	}
+	if lock, _ := guard.Check(ctx, "user@example.com", ""); lock != nil {
+		t.Errorf("after unlock: lock %v, want none", lock)
+	}
+}
+
+func TestGuardAddressLock(t *testing.T) {
+	ctx := context.Background()
+	guard, _ := newTestGuard(newFakeStore())
+
+	// Guessing across many accounts from one address locks the address
+	for i := 0; i < testPolicy.AddressLimit; i++ {
+		guard.Failed(ctx, string(rune('a'+i))+"@example.com", "198.51.100.1")
+	}
+	lock, err := guard.Check(ctx, "new@example.com", "198.51.100.1")
+	if err != nil || lock == nil || lock.Key != AddressKey("198.51.100.1") {
+		t.Fatalf("lock %v, err %v; want the address locked", lock, err)
+	}
+	if lock, _ := guard.Check(ctx, "new@example.com", "198.51.100.2"); lock != nil {
+		t.Errorf("other address: lock %v, want none", lock)
+	}
+}
+
+func TestGuardRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	guard, _ := newTestGuard(store)
+
+	store.conflicts = saveAttempts - 1
+	if _, err := guard.Failed(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("failure with %d conflicts: %v", saveAttempts-1, err)
+	}
+	if got := store.records[AccountKey("user@example.com")].Failures; got != 1 {
+		t.Errorf("failures recorded: %d, want 1", got)
+	}
+
+	store.conflicts = saveAttempts
+	if _, err := guard.Failed(ctx, "user@example.com", ""); err == nil {
+		t.Error("failure with a conflict on every attempt: want an error")
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	tests := []struct {
+		forwarded string
+		trusted   int
+		want      string
+	}{
+		{"", 0, "192.0.2.1"},
+		{"198.51.100.1", 0, "198.51.100.1"},
+		{"203.0.113.9, 198.51.100.1", 0, "198.51.100.1"},
+		{"203.0.113.9, 198.51.100.1, 10.0.0.2", 1, "198.51.100.1"},
+		{"10.0.0.2", 3, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/auth/login", nil)
+		r.RemoteAddr = "192.0.2.1:4000"
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := ClientAddress(r, tt.trusted); got != tt.want {
+			t.Errorf("ClientAddress(%q, %d) = %q, want %q", tt.forwarded, tt.trusted, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package quarantine holds back uploads that look like executables or scripts, judged by
+// their file extension and by the magic bytes at the start of the stored object. A file
+// that fails is moved out of its owner's prefix and marked quarantined rather than
+// deleted, so an admin can review and release it.
+package quarantine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// HeaderSize is how many leading bytes of an object are read to check its magic bytes
+const HeaderSize = 512
+
+// DefaultExtensions are the extensions blocked when a deployment doesn't list its own
+var DefaultExtensions = []string{
+	".exe", ".dll", ".com", ".scr", ".msi", ".cpl", ".sys",
+	".bat", ".cmd", ".ps1", ".vbs", ".vbe", ".jse", ".wsf", ".hta",
+	".sh", ".bash", ".jar", ".apk", ".app", ".elf",
+}
+
+// signature is a leading byte sequence that identifies executable content
+type signature struct {
+	magic []byte
+	kind  string
+}
+
+var signatures = []signature{
+	{[]byte("MZ"), "Windows executable"},
+	{[]byte("\x7fELF"), "ELF executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "Mach-O executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "Mach-O executable"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "Mach-O executable"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "Mach-O executable"},
+	{[]byte{0xca, 0xfe, 0xba, 0xbe}, "Mach-O universal binary or Java class"},
+	{[]byte("#!"), "script with an interpreter line"},
+}
+
+// Policy decides which uploads are quarantined. The zero value quarantines nothing.
+type Policy struct {
+	enabled    bool
+	extensions map[string]bool
+}
+
+// NewPolicy creates a policy that, when enabled, quarantines files with one of the given
+// extensions or with executable magic bytes. No extensions means DefaultExtensions.
+func NewPolicy(enabled bool, extensions []string) Policy {
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	blocked := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		blocked[ext] = true
+	}
+	return Policy{enabled: enabled, extensions: blocked}
+}
+
+// Enabled reports whether uploads are screened at all
+func (p Policy) Enabled() bool {
+	return p.enabled
+}
+
+// Inspect returns why a file with this name and leading bytes must be quarantined, or ""
+// if it may be served. Both checks apply, so renaming an executable doesn't get it through.
+func (p Policy) Inspect(filename string, header []byte) string {
+	if !p.enabled {
+		return ""
+	}
+	if ext := strings.ToLower(filepath.Ext(filename)); p.extensions[ext] {
+		return fmt.Sprintf("extension %s is blocked", ext)
+	}
+	for _, sig := range signatures {
+		if bytes.HasPrefix(header, sig.magic) {
+			return fmt.Sprintf("content looks like a %s", sig.kind)
+		}
+	}
+	return ""
+}
+
+// ObjectStore is the object storage screening and quarantining need
+type ObjectStore interface {
+	ReadObjectHeader(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error)
+	CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error
+	DeleteObject(ctx context.Context, bucket, s3Key string) error
+}
+
+// MetadataStore is the persistence quarantining needs
+type MetadataStore interface {
+	SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error
+}
+
+// Screen checks an uploaded file against the policy and quarantines it if it fails,
+// returning the reason, or "" if it passed. It returns storage.ErrObjectNotFound if the
+// file's content hasn't been uploaded yet.
+func Screen(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, policy Policy, metadata *storage.FileMetadata) (string, error) {
+	if !policy.Enabled() {
+		return "", nil
+	}
+
+	header, err := s3Client.ReadObjectHeader(ctx, metadata.Bucket, metadata.S3Key, HeaderSize)
+	if err != nil {
+		return "", err
+	}
+	reason := policy.Inspect(metadata.Filename, header)
+	if reason == "" {
+		return "", nil
+	}
+	if err := Quarantine(ctx, s3Client, dynamoClient, metadata, reason); err != nil {
+		return "", err
+	}
+	return reason, nil
+}
+
+// Quarantine moves a file's object under quarantine/ and marks it quarantined. URLs signed
+// for the old key stop working once it is deleted. If the move fails the file is still
+// marked, which is what stops new download URLs being issued.
+func Quarantine(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata, reason string) error {
+	oldKey := metadata.S3Key
+	newKey := storage.QuarantineKey(oldKey)
+	moved := true
+	if err := s3Client.CopyObject(ctx, metadata.Bucket, oldKey, newKey, metadata.TotalSize); err != nil {
+		log.Printf("Warning: Failed to move quarantined file %s out of %s: %v", metadata.FileID, oldKey, err)
+		moved = false
+	}
+
+	completedAt := time.Now().Format(time.RFC3339)
+	if moved {
+		metadata.S3Key = newKey
+	}
+	metadata.Status = storage.FileStatusQuarantined
+	metadata.QuarantineReason = &reason
+	metadata.CompletedAt = &completedAt
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to mark file %s quarantined: %w", metadata.FileID, err)
+	}
+
+	if moved {
+		if err := s3Client.DeleteObject(ctx, metadata.Bucket, oldKey); err != nil {
+			log.Printf("Warning: Quarantined file %s was copied to %s but %s is still in place: %v", metadata.FileID, newKey, oldKey, err)
+		}
+	}
+	log.Printf("Quarantined file %s: %s", metadata.FileID, reason)
+	return nil
+}
+
+// Release moves a quarantined file back under its owner's prefix and marks it completed
+func Release(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata) error {
+	if metadata.Status != storage.FileStatusQuarantined {
+		return fmt.Errorf("file %s is not quarantined", metadata.FileID)
+	}
+
+	oldKey := metadata.S3Key
+	newKey := storage.ReleasedKey(oldKey)
+	if newKey != oldKey {
+		if err := s3Client.CopyObject(ctx, metadata.Bucket, oldKey, newKey, metadata.TotalSize); err != nil {
+			return fmt.Errorf("failed to move file %s out of quarantine: %w", metadata.FileID, err)
+		}
+	}
+
+	metadata.S3Key = newKey
+	metadata.Status = storage.FileStatusCompleted
+	metadata.QuarantineReason = nil
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to mark file %s released: %w", metadata.FileID, err)
+	}
+
+	if newKey != oldKey {
+		if err := s3Client.DeleteObject(ctx, metadata.Bucket, oldKey); err != nil {
+			log.Printf("Warning: Released file %s was copied to %s but %s is still in place: %v", metadata.FileID, newKey, oldKey, err)
+		}
+	}
+	log.Printf("Released file %s from quarantine", metadata.FileID)
+	return nil
+}
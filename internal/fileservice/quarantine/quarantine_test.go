@@ -0,0 +1,46 @@
+package quarantine
+
+import "testing"
+
+func TestInspect(t *testing.T) {
+	policy := NewPolicy(true, nil)
+
+	tests := []struct {
+		name        string
+		filename    string
+		header      []byte
+		quarantined bool
+	}{
+		{"plain text", "notes.txt", []byte("hello"), false},
+		{"pdf", "report.pdf", []byte("%PDF-1.7"), false},
+		{"empty object", "empty.bin", nil, false},
+		{"blocked extension", "setup.EXE", []byte("anything"), true},
+		{"renamed windows executable", "video.mp4", []byte("MZ\x90\x00"), true},
+		{"elf binary", "data", []byte("\x7fELF\x02\x01"), true},
+		{"mach-o binary", "tool", []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07}, true},
+		{"shebang script", "run.txt", []byte("#!/bin/sh\n"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := policy.Inspect(tt.filename, tt.header)
+			if (reason != "") != tt.quarantined {
+				t.Errorf("Inspect(%q) = %q, want quarantined %v", tt.filename, reason, tt.quarantined)
+			}
+		})
+	}
+}
+
+func TestPolicyConfiguration(t *testing.T) {
+	if reason := (Policy{}).Inspect("setup.exe", []byte("MZ")); reason != "" {
+		t.Errorf("zero policy quarantined a file: %q", reason)
+	}
+
+	// A deployment's own list replaces the defaults, with or without the leading dot
+	policy := NewPolicy(true, []string{"iso", ".DMG"})
+	if policy.Inspect("disk.iso", nil) == "" || policy.Inspect("disk.dmg", nil) == "" {
+		t.Error("configured extensions were not blocked")
+	}
+	if reason := policy.Inspect("setup.exe", []byte("plain")); reason != "" {
+		t.Errorf("default extension still blocked after override: %q", reason)
+	}
+}
@@ -0,0 +1,179 @@
+// Package reconcile detects drift between the S3 bucket and the file metadata table:
+// objects no record refers to, and records whose object never arrived or has vanished.
+package reconcile
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// maxReportEntries caps each list in the stored report so it fits in a single DynamoDB item
+const maxReportEntries = 500
+
+// Reconciler compares bucket contents with file metadata; the scheduler runs it periodically
+// and admins can run it on demand
+type Reconciler struct {
+	s3Client     storage.BlobStore
+	dynamoClient storage.MetadataStore
+	gracePeriod  time.Duration // Objects and uploads younger than this may still be in flight
+}
+
+// NewReconciler creates a reconciler
+func NewReconciler(s3Client storage.BlobStore, dynamoClient storage.MetadataStore, gracePeriod time.Duration) *Reconciler {
+	return &Reconciler{
+		s3Client:     s3Client,
+		dynamoClient: dynamoClient,
+		gracePeriod:  gracePeriod,
+	}
+}
+
+// RunOnce compares the bucket with the metadata table, optionally repairs what it finds,
+// and stores the report as the latest one
+func (r *Reconciler) RunOnce(ctx context.Context, repair bool) (*storage.ReconciliationReport, error) {
+	startedAt := time.Now()
+
+	objects, err := r.s3Client.ListAllObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.dynamoClient.ListAllFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := Compare(objects, files, r.s3Client.ResolveBucket(""), startedAt, r.gracePeriod)
+	report.StartedAt = startedAt.Format(time.RFC3339)
+	report.AutoRepair = repair
+
+	if repair {
+		for i := range report.OrphanObjects {
+			orphan := &report.OrphanObjects[i]
+			if err := r.s3Client.DeleteObject(ctx, orphan.Bucket, orphan.Key); err != nil {
+				log.Printf("Warning: Failed to delete orphan object %s/%s: %v", orphan.Bucket, orphan.Key, err)
+				continue
+			}
+			orphan.Repaired = true
+		}
+		for i := range report.MissingObjects {
+			missing := &report.MissingObjects[i]
+			if err := r.dynamoClient.DeleteFileMetadata(ctx, missing.FileID); err != nil {
+				log.Printf("Warning: Failed to delete dangling metadata for %s: %v", missing.FileID, err)
+				continue
+			}
+			missing.Repaired = true
+		}
+	}
+
+	if len(report.OrphanObjects) > maxReportEntries {
+		report.OrphanObjects = report.OrphanObjects[:maxReportEntries]
+		report.Truncated = true
+	}
+	if len(report.MissingObjects) > maxReportEntries {
+		report.MissingObjects = report.MissingObjects[:maxReportEntries]
+		report.Truncated = true
+	}
+
+	report.CompletedAt = time.Now().Format(time.RFC3339)
+	if err := r.dynamoClient.SaveReconciliationReport(ctx, report); err != nil {
+		log.Printf("Warning: Failed to save reconciliation report: %v", err)
+	}
+
+	log.Printf("Reconciliation complete: %d objects, %d records, %d orphan objects, %d missing objects (repair: %t)",
+		report.ObjectsScanned, report.RecordsScanned, report.OrphanCount, report.MissingCount, repair)
+	return report, nil
+}
+
+// Compare finds objects without metadata and metadata without objects. Records with no bucket
+// refer to defaultBucket. Anything younger than gracePeriod is skipped, since uploads write the
+// record and the object at different times.
+func Compare(objects []storage.ObjectInfo, files []storage.FileMetadata, defaultBucket string, now time.Time, gracePeriod time.Duration) *storage.ReconciliationReport {
+	report := &storage.ReconciliationReport{
+		ObjectsScanned: len(objects),
+		RecordsScanned: len(files),
+		OrphanObjects:  []storage.OrphanObject{},
+		MissingObjects: []storage.MissingObject{},
+	}
+
+	bucketOf := func(file storage.FileMetadata) string {
+		if file.Bucket == "" {
+			return defaultBucket
+		}
+		return file.Bucket
+	}
+
+	referenced := make(map[location]bool, len(files))
+	for _, file := range files {
+		referenced[location{bucketOf(file), file.S3Key}] = true
+	}
+	stored := make(map[location]bool, len(objects))
+	for _, object := range objects {
+		loc := location{object.Bucket, object.Key}
+		stored[loc] = true
+		if referenced[loc] || now.Sub(object.LastModified) < gracePeriod {
+			continue
+		}
+		report.OrphanObjects = append(report.OrphanObjects, storage.OrphanObject{
+			Bucket:       object.Bucket,
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified.Format(time.RFC3339),
+		})
+	}
+
+	for _, file := range files {
+		if stored[location{bucketOf(file), file.S3Key}] || !expectsObject(file, now, gracePeriod) {
+			continue
+		}
+		report.MissingObjects = append(report.MissingObjects, storage.MissingObject{
+			FileID:     file.FileID,
+			UserID:     file.UserID,
+			Bucket:     bucketOf(file),
+			S3Key:      file.S3Key,
+			Status:     file.Status,
+			UploadType: file.UploadType,
+			UploadedAt: file.UploadedAt,
+		})
+	}
+
+	sort.Slice(report.OrphanObjects, func(i, j int) bool {
+		a, b := report.OrphanObjects[i], report.OrphanObjects[j]
+		if a.Bucket != b.Bucket {
+			return a.Bucket < b.Bucket
+		}
+		return a.Key < b.Key
+	})
+	sort.Slice(report.MissingObjects, func(i, j int) bool {
+		return report.MissingObjects[i].FileID < report.MissingObjects[j].FileID
+	})
+
+	report.OrphanCount = len(report.OrphanObjects)
+	report.MissingCount = len(report.MissingObjects)
+	return report
+}
+
+// location identifies an object across buckets
+type location struct {
+	bucket string
+	key    string
+}
+
+// expectsObject reports whether a record's object should be in the bucket by now.
+// Completed files always should; a single upload should once its URL is long expired.
+// In-progress multipart uploads have no object until S3 assembles the parts.
+func expectsObject(file storage.FileMetadata, now time.Time, gracePeriod time.Duration) bool {
+	if file.Status == storage.FileStatusCompleted {
+		return true
+	}
+	if file.UploadType != "single" {
+		return false
+	}
+	uploadedAt, err := time.Parse(time.RFC3339, file.UploadedAt)
+	if err != nil {
+		return false
+	}
+	return now.Sub(uploadedAt) >= gracePeriod
+}
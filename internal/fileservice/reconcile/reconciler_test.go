@@ -0,0 +1,44 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+func TestCompare(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	grace := 24 * time.Hour
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	objects := []storage.ObjectInfo{
+		{Bucket: "default", Key: "users/u1/file-1/a.txt", Size: 10, LastModified: old},   // has metadata
+		{Bucket: "default", Key: "users/u1/orphan/b.txt", Size: 20, LastModified: old},   // orphan
+		{Bucket: "default", Key: "users/u1/fresh/c.txt", Size: 30, LastModified: recent}, // orphan, but may be in flight
+		{Bucket: "shard-1", Key: "users/u1/file-6/h.txt", Size: 40, LastModified: old},   // has metadata in its shard
+		{Bucket: "shard-1", Key: "users/u1/file-2/d.txt", Size: 50, LastModified: old},   // file-2's key, wrong bucket
+	}
+	files := []storage.FileMetadata{
+		{FileID: "file-1", S3Key: "users/u1/file-1/a.txt", UploadType: "single", Status: storage.FileStatusUploading, UploadedAt: old.Format(time.RFC3339)},
+		{FileID: "file-2", S3Key: "users/u1/file-2/d.txt", UploadType: "multipart", Status: storage.FileStatusCompleted, UploadedAt: old.Format(time.RFC3339)},
+		{FileID: "file-3", S3Key: "users/u1/file-3/e.txt", UploadType: "single", Status: storage.FileStatusUploading, UploadedAt: old.Format(time.RFC3339)},
+		{FileID: "file-4", S3Key: "users/u1/file-4/f.txt", UploadType: "single", Status: storage.FileStatusUploading, UploadedAt: recent.Format(time.RFC3339)},
+		{FileID: "file-5", S3Key: "users/u1/file-5/g.txt", UploadType: "multipart", Status: storage.FileStatusUploading, UploadedAt: old.Format(time.RFC3339)},
+		{FileID: "file-6", S3Key: "users/u1/file-6/h.txt", Bucket: "shard-1", UploadType: "single", Status: storage.FileStatusUploading, UploadedAt: old.Format(time.RFC3339)},
+	}
+
+	report := Compare(objects, files, "default", now, grace)
+
+	if report.OrphanCount != 2 || report.OrphanObjects[0].Key != "users/u1/orphan/b.txt" ||
+		report.OrphanObjects[1].Bucket != "shard-1" || report.OrphanObjects[1].Key != "users/u1/file-2/d.txt" {
+		t.Errorf("orphan objects = %+v, want default/users/u1/orphan/b.txt and shard-1/users/u1/file-2/d.txt", report.OrphanObjects)
+	}
+	if report.MissingCount != 2 || report.MissingObjects[0].FileID != "file-2" || report.MissingObjects[1].FileID != "file-3" {
+		t.Errorf("missing objects = %+v, want file-2 and file-3", report.MissingObjects)
+	}
+	if report.ObjectsScanned != 5 || report.RecordsScanned != 6 {
+		t.Errorf("scanned %d objects and %d records, want 5 and 6", report.ObjectsScanned, report.RecordsScanned)
+	}
+}
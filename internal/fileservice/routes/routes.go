@@ -1,47 +1,287 @@
 package routes
 
 import (
+	"context"
+	"log"
+	"net/http"
 	"time"
 	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/anomaly"
+	"vibe-drop/internal/fileservice/callbacks"
 	"vibe-drop/internal/fileservice/config"
+	"vibe-drop/internal/fileservice/emailverify"
+	"vibe-drop/internal/fileservice/events"
 	"vibe-drop/internal/fileservice/handlers"
+	"vibe-drop/internal/fileservice/loginguard"
+	"vibe-drop/internal/fileservice/quarantine"
+	"vibe-drop/internal/fileservice/reconcile"
+	"vibe-drop/internal/fileservice/scan"
 	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/fileservice/throttle"
+	"vibe-drop/internal/fileservice/writeretry"
+	"vibe-drop/internal/health"
+	"vibe-drop/internal/registry"
+	"vibe-drop/internal/s3compat"
+	"vibe-drop/internal/telemetry"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes(cfg *config.Config, s3Client *storage.S3Client, dynamoClient *storage.DynamoClient) *mux.Router {
-	// S3 client is now passed in from server.go
+// uploadNoticePoll is how often a stream of upload notices checks for new ones
+const uploadNoticePoll = 30 * time.Second
+
+// uploadEventPoll is how often a stream of upload events checks the upload's chunks
+const uploadEventPoll = 2 * time.Second
+
+// SetupRoutes builds the file service's router. Failed upload metadata writes are queued
+// on writeRetries, which may be nil to drop them.
+func SetupRoutes(cfg *config.Config, s3Client storage.BlobStore, dynamoClient storage.MetadataStore, writeRetries *writeretry.Queue, bus events.Publisher) *mux.Router {
+	// Object store is passed in from server.go
 	r := mux.NewRouter()
+	r.Use(common.RequestLoggerMiddleware())
+	r.Use(telemetry.Middleware("vibe-drop-fileservice"))
+	r.Use(common.LocaleMiddleware())
+	r.Use(common.SizeFormatMiddleware())
+	r.Use(common.ClientInfoMiddleware())
+	r.Use(common.PathParamValidationMiddleware())
 
 	// Create auth services
-	jwtService := auth.NewJWTService("your-jwt-secret-key-change-in-production", time.Hour)
+	jwtService := auth.NewJWTServiceFromConfig(cfg.JWT())
 	passwordService := auth.NewPasswordService()
+	var loginGuard *loginguard.Guard
+	if policy := cfg.LoginPolicy(); policy.AccountLimit > 0 || policy.AddressLimit > 0 {
+		loginGuard = loginguard.NewGuard(dynamoClient, policy)
+	}
+	var totpBox *auth.SecretBox
+	if cfg.TOTPEncryptionKey != "" {
+		totpBox, _ = auth.NewSecretBox(cfg.TOTPEncryptionKey) // The config checked the key
+	}
 	authServices := &handlers.AuthServices{
 		JWTService:      jwtService,
 		PasswordService: passwordService,
 		DynamoClient:    dynamoClient,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		LoginGuard:      loginGuard,
+		TOTPBox:         totpBox,
+		TOTPIssuer:      cfg.TOTPIssuer,
+
+		EmailVerificationTTL: cfg.EmailVerificationTTL,
+		Events:               bus,
+	}
+	if cfg.EmailVerificationWebhookURL != "" {
+		authServices.EmailVerifier = emailverify.NewWebhookNotifier(cfg.EmailVerificationWebhookURL)
 	}
 
-	// Health check (no auth needed)
+	// Health checks (no auth needed). Readiness pings the object and metadata stores.
 	r.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
+	r.HandleFunc("/health/live", handlers.HealthHandler).Methods("GET")
+	r.Handle("/health/ready", health.NewChecker("file-service",
+		health.Check{Name: cfg.StorageBackend, Ping: func(ctx context.Context) error { return s3Client.TestConnection(ctx) }},
+		health.Check{Name: cfg.MetadataBackend, Ping: func(ctx context.Context) error { return dynamoClient.TestConnection(ctx) }},
+	)).Methods("GET")
+
+	// The filesystem backend serves its own presigned URLs, which carry their authorization
+	if fsStore, ok := s3Client.(*storage.FSStore); ok {
+		r.PathPrefix(storage.FSBlobPath).Handler(fsStore).Methods("GET", "HEAD", "PUT")
+	}
 
-	// Authentication endpoints (no auth needed)
-	r.Handle("/auth/register", handlers.RegisterHandler(authServices)).Methods("POST")
-	r.Handle("/auth/login", handlers.LoginHandler(authServices)).Methods("POST")
+	// Anomaly detection on download URL issuance and deletes
+	detector := anomaly.NewDetector(cfg.AnomalyLockDuration,
+		anomaly.Rule{Action: anomaly.ActionDownloadURL, Limit: cfg.AnomalyDownloadURLLimit, Window: cfg.AnomalyDownloadURLWindow},
+		anomaly.Rule{Action: anomaly.ActionDelete, Limit: cfg.AnomalyDeleteLimit, Window: cfg.AnomalyDeleteWindow},
+	)
+	if cfg.AnomalyAlertWebhookURL != "" {
+		detector.OnDetection(anomaly.NewWebhookNotifier(cfg.AnomalyAlertWebhookURL))
+	}
+	watch := func(action string, h http.Handler) http.Handler {
+		if !cfg.AnomalyDetection {
+			return h
+		}
+		return detector.Middleware(action)(h)
+	}
+	// Batch deletes count each file they name, so the handler records them itself
+	var batchDetector *anomaly.Detector
+	guard := func(h http.Handler) http.Handler { return h }
+	if cfg.AnomalyDetection {
+		batchDetector = detector
+		guard = detector.LockMiddleware()
+	}
 
 	// File operations - pass clients to handlers that need them
-	r.Handle("/files/upload-url", handlers.GenerateUploadURLHandler(s3Client, dynamoClient)).Methods("POST")
-	r.Handle("/files", handlers.ListFilesHandler(dynamoClient)).Methods("GET")
-	r.Handle("/files/{id}", handlers.GetFileMetadataHandler(dynamoClient)).Methods("GET")
-	r.Handle("/files/{id}/download-url", handlers.GenerateDownloadURLHandler(s3Client, dynamoClient)).Methods("GET")
-	r.Handle("/files/{id}", handlers.DeleteFileHandler(s3Client, dynamoClient)).Methods("DELETE")
-	
-	// Chunk completion for multipart uploads
-	r.Handle("/files/{fileId}/chunks/{chunkNumber}/complete", handlers.ChunkCompletionHandler(dynamoClient)).Methods("POST")
-	
-	// Complete multipart upload
-	r.Handle("/files/{fileId}/complete", handlers.CompleteMultipartUploadHandler(s3Client, dynamoClient)).Methods("POST")
+	uploadHints := handlers.NewUploadHints(cfg.UploadMaxParallelParts, cfg.UploadRetryMaxAttempts,
+		cfg.UploadRetryInitialBackoff, cfg.UploadRetryMaxBackoff)
+	policies := handlers.NewContentTypePolicies(dynamoClient, cfg.ContentTypePolicy)
+	executables := quarantine.NewPolicy(cfg.QuarantineExecutables, cfg.QuarantineExtensions)
+	scans := scan.NewPolicy(cfg.VirusScanner != "", cfg.VirusScanEnforce, cfg.VirusScanInterval)
+	downloadThrottle := throttle.NewLimiter(cfg.DownloadURLFileLimit, cfg.DownloadURLFileWindow)
+	reconciler := reconcile.NewReconciler(s3Client, dynamoClient, cfg.ReconcileGracePeriod)
+	var uploadCallbacks *callbacks.Notifier
+	if cfg.UploadCallbackSecret != "" {
+		uploadCallbacks = callbacks.NewNotifier(dynamoClient, s3Client, []byte(cfg.UploadCallbackSecret))
+	}
+
+	// Handlers for the registry's routes, by name. Each is wrapped in the auth its route
+	// requires below.
+	served := map[string]http.Handler{
+		"register":          handlers.RegisterHandler(authServices),
+		"login":             handlers.LoginHandler(authServices),
+		"refreshToken":      handlers.RefreshHandler(authServices),
+		"logout":            handlers.LogoutHandler(authServices),
+		"createScopedToken": handlers.CreateScopedTokenHandler(authServices),
+		"enrollTOTP":        handlers.EnrollTOTPHandler(authServices),
+		"verifyTOTP":        handlers.VerifyTOTPHandler(authServices),
+		"disableTOTP":       handlers.DisableTOTPHandler(authServices),
+		"getJWKS":           handlers.JWKSHandler(jwtService),
+
+		// The signed-in user's account
+		"getCurrentUser":    handlers.GetCurrentUserHandler(authServices),
+		"updateCurrentUser": handlers.UpdateCurrentUserHandler(authServices),
+		"verifyEmail":       handlers.VerifyEmailHandler(authServices),
+		"deleteCurrentUser": handlers.DeleteCurrentUserHandler(authServices, s3Client, dynamoClient),
+
+		"listFiles":        handlers.ListFilesHandler(dynamoClient),
+		"createUploadURL":  handlers.GenerateUploadURLHandler(s3Client, dynamoClient, uploadHints, cfg.StorageQuotaBytes, policies, cfg.FilenameCollisionStrategy, cfg.BackgroundUploadURLExpiry, writeRetries),
+		"listRecentFiles":  handlers.RecentFilesHandler(dynamoClient),
+		"updateFileTags":   handlers.UpdateFileTagsHandler(dynamoClient),
+		"searchFiles":      handlers.SearchFilesHandler(dynamoClient),
+		"checkFileExists":  handlers.FileExistsHandler(s3Client, dynamoClient),
+		"getFile":          handlers.GetFileMetadataHandler(dynamoClient),
+		"getDownloadURL":   watch(anomaly.ActionDownloadURL, handlers.GenerateDownloadURLHandler(s3Client, dynamoClient, executables, scans, downloadThrottle, cfg.DownloadURLMaxExpiry)),
+		"deleteFile":       watch(anomaly.ActionDelete, handlers.DeleteFileHandler(s3Client, dynamoClient, bus)),
+		"batchDeleteFiles": guard(handlers.BatchDeleteFilesHandler(s3Client, dynamoClient, bus, batchDetector)),
+
+		// Multipart uploads
+		"listChunks":      handlers.ListChunksHandler(dynamoClient),
+		"getUploadStatus": handlers.UploadStatusHandler(s3Client, dynamoClient),
+		"getUploadEvents": handlers.UploadEventsHandler(dynamoClient, uploadEventPoll),
+		"refreshChunkURL": handlers.RefreshChunkURLHandler(s3Client, dynamoClient),
+		"completeChunk":   handlers.ChunkCompletionHandler(s3Client, dynamoClient, cfg.VerifyChunkParts),
+		"completeUpload":  handlers.CompleteMultipartUploadHandler(s3Client, dynamoClient, executables, scans, cfg.ChunkRecordRetention, uploadCallbacks, bus),
+		"abortUpload":     handlers.AbortMultipartUploadHandler(s3Client, dynamoClient, bus),
+
+		// Delta uploads: a file's block manifest, and new versions stitched from its blocks
+		"getBlockManifest":  handlers.BlockManifestHandler(s3Client, dynamoClient, dynamoClient),
+		"createDeltaUpload": handlers.DeltaUploadHandler(s3Client, dynamoClient, uploadHints, cfg.StorageQuotaBytes, policies, writeRetries),
+
+		// Parallel downloads: a file's parts, laid out on its block manifest
+		"getFileParts": handlers.FilePartsHandler(s3Client, dynamoClient, dynamoClient, uploadHints),
+
+		// User storage analytics (computed by the background aggregator) and quota usage
+		// (tracked as uploads are requested and files deleted)
+		"getUserAnalytics": handlers.UserAnalyticsHandler(dynamoClient),
+		"getUserUsage":     handlers.UserUsageHandler(dynamoClient, cfg.StorageQuotaBytes),
+
+		// Upload by email: the user's inbox address and who may send to it
+		"getInbox":        handlers.GetInboxHandler(dynamoClient, cfg.InboxDomain, cfg.InboxAddressSecret),
+		"setInboxSenders": handlers.SetInboxSendersHandler(dynamoClient, cfg.InboxDomain, cfg.InboxAddressSecret),
+
+		// Where the calling API key's completed uploads are reported; http URLs are allowed
+		// in dev for local receivers
+		"getUploadCallback":    handlers.GetUploadCallbackHandler(dynamoClient, cfg.UploadCallbackSecret),
+		"setUploadCallback":    handlers.SetUploadCallbackHandler(dynamoClient, cfg.UploadCallbackSecret, cfg.Environment == "dev"),
+		"deleteUploadCallback": handlers.DeleteUploadCallbackHandler(dynamoClient, cfg.UploadCallbackSecret),
+
+		// Slow and stalled uploads, as a list or an event stream
+		"listUploadNotices": handlers.UploadNoticesHandler(dynamoClient, cfg.UploadNoticeThresholds(), uploadNoticePoll),
+
+		// Admin operational endpoints
+		"getAdminMetrics":         handlers.SystemMetricsHandler(dynamoClient),
+		"getClientVersions":       handlers.ClientVersionsHandler(dynamoClient),
+		"redriveUpload":           handlers.RedriveUploadHandler(s3Client, dynamoClient, uploadCallbacks, bus),
+		"listIssuedURLs":          handlers.ListIssuedURLsHandler(dynamoClient),
+		"revokeFileURLs":          handlers.RevokeFileURLsHandler(s3Client, dynamoClient),
+		"releaseQuarantinedFile":  handlers.ReleaseQuarantinedFileHandler(s3Client, dynamoClient),
+		"processS3Events":         handlers.S3EventsHandler(s3Client, dynamoClient, uploadCallbacks, bus),
+		"getReconciliationReport": handlers.ReconciliationReportHandler(dynamoClient),
+		"runReconciliation":       handlers.RunReconciliationHandler(reconciler),
+		"listAnomalies":           handlers.AnomaliesHandler(detector),
+		"unlockUser":              handlers.UnlockUserHandler(detector),
+		"unlockLogin":             handlers.UnlockLoginHandler(loginGuard, dynamoClient),
+		"createOwnershipTransfer": handlers.CreateTransferHandler(dynamoClient),
+		"getOwnershipTransfer":    handlers.GetTransferHandler(dynamoClient),
+		"getContentTypePolicy":    handlers.GetContentTypePolicyHandler(policies),
+		"setContentTypePolicy":    handlers.SetContentTypePolicyHandler(policies),
+		"resetContentTypePolicy":  handlers.ResetContentTypePolicyHandler(policies),
+
+		// Admin account management: any user's files and usage, force deletes, suspensions
+		// and roles
+		"listUsers":         handlers.ListUsersHandler(dynamoClient),
+		"getUserFilesAdmin": handlers.AdminUserFilesHandler(dynamoClient, dynamoClient),
+		"getUserUsageAdmin": handlers.AdminUserUsageHandler(dynamoClient, dynamoClient, cfg.StorageQuotaBytes),
+		"forceDeleteFile":   handlers.ForceDeleteFileHandler(s3Client, dynamoClient, bus),
+		"suspendUser":       handlers.SuspendUserHandler(dynamoClient),
+		"unsuspendUser":     handlers.UnsuspendUserHandler(dynamoClient),
+		"setUserRole":       handlers.SetUserRoleHandler(dynamoClient),
+	}
+
+	// Route protection: a valid JWT plus the scope each operation needs, a full-access
+	// (login) token for minting scoped tokens, a token the gateway minted for an API key,
+	// or X-Admin-Key or an admin's token
+	authenticate := auth.AuthMiddleware(jwtService)
+	requireAdmin := auth.AdminMiddleware(cfg.AdminAPIKey, jwtService)
+	for _, route := range registry.Served() {
+		handler, ok := served[route.Name]
+		if !ok {
+			log.Fatalf("No file service handler for %s %s (%s)", route.Method, route.ServicePath, route.Name)
+		}
+		switch route.Auth {
+		case registry.AuthUser:
+			handler = authenticate(auth.RequireScope(route.Scope)(handler))
+		case registry.AuthFullAccess:
+			handler = authenticate(auth.RequireFullAccess()(handler))
+		case registry.AuthAPIKey:
+			handler = authenticate(auth.RequireAPIKey()(handler))
+		case registry.AuthAdmin:
+			handler = requireAdmin(handler)
+		}
+		r.Handle(route.ServicePath, handler).Methods(route.Method).Name(route.Name)
+	}
+
+	// The WebDAV drive isn't a registry route: clients mount it from the file service
+	// directly, signing in with a token as the password
+	if cfg.WebDAVEnabled {
+		drive := handlers.WebDAVHandler(s3Client, dynamoClient, policies, executables, scans, cfg.StorageQuotaBytes, bus)
+		// Reads count as download URLs do, and HEAD only checks the lock
+		downloads, heads, deletes := watch(anomaly.ActionDownloadURL, drive), guard(drive), watch(anomaly.ActionDelete, drive)
+		dav := auth.BasicTokenMiddleware(jwtService, "Vibe-Drop")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				downloads.ServeHTTP(w, r)
+			case http.MethodHead:
+				heads.ServeHTTP(w, r)
+			case http.MethodDelete:
+				deletes.ServeHTTP(w, r)
+			default:
+				drive.ServeHTTP(w, r)
+			}
+		}))
+		r.Handle(handlers.WebDAVPath, dav)
+		r.PathPrefix(handlers.WebDAVPath + "/").Handler(dav)
+	}
+
+	// Nor is the S3-compatible API: the gateway checks its signatures and proxies it here
+	// with a token for the API key, whatever the path
+	if cfg.S3CompatEnabled {
+		bucket := handlers.S3Handler(s3Client, dynamoClient, policies, executables, scans, cfg.StorageQuotaBytes, uploadCallbacks, bus)
+		// As on the drive, getting an object counts as a download URL and HEAD checks the lock
+		downloads, heads, deletes := watch(anomaly.ActionDownloadURL, bucket), guard(bucket), watch(anomaly.ActionDelete, bucket)
+		s3 := s3compat.Errors(auth.AuthMiddleware(jwtService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, key := s3compat.SplitPath(r.URL.Path)
+			switch {
+			case key != "" && r.Method == http.MethodGet:
+				downloads.ServeHTTP(w, r)
+			case key != "" && r.Method == http.MethodHead:
+				heads.ServeHTTP(w, r)
+			case r.Method == http.MethodDelete:
+				deletes.ServeHTTP(w, r)
+			default:
+				bucket.ServeHTTP(w, r)
+			}
+		})))
+		r.Handle(s3compat.Path, s3)
+		r.PathPrefix(s3compat.Path + "/").Handler(s3)
+	}
 
 	return r
 }
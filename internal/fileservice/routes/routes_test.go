@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"vibe-drop/internal/fileservice/config"
+	"vibe-drop/internal/registry"
+)
+
+// TestRegistryRoutesAreServed checks each route the registry gives the file service
+// reaches a handler under its name
+func TestRegistryRoutesAreServed(t *testing.T) {
+	router := SetupRoutes(&config.Config{}, nil, nil, nil, nil)
+	for _, route := range registry.Served() {
+		req := httptest.NewRequest(route.Method, route.ServiceURL(map[string]string{"id": "x", "chunkNumber": "1"}), nil)
+		var match mux.RouteMatch
+		if !router.Match(req, &match) || match.Route.GetName() != route.Name {
+			t.Errorf("%s %s is not served as %s", route.Method, route.ServicePath, route.Name)
+		}
+	}
+}
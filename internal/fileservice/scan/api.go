@@ -0,0 +1,53 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// API scans with an external scanning service. Content is POSTed as the request body and
+// the service replies 200 with JSON {"infected": bool, "signature": "..."}.
+type API struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewAPI creates a scanner for the service at url, sending apiKey as a bearer token if set
+func NewAPI(url, apiKey string, timeout time.Duration) *API {
+	return &API{url: url, apiKey: apiKey, client: &http.Client{Timeout: timeout}}
+}
+
+// Scan posts content to the service and reads its verdict
+func (a *API) Scan(ctx context.Context, content io.Reader) (Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, content)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to build scan request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("scanning API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("scanning API returned %s", resp.Status)
+	}
+
+	var result struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("failed to decode scanning API response: %w", err)
+	}
+	return Verdict{Infected: result.Infected, Signature: result.Signature}, nil
+}
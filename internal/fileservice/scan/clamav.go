@@ -0,0 +1,95 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamChunkSize is how much content goes in each INSTREAM chunk
+const clamChunkSize = 64 * 1024
+
+// ClamAV scans with a clamd daemon, streaming content over TCP with its INSTREAM command
+type ClamAV struct {
+	address string
+	timeout time.Duration
+}
+
+// NewClamAV creates a scanner for the clamd listening at address (host:port). A timeout
+// of zero leaves each scan bounded only by its context.
+func NewClamAV(address string, timeout time.Duration) *ClamAV {
+	return &ClamAV{address: address, timeout: timeout}
+}
+
+// Scan sends content to clamd and parses its one-line reply
+func (c *ClamAV) Scan(ctx context.Context, content io.Reader) (Verdict, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := clamStream(conn, content); err != nil {
+		return Verdict{}, fmt.Errorf("failed to send content to clamd: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamReply(reply)
+}
+
+// clamStream writes the INSTREAM command, then content as length-prefixed chunks ending
+// with an empty one
+func clamStream(w io.Writer, content io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	chunk := make([]byte, 4+clamChunkSize)
+	for {
+		n, err := io.ReadFull(content, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk, uint32(n))
+			if _, werr := w.Write(chunk[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamReply reads a reply such as "stream: OK", "stream: Eicar-Signature FOUND" or
+// "INSTREAM size limit exceeded. ERROR"
+func parseClamReply(reply string) (Verdict, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return Verdict{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	}
+	return Verdict{}, fmt.Errorf("clamd: %s", reply)
+}
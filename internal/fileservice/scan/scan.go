@@ -0,0 +1,174 @@
+// Package scan checks stored files for viruses, with a ClamAV daemon or an external
+// scanning API. Completing an upload queues the file by marking its scan status pending; a
+// background job then streams each pending object to the scanner and records whether it is
+// clean or infected. With enforcement on, download URLs wait for a clean result.
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// Scanner kinds a deployment can configure
+const (
+	KindClamAV = "clamav"
+	KindAPI    = "api"
+)
+
+// Verdict is what a scanner found in some content
+type Verdict struct {
+	Infected  bool
+	Signature string // The virus or rule matched, if infected
+}
+
+// Scanner checks content for viruses. An error means the content couldn't be judged.
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (Verdict, error)
+}
+
+// New creates the scanner of the given kind; timeout bounds each scan
+func New(kind, clamAVAddress, apiURL, apiKey string, timeout time.Duration) (Scanner, error) {
+	switch kind {
+	case KindClamAV:
+		return NewClamAV(clamAVAddress, timeout), nil
+	case KindAPI:
+		if apiURL == "" {
+			return nil, errors.New("the scanning API needs a URL")
+		}
+		return NewAPI(apiURL, apiKey, timeout), nil
+	}
+	return nil, fmt.Errorf("unknown virus scanner %q", kind)
+}
+
+// Policy decides whether uploads are scanned and whether downloads wait for the result.
+// The zero value scans nothing.
+type Policy struct {
+	enabled    bool
+	enforce    bool
+	retryAfter time.Duration
+}
+
+// NewPolicy creates a scan policy. With enforce set, download URLs are refused for files not
+// yet scanned clean; retryAfter is how soon a pending scan is worth asking about again.
+func NewPolicy(enabled, enforce bool, retryAfter time.Duration) Policy {
+	return Policy{enabled: enabled, enforce: enforce, retryAfter: retryAfter}
+}
+
+// Enabled reports whether completed uploads are queued for scanning
+func (p Policy) Enabled() bool {
+	return p.enabled
+}
+
+// Enforced reports whether downloads require a clean scan
+func (p Policy) Enforced() bool {
+	return p.enabled && p.enforce
+}
+
+// RetryAfter is how long a client should wait before asking again about a pending file
+func (p Policy) RetryAfter() time.Duration {
+	return p.retryAfter
+}
+
+// Enqueue marks a file for the scan job and clears any earlier result. The caller saves
+// the metadata.
+func Enqueue(metadata *storage.FileMetadata) {
+	metadata.ScanStatus = storage.ScanStatusPending
+	metadata.ScanSignature = ""
+	metadata.ScannedAt = nil
+}
+
+// ObjectStore is the object storage scanning needs
+type ObjectStore interface {
+	OpenObject(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error)
+}
+
+// MetadataStore is the persistence scanning needs
+type MetadataStore interface {
+	ListFilesPendingScan(ctx context.Context) ([]storage.FileMetadata, error)
+	GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error)
+	SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error
+}
+
+// ScanFile streams a file's stored content to the scanner and records the verdict
+func ScanFile(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, scanner Scanner, metadata *storage.FileMetadata) error {
+	content, err := s3Client.OpenObject(ctx, metadata.Bucket, metadata.S3Key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	verdict, err := scanner.Scan(ctx, content)
+	if err != nil {
+		return fmt.Errorf("failed to scan file %s: %w", metadata.FileID, err)
+	}
+
+	scannedAt := time.Now().Format(time.RFC3339)
+	metadata.ScannedAt = &scannedAt
+	metadata.ScanStatus = storage.ScanStatusClean
+	metadata.ScanSignature = ""
+	if verdict.Infected {
+		metadata.ScanStatus = storage.ScanStatusInfected
+		metadata.ScanSignature = verdict.Signature
+	}
+	if err := dynamoClient.SaveFileMetadata(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to record scan of file %s: %w", metadata.FileID, err)
+	}
+	if verdict.Infected {
+		log.Printf("Virus scan found %s in file %s", verdict.Signature, metadata.FileID)
+	}
+	return nil
+}
+
+// Runner scans the files waiting for it; the scheduler runs it
+type Runner struct {
+	s3Client     ObjectStore
+	dynamoClient MetadataStore
+	scanner      Scanner
+}
+
+// NewRunner creates a scan runner
+func NewRunner(s3Client ObjectStore, dynamoClient MetadataStore, scanner Scanner) *Runner {
+	return &Runner{
+		s3Client:     s3Client,
+		dynamoClient: dynamoClient,
+		scanner:      scanner,
+	}
+}
+
+// RunOnce scans every pending file. A file that can't be scanned stays pending and is
+// retried on the next run rather than stopping the others.
+func (r *Runner) RunOnce(ctx context.Context) error {
+	files, err := r.dynamoClient.ListFilesPendingScan(ctx)
+	if err != nil {
+		return err
+	}
+
+	scanned, infected, failed := 0, 0, 0
+	for _, file := range files {
+		// Reload the file so one deleted or rescanned since the listing isn't written back
+		metadata, err := r.dynamoClient.GetFileMetadata(ctx, file.FileID)
+		if err != nil || metadata.ScanStatus != storage.ScanStatusPending {
+			continue
+		}
+		if err := ScanFile(ctx, r.s3Client, r.dynamoClient, r.scanner, metadata); err != nil {
+			log.Printf("Virus scan of file %s failed: %v", file.FileID, err)
+			failed++
+			continue
+		}
+		scanned++
+		if metadata.ScanStatus == storage.ScanStatusInfected {
+			infected++
+		}
+	}
+
+	if scanned > 0 || failed > 0 {
+		log.Printf("Virus scan checked %d files, %d infected (%d failed)", scanned, infected, failed)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// fakeClamd accepts one INSTREAM session, reassembles the content and answers with reply
+func fakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		if command, err := r.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+			return
+		}
+		var content bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+				return
+			}
+		}
+		received <- content.Bytes()
+		io.WriteString(conn, reply+"\x00")
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestClamAV(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), clamChunkSize+10) // Spans two chunks
+
+	addr, received := fakeClamd(t, "stream: OK")
+	verdict, err := NewClamAV(addr, time.Second).Scan(context.Background(), bytes.NewReader(content))
+	if err != nil || verdict.Infected {
+		t.Fatalf("clean content: verdict %+v, err %v", verdict, err)
+	}
+	if got := <-received; !bytes.Equal(got, content) {
+		t.Errorf("clamd received %d bytes, want %d", len(got), len(content))
+	}
+
+	addr, _ = fakeClamd(t, "stream: Eicar-Signature FOUND")
+	verdict, err = NewClamAV(addr, time.Second).Scan(context.Background(), strings.NewReader("eicar"))
+	if err != nil || !verdict.Infected || verdict.Signature != "Eicar-Signature" {
+		t.Errorf("infected content: verdict %+v, err %v", verdict, err)
+	}
+
+	addr, _ = fakeClamd(t, "INSTREAM size limit exceeded. ERROR")
+	if _, err := NewClamAV(addr, time.Second).Scan(context.Background(), strings.NewReader("big")); err == nil {
+		t.Error("clamd error reply was not returned as an error")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "eicar" {
+			io.WriteString(w, `{"infected": true, "signature": "EICAR"}`)
+			return
+		}
+		io.WriteString(w, `{"infected": false}`)
+	}))
+	defer srv.Close()
+
+	api := NewAPI(srv.URL, "secret", time.Second)
+	if verdict, err := api.Scan(context.Background(), strings.NewReader("hello")); err != nil || verdict.Infected {
+		t.Errorf("clean content: verdict %+v, err %v", verdict, err)
+	}
+	if verdict, err := api.Scan(context.Background(), strings.NewReader("eicar")); err != nil || verdict.Signature != "EICAR" {
+		t.Errorf("infected content: verdict %+v, err %v", verdict, err)
+	}
+	if _, err := NewAPI(srv.URL, "wrong", time.Second).Scan(context.Background(), strings.NewReader("hello")); err == nil {
+		t.Error("a non-200 response was not returned as an error")
+	}
+}
+
+type fakeStore struct {
+	objects map[string]string
+	files   map[string]*storage.FileMetadata
+}
+
+func (f *fakeStore) OpenObject(_ context.Context, _, s3Key string) (io.ReadCloser, error) {
+	content, ok := f.objects[s3Key]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (f *fakeStore) ListFilesPendingScan(context.Context) ([]storage.FileMetadata, error) {
+	var pending []storage.FileMetadata
+	for _, file := range f.files {
+		if file.ScanStatus == storage.ScanStatusPending {
+			pending = append(pending, *file)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeStore) GetFileMetadata(_ context.Context, fileID string) (*storage.FileMetadata, error) {
+	file, ok := f.files[fileID]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	copied := *file
+	return &copied, nil
+}
+
+func (f *fakeStore) SaveFileMetadata(_ context.Context, metadata *storage.FileMetadata) error {
+	stored := *metadata
+	f.files[metadata.FileID] = &stored
+	return nil
+}
+
+type stringScanner struct{}
+
+// Scan reports content containing "eicar" as infected
+func (stringScanner) Scan(_ context.Context, content io.Reader) (Verdict, error) {
+	body, err := io.ReadAll(content)
+	if strings.Contains(string(body), "eicar") {
+		return Verdict{Infected: true, Signature: "EICAR"}, err
+	}
+	return Verdict{}, err
+}
+
+func TestRunOnce(t *testing.T) {
+	store := &fakeStore{
+		objects: map[string]string{"clean-key": "hello", "infected-key": "eicar"},
+		files: map[string]*storage.FileMetadata{
+			"clean":    {FileID: "clean", S3Key: "clean-key", ScanStatus: storage.ScanStatusPending},
+			"infected": {FileID: "infected", S3Key: "infected-key", ScanStatus: storage.ScanStatusPending},
+			"missing":  {FileID: "missing", S3Key: "missing-key", ScanStatus: storage.ScanStatusPending},
+			"done":     {FileID: "done", S3Key: "infected-key", ScanStatus: storage.ScanStatusClean},
+		},
+	}
+
+	if err := NewRunner(store, store, stringScanner{}).RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"clean":    storage.ScanStatusClean,
+		"infected": storage.ScanStatusInfected,
+		"missing":  storage.ScanStatusPending, // Retried on the next run
+		"done":     storage.ScanStatusClean,
+	}
+	for fileID, status := range want {
+		if got := store.files[fileID].ScanStatus; got != status {
+			t.Errorf("file %s scan status = %q, want %q", fileID, got, status)
+		}
+	}
+	if file := store.files["infected"]; file.ScanSignature != "EICAR" || file.ScannedAt == nil {
+		t.Errorf("infected file = %+v, want the signature and scan time recorded", file)
+	}
+}
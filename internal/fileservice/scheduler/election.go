@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// MinLeaseTTL is the shortest lease an elector can hold. The lease is renewed every third
+// of its TTL, and a shorter one would expire before a DynamoDB round trip could renew it.
+const MinLeaseTTL = 3 * time.Second
+
+// LeaseStore persists the leader lease. storage.MetadataStore implements it.
+type LeaseStore interface {
+	AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, owner string) error
+}
+
+// Elector competes for a named lease and reports whether this replica holds it
+type Elector struct {
+	store  LeaseStore
+	name   string
+	owner  string
+	ttl    time.Duration
+	leader atomic.Bool
+}
+
+// NewElector creates an elector for the lease name, identifying this replica as owner
+func NewElector(store LeaseStore, name, owner string, ttl time.Duration) *Elector {
+	return &Elector{
+		store: store,
+		name:  name,
+		owner: owner,
+		ttl:   ttl,
+	}
+}
+
+// Run renews or contests the lease every third of its TTL until ctx is cancelled,
+// then releases it so another replica can take over without waiting for expiry
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			if e.leader.Swap(false) {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.store.ReleaseLease(releaseCtx, e.name, e.owner); err != nil {
+					log.Printf("Warning: Failed to release leader lease: %v", err)
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsLeader reports whether this replica held the lease at the last renewal
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	acquired, err := e.store.AcquireLease(ctx, e.name, e.owner, e.ttl)
+	if ctx.Err() != nil {
+		return // Shutting down; Run releases the lease
+	}
+	if err != nil {
+		// Without a confirmed lease, step down rather than risk two leaders
+		log.Printf("Leader election: %v", err)
+		acquired = false
+	}
+	if was := e.leader.Swap(acquired); was != acquired {
+		if acquired {
+			log.Printf("Leader election: %s now leads %s", e.owner, e.name)
+		} else {
+			log.Printf("Leader election: %s lost %s", e.owner, e.name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package scheduler runs the file service's background jobs on fixed intervals. When several
+// replicas run, a DynamoDB lease elects one leader and only the leader runs jobs, so each
+// job executes once per interval across the fleet.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is how often each job checks whether it is due and this replica leads
+const defaultPollInterval = 5 * time.Second
+
+// Job is a named task run every Interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Leadership reports whether this replica should run jobs
+type Leadership interface {
+	IsLeader() bool
+}
+
+// Scheduler owns the background jobs
+type Scheduler struct {
+	leadership   Leadership // nil runs jobs unconditionally (single replica)
+	pollInterval time.Duration
+	jobs         []Job
+}
+
+// New creates a scheduler that only runs jobs while leadership reports this replica leads.
+// Pass nil when running a single replica.
+func New(leadership Leadership) *Scheduler {
+	return &Scheduler{
+		leadership:   leadership,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// Register adds a job; jobs with a non-positive interval are disabled
+func (s *Scheduler) Register(job Job) {
+	if job.Interval <= 0 {
+		log.Printf("Scheduler: job %s disabled (interval %s)", job.Name, job.Interval)
+		return
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every job as soon as this replica leads, then each time its interval
+// elapses, until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	poll := s.pollInterval
+	if job.Interval < poll {
+		poll = job.Interval
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	var next time.Time
+	for {
+		if now := time.Now(); !now.Before(next) && s.isLeader() {
+			next = now.Add(job.Interval)
+			s.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	started := time.Now()
+	if err := job.Run(ctx); err != nil {
+		log.Printf("Scheduler: job %s failed after %s: %v", job.Name, time.Since(started).Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("Scheduler: job %s finished in %s", job.Name, time.Since(started).Round(time.Millisecond))
+}
+
+func (s *Scheduler) isLeader() bool {
+	return s.leadership == nil || s.leadership.IsLeader()
+}
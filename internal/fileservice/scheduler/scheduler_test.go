@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fixedLeadership bool
+
+func (l fixedLeadership) IsLeader() bool { return bool(l) }
+
+func runFor(t *testing.T, s *Scheduler, d time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	s.Start(ctx)
+}
+
+func TestSchedulerRunsJobsOnlyOnLeader(t *testing.T) {
+	for _, leader := range []bool{true, false} {
+		var runs atomic.Int32
+		s := New(fixedLeadership(leader))
+		s.pollInterval = time.Millisecond
+		s.Register(Job{Name: "count", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			runs.Add(1)
+			return nil
+		}})
+		s.Register(Job{Name: "disabled", Interval: 0, Run: func(context.Context) error {
+			t.Error("disabled job ran")
+			return nil
+		}})
+
+		runFor(t, s, 55*time.Millisecond)
+		if got := runs.Load(); leader && got < 2 {
+			t.Errorf("leader ran job %d times, want at least 2", got)
+		} else if !leader && got != 0 {
+			t.Errorf("follower ran job %d times, want 0", got)
+		}
+	}
+}
+
+// fakeLeaseStore grants the lease to whichever owner asks first until it is released
+type fakeLeaseStore struct {
+	mu    sync.Mutex
+	owner string
+	err   error
+}
+
+func (f *fakeLeaseStore) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	if f.owner == "" || f.owner == owner {
+		f.owner = owner
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *fakeLeaseStore) ReleaseLease(ctx context.Context, name, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.owner == owner {
+		f.owner = ""
+	}
+	return nil
+}
+
+func TestElectorSingleLeader(t *testing.T) {
+	store := &fakeLeaseStore{}
+	a := NewElector(store, "jobs", "a", 30*time.Millisecond)
+	b := NewElector(store, "jobs", "b", 30*time.Millisecond)
+
+	a.campaign(context.Background())
+	b.campaign(context.Background())
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("a leads = %t, b leads = %t; want only a", a.IsLeader(), b.IsLeader())
+	}
+
+	// A store error makes the leader step down rather than assume it still holds the lease
+	store.err = errors.New("throttled")
+	a.campaign(context.Background())
+	if a.IsLeader() {
+		t.Error("leader kept leadership after failing to renew")
+	}
+
+	// Releasing on shutdown lets the other replica take over immediately
+	store.err = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	<-done
+	b.campaign(context.Background())
+	if !b.IsLeader() {
+		t.Error("standby did not take over after the leader released its lease")
+	}
+}
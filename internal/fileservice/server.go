@@ -3,42 +3,113 @@ package fileservice
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/analytics"
+	"vibe-drop/internal/fileservice/compaction"
 	"vibe-drop/internal/fileservice/config"
+	"vibe-drop/internal/fileservice/events"
+	"vibe-drop/internal/fileservice/grpcserver"
+	"vibe-drop/internal/fileservice/janitor"
+	"vibe-drop/internal/fileservice/reconcile"
 	"vibe-drop/internal/fileservice/routes"
+	"vibe-drop/internal/fileservice/scan"
+	"vibe-drop/internal/fileservice/scheduler"
 	"vibe-drop/internal/fileservice/storage"
+	"vibe-drop/internal/fileservice/transfer"
+	"vibe-drop/internal/fileservice/uploadwatch"
+	"vibe-drop/internal/fileservice/writeretry"
+	"vibe-drop/internal/telemetry"
 )
 
 var server *http.Server
+var grpcServer *grpc.Server
+var stopBackgroundJobs context.CancelFunc
+var shutdownTracing func(context.Context) error
 
 func Start() {
 	cfg := config.Load()
+	if err := common.SetupLogging("vibe-drop-fileservice", cfg.LogLevel); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	var err error
+	shutdownTracing, err = telemetry.Setup(context.Background(), telemetry.Config{
+		ServiceName:   "vibe-drop-fileservice",
+		OTLPEndpoint:  cfg.OTLPEndpoint,
+		SamplePercent: cfg.TraceSamplePercent,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
 	
-	// Initialize S3 client
-	s3Client, err := storage.NewS3Client(cfg.S3Bucket, cfg.S3Region, cfg.S3Endpoint)
+	// Initialize object storage
+	blobStore, err := newBlobStore(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create S3 client: %v", err)
+		log.Fatalf("Failed to create %s object store: %v", cfg.StorageBackend, err)
 	}
 
-	// Test S3 connection
-	if err := s3Client.TestConnection(context.Background()); err != nil {
-		log.Printf("Warning: S3 connection test failed: %v", err)
+	// Test object storage connection
+	if err := blobStore.TestConnection(context.Background()); err != nil {
+		log.Printf("Warning: %s connection test failed: %v", cfg.StorageBackend, err)
+	} else {
+		log.Printf("%s connection test successful", cfg.StorageBackend)
 	}
 
-	// Initialize DynamoDB client
-	dynamoClient, err := storage.NewDynamoClient(cfg.DynamoRegion, cfg.DynamoEndpoint)
+	// Initialize the metadata store
+	metadataStore, err := newMetadataStore(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create DynamoDB client: %v", err)
+		log.Fatalf("Failed to create %s metadata store: %v", cfg.MetadataBackend, err)
 	}
 
-	// Test DynamoDB connection
-	if err := dynamoClient.TestConnection(context.Background()); err != nil {
-		log.Printf("Warning: DynamoDB connection test failed: %v", err)
+	// Test metadata store connection
+	if err := metadataStore.TestConnection(context.Background()); err != nil {
+		log.Printf("Warning: %s connection test failed: %v", cfg.MetadataBackend, err)
+	} else {
+		log.Printf("%s connection test successful", cfg.MetadataBackend)
 	}
 	
-	router := routes.SetupRoutes(cfg, s3Client, dynamoClient)
+	// Start background jobs
+	jobsCtx, cancel := context.WithCancel(context.Background())
+	stopBackgroundJobs = cancel
+	go newScheduler(jobsCtx, cfg, blobStore, metadataStore).Start(jobsCtx)
+
+	// Every replica retries the upload metadata writes it failed to make
+	writeRetries := newWriteRetries(cfg, metadataStore)
+	go writeRetries.Run(jobsCtx)
+	
+	bus, err := newEventBus(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create %s event bus: %v", cfg.EventBus, err)
+	}
+
+	router := routes.SetupRoutes(cfg, blobStore, metadataStore, writeRetries, bus)
+
+	if cfg.GRPCPort != "" {
+		listener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC on port %s: %v", cfg.GRPCPort, err)
+		}
+		grpcServer = grpcserver.New(router)
+		go func() {
+			log.Printf("File Service gRPC API starting on port %s...", cfg.GRPCPort)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("File Service gRPC API stopped: %v", err)
+			}
+		}()
+	}
 
 	server = &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -51,7 +122,151 @@ func Start() {
 	}
 }
 
+// storageTimeouts bounds the DynamoDB and S3 calls
+func storageTimeouts(cfg *config.Config) storage.Timeouts {
+	return storage.Timeouts{Operation: cfg.StorageOperationTimeout, Transfer: cfg.StorageTransferTimeout}
+}
+
+// assumedRole is the IAM role the S3 and DynamoDB clients assume, if any
+func assumedRole(cfg *config.Config) storage.AssumeRole {
+	return storage.AssumeRole{
+		RoleARN:     cfg.AWSRoleARN,
+		ExternalID:  cfg.AWSRoleExternalID,
+		SessionName: cfg.AWSRoleSessionName,
+		Duration:    cfg.AWSRoleDuration,
+		STSEndpoint: cfg.AWSSTSEndpoint,
+	}
+}
+
+// newBlobStore creates the object store STORAGE_BACKEND selects
+func newBlobStore(cfg *config.Config) (storage.BlobStore, error) {
+	switch cfg.StorageBackend {
+	case storage.BackendMinIO:
+		return storage.NewMinIOClient(cfg.MinIOEndpoint, cfg.MinIOAccessKey, cfg.MinIOSecretKey, cfg.S3Bucket, cfg.S3Region, storageTimeouts(cfg), cfg.S3ShardBuckets...)
+	case storage.BackendFilesystem:
+		return storage.NewFSStore(cfg.StorageFSRoot, cfg.StorageFSPublicURL, []byte(cfg.StorageFSSigningKey), cfg.S3Bucket, cfg.S3ShardBuckets...)
+	default:
+		return storage.NewS3Client(cfg.S3Bucket, cfg.S3Region, cfg.S3Endpoint, storageTimeouts(cfg), assumedRole(cfg), cfg.S3ShardBuckets...)
+	}
+}
+
+// newMetadataStore creates the metadata store METADATA_BACKEND selects
+func newMetadataStore(cfg *config.Config) (storage.MetadataStore, error) {
+	switch cfg.MetadataBackend {
+	case storage.MetadataBackendPostgres:
+		return storage.NewPostgresClient(cfg.PostgresDSN)
+	default:
+		return storage.NewDynamoClient(cfg.DynamoRegion, cfg.DynamoEndpoint, storageTimeouts(cfg), assumedRole(cfg))
+	}
+}
+
+// newEventBus creates the bus EVENT_BUS selects, or nil to publish nothing. SNS and SQS are
+// reached with the default credential chain, or LocalStack's test keys with EVENT_ENDPOINT.
+func newEventBus(cfg *config.Config) (events.Publisher, error) {
+	if cfg.EventBus == "" {
+		return nil, nil
+	}
+	if cfg.EventBus == events.BusMemory {
+		bus := events.NewBus()
+		bus.Subscribe("", events.LogEvent)
+		return bus, nil
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.EventRegion)}
+	if cfg.EventEndpoint != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EventBus == events.BusSNS {
+		return events.NewSNSPublisher(sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+			if cfg.EventEndpoint != "" {
+				o.BaseEndpoint = aws.String(cfg.EventEndpoint)
+			}
+		}), cfg.EventTopicARN), nil
+	}
+	return events.NewSQSPublisher(sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.EventEndpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.EventEndpoint)
+		}
+	}), cfg.EventQueueURL), nil
+}
+
+// newWriteRetries creates the queue failed upload metadata writes are retried from
+func newWriteRetries(cfg *config.Config, metadataStore storage.MetadataStore) *writeretry.Queue {
+	queue := writeretry.NewQueue(metadataStore, writeretry.Backoff{
+		Initial:     cfg.WriteRetryInitialBackoff,
+		Max:         cfg.WriteRetryMaxBackoff,
+		MaxAttempts: cfg.WriteRetryMaxAttempts,
+	})
+	if cfg.WriteRetryAlertWebhookURL != "" {
+		queue.OnExhausted(writeretry.NewWebhookNotifier(cfg.WriteRetryAlertWebhookURL))
+	}
+	return queue
+}
+
+// newScheduler registers the background jobs. With leader election on, only the replica
+// holding the metadata store's lease runs them.
+func newScheduler(ctx context.Context, cfg *config.Config, blobStore storage.BlobStore, metadataStore storage.MetadataStore) *scheduler.Scheduler {
+	var leadership scheduler.Leadership
+	if cfg.LeaderElection {
+		hostname, _ := os.Hostname()
+		owner := hostname + "-" + uuid.New().String()[:8]
+		elector := scheduler.NewElector(metadataStore, "fileservice-scheduler", owner, cfg.LeaderLeaseTTL)
+		go elector.Run(ctx)
+		leadership = elector
+	}
+
+	sched := scheduler.New(leadership)
+
+	aggregator := analytics.NewAggregator(metadataStore, cfg.StuckUploadAfter)
+	sched.Register(scheduler.Job{Name: "analytics", Interval: cfg.AnalyticsInterval, Run: aggregator.RunOnce})
+
+	reconciler := reconcile.NewReconciler(blobStore, metadataStore, cfg.ReconcileGracePeriod)
+	sched.Register(scheduler.Job{Name: "reconcile", Interval: cfg.ReconcileInterval, Run: func(ctx context.Context) error {
+		_, err := reconciler.RunOnce(ctx, cfg.ReconcileAutoRepair)
+		return err
+	}})
+
+	uploadJanitor := janitor.NewJanitor(blobStore, metadataStore, cfg.StaleUploadAbortAfter)
+	sched.Register(scheduler.Job{Name: "upload-janitor", Interval: cfg.UploadJanitorInterval, Run: uploadJanitor.RunOnce})
+
+	if cfg.UploadNoticeWebhookURL != "" {
+		watcher := uploadwatch.NewWatcher(metadataStore, cfg.UploadNoticeThresholds(), uploadwatch.NewWebhookNotifier(cfg.UploadNoticeWebhookURL))
+		sched.Register(scheduler.Job{Name: "upload-watch", Interval: cfg.UploadWatchInterval, Run: watcher.RunOnce})
+	}
+
+	compactor := compaction.NewCompactor(metadataStore, cfg.ChunkRecordRetention)
+	sched.Register(scheduler.Job{Name: "chunk-compaction", Interval: cfg.ChunkCompactionInterval, Run: compactor.RunOnce})
+
+	// DynamoDB's TTL removes expired login attempts itself; PostgreSQL needs them purged
+	sched.Register(scheduler.Job{Name: "login-attempt-purge", Interval: cfg.LoginFailureWindow, Run: func(ctx context.Context) error {
+		_, err := metadataStore.PurgeExpiredLoginAttempts(ctx, time.Now())
+		return err
+	}})
+
+	transfers := transfer.NewRunner(blobStore, metadataStore)
+	sched.Register(scheduler.Job{Name: "ownership-transfers", Interval: cfg.OwnershipTransferInterval, Run: transfers.RunOnce})
+
+	if cfg.VirusScanner != "" {
+		scanner, err := scan.New(cfg.VirusScanner, cfg.ClamAVAddress, cfg.VirusScanAPIURL, cfg.VirusScanAPIKey, cfg.VirusScanTimeout)
+		if err != nil {
+			log.Fatalf("Failed to create virus scanner: %v", err)
+		}
+		scans := scan.NewRunner(blobStore, metadataStore, scanner)
+		sched.Register(scheduler.Job{Name: "virus-scan", Interval: cfg.VirusScanInterval, Run: scans.RunOnce})
+	}
+
+	return sched
+}
+
 func Stop() {
+	if stopBackgroundJobs != nil {
+		stopBackgroundJobs()
+	}
+
 	if server != nil {
 		log.Println("Shutting down File Service...")
 		
@@ -64,4 +279,26 @@ func Stop() {
 			log.Println("File Service stopped gracefully")
 		}
 	}
+
+	if grpcServer != nil {
+		// Let calls in progress finish, as the HTTP server does, for up to 30 seconds
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(30 * time.Second):
+			grpcServer.Stop()
+		}
+	}
+
+	if shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}
 }
\ No newline at end of file
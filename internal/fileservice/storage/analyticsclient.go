@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// UserAnalytics is a precomputed snapshot of a user's storage usage
+type UserAnalytics struct {
+	UserID        string                      `json:"user_id" dynamodbav:"userID"`
+	TotalBytes    int64                       `json:"total_bytes" dynamodbav:"totalBytes"`
+	FileCount     int                         `json:"file_count" dynamodbav:"fileCount"`
+	ByContentType map[string]ContentTypeStats `json:"by_content_type" dynamodbav:"byContentType"`
+	SizeHistogram []HistogramBucket           `json:"size_histogram" dynamodbav:"sizeHistogram"`
+	Growth        []GrowthPoint               `json:"growth" dynamodbav:"growth"`
+	ComputedAt    string                      `json:"computed_at" dynamodbav:"computedAt"`
+}
+
+// ContentTypeStats holds file count and bytes for a single content type
+type ContentTypeStats struct {
+	Count int   `json:"count" dynamodbav:"count"`
+	Bytes int64 `json:"bytes" dynamodbav:"bytes"`
+}
+
+// HistogramBucket counts files whose size falls in [MinBytes, MaxBytes)
+type HistogramBucket struct {
+	Label    string `json:"label" dynamodbav:"label"`
+	MinBytes int64  `json:"min_bytes" dynamodbav:"minBytes"`
+	MaxBytes int64  `json:"max_bytes,omitempty" dynamodbav:"maxBytes,omitempty"` // 0 means unbounded
+	Count    int    `json:"count" dynamodbav:"count"`
+}
+
+// GrowthPoint records storage added on a given day and the running total
+type GrowthPoint struct {
+	Date            string `json:"date" dynamodbav:"date"` // YYYY-MM-DD
+	FilesAdded      int    `json:"files_added" dynamodbav:"filesAdded"`
+	BytesAdded      int64  `json:"bytes_added" dynamodbav:"bytesAdded"`
+	CumulativeBytes int64  `json:"cumulative_bytes" dynamodbav:"cumulativeBytes"`
+}
+
+// ListAllFiles scans every file metadata record, following pagination
+func (d *DynamoClient) ListAllFiles(ctx context.Context) ([]FileMetadata, error) {
+	var files []FileMetadata
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName: aws.String("vibe-drop-files"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to scan files: %w", err))
+		}
+
+		var pageFiles []FileMetadata
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageFiles); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal files: %w", err)
+		}
+		files = append(files, pageFiles...)
+	}
+
+	return files, nil
+}
+
+// SaveUserAnalytics stores the latest analytics snapshot for a user
+func (d *DynamoClient) SaveUserAnalytics(ctx context.Context, analytics *UserAnalytics) error {
+	item, err := attributevalue.MarshalMap(analytics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal analytics: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save analytics: %w", err))
+	}
+
+	return nil
+}
+
+// GetUserAnalytics retrieves the latest analytics snapshot for a user
+func (d *DynamoClient) GetUserAnalytics(ctx context.Context, userID string) (*UserAnalytics, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Key: map[string]types.AttributeValue{
+			"userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get analytics: %w", err))
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("analytics %w for user: %s", ErrNotFound, userID)
+	}
+
+	var analytics UserAnalytics
+	if err := attributevalue.UnmarshalMap(result.Item, &analytics); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal analytics: %w", err)
+	}
+
+	return &analytics, nil
+}
+
+// systemMetricsKey is the reserved analytics item holding system-wide metrics
+const systemMetricsKey = "system"
+
+// SystemMetrics is a precomputed snapshot of system-wide operational metrics
+type SystemMetrics struct {
+	Key               string        `json:"-" dynamodbav:"userID"`
+	TotalBytes        int64         `json:"total_bytes" dynamodbav:"totalBytes"`
+	TotalFiles        int           `json:"total_files" dynamodbav:"totalFiles"`
+	TotalUsers        int           `json:"total_users" dynamodbav:"totalUsers"`
+	UploadsPerDay     []DailyCount  `json:"uploads_per_day" dynamodbav:"uploadsPerDay"`
+	FailedCompletions int           `json:"failed_completions" dynamodbav:"failedCompletions"`
+	StuckUploads      []StuckUpload `json:"stuck_uploads" dynamodbav:"stuckUploads"`
+	TopUsers          []UserStorage `json:"top_users" dynamodbav:"topUsers"`
+	// Uploads started within the window, by the client that declared itself in X-Client-Info
+	ClientVersions      []ClientVersionUsage `json:"client_versions" dynamodbav:"clientVersions"`
+	UnidentifiedUploads int                  `json:"unidentified_uploads" dynamodbav:"unidentifiedUploads"` // Sent without the header
+	ComputedAt          string               `json:"computed_at" dynamodbav:"computedAt"`
+}
+
+// ClientVersionUsage counts recent uploads from one app version on one platform
+type ClientVersionUsage struct {
+	App        string `json:"app" dynamodbav:"app"`
+	Version    string `json:"version" dynamodbav:"version"`
+	Platform   string `json:"platform,omitempty" dynamodbav:"platform,omitempty"`
+	Uploads    int    `json:"uploads" dynamodbav:"uploads"`
+	Users      int    `json:"users" dynamodbav:"users"`
+	LastSeenAt string `json:"last_seen_at" dynamodbav:"lastSeenAt"`
+}
+
+// DailyCount is the number of uploads started on a given day
+type DailyCount struct {
+	Date  string `json:"date" dynamodbav:"date"` // YYYY-MM-DD
+	Count int    `json:"count" dynamodbav:"count"`
+}
+
+// StuckUpload is an upload that has stayed in "uploading" past the configured threshold
+type StuckUpload struct {
+	FileID     string `json:"file_id" dynamodbav:"fileID"`
+	UserID     string `json:"user_id" dynamodbav:"userID"`
+	UploadType string `json:"upload_type" dynamodbav:"uploadType"`
+	UploadedAt string `json:"uploaded_at" dynamodbav:"uploadedAt"`
+}
+
+// UserStorage is a user's total stored bytes
+type UserStorage struct {
+	UserID     string `json:"user_id" dynamodbav:"userID"`
+	TotalBytes int64  `json:"total_bytes" dynamodbav:"totalBytes"`
+	FileCount  int    `json:"file_count" dynamodbav:"fileCount"`
+}
+
+// SaveSystemMetrics stores the latest system-wide metrics snapshot
+func (d *DynamoClient) SaveSystemMetrics(ctx context.Context, metrics *SystemMetrics) error {
+	metrics.Key = systemMetricsKey
+	item, err := attributevalue.MarshalMap(metrics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal system metrics: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save system metrics: %w", err))
+	}
+
+	return nil
+}
+
+// GetSystemMetrics retrieves the latest system-wide metrics snapshot
+func (d *DynamoClient) GetSystemMetrics(ctx context.Context) (*SystemMetrics, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Key: map[string]types.AttributeValue{
+			"userID": &types.AttributeValueMemberS{Value: systemMetricsKey},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get system metrics: %w", err))
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("system metrics not computed yet: %w", ErrNotFound)
+	}
+
+	var metrics SystemMetrics
+	if err := attributevalue.UnmarshalMap(result.Item, &metrics); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal system metrics: %w", err)
+	}
+
+	return &metrics, nil
+}
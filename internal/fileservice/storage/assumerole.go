@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// DefaultRoleSessionName names the file service's sessions in CloudTrail when the
+// configuration doesn't
+const DefaultRoleSessionName = "vibe-drop-fileservice"
+
+// roleCredentialsRefreshWindow is how long before assumed credentials expire that they're
+// replaced, so no call is signed with credentials about to lapse
+const roleCredentialsRefreshWindow = 5 * time.Minute
+
+// AssumeRole is an IAM role the S3 and DynamoDB clients assume, so the file service can
+// run in one AWS account and keep its data in another. The role is assumed with the
+// default credential chain (environment, shared config or the instance's role), and its
+// credentials are renewed before they expire. The zero value assumes no role.
+type AssumeRole struct {
+	RoleARN     string
+	ExternalID  string        // Sent when assuming the role, if its trust policy requires one
+	SessionName string        // DefaultRoleSessionName if empty
+	Duration    time.Duration // Lifetime of each set of credentials; 0 means STS's default of 1h
+	STSEndpoint string        // For LocalStack; empty uses AWS STS
+}
+
+// credentials is what a client in region signs with: the role's credentials if a role is
+// set, otherwise fallback
+func (r AssumeRole) credentials(region string, fallback aws.CredentialsProvider) (aws.CredentialsProvider, error) {
+	if r.RoleARN == "" {
+		return fallback, nil
+	}
+
+	base, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config to assume %s: %w", r.RoleARN, err)
+	}
+	traceAWS(&base)
+	client := sts.NewFromConfig(base, func(o *sts.Options) {
+		if r.STSEndpoint != "" {
+			o.BaseEndpoint = aws.String(r.STSEndpoint)
+		}
+	})
+
+	provider := stscreds.NewAssumeRoleProvider(client, r.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = r.SessionName
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = DefaultRoleSessionName
+		}
+		if r.ExternalID != "" {
+			o.ExternalID = aws.String(r.ExternalID)
+		}
+		if r.Duration > 0 {
+			o.Duration = r.Duration
+		}
+	})
+	return aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = roleCredentialsRefreshWindow
+	}), nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// BlockManifestTTL is how long DynamoDB keeps a file's block manifest. A file's content
+// never changes, so a manifest stays right for as long as the file exists; the TTL only
+// clears out manifests of deleted files. PostgreSQL deletes them with the file.
+const BlockManifestTTL = 30 * 24 * time.Hour
+
+// BlockManifest is a file's checksums block by block, kept so delta uploads against the
+// file don't read it all again
+type BlockManifest struct {
+	FileID    string `json:"file_id" dynamodbav:"fileID"`
+	BlockSize int64  `json:"block_size" dynamodbav:"blockSize"`
+	Blocks    []byte `json:"blocks" dynamodbav:"blocks"` // Packed by delta.Encode
+	CreatedAt string `json:"created_at" dynamodbav:"createdAt"`
+	// Unix time after which the record is removed (the table's TTL attribute)
+	ExpiresAt int64 `json:"expires_at" dynamodbav:"expiresAt"`
+}
+
+// GetBlockManifest returns a file's block manifest, or ErrNotFound if none is stored
+func (d *DynamoClient) GetBlockManifest(ctx context.Context, fileID string) (*BlockManifest, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-block-manifests"),
+		Key: map[string]types.AttributeValue{
+			"fileID": &types.AttributeValueMemberS{Value: fileID},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get block manifest: %w", err))
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("block manifest %w: %s", ErrNotFound, fileID)
+	}
+
+	var manifest BlockManifest
+	if err := attributevalue.UnmarshalMap(result.Item, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// SaveBlockManifest replaces a file's block manifest
+func (d *DynamoClient) SaveBlockManifest(ctx context.Context, manifest *BlockManifest) error {
+	item, err := attributevalue.MarshalMap(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block manifest: %w", err)
+	}
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-block-manifests"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save block manifest: %w", err))
+	}
+	return nil
+}
+
+// GetBlockManifest returns a file's block manifest, or ErrNotFound if none is stored
+func (p *PostgresClient) GetBlockManifest(ctx context.Context, fileID string) (*BlockManifest, error) {
+	manifest := BlockManifest{FileID: fileID}
+	err := p.pool.QueryRow(ctx, `
+		SELECT block_size, blocks, created_at FROM block_manifests WHERE file_id = $1`,
+		fileID).Scan(&manifest.BlockSize, &manifest.Blocks, &manifest.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("block manifest %w: %s", ErrNotFound, fileID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get block manifest: %w", err))
+	}
+	return &manifest, nil
+}
+
+// SaveBlockManifest replaces a file's block manifest. ExpiresAt isn't stored, since the
+// manifest goes when its file's row does.
+func (p *PostgresClient) SaveBlockManifest(ctx context.Context, manifest *BlockManifest) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO block_manifests (file_id, block_size, blocks, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (file_id) DO UPDATE SET block_size = EXCLUDED.block_size, blocks = EXCLUDED.blocks, created_at = EXCLUDED.created_at`,
+		manifest.FileID, manifest.BlockSize, manifest.Blocks, manifest.CreatedAt)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save block manifest: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Checksum algorithms a client may declare for an upload
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC32C = "crc32c"
+)
+
+// Checksum is a whole-object checksum declared by the client. Value is base64 encoded, as
+// S3 reports it. The zero value means the upload has no checksum.
+type Checksum struct {
+	Algorithm string
+	Value     string
+}
+
+// IsZero reports whether no checksum was declared
+func (c Checksum) IsZero() bool {
+	return c.Algorithm == ""
+}
+
+// Header is the request header that carries the checksum on a PUT to S3
+func (c Checksum) Header() string {
+	return "x-amz-checksum-" + c.Algorithm
+}
+
+// ChecksumOf is the checksum recorded for a file
+func ChecksumOf(metadata *FileMetadata) Checksum {
+	return Checksum{Algorithm: metadata.ChecksumAlgorithm, Value: metadata.Checksum}
+}
+
+// ErrChecksumMismatch is returned when S3 rejects an upload whose content doesn't match
+// its declared checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ObjectChecksum returns the checksum S3 computed for an object with the given algorithm,
+// "" if it has none, or ErrObjectNotFound if nothing is stored under the key yet.
+func (s *S3Client) ObjectChecksum(ctx context.Context, bucket, s3Key, algorithm string) (string, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(s.ResolveBucket(bucket)),
+		Key:          aws.String(s3Key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return "", ErrObjectNotFound
+		}
+		return "", classify(fmt.Errorf("failed to read S3 object checksum: %w", err))
+	}
+
+	var value *string
+	switch algorithm {
+	case ChecksumSHA256:
+		value = result.ChecksumSHA256
+	case ChecksumCRC32C:
+		value = result.ChecksumCRC32C
+	}
+	return aws.ToString(value), nil
+}
+
+// isChecksumMismatch reports whether S3 rejected a request because the content didn't match
+// the checksum it was sent with
+func isChecksumMismatch(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "BadDigest"
+}
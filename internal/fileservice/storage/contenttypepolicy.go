@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"vibe-drop/internal/common"
+)
+
+// contentTypePolicyKey is the reserved analytics item holding the admin-set content type policy
+const contentTypePolicyKey = "content-type-policy"
+
+// ErrNoContentTypePolicy is returned when no admin has set a content type policy
+var ErrNoContentTypePolicy = errors.New("no content type policy set")
+
+// ContentTypePolicyRecord is a content type policy set through the admin API
+type ContentTypePolicyRecord struct {
+	Policy    common.ContentTypePolicy
+	UpdatedAt string
+}
+
+// storedContentTypePolicy is the item layout; the policy is kept as JSON so its shape can
+// grow without a migration
+type storedContentTypePolicy struct {
+	Key       string `dynamodbav:"userID"`
+	Policy    string `dynamodbav:"policy"`
+	UpdatedAt string `dynamodbav:"updatedAt"`
+}
+
+func contentTypePolicyItemKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"userID": &types.AttributeValueMemberS{Value: contentTypePolicyKey},
+	}
+}
+
+// SaveContentTypePolicy stores the policy uploads are checked against, replacing any earlier one
+func (d *DynamoClient) SaveContentTypePolicy(ctx context.Context, record *ContentTypePolicyRecord) error {
+	policy, err := json.Marshal(record.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode content type policy: %w", err)
+	}
+	item, err := attributevalue.MarshalMap(storedContentTypePolicy{
+		Key:       contentTypePolicyKey,
+		Policy:    string(policy),
+		UpdatedAt: record.UpdatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal content type policy: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save content type policy: %w", err))
+	}
+	return nil
+}
+
+// GetContentTypePolicy retrieves the admin-set policy, or ErrNoContentTypePolicy if there is none
+func (d *DynamoClient) GetContentTypePolicy(ctx context.Context) (*ContentTypePolicyRecord, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Key:       contentTypePolicyItemKey(),
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get content type policy: %w", err))
+	}
+	if result.Item == nil {
+		return nil, ErrNoContentTypePolicy
+	}
+
+	var stored storedContentTypePolicy
+	if err := attributevalue.UnmarshalMap(result.Item, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal content type policy: %w", err)
+	}
+	policy, err := common.ParseContentTypePolicy([]byte(stored.Policy))
+	if err != nil {
+		return nil, err
+	}
+	return &ContentTypePolicyRecord{Policy: policy, UpdatedAt: stored.UpdatedAt}, nil
+}
+
+// DeleteContentTypePolicy removes the admin-set policy so the configured one applies again
+func (d *DynamoClient) DeleteContentTypePolicy(ctx context.Context) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Key:       contentTypePolicyItemKey(),
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete content type policy: %w", err))
+	}
+	return nil
+}
@@ -2,8 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,16 +15,36 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"vibe-drop/internal/common"
 )
 
 type DynamoClient struct {
 	client *dynamodb.Client
 }
 
+// File status values stored in FileMetadata.Status
+const (
+	FileStatusUploading        = "uploading"
+	FileStatusCompleted        = "completed"
+	FileStatusCompletionFailed = "completion_failed" // S3 rejected CompleteMultipartUpload
+	FileStatusQuarantined      = "quarantined"       // Held back by the executable policy
+	FileStatusCorrupt          = "corrupt"           // Content didn't match the declared checksum
+)
+
+// Virus scan status values stored in FileMetadata.ScanStatus; empty means never queued
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+)
+
 // FileMetadata represents the structure for file metadata in DynamoDB
 type FileMetadata struct {
 	FileID      string `json:"fileID" dynamodbav:"fileID"`
-	Filename    string `json:"filename" dynamodbav:"filename"`
+	Filename    string `json:"filename" dynamodbav:"filename"` // Normalized (common.NormalizeFilename)
+	// The filename as uploaded, kept only when normalizing changed it
+	OriginalFilename string `json:"originalFilename,omitempty" dynamodbav:"originalFilename,omitempty"`
 	TotalSize   int64  `json:"totalSize" dynamodbav:"totalSize"`
 	ContentType string `json:"contentType" dynamodbav:"contentType"`
 	Status      string `json:"status" dynamodbav:"status"`
@@ -29,21 +52,80 @@ type FileMetadata struct {
 	UploadedAt  string `json:"uploadedAt" dynamodbav:"uploadedAt"`
 	UserID      string `json:"userID" dynamodbav:"userID"`
 	S3Key       string `json:"s3Key" dynamodbav:"s3Key"`
+	// Shard bucket holding the object; empty for files stored before sharding (default bucket)
+	Bucket      string `json:"bucket,omitempty" dynamodbav:"bucket,omitempty"`
 	// Future chunking fields (will be empty for single uploads)
 	S3UploadID   *string `json:"s3UploadId,omitempty" dynamodbav:"s3UploadId,omitempty"`
 	ChunkSize    *int64  `json:"chunkSize,omitempty" dynamodbav:"chunkSize,omitempty"`
 	TotalChunks  *int    `json:"totalChunks,omitempty" dynamodbav:"totalChunks,omitempty"`
 	CompletedAt  *string `json:"completedAt,omitempty" dynamodbav:"completedAt,omitempty"`
+	// Set each time a download URL is issued for the file
+	LastAccessedAt *string `json:"lastAccessedAt,omitempty" dynamodbav:"lastAccessedAt,omitempty"`
+	// Set on a file uploaded as a new version of a same-named one (version 2 onwards)
+	Version           int    `json:"version,omitempty" dynamodbav:"version,omitempty"`
+	PreviousVersionID string `json:"previousVersionId,omitempty" dynamodbav:"previousVersionId,omitempty"`
+	// Why the executable policy quarantined the file; set only while it is quarantined
+	QuarantineReason *string `json:"quarantineReason,omitempty" dynamodbav:"quarantineReason,omitempty"`
+	// Whole-object checksum the client declared (base64, as S3 reports it)
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty" dynamodbav:"checksumAlgorithm,omitempty"`
+	Checksum          string `json:"checksum,omitempty" dynamodbav:"checksum,omitempty"`
+	// Why verification marked the file corrupt
+	CorruptReason *string `json:"corruptReason,omitempty" dynamodbav:"corruptReason,omitempty"`
+	// Set for background uploads: the lifetime in seconds of their single-use upload URLs
+	UploadURLTTL int64 `json:"uploadUrlTTL,omitempty" dynamodbav:"uploadUrlTTL,omitempty"`
+	// For a background single upload, when the first PUT was seen and its URL retired
+	UploadConsumedAt *string `json:"uploadConsumedAt,omitempty" dynamodbav:"uploadConsumedAt,omitempty"`
+	// The S3 event sequencer of that first PUT, to tell redelivered events from reuse
+	UploadSequencer string `json:"uploadSequencer,omitempty" dynamodbav:"uploadSequencer,omitempty"`
+	// For any other single upload, when its first PUT was reported, so it's only reported once
+	UploadReportedAt *string `json:"uploadReportedAt,omitempty" dynamodbav:"uploadReportedAt,omitempty"`
+	// Virus scanning: pending until the scan job has checked the stored content
+	ScanStatus    string  `json:"scanStatus,omitempty" dynamodbav:"scanStatus,omitempty"`
+	ScanSignature string  `json:"scanSignature,omitempty" dynamodbav:"scanSignature,omitempty"` // What an infected file matched
+	ScannedAt     *string `json:"scannedAt,omitempty" dynamodbav:"scannedAt,omitempty"`
+	// The client that started the upload, if it sent X-Client-Info
+	Client *common.ClientInfo `json:"client,omitempty" dynamodbav:"client,omitempty"`
+	// A completed multipart upload's chunk records, rolled up so the records can expire
+	ChunkSummary *ChunkSummary `json:"chunkSummary,omitempty" dynamodbav:"chunkSummary,omitempty"`
+	// Multipart: how many chunks are marked uploaded, kept up to date by UpdateChunkStatus
+	UploadedParts int `json:"uploadedParts,omitempty" dynamodbav:"uploadedParts,omitempty"`
+	// The owner's tags: keys with optional values (common.ValidateFileTags)
+	Tags map[string]string `json:"tags,omitempty" dynamodbav:"tags,omitempty"`
+	// The API key the upload was started with, whose callback hears when it completes
+	APIKeyID string `json:"apiKeyId,omitempty" dynamodbav:"apiKeyId,omitempty"`
+}
+
+// IsBackgroundUpload reports whether the file was uploaded with long-lived single-use URLs
+func (m *FileMetadata) IsBackgroundUpload() bool {
+	return m.UploadURLTTL > 0
+}
+
+// AllPartsCounted reports whether the uploaded-parts counter has reached the file's chunk
+// count. It is a cheap hint that the upload may be complete; CheckUploadComplete has the
+// final say, since the counter can fall behind (e.g. for parts uploaded before it existed).
+func (m *FileMetadata) AllPartsCounted() bool {
+	return m.TotalChunks != nil && m.UploadedParts >= *m.TotalChunks
 }
 
-func NewDynamoClient(region, endpoint string) (*DynamoClient, error) {
+// UploadURLExpiry is how long the file's upload and part URLs stay valid
+func (m *FileMetadata) UploadURLExpiry() time.Duration {
+	return urlExpiry(time.Duration(m.UploadURLTTL) * time.Second)
+}
+
+// NewDynamoClient creates a client whose calls each take at most timeouts.Operation. If
+// role names a role, the client signs with its credentials.
+func NewDynamoClient(region, endpoint string, timeouts Timeouts, role AssumeRole) (*DynamoClient, error) {
 	// For LocalStack, we need to provide fake credentials
 	// In production, these would come from AWS IAM roles or environment variables
-	creds := credentials.NewStaticCredentialsProvider(
+	static := credentials.NewStaticCredentialsProvider(
 		"test",      // Access Key ID (fake for LocalStack)
 		"test",      // Secret Access Key (fake for LocalStack)
 		"",          // Session Token (not needed)
 	)
+	creds, err := role.credentials(region, static)
+	if err != nil {
+		return nil, err
+	}
 
 	// Load AWS configuration
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
@@ -53,6 +135,8 @@ func NewDynamoClient(region, endpoint string) (*DynamoClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	traceAWS(&cfg)
+	boundAWS(&cfg, timeouts)
 
 	// Create DynamoDB client with custom endpoint for LocalStack
 	dynamoClient := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
@@ -73,9 +157,8 @@ func NewDynamoClient(region, endpoint string) (*DynamoClient, error) {
 func (d *DynamoClient) TestConnection(ctx context.Context) error {
 	_, err := d.client.ListTables(ctx, &dynamodb.ListTablesInput{})
 	if err != nil {
-		return fmt.Errorf("failed to connect to DynamoDB: %w", err)
+		return classify(fmt.Errorf("failed to connect to DynamoDB: %w", err))
 	}
-	log.Println("DynamoDB connection test successful")
 	return nil
 }
 
@@ -93,7 +176,7 @@ func (d *DynamoClient) SaveFileMetadata(ctx context.Context, metadata *FileMetad
 		Item:      item,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to save file metadata: %w", err)
+		return classify(fmt.Errorf("failed to save file metadata: %w", err))
 	}
 
 	log.Printf("Saved file metadata for fileID: %s", metadata.FileID)
@@ -109,11 +192,11 @@ func (d *DynamoClient) GetFileMetadata(ctx context.Context, fileID string) (*Fil
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file metadata: %w", err)
+		return nil, classify(fmt.Errorf("failed to get file metadata: %w", err))
 	}
 
 	if result.Item == nil {
-		return nil, fmt.Errorf("file not found: %s", fileID)
+		return nil, fmt.Errorf("file %w: %s", ErrNotFound, fileID)
 	}
 
 	var metadata FileMetadata
@@ -137,7 +220,7 @@ func (d *DynamoClient) ListUserFiles(ctx context.Context, userID string) ([]File
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list user files: %w", err)
+		return nil, classify(fmt.Errorf("failed to list user files: %w", err))
 	}
 
 	var files []FileMetadata
@@ -154,6 +237,131 @@ func (d *DynamoClient) ListUserFiles(ctx context.Context, userID string) ([]File
 	return files, nil
 }
 
+// ListFilesPendingScan returns the files waiting for a virus scan
+func (d *DynamoClient) ListFilesPendingScan(ctx context.Context) ([]FileMetadata, error) {
+	var files []FileMetadata
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName:        aws.String("vibe-drop-files"),
+		FilterExpression: aws.String("scanStatus = :pending"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: ScanStatusPending},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to scan files pending a virus scan: %w", err))
+		}
+
+		var pageFiles []FileMetadata
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageFiles); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal files: %w", err)
+		}
+		files = append(files, pageFiles...)
+	}
+	return files, nil
+}
+
+// ListRecentFiles retrieves a user's files ordered by most recent access, newest first
+func (d *DynamoClient) ListRecentFiles(ctx context.Context, userID string, limit int) ([]FileMetadata, error) {
+	// Same scan approach as ListUserFiles, restricted to files that have been accessed
+	result, err := d.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("vibe-drop-files"),
+		FilterExpression: aws.String("userID = :userID AND attribute_exists(lastAccessedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list recent files: %w", err))
+	}
+
+	var files []FileMetadata
+	for _, item := range result.Items {
+		var metadata FileMetadata
+		err = attributevalue.UnmarshalMap(item, &metadata)
+		if err != nil {
+			log.Printf("Failed to unmarshal item: %v", err)
+			continue
+		}
+		files = append(files, metadata)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return accessTime(files[i]).After(accessTime(files[j]))
+	})
+
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+
+	return files, nil
+}
+
+// RecordFileAccess stamps the file's lastAccessedAt with the current time
+func (d *DynamoClient) RecordFileAccess(ctx context.Context, fileID string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("vibe-drop-files"),
+		Key: map[string]types.AttributeValue{
+			"fileID": &types.AttributeValueMemberS{Value: fileID},
+		},
+		UpdateExpression: aws.String("SET lastAccessedAt = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+		},
+		ConditionExpression: aws.String("attribute_exists(fileID)"),
+	})
+	if errors.Is(classify(err), ErrConditionFailed) {
+		return fmt.Errorf("failed to record file access: file %w: %s", ErrNotFound, fileID)
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to record file access: %w", err))
+	}
+
+	return nil
+}
+
+// SetFileTags replaces a file's tags, leaving the rest of its metadata as it is. No tags
+// removes them.
+func (d *DynamoClient) SetFileTags(ctx context.Context, fileID string, tags map[string]string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("vibe-drop-files"),
+		Key: map[string]types.AttributeValue{
+			"fileID": &types.AttributeValueMemberS{Value: fileID},
+		},
+		UpdateExpression:    aws.String("REMOVE tags"),
+		ConditionExpression: aws.String("attribute_exists(fileID)"),
+	}
+	if len(tags) > 0 {
+		value, err := attributevalue.Marshal(tags)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tags: %w", err)
+		}
+		input.UpdateExpression = aws.String("SET tags = :tags")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{":tags": value}
+	}
+	_, err := d.client.UpdateItem(ctx, input)
+	if errors.Is(classify(err), ErrConditionFailed) {
+		return fmt.Errorf("failed to set file tags: file %w: %s", ErrNotFound, fileID)
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to set file tags: %w", err))
+	}
+	return nil
+}
+
+// accessTime parses lastAccessedAt, treating missing or malformed values as the zero time
+func accessTime(metadata FileMetadata) time.Time {
+	if metadata.LastAccessedAt == nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, *metadata.LastAccessedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
 // DeleteFileMetadata removes file metadata from DynamoDB
 func (d *DynamoClient) DeleteFileMetadata(ctx context.Context, fileID string) error {
 	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
@@ -163,13 +371,41 @@ func (d *DynamoClient) DeleteFileMetadata(ctx context.Context, fileID string) er
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to delete file metadata: %w", err)
+		return classify(fmt.Errorf("failed to delete file metadata: %w", err))
 	}
 
 	log.Printf("Deleted file metadata for fileID: %s", fileID)
 	return nil
 }
 
+// DeleteFilesMetadata removes many files' metadata, 25 in each BatchWriteItem call. It
+// returns the files whose metadata may remain, with why; deleting them again is safe.
+func (d *DynamoClient) DeleteFilesMetadata(ctx context.Context, fileIDs []string) map[string]error {
+	failed := make(map[string]error)
+	for start := 0; start < len(fileIDs); start += batchWriteSize {
+		batch := fileIDs[start:min(start+batchWriteSize, len(fileIDs))]
+		requests := make([]types.WriteRequest, len(batch))
+		for i, fileID := range batch {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+				"fileID": &types.AttributeValueMemberS{Value: fileID},
+			}}}
+		}
+		unprocessed, err := d.writeBatch(ctx, "vibe-drop-files", requests)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("failed to delete file metadata: %w", err)
+		for _, request := range unprocessed {
+			if key, ok := request.DeleteRequest.Key["fileID"].(*types.AttributeValueMemberS); ok {
+				failed[key.Value] = err
+			}
+		}
+	}
+
+	log.Printf("Deleted file metadata for %d files", len(fileIDs)-len(failed))
+	return failed
+}
+
 // FileChunk represents a single chunk in the chunks table
 type FileChunk struct {
 	FileID      string `json:"fileID" dynamodbav:"fileID"`
@@ -179,6 +415,23 @@ type FileChunk struct {
 	Status      string `json:"status" dynamodbav:"status"` // "pending", "uploaded", "failed"
 	UploadedAt  string `json:"uploadedAt,omitempty" dynamodbav:"uploadedAt,omitempty"`
 	S3PartNumber int   `json:"s3PartNumber" dynamodbav:"s3PartNumber"`
+	// When the latest presigned URL issued for the chunk expires
+	URLExpiresAt string `json:"urlExpiresAt,omitempty" dynamodbav:"urlExpiresAt,omitempty"`
+	// Unix time after which the record is removed (the table's TTL attribute); set once the
+	// upload has completed and its chunks are summarized on the file
+	ExpiresAt int64 `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// ChunkSummary is what a completed multipart upload keeps of its chunk records, so the file
+// still describes its parts once the records have expired
+type ChunkSummary struct {
+	Chunks          int    `json:"chunks" dynamodbav:"chunks"`
+	TotalSize       int64  `json:"totalSize" dynamodbav:"totalSize"` // Sum of the chunk sizes
+	FirstUploadedAt string `json:"firstUploadedAt,omitempty" dynamodbav:"firstUploadedAt,omitempty"`
+	LastUploadedAt  string `json:"lastUploadedAt,omitempty" dynamodbav:"lastUploadedAt,omitempty"`
+	CompactedAt     string `json:"compactedAt" dynamodbav:"compactedAt"`
+	// When the chunk records expire; empty while they are kept indefinitely
+	RecordsExpireAt string `json:"recordsExpireAt,omitempty" dynamodbav:"recordsExpireAt,omitempty"`
 }
 
 // SaveFileChunk saves chunk metadata to DynamoDB
@@ -193,41 +446,216 @@ func (d *DynamoClient) SaveFileChunk(ctx context.Context, chunk *FileChunk) erro
 		Item:      item,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to save chunk metadata: %w", err)
+		return classify(fmt.Errorf("failed to save chunk metadata: %w", err))
 	}
 
 	log.Printf("Saved chunk metadata for fileID: %s, chunk: %d", chunk.FileID, chunk.ChunkNumber)
 	return nil
 }
 
-// GetFileChunks retrieves all chunks for a file
+// Chunk records are written, and file records deleted, with BatchWriteItem, which takes at
+// most 25 items. A few batches of chunks go at once; items DynamoDB leaves unprocessed are
+// retried with exponential backoff.
+const (
+	batchWriteSize        = 25
+	batchWriteConcurrency = 4
+	batchWriteAttempts    = 5
+	batchWriteBackoff     = 50 * time.Millisecond
+)
+
+// SaveFileChunks saves many chunk records in BatchWriteItem calls, for the thousands a large
+// multipart upload starts with. The chunks must have distinct keys. On error some records
+// may have been saved; saving them all again is safe.
+func (d *DynamoClient) SaveFileChunks(ctx context.Context, chunks []FileChunk) error {
+	requests := make([]types.WriteRequest, len(chunks))
+	for i := range chunks {
+		item, err := attributevalue.MarshalMap(&chunks[i])
+		if err != nil {
+			return fmt.Errorf("failed to marshal chunk: %w", err)
+		}
+		requests[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	batches := make(chan []types.WriteRequest)
+	for w := 0; w < batchWriteConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := d.writeChunkBatch(ctx, batch); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for start := 0; start < len(requests) && ctx.Err() == nil; start += batchWriteSize {
+		select {
+		case batches <- requests[start:min(start+batchWriteSize, len(requests))]:
+		case <-ctx.Done():
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return classify(fmt.Errorf("failed to save chunk metadata: %w", err))
+	}
+	log.Printf("Saved %d chunk records", len(chunks))
+	return nil
+}
+
+// writeChunkBatch writes one BatchWriteItem's worth of chunk records
+func (d *DynamoClient) writeChunkBatch(ctx context.Context, requests []types.WriteRequest) error {
+	if _, err := d.writeBatch(ctx, "vibe-drop-chunks", requests); err != nil {
+		return fmt.Errorf("failed to save chunk metadata: %w", err)
+	}
+	return nil
+}
+
+// writeBatch makes one BatchWriteItem's worth of writes to table, retrying the unprocessed
+// ones until none are left or the attempts run out. On error it also returns the writes
+// that may not have been made.
+func (d *DynamoClient) writeBatch(ctx context.Context, table string, requests []types.WriteRequest) ([]types.WriteRequest, error) {
+	backoff := batchWriteBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := d.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{table: requests},
+		})
+		if err != nil {
+			return requests, classify(err)
+		}
+
+		requests = result.UnprocessedItems[table]
+		if len(requests) == 0 {
+			return nil, nil
+		}
+		if attempt == batchWriteAttempts {
+			return requests, fmt.Errorf("%w: %d records still unprocessed after %d attempts", ErrThrottled, len(requests), attempt)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return requests, classify(ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+// GetFileChunks retrieves all chunks for a file, reading every page of the query
 func (d *DynamoClient) GetFileChunks(ctx context.Context, fileID string) ([]FileChunk, error) {
-	result, err := d.client.Query(ctx, &dynamodb.QueryInput{
-		TableName: aws.String("vibe-drop-chunks"),
+	var chunks []FileChunk
+	err := d.WalkFileChunks(ctx, fileID, func(page []FileChunk) error {
+		chunks = append(chunks, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// WalkFileChunks calls fn with each page of a file's chunks, in chunk order, as DynamoDB
+// returns them (up to 1 MB each), so a large upload's chunks needn't all be held at once.
+// Expired records are left out, since the TTL may take days to delete them. An error
+// from fn stops the walk and is returned.
+func (d *DynamoClient) WalkFileChunks(ctx context.Context, fileID string, fn func(page []FileChunk) error) error {
+	paginator := dynamodb.NewQueryPaginator(d.client, &dynamodb.QueryInput{
+		TableName:              aws.String("vibe-drop-chunks"),
 		KeyConditionExpression: aws.String("fileID = :fileID"),
+		FilterExpression:       aws.String("attribute_not_exists(expiresAt) OR expiresAt > :now"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":fileID": &types.AttributeValueMemberS{Value: fileID},
+			":now":    &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
 		},
 	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get chunks: %w", err)
-	}
-
-	var chunks []FileChunk
-	for _, item := range result.Items {
-		var chunk FileChunk
-		err = attributevalue.UnmarshalMap(item, &chunk)
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
 		if err != nil {
-			log.Printf("Failed to unmarshal chunk item: %v", err)
+			return classify(fmt.Errorf("failed to get chunks: %w", err))
+		}
+		page := make([]FileChunk, 0, len(result.Items))
+		for _, item := range result.Items {
+			var chunk FileChunk
+			if err := attributevalue.UnmarshalMap(item, &chunk); err != nil {
+				log.Printf("Failed to unmarshal chunk item: %v", err)
+				continue
+			}
+			page = append(page, chunk)
+		}
+		// The filter can leave a page empty when every record on it has expired
+		if len(page) == 0 {
 			continue
 		}
-		chunks = append(chunks, chunk)
+		if err := fn(page); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return chunks, nil
+// DeleteFileChunks removes every chunk record for a file, a page at a time
+func (d *DynamoClient) DeleteFileChunks(ctx context.Context, fileID string) error {
+	deleted := 0
+	err := d.WalkFileChunks(ctx, fileID, func(page []FileChunk) error {
+		for _, chunk := range page {
+			_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String("vibe-drop-chunks"),
+				Key: map[string]types.AttributeValue{
+					"fileID":      &types.AttributeValueMemberS{Value: fileID},
+					"chunkNumber": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", chunk.ChunkNumber)},
+				},
+			})
+			if err != nil {
+				return classify(fmt.Errorf("failed to delete chunk %d: %w", chunk.ChunkNumber, err))
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Deleted %d chunk records for fileID: %s", deleted, fileID)
+	return nil
+}
+
+// ExpireFileChunks sets every chunk record of a file to expire at expiresAt, rewriting
+// them in batches a page at a time. DynamoDB's TTL removes them some time after that.
+func (d *DynamoClient) ExpireFileChunks(ctx context.Context, fileID string, expiresAt time.Time) error {
+	return d.WalkFileChunks(ctx, fileID, func(page []FileChunk) error {
+		for i := range page {
+			page[i].ExpiresAt = expiresAt.Unix()
+		}
+		return d.SaveFileChunks(ctx, page)
+	})
 }
 
-// UpdateChunkStatus updates a chunk's upload status and ETag
+// PurgeExpiredChunks has nothing to do for DynamoDB, whose TTL deletes expired chunk records
+func (d *DynamoClient) PurgeExpiredChunks(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+// UpdateChunkStatus updates a chunk's upload status and ETag. When the chunk becomes, or
+// stops being, uploaded, the file's uploadedParts counter is adjusted to match.
 func (d *DynamoClient) UpdateChunkStatus(ctx context.Context, fileID string, chunkNumber int, status string, etag string) error {
 	updateExpression := "SET #status = :status"
 	expressionAttributeNames := map[string]string{
@@ -244,7 +672,7 @@ func (d *DynamoClient) UpdateChunkStatus(ctx context.Context, fileID string, chu
 		expressionAttributeValues[":uploadedAt"] = &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)}
 	}
 
-	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	result, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String("vibe-drop-chunks"),
 		Key: map[string]types.AttributeValue{
 			"fileID":      &types.AttributeValueMemberS{Value: fileID},
@@ -253,15 +681,62 @@ func (d *DynamoClient) UpdateChunkStatus(ctx context.Context, fileID string, chu
 		UpdateExpression:          aws.String(updateExpression),
 		ExpressionAttributeNames:  expressionAttributeNames,
 		ExpressionAttributeValues: expressionAttributeValues,
+		ReturnValues:              types.ReturnValueUpdatedOld,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to update chunk status: %w", err)
+		return classify(fmt.Errorf("failed to update chunk status: %w", err))
+	}
+
+	// DynamoDB applies updates to one item in turn, so of two reports for the same chunk only
+	// one sees it change and the counter stays exact
+	var previous struct {
+		Status string `dynamodbav:"status"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Attributes, &previous); err != nil {
+		return fmt.Errorf("failed to read previous chunk status: %w", err)
+	}
+	if delta := uploadedDelta(previous.Status, status); delta != 0 {
+		_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String("vibe-drop-files"),
+			Key:                 map[string]types.AttributeValue{"fileID": &types.AttributeValueMemberS{Value: fileID}},
+			UpdateExpression:    aws.String("ADD uploadedParts :delta"),
+			ConditionExpression: aws.String("attribute_exists(fileID)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":delta": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", delta)},
+			},
+		})
+		if err != nil && !errors.Is(classify(err), ErrConditionFailed) {
+			return classify(fmt.Errorf("failed to count uploaded chunk: %w", err))
+		}
 	}
 
 	log.Printf("Updated chunk %d status to %s for fileID: %s", chunkNumber, status, fileID)
 	return nil
 }
 
+// RecordChunkURLExpiry stores when the latest presigned URL issued for a chunk expires
+func (d *DynamoClient) RecordChunkURLExpiry(ctx context.Context, fileID string, chunkNumber int, expiresAt time.Time) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("vibe-drop-chunks"),
+		Key: map[string]types.AttributeValue{
+			"fileID":      &types.AttributeValueMemberS{Value: fileID},
+			"chunkNumber": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", chunkNumber)},
+		},
+		UpdateExpression:    aws.String("SET urlExpiresAt = :expiresAt"),
+		ConditionExpression: aws.String("attribute_exists(fileID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expiresAt": &types.AttributeValueMemberS{Value: expiresAt.Format(time.RFC3339)},
+		},
+	})
+	if errors.Is(classify(err), ErrConditionFailed) {
+		return fmt.Errorf("failed to record chunk URL expiry: chunk %d of %s %w", chunkNumber, fileID, ErrNotFound)
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to record chunk URL expiry: %w", err))
+	}
+	return nil
+}
+
 // CheckUploadComplete checks if all chunks are uploaded and returns completion status
 func (d *DynamoClient) CheckUploadComplete(ctx context.Context, fileID string) (bool, []FileChunk, error) {
 	chunks, err := d.GetFileChunks(ctx, fileID)
@@ -269,12 +744,26 @@ func (d *DynamoClient) CheckUploadComplete(ctx context.Context, fileID string) (
 		return false, nil, err
 	}
 
-	// Check if all chunks are uploaded
+	return allChunksUploaded(chunks), chunks, nil
+}
+
+// uploadedDelta is how a chunk's status change moves the file's uploaded-parts counter
+func uploadedDelta(previous, status string) int {
+	switch {
+	case previous != "uploaded" && status == "uploaded":
+		return 1
+	case previous == "uploaded" && status != "uploaded":
+		return -1
+	}
+	return 0
+}
+
+// allChunksUploaded reports whether there are chunks and every one has been uploaded
+func allChunksUploaded(chunks []FileChunk) bool {
 	for _, chunk := range chunks {
 		if chunk.Status != "uploaded" {
-			return false, chunks, nil // Not complete yet
+			return false // Not complete yet
 		}
 	}
-
-	return len(chunks) > 0, chunks, nil // Complete if we have chunks and all are uploaded
+	return len(chunks) > 0
 }
\ No newline at end of file
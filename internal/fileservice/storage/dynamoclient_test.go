@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchWriteServer answers BatchWriteItem like DynamoDB under load: the first time it sees a
+// request it leaves its last item unprocessed
+type batchWriteServer struct {
+	mu      sync.Mutex
+	calls   int
+	written map[string]int // chunkNumber -> times written
+	largest int
+}
+
+type batchWriteRequest struct {
+	RequestItems map[string][]struct {
+		PutRequest struct {
+			Item map[string]map[string]string
+		}
+	}
+}
+
+func (s *batchWriteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req batchWriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requests := req.RequestItems["vibe-drop-chunks"]
+
+	s.mu.Lock()
+	s.calls++
+	s.largest = max(s.largest, len(requests))
+	firstAttempt := len(requests) == batchWriteSize
+	processed := requests
+	if firstAttempt {
+		processed = requests[:len(requests)-1]
+	}
+	for _, request := range processed {
+		s.written[request.PutRequest.Item["chunkNumber"]["N"]]++
+	}
+	s.mu.Unlock()
+
+	unprocessed := map[string]any{}
+	if firstAttempt {
+		unprocessed["vibe-drop-chunks"] = requests[len(requests)-1:]
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	json.NewEncoder(w).Encode(map[string]any{"UnprocessedItems": unprocessed})
+}
+
+func TestSaveFileChunks(t *testing.T) {
+	server := &batchWriteServer{written: make(map[string]int)}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	client, err := NewDynamoClient("us-east-1", srv.URL, Timeouts{}, AssumeRole{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := make([]FileChunk, 101)
+	for i := range chunks {
+		chunks[i] = FileChunk{FileID: "file-1", ChunkNumber: i + 1, Status: "pending", S3PartNumber: i + 1}
+	}
+	if err := client.SaveFileChunks(context.Background(), chunks); err != nil {
+		t.Fatalf("SaveFileChunks: %v", err)
+	}
+
+	if len(server.written) != len(chunks) {
+		t.Errorf("%d chunks written, want %d", len(server.written), len(chunks))
+	}
+	for chunkNumber, times := range server.written {
+		if times != 1 {
+			t.Errorf("chunk %s written %d times, want once", chunkNumber, times)
+		}
+	}
+	if server.largest > batchWriteSize {
+		t.Errorf("largest batch had %d items, want at most %d", server.largest, batchWriteSize)
+	}
+	// Five batches, four of them full and retried once for their unprocessed item
+	if server.calls != 9 {
+		t.Errorf("%d BatchWriteItem calls, want 9", server.calls)
+	}
+}
+
+func TestSaveFileChunksGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchWriteRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		json.NewEncoder(w).Encode(map[string]any{"UnprocessedItems": req.RequestItems})
+	}))
+	defer srv.Close()
+
+	client, err := NewDynamoClient("us-east-1", srv.URL, Timeouts{}, AssumeRole{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.SaveFileChunks(context.Background(), []FileChunk{{FileID: "file-1", ChunkNumber: 1}})
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("SaveFileChunks = %v, want ErrThrottled once the attempts run out", err)
+	}
+}
+
+func TestGetFileChunksReadsEveryPage(t *testing.T) {
+	pages := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ ExclusiveStartKey map[string]any }
+		json.NewDecoder(r.Body).Decode(&req)
+		pages++
+
+		// DynamoDB stops a query page at 1 MB, so a large upload's chunks span several
+		item := func(chunkNumber string) map[string]any {
+			return map[string]any{"fileID": map[string]string{"S": "file-1"}, "chunkNumber": map[string]string{"N": chunkNumber}}
+		}
+		resp := map[string]any{"Items": []any{item("1"), item("2")}}
+		if req.ExclusiveStartKey == nil {
+			resp["LastEvaluatedKey"] = item("2")
+		} else {
+			resp["Items"] = []any{item("3")}
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	client, err := NewDynamoClient("us-east-1", srv.URL, Timeouts{}, AssumeRole{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := client.GetFileChunks(context.Background(), "file-1")
+	if err != nil {
+		t.Fatalf("GetFileChunks: %v", err)
+	}
+	if len(chunks) != 3 || pages != 2 {
+		t.Errorf("%d chunks from %d pages, want 3 from 2", len(chunks), pages)
+	}
+
+	// A callback's error ends the walk without reading further pages
+	pages = 0
+	errStop := errors.New("stop")
+	err = client.WalkFileChunks(context.Background(), "file-1", func(page []FileChunk) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) || pages != 1 {
+		t.Errorf("WalkFileChunks = %v after %d pages, want the callback's error after 1", err, pages)
+	}
+}
+
+func TestCallsTimeOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := NewDynamoClient("us-east-1", srv.URL, Timeouts{Operation: 50 * time.Millisecond}, AssumeRole{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	_, err = client.GetFileMetadata(context.Background(), "file-1")
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("GetFileMetadata = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("GetFileMetadata took %s, want it cut off after the 50ms timeout", elapsed)
+	}
+
+	// A cancelled caller stops the call without waiting for the timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetFileMetadata(ctx, "file-1"); !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("GetFileMetadata with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	timeouts := Timeouts{Operation: time.Second}
+	for operation, want := range map[string]time.Duration{
+		"GetItem":                 time.Second,
+		"CompleteMultipartUpload": DefaultTransferTimeout,
+		"GetObject":               0,
+	} {
+		if got := timeouts.timeoutFor(operation); got != want {
+			t.Errorf("timeoutFor(%s) = %s, want %s", operation, got, want)
+		}
+	}
+}
+
+func TestAssumesRole(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "base-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "base-secret")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+
+	// Each set of credentials expires within the refresh window, so every call renews them
+	var mu sync.Mutex
+	var assumed []string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("RoleArn") != "arn:aws:iam::123456789012:role/vibe-drop" || r.Form.Get("ExternalId") != "ext-1" ||
+			r.Form.Get("RoleSessionName") != DefaultRoleSessionName || r.Form.Get("DurationSeconds") != "1800" {
+			t.Errorf("AssumeRole form %v", r.Form)
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=base-key/") {
+			t.Errorf("AssumeRole signed with %q, want the base credentials", r.Header.Get("Authorization"))
+		}
+		mu.Lock()
+		assumed = append(assumed, fmt.Sprintf("ASIA%d", len(assumed)+1))
+		key := assumed[len(assumed)-1]
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult>
+<Credentials><AccessKeyId>%s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>%s</Expiration></Credentials>
+<AssumedRoleUser><Arn>arn:aws:sts::123456789012:assumed-role/vibe-drop/s</Arn><AssumedRoleId>AROA:s</AssumedRoleId></AssumedRoleUser>
+</AssumeRoleResult></AssumeRoleResponse>`, key, time.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+	}))
+	defer sts.Close()
+
+	var signedWith []string
+	dynamo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signedWith = append(signedWith, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte(`{"TableNames":[]}`))
+	}))
+	defer dynamo.Close()
+
+	role := AssumeRole{RoleARN: "arn:aws:iam::123456789012:role/vibe-drop", ExternalID: "ext-1", Duration: 30 * time.Minute, STSEndpoint: sts.URL}
+	client, err := NewDynamoClient("us-east-1", dynamo.URL, Timeouts{}, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.TestConnection(context.Background()); err != nil {
+			t.Fatalf("TestConnection: %v", err)
+		}
+	}
+
+	if len(assumed) != 2 {
+		t.Fatalf("role assumed %d times, want once per call", len(assumed))
+	}
+	for i, authorization := range signedWith {
+		if !strings.Contains(authorization, "Credential="+assumed[i]+"/") {
+			t.Errorf("call %d signed with %q, want %s", i+1, authorization, assumed[i])
+		}
+	}
+}
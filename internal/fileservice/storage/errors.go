@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"vibe-drop/internal/common"
+)
+
+// Errors the storage clients wrap their failures in, whatever the backend, so callers can
+// tell them apart with errors.Is instead of matching on messages.
+var (
+	// ErrNotFound means the record or object asked for doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConditionFailed means a conditional write was rejected because the record had
+	// changed, or already existed, since the caller read it.
+	ErrConditionFailed = errors.New("condition failed")
+	// ErrThrottled means the backend shed the request under load; retrying later may work.
+	ErrThrottled = errors.New("throttled")
+	// ErrTimeout means the backend didn't answer within the call's timeout (see Timeouts).
+	ErrTimeout = errors.New("timed out")
+)
+
+// classify wraps err in the sentinel matching the backend failure underneath it: a
+// DynamoDB or S3 API error code, a PostgreSQL SQLSTATE, a missing file or a deadline
+// that passed. It returns err
+// unchanged if it is nil, already wraps a sentinel, or matches none of them.
+func classify(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrConditionFailed) || errors.Is(err, ErrThrottled) || errors.Is(err, ErrTimeout) {
+		return err
+	}
+	if sentinel := sentinelFor(err); sentinel != nil {
+		return fmt.Errorf("%w: %w", sentinel, err)
+	}
+	return err
+}
+
+func sentinelFor(err error) error {
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			if reason.Code == nil {
+				continue
+			}
+			switch *reason.Code {
+			case "ConditionalCheckFailed":
+				return ErrConditionFailed
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				return ErrThrottled
+			}
+		}
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound", "NoSuchUpload":
+			return ErrNotFound
+		case "ConditionalCheckFailedException", "PreconditionFailed", "TransactionConflictException", "ConditionalRequestConflict":
+			return ErrConditionFailed
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded",
+			"ProvisionedThroughputExceededException", "TooManyRequestsException", "RequestThrottled":
+			return ErrThrottled
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return ErrConditionFailed
+		case "40001", "40P01", "53300", "57P03": // serialization_failure, deadlock_detected, too_many_connections, cannot_connect_now
+			return ErrThrottled
+		}
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// UpstreamRequests returns the AWS calls err failed in, with the request IDs AWS answered
+// them with, so a failed user request can be matched to AWS's own records of it. Calls
+// that got no answer, and failures of the other backends, have none.
+func UpstreamRequests(err error) []common.UpstreamRequest {
+	var requests []common.UpstreamRequest
+	seen := make(map[string]bool)
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case *smithy.OperationError:
+			if request, ok := upstreamRequest(e); ok && !seen[request.RequestID] {
+				seen[request.RequestID] = true
+				requests = append(requests, request)
+			}
+		case interface{ Unwrap() []error }: // errors.Join, and classify's "%w: %w"
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+	return requests
+}
+
+func upstreamRequest(op *smithy.OperationError) (common.UpstreamRequest, bool) {
+	var withID interface{ ServiceRequestID() string }
+	if !errors.As(op.Err, &withID) || withID.ServiceRequestID() == "" {
+		return common.UpstreamRequest{}, false
+	}
+	request := common.UpstreamRequest{Service: op.ServiceID, Operation: op.OperationName, RequestID: withID.ServiceRequestID()}
+	var withHost interface{ ServiceHostID() string }
+	if errors.As(op.Err, &withHost) {
+		request.HostID = withHost.ServiceHostID()
+	}
+	return request, true
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"vibe-drop/internal/common"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"missing S3 key", &smithy.GenericAPIError{Code: "NoSuchKey"}, ErrNotFound},
+		{"S3 slow down", &smithy.GenericAPIError{Code: "SlowDown"}, ErrThrottled},
+		{"DynamoDB condition", &types.ConditionalCheckFailedException{}, ErrConditionFailed},
+		{"DynamoDB throughput", &types.ProvisionedThroughputExceededException{}, ErrThrottled},
+		{"cancelled transaction", &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")}, {Code: aws.String("ConditionalCheckFailed")},
+		}}, ErrConditionFailed},
+		{"PostgreSQL unique violation", &pgconn.PgError{Code: "23505"}, ErrConditionFailed},
+		{"PostgreSQL serialization failure", &pgconn.PgError{Code: "40001"}, ErrThrottled},
+		{"missing file", fs.ErrNotExist, ErrNotFound},
+		{"deadline passed", context.DeadlineExceeded, ErrTimeout},
+		{"other failure", errors.New("connection reset"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(fmt.Errorf("failed to load: %w", tt.err))
+			for _, sentinel := range []error{ErrNotFound, ErrConditionFailed, ErrThrottled, ErrTimeout} {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %t", err, sentinel, got)
+				}
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classify dropped the cause: %v", err)
+			}
+		})
+	}
+}
+
+// s3ResponseError stands in for the S3 client's error, which adds the extended request ID
+type s3ResponseError struct {
+	*awshttp.ResponseError
+	hostID string
+}
+
+func (e *s3ResponseError) ServiceHostID() string { return e.hostID }
+
+func awsFailure(service, operation, requestID, hostID string) error {
+	responseErr := &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}},
+			Err:      &smithy.GenericAPIError{Code: "InternalError"},
+		},
+		RequestID: requestID,
+	}
+	var err error = responseErr
+	if hostID != "" {
+		err = &s3ResponseError{ResponseError: responseErr, hostID: hostID}
+	}
+	return &smithy.OperationError{ServiceID: service, OperationName: operation, Err: err}
+}
+
+func TestUpstreamRequests(t *testing.T) {
+	err := classify(fmt.Errorf("failed to copy parts: %w", errors.Join(
+		awsFailure("S3", "UploadPartCopy", "REQ-1", "HOST-1"),
+		awsFailure("S3", "UploadPartCopy", "REQ-1", "HOST-1"), // Reported twice, listed once
+		fmt.Errorf("failed to save: %w", awsFailure("DynamoDB", "PutItem", "REQ-2", "")),
+		awsFailure("S3", "UploadPartCopy", "", ""), // No answer, so no ID
+		errors.New("connection reset"),
+	)))
+	want := []common.UpstreamRequest{
+		{Service: "S3", Operation: "UploadPartCopy", RequestID: "REQ-1", HostID: "HOST-1"},
+		{Service: "DynamoDB", Operation: "PutItem", RequestID: "REQ-2"},
+	}
+	got := UpstreamRequests(err)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("UpstreamRequests = %+v, want %+v", got, want)
+	}
+	if requests := UpstreamRequests(&pgconn.PgError{Code: "23505"}); requests != nil {
+		t.Errorf("PostgreSQL failure: UpstreamRequests = %+v, want none", requests)
+	}
+
+	// An error response written with them names them in its body and headers
+	rec := httptest.NewRecorder()
+	common.WriteS3Error(common.WithUpstreamRequests(rec, got), "Failed to copy parts", err.Error())
+	var body struct {
+		Error common.ErrorInfo `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(body.Error.Upstream, want) {
+		t.Errorf("upstream = %+v, want %+v", body.Error.Upstream, want)
+	}
+	headers := rec.Header().Values(common.UpstreamRequestIDHeader)
+	if len(headers) != 2 || headers[0] != "S3 UploadPartCopy request_id=REQ-1 host_id=HOST-1" || headers[1] != "DynamoDB PutItem request_id=REQ-2" {
+		t.Errorf("%s = %q", common.UpstreamRequestIDHeader, headers)
+	}
+}
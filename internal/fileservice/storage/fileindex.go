@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// userUploadedIndex is the files table's index of each user's files by upload time
+const userUploadedIndex = "user-uploaded-index"
+
+// maxUTCOffset is the furthest a timestamp's UTC offset can be from UTC. uploadedAt keeps
+// the offset of the replica that wrote it, so compared as text it can be out by this much.
+const maxUTCOffset = 14 * time.Hour
+
+// FileCursor is the position of a file in its owner's files ordered by upload time
+type FileCursor struct {
+	UploadedAt string `json:"uploadedAt"`
+	FileID     string `json:"fileID"`
+}
+
+// CursorFor is the position of metadata's file
+func CursorFor(metadata *FileMetadata) *FileCursor {
+	return &FileCursor{UploadedAt: metadata.UploadedAt, FileID: metadata.FileID}
+}
+
+// UploadTimeRange bounds when files were uploaded; a zero bound leaves that side open
+type UploadTimeRange struct {
+	After  time.Time
+	Before time.Time
+}
+
+// Contains reports whether uploadedAt is within the range. Times that don't parse are
+// only in an unbounded range.
+func (r UploadTimeRange) Contains(uploadedAt string) bool {
+	if r.After.IsZero() && r.Before.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, uploadedAt)
+	if err != nil {
+		return false
+	}
+	return !t.Before(r.After) && (r.Before.IsZero() || !t.After(r.Before))
+}
+
+// textBounds are the range's bounds widened to cover every UTC offset, as RFC3339 text to
+// compare uploadedAt with, or "" for an open side. Files just outside the range can fall
+// within them, so callers check Contains too.
+func (r UploadTimeRange) textBounds() (after, before string) {
+	if !r.After.IsZero() {
+		after = r.After.Add(-maxUTCOffset).UTC().Format(time.RFC3339)
+	}
+	if !r.Before.IsZero() {
+		before = r.Before.Add(maxUTCOffset).UTC().Format(time.RFC3339)
+	}
+	return after, before
+}
+
+// FilesPage is a page of a user's files, most recently uploaded first
+type FilesPage struct {
+	Files []FileMetadata
+	Next  *FileCursor // Where the next page starts; nil after the last page
+}
+
+// ListFilesByUploadTime reads up to limit of the user's files from the user-uploaded-index,
+// most recently uploaded first, starting after the cursor if there is one. Only files
+// uploaded within uploaded are returned, so a page can hold fewer than limit files and
+// still be followed by another.
+func (d *DynamoClient) ListFilesByUploadTime(ctx context.Context, userID string, uploaded UploadTimeRange, after *FileCursor, limit int) (*FilesPage, error) {
+	keyCondition := "userID = :userID"
+	values := map[string]types.AttributeValue{
+		":userID": &types.AttributeValueMemberS{Value: userID},
+	}
+	switch from, to := uploaded.textBounds(); {
+	case from != "" && to != "":
+		keyCondition += " AND uploadedAt BETWEEN :from AND :to"
+		values[":from"] = &types.AttributeValueMemberS{Value: from}
+		values[":to"] = &types.AttributeValueMemberS{Value: to}
+	case from != "":
+		keyCondition += " AND uploadedAt >= :from"
+		values[":from"] = &types.AttributeValueMemberS{Value: from}
+	case to != "":
+		keyCondition += " AND uploadedAt <= :to"
+		values[":to"] = &types.AttributeValueMemberS{Value: to}
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("vibe-drop-files"),
+		IndexName:                 aws.String(userUploadedIndex),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(int32(limit)),
+	}
+	if after != nil {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"fileID":     &types.AttributeValueMemberS{Value: after.FileID},
+			"userID":     &types.AttributeValueMemberS{Value: userID},
+			"uploadedAt": &types.AttributeValueMemberS{Value: after.UploadedAt},
+		}
+	}
+	result, err := d.client.Query(ctx, input)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list files by upload time: %w", err))
+	}
+
+	var read []FileMetadata
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &read); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal files: %w", err)
+	}
+	page := &FilesPage{}
+	for _, metadata := range read {
+		if uploaded.Contains(metadata.UploadedAt) {
+			page.Files = append(page.Files, metadata)
+		}
+	}
+	if result.LastEvaluatedKey != nil && len(read) > 0 {
+		page.Next = CursorFor(&read[len(read)-1])
+	}
+	return page, nil
+}
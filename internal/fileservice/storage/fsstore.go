@@ -0,0 +1,759 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FSBlobPath is where the file service serves the presigned URLs an FSStore issues
+const FSBlobPath = "/blobs/"
+
+// Query parameters of an FSStore presigned URL
+const (
+	fsParamExpires           = "X-VD-Expires"
+	fsParamSignature         = "X-VD-Signature"
+	fsParamChecksumAlgorithm = "X-VD-Checksum-Algorithm"
+	fsParamChecksum          = "X-VD-Checksum"
+	fsParamUploadID          = "uploadId"
+	fsParamPartNumber        = "partNumber"
+	// Named as on S3; a download is served with these headers if they are set
+	fsParamContentDisposition = "response-content-disposition"
+	fsParamContentType        = "response-content-type"
+)
+
+// Directories under the root that can't clash with a bucket, since bucket names never
+// start with a dot
+const (
+	fsUploadsDir = ".uploads" // One directory of parts per multipart upload
+	fsTempDir    = ".tmp"     // Content being written, renamed into place when complete
+)
+
+// maxPartNumber is the highest part number S3 accepts, kept so both backends agree
+const maxPartNumber = 10000
+
+// FSStore keeps objects in a local directory, one subdirectory per bucket, so the service
+// can run without S3 in tests and on-prem deployments. Its presigned URLs point at the file
+// service itself, which serves them with ServeHTTP; each carries an HMAC of the request it
+// allows and when it expires.
+type FSStore struct {
+	root       string
+	publicURL  string // Base URL clients reach the file service at
+	signingKey []byte
+	bucket     string   // Default bucket; holds objects whose metadata predates sharding
+	shards     []string // Buckets new objects are spread across
+}
+
+// NewFSStore creates a store under root for bucket and any shardBuckets, as NewS3Client
+// does. Presigned URLs are issued under publicURL and signed with signingKey.
+func NewFSStore(root, publicURL string, signingKey []byte, bucket string, shardBuckets ...string) (*FSStore, error) {
+	if len(signingKey) == 0 {
+		return nil, fmt.Errorf("a signing key is required")
+	}
+	if len(shardBuckets) == 0 {
+		shardBuckets = []string{bucket}
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage root: %w", err)
+	}
+	store := &FSStore{
+		root:       root,
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		signingKey: signingKey,
+		bucket:     bucket,
+		shards:     shardBuckets,
+	}
+
+	dirs := []string{fsUploadsDir, fsTempDir}
+	for _, b := range store.Buckets() {
+		if !validFSBucket(b) {
+			return nil, fmt.Errorf("invalid bucket name %q", b)
+		}
+		dirs = append(dirs, b)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+
+	log.Printf("Filesystem store created at %s for bucket: %s (shards: %s), serving URLs from %s", root, bucket, strings.Join(shardBuckets, ","), store.publicURL)
+	return store, nil
+}
+
+// BucketFor returns the shard bucket a new file's objects are stored in
+func (s *FSStore) BucketFor(fileID string) string {
+	return shardFor(s.shards, fileID)
+}
+
+// ResolveBucket returns the bucket holding a file's objects given the bucket recorded
+// in its metadata. Records from before sharding have none and live in the default bucket.
+func (s *FSStore) ResolveBucket(recorded string) string {
+	if recorded == "" {
+		return s.bucket
+	}
+	return recorded
+}
+
+// Buckets returns the default bucket followed by every shard bucket not already listed
+func (s *FSStore) Buckets() []string {
+	return allBuckets(s.bucket, s.shards)
+}
+
+// TestConnection checks the root is still writable
+func (s *FSStore) TestConnection(ctx context.Context) error {
+	probe, err := os.CreateTemp(filepath.Join(s.root, fsTempDir), "probe-")
+	if err != nil {
+		return fmt.Errorf("storage root %s is not writable: %w", s.root, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// validFSBucket rejects bucket names that would leave or collide with the store's layout
+func validFSBucket(bucket string) bool {
+	return bucket != "" && !strings.HasPrefix(bucket, ".") && !strings.ContainsAny(bucket, `/\`)
+}
+
+// objectPath maps a bucket and key onto the filesystem, rejecting any that would resolve
+// outside the bucket's directory
+func (s *FSStore) objectPath(bucket, key string) (string, error) {
+	if !validFSBucket(bucket) {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, `\`) {
+			return "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(key)), nil
+}
+
+// uploadDir is where a multipart upload's parts are kept until it completes
+func (s *FSStore) uploadDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	return filepath.Join(s.root, fsUploadsDir, uploadID), nil
+}
+
+func partPath(dir string, partNumber int) string {
+	return filepath.Join(dir, strconv.Itoa(partNumber))
+}
+
+// presign builds a URL for method on bucket/key, valid for expiry
+func (s *FSStore) presign(method, bucket, key string, expiry time.Duration, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set(fsParamExpires, strconv.FormatInt(time.Now().Add(expiry).Unix(), 10))
+	query.Set(fsParamSignature, s.sign(method, bucket, key, query))
+	path := (&url.URL{Path: FSBlobPath + bucket + "/" + key}).EscapedPath()
+	return s.publicURL + path + "?" + query.Encode()
+}
+
+// sign is the HMAC over everything a presigned URL allows
+func (s *FSStore) sign(method, bucket, key string, query url.Values) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	io.WriteString(mac, strings.Join([]string{
+		method, bucket, key,
+		query.Get(fsParamExpires),
+		query.Get(fsParamUploadID),
+		query.Get(fsParamPartNumber),
+		query.Get(fsParamChecksumAlgorithm),
+		query.Get(fsParamChecksum),
+		query.Get(fsParamContentDisposition),
+		query.Get(fsParamContentType),
+	}, "\n"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateUploadURL creates a presigned URL for uploading a file under the user's prefix.
+// With a checksum the URL is signed with it, so a PUT whose body doesn't match is rejected.
+func (s *FSStore) GenerateUploadURL(ctx context.Context, userID, filename string, opts UploadOptions) (string, string, error) {
+	fileID := uuid.New().String()
+	key := ObjectKey(userID, fileID, filename)
+	if err := ValidateObjectKey(userID, key); err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{}
+	if !opts.Checksum.IsZero() {
+		if newChecksumHash(opts.Checksum.Algorithm) == nil {
+			return "", "", fmt.Errorf("unsupported checksum algorithm %q", opts.Checksum.Algorithm)
+		}
+		query.Set(fsParamChecksumAlgorithm, opts.Checksum.Algorithm)
+		query.Set(fsParamChecksum, opts.Checksum.Value)
+	}
+	return s.presign(http.MethodPut, s.BucketFor(fileID), key, urlExpiry(opts.URLExpiry), query), fileID, nil
+}
+
+// GenerateDownloadURL creates a presigned URL for downloading a file from the bucket recorded in its metadata.
+// The object is served with the options' headers, which are part of the signature.
+func (s *FSStore) GenerateDownloadURL(ctx context.Context, bucket, s3Key string, opts DownloadOptions) (string, error) {
+	bucket = s.ResolveBucket(bucket)
+	if _, err := s.objectPath(bucket, s3Key); err != nil {
+		return "", classify(fmt.Errorf("failed to generate download URL: %w", err))
+	}
+	query := url.Values{}
+	if opts.ContentDisposition != "" {
+		query.Set(fsParamContentDisposition, opts.ContentDisposition)
+	}
+	if opts.ContentType != "" {
+		query.Set(fsParamContentType, opts.ContentType)
+	}
+	return s.presign(http.MethodGet, bucket, s3Key, urlExpiry(opts.URLExpiry), query), nil
+}
+
+// DeleteObject deletes a file from the bucket recorded in its metadata. Deleting a missing
+// object succeeds, as it does on S3.
+func (s *FSStore) DeleteObject(ctx context.Context, bucket, s3Key string) error {
+	path, err := s.objectPath(s.ResolveBucket(bucket), s3Key)
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete object: %w", err))
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return classify(fmt.Errorf("failed to delete object: %w", err))
+	}
+	log.Printf("Deleted object: %s", s3Key)
+	return nil
+}
+
+// DeleteObjects deletes many objects from one bucket recorded in their metadata. It returns
+// the keys it couldn't delete, with why.
+func (s *FSStore) DeleteObjects(ctx context.Context, bucket string, s3Keys []string) map[string]error {
+	failed := make(map[string]error)
+	for _, key := range s3Keys {
+		if err := s.DeleteObject(ctx, bucket, key); err != nil {
+			failed[key] = err
+		}
+	}
+	return failed
+}
+
+// open opens an object, mapping a missing file to ErrObjectNotFound
+func (s *FSStore) open(bucket, s3Key string) (*os.File, error) {
+	path, err := s.objectPath(s.ResolveBucket(bucket), s3Key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+// ReadObjectHeader returns up to the first n bytes of an object, or ErrObjectNotFound if
+// nothing is stored under the key yet. An empty object yields no bytes.
+func (s *FSStore) ReadObjectHeader(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error) {
+	f, err := s.open(bucket, s3Key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, err
+		}
+		return nil, classify(fmt.Errorf("failed to read object: %w", err))
+	}
+	defer f.Close()
+
+	header, err := io.ReadAll(io.LimitReader(f, n))
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to read object: %w", err))
+	}
+	if len(header) == 0 {
+		return nil, nil
+	}
+	return header, nil
+}
+
+// OpenObject streams an object's content, or returns ErrObjectNotFound if nothing is stored
+// under the key. The caller closes the reader.
+func (s *FSStore) OpenObject(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error) {
+	f, err := s.open(bucket, s3Key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, err
+		}
+		return nil, classify(fmt.Errorf("failed to read object: %w", err))
+	}
+	return f, nil
+}
+
+// OpenObjectRange streams length bytes of an object's content from offset, as OpenObject
+// streams all of it
+func (s *FSStore) OpenObjectRange(ctx context.Context, bucket, s3Key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := s.open(bucket, s3Key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, err
+		}
+		return nil, classify(fmt.Errorf("failed to read object: %w", err))
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, classify(fmt.Errorf("failed to read object: %w", err))
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// PutObject stores content under the key, replacing any object already there
+func (s *FSStore) PutObject(ctx context.Context, bucket, s3Key string, content io.ReadSeeker, size int64) error {
+	path, err := s.objectPath(s.ResolveBucket(bucket), s3Key)
+	if err != nil {
+		return classify(fmt.Errorf("failed to store object: %w", err))
+	}
+	if _, err := s.writeFile(path, io.LimitReader(content, size), nil); err != nil {
+		return classify(fmt.Errorf("failed to store object: %w", err))
+	}
+	log.Printf("Stored object: %s", s3Key)
+	return nil
+}
+
+// CopyObject copies srcKey to dstKey within the file's bucket
+func (s *FSStore) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error {
+	bucket = s.ResolveBucket(bucket)
+	src, err := s.open(bucket, srcKey)
+	if err != nil {
+		return classify(fmt.Errorf("failed to copy object: %w", err))
+	}
+	defer src.Close()
+
+	dst, err := s.objectPath(bucket, dstKey)
+	if err != nil {
+		return classify(fmt.Errorf("failed to copy object: %w", err))
+	}
+	if _, err := s.writeFile(dst, src, nil); err != nil {
+		return classify(fmt.Errorf("failed to copy object: %w", err))
+	}
+	log.Printf("Copied object %s to %s", srcKey, dstKey)
+	return nil
+}
+
+// newChecksumHash returns the hash behind a checksum algorithm, or nil if it isn't supported
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	return nil
+}
+
+// ObjectChecksum computes an object's checksum with the given algorithm, base64 encoded
+// as S3 reports it, "" for an unsupported algorithm, or ErrObjectNotFound if nothing is
+// stored under the key yet.
+func (s *FSStore) ObjectChecksum(ctx context.Context, bucket, s3Key, algorithm string) (string, error) {
+	h := newChecksumHash(algorithm)
+	if h == nil {
+		return "", nil
+	}
+	f, err := s.open(bucket, s3Key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return "", err
+		}
+		return "", classify(fmt.Errorf("failed to read object checksum: %w", err))
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", classify(fmt.Errorf("failed to read object checksum: %w", err))
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// ListAllObjects lists every object in the default and shard buckets
+func (s *FSStore) ListAllObjects(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for _, bucket := range s.Buckets() {
+		dir := filepath.Join(s.root, bucket)
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, ObjectInfo{
+				Bucket:       bucket,
+				Key:          filepath.ToSlash(rel),
+				Size:         info.Size(),
+				LastModified: info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, classify(fmt.Errorf("failed to list objects in %s: %w", bucket, err))
+		}
+	}
+	return objects, nil
+}
+
+// InitiateMultipartUpload starts a multipart upload under the user's prefix. As on S3, only
+// a CRC32C checksum can cover a whole multipart object; it is checked on completion.
+func (s *FSStore) InitiateMultipartUpload(ctx context.Context, userID, filename string, opts UploadOptions) (*MultipartUploadInfo, error) {
+	fileID := uuid.New().String()
+	key := ObjectKey(userID, fileID, filename)
+	if err := ValidateObjectKey(userID, key); err != nil {
+		return nil, err
+	}
+	if !opts.Checksum.IsZero() && opts.Checksum.Algorithm != ChecksumCRC32C {
+		return nil, fmt.Errorf("multipart uploads support only %s checksums, not %s", ChecksumCRC32C, opts.Checksum.Algorithm)
+	}
+
+	info := &MultipartUploadInfo{
+		FileID:    fileID,
+		UploadID:  uuid.New().String(),
+		Bucket:    s.BucketFor(fileID),
+		Key:       key,
+		Checksum:  opts.Checksum,
+		URLExpiry: opts.URLExpiry,
+	}
+	dir, _ := s.uploadDir(info.UploadID)
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		return nil, classify(fmt.Errorf("failed to initiate multipart upload: %w", err))
+	}
+
+	log.Printf("Initiated multipart upload: %s (uploadID: %s)", key, info.UploadID)
+	return info, nil
+}
+
+// GenerateMultipartUploadURL creates presigned URLs for each chunk
+func (s *FSStore) GenerateMultipartUploadURL(ctx context.Context, uploadInfo *MultipartUploadInfo, partNumber int) (string, error) {
+	if partNumber < 1 || partNumber > maxPartNumber {
+		return "", fmt.Errorf("failed to generate multipart upload URL for part %d: part numbers run from 1 to %d", partNumber, maxPartNumber)
+	}
+	query := url.Values{}
+	query.Set(fsParamUploadID, uploadInfo.UploadID)
+	query.Set(fsParamPartNumber, strconv.Itoa(partNumber))
+	return s.presign(http.MethodPut, s.ResolveBucket(uploadInfo.Bucket), uploadInfo.Key, urlExpiry(uploadInfo.URLExpiry), query), nil
+}
+
+// UploadPartCopy fills a part of a multipart upload with length bytes of an existing
+// object from offset, as S3 does. The source may be in another shard. It returns the
+// part's ETag.
+func (s *FSStore) UploadPartCopy(ctx context.Context, uploadInfo *MultipartUploadInfo, partNumber int, srcBucket, srcKey string, offset, length int64) (string, error) {
+	if partNumber < 1 || partNumber > maxPartNumber {
+		return "", fmt.Errorf("failed to copy part %d: part numbers run from 1 to %d", partNumber, maxPartNumber)
+	}
+	src, err := s.open(srcBucket, srcKey)
+	if err != nil {
+		return "", classify(fmt.Errorf("failed to copy part %d: %w", partNumber, err))
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", classify(fmt.Errorf("failed to copy part %d: %w", partNumber, err))
+	}
+	if offset < 0 || length <= 0 || offset+length > info.Size() {
+		return "", fmt.Errorf("failed to copy part %d: range %d-%d is outside the %d byte source", partNumber, offset, offset+length-1, info.Size())
+	}
+
+	etag, err := s.putPart(uploadInfo.UploadID, partNumber, io.NewSectionReader(src, offset, length))
+	if err != nil {
+		return "", classify(fmt.Errorf("failed to copy part %d: %w", partNumber, err))
+	}
+	return etag, nil
+}
+
+// CompleteMultipartUpload joins the listed parts, in order, into the object. Each part's
+// ETag must match the part received, as on S3.
+func (s *FSStore) CompleteMultipartUpload(ctx context.Context, uploadInfo *MultipartUploadInfo, parts []CompletedPart) error {
+	dir, err := s.uploadDir(uploadInfo.UploadID)
+	if err != nil {
+		return classify(fmt.Errorf("failed to complete multipart upload: %w", err))
+	}
+	dst, err := s.objectPath(s.ResolveBucket(uploadInfo.Bucket), uploadInfo.Key)
+	if err != nil {
+		return classify(fmt.Errorf("failed to complete multipart upload: %w", err))
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return fmt.Errorf("failed to complete multipart upload: parts must be listed in ascending order")
+		}
+		etag, err := os.ReadFile(partPath(dir, part.PartNumber) + ".etag")
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload: part %d was not uploaded", part.PartNumber)
+		}
+		if strings.Trim(part.ETag, `"`) != strings.Trim(string(etag), `"`) {
+			return fmt.Errorf("failed to complete multipart upload: ETag for part %d does not match", part.PartNumber)
+		}
+		f, err := os.Open(partPath(dir, part.PartNumber))
+		if err != nil {
+			return classify(fmt.Errorf("failed to complete multipart upload: %w", err))
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	var expect *Checksum
+	if uploadInfo.Checksum.Algorithm == ChecksumCRC32C {
+		expect = &uploadInfo.Checksum
+	}
+	if _, err := s.writeFile(dst, io.MultiReader(readers...), expect); err != nil {
+		return classify(fmt.Errorf("failed to complete multipart upload: %w", err))
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Warning: Failed to remove parts of multipart upload %s: %v", uploadInfo.UploadID, err)
+	}
+
+	log.Printf("Completed multipart upload: %s (uploadID: %s)", uploadInfo.Key, uploadInfo.UploadID)
+	return nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts. An upload that no longer
+// exists counts as already aborted.
+func (s *FSStore) AbortMultipartUpload(ctx context.Context, uploadInfo *MultipartUploadInfo) error {
+	dir, err := s.uploadDir(uploadInfo.UploadID)
+	if err != nil {
+		return classify(fmt.Errorf("failed to abort multipart upload: %w", err))
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return classify(fmt.Errorf("failed to abort multipart upload: %w", err))
+	}
+	log.Printf("Aborted multipart upload: %s (uploadID: %s)", uploadInfo.Key, uploadInfo.UploadID)
+	return nil
+}
+
+// ListParts returns every part received for a multipart upload, in part-number order
+func (s *FSStore) ListParts(ctx context.Context, uploadInfo *MultipartUploadInfo) ([]UploadedPart, error) {
+	dir, err := s.uploadDir(uploadInfo.UploadID)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list multipart upload parts: %w", err))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list multipart upload parts: %w", err))
+	}
+
+	var parts []UploadedPart
+	for _, entry := range entries {
+		partNumber, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // An ETag file
+		}
+		part, err := s.readPart(dir, partNumber)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to list multipart upload parts: %w", err))
+		}
+		if part != nil {
+			parts = append(parts, *part)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// GetPart returns the part received under partNumber, or nil if there is none
+func (s *FSStore) GetPart(ctx context.Context, uploadInfo *MultipartUploadInfo, partNumber int) (*UploadedPart, error) {
+	dir, err := s.uploadDir(uploadInfo.UploadID)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to look up part %d: %w", partNumber, err))
+	}
+	part, err := s.readPart(dir, partNumber)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to look up part %d: %w", partNumber, err))
+	}
+	return part, nil
+}
+
+// readPart describes a received part, or returns nil if it hasn't been received. A part
+// counts once its ETag file exists, which is written last.
+func (s *FSStore) readPart(dir string, partNumber int) (*UploadedPart, error) {
+	etag, err := os.ReadFile(partPath(dir, partNumber) + ".etag")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(partPath(dir, partNumber))
+	if err != nil {
+		return nil, err
+	}
+	return &UploadedPart{PartNumber: partNumber, ETag: string(etag), Size: info.Size()}, nil
+}
+
+// writeFile streams content to a temporary file and renames it to path, so readers never
+// see a partial object. With expect set, content that doesn't match the checksum is
+// discarded with ErrChecksumMismatch. It returns the content's quoted MD5 ETag.
+func (s *FSStore) writeFile(path string, content io.Reader, expect *Checksum) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, fsTempDir), "blob-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	sum := md5.New()
+	writers := []io.Writer{tmp, sum}
+	var checksum hash.Hash
+	if expect != nil {
+		if checksum = newChecksumHash(expect.Algorithm); checksum == nil {
+			tmp.Close()
+			return "", fmt.Errorf("unsupported checksum algorithm %q", expect.Algorithm)
+		}
+		writers = append(writers, checksum)
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if checksum != nil && base64.StdEncoding.EncodeToString(checksum.Sum(nil)) != expect.Value {
+		return "", ErrChecksumMismatch
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(sum.Sum(nil)) + `"`, nil
+}
+
+// ServeHTTP serves the presigned URLs the store issues: GET (and HEAD) downloads an
+// object, with Range support, and PUT uploads an object or, with uploadId and partNumber,
+// a multipart upload part. Requests with a bad or expired signature get 403.
+func (s *FSStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, FSBlobPath), "/")
+	path, err := s.objectPath(bucket, key)
+	if !ok || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	signature, _ := hex.DecodeString(query.Get(fsParamSignature))
+	expected, _ := hex.DecodeString(s.sign(method, bucket, key, query))
+	if !hmac.Equal(signature, expected) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	expires, err := strconv.ParseInt(query.Get(fsParamExpires), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		http.Error(w, "URL has expired", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read object", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, "Failed to read object", http.StatusInternalServerError)
+			return
+		}
+		if disposition := query.Get(fsParamContentDisposition); disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+		if contentType := query.Get(fsParamContentType); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		http.ServeContent(w, r, "", info.ModTime(), f)
+
+	case http.MethodPut:
+		var etag string
+		if uploadID := query.Get(fsParamUploadID); uploadID != "" {
+			partNumber, convErr := strconv.Atoi(query.Get(fsParamPartNumber))
+			if convErr != nil || partNumber < 1 || partNumber > maxPartNumber {
+				http.Error(w, "Invalid part number", http.StatusBadRequest)
+				return
+			}
+			etag, err = s.putPart(uploadID, partNumber, r.Body)
+		} else {
+			var expect *Checksum
+			if algorithm := query.Get(fsParamChecksumAlgorithm); algorithm != "" {
+				expect = &Checksum{Algorithm: algorithm, Value: query.Get(fsParamChecksum)}
+			}
+			etag, err = s.writeFile(path, r.Body, expect)
+		}
+		switch {
+		case errors.Is(err, ErrChecksumMismatch):
+			http.Error(w, "Content does not match the declared checksum", http.StatusBadRequest)
+		case errors.Is(err, fs.ErrNotExist):
+			http.Error(w, "No such upload", http.StatusNotFound)
+		case err != nil:
+			log.Printf("Failed to store object %s: %v", key, err)
+			http.Error(w, "Failed to store object", http.StatusInternalServerError)
+		default:
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusOK)
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// putPart stores one part of a multipart upload, then its ETag, so a part is only listed
+// once it is complete. Uploading the same part number again replaces it.
+func (s *FSStore) putPart(uploadID string, partNumber int, content io.Reader) (string, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return "", fs.ErrNotExist // Not an upload this store created
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	etag, err := s.writeFile(partPath(dir, partNumber), content, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(partPath(dir, partNumber)+".etag", []byte(etag), 0o640); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestFSStore serves a store under a temporary root the way the file service does
+func newTestFSStore(t *testing.T) *FSStore {
+	t.Helper()
+	var store *FSStore
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	store, err := NewFSStore(t.TempDir(), srv.URL, []byte("test-key"), "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func put(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestFSStoreUploadAndDownload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFSStore(t)
+
+	sum := sha256.Sum256([]byte("hello world"))
+	checksum := Checksum{Algorithm: ChecksumSHA256, Value: base64.StdEncoding.EncodeToString(sum[:])}
+	uploadURL, fileID, err := store.GenerateUploadURL(ctx, "user-1", "hello.txt", UploadOptions{Checksum: checksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := put(t, uploadURL, "tampered"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT with the wrong content = %d, want 400", resp.StatusCode)
+	}
+	if resp := put(t, strings.Replace(uploadURL, "hello.txt", "other.txt", 1), "hello world"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("PUT to a key the URL wasn't signed for = %d, want 403", resp.StatusCode)
+	}
+	if resp := put(t, uploadURL, "hello world"); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		t.Fatalf("PUT = %d with ETag %q, want 200 and an ETag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	key := ObjectKey("user-1", fileID, "hello.txt")
+	if got, err := store.ObjectChecksum(ctx, "", key, ChecksumSHA256); err != nil || got != checksum.Value {
+		t.Errorf("ObjectChecksum = %q, %v; want %q", got, err, checksum.Value)
+	}
+	if header, err := store.ReadObjectHeader(ctx, "", key, 5); err != nil || string(header) != "hello" {
+		t.Errorf("ReadObjectHeader = %q, %v; want hello", header, err)
+	}
+
+	downloadURL, err := store.GenerateDownloadURL(ctx, "", key, DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, downloadURL, nil)
+	req.Header.Set("Range", "bytes=6-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "world" {
+		t.Errorf("ranged GET = %d %q, want 206 world", resp.StatusCode, body)
+	}
+
+	downloadURL, err = store.GenerateDownloadURL(ctx, "", key, DownloadOptions{ContentDisposition: `attachment; filename="hello.txt"`, ContentType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(downloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Disposition") != `attachment; filename="hello.txt"` || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("GET served with Content-Disposition %q and Content-Type %q", resp.Header.Get("Content-Disposition"), resp.Header.Get("Content-Type"))
+	}
+	resp, err = http.Get(strings.Replace(downloadURL, "text%2Fplain", "text%2Fhtml", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET with a changed content type = %d, want 403", resp.StatusCode)
+	}
+
+	if err := store.CopyObject(ctx, "", key, "quarantine/"+key, 11); err != nil {
+		t.Fatal(err)
+	}
+	if objects, err := store.ListAllObjects(ctx); err != nil || len(objects) != 2 {
+		t.Errorf("ListAllObjects = %+v, %v; want the object and its copy", objects, err)
+	}
+	if err := store.DeleteObject(ctx, "", key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.OpenObject(ctx, "", key); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("OpenObject after delete: %v, want ErrObjectNotFound", err)
+	}
+	if err := store.DeleteObject(ctx, "", key); err != nil {
+		t.Errorf("deleting a missing object: %v, want nil", err)
+	}
+}
+
+func TestFSStoreMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFSStore(t)
+
+	crc := crc32.Checksum([]byte("part one,part two"), crc32.MakeTable(crc32.Castagnoli))
+	checksum := Checksum{Algorithm: ChecksumCRC32C, Value: base64.StdEncoding.EncodeToString([]byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)})}
+	info, err := store.InitiateMultipartUpload(ctx, "user-1", "big.bin", UploadOptions{Checksum: checksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed []CompletedPart
+	for i, content := range []string{"part one,", "part two"} {
+		partURL, err := store.GenerateMultipartUploadURL(ctx, info, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := put(t, partURL, content)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("PUT part %d = %d, want 200", i+1, resp.StatusCode)
+		}
+		completed = append(completed, CompletedPart{PartNumber: i + 1, ETag: resp.Header.Get("ETag")})
+	}
+
+	parts, err := store.ListParts(ctx, info)
+	if err != nil || len(parts) != 2 || parts[1].ETag != completed[1].ETag || parts[1].Size != 8 {
+		t.Errorf("ListParts = %+v, %v; want both parts with their ETags", parts, err)
+	}
+	if part, err := store.GetPart(ctx, info, 3); part != nil || err != nil {
+		t.Errorf("GetPart(3) = %+v, %v; want nil", part, err)
+	}
+
+	wrong := []CompletedPart{completed[0], {PartNumber: 2, ETag: `"wrong"`}}
+	if err := store.CompleteMultipartUpload(ctx, info, wrong); err == nil {
+		t.Error("completing with a wrong ETag succeeded")
+	}
+	if err := store.CompleteMultipartUpload(ctx, info, completed); err != nil {
+		t.Fatal(err)
+	}
+	header, err := store.ReadObjectHeader(ctx, info.Bucket, info.Key, 100)
+	if err != nil || string(header) != "part one,part two" {
+		t.Errorf("completed object = %q, %v; want the parts joined", header, err)
+	}
+	if err := store.AbortMultipartUpload(ctx, info); err != nil {
+		t.Errorf("aborting a completed upload: %v, want nil", err)
+	}
+
+	mismatched, _ := store.InitiateMultipartUpload(ctx, "user-1", "bad.bin", UploadOptions{Checksum: checksum})
+	partURL, _ := store.GenerateMultipartUploadURL(ctx, mismatched, 1)
+	resp := put(t, partURL, "something else")
+	err = store.CompleteMultipartUpload(ctx, mismatched, []CompletedPart{{PartNumber: 1, ETag: resp.Header.Get("ETag")}})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("completing with the wrong content: %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestFSStoreUploadPartCopy(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFSStore(t)
+
+	base := ObjectKey("user-1", "file-1", "base.bin")
+	if err := store.PutObject(ctx, "", base, strings.NewReader("hello, world"), 12); err != nil {
+		t.Fatal(err)
+	}
+	info, err := store.InitiateMultipartUpload(ctx, "user-1", "next.bin", UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.UploadPartCopy(ctx, info, 1, "", base, 7, 6); err == nil {
+		t.Error("copying past the end of the source succeeded")
+	}
+	copied, err := store.UploadPartCopy(ctx, info, 1, "", base, 7, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partURL, _ := store.GenerateMultipartUploadURL(ctx, info, 2)
+	resp := put(t, partURL, "!")
+	parts := []CompletedPart{{PartNumber: 1, ETag: copied}, {PartNumber: 2, ETag: resp.Header.Get("ETag")}}
+	if err := store.CompleteMultipartUpload(ctx, info, parts); err != nil {
+		t.Fatal(err)
+	}
+	header, err := store.ReadObjectHeader(ctx, info.Bucket, info.Key, 100)
+	if err != nil || string(header) != "world!" {
+		t.Errorf("completed object = %q, %v; want the copied range then the uploaded part", header, err)
+	}
+}
+
+func TestFSStoreRejectsPathTraversal(t *testing.T) {
+	store := newTestFSStore(t)
+	for _, key := range []string{"../escape", "users/../../escape", "users//x", ""} {
+		if _, err := store.objectPath("files", key); err == nil {
+			t.Errorf("objectPath(files, %q) succeeded, want an error", key)
+		}
+	}
+	if _, err := store.objectPath(".uploads", "x"); err == nil {
+		t.Error("objectPath allowed the uploads directory as a bucket")
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// InboxSettings are a user's upload by email settings
+type InboxSettings struct {
+	UserID string `json:"user_id" dynamodbav:"userID"`
+	// Who may email files in: addresses, and "@domain" for everyone at a domain
+	AllowedSenders []string `json:"allowed_senders" dynamodbav:"allowedSenders"`
+	UpdatedAt      string   `json:"updated_at" dynamodbav:"updatedAt"`
+}
+
+// GetInboxSettings returns a user's inbox settings, or ErrNotFound if they never saved any
+func (d *DynamoClient) GetInboxSettings(ctx context.Context, userID string) (*InboxSettings, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-inboxes"),
+		Key: map[string]types.AttributeValue{
+			"userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get inbox settings: %w", err))
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("inbox settings %w: %s", ErrNotFound, userID)
+	}
+
+	var settings InboxSettings
+	if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal inbox settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// SaveInboxSettings replaces a user's inbox settings
+func (d *DynamoClient) SaveInboxSettings(ctx context.Context, settings *InboxSettings) error {
+	item, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inbox settings: %w", err)
+	}
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-inboxes"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save inbox settings: %w", err))
+	}
+	return nil
+}
+
+// GetInboxSettings returns a user's inbox settings, or ErrNotFound if they never saved any
+func (p *PostgresClient) GetInboxSettings(ctx context.Context, userID string) (*InboxSettings, error) {
+	var record []byte
+	err := p.pool.QueryRow(ctx, `SELECT record FROM inboxes WHERE user_id = $1`, userID).Scan(&record)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("inbox settings %w: %s", ErrNotFound, userID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get inbox settings: %w", err))
+	}
+
+	var settings InboxSettings
+	if err := json.Unmarshal(record, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal inbox settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// SaveInboxSettings replaces a user's inbox settings
+func (p *PostgresClient) SaveInboxSettings(ctx context.Context, settings *InboxSettings) error {
+	record, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inbox settings: %w", err)
+	}
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO inboxes (user_id, record) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET record = EXCLUDED.record`,
+		settings.UserID, record)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save inbox settings: %w", err))
+	}
+	return nil
+}
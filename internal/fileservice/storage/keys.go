@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// userKeyPrefix is the root under which each user's objects are stored
+const userKeyPrefix = "users/"
+
+// UserKeyPrefix returns the S3 prefix that all of a user's objects live under
+func UserKeyPrefix(userID string) string {
+	return userKeyPrefix + userID + "/"
+}
+
+// ObjectKey builds the S3 key for a user's file: users/{userID}/{fileID}-{filename}
+func ObjectKey(userID, fileID, filename string) string {
+	return UserKeyPrefix(userID) + fileID + "-" + filename
+}
+
+// ValidateObjectKey ensures a key sits directly under the user's prefix, so a presigned
+// URL or completion can never touch another user's objects
+func ValidateObjectKey(userID, key string) error {
+	if userID == "" || strings.ContainsAny(userID, "/\\") {
+		return fmt.Errorf("invalid user ID for object key")
+	}
+
+	prefix := UserKeyPrefix(userID)
+	if !strings.HasPrefix(key, prefix) {
+		return fmt.Errorf("object key %q is outside the user's prefix", key)
+	}
+
+	name := strings.TrimPrefix(key, prefix)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("object key %q is not a valid file key", key)
+	}
+
+	return nil
+}
+
+// RotatedObjectKey builds a fresh key for an existing file, users/{userID}/{fileID}-{token}-{filename},
+// used when its object is moved so URLs presigned for the old key stop working
+func RotatedObjectKey(userID, fileID, filename string) string {
+	return UserKeyPrefix(userID) + fileID + "-" + uuid.New().String()[:8] + "-" + filename
+}
+
+// FileIDFromKey returns the file ID an object key under a user's prefix was built for, by
+// ObjectKey or RotatedObjectKey. It reports false for any other key.
+func FileIDFromKey(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, userKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	_, name, ok := strings.Cut(rest, "/")
+	if !ok || len(name) <= len(uuid.Nil.String()) || name[len(uuid.Nil.String())] != '-' {
+		return "", false
+	}
+	fileID := name[:len(uuid.Nil.String())]
+	if _, err := uuid.Parse(fileID); err != nil {
+		return "", false
+	}
+	return fileID, true
+}
+
+// quarantineKeyPrefix is the root quarantined objects are moved under, away from users' prefixes
+const quarantineKeyPrefix = "quarantine/"
+
+// QuarantineKey returns where a quarantined object is held: its key under quarantine/
+func QuarantineKey(key string) string {
+	return quarantineKeyPrefix + key
+}
+
+// ReleasedKey returns the key a quarantined object is moved back to on release
+func ReleasedKey(quarantineKey string) string {
+	return strings.TrimPrefix(quarantineKey, quarantineKeyPrefix)
+}
@@ -0,0 +1,79 @@
+package storage
+
+import "testing"
+
+func TestValidateObjectKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		key     string
+		wantErr bool
+	}{
+		{
+			name:   "key under user prefix",
+			userID: "user-1",
+			key:    ObjectKey("user-1", "0b6d9b4e-1f2a-4c3d-9e8f-123456789abc", "report.pdf"),
+		},
+		{
+			name:    "key under another user's prefix",
+			userID:  "user-1",
+			key:     ObjectKey("user-2", "0b6d9b4e-1f2a-4c3d-9e8f-123456789abc", "report.pdf"),
+			wantErr: true,
+		},
+		{
+			name:    "legacy unprefixed key",
+			userID:  "user-1",
+			key:     "0b6d9b4e-1f2a-4c3d-9e8f-123456789abc-report.pdf",
+			wantErr: true,
+		},
+		{
+			name:    "nested path escaping the file level",
+			userID:  "user-1",
+			key:     "users/user-1/../user-2/file.pdf",
+			wantErr: true,
+		},
+		{
+			name:    "user ID containing a slash",
+			userID:  "user-1/../user-2",
+			key:     "users/user-1/../user-2/file.pdf",
+			wantErr: true,
+		},
+		{
+			name:    "empty user ID",
+			userID:  "",
+			key:     "users//file.pdf",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateObjectKey(tt.userID, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateObjectKey(%q, %q) error = %v, wantErr %v", tt.userID, tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileIDFromKey(t *testing.T) {
+	const fileID = "0b6d9b4e-1f2a-4c3d-9e8f-123456789abc"
+	for _, key := range []string{
+		ObjectKey("user-1", fileID, "report.pdf"),
+		RotatedObjectKey("user-1", fileID, "report.pdf"),
+	} {
+		if got, ok := FileIDFromKey(key); !ok || got != fileID {
+			t.Errorf("FileIDFromKey(%q) = %q, %v; want %s", key, got, ok, fileID)
+		}
+	}
+	for _, key := range []string{
+		fileID + "-report.pdf",
+		QuarantineKey(ObjectKey("user-1", fileID, "report.pdf")),
+		"users/user-1/not-a-uuid-at-all-but-long-enough-report.pdf",
+		"users/user-1/" + fileID,
+	} {
+		if got, ok := FileIDFromKey(key); ok {
+			t.Errorf("FileIDFromKey(%q) = %q, want no file ID", key, got)
+		}
+	}
+}
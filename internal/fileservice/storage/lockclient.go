@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AcquireLease takes or renews the named lease for owner until ttl from now.
+// It returns false, with no error, while another owner holds an unexpired lease.
+func (d *DynamoClient) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-locks"),
+		Item: map[string]types.AttributeValue{
+			"lockName":  &types.AttributeValueMemberS{Value: name},
+			"owner":     &types.AttributeValueMemberS{Value: owner},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(ttl).UnixMilli(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(lockName) OR #owner = :owner OR expiresAt < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+			":now":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+		},
+	})
+	if err != nil {
+		var held *types.ConditionalCheckFailedException
+		if errors.As(err, &held) {
+			return false, nil
+		}
+		return false, classify(fmt.Errorf("failed to acquire lease %s: %w", name, err))
+	}
+	return true, nil
+}
+
+// ReleaseLease gives up the named lease if owner still holds it
+func (d *DynamoClient) ReleaseLease(ctx context.Context, name, owner string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-locks"),
+		Key: map[string]types.AttributeValue{
+			"lockName": &types.AttributeValueMemberS{Value: name},
+		},
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		var held *types.ConditionalCheckFailedException
+		if errors.As(err, &held) {
+			return nil // Already expired and taken over
+		}
+		return classify(fmt.Errorf("failed to release lease %s: %w", name, err))
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// LoginAttempts counts recent failed sign-ins for one key: an account or a client address.
+// Version goes up by one with each save, so concurrent failures can't overwrite each other.
+type LoginAttempts struct {
+	Key           string    `json:"key" dynamodbav:"attemptKey"`
+	Failures      int       `json:"failures" dynamodbav:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at" dynamodbav:"lastFailureAt"`
+	LockedUntil   time.Time `json:"locked_until,omitempty" dynamodbav:"lockedUntil"` // Zero unless locked
+	// Unix time after which the record is removed (the table's TTL attribute)
+	ExpiresAt int64 `json:"expires_at" dynamodbav:"expiresAt"`
+	Version   int   `json:"version" dynamodbav:"version"`
+}
+
+// GetLoginAttempts returns the failures recorded for key, or an empty record with
+// Version 0 if there are none
+func (d *DynamoClient) GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-login-attempts"),
+		Key: map[string]types.AttributeValue{
+			"attemptKey": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get login attempts: %w", err))
+	}
+	if result.Item == nil {
+		return &LoginAttempts{Key: key}, nil
+	}
+
+	var attempts LoginAttempts
+	if err := attributevalue.UnmarshalMap(result.Item, &attempts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal login attempts: %w", err)
+	}
+	return &attempts, nil
+}
+
+// SaveLoginAttempts writes attempts if the stored record is still the version before it,
+// and returns ErrConditionFailed if another write got there first
+func (d *DynamoClient) SaveLoginAttempts(ctx context.Context, attempts *LoginAttempts) error {
+	item, err := attributevalue.MarshalMap(attempts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal login attempts: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("vibe-drop-login-attempts"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(attemptKey) OR version = :previous"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":previous": &types.AttributeValueMemberN{Value: strconv.Itoa(attempts.Version - 1)},
+		},
+	})
+	if err != nil {
+		var changed *types.ConditionalCheckFailedException
+		if errors.As(err, &changed) {
+			return fmt.Errorf("login attempts for %s changed: %w", attempts.Key, ErrConditionFailed)
+		}
+		return classify(fmt.Errorf("failed to save login attempts: %w", err))
+	}
+	return nil
+}
+
+// DeleteLoginAttempts clears the failures and any lock recorded for key
+func (d *DynamoClient) DeleteLoginAttempts(ctx context.Context, key string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-login-attempts"),
+		Key: map[string]types.AttributeValue{
+			"attemptKey": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete login attempts: %w", err))
+	}
+	return nil
+}
+
+// PurgeExpiredLoginAttempts has nothing to do for DynamoDB, whose TTL deletes expired records
+func (d *DynamoClient) PurgeExpiredLoginAttempts(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+// GetLoginAttempts returns the failures recorded for key, or an empty record with
+// Version 0 if there are none
+func (p *PostgresClient) GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error) {
+	var record []byte
+	err := p.pool.QueryRow(ctx, `SELECT record FROM login_attempts WHERE attempt_key = $1`, key).Scan(&record)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &LoginAttempts{Key: key}, nil
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get login attempts: %w", err))
+	}
+
+	var attempts LoginAttempts
+	if err := json.Unmarshal(record, &attempts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal login attempts: %w", err)
+	}
+	return &attempts, nil
+}
+
+// SaveLoginAttempts writes attempts if the stored record is still the version before it,
+// and returns ErrConditionFailed if another write got there first
+func (p *PostgresClient) SaveLoginAttempts(ctx context.Context, attempts *LoginAttempts) error {
+	record, err := json.Marshal(attempts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal login attempts: %w", err)
+	}
+
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO login_attempts (attempt_key, version, expires_at, record) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (attempt_key) DO UPDATE SET version = EXCLUDED.version, expires_at = EXCLUDED.expires_at, record = EXCLUDED.record
+		WHERE login_attempts.version = $5`,
+		attempts.Key, attempts.Version, attempts.ExpiresAt, record, attempts.Version-1)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save login attempts: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("login attempts for %s changed: %w", attempts.Key, ErrConditionFailed)
+	}
+	return nil
+}
+
+// DeleteLoginAttempts clears the failures and any lock recorded for key
+func (p *PostgresClient) DeleteLoginAttempts(ctx context.Context, key string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM login_attempts WHERE attempt_key = $1`, key); err != nil {
+		return classify(fmt.Errorf("failed to delete login attempts: %w", err))
+	}
+	return nil
+}
+
+// PurgeExpiredLoginAttempts deletes the records that expired before now. PostgreSQL has
+// no TTL, so the login attempt purge job calls this.
+func (p *PostgresClient) PurgeExpiredLoginAttempts(ctx context.Context, now time.Time) (int, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM login_attempts WHERE expires_at < $1`, now.Unix())
+	if err != nil {
+		return 0, classify(fmt.Errorf("failed to purge expired login attempts: %w", err))
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Metadata backends selectable with METADATA_BACKEND
+const (
+	MetadataBackendDynamoDB = "dynamodb" // AWS DynamoDB, or LocalStack via DYNAMO_ENDPOINT
+	MetadataBackendPostgres = "postgres" // A PostgreSQL database at POSTGRES_DSN
+)
+
+// MetadataStore is the database the file service keeps file, chunk, user and job records
+// in. *DynamoClient implements it for DynamoDB, *PostgresClient for PostgreSQL. Packages
+// that need only a few operations declare narrower interfaces of their own.
+type MetadataStore interface {
+	TestConnection(ctx context.Context) error
+
+	SaveFileMetadata(ctx context.Context, metadata *FileMetadata) error
+	GetFileMetadata(ctx context.Context, fileID string) (*FileMetadata, error)
+	ListUserFiles(ctx context.Context, userID string) ([]FileMetadata, error)
+	ListFilesPendingScan(ctx context.Context) ([]FileMetadata, error)
+	ListRecentFiles(ctx context.Context, userID string, limit int) ([]FileMetadata, error)
+	ListFilesByUploadTime(ctx context.Context, userID string, uploaded UploadTimeRange, after *FileCursor, limit int) (*FilesPage, error)
+	ListAllFiles(ctx context.Context) ([]FileMetadata, error)
+	RecordFileAccess(ctx context.Context, fileID string) error
+	SetFileTags(ctx context.Context, fileID string, tags map[string]string) error
+	DeleteFileMetadata(ctx context.Context, fileID string) error
+	DeleteFilesMetadata(ctx context.Context, fileIDs []string) map[string]error
+
+	SaveFileChunk(ctx context.Context, chunk *FileChunk) error
+	SaveFileChunks(ctx context.Context, chunks []FileChunk) error
+	GetFileChunks(ctx context.Context, fileID string) ([]FileChunk, error)
+	WalkFileChunks(ctx context.Context, fileID string, fn func(page []FileChunk) error) error
+	DeleteFileChunks(ctx context.Context, fileID string) error
+	UpdateChunkStatus(ctx context.Context, fileID string, chunkNumber int, status string, etag string) error
+	RecordChunkURLExpiry(ctx context.Context, fileID string, chunkNumber int, expiresAt time.Time) error
+	CheckUploadComplete(ctx context.Context, fileID string) (bool, []FileChunk, error)
+	ExpireFileChunks(ctx context.Context, fileID string, expiresAt time.Time) error
+	PurgeExpiredChunks(ctx context.Context, now time.Time) (int, error)
+
+	CreateUser(ctx context.Context, user *User) error
+	GetUserByID(ctx context.Context, userID string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, userID string) error
+
+	GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error)
+	SaveLoginAttempts(ctx context.Context, attempts *LoginAttempts) error
+	DeleteLoginAttempts(ctx context.Context, key string) error
+	PurgeExpiredLoginAttempts(ctx context.Context, now time.Time) (int, error)
+
+	GetInboxSettings(ctx context.Context, userID string) (*InboxSettings, error)
+	SaveInboxSettings(ctx context.Context, settings *InboxSettings) error
+	GetUploadCallback(ctx context.Context, apiKeyID string) (*UploadCallback, error)
+	SaveUploadCallback(ctx context.Context, callback *UploadCallback) error
+	DeleteUploadCallback(ctx context.Context, apiKeyID string) error
+	GetBlockManifest(ctx context.Context, fileID string) (*BlockManifest, error)
+	SaveBlockManifest(ctx context.Context, manifest *BlockManifest) error
+
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldHash string, next *RefreshToken) error
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) (int, error)
+
+	ReserveStorage(ctx context.Context, userID string, bytes, limit int64) error
+	ReleaseStorage(ctx context.Context, userID string, bytes int64) error
+	GetStorageUsage(ctx context.Context, userID string) (int64, error)
+
+	RecordIssuedURL(ctx context.Context, issued *IssuedURL) error
+	ListIssuedURLs(ctx context.Context, fileID string) ([]IssuedURL, error)
+	MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error)
+
+	CreateOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer) error
+	SaveOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer) error
+	GetOwnershipTransfer(ctx context.Context, transferID string) (*OwnershipTransfer, error)
+	ListUnfinishedOwnershipTransfers(ctx context.Context) ([]OwnershipTransfer, error)
+	ClaimOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer, staleBefore time.Time) (bool, error)
+	TransferFileOwnership(ctx context.Context, metadata *FileMetadata, toUserID, newKey string) error
+
+	SaveOutboxEntry(ctx context.Context, entry *OutboxEntry) error
+	ListOutboxEntries(ctx context.Context) ([]OutboxEntry, error)
+	DeleteOutboxEntry(ctx context.Context, entryID string) error
+
+	SaveUserAnalytics(ctx context.Context, analytics *UserAnalytics) error
+	GetUserAnalytics(ctx context.Context, userID string) (*UserAnalytics, error)
+	SaveSystemMetrics(ctx context.Context, metrics *SystemMetrics) error
+	GetSystemMetrics(ctx context.Context) (*SystemMetrics, error)
+	SaveReconciliationReport(ctx context.Context, report *ReconciliationReport) error
+	GetReconciliationReport(ctx context.Context) (*ReconciliationReport, error)
+	SaveContentTypePolicy(ctx context.Context, record *ContentTypePolicyRecord) error
+	GetContentTypePolicy(ctx context.Context) (*ContentTypePolicyRecord, error)
+	DeleteContentTypePolicy(ctx context.Context) error
+
+	AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, owner string) error
+}
+
+var (
+	_ MetadataStore = (*DynamoClient)(nil)
+	_ MetadataStore = (*PostgresClient)(nil)
+)
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Kinds of write an outbox entry retries
+const (
+	OutboxFileMetadata = "file_metadata"
+	OutboxFileChunks   = "file_chunks"
+)
+
+// OutboxEntry is a file metadata or chunk record write that failed while an upload was
+// being started, kept until a retry succeeds so the upload doesn't become untrackable
+type OutboxEntry struct {
+	EntryID       string        `json:"entryID" dynamodbav:"entryID"`
+	Kind          string        `json:"kind" dynamodbav:"kind"` // OutboxFileMetadata or OutboxFileChunks
+	FileID        string        `json:"fileID" dynamodbav:"fileID"`
+	Metadata      *FileMetadata `json:"metadata,omitempty" dynamodbav:"metadata,omitempty"` // The file metadata to write
+	Chunks        []FileChunk   `json:"chunks,omitempty" dynamodbav:"chunks,omitempty"`     // The chunk records to write
+	Attempts      int           `json:"attempts" dynamodbav:"attempts"`
+	LastError     string        `json:"lastError,omitempty" dynamodbav:"lastError,omitempty"`
+	CreatedAt     string        `json:"createdAt" dynamodbav:"createdAt"`
+	NextAttemptAt string        `json:"nextAttemptAt" dynamodbav:"nextAttemptAt"`
+	// Set once every attempt has failed; the entry is kept for operators but not retried
+	ExhaustedAt *string `json:"exhaustedAt,omitempty" dynamodbav:"exhaustedAt,omitempty"`
+}
+
+// SaveOutboxEntry stores an outbox entry, replacing any earlier version of it
+func (d *DynamoClient) SaveOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-outbox"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save outbox entry: %w", err))
+	}
+	return nil
+}
+
+// ListOutboxEntries returns every outbox entry, exhausted ones included
+func (d *DynamoClient) ListOutboxEntries(ctx context.Context) ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := d.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String("vibe-drop-outbox"),
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to scan outbox: %w", err))
+		}
+
+		var page []OutboxEntry
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal outbox entries: %w", err)
+		}
+		entries = append(entries, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+	return entries, nil
+}
+
+// DeleteOutboxEntry removes an outbox entry; deleting one that is already gone succeeds
+func (d *DynamoClient) DeleteOutboxEntry(ctx context.Context, entryID string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-outbox"),
+		Key: map[string]types.AttributeValue{
+			"entryID": &types.AttributeValueMemberS{Value: entryID},
+		},
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete outbox entry: %w", err))
+	}
+	return nil
+}
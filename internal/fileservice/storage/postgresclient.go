@@ -0,0 +1,1253 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"vibe-drop/internal/common"
+)
+
+// PostgresClient keeps the file service's metadata in PostgreSQL (12 or later), for
+// deployments that don't run DynamoDB. Records the service only reads whole (files,
+// transfers, URL audits, analytics) are stored as JSON documents so their shape can grow
+// without a migration; the fields queries filter on are generated columns with indexes.
+type PostgresClient struct {
+	pool *pgxpool.Pool
+}
+
+// schema creates the tables on startup; every statement is safe to run again
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS files (
+		file_id          text PRIMARY KEY,
+		metadata         jsonb NOT NULL,
+		user_id          text GENERATED ALWAYS AS (metadata->>'userID') STORED,
+		s3_key           text GENERATED ALWAYS AS (metadata->>'s3Key') STORED,
+		scan_status      text GENERATED ALWAYS AS (metadata->>'scanStatus') STORED,
+		last_accessed_at text GENERATED ALWAYS AS (metadata->>'lastAccessedAt') STORED
+	)`,
+	`CREATE INDEX IF NOT EXISTS files_user_id_idx ON files (user_id)`,
+	`CREATE INDEX IF NOT EXISTS files_pending_scan_idx ON files (file_id) WHERE scan_status = 'pending'`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS uploaded_at text GENERATED ALWAYS AS (metadata->>'uploadedAt') STORED`,
+	`CREATE INDEX IF NOT EXISTS files_user_uploaded_idx ON files (user_id, uploaded_at, file_id)`,
+
+	`CREATE TABLE IF NOT EXISTS chunks (
+		file_id        text NOT NULL,
+		chunk_number   integer NOT NULL,
+		size           bigint NOT NULL,
+		etag           text NOT NULL DEFAULT '',
+		status         text NOT NULL,
+		uploaded_at    text NOT NULL DEFAULT '',
+		s3_part_number integer NOT NULL,
+		url_expires_at text NOT NULL DEFAULT '',
+		PRIMARY KEY (file_id, chunk_number)
+	)`,
+	// Unix time after which a completed upload's chunk record is purged; 0 keeps it
+	`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS expires_at bigint NOT NULL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS chunks_expires_at_idx ON chunks (expires_at) WHERE expires_at > 0`,
+
+	`CREATE TABLE IF NOT EXISTS users (
+		user_id       text PRIMARY KEY,
+		username      text NOT NULL,
+		email         text NOT NULL UNIQUE,
+		password_hash text NOT NULL,
+		created_at    text NOT NULL,
+		updated_at    text NOT NULL
+	)`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email text NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_hash text NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_expires_at text NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at text NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_reason text NOT NULL DEFAULT ''`,
+
+	`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash  text PRIMARY KEY,
+		family_id   text NOT NULL,
+		user_id     text NOT NULL,
+		username    text NOT NULL,
+		auth_time   text NOT NULL,
+		created_at  text NOT NULL,
+		expires_at  text NOT NULL,
+		revoked_at  text,
+		replaced_by text
+	)`,
+	`CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id)`,
+
+	`CREATE TABLE IF NOT EXISTS storage_usage (
+		user_id    text PRIMARY KEY,
+		used_bytes bigint NOT NULL,
+		updated_at text NOT NULL
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS issued_urls (
+		file_id text NOT NULL,
+		url_id  text NOT NULL,
+		record  jsonb NOT NULL,
+		PRIMARY KEY (file_id, url_id)
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS ownership_transfers (
+		transfer_id text PRIMARY KEY,
+		transfer    jsonb NOT NULL,
+		status      text GENERATED ALWAYS AS (transfer->>'status') STORED,
+		updated_at  text GENERATED ALWAYS AS (transfer->>'updated_at') STORED
+	)`,
+	`CREATE INDEX IF NOT EXISTS ownership_transfers_unfinished_idx ON ownership_transfers (transfer_id) WHERE status <> 'completed'`,
+
+	`CREATE TABLE IF NOT EXISTS outbox (
+		entry_id text PRIMARY KEY,
+		entry    jsonb NOT NULL
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS user_analytics (
+		user_id   text PRIMARY KEY,
+		analytics jsonb NOT NULL
+	)`,
+	// Singleton records: system metrics, the reconciliation report, the content type policy
+	`CREATE TABLE IF NOT EXISTS documents (
+		name     text PRIMARY KEY,
+		document jsonb NOT NULL
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS login_attempts (
+		attempt_key text PRIMARY KEY,
+		version     integer NOT NULL,
+		expires_at  bigint NOT NULL,
+		record      jsonb NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS login_attempts_expires_at_idx ON login_attempts (expires_at)`,
+
+	`CREATE TABLE IF NOT EXISTS inboxes (
+		user_id text PRIMARY KEY,
+		record  jsonb NOT NULL
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS upload_callbacks (
+		api_key_id text PRIMARY KEY,
+		record     jsonb NOT NULL
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS block_manifests (
+		file_id    text PRIMARY KEY REFERENCES files (file_id) ON DELETE CASCADE,
+		block_size bigint NOT NULL,
+		blocks     bytea NOT NULL,
+		created_at text NOT NULL
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS leases (
+		name       text PRIMARY KEY,
+		owner      text NOT NULL,
+		expires_at timestamptz NOT NULL
+	)`,
+}
+
+// NewPostgresClient connects to the database at dsn and creates any missing tables
+func NewPostgresClient(dsn string) (*PostgresClient, error) {
+	ctx := context.Background()
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL connection string: %w", err)
+	}
+	poolConfig.ConnConfig.Tracer = newQueryTracer()
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PostgreSQL connection pool: %w", err)
+	}
+
+	client := &PostgresClient{pool: pool}
+	for _, statement := range schema {
+		if _, err := pool.Exec(ctx, statement); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("failed to migrate PostgreSQL schema: %w", err)
+		}
+	}
+
+	log.Printf("PostgreSQL Client created for database: %s", pool.Config().ConnConfig.Database)
+	return client, nil
+}
+
+// Close releases the client's connections
+func (p *PostgresClient) Close() {
+	p.pool.Close()
+}
+
+// TestConnection checks the database is reachable
+func (p *PostgresClient) TestConnection(ctx context.Context) error {
+	if err := p.pool.Ping(ctx); err != nil {
+		return classify(fmt.Errorf("failed to connect to PostgreSQL: %w", err))
+	}
+	return nil
+}
+
+// SaveFileMetadata inserts or replaces a file's metadata
+func (p *PostgresClient) SaveFileMetadata(ctx context.Context, metadata *FileMetadata) error {
+	document, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO files (file_id, metadata) VALUES ($1, $2)
+		ON CONFLICT (file_id) DO UPDATE SET metadata = EXCLUDED.metadata`,
+		metadata.FileID, document)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save file metadata: %w", err))
+	}
+
+	log.Printf("Saved file metadata for fileID: %s", metadata.FileID)
+	return nil
+}
+
+// GetFileMetadata retrieves file metadata by fileID
+func (p *PostgresClient) GetFileMetadata(ctx context.Context, fileID string) (*FileMetadata, error) {
+	var document []byte
+	err := p.pool.QueryRow(ctx, `SELECT metadata FROM files WHERE file_id = $1`, fileID).Scan(&document)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("file %w: %s", ErrNotFound, fileID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get file metadata: %w", err))
+	}
+
+	var metadata FileMetadata
+	if err := json.Unmarshal(document, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// queryFiles runs a query selecting the metadata column of files
+func (p *PostgresClient) queryFiles(ctx context.Context, query string, args ...any) ([]FileMetadata, error) {
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileMetadata
+	for _, document := range documents {
+		var metadata FileMetadata
+		if err := json.Unmarshal(document, &metadata); err != nil {
+			log.Printf("Failed to unmarshal file metadata: %v", err)
+			continue
+		}
+		files = append(files, metadata)
+	}
+	return files, nil
+}
+
+// ListUserFiles retrieves all files for a specific user
+func (p *PostgresClient) ListUserFiles(ctx context.Context, userID string) ([]FileMetadata, error) {
+	files, err := p.queryFiles(ctx, `SELECT metadata FROM files WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list user files: %w", err))
+	}
+	return files, nil
+}
+
+// ListFilesPendingScan returns the files waiting for a virus scan
+func (p *PostgresClient) ListFilesPendingScan(ctx context.Context) ([]FileMetadata, error) {
+	files, err := p.queryFiles(ctx, `SELECT metadata FROM files WHERE scan_status = $1`, ScanStatusPending)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list files pending a virus scan: %w", err))
+	}
+	return files, nil
+}
+
+// ListRecentFiles retrieves a user's files ordered by most recent access, newest first
+func (p *PostgresClient) ListRecentFiles(ctx context.Context, userID string, limit int) ([]FileMetadata, error) {
+	files, err := p.queryFiles(ctx, `SELECT metadata FROM files WHERE user_id = $1 AND last_accessed_at IS NOT NULL`, userID)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list recent files: %w", err))
+	}
+
+	// Access times are stored with the writer's UTC offset, so they sort as times, not text
+	sort.Slice(files, func(i, j int) bool {
+		return accessTime(files[i]).After(accessTime(files[j]))
+	})
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+// ListFilesByUploadTime reads up to limit of the user's files, most recently uploaded
+// first, starting after the cursor if there is one. Only files uploaded within uploaded
+// are returned, so a page can hold fewer than limit files and still be followed by another.
+func (p *PostgresClient) ListFilesByUploadTime(ctx context.Context, userID string, uploaded UploadTimeRange, after *FileCursor, limit int) (*FilesPage, error) {
+	query := `SELECT metadata FROM files WHERE user_id = $1`
+	args := []any{userID}
+	from, to := uploaded.textBounds()
+	if from != "" {
+		args = append(args, from)
+		query += fmt.Sprintf(` AND uploaded_at >= $%d`, len(args))
+	}
+	if to != "" {
+		args = append(args, to)
+		query += fmt.Sprintf(` AND uploaded_at <= $%d`, len(args))
+	}
+	if after != nil {
+		args = append(args, after.UploadedAt, after.FileID)
+		query += fmt.Sprintf(` AND (uploaded_at < $%[1]d OR (uploaded_at = $%[1]d AND file_id < $%[2]d))`, len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY uploaded_at DESC, file_id DESC LIMIT $%d`, len(args))
+
+	read, err := p.queryFiles(ctx, query, args...)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list files by upload time: %w", err))
+	}
+	page := &FilesPage{}
+	for _, metadata := range read {
+		if uploaded.Contains(metadata.UploadedAt) {
+			page.Files = append(page.Files, metadata)
+		}
+	}
+	if len(read) == limit {
+		page.Next = CursorFor(&read[len(read)-1])
+	}
+	return page, nil
+}
+
+// ListAllFiles returns every file metadata record
+func (p *PostgresClient) ListAllFiles(ctx context.Context) ([]FileMetadata, error) {
+	files, err := p.queryFiles(ctx, `SELECT metadata FROM files`)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list files: %w", err))
+	}
+	return files, nil
+}
+
+// RecordFileAccess stamps the file's lastAccessedAt with the current time
+func (p *PostgresClient) RecordFileAccess(ctx context.Context, fileID string) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE files SET metadata = metadata || jsonb_build_object('lastAccessedAt', $2::text)
+		WHERE file_id = $1`,
+		fileID, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return classify(fmt.Errorf("failed to record file access: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to record file access: file %w: %s", ErrNotFound, fileID)
+	}
+	return nil
+}
+
+// SetFileTags replaces a file's tags, leaving the rest of its metadata as it is. No tags
+// removes them.
+func (p *PostgresClient) SetFileTags(ctx context.Context, fileID string, tags map[string]string) error {
+	if len(tags) == 0 {
+		tags = nil // Stored as null, which reads back as no tags
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tags: %w", err)
+	}
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE files SET metadata = metadata || jsonb_build_object('tags', $2::jsonb)
+		WHERE file_id = $1`,
+		fileID, string(encoded))
+	if err != nil {
+		return classify(fmt.Errorf("failed to set file tags: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set file tags: file %w: %s", ErrNotFound, fileID)
+	}
+	return nil
+}
+
+// DeleteFileMetadata removes a file's metadata
+func (p *PostgresClient) DeleteFileMetadata(ctx context.Context, fileID string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM files WHERE file_id = $1`, fileID); err != nil {
+		return classify(fmt.Errorf("failed to delete file metadata: %w", err))
+	}
+
+	log.Printf("Deleted file metadata for fileID: %s", fileID)
+	return nil
+}
+
+// DeleteFilesMetadata removes many files' metadata in one statement. It returns the files
+// whose metadata remains, with why: all of them if the statement failed.
+func (p *PostgresClient) DeleteFilesMetadata(ctx context.Context, fileIDs []string) map[string]error {
+	failed := make(map[string]error)
+	if _, err := p.pool.Exec(ctx, `DELETE FROM files WHERE file_id = ANY($1)`, fileIDs); err != nil {
+		err = classify(fmt.Errorf("failed to delete file metadata: %w", err))
+		for _, fileID := range fileIDs {
+			failed[fileID] = err
+		}
+		return failed
+	}
+
+	log.Printf("Deleted file metadata for %d files", len(fileIDs))
+	return failed
+}
+
+const saveChunk = `
+	INSERT INTO chunks (file_id, chunk_number, size, etag, status, uploaded_at, s3_part_number, url_expires_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (file_id, chunk_number) DO UPDATE SET
+		size = EXCLUDED.size, etag = EXCLUDED.etag, status = EXCLUDED.status, uploaded_at = EXCLUDED.uploaded_at,
+		s3_part_number = EXCLUDED.s3_part_number, url_expires_at = EXCLUDED.url_expires_at, expires_at = EXCLUDED.expires_at`
+
+// SaveFileChunk inserts or replaces a chunk's metadata
+func (p *PostgresClient) SaveFileChunk(ctx context.Context, chunk *FileChunk) error {
+	_, err := p.pool.Exec(ctx, saveChunk,
+		chunk.FileID, chunk.ChunkNumber, chunk.Size, chunk.ETag, chunk.Status, chunk.UploadedAt, chunk.S3PartNumber, chunk.URLExpiresAt, chunk.ExpiresAt)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save chunk metadata: %w", err))
+	}
+
+	log.Printf("Saved chunk metadata for fileID: %s, chunk: %d", chunk.FileID, chunk.ChunkNumber)
+	return nil
+}
+
+// SaveFileChunks inserts or replaces many chunks' metadata in one transaction, sent as a
+// single pipelined batch rather than a round trip per chunk
+func (p *PostgresClient) SaveFileChunks(ctx context.Context, chunks []FileChunk) error {
+	batch := &pgx.Batch{}
+	for _, chunk := range chunks {
+		batch.Queue(saveChunk,
+			chunk.FileID, chunk.ChunkNumber, chunk.Size, chunk.ETag, chunk.Status, chunk.UploadedAt, chunk.S3PartNumber, chunk.URLExpiresAt, chunk.ExpiresAt)
+	}
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save chunk metadata: %w", err))
+	}
+
+	log.Printf("Saved %d chunk records", len(chunks))
+	return nil
+}
+
+// chunkPageSize is how many chunk records WalkFileChunks reads per query
+const chunkPageSize = 1000
+
+// GetFileChunks retrieves all unexpired chunks for a file in chunk order
+func (p *PostgresClient) GetFileChunks(ctx context.Context, fileID string) ([]FileChunk, error) {
+	var chunks []FileChunk
+	err := p.WalkFileChunks(ctx, fileID, func(page []FileChunk) error {
+		chunks = append(chunks, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// WalkFileChunks calls fn with each page of a file's unexpired chunks, in chunk order. Each
+// page is its own query, continuing after the last chunk number of the one before. An
+// error from fn stops the walk and is returned.
+func (p *PostgresClient) WalkFileChunks(ctx context.Context, fileID string, fn func(page []FileChunk) error) error {
+	now := time.Now().Unix()
+	after := 0
+	for {
+		rows, err := p.pool.Query(ctx, `
+			SELECT file_id, chunk_number, size, etag, status, uploaded_at, s3_part_number, url_expires_at, expires_at
+			FROM chunks WHERE file_id = $1 AND chunk_number > $2 AND (expires_at = 0 OR expires_at > $3)
+			ORDER BY chunk_number LIMIT $4`,
+			fileID, after, now, chunkPageSize)
+		if err != nil {
+			return classify(fmt.Errorf("failed to get chunks: %w", err))
+		}
+		page, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (FileChunk, error) {
+			var chunk FileChunk
+			err := row.Scan(&chunk.FileID, &chunk.ChunkNumber, &chunk.Size, &chunk.ETag, &chunk.Status,
+				&chunk.UploadedAt, &chunk.S3PartNumber, &chunk.URLExpiresAt, &chunk.ExpiresAt)
+			return chunk, err
+		})
+		if err != nil {
+			return classify(fmt.Errorf("failed to get chunks: %w", err))
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < chunkPageSize {
+			return nil
+		}
+		after = page[len(page)-1].ChunkNumber
+	}
+}
+
+// DeleteFileChunks removes every chunk record for a file
+func (p *PostgresClient) DeleteFileChunks(ctx context.Context, fileID string) error {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM chunks WHERE file_id = $1`, fileID)
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete chunks: %w", err))
+	}
+
+	log.Printf("Deleted %d chunk records for fileID: %s", tag.RowsAffected(), fileID)
+	return nil
+}
+
+// ExpireFileChunks sets every chunk record of a file to expire at expiresAt
+func (p *PostgresClient) ExpireFileChunks(ctx context.Context, fileID string, expiresAt time.Time) error {
+	_, err := p.pool.Exec(ctx, `UPDATE chunks SET expires_at = $2 WHERE file_id = $1`, fileID, expiresAt.Unix())
+	if err != nil {
+		return classify(fmt.Errorf("failed to expire chunks: %w", err))
+	}
+	return nil
+}
+
+// PurgeExpiredChunks deletes the chunk records that expired before now. PostgreSQL has no
+// TTL, so the compaction job calls this on each run.
+func (p *PostgresClient) PurgeExpiredChunks(ctx context.Context, now time.Time) (int, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM chunks WHERE expires_at > 0 AND expires_at <= $1`, now.Unix())
+	if err != nil {
+		return 0, classify(fmt.Errorf("failed to purge expired chunks: %w", err))
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// UpdateChunkStatus updates a chunk's upload status and ETag. When the chunk becomes, or
+// stops being, uploaded, the file's uploadedParts counter is adjusted in the same
+// transaction.
+func (p *PostgresClient) UpdateChunkStatus(ctx context.Context, fileID string, chunkNumber int, status string, etag string) error {
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		// Locking the row makes concurrent reports for the same chunk count it once
+		var previous string
+		err := tx.QueryRow(ctx, `SELECT status FROM chunks WHERE file_id = $1 AND chunk_number = $2 FOR UPDATE`,
+			fileID, chunkNumber).Scan(&previous)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if status == "uploaded" && etag != "" {
+			_, err = tx.Exec(ctx, `
+				UPDATE chunks SET status = $3, etag = $4, uploaded_at = $5
+				WHERE file_id = $1 AND chunk_number = $2`,
+				fileID, chunkNumber, status, etag, time.Now().Format(time.RFC3339))
+		} else {
+			_, err = tx.Exec(ctx, `UPDATE chunks SET status = $3 WHERE file_id = $1 AND chunk_number = $2`,
+				fileID, chunkNumber, status)
+		}
+		if err != nil {
+			return err
+		}
+
+		if delta := uploadedDelta(previous, status); delta != 0 {
+			_, err = tx.Exec(ctx, `
+				UPDATE files SET metadata = metadata || jsonb_build_object('uploadedParts', COALESCE((metadata->>'uploadedParts')::integer, 0) + $2)
+				WHERE file_id = $1`,
+				fileID, delta)
+		}
+		return err
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to update chunk status: %w", err))
+	}
+
+	log.Printf("Updated chunk %d status to %s for fileID: %s", chunkNumber, status, fileID)
+	return nil
+}
+
+// RecordChunkURLExpiry stores when the latest presigned URL issued for a chunk expires
+func (p *PostgresClient) RecordChunkURLExpiry(ctx context.Context, fileID string, chunkNumber int, expiresAt time.Time) error {
+	tag, err := p.pool.Exec(ctx, `UPDATE chunks SET url_expires_at = $3 WHERE file_id = $1 AND chunk_number = $2`,
+		fileID, chunkNumber, expiresAt.Format(time.RFC3339))
+	if err != nil {
+		return classify(fmt.Errorf("failed to record chunk URL expiry: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to record chunk URL expiry: chunk %d of %s %w", chunkNumber, fileID, ErrNotFound)
+	}
+	return nil
+}
+
+// CheckUploadComplete checks if all chunks are uploaded and returns completion status
+func (p *PostgresClient) CheckUploadComplete(ctx context.Context, fileID string) (bool, []FileChunk, error) {
+	chunks, err := p.GetFileChunks(ctx, fileID)
+	if err != nil {
+		return false, nil, err
+	}
+	return allChunksUploaded(chunks), chunks, nil
+}
+
+// CreateUser saves a new user; the email must not belong to another user
+func (p *PostgresClient) CreateUser(ctx context.Context, user *User) error {
+	now := time.Now().Format(time.RFC3339)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`, userArgs(user)...)
+	if err != nil {
+		return classify(fmt.Errorf("failed to create user: %w", err))
+	}
+	return nil
+}
+
+const userColumns = `user_id, username, email, password_hash, created_at, updated_at, totp_secret, totp_enabled, totp_last_step,
+	pending_email, email_verification_hash, email_verification_expires_at, role, suspended_at, suspended_reason`
+
+func userArgs(user *User) []any {
+	return []any{user.UserID, user.Username, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt,
+		user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep,
+		user.PendingEmail, user.EmailVerificationHash, user.EmailVerificationExpiresAt,
+		user.Role, user.SuspendedAt, user.SuspendedReason}
+}
+
+// scanUser reads a row of userColumns
+func scanUser(row pgx.Row) (*User, error) {
+	var user User
+	err := row.Scan(&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep,
+		&user.PendingEmail, &user.EmailVerificationHash, &user.EmailVerificationExpiresAt,
+		&user.Role, &user.SuspendedAt, &user.SuspendedReason)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (p *PostgresClient) getUser(ctx context.Context, column, value string) (*User, error) {
+	return scanUser(p.pool.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE `+column+` = $1`, value))
+}
+
+// GetUserByID retrieves a user by their ID
+func (p *PostgresClient) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	user, err := p.getUser(ctx, "user_id", userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user %w: %s", ErrNotFound, userID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get user: %w", err))
+	}
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by their email address
+func (p *PostgresClient) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	user, err := p.getUser(ctx, "email", email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user %w with email: %s", ErrNotFound, email)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to query user by email: %w", err))
+	}
+	return user, nil
+}
+
+// ListUsers returns every user, oldest account first
+func (p *PostgresClient) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+userColumns+` FROM users ORDER BY created_at, user_id`)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list users: %w", err))
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to list users: %w", err))
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, classify(fmt.Errorf("failed to list users: %w", err))
+	}
+	return users, nil
+}
+
+// UpdateUser updates user information
+func (p *PostgresClient) UpdateUser(ctx context.Context, user *User) error {
+	user.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (user_id) DO UPDATE SET
+			username = EXCLUDED.username, email = EXCLUDED.email, password_hash = EXCLUDED.password_hash,
+			created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at,
+			totp_secret = EXCLUDED.totp_secret, totp_enabled = EXCLUDED.totp_enabled, totp_last_step = EXCLUDED.totp_last_step,
+			pending_email = EXCLUDED.pending_email, email_verification_hash = EXCLUDED.email_verification_hash,
+			email_verification_expires_at = EXCLUDED.email_verification_expires_at,
+			role = EXCLUDED.role, suspended_at = EXCLUDED.suspended_at, suspended_reason = EXCLUDED.suspended_reason`, userArgs(user)...)
+	if err != nil {
+		return classify(fmt.Errorf("failed to update user: %w", err))
+	}
+	return nil
+}
+
+// DeleteUser deletes a user and their inbox settings, so mail to their inbox address is
+// no longer accepted. Their files must be deleted first.
+func (p *PostgresClient) DeleteUser(ctx context.Context, userID string) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete user: %w", err))
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM inboxes WHERE user_id = $1`, userID); err != nil {
+		return classify(fmt.Errorf("failed to delete inbox settings: %w", err))
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE user_id = $1`, userID); err != nil {
+		return classify(fmt.Errorf("failed to delete user: %w", err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return classify(fmt.Errorf("failed to delete user: %w", err))
+	}
+	return nil
+}
+
+const insertRefreshToken = `
+	INSERT INTO refresh_tokens (token_hash, family_id, user_id, username, auth_time, created_at, expires_at, revoked_at, replaced_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+func refreshTokenArgs(token *RefreshToken) []any {
+	return []any{token.TokenHash, token.FamilyID, token.UserID, token.Username, token.AuthTime,
+		token.CreatedAt, token.ExpiresAt, token.RevokedAt, token.ReplacedBy}
+}
+
+// SaveRefreshToken stores a newly issued refresh token
+func (p *PostgresClient) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	if _, err := p.pool.Exec(ctx, insertRefreshToken, refreshTokenArgs(token)...); err != nil {
+		return classify(fmt.Errorf("failed to save refresh token: %w", err))
+	}
+	return nil
+}
+
+// GetRefreshToken looks up a refresh token by its hash
+func (p *PostgresClient) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := p.pool.QueryRow(ctx, `
+		SELECT token_hash, family_id, user_id, username, auth_time, created_at, expires_at, revoked_at, replaced_by
+		FROM refresh_tokens WHERE token_hash = $1`, tokenHash).
+		Scan(&token.TokenHash, &token.FamilyID, &token.UserID, &token.Username, &token.AuthTime,
+			&token.CreatedAt, &token.ExpiresAt, &token.RevokedAt, &token.ReplacedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get refresh token: %w", err))
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken revokes the token with oldHash and stores next in one transaction.
+// It returns ErrRefreshTokenRevoked if the old token was already revoked, so two
+// concurrent refreshes with the same token can't both succeed.
+func (p *PostgresClient) RotateRefreshToken(ctx context.Context, oldHash string, next *RefreshToken) error {
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE refresh_tokens SET revoked_at = $2, replaced_by = $3
+			WHERE token_hash = $1 AND revoked_at IS NULL`,
+			oldHash, next.CreatedAt, next.TokenHash)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrRefreshTokenRevoked
+		}
+		_, err = tx.Exec(ctx, insertRefreshToken, refreshTokenArgs(next)...)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenRevoked) {
+		return err
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to rotate refresh token: %w", err))
+	}
+	return nil
+}
+
+// RevokeRefreshToken revokes one refresh token. Revoking an unknown or already revoked
+// token is not an error, so logout is idempotent.
+func (p *PostgresClient) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := p.pool.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE token_hash = $1 AND revoked_at IS NULL`,
+		tokenHash, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return classify(fmt.Errorf("failed to revoke refresh token: %w", err))
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every unrevoked token in a family and returns how many it revoked
+func (p *PostgresClient) RevokeRefreshTokenFamily(ctx context.Context, familyID string) (int, error) {
+	tag, err := p.pool.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`,
+		familyID, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return 0, classify(fmt.Errorf("failed to revoke refresh token family: %w", err))
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ReserveStorage atomically adds bytes to the user's usage unless the total would exceed limit
+func (p *PostgresClient) ReserveStorage(ctx context.Context, userID string, bytes, limit int64) error {
+	if bytes > limit {
+		return ErrQuotaExceeded
+	}
+
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO storage_usage (user_id, used_bytes, updated_at) VALUES ($1, $2, $4)
+		ON CONFLICT (user_id) DO UPDATE SET used_bytes = storage_usage.used_bytes + EXCLUDED.used_bytes, updated_at = EXCLUDED.updated_at
+		WHERE storage_usage.used_bytes <= $3`,
+		userID, bytes, limit-bytes, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return classify(fmt.Errorf("failed to reserve storage: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+const releaseStorage = `
+	UPDATE storage_usage SET used_bytes = GREATEST(used_bytes - $2, 0), updated_at = $3
+	WHERE user_id = $1`
+
+const reserveStorage = `
+	INSERT INTO storage_usage (user_id, used_bytes, updated_at) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE SET used_bytes = storage_usage.used_bytes + EXCLUDED.used_bytes, updated_at = EXCLUDED.updated_at`
+
+// ReleaseStorage subtracts bytes from the user's usage, stopping at zero for files
+// stored before usage was tracked
+func (p *PostgresClient) ReleaseStorage(ctx context.Context, userID string, bytes int64) error {
+	if _, err := p.pool.Exec(ctx, releaseStorage, userID, bytes, time.Now().Format(time.RFC3339)); err != nil {
+		return classify(fmt.Errorf("failed to release storage: %w", err))
+	}
+	return nil
+}
+
+// GetStorageUsage returns the bytes counted against the user's quota (zero if none yet)
+func (p *PostgresClient) GetStorageUsage(ctx context.Context, userID string) (int64, error) {
+	var bytes int64
+	err := p.pool.QueryRow(ctx, `SELECT used_bytes FROM storage_usage WHERE user_id = $1`, userID).Scan(&bytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, classify(fmt.Errorf("failed to get storage usage: %w", err))
+	}
+	return bytes, nil
+}
+
+// RecordIssuedURL saves the audit record of an issued presigned URL
+func (p *PostgresClient) RecordIssuedURL(ctx context.Context, issued *IssuedURL) error {
+	record, err := json.Marshal(issued)
+	if err != nil {
+		return fmt.Errorf("failed to marshal issued URL: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO issued_urls (file_id, url_id, record) VALUES ($1, $2, $3)
+		ON CONFLICT (file_id, url_id) DO UPDATE SET record = EXCLUDED.record`,
+		issued.FileID, issued.URLID, record)
+	if err != nil {
+		return classify(fmt.Errorf("failed to record issued URL: %w", err))
+	}
+	return nil
+}
+
+// ListIssuedURLs returns every presigned URL recorded for a file, oldest first
+func (p *PostgresClient) ListIssuedURLs(ctx context.Context, fileID string) ([]IssuedURL, error) {
+	rows, err := p.pool.Query(ctx, `SELECT record FROM issued_urls WHERE file_id = $1 ORDER BY url_id`, fileID)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list issued URLs: %w", err))
+	}
+	records, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list issued URLs: %w", err))
+	}
+
+	var issued []IssuedURL
+	for _, record := range records {
+		var url IssuedURL
+		if err := json.Unmarshal(record, &url); err != nil {
+			log.Printf("Failed to unmarshal issued URL record: %v", err)
+			continue
+		}
+		issued = append(issued, url)
+	}
+	return issued, nil
+}
+
+// MarkURLsRevoked stamps every still-active URL recorded for a file as revoked at
+// revokedAt and returns how many it marked
+func (p *PostgresClient) MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error) {
+	issued, err := p.ListIssuedURLs(ctx, fileID)
+	if err != nil {
+		return 0, err
+	}
+
+	var active []string
+	for _, record := range issued {
+		if record.Active(revokedAt) {
+			active = append(active, record.URLID)
+		}
+	}
+	if len(active) == 0 {
+		return 0, nil
+	}
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE issued_urls SET record = record || jsonb_build_object('revoked_at', $3::text)
+		WHERE file_id = $1 AND url_id = ANY($2)`,
+		fileID, active, revokedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, classify(fmt.Errorf("failed to mark URLs revoked: %w", err))
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// CreateOwnershipTransfer stores a new transfer request
+func (p *PostgresClient) CreateOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer) error {
+	document, err := json.Marshal(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ownership transfer: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `INSERT INTO ownership_transfers (transfer_id, transfer) VALUES ($1, $2)`,
+		transfer.TransferID, document)
+	if err != nil {
+		return classify(fmt.Errorf("failed to create ownership transfer: %w", err))
+	}
+	return nil
+}
+
+// SaveOwnershipTransfer stores a transfer's progress
+func (p *PostgresClient) SaveOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer) error {
+	document, err := json.Marshal(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ownership transfer: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO ownership_transfers (transfer_id, transfer) VALUES ($1, $2)
+		ON CONFLICT (transfer_id) DO UPDATE SET transfer = EXCLUDED.transfer`,
+		transfer.TransferID, document)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save ownership transfer: %w", err))
+	}
+	return nil
+}
+
+// GetOwnershipTransfer retrieves a transfer by ID
+func (p *PostgresClient) GetOwnershipTransfer(ctx context.Context, transferID string) (*OwnershipTransfer, error) {
+	var document []byte
+	err := p.pool.QueryRow(ctx, `SELECT transfer FROM ownership_transfers WHERE transfer_id = $1`, transferID).Scan(&document)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("ownership transfer %w: %s", ErrNotFound, transferID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get ownership transfer: %w", err))
+	}
+
+	var transfer OwnershipTransfer
+	if err := json.Unmarshal(document, &transfer); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ownership transfer: %w", err)
+	}
+	return &transfer, nil
+}
+
+// ListUnfinishedOwnershipTransfers returns the transfers that are pending or running
+func (p *PostgresClient) ListUnfinishedOwnershipTransfers(ctx context.Context) ([]OwnershipTransfer, error) {
+	rows, err := p.pool.Query(ctx, `SELECT transfer FROM ownership_transfers WHERE status <> $1`, TransferStatusCompleted)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list ownership transfers: %w", err))
+	}
+	documents, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list ownership transfers: %w", err))
+	}
+
+	var transfers []OwnershipTransfer
+	for _, document := range documents {
+		var transfer OwnershipTransfer
+		if err := json.Unmarshal(document, &transfer); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ownership transfers: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// ClaimOwnershipTransfer marks a transfer running so only one replica works on it. A
+// pending transfer can always be claimed; a running one only once its heartbeat is older
+// than staleBefore, i.e. the replica running it stopped. It reports whether the claim won.
+func (p *PostgresClient) ClaimOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer, staleBefore time.Time) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE ownership_transfers SET transfer = transfer || jsonb_build_object('status', $2::text, 'updated_at', $4::text)
+		WHERE transfer_id = $1 AND (status = $3 OR (status = $2 AND updated_at < $5))`,
+		transfer.TransferID, TransferStatusRunning, TransferStatusPending, now, staleBefore.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, classify(fmt.Errorf("failed to claim ownership transfer: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	transfer.Status = TransferStatusRunning
+	transfer.UpdatedAt = now
+	return true, nil
+}
+
+// TransferFileOwnership reassigns a file to toUserID under newKey and moves its size from
+// the old owner's storage usage to the new owner's, all in one transaction. It returns
+// ErrOwnershipChanged if the file's owner or key no longer match metadata.
+func (p *PostgresClient) TransferFileOwnership(ctx context.Context, metadata *FileMetadata, toUserID, newKey string) error {
+	now := time.Now().Format(time.RFC3339)
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE files SET metadata = metadata || jsonb_build_object('userID', $2::text, 's3Key', $3::text)
+			WHERE file_id = $1 AND user_id = $4 AND s3_key = $5`,
+			metadata.FileID, toUserID, newKey, metadata.UserID, metadata.S3Key)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrOwnershipChanged
+		}
+		if _, err := tx.Exec(ctx, releaseStorage, metadata.UserID, metadata.TotalSize, now); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, reserveStorage, toUserID, metadata.TotalSize, now)
+		return err
+	})
+	if errors.Is(err, ErrOwnershipChanged) {
+		return err
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to transfer file ownership: %w", err))
+	}
+	return nil
+}
+
+// SaveOutboxEntry stores an outbox entry, replacing any earlier version of it
+func (p *PostgresClient) SaveOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	document, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO outbox (entry_id, entry) VALUES ($1, $2)
+		ON CONFLICT (entry_id) DO UPDATE SET entry = EXCLUDED.entry`,
+		entry.EntryID, document)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save outbox entry: %w", err))
+	}
+	return nil
+}
+
+// ListOutboxEntries returns every outbox entry, exhausted ones included
+func (p *PostgresClient) ListOutboxEntries(ctx context.Context) ([]OutboxEntry, error) {
+	rows, err := p.pool.Query(ctx, `SELECT entry FROM outbox`)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list outbox entries: %w", err))
+	}
+	documents, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to list outbox entries: %w", err))
+	}
+
+	var entries []OutboxEntry
+	for _, document := range documents {
+		var entry OutboxEntry
+		if err := json.Unmarshal(document, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal outbox entries: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// DeleteOutboxEntry removes an outbox entry; deleting one that is already gone succeeds
+func (p *PostgresClient) DeleteOutboxEntry(ctx context.Context, entryID string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM outbox WHERE entry_id = $1`, entryID); err != nil {
+		return classify(fmt.Errorf("failed to delete outbox entry: %w", err))
+	}
+	return nil
+}
+
+// SaveUserAnalytics stores the latest analytics snapshot for a user
+func (p *PostgresClient) SaveUserAnalytics(ctx context.Context, analytics *UserAnalytics) error {
+	document, err := json.Marshal(analytics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal analytics: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO user_analytics (user_id, analytics) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET analytics = EXCLUDED.analytics`,
+		analytics.UserID, document)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save analytics: %w", err))
+	}
+	return nil
+}
+
+// GetUserAnalytics retrieves the latest analytics snapshot for a user
+func (p *PostgresClient) GetUserAnalytics(ctx context.Context, userID string) (*UserAnalytics, error) {
+	var document []byte
+	err := p.pool.QueryRow(ctx, `SELECT analytics FROM user_analytics WHERE user_id = $1`, userID).Scan(&document)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("analytics %w for user: %s", ErrNotFound, userID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get analytics: %w", err))
+	}
+
+	var analytics UserAnalytics
+	if err := json.Unmarshal(document, &analytics); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal analytics: %w", err)
+	}
+	return &analytics, nil
+}
+
+// saveDocument stores one of the singleton records under name
+func (p *PostgresClient) saveDocument(ctx context.Context, name string, value any) error {
+	document, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO documents (name, document) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET document = EXCLUDED.document`,
+		name, document)
+	return err
+}
+
+// getDocument loads the singleton record under name into value, reporting whether it exists
+func (p *PostgresClient) getDocument(ctx context.Context, name string, value any) (bool, error) {
+	var document []byte
+	err := p.pool.QueryRow(ctx, `SELECT document FROM documents WHERE name = $1`, name).Scan(&document)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(document, value)
+}
+
+// SaveSystemMetrics stores the latest system-wide metrics snapshot
+func (p *PostgresClient) SaveSystemMetrics(ctx context.Context, metrics *SystemMetrics) error {
+	if err := p.saveDocument(ctx, systemMetricsKey, metrics); err != nil {
+		return classify(fmt.Errorf("failed to save system metrics: %w", err))
+	}
+	return nil
+}
+
+// GetSystemMetrics retrieves the latest system-wide metrics snapshot
+func (p *PostgresClient) GetSystemMetrics(ctx context.Context) (*SystemMetrics, error) {
+	var metrics SystemMetrics
+	found, err := p.getDocument(ctx, systemMetricsKey, &metrics)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get system metrics: %w", err))
+	}
+	if !found {
+		return nil, fmt.Errorf("system metrics not computed yet: %w", ErrNotFound)
+	}
+	return &metrics, nil
+}
+
+// SaveReconciliationReport stores the latest reconciliation report
+func (p *PostgresClient) SaveReconciliationReport(ctx context.Context, report *ReconciliationReport) error {
+	if err := p.saveDocument(ctx, reconciliationReportKey, report); err != nil {
+		return classify(fmt.Errorf("failed to save reconciliation report: %w", err))
+	}
+	return nil
+}
+
+// GetReconciliationReport retrieves the latest reconciliation report
+func (p *PostgresClient) GetReconciliationReport(ctx context.Context) (*ReconciliationReport, error) {
+	var report ReconciliationReport
+	found, err := p.getDocument(ctx, reconciliationReportKey, &report)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get reconciliation report: %w", err))
+	}
+	if !found {
+		return nil, fmt.Errorf("reconciliation has not run yet: %w", ErrNotFound)
+	}
+	return &report, nil
+}
+
+// postgresContentTypePolicy is the stored document; ContentTypePolicyRecord has no JSON tags
+type postgresContentTypePolicy struct {
+	Policy    json.RawMessage `json:"policy"`
+	UpdatedAt string          `json:"updatedAt"`
+}
+
+// SaveContentTypePolicy stores the policy uploads are checked against, replacing any earlier one
+func (p *PostgresClient) SaveContentTypePolicy(ctx context.Context, record *ContentTypePolicyRecord) error {
+	policy, err := json.Marshal(record.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode content type policy: %w", err)
+	}
+	stored := postgresContentTypePolicy{Policy: policy, UpdatedAt: record.UpdatedAt}
+	if err := p.saveDocument(ctx, contentTypePolicyKey, stored); err != nil {
+		return classify(fmt.Errorf("failed to save content type policy: %w", err))
+	}
+	return nil
+}
+
+// GetContentTypePolicy retrieves the admin-set policy, or ErrNoContentTypePolicy if there is none
+func (p *PostgresClient) GetContentTypePolicy(ctx context.Context) (*ContentTypePolicyRecord, error) {
+	var stored postgresContentTypePolicy
+	found, err := p.getDocument(ctx, contentTypePolicyKey, &stored)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get content type policy: %w", err))
+	}
+	if !found {
+		return nil, ErrNoContentTypePolicy
+	}
+	policy, err := common.ParseContentTypePolicy(stored.Policy)
+	if err != nil {
+		return nil, err
+	}
+	return &ContentTypePolicyRecord{Policy: policy, UpdatedAt: stored.UpdatedAt}, nil
+}
+
+// DeleteContentTypePolicy removes the admin-set policy so the configured one applies again
+func (p *PostgresClient) DeleteContentTypePolicy(ctx context.Context) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM documents WHERE name = $1`, contentTypePolicyKey); err != nil {
+		return classify(fmt.Errorf("failed to delete content type policy: %w", err))
+	}
+	return nil
+}
+
+// AcquireLease takes or renews the named lease for owner until ttl from now.
+// It returns false, with no error, while another owner holds an unexpired lease.
+func (p *PostgresClient) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO leases (name, owner, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+		WHERE leases.owner = EXCLUDED.owner OR leases.expires_at < $4`,
+		name, owner, now.Add(ttl), now)
+	if err != nil {
+		return false, classify(fmt.Errorf("failed to acquire lease %s: %w", name, err))
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseLease gives up the named lease if owner still holds it
+func (p *PostgresClient) ReleaseLease(ctx context.Context, name, owner string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM leases WHERE name = $1 AND owner = $2`, name, owner); err != nil {
+		return classify(fmt.Errorf("failed to release lease %s: %w", name, err))
+	}
+	return nil
+}
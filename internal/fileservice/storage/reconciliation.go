@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// reconciliationReportKey is the reserved analytics item holding the latest reconciliation report
+const reconciliationReportKey = "reconciliation"
+
+// ReconciliationReport lists drift between the bucket and the file metadata table
+type ReconciliationReport struct {
+	Key            string          `json:"-" dynamodbav:"userID"`
+	StartedAt      string          `json:"started_at" dynamodbav:"startedAt"`
+	CompletedAt    string          `json:"completed_at" dynamodbav:"completedAt"`
+	AutoRepair     bool            `json:"auto_repair" dynamodbav:"autoRepair"`
+	ObjectsScanned int             `json:"objects_scanned" dynamodbav:"objectsScanned"`
+	RecordsScanned int             `json:"records_scanned" dynamodbav:"recordsScanned"`
+	OrphanCount    int             `json:"orphan_count" dynamodbav:"orphanCount"`
+	MissingCount   int             `json:"missing_count" dynamodbav:"missingCount"`
+	OrphanObjects  []OrphanObject  `json:"orphan_objects" dynamodbav:"orphanObjects"`
+	MissingObjects []MissingObject `json:"missing_objects" dynamodbav:"missingObjects"`
+	Truncated      bool            `json:"truncated" dynamodbav:"truncated"` // Lists were cut to fit in one item
+}
+
+// OrphanObject is a stored object no metadata record refers to
+type OrphanObject struct {
+	Bucket       string `json:"bucket" dynamodbav:"bucket"`
+	Key          string `json:"key" dynamodbav:"key"`
+	Size         int64  `json:"size" dynamodbav:"size"`
+	LastModified string `json:"last_modified" dynamodbav:"lastModified"`
+	Repaired     bool   `json:"repaired" dynamodbav:"repaired"` // Object was deleted
+}
+
+// MissingObject is a metadata record whose object is not in the bucket
+type MissingObject struct {
+	FileID     string `json:"file_id" dynamodbav:"fileID"`
+	UserID     string `json:"user_id" dynamodbav:"userID"`
+	Bucket     string `json:"bucket" dynamodbav:"bucket"`
+	S3Key      string `json:"s3_key" dynamodbav:"s3Key"`
+	Status     string `json:"status" dynamodbav:"status"`
+	UploadType string `json:"upload_type" dynamodbav:"uploadType"`
+	UploadedAt string `json:"uploaded_at" dynamodbav:"uploadedAt"`
+	Repaired   bool   `json:"repaired" dynamodbav:"repaired"` // Record was deleted
+}
+
+// SaveReconciliationReport stores the latest reconciliation report
+func (d *DynamoClient) SaveReconciliationReport(ctx context.Context, report *ReconciliationReport) error {
+	report.Key = reconciliationReportKey
+	item, err := attributevalue.MarshalMap(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reconciliation report: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save reconciliation report: %w", err))
+	}
+
+	return nil
+}
+
+// GetReconciliationReport retrieves the latest reconciliation report
+func (d *DynamoClient) GetReconciliationReport(ctx context.Context) (*ReconciliationReport, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-analytics"),
+		Key: map[string]types.AttributeValue{
+			"userID": &types.AttributeValueMemberS{Value: reconciliationReportKey},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get reconciliation report: %w", err))
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("reconciliation has not run yet: %w", ErrNotFound)
+	}
+
+	var report ReconciliationReport
+	if err := attributevalue.UnmarshalMap(result.Item, &report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reconciliation report: %w", err)
+	}
+
+	return &report, nil
+}
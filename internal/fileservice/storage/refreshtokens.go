@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// ErrRefreshTokenNotFound is returned when no refresh token has the given hash
+	ErrRefreshTokenNotFound = fmt.Errorf("refresh token %w", ErrNotFound)
+	// ErrRefreshTokenRevoked is returned when rotating a refresh token that was already used or revoked
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+)
+
+// RefreshToken is the stored record of an issued refresh token. Only the token's hash is
+// kept. Each rotation issues a new token in the same family, so reuse of an old one can
+// revoke the whole session.
+type RefreshToken struct {
+	TokenHash  string  `json:"token_hash" dynamodbav:"tokenHash"`
+	FamilyID   string  `json:"family_id" dynamodbav:"familyID"` // Shared by every token rotated from one sign-in
+	UserID     string  `json:"user_id" dynamodbav:"userID"`
+	Username   string  `json:"username" dynamodbav:"username"`
+	AuthTime   string  `json:"auth_time" dynamodbav:"authTime"` // The sign-in that started the family
+	CreatedAt  string  `json:"created_at" dynamodbav:"createdAt"`
+	ExpiresAt  string  `json:"expires_at" dynamodbav:"expiresAt"`
+	RevokedAt  *string `json:"revoked_at,omitempty" dynamodbav:"revokedAt,omitempty"`
+	ReplacedBy *string `json:"replaced_by,omitempty" dynamodbav:"replacedBy,omitempty"` // Hash of the token it was rotated to
+}
+
+// Expired reports whether the token's lifetime has ended at now
+func (t RefreshToken) Expired(now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, t.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+func refreshTokenKey(tokenHash string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"tokenHash": &types.AttributeValueMemberS{Value: tokenHash},
+	}
+}
+
+// SaveRefreshToken stores a newly issued refresh token
+func (d *DynamoClient) SaveRefreshToken(ctx context.Context, token *RefreshToken) error {
+	item, err := attributevalue.MarshalMap(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("vibe-drop-refresh-tokens"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(tokenHash)"),
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save refresh token: %w", err))
+	}
+	return nil
+}
+
+// GetRefreshToken looks up a refresh token by its hash
+func (d *DynamoClient) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String("vibe-drop-refresh-tokens"),
+		Key:            refreshTokenKey(tokenHash),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get refresh token: %w", err))
+	}
+	if result.Item == nil {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	var token RefreshToken
+	if err := attributevalue.UnmarshalMap(result.Item, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken revokes the token with oldHash and stores next in one transaction.
+// It returns ErrRefreshTokenRevoked if the old token was already revoked, so two
+// concurrent refreshes with the same token can't both succeed.
+func (d *DynamoClient) RotateRefreshToken(ctx context.Context, oldHash string, next *RefreshToken) error {
+	item, err := attributevalue.MarshalMap(next)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:           aws.String("vibe-drop-refresh-tokens"),
+					Key:                 refreshTokenKey(oldHash),
+					UpdateExpression:    aws.String("SET revokedAt = :now, replacedBy = :next"),
+					ConditionExpression: aws.String("attribute_exists(tokenHash) AND attribute_not_exists(revokedAt)"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":now":  &types.AttributeValueMemberS{Value: next.CreatedAt},
+						":next": &types.AttributeValueMemberS{Value: next.TokenHash},
+					},
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String("vibe-drop-refresh-tokens"),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(tokenHash)"),
+				},
+			},
+		},
+	})
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		return ErrRefreshTokenRevoked
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to rotate refresh token: %w", err))
+	}
+	return nil
+}
+
+// RevokeRefreshToken revokes one refresh token. Revoking an unknown or already revoked
+// token is not an error, so logout is idempotent.
+func (d *DynamoClient) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String("vibe-drop-refresh-tokens"),
+		Key:                 refreshTokenKey(tokenHash),
+		UpdateExpression:    aws.String("SET revokedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(tokenHash) AND attribute_not_exists(revokedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+		},
+	})
+	var alreadyRevoked *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &alreadyRevoked) {
+		return classify(fmt.Errorf("failed to revoke refresh token: %w", err))
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every unrevoked token in a family and returns how many it revoked
+func (d *DynamoClient) RevokeRefreshTokenFamily(ctx context.Context, familyID string) (int, error) {
+	var tokens []RefreshToken
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String("vibe-drop-refresh-tokens"),
+			IndexName:              aws.String("family-index"),
+			KeyConditionExpression: aws.String("familyID = :familyID"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":familyID": &types.AttributeValueMemberS{Value: familyID},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return 0, classify(fmt.Errorf("failed to query refresh token family: %w", err))
+		}
+
+		var page []RefreshToken
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return 0, fmt.Errorf("failed to unmarshal refresh tokens: %w", err)
+		}
+		tokens = append(tokens, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+
+	revoked := 0
+	for _, token := range tokens {
+		if token.RevokedAt != nil {
+			continue
+		}
+		if err := d.RevokeRefreshToken(ctx, token.TokenHash); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
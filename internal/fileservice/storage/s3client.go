@@ -2,8 +2,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,23 +16,74 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
 )
 
+// PresignedURLExpiry is how long presigned upload, part and download URLs stay valid
+const PresignedURLExpiry = 15 * time.Minute
+
+// MaxPresignedURLExpiry is the longest S3 accepts for a presigned URL
+const MaxPresignedURLExpiry = 7 * 24 * time.Hour
+
+// UploadOptions are what a new upload's presigned URLs are signed with
+type UploadOptions struct {
+	Checksum  Checksum
+	URLExpiry time.Duration // How long upload and part URLs stay valid; 0 means PresignedURLExpiry
+}
+
+// DownloadOptions are what a download URL is signed with
+type DownloadOptions struct {
+	URLExpiry time.Duration // How long the URL stays valid; 0 means PresignedURLExpiry
+	// Headers the object is served with in place of its stored ones, if set
+	ContentDisposition string
+	ContentType        string
+}
+
+// urlExpiry is expiry, or PresignedURLExpiry if it isn't set
+func urlExpiry(expiry time.Duration) time.Duration {
+	if expiry <= 0 {
+		return PresignedURLExpiry
+	}
+	return expiry
+}
+
 type S3Client struct {
-	client *s3.Client
-	bucket string
+	client   *s3.Client
+	bucket   string   // Default bucket; holds objects whose metadata predates sharding
+	shards   []string // Buckets new objects are spread across
+	timeouts Timeouts
 }
 
-func NewS3Client(bucket, region, endpoint string) (*S3Client, error) {
+// NewS3Client creates a client for bucket whose calls are bounded by timeouts, signing
+// with role's credentials if it names a role. If shardBuckets are given, new objects are
+// spread across them by a hash of the file ID instead of all going to bucket.
+func NewS3Client(bucket, region, endpoint string, timeouts Timeouts, role AssumeRole, shardBuckets ...string) (*S3Client, error) {
 	// For LocalStack, we need to provide fake credentials
 	// In production, these would come from AWS IAM roles or environment variables
-	creds := credentials.NewStaticCredentialsProvider(
+	static := credentials.NewStaticCredentialsProvider(
 		"test",      // Access Key ID (fake for LocalStack)
 		"test",      // Secret Access Key (fake for LocalStack) 
 		"",          // Session Token (not needed)
 	)
+	creds, err := role.credentials(region, static)
+	if err != nil {
+		return nil, err
+	}
+	return newS3Client(creds, bucket, region, endpoint, timeouts, shardBuckets)
+}
 
+// NewMinIOClient creates a client for bucket on the MinIO server at endpoint, signing with
+// the server's access key. Timeouts and shard buckets work as with NewS3Client.
+func NewMinIOClient(endpoint, accessKey, secretKey, bucket, region string, timeouts Timeouts, shardBuckets ...string) (*S3Client, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("a MinIO endpoint is required")
+	}
+	creds := credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")
+	return newS3Client(creds, bucket, region, endpoint, timeouts, shardBuckets)
+}
+
+func newS3Client(creds aws.CredentialsProvider, bucket, region, endpoint string, timeouts Timeouts, shardBuckets []string) (*S3Client, error) {
 	// Load AWS configuration
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithCredentialsProvider(creds),
@@ -36,111 +92,373 @@ func NewS3Client(bucket, region, endpoint string) (*S3Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	traceAWS(&cfg)
+	boundAWS(&cfg, timeouts)
 
-	// Create S3 client with custom endpoint for LocalStack
+	// Create S3 client with custom endpoint for LocalStack or MinIO
 	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
 		if endpoint != "" {
 			o.BaseEndpoint = aws.String(endpoint)
-			// Force path-style addressing (required for LocalStack)
+			// Force path-style addressing (required for LocalStack and MinIO)
 			o.UsePathStyle = true
 		}
 	})
 
+	if len(shardBuckets) == 0 {
+		shardBuckets = []string{bucket}
+	}
 	client := &S3Client{
-		client: s3Client,
-		bucket: bucket,
+		client:   s3Client,
+		bucket:   bucket,
+		shards:   shardBuckets,
+		timeouts: timeouts,
 	}
 
-	log.Printf("S3 Client created for bucket: %s, endpoint: %s", bucket, endpoint)
+	log.Printf("S3 Client created for bucket: %s (shards: %s), endpoint: %s", bucket, strings.Join(shardBuckets, ","), endpoint)
 	return client, nil
 }
 
+// BucketFor returns the shard bucket a new file's objects are stored in
+func (s *S3Client) BucketFor(fileID string) string {
+	return shardFor(s.shards, fileID)
+}
+
+// ResolveBucket returns the bucket holding a file's objects given the bucket recorded
+// in its metadata. Records from before sharding have none and live in the default bucket.
+func (s *S3Client) ResolveBucket(recorded string) string {
+	if recorded == "" {
+		return s.bucket
+	}
+	return recorded
+}
+
+// Buckets returns the default bucket followed by every shard bucket not already listed
+func (s *S3Client) Buckets() []string {
+	return allBuckets(s.bucket, s.shards)
+}
+
 // Test connection by listing buckets
 func (s *S3Client) TestConnection(ctx context.Context) error {
 	_, err := s.client.ListBuckets(ctx, &s3.ListBucketsInput{})
 	if err != nil {
-		return fmt.Errorf("failed to connect to S3: %w", err)
+		return classify(fmt.Errorf("failed to connect to S3: %w", err))
 	}
-	log.Println("S3 connection test successful")
 	return nil
 }
 
-// GenerateUploadURL creates a presigned URL for uploading a file
-func (s *S3Client) GenerateUploadURL(ctx context.Context, filename string) (string, string, error) {
+// GenerateUploadURL creates a presigned URL for uploading a file under the user's prefix.
+// With a checksum the URL is signed with its header, so S3 rejects a PUT whose body
+// doesn't match.
+func (s *S3Client) GenerateUploadURL(ctx context.Context, userID, filename string, opts UploadOptions) (string, string, error) {
 	// Generate unique file ID
 	fileID := uuid.New().String()
-	key := fmt.Sprintf("%s-%s", fileID, filename)
+	key := ObjectKey(userID, fileID, filename)
+	if err := ValidateObjectKey(userID, key); err != nil {
+		return "", "", err
+	}
 
 	presignClient := s3.NewPresignClient(s.client)
 	
-	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.BucketFor(fileID)),
 		Key:    aws.String(key),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 15 * time.Minute
+	}
+	switch opts.Checksum.Algorithm {
+	case ChecksumSHA256:
+		input.ChecksumSHA256 = aws.String(opts.Checksum.Value)
+	case ChecksumCRC32C:
+		input.ChecksumCRC32C = aws.String(opts.Checksum.Value)
+	}
+	request, err := presignClient.PresignPutObject(ctx, input, func(presign *s3.PresignOptions) {
+		presign.Expires = urlExpiry(opts.URLExpiry)
 	})
 	
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate upload URL: %w", err)
+		return "", "", classify(fmt.Errorf("failed to generate upload URL: %w", err))
 	}
 	
 	return request.URL, fileID, nil
 }
 
-// GenerateDownloadURL creates a presigned URL for downloading a file
-func (s *S3Client) GenerateDownloadURL(ctx context.Context, s3Key string) (string, error) {
+// GenerateDownloadURL creates a presigned URL for downloading a file from the bucket recorded in its metadata.
+// S3 serves the response with the options' headers, which are part of the signature.
+func (s *S3Client) GenerateDownloadURL(ctx context.Context, bucket, s3Key string, opts DownloadOptions) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 	
-	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.ResolveBucket(bucket)),
 		Key:    aws.String(s3Key),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 15 * time.Minute
+	}
+	if opts.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if opts.ContentType != "" {
+		input.ResponseContentType = aws.String(opts.ContentType)
+	}
+	request, err := presignClient.PresignGetObject(ctx, input, func(presign *s3.PresignOptions) {
+		presign.Expires = urlExpiry(opts.URLExpiry)
 	})
 	
 	if err != nil {
-		return "", fmt.Errorf("failed to generate download URL: %w", err)
+		return "", classify(fmt.Errorf("failed to generate download URL: %w", err))
 	}
 	
 	return request.URL, nil
 }
 
-// DeleteObject deletes a file from S3
-func (s *S3Client) DeleteObject(ctx context.Context, s3Key string) error {
+// DeleteObject deletes a file from the bucket recorded in its metadata
+func (s *S3Client) DeleteObject(ctx context.Context, bucket, s3Key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucket),
+		Bucket: aws.String(s.ResolveBucket(bucket)),
 		Key:    aws.String(s3Key),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to delete S3 object: %w", err)
+		return classify(fmt.Errorf("failed to delete S3 object: %w", err))
 	}
 	
 	log.Printf("Deleted S3 object: %s", s3Key)
 	return nil
 }
 
+// maxDeleteObjects is the most keys S3 deletes in one DeleteObjects call
+const maxDeleteObjects = 1000
+
+// DeleteObjects deletes many objects from one bucket recorded in their metadata, up to 1000
+// in each DeleteObjects call. It returns the keys it couldn't delete, with why; keys that
+// don't exist count as deleted, as with DeleteObject.
+func (s *S3Client) DeleteObjects(ctx context.Context, bucket string, s3Keys []string) map[string]error {
+	bucket = s.ResolveBucket(bucket)
+	failed := make(map[string]error)
+	for start := 0; start < len(s3Keys); start += maxDeleteObjects {
+		batch := s3Keys[start:min(start+maxDeleteObjects, len(s3Keys))]
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for i, key := range batch {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		result, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			err = classify(fmt.Errorf("failed to delete S3 objects: %w", err))
+			for _, key := range batch {
+				failed[key] = err
+			}
+			continue
+		}
+		for _, deleteErr := range result.Errors {
+			failed[aws.ToString(deleteErr.Key)] = fmt.Errorf("failed to delete S3 object: %s: %s",
+				aws.ToString(deleteErr.Code), aws.ToString(deleteErr.Message))
+		}
+	}
+
+	log.Printf("Deleted %d S3 objects from %s", len(s3Keys)-len(failed), bucket)
+	return failed
+}
+
+// ErrObjectNotFound is returned when a read finds no object under the key
+var ErrObjectNotFound = fmt.Errorf("object %w", ErrNotFound)
+
+// ReadObjectHeader returns up to the first n bytes of an object, or ErrObjectNotFound if
+// nothing is stored under the key yet. An empty object yields no bytes. The request and
+// the read together take at most the operation timeout.
+func (s *S3Client) ReadObjectHeader(ctx context.Context, bucket, s3Key string, n int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts.operation())
+	defer cancel()
+
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.ResolveBucket(bucket)),
+		Key:    aws.String(s3Key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		// S3 rejects any range on an empty object
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+			return nil, nil
+		}
+		return nil, classify(fmt.Errorf("failed to read S3 object: %w", err))
+	}
+	defer result.Body.Close()
+
+	header, err := io.ReadAll(io.LimitReader(result.Body, n))
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to read S3 object: %w", err))
+	}
+	return header, nil
+}
+
+// OpenObject streams an object's content, or returns ErrObjectNotFound if nothing is stored
+// under the key. The caller closes the reader. No timeout applies beyond ctx's, so bound
+// ctx by how long reading the whole object may take.
+func (s *S3Client) OpenObject(ctx context.Context, bucket, s3Key string) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.ResolveBucket(bucket)),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, classify(fmt.Errorf("failed to read S3 object: %w", err))
+	}
+	return result.Body, nil
+}
+
+// OpenObjectRange streams length bytes of an object's content from offset, as OpenObject
+// streams all of it
+func (s *S3Client) OpenObjectRange(ctx context.Context, bucket, s3Key string, offset, length int64) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.ResolveBucket(bucket)),
+		Key:    aws.String(s3Key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, classify(fmt.Errorf("failed to read S3 object: %w", err))
+	}
+	return result.Body, nil
+}
+
+// PutObject stores content under the key, replacing any object already there. S3 takes
+// up to 5GB in one PUT; larger files need a multipart upload.
+func (s *S3Client) PutObject(ctx context.Context, bucket, s3Key string, content io.ReadSeeker, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.ResolveBucket(bucket)),
+		Key:           aws.String(s3Key),
+		Body:          content,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to store S3 object: %w", err))
+	}
+	log.Printf("Stored S3 object: %s", s3Key)
+	return nil
+}
+
+// maxCopyObjectSize is the largest object a single CopyObject call can copy
+const maxCopyObjectSize = int64(5 * 1024 * 1024 * 1024)
+
+// CopyObject copies srcKey to dstKey within the file's bucket. Objects over 5GB are
+// copied part by part with a multipart upload, as S3 requires.
+func (s *S3Client) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error {
+	bucket = s.ResolveBucket(bucket)
+	source := (&url.URL{Path: bucket + "/" + srcKey}).EscapedPath() // CopySource must be URL-encoded
+	if size <= maxCopyObjectSize {
+		_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(dstKey),
+			CopySource: aws.String(source),
+		})
+		if err != nil {
+			return classify(fmt.Errorf("failed to copy S3 object: %w", err))
+		}
+		log.Printf("Copied S3 object %s to %s", srcKey, dstKey)
+		return nil
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to start multipart copy: %w", err))
+	}
+	abort := func() {
+		if _, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(dstKey),
+			UploadId: created.UploadId,
+		}); err != nil {
+			log.Printf("Warning: Failed to abort multipart copy to %s: %v", dstKey, err)
+		}
+	}
+
+	var parts []types.CompletedPart
+	for start, partNumber := int64(0), int32(1); start < size; start, partNumber = start+maxCopyObjectSize, partNumber+1 {
+		end := start + maxCopyObjectSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		result, err := s.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(dstKey),
+			UploadId:        created.UploadId,
+			PartNumber:      aws.Int32(partNumber),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		})
+		if err != nil {
+			abort()
+			return classify(fmt.Errorf("failed to copy part %d: %w", partNumber, err))
+		}
+		parts = append(parts, types.CompletedPart{PartNumber: aws.Int32(partNumber), ETag: result.CopyPartResult.ETag})
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(dstKey),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abort()
+		return classify(fmt.Errorf("failed to complete multipart copy: %w", err))
+	}
+	log.Printf("Copied S3 object %s to %s in %d parts", srcKey, dstKey, len(parts))
+	return nil
+}
+
 // MultipartUploadInfo contains details for a multipart upload
 type MultipartUploadInfo struct {
-	UploadID string
-	Key      string
+	FileID    string
+	UploadID  string
+	Bucket    string        // Empty means the default bucket
+	Key       string
+	Checksum  Checksum      // The whole object's declared checksum, checked by S3 on completion
+	URLExpiry time.Duration // How long part URLs stay valid; 0 means PresignedURLExpiry
 }
 
-// InitiateMultipartUpload starts a multipart upload process
-func (s *S3Client) InitiateMultipartUpload(ctx context.Context, filename string) (*MultipartUploadInfo, error) {
+// InitiateMultipartUpload starts a multipart upload process under the user's prefix. Only a
+// CRC32C checksum can cover a whole multipart object; S3 checks it when the upload completes.
+func (s *S3Client) InitiateMultipartUpload(ctx context.Context, userID, filename string, opts UploadOptions) (*MultipartUploadInfo, error) {
 	fileID := uuid.New().String()
-	key := fmt.Sprintf("%s-%s", fileID, filename)
+	key := ObjectKey(userID, fileID, filename)
+	if err := ValidateObjectKey(userID, key); err != nil {
+		return nil, err
+	}
 
-	result, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket: aws.String(s.bucket),
+	bucket := s.BucketFor(fileID)
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
-	})
+	}
+	if opts.Checksum.Algorithm == ChecksumCRC32C {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32c
+		input.ChecksumType = types.ChecksumTypeFullObject
+	} else if !opts.Checksum.IsZero() {
+		return nil, fmt.Errorf("multipart uploads support only %s checksums, not %s", ChecksumCRC32C, opts.Checksum.Algorithm)
+	}
+	result, err := s.client.CreateMultipartUpload(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initiate multipart upload: %w", err)
+		return nil, classify(fmt.Errorf("failed to initiate multipart upload: %w", err))
 	}
 
 	info := &MultipartUploadInfo{
-		UploadID: *result.UploadId,
-		Key:      key,
+		FileID:    fileID,
+		UploadID:  *result.UploadId,
+		Bucket:    bucket,
+		Key:       key,
+		Checksum:  opts.Checksum,
+		URLExpiry: opts.URLExpiry,
 	}
 
 	log.Printf("Initiated multipart upload: %s (uploadID: %s)", key, info.UploadID)
@@ -152,21 +470,40 @@ func (s *S3Client) GenerateMultipartUploadURL(ctx context.Context, uploadInfo *M
 	presignClient := s3.NewPresignClient(s.client)
 
 	request, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
-		Bucket:     aws.String(s.bucket),
+		Bucket:     aws.String(s.ResolveBucket(uploadInfo.Bucket)),
 		Key:        aws.String(uploadInfo.Key),
 		PartNumber: aws.Int32(int32(partNumber)),
 		UploadId:   aws.String(uploadInfo.UploadID),
 	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 15 * time.Minute
+		opts.Expires = urlExpiry(uploadInfo.URLExpiry)
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("failed to generate multipart upload URL for part %d: %w", partNumber, err)
+		return "", classify(fmt.Errorf("failed to generate multipart upload URL for part %d: %w", partNumber, err))
 	}
 
 	return request.URL, nil
 }
 
+// UploadPartCopy fills a part of a multipart upload with length bytes of an existing
+// object from offset, without the content passing through the service. The source may be
+// in another shard. It returns the part's ETag.
+func (s *S3Client) UploadPartCopy(ctx context.Context, uploadInfo *MultipartUploadInfo, partNumber int, srcBucket, srcKey string, offset, length int64) (string, error) {
+	source := (&url.URL{Path: s.ResolveBucket(srcBucket) + "/" + srcKey}).EscapedPath() // CopySource must be URL-encoded
+	result, err := s.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+		Bucket:          aws.String(s.ResolveBucket(uploadInfo.Bucket)),
+		Key:             aws.String(uploadInfo.Key),
+		UploadId:        aws.String(uploadInfo.UploadID),
+		PartNumber:      aws.Int32(int32(partNumber)),
+		CopySource:      aws.String(source),
+		CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return "", classify(fmt.Errorf("failed to copy part %d: %w", partNumber, err))
+	}
+	return aws.ToString(result.CopyPartResult.ETag), nil
+}
+
 // CompletedPart represents a completed multipart upload part
 type CompletedPart struct {
 	PartNumber int
@@ -184,18 +521,133 @@ func (s *S3Client) CompleteMultipartUpload(ctx context.Context, uploadInfo *Mult
 		}
 	}
 
-	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(s.bucket),
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.ResolveBucket(uploadInfo.Bucket)),
 		Key:      aws.String(uploadInfo.Key),
 		UploadId: aws.String(uploadInfo.UploadID),
 		MultipartUpload: &types.CompletedMultipartUpload{
 			Parts: completedParts,
 		},
-	})
+	}
+	if uploadInfo.Checksum.Algorithm == ChecksumCRC32C {
+		input.ChecksumCRC32C = aws.String(uploadInfo.Checksum.Value)
+		input.ChecksumType = types.ChecksumTypeFullObject
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, input)
+	if isChecksumMismatch(err) {
+		return fmt.Errorf("failed to complete multipart upload: %w: %v", ErrChecksumMismatch, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to complete multipart upload: %w", err)
+		return classify(fmt.Errorf("failed to complete multipart upload: %w", err))
 	}
 
 	log.Printf("Completed multipart upload: %s (uploadID: %s)", uploadInfo.Key, uploadInfo.UploadID)
 	return nil
-}
\ No newline at end of file
+}
+// AbortMultipartUpload discards a multipart upload and the parts S3 holds for it.
+// An upload S3 no longer knows about counts as already aborted.
+func (s *S3Client) AbortMultipartUpload(ctx context.Context, uploadInfo *MultipartUploadInfo) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.ResolveBucket(uploadInfo.Bucket)),
+		Key:      aws.String(uploadInfo.Key),
+		UploadId: aws.String(uploadInfo.UploadID),
+	})
+	if err != nil {
+		var missing *types.NoSuchUpload
+		if errors.As(err, &missing) {
+			return nil
+		}
+		return classify(fmt.Errorf("failed to abort multipart upload: %w", err))
+	}
+
+	log.Printf("Aborted multipart upload: %s (uploadID: %s)", uploadInfo.Key, uploadInfo.UploadID)
+	return nil
+}
+
+// UploadedPart is a part S3 holds for an in-progress multipart upload
+type UploadedPart struct {
+	PartNumber int
+	ETag       string
+	Size       int64
+}
+
+// ListParts returns every part S3 has received for a multipart upload, in part-number order
+func (s *S3Client) ListParts(ctx context.Context, uploadInfo *MultipartUploadInfo) ([]UploadedPart, error) {
+	var parts []UploadedPart
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.ResolveBucket(uploadInfo.Bucket)),
+		Key:      aws.String(uploadInfo.Key),
+		UploadId: aws.String(uploadInfo.UploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to list multipart upload parts: %w", err))
+		}
+		for _, part := range page.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber: int(aws.ToInt32(part.PartNumber)),
+				ETag:       aws.ToString(part.ETag),
+				Size:       aws.ToInt64(part.Size),
+			})
+		}
+	}
+	return parts, nil
+}
+
+// GetPart returns the part S3 holds under partNumber, or nil if it has none
+func (s *S3Client) GetPart(ctx context.Context, uploadInfo *MultipartUploadInfo, partNumber int) (*UploadedPart, error) {
+	// Parts are listed in order, so starting after partNumber-1 yields the part if it exists
+	result, err := s.client.ListParts(ctx, &s3.ListPartsInput{
+		Bucket:           aws.String(s.ResolveBucket(uploadInfo.Bucket)),
+		Key:              aws.String(uploadInfo.Key),
+		UploadId:         aws.String(uploadInfo.UploadID),
+		PartNumberMarker: aws.String(strconv.Itoa(partNumber - 1)),
+		MaxParts:         aws.Int32(1),
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to look up part %d: %w", partNumber, err))
+	}
+	if len(result.Parts) == 0 || int(aws.ToInt32(result.Parts[0].PartNumber)) != partNumber {
+		return nil, nil
+	}
+	part := result.Parts[0]
+	return &UploadedPart{
+		PartNumber: partNumber,
+		ETag:       aws.ToString(part.ETag),
+		Size:       aws.ToInt64(part.Size),
+	}, nil
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListAllObjects lists every object in the default and shard buckets, following pagination
+func (s *S3Client) ListAllObjects(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for _, bucket := range s.Buckets() {
+		paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, classify(fmt.Errorf("failed to list S3 objects in %s: %w", bucket, err))
+			}
+			for _, object := range page.Contents {
+				objects = append(objects, ObjectInfo{
+					Bucket:       bucket,
+					Key:          aws.ToString(object.Key),
+					Size:         aws.ToInt64(object.Size),
+					LastModified: aws.ToTime(object.LastModified),
+				})
+			}
+		}
+	}
+	return objects, nil
+}
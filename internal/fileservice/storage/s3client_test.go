@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBucketFor(t *testing.T) {
+	unsharded := &S3Client{bucket: "files", shards: []string{"files"}}
+	if got := unsharded.BucketFor("file-1"); got != "files" {
+		t.Errorf("unsharded BucketFor = %q, want files", got)
+	}
+
+	sharded := &S3Client{bucket: "files", shards: []string{"files-0", "files-1", "files-2"}}
+	used := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		fileID := fmt.Sprintf("file-%d", i)
+		bucket := sharded.BucketFor(fileID)
+		if again := sharded.BucketFor(fileID); again != bucket {
+			t.Fatalf("BucketFor(%s) = %q then %q, want a stable choice", fileID, bucket, again)
+		}
+		used[bucket]++
+	}
+	if len(used) != 3 {
+		t.Errorf("files spread over %v, want all three shards", used)
+	}
+
+	if got := sharded.ResolveBucket(""); got != "files" {
+		t.Errorf("ResolveBucket(\"\") = %q, want the default bucket", got)
+	}
+	if got := sharded.Buckets(); len(got) != 4 || got[0] != "files" {
+		t.Errorf("Buckets() = %v, want the default bucket then the shards", got)
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+)
+
+// S3EventNotification is the body of an S3 bucket event notification, as S3 delivers it to
+// SQS, SNS or Lambda and as a forwarder posts it on
+type S3EventNotification struct {
+	Records []S3EventRecord `json:"Records"`
+}
+
+// S3EventRecord is one object event in a notification
+type S3EventRecord struct {
+	EventName string `json:"eventName"` // e.g. "ObjectCreated:Put"
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key       string `json:"key"` // URL encoded
+			Size      int64  `json:"size"`
+			ETag      string `json:"eTag"`
+			Sequencer string `json:"sequencer"` // Orders events for the same key
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// IsObjectCreated reports whether the event is an object being written
+func (r S3EventRecord) IsObjectCreated() bool {
+	return strings.HasPrefix(r.EventName, "ObjectCreated:")
+}
+
+// ObjectKey is the event's object key, decoded
+func (r S3EventRecord) ObjectKey() (string, error) {
+	return url.QueryUnescape(r.S3.Object.Key)
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Default storage call timeouts, used when the configuration leaves them unset
+const (
+	DefaultOperationTimeout = 10 * time.Second
+	DefaultTransferTimeout  = 10 * time.Minute
+)
+
+// Timeouts bound how long one storage call may take, retries included, so a slow DynamoDB
+// partition or S3 bucket fails the request instead of holding its goroutine. The caller's
+// context still applies: a cancelled request stops its calls at once.
+type Timeouts struct {
+	Operation time.Duration // Most calls; 0 means DefaultOperationTimeout
+	// Calls whose duration grows with the object's size: copies and completing multipart
+	// uploads. 0 means DefaultTransferTimeout.
+	Transfer time.Duration
+}
+
+// transferOperations are the S3 calls bounded by the transfer timeout
+var transferOperations = map[string]bool{
+	"CopyObject":              true,
+	"PutObject":               true,
+	"UploadPartCopy":          true,
+	"CompleteMultipartUpload": true,
+}
+
+// streamingOperations return a body the caller reads after the call returns, so the call
+// can't be bounded on its own; callers bound the whole read instead
+var streamingOperations = map[string]bool{
+	"GetObject": true,
+}
+
+// timeoutFor is how long the named operation may take, or 0 for no bound of its own
+func (t Timeouts) timeoutFor(operation string) time.Duration {
+	switch {
+	case streamingOperations[operation]:
+		return 0
+	case transferOperations[operation]:
+		return t.transfer()
+	default:
+		return t.operation()
+	}
+}
+
+func (t Timeouts) operation() time.Duration {
+	if t.Operation <= 0 {
+		return DefaultOperationTimeout
+	}
+	return t.Operation
+}
+
+func (t Timeouts) transfer() time.Duration {
+	if t.Transfer <= 0 {
+		return DefaultTransferTimeout
+	}
+	return t.Transfer
+}
+
+// boundAWS gives every AWS SDK call made with cfg the timeout its operation has. The
+// deadline is set before the SDK's retries, so it covers all of a call's attempts.
+func boundAWS(cfg *aws.Config, timeouts Timeouts) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		timeout := timeouts.timeoutFor(stack.ID())
+		if timeout <= 0 {
+			return nil
+		}
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("OperationTimeout",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	})
+}
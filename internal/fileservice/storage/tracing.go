@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceAWS gives every AWS SDK call made with cfg a client span under the caller's. No trace
+// context is sent: AWS ignores it, and it mustn't end up in presigned URLs' headers. Spans
+// carry the request ID AWS answered with and, for S3, its extended request ID, which AWS
+// support asks for alongside it.
+func traceAWS(cfg *aws.Config) {
+	otelaws.AppendMiddlewares(&cfg.APIOptions, otelaws.WithTextMapPropagator(propagation.NewCompositeTextMapPropagator()))
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("S3HostIDSpanAttribute", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleDeserialize(ctx, in)
+			if hostID, ok := s3.GetHostIDMetadata(metadata); ok && hostID != "" {
+				trace.SpanFromContext(ctx).SetAttributes(attribute.String("aws.s3.extended_request_id", hostID))
+			}
+			return out, metadata, err
+		}), middleware.Before)
+	})
+}
+
+// queryTracer gives each PostgreSQL query, and each batch of queries, a client span under
+// the caller's. Spans are named after the SQL command, e.g. postgres INSERT.
+type queryTracer struct {
+	tracer trace.Tracer
+}
+
+func newQueryTracer() *queryTracer {
+	return &queryTracer{tracer: otel.Tracer("vibe-drop/internal/fileservice/storage")}
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	name := "postgres"
+	if fields := strings.Fields(data.SQL); len(fields) > 0 {
+		name += " " + strings.ToUpper(fields[0])
+	}
+	ctx, _ = t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "postgresql"), attribute.String("db.query.text", data.SQL)))
+	return ctx
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+}
+
+func (t *queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "postgres batch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "postgresql"), attribute.Int("db.operation.batch.size", data.Batch.Len())))
+	return ctx
+}
+
+func (t *queryTracer) TraceBatchQuery(context.Context, *pgx.Conn, pgx.TraceBatchQueryData) {}
+
+func (t *queryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.Err)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
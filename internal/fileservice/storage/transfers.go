@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Ownership transfer status values
+const (
+	TransferStatusPending   = "pending"
+	TransferStatusRunning   = "running"
+	TransferStatusCompleted = "completed"
+)
+
+// ErrOwnershipChanged is returned when a file is no longer owned by the transfer's source
+// user, e.g. because it was deleted or transferred meanwhile
+var ErrOwnershipChanged = errors.New("file ownership changed")
+
+// OwnershipTransfer is an admin request to move files from one user to another, run by a
+// background job. It records progress so an interrupted run can resume.
+type OwnershipTransfer struct {
+	TransferID  string            `json:"transfer_id" dynamodbav:"transferID"`
+	FromUserID  string            `json:"from_user_id" dynamodbav:"fromUserID"`
+	ToUserID    string            `json:"to_user_id" dynamodbav:"toUserID"`
+	FileIDs     []string          `json:"file_ids,omitempty" dynamodbav:"fileIDs,omitempty"` // Empty transfers every file the source user owns
+	Status      string            `json:"status" dynamodbav:"status"`
+	Transferred int               `json:"transferred" dynamodbav:"transferred"`
+	Bytes       int64             `json:"bytes" dynamodbav:"bytes"`     // Total size of the transferred files
+	Skipped     int               `json:"skipped" dynamodbav:"skipped"` // Not owned by the source user or still uploading
+	Failures    []TransferFailure `json:"failures,omitempty" dynamodbav:"failures,omitempty"`
+	CreatedAt   string            `json:"created_at" dynamodbav:"createdAt"`
+	UpdatedAt   string            `json:"updated_at" dynamodbav:"updatedAt"` // Heartbeat while running
+	CompletedAt *string           `json:"completed_at,omitempty" dynamodbav:"completedAt,omitempty"`
+}
+
+// TransferFailure is a file a transfer could not move
+type TransferFailure struct {
+	FileID string `json:"file_id" dynamodbav:"fileID"`
+	Error  string `json:"error" dynamodbav:"error"`
+}
+
+// CreateOwnershipTransfer stores a new transfer request
+func (d *DynamoClient) CreateOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer) error {
+	item, err := attributevalue.MarshalMap(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ownership transfer: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("vibe-drop-transfers"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(transferID)"),
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to create ownership transfer: %w", err))
+	}
+	return nil
+}
+
+// SaveOwnershipTransfer stores a transfer's progress
+func (d *DynamoClient) SaveOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer) error {
+	item, err := attributevalue.MarshalMap(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ownership transfer: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-transfers"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save ownership transfer: %w", err))
+	}
+	return nil
+}
+
+// GetOwnershipTransfer retrieves a transfer by ID
+func (d *DynamoClient) GetOwnershipTransfer(ctx context.Context, transferID string) (*OwnershipTransfer, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-transfers"),
+		Key: map[string]types.AttributeValue{
+			"transferID": &types.AttributeValueMemberS{Value: transferID},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get ownership transfer: %w", err))
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("ownership transfer %w: %s", ErrNotFound, transferID)
+	}
+
+	var transfer OwnershipTransfer
+	if err := attributevalue.UnmarshalMap(result.Item, &transfer); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ownership transfer: %w", err)
+	}
+	return &transfer, nil
+}
+
+// ListUnfinishedOwnershipTransfers returns the transfers that are pending or running
+func (d *DynamoClient) ListUnfinishedOwnershipTransfers(ctx context.Context) ([]OwnershipTransfer, error) {
+	var transfers []OwnershipTransfer
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := d.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:        aws.String("vibe-drop-transfers"),
+			FilterExpression: aws.String("#status <> :completed"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":completed": &types.AttributeValueMemberS{Value: TransferStatusCompleted},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to scan ownership transfers: %w", err))
+		}
+
+		var page []OwnershipTransfer
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ownership transfers: %w", err)
+		}
+		transfers = append(transfers, page...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+	return transfers, nil
+}
+
+// ClaimOwnershipTransfer marks a transfer running so only one replica works on it. A
+// pending transfer can always be claimed; a running one only once its heartbeat is older
+// than staleBefore, i.e. the replica running it stopped. It reports whether the claim won.
+func (d *DynamoClient) ClaimOwnershipTransfer(ctx context.Context, transfer *OwnershipTransfer, staleBefore time.Time) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("vibe-drop-transfers"),
+		Key: map[string]types.AttributeValue{
+			"transferID": &types.AttributeValueMemberS{Value: transfer.TransferID},
+		},
+		UpdateExpression:    aws.String("SET #status = :running, updatedAt = :now"),
+		ConditionExpression: aws.String("#status = :pending OR (#status = :running AND updatedAt < :stale)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":running": &types.AttributeValueMemberS{Value: TransferStatusRunning},
+			":pending": &types.AttributeValueMemberS{Value: TransferStatusPending},
+			":now":     &types.AttributeValueMemberS{Value: now},
+			":stale":   &types.AttributeValueMemberS{Value: staleBefore.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		var lost *types.ConditionalCheckFailedException
+		if errors.As(err, &lost) {
+			return false, nil
+		}
+		return false, classify(fmt.Errorf("failed to claim ownership transfer: %w", err))
+	}
+	transfer.Status = TransferStatusRunning
+	transfer.UpdatedAt = now
+	return true, nil
+}
+
+// TransferFileOwnership reassigns a file to toUserID under newKey and moves its size from
+// the old owner's storage usage to the new owner's, all in one transaction. It returns
+// ErrOwnershipChanged if the file's owner or key no longer match metadata.
+func (d *DynamoClient) TransferFileOwnership(ctx context.Context, metadata *FileMetadata, toUserID, newKey string) error {
+	now := &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)}
+	size := strconv.FormatInt(metadata.TotalSize, 10)
+
+	fileUpdate := types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: aws.String("vibe-drop-files"),
+			Key: map[string]types.AttributeValue{
+				"fileID": &types.AttributeValueMemberS{Value: metadata.FileID},
+			},
+			UpdateExpression:    aws.String("SET userID = :to, s3Key = :newKey"),
+			ConditionExpression: aws.String("userID = :from AND s3Key = :oldKey"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":to":     &types.AttributeValueMemberS{Value: toUserID},
+				":from":   &types.AttributeValueMemberS{Value: metadata.UserID},
+				":newKey": &types.AttributeValueMemberS{Value: newKey},
+				":oldKey": &types.AttributeValueMemberS{Value: metadata.S3Key},
+			},
+		},
+	}
+	release := types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: aws.String("vibe-drop-usage"),
+			Key: map[string]types.AttributeValue{
+				"userID": &types.AttributeValueMemberS{Value: metadata.UserID},
+			},
+			UpdateExpression:    aws.String("ADD usedBytes :delta SET updatedAt = :now"),
+			ConditionExpression: aws.String("usedBytes >= :bytes"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(-metadata.TotalSize, 10)},
+				":bytes": &types.AttributeValueMemberN{Value: size},
+				":now":   now,
+			},
+		},
+	}
+	reserve := types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: aws.String("vibe-drop-usage"),
+			Key: map[string]types.AttributeValue{
+				"userID": &types.AttributeValueMemberS{Value: toUserID},
+			},
+			UpdateExpression: aws.String("ADD usedBytes :bytes SET updatedAt = :now"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":bytes": &types.AttributeValueMemberN{Value: size},
+				":now":   now,
+			},
+		},
+	}
+
+	err := d.transferTransaction(ctx, fileUpdate, release, reserve)
+	if reason := cancellationReason(err, 1); reason == "ConditionalCheckFailed" {
+		// The old owner's usage is below the file's size (files stored before usage was
+		// tracked), so stop it at zero as ReleaseStorage does
+		release.Update.UpdateExpression = aws.String("SET usedBytes = :zero, updatedAt = :now")
+		release.Update.ConditionExpression = nil
+		release.Update.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+			":now":  now,
+		}
+		err = d.transferTransaction(ctx, fileUpdate, release, reserve)
+	}
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		return ErrOwnershipChanged
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to transfer file ownership: %w", err))
+	}
+	return nil
+}
+
+func (d *DynamoClient) transferTransaction(ctx context.Context, items ...types.TransactWriteItem) error {
+	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	return err
+}
+
+// cancellationReason returns the code DynamoDB gave for the i'th item of a cancelled transaction
+func cancellationReason(err error, i int) string {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) || i >= len(canceled.CancellationReasons) {
+		return ""
+	}
+	return aws.ToString(canceled.CancellationReasons[i].Code)
+}
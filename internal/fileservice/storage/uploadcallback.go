@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// UploadCallback is where an API key's integration is told its uploads completed
+type UploadCallback struct {
+	APIKeyID string `json:"api_key_id" dynamodbav:"apiKeyID"`
+	UserID   string `json:"user_id" dynamodbav:"userID"` // The key's user when it was registered
+	URL      string `json:"url" dynamodbav:"url"`
+	// Derives the signing secret with the deployment's UPLOAD_CALLBACK_SECRET, so the
+	// secret itself isn't stored; a new one is drawn each time the URL is set
+	Nonce     string `json:"nonce" dynamodbav:"nonce"`
+	UpdatedAt string `json:"updated_at" dynamodbav:"updatedAt"`
+}
+
+// GetUploadCallback returns an API key's callback, or ErrNotFound if it has none
+func (d *DynamoClient) GetUploadCallback(ctx context.Context, apiKeyID string) (*UploadCallback, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-upload-callbacks"),
+		Key: map[string]types.AttributeValue{
+			"apiKeyID": &types.AttributeValueMemberS{Value: apiKeyID},
+		},
+	})
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get upload callback: %w", err))
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("upload callback %w: %s", ErrNotFound, apiKeyID)
+	}
+
+	var callback UploadCallback
+	if err := attributevalue.UnmarshalMap(result.Item, &callback); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload callback: %w", err)
+	}
+	return &callback, nil
+}
+
+// SaveUploadCallback replaces an API key's callback
+func (d *DynamoClient) SaveUploadCallback(ctx context.Context, callback *UploadCallback) error {
+	item, err := attributevalue.MarshalMap(callback)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload callback: %w", err)
+	}
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-upload-callbacks"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to save upload callback: %w", err))
+	}
+	return nil
+}
+
+// DeleteUploadCallback removes an API key's callback; removing none is not an error
+func (d *DynamoClient) DeleteUploadCallback(ctx context.Context, apiKeyID string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-upload-callbacks"),
+		Key: map[string]types.AttributeValue{
+			"apiKeyID": &types.AttributeValueMemberS{Value: apiKeyID},
+		},
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to delete upload callback: %w", err))
+	}
+	return nil
+}
+
+// GetUploadCallback returns an API key's callback, or ErrNotFound if it has none
+func (p *PostgresClient) GetUploadCallback(ctx context.Context, apiKeyID string) (*UploadCallback, error) {
+	var record []byte
+	err := p.pool.QueryRow(ctx, `SELECT record FROM upload_callbacks WHERE api_key_id = $1`, apiKeyID).Scan(&record)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("upload callback %w: %s", ErrNotFound, apiKeyID)
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to get upload callback: %w", err))
+	}
+
+	var callback UploadCallback
+	if err := json.Unmarshal(record, &callback); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload callback: %w", err)
+	}
+	return &callback, nil
+}
+
+// SaveUploadCallback replaces an API key's callback
+func (p *PostgresClient) SaveUploadCallback(ctx context.Context, callback *UploadCallback) error {
+	record, err := json.Marshal(callback)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload callback: %w", err)
+	}
+	_, err = p.pool.Exec(ctx, `
+		INSERT INTO upload_callbacks (api_key_id, record) VALUES ($1, $2)
+		ON CONFLICT (api_key_id) DO UPDATE SET record = EXCLUDED.record`,
+		callback.APIKeyID, record)
+	if err != nil {
+		return classify(fmt.Errorf("failed to save upload callback: %w", err))
+	}
+	return nil
+}
+
+// DeleteUploadCallback removes an API key's callback; removing none is not an error
+func (p *PostgresClient) DeleteUploadCallback(ctx context.Context, apiKeyID string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM upload_callbacks WHERE api_key_id = $1`, apiKeyID); err != nil {
+		return classify(fmt.Errorf("failed to delete upload callback: %w", err))
+	}
+	return nil
+}
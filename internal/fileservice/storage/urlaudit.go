@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"vibe-drop/internal/common"
+)
+
+// Purposes recorded for issued presigned URLs
+const (
+	URLPurposeUpload     = "upload"      // single-part PUT
+	URLPurposeUploadPart = "upload_part" // one multipart part PUT
+	URLPurposeDownload   = "download"
+)
+
+// IssuedURL is the audit record of one presigned URL handed to a client
+type IssuedURL struct {
+	FileID string `json:"file_id" dynamodbav:"fileID"`
+	// Sort key: issue time plus a random suffix, so records list in issue order
+	URLID      string  `json:"url_id" dynamodbav:"urlID"`
+	UserID     string  `json:"user_id" dynamodbav:"userID"`
+	Purpose    string  `json:"purpose" dynamodbav:"purpose"`
+	S3Key      string  `json:"s3_key" dynamodbav:"s3Key"`
+	PartNumber int     `json:"part_number,omitempty" dynamodbav:"partNumber,omitempty"`
+	IssuedAt   string  `json:"issued_at" dynamodbav:"issuedAt"`
+	ExpiresAt  string  `json:"expires_at" dynamodbav:"expiresAt"`
+	RevokedAt  *string `json:"revoked_at,omitempty" dynamodbav:"revokedAt,omitempty"`
+
+	Client *common.ClientInfo `json:"client,omitempty" dynamodbav:"client,omitempty"` // Who the URL was issued to
+}
+
+// Active reports whether the URL could still be used at now
+func (u IssuedURL) Active(now time.Time) bool {
+	if u.RevokedAt != nil {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, u.ExpiresAt)
+	return err == nil && now.Before(expiresAt)
+}
+
+// NewIssuedURL builds the audit record for a URL issued now for s3Key, valid for expiry
+// (0 means PresignedURLExpiry)
+func NewIssuedURL(fileID, userID, s3Key, purpose string, partNumber int, expiry time.Duration) *IssuedURL {
+	now := time.Now().UTC()
+	return &IssuedURL{
+		FileID:     fileID,
+		URLID:      now.Format(time.RFC3339Nano) + "#" + uuid.New().String()[:8],
+		UserID:     userID,
+		Purpose:    purpose,
+		S3Key:      s3Key,
+		PartNumber: partNumber,
+		IssuedAt:   now.Format(time.RFC3339),
+		ExpiresAt:  now.Add(urlExpiry(expiry)).Format(time.RFC3339),
+	}
+}
+
+// RecordIssuedURL saves the audit record of an issued presigned URL
+func (d *DynamoClient) RecordIssuedURL(ctx context.Context, issued *IssuedURL) error {
+	item, err := attributevalue.MarshalMap(issued)
+	if err != nil {
+		return fmt.Errorf("failed to marshal issued URL: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("vibe-drop-url-audit"),
+		Item:      item,
+	})
+	if err != nil {
+		return classify(fmt.Errorf("failed to record issued URL: %w", err))
+	}
+	return nil
+}
+
+// ListIssuedURLs returns every presigned URL recorded for a file, oldest first
+func (d *DynamoClient) ListIssuedURLs(ctx context.Context, fileID string) ([]IssuedURL, error) {
+	var issued []IssuedURL
+	paginator := dynamodb.NewQueryPaginator(d.client, &dynamodb.QueryInput{
+		TableName:              aws.String("vibe-drop-url-audit"),
+		KeyConditionExpression: aws.String("fileID = :fileID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":fileID": &types.AttributeValueMemberS{Value: fileID},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to list issued URLs: %w", err))
+		}
+		for _, item := range page.Items {
+			var record IssuedURL
+			if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+				log.Printf("Failed to unmarshal issued URL item: %v", err)
+				continue
+			}
+			issued = append(issued, record)
+		}
+	}
+	return issued, nil
+}
+
+// MarkURLsRevoked stamps every still-active URL recorded for a file as revoked at
+// revokedAt and returns how many it marked
+func (d *DynamoClient) MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error) {
+	issued, err := d.ListIssuedURLs(ctx, fileID)
+	if err != nil {
+		return 0, err
+	}
+
+	stamp := revokedAt.UTC().Format(time.RFC3339)
+	revoked := 0
+	for _, record := range issued {
+		if !record.Active(revokedAt) {
+			continue
+		}
+		_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String("vibe-drop-url-audit"),
+			Key: map[string]types.AttributeValue{
+				"fileID": &types.AttributeValueMemberS{Value: fileID},
+				"urlID":  &types.AttributeValueMemberS{Value: record.URLID},
+			},
+			UpdateExpression: aws.String("SET revokedAt = :revokedAt"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":revokedAt": &types.AttributeValueMemberS{Value: stamp},
+			},
+		})
+		if err != nil {
+			return revoked, classify(fmt.Errorf("failed to mark URL %s revoked: %w", record.URLID, err))
+		}
+		revoked++
+	}
+	return revoked, nil
+}
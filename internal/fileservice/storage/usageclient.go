@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrQuotaExceeded is returned when a reservation would take a user over their storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// ReserveStorage atomically adds bytes to the user's usage unless the total would exceed limit
+func (d *DynamoClient) ReserveStorage(ctx context.Context, userID string, bytes, limit int64) error {
+	if bytes > limit {
+		return ErrQuotaExceeded
+	}
+
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("vibe-drop-usage"),
+		Key: map[string]types.AttributeValue{
+			"userID": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression:    aws.String("ADD usedBytes :bytes SET updatedAt = :now"),
+		ConditionExpression: aws.String("attribute_not_exists(usedBytes) OR usedBytes <= :max"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":bytes": &types.AttributeValueMemberN{Value: strconv.FormatInt(bytes, 10)},
+			":max":   &types.AttributeValueMemberN{Value: strconv.FormatInt(limit-bytes, 10)},
+			":now":   &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		var exceeded *types.ConditionalCheckFailedException
+		if errors.As(err, &exceeded) {
+			return ErrQuotaExceeded
+		}
+		return classify(fmt.Errorf("failed to reserve storage: %w", err))
+	}
+	return nil
+}
+
+// ReleaseStorage subtracts bytes from the user's usage, stopping at zero for files
+// stored before usage was tracked
+func (d *DynamoClient) ReleaseStorage(ctx context.Context, userID string, bytes int64) error {
+	key := map[string]types.AttributeValue{
+		"userID": &types.AttributeValueMemberS{Value: userID},
+	}
+	now := &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)}
+
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String("vibe-drop-usage"),
+		Key:                 key,
+		UpdateExpression:    aws.String("ADD usedBytes :delta SET updatedAt = :now"),
+		ConditionExpression: aws.String("usedBytes >= :bytes"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(-bytes, 10)},
+			":bytes": &types.AttributeValueMemberN{Value: strconv.FormatInt(bytes, 10)},
+			":now":   now,
+		},
+	})
+	var underflow *types.ConditionalCheckFailedException
+	if errors.As(err, &underflow) {
+		_, err = d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:        aws.String("vibe-drop-usage"),
+			Key:              key,
+			UpdateExpression: aws.String("SET usedBytes = :zero, updatedAt = :now"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+				":now":  now,
+			},
+		})
+	}
+	if err != nil {
+		return classify(fmt.Errorf("failed to release storage: %w", err))
+	}
+	return nil
+}
+
+// GetStorageUsage returns the bytes counted against the user's quota (zero if none yet)
+func (d *DynamoClient) GetStorageUsage(ctx context.Context, userID string) (int64, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("vibe-drop-usage"),
+		Key: map[string]types.AttributeValue{
+			"userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return 0, classify(fmt.Errorf("failed to get storage usage: %w", err))
+	}
+
+	used, ok := result.Item["usedBytes"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, nil
+	}
+	bytes, err := strconv.ParseInt(used.Value, 10, 64)
+	if err != nil {
+		return 0, classify(fmt.Errorf("invalid stored usage %q: %w", used.Value, err))
+	}
+	return bytes, nil
+}
@@ -3,12 +3,15 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"vibe-drop/internal/auth"
 )
 
 // User represents a user account in the system
@@ -19,6 +22,40 @@ type User struct {
 	PasswordHash string `json:"-" dynamodbav:"passwordHash"` // Never expose in JSON responses
 	CreatedAt    string `json:"created_at" dynamodbav:"createdAt"`
 	UpdatedAt    string `json:"updated_at" dynamodbav:"updatedAt"`
+
+	// Two-factor authentication: the TOTP secret, encrypted, which sign-in requires a code
+	// for once enabled (a secret that isn't enabled is an enrollment awaiting its first
+	// code), and the period of the last code accepted, so none is accepted twice
+	TOTPSecret   string `json:"-" dynamodbav:"totpSecret,omitempty"`
+	TOTPEnabled  bool   `json:"totp_enabled" dynamodbav:"totpEnabled,omitempty"`
+	TOTPLastStep int64  `json:"-" dynamodbav:"totpLastStep,omitempty"`
+
+	// An email change awaiting confirmation: the new address, which replaces Email once
+	// the token sent to it is presented, and the token's hash and expiry
+	PendingEmail               string `json:"pending_email,omitempty" dynamodbav:"pendingEmail,omitempty"`
+	EmailVerificationHash      string `json:"-" dynamodbav:"emailVerificationHash,omitempty"`
+	EmailVerificationExpiresAt string `json:"-" dynamodbav:"emailVerificationExpiresAt,omitempty"`
+
+	// What the user may do: auth.RoleUser, or auth.RoleAdmin for the admin API. Empty is
+	// auth.RoleUser.
+	Role string `json:"role,omitempty" dynamodbav:"role,omitempty"`
+
+	// A suspended account can't sign in or refresh its session. Set by an admin, with why.
+	SuspendedAt     string `json:"suspended_at,omitempty" dynamodbav:"suspendedAt,omitempty"`
+	SuspendedReason string `json:"suspended_reason,omitempty" dynamodbav:"suspendedReason,omitempty"`
+}
+
+// RoleOrDefault is the user's role, auth.RoleUser if none was given
+func (u *User) RoleOrDefault() string {
+	if u.Role == "" {
+		return auth.RoleUser
+	}
+	return u.Role
+}
+
+// IsSuspended reports whether an admin has suspended the account
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != ""
 }
 
 // CreateUser saves a new user to DynamoDB
@@ -41,7 +78,7 @@ func (d *DynamoClient) CreateUser(ctx context.Context, user *User) error {
 		ConditionExpression: aws.String("attribute_not_exists(userID)"),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return classify(fmt.Errorf("failed to create user: %w", err))
 	}
 
 	return nil
@@ -56,11 +93,11 @@ func (d *DynamoClient) GetUserByID(ctx context.Context, userID string) (*User, e
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, classify(fmt.Errorf("failed to get user: %w", err))
 	}
 
 	if result.Item == nil {
-		return nil, fmt.Errorf("user not found: %s", userID)
+		return nil, fmt.Errorf("user %w: %s", ErrNotFound, userID)
 	}
 
 	var user User
@@ -84,11 +121,11 @@ func (d *DynamoClient) GetUserByEmail(ctx context.Context, email string) (*User,
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query user by email: %w", err)
+		return nil, classify(fmt.Errorf("failed to query user by email: %w", err))
 	}
 
 	if len(result.Items) == 0 {
-		return nil, fmt.Errorf("user not found with email: %s", email)
+		return nil, fmt.Errorf("user %w with email: %s", ErrNotFound, email)
 	}
 
 	var user User
@@ -100,6 +137,33 @@ func (d *DynamoClient) GetUserByEmail(ctx context.Context, email string) (*User,
 	return &user, nil
 }
 
+// ListUsers returns every user, oldest account first
+func (d *DynamoClient) ListUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName: aws.String("vibe-drop-users"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classify(fmt.Errorf("failed to list users: %w", err))
+		}
+
+		var pageUsers []User
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageUsers); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal users: %w", err)
+		}
+		users = append(users, pageUsers...)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt != users[j].CreatedAt {
+			return users[i].CreatedAt < users[j].CreatedAt
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	return users, nil
+}
+
 // UpdateUser updates user information
 func (d *DynamoClient) UpdateUser(ctx context.Context, user *User) error {
 	// Update timestamp
@@ -117,8 +181,29 @@ func (d *DynamoClient) UpdateUser(ctx context.Context, user *User) error {
 		Item:      item,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return classify(fmt.Errorf("failed to update user: %w", err))
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// DeleteUser deletes a user and their inbox settings, so mail to their inbox address is
+// no longer accepted. Their files must be deleted first.
+func (d *DynamoClient) DeleteUser(ctx context.Context, userID string) error {
+	key := map[string]types.AttributeValue{
+		"userID": &types.AttributeValueMemberS{Value: userID},
+	}
+	if _, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-inboxes"),
+		Key:       key,
+	}); err != nil {
+		return classify(fmt.Errorf("failed to delete inbox settings: %w", err))
+	}
+	if _, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("vibe-drop-users"),
+		Key:       key,
+	}); err != nil {
+		return classify(fmt.Errorf("failed to delete user: %w", err))
+	}
+	return nil
+}
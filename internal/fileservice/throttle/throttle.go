@@ -0,0 +1,85 @@
+// Package throttle limits how often something keyed by ID, such as a file's download URLs,
+// may be issued. Each key gets a token bucket that holds Limit tokens and refills over
+// Window, so short bursts pass while sustained hotlinking is slowed to the average rate.
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter throttles actions per key. The zero value and a nil *Limiter allow everything.
+// Buckets live in process memory, so each replica throttles the traffic it serves.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewLimiter allows limit actions per key within window, refilled evenly. A limit or
+// window of zero disables throttling.
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Enabled reports whether the limiter throttles anything
+func (l *Limiter) Enabled() bool {
+	return l != nil && l.limit > 0 && l.window > 0
+}
+
+// Allow takes a token from key's bucket. If none is left it reports false and how long
+// until one is; the attempt isn't counted.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Every(l.window/time.Duration(l.limit)), l.limit)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	reservation := b.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// sweep drops buckets idle for a whole window, which have refilled and so behave like new
+// ones. It runs at most once per window. The caller holds l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.window {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterPerKey(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("file-1"); !ok {
+			t.Fatalf("request %d refused within the limit", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("file-1")
+	if ok || retryAfter != 20*time.Second {
+		t.Fatalf("over the limit: allowed %v, retry after %s, want refused for 20s", ok, retryAfter)
+	}
+	if ok, _ := l.Allow("file-2"); !ok {
+		t.Error("another key was throttled")
+	}
+
+	// Refused attempts don't use up the refill
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.Allow("file-1"); !ok {
+		t.Error("refused after a token refilled")
+	}
+
+	// Idle buckets are dropped once they would be full again
+	now = now.Add(2 * time.Minute)
+	l.Allow("file-3")
+	if _, kept := l.buckets["file-1"]; kept || len(l.buckets) != 1 {
+		t.Errorf("buckets after sweep = %d, want only file-3", len(l.buckets))
+	}
+}
+
+func TestDisabledLimiter(t *testing.T) {
+	var nilLimiter *Limiter
+	for _, l := range []*Limiter{nilLimiter, NewLimiter(0, time.Minute), NewLimiter(5, 0)} {
+		for i := 0; i < 10; i++ {
+			if ok, _ := l.Allow("file-1"); !ok {
+				t.Fatalf("disabled limiter %+v refused a request", l)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package transfer moves file ownership from one user to another, e.g. when offboarding an
+// employee. Admins queue a transfer; a background job works through it file by file.
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// staleAfter is how long a running transfer can go without a heartbeat before another
+// run takes it over, assuming the replica working on it stopped
+const staleAfter = 10 * time.Minute
+
+// ObjectStore is the object storage a transfer needs
+type ObjectStore interface {
+	CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error
+	DeleteObject(ctx context.Context, bucket, s3Key string) error
+}
+
+// MetadataStore is the persistence a transfer needs
+type MetadataStore interface {
+	GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error)
+	ListUserFiles(ctx context.Context, userID string) ([]storage.FileMetadata, error)
+	TransferFileOwnership(ctx context.Context, metadata *storage.FileMetadata, toUserID, newKey string) error
+	MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error)
+	ListUnfinishedOwnershipTransfers(ctx context.Context) ([]storage.OwnershipTransfer, error)
+	ClaimOwnershipTransfer(ctx context.Context, transfer *storage.OwnershipTransfer, staleBefore time.Time) (bool, error)
+	SaveOwnershipTransfer(ctx context.Context, transfer *storage.OwnershipTransfer) error
+}
+
+// errSkipped marks a file that is left alone rather than failed
+var errSkipped = errors.New("skipped")
+
+// TransferFile moves one completed file to toUserID. The object is copied under the new
+// owner's prefix first; the metadata and both users' usage then switch in one
+// transaction, and only after that is the old object deleted. URLs issued for the old key
+// stop working with it.
+func TransferFile(ctx context.Context, s3Client ObjectStore, dynamoClient MetadataStore, metadata *storage.FileMetadata, toUserID string) error {
+	if metadata.Status != storage.FileStatusCompleted {
+		return errSkipped // Unfinished uploads stay with the user who started them
+	}
+
+	oldKey := metadata.S3Key
+	newKey := storage.ObjectKey(toUserID, metadata.FileID, metadata.Filename)
+	if err := s3Client.CopyObject(ctx, metadata.Bucket, oldKey, newKey, metadata.TotalSize); err != nil {
+		return err
+	}
+
+	if err := dynamoClient.TransferFileOwnership(ctx, metadata, toUserID, newKey); err != nil {
+		if delErr := s3Client.DeleteObject(ctx, metadata.Bucket, newKey); delErr != nil {
+			log.Printf("Warning: Failed to remove copy %s after ownership transfer failed: %v", newKey, delErr)
+		}
+		if errors.Is(err, storage.ErrOwnershipChanged) {
+			return errSkipped
+		}
+		return err
+	}
+
+	// The file already belongs to the new owner; a leftover object is an orphan for the reconciler
+	if err := s3Client.DeleteObject(ctx, metadata.Bucket, oldKey); err != nil {
+		log.Printf("Warning: Transferred file %s to %s but failed to delete %s: %v", metadata.FileID, newKey, oldKey, err)
+	}
+	if _, err := dynamoClient.MarkURLsRevoked(ctx, metadata.FileID, time.Now()); err != nil {
+		log.Printf("Warning: Failed to mark URLs for file %s revoked: %v", metadata.FileID, err)
+	}
+	return nil
+}
+
+// Runner works through queued ownership transfers; the scheduler runs it
+type Runner struct {
+	s3Client     ObjectStore
+	dynamoClient MetadataStore
+}
+
+// NewRunner creates a transfer runner
+func NewRunner(s3Client ObjectStore, dynamoClient MetadataStore) *Runner {
+	return &Runner{s3Client: s3Client, dynamoClient: dynamoClient}
+}
+
+// RunOnce claims and runs every unfinished transfer. A transfer another replica is
+// running is left to it.
+func (r *Runner) RunOnce(ctx context.Context) error {
+	transfers, err := r.dynamoClient.ListUnfinishedOwnershipTransfers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range transfers {
+		transfer := &transfers[i]
+		claimed, err := r.dynamoClient.ClaimOwnershipTransfer(ctx, transfer, time.Now().Add(-staleAfter))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := r.Run(ctx, transfer); err != nil {
+			return fmt.Errorf("transfer %s: %w", transfer.TransferID, err)
+		}
+	}
+	return nil
+}
+
+// Run moves every file in a claimed transfer, saving progress after each so a restarted
+// run resumes instead of starting over. Files already moved are no longer owned by the
+// source user and are not counted again; skips and failures are recounted from scratch.
+func (r *Runner) Run(ctx context.Context, transfer *storage.OwnershipTransfer) error {
+	files, err := r.files(ctx, transfer)
+	if err != nil {
+		return err
+	}
+	transfer.Skipped = 0
+	transfer.Failures = nil
+
+	for i := range files {
+		file := &files[i]
+		if file.UserID != transfer.FromUserID {
+			if file.UserID != transfer.ToUserID {
+				transfer.Skipped++
+			}
+			continue
+		}
+
+		err := TransferFile(ctx, r.s3Client, r.dynamoClient, file, transfer.ToUserID)
+		switch {
+		case errors.Is(err, errSkipped):
+			transfer.Skipped++
+		case err != nil:
+			log.Printf("Transfer %s failed to move file %s: %v", transfer.TransferID, file.FileID, err)
+			transfer.Failures = append(transfer.Failures, storage.TransferFailure{FileID: file.FileID, Error: err.Error()})
+		default:
+			transfer.Transferred++
+			transfer.Bytes += file.TotalSize
+		}
+
+		transfer.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := r.dynamoClient.SaveOwnershipTransfer(ctx, transfer); err != nil {
+			return err
+		}
+	}
+
+	completedAt := time.Now().UTC().Format(time.RFC3339)
+	transfer.Status = storage.TransferStatusCompleted
+	transfer.UpdatedAt = completedAt
+	transfer.CompletedAt = &completedAt
+	if err := r.dynamoClient.SaveOwnershipTransfer(ctx, transfer); err != nil {
+		return err
+	}
+	log.Printf("Transfer %s from %s to %s finished: %d files (%d bytes) moved, %d skipped, %d failed",
+		transfer.TransferID, transfer.FromUserID, transfer.ToUserID, transfer.Transferred, transfer.Bytes, transfer.Skipped, len(transfer.Failures))
+	return nil
+}
+
+// files returns the transfer's files: the requested ones, or everything the source user owns
+func (r *Runner) files(ctx context.Context, transfer *storage.OwnershipTransfer) ([]storage.FileMetadata, error) {
+	if len(transfer.FileIDs) == 0 {
+		return r.dynamoClient.ListUserFiles(ctx, transfer.FromUserID)
+	}
+
+	files := make([]storage.FileMetadata, 0, len(transfer.FileIDs))
+	for _, fileID := range transfer.FileIDs {
+		metadata, err := r.dynamoClient.GetFileMetadata(ctx, fileID)
+		if err != nil {
+			files = append(files, storage.FileMetadata{FileID: fileID}) // Gone; counted as skipped
+			continue
+		}
+		files = append(files, *metadata)
+	}
+	return files, nil
+}
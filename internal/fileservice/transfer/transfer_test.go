@@ -0,0 +1,122 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+type fakeObjects struct {
+	objects map[string]bool
+}
+
+func (f *fakeObjects) CopyObject(ctx context.Context, bucket, srcKey, dstKey string, size int64) error {
+	if !f.objects[srcKey] {
+		return errors.New("no such key")
+	}
+	f.objects[dstKey] = true
+	return nil
+}
+
+func (f *fakeObjects) DeleteObject(ctx context.Context, bucket, s3Key string) error {
+	delete(f.objects, s3Key)
+	return nil
+}
+
+type fakeStore struct {
+	files map[string]*storage.FileMetadata
+	usage map[string]int64
+	saved []storage.OwnershipTransfer
+}
+
+func (f *fakeStore) GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error) {
+	metadata, ok := f.files[fileID]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	copied := *metadata
+	return &copied, nil
+}
+
+func (f *fakeStore) ListUserFiles(ctx context.Context, userID string) ([]storage.FileMetadata, error) {
+	var files []storage.FileMetadata
+	for _, file := range f.files {
+		if file.UserID == userID {
+			files = append(files, *file)
+		}
+	}
+	return files, nil
+}
+
+func (f *fakeStore) TransferFileOwnership(ctx context.Context, metadata *storage.FileMetadata, toUserID, newKey string) error {
+	stored := f.files[metadata.FileID]
+	if stored == nil || stored.UserID != metadata.UserID || stored.S3Key != metadata.S3Key {
+		return storage.ErrOwnershipChanged
+	}
+	stored.UserID, stored.S3Key = toUserID, newKey
+	f.usage[metadata.UserID] = max(f.usage[metadata.UserID]-metadata.TotalSize, 0)
+	f.usage[toUserID] += metadata.TotalSize
+	return nil
+}
+
+func (f *fakeStore) MarkURLsRevoked(ctx context.Context, fileID string, revokedAt time.Time) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeStore) ListUnfinishedOwnershipTransfers(ctx context.Context) ([]storage.OwnershipTransfer, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) ClaimOwnershipTransfer(ctx context.Context, transfer *storage.OwnershipTransfer, staleBefore time.Time) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeStore) SaveOwnershipTransfer(ctx context.Context, transfer *storage.OwnershipTransfer) error {
+	f.saved = append(f.saved, *transfer)
+	return nil
+}
+
+func TestRunMovesCompletedFilesAndUsage(t *testing.T) {
+	db := &fakeStore{
+		files: map[string]*storage.FileMetadata{
+			"done":      {FileID: "done", Filename: "a.txt", TotalSize: 100, Status: storage.FileStatusCompleted, UserID: "alice", S3Key: "users/alice/done-a.txt"},
+			"uploading": {FileID: "uploading", Filename: "b.bin", TotalSize: 50, Status: storage.FileStatusUploading, UserID: "alice", S3Key: "users/alice/uploading-b.bin"},
+			"other":     {FileID: "other", Filename: "c.txt", TotalSize: 10, Status: storage.FileStatusCompleted, UserID: "carol", S3Key: "users/carol/other-c.txt"},
+		},
+		usage: map[string]int64{"alice": 150, "bob": 5},
+	}
+	s3 := &fakeObjects{objects: map[string]bool{"users/alice/done-a.txt": true}}
+	transfer := &storage.OwnershipTransfer{TransferID: "t-1", FromUserID: "alice", ToUserID: "bob", Status: storage.TransferStatusRunning}
+
+	if err := NewRunner(s3, db).Run(context.Background(), transfer); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if moved := db.files["done"]; moved.UserID != "bob" || moved.S3Key != "users/bob/done-a.txt" {
+		t.Errorf("transferred file = %+v, want owned by bob under his prefix", moved)
+	}
+	if !s3.objects["users/bob/done-a.txt"] || s3.objects["users/alice/done-a.txt"] {
+		t.Errorf("objects = %v, want the object moved to bob's prefix", s3.objects)
+	}
+	if db.files["uploading"].UserID != "alice" {
+		t.Error("an in-progress upload was transferred")
+	}
+	if db.usage["alice"] != 50 || db.usage["bob"] != 105 {
+		t.Errorf("usage = %v, want alice 50 and bob 105", db.usage)
+	}
+	if transfer.Status != storage.TransferStatusCompleted || transfer.Transferred != 1 || transfer.Bytes != 100 || transfer.Skipped != 1 {
+		t.Errorf("transfer = %+v, want completed with 1 moved (100 bytes) and 1 skipped", transfer)
+	}
+
+	// A resumed run finds nothing left to move and keeps the earlier counts
+	transfer.Status = storage.TransferStatusRunning
+	if err := NewRunner(s3, db).Run(context.Background(), transfer); err != nil {
+		t.Fatalf("resumed Run: %v", err)
+	}
+	if transfer.Transferred != 1 || transfer.Skipped != 1 || db.usage["bob"] != 105 {
+		t.Errorf("after resume: transfer = %+v, usage = %v; want counts and usage unchanged", transfer, db.usage)
+	}
+}
@@ -0,0 +1,40 @@
+package uploadwatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/common"
+)
+
+// WebhookNotifier posts each notice as JSON to a webhook that reaches the user, such as an
+// email relay, with the details in "notice" and the address to send it to in "email"
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: common.NewWebhookClient()}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notice Notice, email string) {
+	text := fmt.Sprintf("Upload of %s has been in progress since %s (%d of %d parts)",
+		notice.Filename, notice.StartedAt.Format(time.RFC3339), notice.UploadedParts, notice.TotalParts)
+	if notice.Kind == KindStalled {
+		text = fmt.Sprintf("Upload of %s has made no progress since %s (%d of %d parts)",
+			notice.Filename, notice.LastProgressAt.Format(time.RFC3339), notice.UploadedParts, notice.TotalParts)
+	}
+	err := common.PostWebhook(ctx, n.client, n.url, map[string]interface{}{
+		"text":   text,
+		"email":  email,
+		"notice": notice,
+	})
+	if err != nil {
+		log.Printf("Failed to send upload notice: %v", err)
+	}
+}
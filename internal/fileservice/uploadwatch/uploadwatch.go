@@ -0,0 +1,188 @@
+// Package uploadwatch tells users about multipart uploads that are taking a long time or
+// have stopped making progress, with links to resume or abort them.
+package uploadwatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// Notice kinds
+const (
+	KindLongRunning = "long_running" // Still in progress after Thresholds.LongRunning
+	KindStalled     = "stalled"      // No chunk uploaded for Thresholds.Stall
+)
+
+// Thresholds are when an upload in progress is worth a notice; zero turns a kind off
+type Thresholds struct {
+	LongRunning time.Duration
+	Stall       time.Duration
+}
+
+// Action is an API call the user can make about the upload, relative to the API's base URL
+type Action struct {
+	Name   string `json:"name"` // "resume" or "abort"
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Notice is one thing to tell a user about one of their uploads
+type Notice struct {
+	Kind           string    `json:"kind"`
+	FileID         string    `json:"file_id"`
+	Filename       string    `json:"filename"`
+	UserID         string    `json:"user_id"`
+	StartedAt      time.Time `json:"started_at"`
+	LastProgressAt time.Time `json:"last_progress_at"` // The last chunk uploaded, or the start
+	UploadedParts  int       `json:"uploaded_parts"`
+	TotalParts     int       `json:"total_parts"`
+	Actions        []Action  `json:"actions"`
+}
+
+// Key identifies a notice for deduplication. A stall is keyed by when progress stopped,
+// so an upload that resumes and stalls again is noticed again.
+func (n Notice) Key() string {
+	if n.Kind == KindStalled {
+		return n.Kind + " " + n.FileID + " " + n.LastProgressAt.Format(time.RFC3339)
+	}
+	return n.Kind + " " + n.FileID
+}
+
+// ChunkLister is the persistence Check needs
+type ChunkLister interface {
+	GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error)
+}
+
+// InProgress reports whether file is a multipart upload still being uploaded
+func InProgress(file storage.FileMetadata) bool {
+	return file.UploadType == "multipart" && file.Status == storage.FileStatusUploading && file.S3UploadID != nil
+}
+
+// Check returns the notices due at now for file, an upload in progress
+func Check(ctx context.Context, chunks ChunkLister, file storage.FileMetadata, now time.Time, thresholds Thresholds) ([]Notice, error) {
+	startedAt, err := time.Parse(time.RFC3339, file.UploadedAt)
+	if err != nil {
+		return nil, fmt.Errorf("file %s has an invalid upload time: %w", file.FileID, err)
+	}
+	longRunning := thresholds.LongRunning > 0 && now.Sub(startedAt) >= thresholds.LongRunning
+	// Nothing can have stalled before the stall threshold has passed since the start
+	mayStall := thresholds.Stall > 0 && now.Sub(startedAt) >= thresholds.Stall
+	if !longRunning && !mayStall {
+		return nil, nil
+	}
+
+	records, err := chunks.GetFileChunks(ctx, file.FileID)
+	if err != nil {
+		return nil, err
+	}
+	lastProgress := startedAt
+	for _, chunk := range records {
+		if chunk.Status != "uploaded" {
+			continue
+		}
+		if uploadedAt, err := time.Parse(time.RFC3339, chunk.UploadedAt); err == nil && uploadedAt.After(lastProgress) {
+			lastProgress = uploadedAt
+		}
+	}
+
+	notice := Notice{
+		FileID:         file.FileID,
+		Filename:       file.Filename,
+		UserID:         file.UserID,
+		StartedAt:      startedAt,
+		LastProgressAt: lastProgress,
+		UploadedParts:  file.UploadedParts,
+		Actions: []Action{
+			{Name: "resume", Method: "GET", Path: "/files/" + file.FileID + "/upload-status"},
+			{Name: "abort", Method: "DELETE", Path: "/files/" + file.FileID + "/upload"},
+		},
+	}
+	if file.TotalChunks != nil {
+		notice.TotalParts = *file.TotalChunks
+	}
+
+	var notices []Notice
+	if longRunning {
+		notice.Kind = KindLongRunning
+		notices = append(notices, notice)
+	}
+	if mayStall && now.Sub(lastProgress) >= thresholds.Stall {
+		notice.Kind = KindStalled
+		notices = append(notices, notice)
+	}
+	return notices, nil
+}
+
+// Notifier delivers a notice to the user, e.g. by email
+type Notifier interface {
+	Notify(ctx context.Context, notice Notice, email string)
+}
+
+// MetadataStore is the persistence a Watcher needs
+type MetadataStore interface {
+	ChunkLister
+	ListAllFiles(ctx context.Context) ([]storage.FileMetadata, error)
+	GetUserByID(ctx context.Context, userID string) (*storage.User, error)
+}
+
+// Watcher checks every upload in progress and sends each notice once; the scheduler
+// runs it. What has been sent is kept in memory, so a restart may repeat a notice.
+type Watcher struct {
+	store      MetadataStore
+	thresholds Thresholds
+	notifier   Notifier
+	sent       map[string]string // File IDs by notice key
+}
+
+// NewWatcher creates a watcher that sends notices to notifier
+func NewWatcher(store MetadataStore, thresholds Thresholds, notifier Notifier) *Watcher {
+	return &Watcher{store: store, thresholds: thresholds, notifier: notifier, sent: make(map[string]string)}
+}
+
+// RunOnce sends the notices that are due and haven't been sent. A file that can't be
+// checked is logged and tried again on the next run.
+func (w *Watcher) RunOnce(ctx context.Context) error {
+	files, err := w.store.ListAllFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	due := make(map[string]bool)
+	unchecked := make(map[string]bool)
+	for _, file := range files {
+		if !InProgress(file) {
+			continue
+		}
+		notices, err := Check(ctx, w.store, file, now, w.thresholds)
+		if err != nil {
+			log.Printf("Upload watch failed to check upload %s: %v", file.FileID, err)
+			unchecked[file.FileID] = true
+			continue
+		}
+		for _, notice := range notices {
+			due[notice.Key()] = true
+			if _, ok := w.sent[notice.Key()]; ok {
+				continue
+			}
+			var email string
+			if user, err := w.store.GetUserByID(ctx, notice.UserID); err == nil {
+				email = user.Email
+			}
+			w.notifier.Notify(ctx, notice, email)
+			w.sent[notice.Key()] = notice.FileID
+		}
+	}
+
+	// Forget uploads that finished, were aborted or made progress
+	for key, fileID := range w.sent {
+		if !due[key] && !unchecked[fileID] {
+			delete(w.sent, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package uploadwatch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+type fakeStore struct {
+	files  []storage.FileMetadata
+	chunks map[string][]storage.FileChunk
+}
+
+func (s *fakeStore) GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error) {
+	return s.chunks[fileID], nil
+}
+
+func (s *fakeStore) ListAllFiles(ctx context.Context) ([]storage.FileMetadata, error) {
+	return s.files, nil
+}
+
+func (s *fakeStore) GetUserByID(ctx context.Context, userID string) (*storage.User, error) {
+	return &storage.User{UserID: userID, Email: userID + "@example.com"}, nil
+}
+
+type recordingNotifier struct {
+	notices []Notice
+	emails  []string
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notice Notice, email string) {
+	n.notices = append(n.notices, notice)
+	n.emails = append(n.emails, email)
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(ago time.Duration) string { return now.Add(-ago).Format(time.RFC3339) }
+	uploadID, total := "upload-1", 10
+	upload := func(id string, started time.Duration) storage.FileMetadata {
+		return storage.FileMetadata{FileID: id, UserID: "user-1", UploadType: "multipart", Status: storage.FileStatusUploading,
+			UploadedAt: at(started), S3UploadID: &uploadID, TotalChunks: &total}
+	}
+	store := &fakeStore{chunks: map[string][]storage.FileChunk{
+		"moving":  {{Status: "uploaded", UploadedAt: at(time.Minute)}},
+		"stalled": {{Status: "uploaded", UploadedAt: at(time.Hour)}, {Status: "pending"}},
+	}}
+	thresholds := Thresholds{LongRunning: 2 * time.Hour, Stall: 15 * time.Minute}
+
+	tests := []struct {
+		file  storage.FileMetadata
+		kinds []string
+	}{
+		{upload("new", 5*time.Minute), nil},
+		{upload("moving", 30*time.Minute), nil},
+		{upload("stalled", 90*time.Minute), []string{KindStalled}},
+		{upload("untouched", 30*time.Minute), []string{KindStalled}},
+		{upload("long", 3*time.Hour), []string{KindLongRunning, KindStalled}},
+	}
+	for _, tt := range tests {
+		notices, err := Check(context.Background(), store, tt.file, now, thresholds)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file.FileID, err)
+		}
+		var kinds []string
+		for _, notice := range notices {
+			kinds = append(kinds, notice.Kind)
+		}
+		if len(kinds) != len(tt.kinds) || (len(kinds) > 0 && (kinds[0] != tt.kinds[0] || kinds[len(kinds)-1] != tt.kinds[len(tt.kinds)-1])) {
+			t.Errorf("%s: notices %v, want %v", tt.file.FileID, kinds, tt.kinds)
+		}
+	}
+
+	notices, _ := Check(context.Background(), store, upload("stalled", 90*time.Minute), now, thresholds)
+	if len(notices) != 1 || !notices[0].LastProgressAt.Equal(now.Add(-time.Hour)) || notices[0].TotalParts != 10 {
+		t.Errorf("stalled notice = %+v", notices)
+	}
+	if actions := notices[0].Actions; len(actions) != 2 || actions[1].Method != "DELETE" || actions[1].Path != "/files/stalled/upload" {
+		t.Errorf("actions = %+v", actions)
+	}
+}
+
+func TestWatcherSendsEachNoticeOnce(t *testing.T) {
+	uploadID := "upload-1"
+	started := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	store := &fakeStore{files: []storage.FileMetadata{
+		{FileID: "f1", UserID: "user-1", UploadType: "multipart", Status: storage.FileStatusUploading, UploadedAt: started, S3UploadID: &uploadID},
+		{FileID: "done", UserID: "user-1", UploadType: "multipart", Status: storage.FileStatusCompleted, UploadedAt: started, S3UploadID: &uploadID},
+	}}
+	notifier := &recordingNotifier{}
+	watcher := NewWatcher(store, Thresholds{Stall: 15 * time.Minute}, notifier)
+
+	for i := 0; i < 2; i++ {
+		if err := watcher.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.notices) != 1 || notifier.notices[0].FileID != "f1" || notifier.emails[0] != "user-1@example.com" {
+		t.Fatalf("notices %+v to %v, want one stall notice for f1 to its owner", notifier.notices, notifier.emails)
+	}
+
+	// Progress clears the stall, so a later stall is noticed again
+	store.chunks = map[string][]storage.FileChunk{"f1": {{Status: "uploaded", UploadedAt: time.Now().UTC().Format(time.RFC3339)}}}
+	watcher.RunOnce(context.Background())
+	store.chunks = map[string][]storage.FileChunk{"f1": {{Status: "uploaded", UploadedAt: time.Now().Add(-20 * time.Minute).UTC().Format(time.RFC3339)}}}
+	watcher.RunOnce(context.Background())
+	if len(notifier.notices) != 2 {
+		t.Errorf("%d notices after the upload stalled again, want 2", len(notifier.notices))
+	}
+}
@@ -0,0 +1,41 @@
+package writeretry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// WebhookNotifier posts each write given up on as JSON to an alert webhook, with the
+// details in "entry" but not the records themselves
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: common.NewWebhookClient()}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, entry storage.OutboxEntry) {
+	err := common.PostWebhook(ctx, n.client, n.url, map[string]interface{}{
+		"text": fmt.Sprintf("Write retry exhausted: %s for file %s failed %d times; last error: %s",
+			entry.Kind, entry.FileID, entry.Attempts, entry.LastError),
+		"entry": map[string]interface{}{
+			"entry_id":   entry.EntryID,
+			"kind":       entry.Kind,
+			"file_id":    entry.FileID,
+			"attempts":   entry.Attempts,
+			"last_error": entry.LastError,
+			"created_at": entry.CreatedAt,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to send write retry alert: %v", err)
+	}
+}
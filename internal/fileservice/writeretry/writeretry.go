@@ -0,0 +1,269 @@
+// Package writeretry retries the file metadata and chunk record writes that fail while an
+// upload is being started. Without the records an upload can't be completed, listed or
+// cleaned up, so instead of dropping them the write is queued and re-attempted with
+// exponential backoff until it succeeds or its attempts run out, which raises an alert.
+package writeretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+// pollInterval is how often the queue looks for entries due a retry
+const pollInterval = time.Second
+
+// Store is the metadata storage the queue writes to and keeps its outbox in.
+// storage.MetadataStore implements it.
+type Store interface {
+	GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error)
+	SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error
+	GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error)
+	SaveFileChunks(ctx context.Context, chunks []storage.FileChunk) error
+	SaveOutboxEntry(ctx context.Context, entry *storage.OutboxEntry) error
+	ListOutboxEntries(ctx context.Context) ([]storage.OutboxEntry, error)
+	DeleteOutboxEntry(ctx context.Context, entryID string) error
+}
+
+var _ Store = storage.MetadataStore(nil)
+
+// Notifier is told about each write whose attempts ran out
+type Notifier interface {
+	Notify(ctx context.Context, entry storage.OutboxEntry)
+}
+
+// Backoff is how retries are spaced: the first comes Initial after the failed write, and
+// each wait doubles up to Max. A write is given up on after MaxAttempts retries.
+type Backoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+// delay is how long to wait after the given number of failed retries
+func (b Backoff) delay(attempts int) time.Duration {
+	delay := b.Initial
+	for i := 0; i < attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, b.Max)
+}
+
+// Queue holds failed writes in memory and retries them. Each entry is also saved to the
+// metadata store's outbox, best effort since the store may be what is failing, and the
+// outbox is loaded when the queue starts, so a restart doesn't lose them. Every replica
+// runs its own queue; after a restart more than one may retry the same entry, which is
+// harmless because a retry only writes records that are still missing. A nil *Queue
+// drops the writes it is given.
+type Queue struct {
+	store     Store
+	backoff   Backoff
+	notifiers []Notifier
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]storage.OutboxEntry
+}
+
+// NewQueue creates a queue that writes to store, spacing retries by backoff
+func NewQueue(store Store, backoff Backoff) *Queue {
+	return &Queue{
+		store:   store,
+		backoff: backoff,
+		now:     time.Now,
+		entries: make(map[string]storage.OutboxEntry),
+	}
+}
+
+// OnExhausted registers a notifier for writes whose attempts ran out
+func (q *Queue) OnExhausted(n Notifier) {
+	q.notifiers = append(q.notifiers, n)
+}
+
+// RetryFileMetadata queues a file metadata write that failed with cause
+func (q *Queue) RetryFileMetadata(ctx context.Context, metadata *storage.FileMetadata, cause error) {
+	if q == nil {
+		return
+	}
+	q.add(ctx, storage.OutboxEntry{Kind: storage.OutboxFileMetadata, FileID: metadata.FileID, Metadata: metadata}, cause)
+}
+
+// RetryFileChunks queues a chunk record write that failed with cause
+func (q *Queue) RetryFileChunks(ctx context.Context, fileID string, chunks []storage.FileChunk, cause error) {
+	if q == nil || len(chunks) == 0 {
+		return
+	}
+	q.add(ctx, storage.OutboxEntry{Kind: storage.OutboxFileChunks, FileID: fileID, Chunks: chunks}, cause)
+}
+
+func (q *Queue) add(ctx context.Context, entry storage.OutboxEntry, cause error) {
+	now := q.now().UTC()
+	entry.EntryID = uuid.New().String()
+	entry.LastError = cause.Error()
+	entry.CreatedAt = now.Format(time.RFC3339)
+	entry.NextAttemptAt = now.Add(q.backoff.delay(0)).Format(time.RFC3339Nano)
+
+	q.mu.Lock()
+	q.entries[entry.EntryID] = entry
+	q.mu.Unlock()
+
+	common.Logger(ctx).Warn("Queued failed write for retry", "kind", entry.Kind, "file_id", entry.FileID, "entry_id", entry.EntryID, "error", cause)
+	// Saved even if the request is cancelled meanwhile
+	q.persist(context.WithoutCancel(ctx), entry)
+}
+
+// Pending is how many writes are waiting to be retried
+func (q *Queue) Pending() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Run loads the outbox, then retries entries as they fall due until ctx is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	loaded := false
+	for {
+		// Keep trying to load the outbox, as the store may be down at startup
+		if !loaded {
+			loaded = q.load(ctx) == nil
+		}
+		q.RetryDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// load adds the outbox's unexhausted entries to those in memory
+func (q *Queue) load(ctx context.Context) error {
+	entries, err := q.store.ListOutboxEntries(ctx)
+	if err != nil {
+		common.Logger(ctx).Warn("Failed to load write retry outbox", "error", err)
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, entry := range entries {
+		if _, queued := q.entries[entry.EntryID]; !queued && entry.ExhaustedAt == nil {
+			q.entries[entry.EntryID] = entry
+		}
+	}
+	return nil
+}
+
+// RetryDue retries each entry whose next attempt has come, one at a time
+func (q *Queue) RetryDue(ctx context.Context) {
+	now := q.now()
+	var due []storage.OutboxEntry
+	q.mu.Lock()
+	for _, entry := range q.entries {
+		if next, err := time.Parse(time.RFC3339Nano, entry.NextAttemptAt); err != nil || !next.After(now) {
+			due = append(due, entry)
+		}
+	}
+	q.mu.Unlock()
+
+	for _, entry := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		q.retry(ctx, entry)
+	}
+}
+
+func (q *Queue) retry(ctx context.Context, entry storage.OutboxEntry) {
+	logger := common.Logger(ctx).With("kind", entry.Kind, "file_id", entry.FileID, "entry_id", entry.EntryID)
+	err := q.write(ctx, entry)
+	if err == nil {
+		q.remove(entry.EntryID)
+		logger.Info("Retried write succeeded", "attempts", entry.Attempts+1)
+		if err := q.store.DeleteOutboxEntry(ctx, entry.EntryID); err != nil {
+			// A later load retries it again, which finds the records already written
+			logger.Warn("Failed to delete outbox entry", "error", err)
+		}
+		return
+	}
+
+	now := q.now().UTC()
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if entry.Attempts >= q.backoff.MaxAttempts {
+		exhaustedAt := now.Format(time.RFC3339)
+		entry.ExhaustedAt = &exhaustedAt
+		q.remove(entry.EntryID)
+		logger.Error("Gave up retrying write; the upload's records are missing", "attempts", entry.Attempts, "error", err)
+		for _, n := range q.notifiers {
+			go n.Notify(context.Background(), entry)
+		}
+	} else {
+		entry.NextAttemptAt = now.Add(q.backoff.delay(entry.Attempts)).Format(time.RFC3339Nano)
+		q.mu.Lock()
+		q.entries[entry.EntryID] = entry
+		q.mu.Unlock()
+		logger.Warn("Retried write failed", "attempts", entry.Attempts, "next_attempt_at", entry.NextAttemptAt, "error", err)
+	}
+	// Also catches the outbox up if saving the entry failed before
+	q.persist(ctx, entry)
+}
+
+// write makes the entry's write if it hasn't been made meanwhile
+func (q *Queue) write(ctx context.Context, entry storage.OutboxEntry) error {
+	switch entry.Kind {
+	case storage.OutboxFileMetadata:
+		_, err := q.store.GetFileMetadata(ctx, entry.FileID)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		return q.store.SaveFileMetadata(ctx, entry.Metadata)
+	case storage.OutboxFileChunks:
+		existing, err := q.store.GetFileChunks(ctx, entry.FileID)
+		if err != nil {
+			return err
+		}
+		saved := make(map[int]bool, len(existing))
+		for _, chunk := range existing {
+			saved[chunk.ChunkNumber] = true
+		}
+		var missing []storage.FileChunk
+		for _, chunk := range entry.Chunks {
+			if !saved[chunk.ChunkNumber] {
+				missing = append(missing, chunk)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		return q.store.SaveFileChunks(ctx, missing)
+	default:
+		return fmt.Errorf("unknown outbox entry kind %q", entry.Kind)
+	}
+}
+
+func (q *Queue) remove(entryID string) {
+	q.mu.Lock()
+	delete(q.entries, entryID)
+	q.mu.Unlock()
+}
+
+func (q *Queue) persist(ctx context.Context, entry storage.OutboxEntry) {
+	if err := q.store.SaveOutboxEntry(ctx, &entry); err != nil {
+		common.Logger(ctx).Warn("Failed to save outbox entry", "kind", entry.Kind, "file_id", entry.FileID, "entry_id", entry.EntryID, "error", err)
+	}
+}
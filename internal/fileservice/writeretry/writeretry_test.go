@@ -0,0 +1,232 @@
+package writeretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"vibe-drop/internal/fileservice/storage"
+)
+
+var errUnavailable = errors.New("metadata store unavailable")
+
+// fakeStore is an in-memory Store whose writes fail while down is set
+type fakeStore struct {
+	mu     sync.Mutex
+	down   bool
+	files  map[string]*storage.FileMetadata
+	chunks map[string][]storage.FileChunk
+	outbox map[string]storage.OutboxEntry
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		files:  make(map[string]*storage.FileMetadata),
+		chunks: make(map[string][]storage.FileChunk),
+		outbox: make(map[string]storage.OutboxEntry),
+	}
+}
+
+func (f *fakeStore) GetFileMetadata(ctx context.Context, fileID string) (*storage.FileMetadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	metadata, ok := f.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("file %w", storage.ErrNotFound)
+	}
+	return metadata, nil
+}
+
+func (f *fakeStore) SaveFileMetadata(ctx context.Context, metadata *storage.FileMetadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errUnavailable
+	}
+	f.files[metadata.FileID] = metadata
+	return nil
+}
+
+func (f *fakeStore) GetFileChunks(ctx context.Context, fileID string) ([]storage.FileChunk, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.chunks[fileID], nil
+}
+
+func (f *fakeStore) SaveFileChunks(ctx context.Context, chunks []storage.FileChunk) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errUnavailable
+	}
+	for _, chunk := range chunks {
+		f.chunks[chunk.FileID] = append(f.chunks[chunk.FileID], chunk)
+	}
+	return nil
+}
+
+func (f *fakeStore) SaveOutboxEntry(ctx context.Context, entry *storage.OutboxEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outbox[entry.EntryID] = *entry
+	return nil
+}
+
+func (f *fakeStore) ListOutboxEntries(ctx context.Context) ([]storage.OutboxEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var entries []storage.OutboxEntry
+	for _, entry := range f.outbox {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (f *fakeStore) DeleteOutboxEntry(ctx context.Context, entryID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.outbox, entryID)
+	return nil
+}
+
+func (f *fakeStore) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+type recordingNotifier struct {
+	entries chan storage.OutboxEntry
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, entry storage.OutboxEntry) {
+	n.entries <- entry
+}
+
+// newTestQueue returns a queue on a clock the returned function advances
+func newTestQueue(store Store, backoff Backoff) (*Queue, func(time.Duration)) {
+	q := NewQueue(store, backoff)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	return q, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second}
+	for attempts, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := b.delay(attempts); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestRetriesUntilWritten(t *testing.T) {
+	store := newFakeStore()
+	store.setDown(true)
+	q, advance := newTestQueue(store, Backoff{Initial: time.Second, Max: time.Minute, MaxAttempts: 5})
+	ctx := context.Background()
+
+	q.RetryFileMetadata(ctx, &storage.FileMetadata{FileID: "file-1"}, errUnavailable)
+	chunks := []storage.FileChunk{{FileID: "file-2", ChunkNumber: 1}, {FileID: "file-2", ChunkNumber: 2}}
+	store.chunks["file-2"] = chunks[:1] // Saved before the write failed partway
+	q.RetryFileChunks(ctx, "file-2", chunks, errUnavailable)
+
+	q.RetryDue(ctx)
+	if q.Pending() != 2 {
+		t.Fatalf("%d pending before the first retry is due, want 2", q.Pending())
+	}
+	advance(time.Second)
+	q.RetryDue(ctx)
+	if q.Pending() != 2 {
+		t.Fatalf("%d pending after a failed retry, want 2", q.Pending())
+	}
+
+	store.setDown(false)
+	advance(time.Second) // The second retry waits twice as long
+	q.RetryDue(ctx)
+	if q.Pending() != 2 {
+		t.Fatalf("%d pending before the second retry is due, want 2", q.Pending())
+	}
+	advance(time.Second)
+	q.RetryDue(ctx)
+	if q.Pending() != 0 {
+		t.Fatalf("%d pending after the store recovered, want 0", q.Pending())
+	}
+	if store.files["file-1"] == nil {
+		t.Error("file metadata was not written")
+	}
+	if got := store.chunks["file-2"]; len(got) != 2 || got[1].ChunkNumber != 2 {
+		t.Errorf("chunk records %+v, want chunks 1 and 2 once each", got)
+	}
+	if len(store.outbox) != 0 {
+		t.Errorf("%d entries left in the outbox", len(store.outbox))
+	}
+}
+
+func TestAlertsAfterLastAttempt(t *testing.T) {
+	store := newFakeStore()
+	store.setDown(true)
+	q, advance := newTestQueue(store, Backoff{Initial: time.Second, Max: time.Second, MaxAttempts: 3})
+	notifier := &recordingNotifier{entries: make(chan storage.OutboxEntry, 1)}
+	q.OnExhausted(notifier)
+	ctx := context.Background()
+
+	q.RetryFileMetadata(ctx, &storage.FileMetadata{FileID: "file-1"}, errUnavailable)
+	for i := 0; i < 3; i++ {
+		advance(time.Second)
+		q.RetryDue(ctx)
+	}
+	if q.Pending() != 0 {
+		t.Fatalf("%d pending after the last attempt, want 0", q.Pending())
+	}
+
+	select {
+	case entry := <-notifier.entries:
+		if entry.FileID != "file-1" || entry.Attempts != 3 || entry.LastError != errUnavailable.Error() {
+			t.Errorf("alerted about %+v", entry)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert after the last attempt")
+	}
+
+	// The exhausted entry stays in the outbox for operators, but isn't retried again
+	entries, _ := store.ListOutboxEntries(ctx)
+	if len(entries) != 1 || entries[0].ExhaustedAt == nil {
+		t.Fatalf("outbox %+v, want the exhausted entry", entries)
+	}
+	restarted, _ := newTestQueue(store, Backoff{Initial: time.Second, Max: time.Second, MaxAttempts: 3})
+	if err := restarted.load(ctx); err != nil || restarted.Pending() != 0 {
+		t.Errorf("restarted queue has %d pending (%v), want 0", restarted.Pending(), err)
+	}
+}
+
+func TestLoadsOutboxOnStart(t *testing.T) {
+	store := newFakeStore()
+	store.outbox["entry-1"] = storage.OutboxEntry{
+		EntryID:  "entry-1",
+		Kind:     storage.OutboxFileMetadata,
+		FileID:   "file-1",
+		Metadata: &storage.FileMetadata{FileID: "file-1"},
+	}
+	q, _ := newTestQueue(store, Backoff{Initial: time.Second, Max: time.Minute, MaxAttempts: 5})
+	ctx := context.Background()
+
+	if err := q.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	q.RetryDue(ctx)
+	if store.files["file-1"] == nil || q.Pending() != 0 || len(store.outbox) != 0 {
+		t.Errorf("loaded entry not retried: metadata %v, %d pending, %d in outbox", store.files["file-1"], q.Pending(), len(store.outbox))
+	}
+}
+
+func TestNilQueueDropsWrites(t *testing.T) {
+	var q *Queue
+	q.RetryFileMetadata(context.Background(), &storage.FileMetadata{FileID: "file-1"}, errUnavailable)
+	if q.Pending() != 0 {
+		t.Error("nil queue kept a write")
+	}
+}
@@ -0,0 +1,125 @@
+// Package health runs the readiness checks of the gateway and the file service. Liveness
+// needs nothing from it: a process that can answer /health/live is alive. Readiness pings
+// each dependency the service relies on, so Kubernetes stops routing to a replica that
+// can't reach them.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"vibe-drop/internal/common"
+)
+
+// CheckTimeout bounds each dependency ping, so a hung dependency is reported as down
+// rather than stalling the probe. Give the probe a longer timeout than this.
+const CheckTimeout = 2 * time.Second
+
+// Overall and per-dependency states
+const (
+	StatusHealthy  = "healthy"  // Every dependency is up
+	StatusDegraded = "degraded" // At least one dependency is down
+	StatusUp       = "up"
+	StatusDown     = "down"
+)
+
+// Check pings one dependency
+type Check struct {
+	Name string
+	// A failing optional dependency degrades the service without making it unready, e.g.
+	// a canary the gateway can route around
+	Optional bool
+	Ping     func(ctx context.Context) error
+}
+
+// DependencyStatus is the outcome of one check
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // "up" or "down"
+	LatencyMS int64  `json:"latency_ms"`
+	Optional  bool   `json:"optional,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is a service's readiness: ready unless a required dependency is down
+type Report struct {
+	Status       string             `json:"status"` // "healthy" or "degraded"
+	Ready        bool               `json:"ready"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Service      string             `json:"service"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Checker serves a service's readiness probe
+type Checker struct {
+	service string
+	checks  []Check
+}
+
+// NewChecker reports service as ready when every required check passes
+func NewChecker(service string, checks ...Check) *Checker {
+	return &Checker{service: service, checks: checks}
+}
+
+// Run pings every dependency at once and reports the results in the order of the checks
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status:       StatusHealthy,
+		Ready:        true,
+		Timestamp:    time.Now(),
+		Service:      c.service,
+		Dependencies: make([]DependencyStatus, len(c.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Dependencies[i] = ping(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, dependency := range report.Dependencies {
+		if dependency.Status == StatusDown {
+			report.Status = StatusDegraded
+			if !dependency.Optional {
+				report.Ready = false
+			}
+		}
+	}
+	return report
+}
+
+func ping(ctx context.Context, check Check) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	err := check.Ping(ctx)
+	status := DependencyStatus{
+		Name:      check.Name,
+		Status:    StatusUp,
+		LatencyMS: time.Since(started).Milliseconds(),
+		Optional:  check.Optional,
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// ServeHTTP answers the readiness probe: 200 when ready, 503 when not, with the report
+// either way
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	if !report.Ready {
+		common.WriteSuccessResponse(w, http.StatusServiceUnavailable, common.SuccessCodeOK, report)
+		return
+	}
+	common.WriteOKResponse(w, report)
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantCode   int
+		wantStatus string
+	}{
+		{"all up", []Check{{Name: "s3", Ping: up}, {Name: "dynamodb", Ping: up}}, http.StatusOK, StatusHealthy},
+		{"required down", []Check{{Name: "s3", Ping: up}, {Name: "dynamodb", Ping: down}}, http.StatusServiceUnavailable, StatusDegraded},
+		{"optional down", []Check{{Name: "file-service", Ping: up}, {Name: "file-service-canary", Optional: true, Ping: down}}, http.StatusOK, StatusDegraded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewChecker("test", tt.checks...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			var resp struct {
+				Data Report `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data.Status != tt.wantStatus || len(resp.Data.Dependencies) != len(tt.checks) {
+				t.Errorf("report %+v, want %s with %d dependencies", resp.Data, tt.wantStatus, len(tt.checks))
+			}
+			for i, dependency := range resp.Data.Dependencies {
+				if dependency.Name != tt.checks[i].Name {
+					t.Errorf("dependency %d is %s, want %s", i, dependency.Name, tt.checks[i].Name)
+				}
+				if (dependency.Status == StatusDown) != (dependency.Error != "") {
+					t.Errorf("%s is %s with error %q", dependency.Name, dependency.Status, dependency.Error)
+				}
+			}
+		})
+	}
+}
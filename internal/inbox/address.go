@@ -0,0 +1,53 @@
+// Package inbox is upload by email: the address each user can send attachments to, the
+// senders they accept mail from, and reading attachments out of a message. The file
+// service shows users their address and keeps their allowlist; the mail ingest service
+// delivers what arrives.
+package inbox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+)
+
+// tagLength is how many characters of the address tag are kept: 80 bits, too many to guess
+const tagLength = 16
+
+var tagEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Address is the address mail for userID's inbox is sent to: the user ID and a tag signed
+// with secret, at domain. Only someone who has seen the address can send to it, and the
+// ingest service can check an address without looking anything up.
+func Address(secret []byte, domain, userID string) string {
+	return userID + "." + tag(secret, userID) + "@" + strings.ToLower(domain)
+}
+
+// ParseAddress returns the user an inbox address belongs to, or false if it isn't one at
+// domain with a valid tag. A "+" suffix on the local part is ignored.
+func ParseAddress(secret []byte, domain, address string) (string, bool) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || !strings.EqualFold(address[at+1:], domain) {
+		return "", false
+	}
+	local := strings.ToLower(address[:at])
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	dot := strings.LastIndex(local, ".")
+	if dot <= 0 {
+		return "", false
+	}
+	userID, given := local[:dot], local[dot+1:]
+	if !hmac.Equal([]byte(given), []byte(tag(secret, userID))) {
+		return "", false
+	}
+	return userID, true
+}
+
+// tag signs userID with secret, in lower case so mail servers that fold case keep it valid
+func tag(secret []byte, userID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(userID))
+	return strings.ToLower(tagEncoding.EncodeToString(mac.Sum(nil)))[:tagLength]
+}
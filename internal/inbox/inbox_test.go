@@ -0,0 +1,124 @@
+package inbox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	secret := []byte("test-secret")
+	userID := "c303e4d6-eed4-4526-8e08-6dcf1e196681"
+	address := Address(secret, "Inbox.Example.com", userID)
+	if !strings.HasPrefix(address, userID+".") || !strings.HasSuffix(address, "@inbox.example.com") {
+		t.Fatalf("Address = %q", address)
+	}
+
+	local := address[:strings.Index(address, "@")]
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address, true},
+		{strings.ToUpper(local) + "@INBOX.EXAMPLE.COM", true},
+		{local + "+receipts@inbox.example.com", true},
+		{local + "@other.example.com", false},
+		{userID + ".aaaaaaaaaaaaaaaa@inbox.example.com", false},
+		{"d303e4d6-eed4-4526-8e08-6dcf1e196681" + local[len(userID):] + "@inbox.example.com", false},
+		{"no-tag@inbox.example.com", false},
+		{"inbox.example.com", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseAddress(secret, "inbox.example.com", tt.address)
+		if ok != tt.want || (ok && got != userID) {
+			t.Errorf("ParseAddress(%q) = %q, %v; want %v", tt.address, got, ok, tt.want)
+		}
+	}
+	if _, ok := ParseAddress([]byte("other-secret"), "inbox.example.com", address); ok {
+		t.Error("address accepted with another secret")
+	}
+}
+
+func TestSenders(t *testing.T) {
+	senders, err := NormalizeSenders([]string{" Alice@Example.com", "@Partner.example.org", "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(senders, ",") != "alice@example.com,@partner.example.org" {
+		t.Errorf("NormalizeSenders = %v", senders)
+	}
+	for _, bad := range []string{"not an address", "@localhost", "@bad_domain.com", "Alice <alice@example.com>"} {
+		if _, err := NormalizeSenders([]string{bad}); err == nil {
+			t.Errorf("NormalizeSenders(%q): want an error", bad)
+		}
+	}
+
+	for sender, want := range map[string]bool{
+		"ALICE@example.com":           true,
+		"bob@partner.example.org":     true,
+		"bob@example.com":             false,
+		"bob@sub.partner.example.org": false,
+		"nobody":                      false,
+	} {
+		if got := Allowed(senders, sender); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", sender, got, want)
+		}
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: Alice <alice@example.com>",
+		"Subject: Files",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="inner"`,
+		"",
+		"--inner",
+		"Content-Type: text/plain",
+		"",
+		"See attached.",
+		"--inner",
+		"Content-Type: text/html",
+		"",
+		"<p>See attached.</p>",
+		"--inner--",
+		"--outer",
+		`Content-Type: application/pdf; name="ignored.pdf"`,
+		`Content-Disposition: attachment; filename="../report.pdf"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0x",
+		"LjQK",
+		"--outer",
+		`Content-Type: text/plain; name="=?UTF-8?Q?caf=C3=A9.txt?="`,
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"caf=C3=A9",
+		"--outer",
+		`Content-Type: application/octet-stream`,
+		`Content-Disposition: attachment; filename="big.bin"`,
+		"",
+		"0123456789abcdef",
+		"--outer--",
+		"",
+	}, "\r\n")
+
+	attachments, skipped, err := Attachments(strings.NewReader(raw), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 2 {
+		t.Fatalf("got %d attachments, want 2: %+v", len(attachments), attachments)
+	}
+	if got := attachments[0]; got.Filename != "report.pdf" || got.ContentType != "application/pdf" || string(got.Content) != "%PDF-1.4\n" {
+		t.Errorf("first attachment = %q %q %q", got.Filename, got.ContentType, got.Content)
+	}
+	if got := attachments[1]; got.Filename != "café.txt" || string(got.Content) != "café" {
+		t.Errorf("second attachment = %q %q", got.Filename, got.Content)
+	}
+	if len(skipped) != 1 || skipped[0] != "big.bin" {
+		t.Errorf("skipped = %v, want [big.bin]", skipped)
+	}
+}
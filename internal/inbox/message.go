@@ -0,0 +1,123 @@
+package inbox
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+// maxDepth caps how deeply multipart bodies can nest
+const maxDepth = 10
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string // As the sender labelled it
+	Content     []byte
+}
+
+// header is what a message's and a part's headers have in common
+type header interface {
+	Get(key string) string
+}
+
+// Attachments reads the attachments out of a raw MIME message. A part is an attachment
+// if its disposition says so or it has a filename. Attachments larger than maxSize are
+// left out, and their filenames returned as skipped.
+func Attachments(raw io.Reader, maxSize int64) (attachments []Attachment, skipped []string, err error) {
+	message, err := mail.ReadMessage(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid message: %w", err)
+	}
+	walker := &partWalker{maxSize: maxSize}
+	if err := walker.walk(message.Header, message.Body, 0); err != nil {
+		return nil, nil, err
+	}
+	return walker.attachments, walker.skipped, nil
+}
+
+type partWalker struct {
+	maxSize     int64
+	attachments []Attachment
+	skipped     []string
+}
+
+func (w *partWalker) walk(h header, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxDepth {
+			return errors.New("invalid message: multipart nested too deeply")
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid message: %w", err)
+			}
+			if err := w.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename == "" && disposition != "attachment" {
+		return nil // The message text
+	}
+	filename = cleanFilename(filename)
+
+	content, err := io.ReadAll(io.LimitReader(decode(h.Get("Content-Transfer-Encoding"), body), w.maxSize+1))
+	if err != nil {
+		return fmt.Errorf("invalid attachment %q: %w", filename, err)
+	}
+	if int64(len(content)) > w.maxSize {
+		w.skipped = append(w.skipped, filename)
+		return nil
+	}
+	w.attachments = append(w.attachments, Attachment{Filename: filename, ContentType: mediaType, Content: content})
+	return nil
+}
+
+// decode undoes a part's transfer encoding
+func decode(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// cleanFilename decodes an encoded-word filename and drops any path the sender gave it
+func cleanFilename(filename string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	if slash := strings.LastIndexAny(filename, `/\`); slash >= 0 {
+		filename = filename[slash+1:]
+	}
+	filename = strings.TrimSpace(filename)
+	if filename == "" || filename == "." || filename == ".." {
+		return "attachment"
+	}
+	return filename
+}
@@ -0,0 +1,70 @@
+package inbox
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// MaxSenders caps how many entries a user's allowlist can have
+const MaxSenders = 100
+
+// NormalizeSenders checks and tidies an allowlist. Each entry is an email address, or a
+// domain written "@example.com" to accept everyone there. Entries are lower-cased and
+// duplicates dropped, keeping the first.
+func NormalizeSenders(entries []string) ([]string, error) {
+	if len(entries) > MaxSenders {
+		return nil, fmt.Errorf("at most %d senders can be allowed", MaxSenders)
+	}
+	normalized := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if strings.HasPrefix(entry, "@") {
+			if !validDomain(entry[1:]) {
+				return nil, fmt.Errorf("%q is not a valid domain", entry)
+			}
+		} else if parsed, err := mail.ParseAddress(entry); err != nil || parsed.Address != entry {
+			return nil, fmt.Errorf("%q is not an email address or @domain", entry)
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			normalized = append(normalized, entry)
+		}
+	}
+	return normalized, nil
+}
+
+// validDomain reports whether domain looks like a host name with at least two labels
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Allowed reports whether sender, an email address, is on allowlist
+func Allowed(allowlist []string, sender string) bool {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	at := strings.LastIndex(sender, "@")
+	if at < 0 {
+		return false
+	}
+	for _, entry := range allowlist {
+		if entry == sender || entry == sender[at:] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+// Package integration holds end-to-end tests that run the file service handlers
+// against LocalStack S3 and DynamoDB. They are excluded from the default build:
+//
+//	go test -tags=integration ./internal/integration
+//
+// A LocalStack container is started with testcontainers (Docker required), or set
+// LOCALSTACK_ENDPOINT to reuse one that is already running. Set
+// INTEGRATION_METADATA_BACKEND=postgres to keep metadata in PostgreSQL instead of DynamoDB.
+package integration
@@ -0,0 +1,259 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+// newUser registers a fresh account and returns a client authenticated as it
+func newUser(t *testing.T) *vibedrop.Client {
+	t.Helper()
+	client := vibedrop.NewClient(fileService.URL)
+	name := fmt.Sprintf("it-%d", time.Now().UnixNano())
+	if _, err := client.Register(context.Background(), name, name+"@example.com", "Integration-Test1!"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	return client
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// downloadAndCompare fetches a file through its presigned URL and checks the content
+func downloadAndCompare(t *testing.T, client *vibedrop.Client, fileID string, want []byte) {
+	t.Helper()
+	ctx := context.Background()
+
+	link, err := client.DownloadURL(ctx, fileID)
+	if err != nil {
+		t.Fatalf("download url: %v", err)
+	}
+	var got bytes.Buffer
+	if _, err := client.DownloadPresigned(ctx, link.URL, 0, &got, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatalf("downloaded %d bytes that differ from the %d uploaded", got.Len(), len(want))
+	}
+}
+
+// deleteAndConfirm deletes a file and checks its metadata is gone
+func deleteAndConfirm(t *testing.T, client *vibedrop.Client, fileID string) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := client.DeleteFile(ctx, fileID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, err := client.GetFile(ctx, fileID)
+	var apiErr *vibedrop.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("get after delete: got %v, want 404", err)
+	}
+}
+
+func TestSingleUploadFlow(t *testing.T) {
+	ctx := context.Background()
+	client := newUser(t)
+	data := randomBytes(t, 256*1024)
+
+	upload, err := client.RequestUpload(ctx, "notes.txt", int64(len(data)))
+	if err != nil {
+		t.Fatalf("request upload: %v", err)
+	}
+	if upload.UploadType != "single" {
+		t.Fatalf("upload type = %q, want single", upload.UploadType)
+	}
+
+	if _, err := client.PutPresigned(ctx, upload.URL, bytes.NewReader(data), int64(len(data)), nil); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+
+	file, err := client.GetFile(ctx, upload.FileID)
+	if err != nil {
+		t.Fatalf("get metadata: %v", err)
+	}
+	if file.Filename != "notes.txt" || file.Size != int64(len(data)) {
+		t.Errorf("metadata = %+v, want notes.txt with size %d", file, len(data))
+	}
+
+	files, err := client.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	found := false
+	for _, f := range files {
+		found = found || f.ID == upload.FileID
+	}
+	if !found {
+		t.Errorf("uploaded file %s missing from list", upload.FileID)
+	}
+
+	downloadAndCompare(t, client, upload.FileID, data)
+	deleteAndConfirm(t, client, upload.FileID)
+}
+
+func TestMultipartUploadFlow(t *testing.T) {
+	ctx := context.Background()
+	client := newUser(t)
+
+	// Declaring exactly the multipart threshold yields a single chunk; as the last
+	// (only) part it may be smaller than S3's 5MB minimum, so a small body suffices
+	const declaredSize = 5 * 1024 * 1024 * 1024
+	data := randomBytes(t, 1024*1024)
+
+	upload, err := client.RequestUpload(ctx, "video.mp4", declaredSize)
+	if err != nil {
+		t.Fatalf("request upload: %v", err)
+	}
+	if upload.UploadType != "multipart" || len(upload.Chunks) != 1 {
+		t.Fatalf("got %s upload with %d chunks, want multipart with 1", upload.UploadType, len(upload.Chunks))
+	}
+
+	// Resuming hands out a fresh URL for the chunk that hasn't been uploaded yet
+	resume, err := client.UploadStatus(ctx, upload.FileID)
+	if err != nil {
+		t.Fatalf("upload status: %v", err)
+	}
+	if len(resume.RemainingURLs) != 1 || resume.BytesConfirmed != 0 {
+		t.Fatalf("upload status = %+v, want 1 remaining URL and nothing confirmed", resume)
+	}
+
+	chunk := resume.RemainingURLs[0]
+	etag, err := client.PutPresigned(ctx, chunk.URL, bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatalf("put chunk: %v", err)
+	}
+
+	status, err := client.CompleteChunk(ctx, upload.FileID, chunk.ChunkNumber, etag)
+	if err != nil {
+		t.Fatalf("complete chunk: %v", err)
+	}
+	if !status.UploadComplete {
+		t.Fatalf("upload_complete = false after the only chunk was reported")
+	}
+
+	if err := client.CompleteUpload(ctx, upload.FileID); err != nil {
+		t.Fatalf("complete upload: %v", err)
+	}
+
+	downloadAndCompare(t, client, upload.FileID, data)
+	deleteAndConfirm(t, client, upload.FileID)
+}
+
+func TestReadOnlyTokenCannotUpload(t *testing.T) {
+	ctx := context.Background()
+	client := newUser(t)
+
+	token, err := client.CreateToken(ctx, []string{"files:read"}, time.Hour)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	readOnly := vibedrop.NewClient(fileService.URL, vibedrop.WithToken(token.Token))
+
+	if _, err := readOnly.ListFiles(ctx); err != nil {
+		t.Fatalf("list with read-only token: %v", err)
+	}
+
+	_, err = readOnly.RequestUpload(ctx, "blocked.txt", 10)
+	var apiErr *vibedrop.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("upload with read-only token: got %v, want 403", err)
+	}
+}
+
+func TestFilesAreScopedToOwner(t *testing.T) {
+	ctx := context.Background()
+	owner := newUser(t)
+	other := newUser(t)
+	data := randomBytes(t, 1024)
+
+	upload, err := owner.RequestUpload(ctx, "private.txt", int64(len(data)))
+	if err != nil {
+		t.Fatalf("request upload: %v", err)
+	}
+	if _, err := owner.PutPresigned(ctx, upload.URL, bytes.NewReader(data), int64(len(data)), nil); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+
+	files, err := other.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	for _, f := range files {
+		if f.ID == upload.FileID {
+			t.Errorf("another user's list includes file %s", upload.FileID)
+		}
+	}
+
+	var apiErr *vibedrop.APIError
+	if _, err := other.GetFile(ctx, upload.FileID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("get as another user: got %v, want 404", err)
+	}
+	if _, err := other.DownloadURL(ctx, upload.FileID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("download url as another user: got %v, want 404", err)
+	}
+	if err := other.DeleteFile(ctx, upload.FileID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("delete as another user: got %v, want 404", err)
+	}
+
+	downloadAndCompare(t, owner, upload.FileID, data)
+	deleteAndConfirm(t, owner, upload.FileID)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	client := newUser(t)
+	original := client.RefreshToken()
+
+	if _, err := client.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if client.RefreshToken() == original {
+		t.Fatal("refresh returned the same refresh token")
+	}
+	if _, err := client.ListFiles(ctx); err != nil {
+		t.Fatalf("list with refreshed token: %v", err)
+	}
+
+	// Replaying the used token is rejected and ends the session
+	replay := vibedrop.NewClient(fileService.URL, vibedrop.WithRefreshToken(original))
+	var apiErr *vibedrop.APIError
+	if _, err := replay.Refresh(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh: got %v, want 401", err)
+	}
+	if _, err := client.Refresh(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("refresh after replay: got %v, want 401", err)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	client := newUser(t)
+	refreshToken := client.RefreshToken()
+
+	if err := client.Logout(ctx); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	loggedOut := vibedrop.NewClient(fileService.URL, vibedrop.WithRefreshToken(refreshToken))
+	var apiErr *vibedrop.APIError
+	if _, err := loggedOut.Refresh(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: got %v, want 401", err)
+	}
+}
@@ -0,0 +1,309 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/fileservice/config"
+	"vibe-drop/internal/fileservice/routes"
+	"vibe-drop/internal/fileservice/storage"
+)
+
+const (
+	localstackImage = "localstack/localstack:3"
+	postgresImage   = "postgres:16"
+	testRegion      = "us-east-1"
+	testBucket      = "vibe-drop-integration"
+)
+
+// fileService is the file service router under test, backed by LocalStack
+var fileService *httptest.Server
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	endpoint := os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		container, err := startLocalStack(ctx)
+		if err != nil {
+			log.Printf("Failed to start LocalStack: %v", err)
+			return 1
+		}
+		defer container.Terminate(ctx)
+
+		endpoint, err = container.PortEndpoint(ctx, "4566/tcp", "http")
+		if err != nil {
+			log.Printf("Failed to resolve LocalStack endpoint: %v", err)
+			return 1
+		}
+	}
+
+	if err := bootstrap(ctx, endpoint); err != nil {
+		log.Printf("Failed to bootstrap LocalStack: %v", err)
+		return 1
+	}
+
+	s3Client, err := storage.NewS3Client(testBucket, testRegion, endpoint, storage.Timeouts{}, storage.AssumeRole{})
+	if err != nil {
+		log.Printf("Failed to create S3 client: %v", err)
+		return 1
+	}
+	metadataStore, stop, err := newMetadataStore(ctx, endpoint)
+	if err != nil {
+		log.Printf("Failed to create metadata store: %v", err)
+		return 1
+	}
+	defer stop()
+
+	cfg := &config.Config{
+		S3Bucket:          testBucket,
+		S3Region:          testRegion,
+		S3Endpoint:        endpoint,
+		DynamoEndpoint:    endpoint,
+		DynamoRegion:      testRegion,
+		Environment:       "dev",
+		AnalyticsInterval: time.Hour,
+		StuckUploadAfter:  24 * time.Hour,
+		StorageQuotaBytes: 1024 * 1024 * 1024,
+		AccessTokenTTL:    15 * time.Minute,
+		RefreshTokenTTL:   24 * time.Hour,
+		JWTSecret:         auth.DevelopmentSecret,
+	}
+	fileService = httptest.NewServer(routes.SetupRoutes(cfg, s3Client, metadataStore, nil, nil))
+	defer fileService.Close()
+
+	return m.Run()
+}
+
+func startLocalStack(ctx context.Context) (testcontainers.Container, error) {
+	return testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        localstackImage,
+			ExposedPorts: []string{"4566/tcp"},
+			Env:          map[string]string{"SERVICES": "s3,dynamodb"},
+			WaitingFor: wait.ForHTTP("/_localstack/health").
+				WithPort("4566/tcp").
+				WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+}
+
+// newMetadataStore returns the metadata store the suite runs against: LocalStack's
+// DynamoDB, or PostgreSQL when INTEGRATION_METADATA_BACKEND is postgres. POSTGRES_DSN
+// reuses a running database; otherwise a container is started. stop cleans it up.
+func newMetadataStore(ctx context.Context, endpoint string) (storage.MetadataStore, func(), error) {
+	if os.Getenv("INTEGRATION_METADATA_BACKEND") != storage.MetadataBackendPostgres {
+		store, err := storage.NewDynamoClient(testRegion, endpoint, storage.Timeouts{}, storage.AssumeRole{})
+		return store, func() {}, err
+	}
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	stop := func() {}
+	if dsn == "" {
+		container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+			ContainerRequest: testcontainers.ContainerRequest{
+				Image:        postgresImage,
+				ExposedPorts: []string{"5432/tcp"},
+				Env:          map[string]string{"POSTGRES_USER": "vibedrop", "POSTGRES_PASSWORD": "vibedrop"},
+				WaitingFor: wait.ForListeningPort("5432/tcp").
+					WithStartupTimeout(time.Minute),
+			},
+			Started: true,
+		})
+		if err != nil {
+			return nil, stop, fmt.Errorf("failed to start PostgreSQL: %w", err)
+		}
+		stop = func() { container.Terminate(ctx) }
+
+		hostPort, err := container.PortEndpoint(ctx, "5432/tcp", "")
+		if err != nil {
+			return nil, stop, err
+		}
+		dsn = "postgres://vibedrop:vibedrop@" + hostPort + "/vibedrop?sslmode=disable"
+	}
+
+	// The server accepts connections briefly before it finishes initializing
+	var store *storage.PostgresClient
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		if store, err = storage.NewPostgresClient(dsn); err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return nil, stop, err
+	}
+	return store, stop, nil
+}
+
+// bootstrap creates the bucket and the tables the file service expects,
+// mirroring the setup steps in the README
+func bootstrap(ctx context.Context, endpoint string) error {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(testRegion),
+		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
+	)
+	if err != nil {
+		return err
+	}
+
+	s3Client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = true
+	})
+	if _, err := s3Client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(testBucket)}); err != nil {
+		var owned *s3types.BucketAlreadyOwnedByYou
+		if !errors.As(err, &owned) {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+	}
+
+	dynamo := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+	for _, table := range tables() {
+		if _, err := dynamo.CreateTable(ctx, table); err != nil {
+			var inUse *types.ResourceInUseException
+			if !errors.As(err, &inUse) {
+				return fmt.Errorf("create table %s: %w", aws.ToString(table.TableName), err)
+			}
+		}
+	}
+	return nil
+}
+
+func tables() []*dynamodb.CreateTableInput {
+	hashKey := func(name string, attrType types.ScalarAttributeType) ([]types.AttributeDefinition, []types.KeySchemaElement) {
+		return []types.AttributeDefinition{{AttributeName: aws.String(name), AttributeType: attrType}},
+			[]types.KeySchemaElement{{AttributeName: aws.String(name), KeyType: types.KeyTypeHash}}
+	}
+
+	filesAttrs, filesKey := hashKey("fileID", types.ScalarAttributeTypeS)
+	analyticsAttrs, analyticsKey := hashKey("userID", types.ScalarAttributeTypeS)
+	usersAttrs, usersKey := hashKey("userID", types.ScalarAttributeTypeS)
+	locksAttrs, locksKey := hashKey("lockName", types.ScalarAttributeTypeS)
+	usageAttrs, usageKey := hashKey("userID", types.ScalarAttributeTypeS)
+	refreshAttrs, refreshKey := hashKey("tokenHash", types.ScalarAttributeTypeS)
+	transfersAttrs, transfersKey := hashKey("transferID", types.ScalarAttributeTypeS)
+	outboxAttrs, outboxKey := hashKey("entryID", types.ScalarAttributeTypeS)
+
+	return []*dynamodb.CreateTableInput{
+		{
+			TableName: aws.String("vibe-drop-files"),
+			AttributeDefinitions: append(filesAttrs,
+				types.AttributeDefinition{AttributeName: aws.String("userID"), AttributeType: types.ScalarAttributeTypeS},
+				types.AttributeDefinition{AttributeName: aws.String("uploadedAt"), AttributeType: types.ScalarAttributeTypeS}),
+			KeySchema: filesKey,
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+				IndexName: aws.String("user-uploaded-index"),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("userID"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("uploadedAt"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			}},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+		{
+			TableName: aws.String("vibe-drop-chunks"),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String("fileID"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("chunkNumber"), AttributeType: types.ScalarAttributeTypeN},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("fileID"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("chunkNumber"), KeyType: types.KeyTypeRange},
+			},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-users"),
+			AttributeDefinitions: append(usersAttrs, types.AttributeDefinition{AttributeName: aws.String("email"), AttributeType: types.ScalarAttributeTypeS}),
+			KeySchema:            usersKey,
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+				IndexName:  aws.String("email-index"),
+				KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String("email"), KeyType: types.KeyTypeHash}},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			}},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-analytics"),
+			AttributeDefinitions: analyticsAttrs,
+			KeySchema:            analyticsKey,
+			BillingMode:          types.BillingModePayPerRequest,
+		},
+		{
+			TableName: aws.String("vibe-drop-url-audit"),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String("fileID"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("urlID"), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("fileID"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("urlID"), KeyType: types.KeyTypeRange},
+			},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-usage"),
+			AttributeDefinitions: usageAttrs,
+			KeySchema:            usageKey,
+			BillingMode:          types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-refresh-tokens"),
+			AttributeDefinitions: append(refreshAttrs, types.AttributeDefinition{AttributeName: aws.String("familyID"), AttributeType: types.ScalarAttributeTypeS}),
+			KeySchema:            refreshKey,
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+				IndexName:  aws.String("family-index"),
+				KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String("familyID"), KeyType: types.KeyTypeHash}},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			}},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-transfers"),
+			AttributeDefinitions: transfersAttrs,
+			KeySchema:            transfersKey,
+			BillingMode:          types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-outbox"),
+			AttributeDefinitions: outboxAttrs,
+			KeySchema:            outboxKey,
+			BillingMode:          types.BillingModePayPerRequest,
+		},
+		{
+			TableName:            aws.String("vibe-drop-locks"),
+			AttributeDefinitions: locksAttrs,
+			KeySchema:            locksKey,
+			BillingMode:          types.BillingModePayPerRequest,
+		},
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"vibe-drop/internal/auth"
+)
+
+type Config struct {
+	Environment string // dev, staging, prod
+
+	// The SQS queue SES receipt notifications arrive on, directly or through SNS, and
+	// the AWS endpoints to reach it and the S3 bucket SES stores messages in (for LocalStack)
+	QueueURL    string
+	AWSRegion   string
+	SQSEndpoint string
+	S3Endpoint  string
+
+	// Incoming mail is delivered through the public API at APIURL, as the recipient
+	APIURL string
+
+	// Inbox addresses, as on the file service
+	InboxDomain        string
+	InboxAddressSecret string
+
+	// Mail is only delivered from senders SES authenticated (DMARC, or SPF or DKIM)
+	RequireSenderAuth bool
+
+	MaxAttachmentBytes int64         // Larger attachments are skipped
+	DeliveryTimeout    time.Duration // Longest one message's delivery may take
+
+	// Signing the short-lived tokens deliveries are made with, as on the file service
+	JWTSecret      string
+	JWTKeys        []auth.SigningKey
+	JWTPrivateKeys []auth.PrivateKey
+	JWTIssuer      string
+
+	LogLevel string // Least severe level logged: debug, info, warn or error
+}
+
+func Load() *Config {
+	// Load .env file if it exists (ignore errors for production)
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found or error loading .env file: %v", err)
+	}
+
+	env := getEnv("ENVIRONMENT", "dev")
+	cfg := &Config{
+		Environment: env,
+
+		QueueURL:    os.Getenv("INGEST_QUEUE_URL"),
+		AWSRegion:   getEnv("INGEST_AWS_REGION", "us-east-1"),
+		SQSEndpoint: os.Getenv("INGEST_SQS_ENDPOINT"),
+		S3Endpoint:  os.Getenv("INGEST_S3_ENDPOINT"),
+
+		APIURL: getEnv("INGEST_API_URL", "http://localhost:8080"),
+
+		InboxDomain:        os.Getenv("INBOX_DOMAIN"),
+		InboxAddressSecret: os.Getenv("INBOX_ADDRESS_SECRET"),
+
+		RequireSenderAuth: getBoolEnv("INGEST_REQUIRE_SENDER_AUTH", true),
+
+		MaxAttachmentBytes: getInt64Env("INGEST_MAX_ATTACHMENT_SIZE", 25*1024*1024),
+		DeliveryTimeout:    getDurationEnv("INGEST_DELIVERY_TIMEOUT", 5*time.Minute),
+
+		JWTSecret:      os.Getenv("JWT_SECRET"),
+		JWTKeys:        getSigningKeysEnv("JWT_KEYS"),
+		JWTPrivateKeys: getPrivateKeysEnv("JWT_PRIVATE_KEYS"),
+		JWTIssuer:      os.Getenv("JWT_ISSUER"),
+
+		LogLevel: getEnv("LOG_LEVEL", "info"),
+	}
+	if cfg.JWTSecret == "" && len(cfg.JWTKeys) == 0 && len(cfg.JWTPrivateKeys) == 0 {
+		cfg.JWTSecret = auth.DevelopmentSecret
+	}
+
+	validateConfig(cfg)
+	return cfg
+}
+
+// JWT is how delivery tokens are signed. They are scoped, and set their own expiry.
+func (c *Config) JWT() auth.JWTConfig {
+	return auth.JWTConfig{Secret: c.JWTSecret, Keys: c.JWTKeys, Issuer: c.JWTIssuer, PrivateKeys: c.JWTPrivateKeys}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid value for %s: must be a positive duration", key)
+	}
+	return duration
+}
+
+func getInt64Env(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 {
+		log.Fatalf("Invalid value for %s: must be a positive integer", key)
+	}
+	return n
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid value for %s: must be true or false", key)
+	}
+	return b
+}
+
+// getSigningKeysEnv reads JWT signing keys written as comma-separated id:secret pairs
+func getSigningKeysEnv(key string) []auth.SigningKey {
+	keys, err := auth.ParseSigningKeys(os.Getenv(key))
+	if err != nil {
+		log.Fatalf("Invalid value for %s: %v", key, err)
+	}
+	return keys
+}
+
+// getPrivateKeysEnv reads RS256 and ES256 signing keys as comma-separated id:path pairs
+func getPrivateKeysEnv(key string) []auth.PrivateKey {
+	keys, err := auth.ParsePrivateKeys(os.Getenv(key))
+	if err != nil {
+		log.Fatalf("Invalid value for %s: %v", key, err)
+	}
+	return keys
+}
+
+func validateConfig(cfg *Config) {
+	var errors []string
+
+	if cfg.QueueURL == "" {
+		errors = append(errors, "INGEST_QUEUE_URL must be set")
+	}
+
+	if cfg.InboxDomain == "" || cfg.InboxAddressSecret == "" {
+		errors = append(errors, "INBOX_DOMAIN and INBOX_ADDRESS_SECRET must be set, as on the file service")
+	}
+
+	if cfg.Environment != "dev" && cfg.JWTSecret == auth.DevelopmentSecret {
+		errors = append(errors, "JWT_SECRET, JWT_KEYS or JWT_PRIVATE_KEYS must be set to a key of your own outside dev")
+	}
+
+	if cfg.Environment != "dev" && !strings.HasPrefix(cfg.APIURL, "https://") {
+		errors = append(errors, "INGEST_API_URL should use https:// outside dev")
+	}
+
+	if len(errors) > 0 {
+		log.Fatalf("Configuration validation failed:\n%s", strings.Join(errors, "\n"))
+	}
+}
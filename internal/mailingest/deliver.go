@@ -0,0 +1,90 @@
+package mailingest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/inbox"
+	"vibe-drop/pkg/vibedrop"
+)
+
+// deliveryTokenExpiry is the lifetime of the token minted for each API call made for a user
+const deliveryTokenExpiry = 5 * time.Minute
+
+// APIDeliverer calls the public API as the recipient, with a short-lived token limited
+// to their files, so emailed files get the same quota, content type and scanning checks
+// as any upload
+type APIDeliverer struct {
+	apiURL     string
+	jwt        *auth.JWTService
+	httpClient *http.Client
+}
+
+// NewAPIDeliverer creates a deliverer that calls the API at apiURL with tokens signed by jwt
+func NewAPIDeliverer(apiURL string, jwt *auth.JWTService) *APIDeliverer {
+	return &APIDeliverer{apiURL: apiURL, jwt: jwt, httpClient: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+func (d *APIDeliverer) client(userID string) (*vibedrop.Client, error) {
+	token, err := d.jwt.GenerateScopedToken(userID, "mail-ingest", []string{auth.ScopeFilesRead, auth.ScopeFilesWrite}, deliveryTokenExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign delivery token: %w", err)
+	}
+	return vibedrop.NewClient(d.apiURL, vibedrop.WithToken(token), vibedrop.WithHTTPClient(d.httpClient),
+		vibedrop.WithClientInfo("vibedrop-mailingest", "1")), nil
+}
+
+func (d *APIDeliverer) AllowedSenders(ctx context.Context, userID string) ([]string, error) {
+	client, err := d.client(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := client.Inbox(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return settings.AllowedSenders, nil
+}
+
+// Deliver uploads the attachment and tags it folder=inbox, with email_from the sender
+func (d *APIDeliverer) Deliver(ctx context.Context, userID, sender string, attachment inbox.Attachment) error {
+	client, err := d.client(userID)
+	if err != nil {
+		return err
+	}
+	size := int64(len(attachment.Content))
+	upload, err := client.RequestUpload(ctx, attachment.Filename, size)
+	if err != nil {
+		return err
+	}
+
+	if upload.UploadType == "multipart" {
+		var offset int64
+		for _, chunk := range upload.Chunks {
+			if chunk.Size < 0 || offset+chunk.Size > size {
+				return fmt.Errorf("upload %s has chunks past the end of the file", upload.FileID)
+			}
+			part := attachment.Content[offset : offset+chunk.Size]
+			etag, err := client.PutPresigned(ctx, chunk.URL, bytes.NewReader(part), chunk.Size, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := client.CompleteChunk(ctx, upload.FileID, chunk.ChunkNumber, etag); err != nil {
+				return err
+			}
+			offset += chunk.Size
+		}
+		if err := client.CompleteUpload(ctx, upload.FileID); err != nil {
+			return err
+		}
+	} else if _, err := client.PutPresignedWithHeaders(ctx, upload.URL, upload.UploadHeaders, bytes.NewReader(attachment.Content), size, nil); err != nil {
+		return err
+	}
+
+	_, err = client.SetTags(ctx, upload.FileID, map[string]string{"folder": "inbox", "email_from": sender})
+	return err
+}
@@ -0,0 +1,154 @@
+// Package mailingest delivers files emailed to users' inbox addresses. SES receives the
+// mail and posts a receipt notification to SQS (directly or through SNS); each attachment
+// on a message from an allowed sender is uploaded into the recipient's files through the
+// public API, so it goes through the same checks as any other upload.
+package mailingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"vibe-drop/internal/inbox"
+	"vibe-drop/pkg/vibedrop"
+)
+
+// Fetcher reads messages SES stored in S3
+type Fetcher interface {
+	Fetch(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// Deliverer acts for a user on their files
+type Deliverer interface {
+	// AllowedSenders is the user's inbox allowlist
+	AllowedSenders(ctx context.Context, userID string) ([]string, error)
+	// Deliver stores an attachment among the user's files, noting who sent it
+	Deliver(ctx context.Context, userID, sender string, attachment inbox.Attachment) error
+}
+
+// Processor handles receipt notifications
+type Processor struct {
+	Fetcher   Fetcher
+	Deliverer Deliverer
+
+	Domain            string
+	AddressSecret     []byte
+	MaxAttachmentSize int64
+	RequireSenderAuth bool
+}
+
+// Process handles one notification. It returns nil once the message is dealt with,
+// delivered or turned away, and an error only if it should be tried again later.
+func (p *Processor) Process(ctx context.Context, body string) error {
+	n, err := parseNotification(body)
+	if err != nil {
+		slog.Warn("Dropping unreadable notification", "error", err)
+		return nil
+	}
+	logger := slog.With("message_id", n.Mail.MessageID)
+
+	if n.Receipt.SpamVerdict.is("FAIL") || n.Receipt.VirusVerdict.is("FAIL") {
+		logger.Info("Rejected mail flagged as spam or a virus", "spam", n.Receipt.SpamVerdict.Status, "virus", n.Receipt.VirusVerdict.Status)
+		return nil
+	}
+	sender := n.sender()
+	if p.RequireSenderAuth && !n.authenticated() {
+		logger.Info("Rejected mail from an unauthenticated sender", "sender", sender,
+			"spf", n.Receipt.SPFVerdict.Status, "dkim", n.Receipt.DKIMVerdict.Status, "dmarc", n.Receipt.DMARCVerdict.Status)
+		return nil
+	}
+
+	var recipients []string
+	for _, recipient := range n.Receipt.Recipients {
+		if userID, ok := inbox.ParseAddress(p.AddressSecret, p.Domain, recipient); ok {
+			recipients = append(recipients, userID)
+		}
+	}
+	if len(recipients) == 0 {
+		logger.Info("Rejected mail to no valid inbox address", "recipients", len(n.Receipt.Recipients))
+		return nil
+	}
+
+	var raw []byte
+	if n.Receipt.Action.Type == "S3" {
+		if raw, err = p.fetch(ctx, n.Receipt.Action.BucketName, n.Receipt.Action.ObjectKey); err != nil {
+			return err
+		}
+	} else if raw, err = n.inlineContent(); err != nil {
+		logger.Warn("Dropping notification without a message", "error", err)
+		return nil
+	}
+	attachments, skipped, err := inbox.Attachments(bytes.NewReader(raw), p.MaxAttachmentSize)
+	if err != nil {
+		logger.Warn("Rejected unreadable mail", "error", err)
+		return nil
+	}
+	if len(skipped) > 0 {
+		logger.Info("Skipped attachments over the size limit", "skipped", len(skipped), "limit", p.MaxAttachmentSize)
+	}
+
+	for _, userID := range recipients {
+		if err := p.deliver(ctx, logger.With("user_id", userID), userID, sender, attachments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver stores the attachments for one recipient, if the sender is on their allowlist
+func (p *Processor) deliver(ctx context.Context, logger *slog.Logger, userID, sender string, attachments []inbox.Attachment) error {
+	allowed, err := p.Deliverer.AllowedSenders(ctx, userID)
+	if err != nil {
+		if permanent(err) {
+			logger.Info("Rejected mail for an inbox that can't take it", "error", err)
+			return nil
+		}
+		return fmt.Errorf("failed to load allowed senders: %w", err)
+	}
+	if !inbox.Allowed(allowed, sender) {
+		logger.Info("Rejected mail from a sender not on the allowlist", "sender", sender)
+		return nil
+	}
+
+	delivered := 0
+	for _, attachment := range attachments {
+		err := p.Deliverer.Deliver(ctx, userID, sender, attachment)
+		if err != nil && !permanent(err) {
+			return fmt.Errorf("failed to deliver %q: %w", attachment.Filename, err)
+		}
+		if err != nil {
+			// Refused by the API, e.g. over quota or a disallowed content type
+			logger.Info("Attachment refused", "filename", attachment.Filename, "error", err)
+			continue
+		}
+		delivered++
+	}
+	logger.Info("Delivered emailed files", "sender", sender, "delivered", delivered, "attachments", len(attachments))
+	return nil
+}
+
+// fetch reads a message SES stored in S3
+func (p *Processor) fetch(ctx context.Context, bucket, key string) ([]byte, error) {
+	object, err := p.Fetcher.Fetch(ctx, bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message from S3: %w", err)
+	}
+	defer object.Close()
+	content, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message from S3: %w", err)
+	}
+	return content, nil
+}
+
+// permanent reports whether the API refused a request for good; other failures, such
+// as server errors, rate limits and network trouble, may succeed on a retry
+func permanent(err error) bool {
+	var apiErr *vibedrop.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != http.StatusTooManyRequests
+}
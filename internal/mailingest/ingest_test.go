@@ -0,0 +1,201 @@
+package mailingest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"vibe-drop/internal/inbox"
+	"vibe-drop/pkg/vibedrop"
+)
+
+var testSecret = []byte("test-secret")
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"Subject: Files\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Two files.\r\n" +
+	"--b\r\n" +
+	"Content-Disposition: attachment; filename=\"a.txt\"\r\n" +
+	"\r\n" +
+	"first\r\n" +
+	"--b\r\n" +
+	"Content-Disposition: attachment; filename=\"b.exe\"\r\n" +
+	"\r\n" +
+	"second\r\n" +
+	"--b--\r\n"
+
+type fakeFetcher struct{ objects map[string]string }
+
+func (f *fakeFetcher) Fetch(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	content, ok := f.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("no such object")
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+type fakeDeliverer struct {
+	allowed   map[string][]string
+	refuse    map[string]error // By filename
+	delivered []string         // userID/filename from sender
+}
+
+func (d *fakeDeliverer) AllowedSenders(ctx context.Context, userID string) ([]string, error) {
+	allowed, ok := d.allowed[userID]
+	if !ok {
+		return nil, &vibedrop.APIError{StatusCode: 404}
+	}
+	return allowed, nil
+}
+
+func (d *fakeDeliverer) Deliver(ctx context.Context, userID, sender string, attachment inbox.Attachment) error {
+	if err := d.refuse[attachment.Filename]; err != nil {
+		return err
+	}
+	d.delivered = append(d.delivered, userID+"/"+attachment.Filename+" from "+sender)
+	return nil
+}
+
+// testNotification is an SNS-action notification for testMessage, edited by change
+func testNotification(t *testing.T, change func(n map[string]interface{})) string {
+	n := map[string]interface{}{
+		"notificationType": "Received",
+		"mail": map[string]interface{}{
+			"messageId":     "m1",
+			"source":        "bounce@example.com",
+			"commonHeaders": map[string]interface{}{"from": []string{"Alice <Alice@Example.com>"}},
+		},
+		"receipt": map[string]interface{}{
+			"recipients":   []string{inbox.Address(testSecret, "in.example.com", "user-1")},
+			"spamVerdict":  map[string]string{"status": "PASS"},
+			"virusVerdict": map[string]string{"status": "PASS"},
+			"spfVerdict":   map[string]string{"status": "PASS"},
+			"dkimVerdict":  map[string]string{"status": "GRAY"},
+			"dmarcVerdict": map[string]string{"status": "GRAY"},
+			"action":       map[string]string{"type": "SNS", "encoding": "BASE64"},
+		},
+		"content": base64.StdEncoding.EncodeToString([]byte(testMessage)),
+	}
+	if change != nil {
+		change(n)
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func newTestProcessor() (*Processor, *fakeDeliverer) {
+	deliverer := &fakeDeliverer{allowed: map[string][]string{"user-1": {"alice@example.com"}}}
+	return &Processor{
+		Fetcher:           &fakeFetcher{objects: map[string]string{"mail/m1": testMessage}},
+		Deliverer:         deliverer,
+		Domain:            "in.example.com",
+		AddressSecret:     testSecret,
+		MaxAttachmentSize: 1024,
+		RequireSenderAuth: true,
+	}, deliverer
+}
+
+func receipt(n map[string]interface{}) map[string]interface{} {
+	return n["receipt"].(map[string]interface{})
+}
+
+func TestProcessDelivers(t *testing.T) {
+	// Inline, through an SNS envelope, and from S3
+	inline := testNotification(t, nil)
+	envelope, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": inline})
+	stored := testNotification(t, func(n map[string]interface{}) {
+		receipt(n)["action"] = map[string]string{"type": "S3", "bucketName": "mail", "objectKey": "m1"}
+		delete(n, "content")
+	})
+
+	for name, body := range map[string]string{"inline": inline, "sns": string(envelope), "s3": stored} {
+		p, deliverer := newTestProcessor()
+		if err := p.Process(context.Background(), body); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := "user-1/a.txt from alice@example.com,user-1/b.exe from alice@example.com"
+		if got := strings.Join(deliverer.delivered, ","); got != want {
+			t.Errorf("%s: delivered %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := map[string]func(n map[string]interface{}){
+		"spam": func(n map[string]interface{}) {
+			receipt(n)["spamVerdict"] = map[string]string{"status": "FAIL"}
+		},
+		"unauthenticated": func(n map[string]interface{}) {
+			receipt(n)["spfVerdict"] = map[string]string{"status": "FAIL"}
+		},
+		"dmarc fail": func(n map[string]interface{}) {
+			receipt(n)["dmarcVerdict"] = map[string]string{"status": "FAIL"}
+		},
+		"forged address": func(n map[string]interface{}) {
+			receipt(n)["recipients"] = []string{"user-1.aaaaaaaaaaaaaaaa@in.example.com"}
+		},
+		"unknown inbox": func(n map[string]interface{}) {
+			receipt(n)["recipients"] = []string{inbox.Address(testSecret, "in.example.com", "user-2")}
+		},
+		"sender not allowed": func(n map[string]interface{}) {
+			n["mail"].(map[string]interface{})["commonHeaders"] = map[string]interface{}{"from": []string{"mallory@example.com"}}
+		},
+	}
+	for name, change := range tests {
+		p, deliverer := newTestProcessor()
+		if err := p.Process(context.Background(), testNotification(t, change)); err != nil {
+			t.Errorf("%s: want the message dropped, got %v", name, err)
+		}
+		if len(deliverer.delivered) != 0 {
+			t.Errorf("%s: delivered %v", name, deliverer.delivered)
+		}
+	}
+
+	p, _ := newTestProcessor()
+	if err := p.Process(context.Background(), "not json"); err != nil {
+		t.Errorf("unreadable notification: want it dropped, got %v", err)
+	}
+}
+
+func TestProcessFailures(t *testing.T) {
+	// A refused attachment is skipped; the rest are still delivered
+	p, deliverer := newTestProcessor()
+	deliverer.refuse = map[string]error{"b.exe": &vibedrop.APIError{StatusCode: 400, Code: "CONTENT_TYPE_NOT_ALLOWED"}}
+	if err := p.Process(context.Background(), testNotification(t, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliverer.delivered) != 1 {
+		t.Errorf("delivered %v, want only a.txt", deliverer.delivered)
+	}
+
+	// Rate limits, server errors and network trouble are retried
+	for _, err := range []error{&vibedrop.APIError{StatusCode: 429}, &vibedrop.APIError{StatusCode: 503}, errors.New("connection refused")} {
+		p, deliverer := newTestProcessor()
+		deliverer.refuse = map[string]error{"a.txt": err}
+		if got := p.Process(context.Background(), testNotification(t, nil)); got == nil {
+			t.Errorf("%v: want a retryable error", err)
+		}
+	}
+
+	// As is a message S3 can't return yet
+	p, _ = newTestProcessor()
+	missing := testNotification(t, func(n map[string]interface{}) {
+		receipt(n)["action"] = map[string]string{"type": "S3", "bucketName": "mail", "objectKey": "missing"}
+	})
+	if err := p.Process(context.Background(), missing); err == nil {
+		t.Error("missing S3 object: want a retryable error")
+	}
+}
@@ -0,0 +1,106 @@
+package mailingest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// notification is the SES receipt notification for one incoming message. SES either
+// stored the message in S3 (an S3 action) or sent it along inline (an SNS action).
+type notification struct {
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		MessageID     string `json:"messageId"`
+		Source        string `json:"source"` // The envelope sender
+		CommonHeaders struct {
+			From    []string `json:"from"`
+			Subject string   `json:"subject"`
+		} `json:"commonHeaders"`
+	} `json:"mail"`
+	Receipt struct {
+		Recipients   []string `json:"recipients"`
+		SpamVerdict  verdict  `json:"spamVerdict"`
+		VirusVerdict verdict  `json:"virusVerdict"`
+		SPFVerdict   verdict  `json:"spfVerdict"`
+		DKIMVerdict  verdict  `json:"dkimVerdict"`
+		DMARCVerdict verdict  `json:"dmarcVerdict"`
+		Action       struct {
+			Type       string `json:"type"` // S3 or SNS
+			BucketName string `json:"bucketName"`
+			ObjectKey  string `json:"objectKey"`
+			Encoding   string `json:"encoding"` // UTF8 or BASE64, for SNS
+		} `json:"action"`
+	} `json:"receipt"`
+	Content string `json:"content"` // The raw message, for SNS
+}
+
+type verdict struct {
+	Status string `json:"status"` // PASS, FAIL, GRAY or PROCESSING_FAILED
+}
+
+func (v verdict) is(status string) bool {
+	return strings.EqualFold(v.Status, status)
+}
+
+// snsEnvelope wraps notifications that came through an SNS topic without raw delivery
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// parseNotification reads an SQS message body, unwrapping the SNS envelope if there is one
+func parseNotification(body string) (*notification, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err == nil && envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var n notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+	if n.NotificationType != "Received" {
+		return nil, fmt.Errorf("unexpected notification type %q", n.NotificationType)
+	}
+	return &n, nil
+}
+
+// sender is the address in the From header, the one DMARC aligns with; the envelope
+// sender if there is no usable From header
+func (n *notification) sender() string {
+	for _, from := range n.Mail.CommonHeaders.From {
+		if address, err := mail.ParseAddress(from); err == nil {
+			return strings.ToLower(address.Address)
+		}
+	}
+	return strings.ToLower(n.Mail.Source)
+}
+
+// authenticated reports whether SES vouched for the sender: DMARC passed, or no DMARC
+// policy failed and SPF or DKIM passed
+func (n *notification) authenticated() bool {
+	r := n.Receipt
+	if r.DMARCVerdict.is("PASS") {
+		return true
+	}
+	return !r.DMARCVerdict.is("FAIL") && (r.DKIMVerdict.is("PASS") || r.SPFVerdict.is("PASS"))
+}
+
+// inlineContent is the raw message of a notification from an SNS action
+func (n *notification) inlineContent() ([]byte, error) {
+	if n.Content == "" {
+		return nil, errors.New("notification has no message content")
+	}
+	if strings.EqualFold(n.Receipt.Action.Encoding, "BASE64") {
+		content, err := base64.StdEncoding.DecodeString(n.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		return content, nil
+	}
+	return []byte(n.Content), nil
+}
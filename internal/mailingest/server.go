@@ -0,0 +1,160 @@
+package mailingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"vibe-drop/internal/auth"
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/mailingest/config"
+)
+
+const (
+	receiveWait    = 20              // Seconds a receive long-polls for
+	receiveBatch   = 10              // Most messages handled per receive
+	receiveBackoff = 5 * time.Second // Pause after a failed receive
+)
+
+var stopPolling context.CancelFunc
+var polling sync.WaitGroup
+
+// Start polls the queue until Stop is called
+func Start() {
+	cfg := config.Load()
+	if err := common.SetupLogging("vibe-drop-mailingest", cfg.LogLevel); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	awsCfg, err := awsConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	queue := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.SQSEndpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.SQSEndpoint)
+		}
+	})
+	objects := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.S3Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	processor := &Processor{
+		Fetcher:           &S3Fetcher{client: objects},
+		Deliverer:         NewAPIDeliverer(cfg.APIURL, auth.NewJWTServiceFromConfig(cfg.JWT())),
+		Domain:            cfg.InboxDomain,
+		AddressSecret:     []byte(cfg.InboxAddressSecret),
+		MaxAttachmentSize: cfg.MaxAttachmentBytes,
+		RequireSenderAuth: cfg.RequireSenderAuth,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopPolling = cancel
+	polling.Add(1)
+	defer polling.Done()
+
+	log.Printf("Mail ingest polling %s...", cfg.QueueURL)
+	poll(ctx, queue, cfg.QueueURL, processor, cfg.DeliveryTimeout)
+}
+
+// Stop finishes the messages in hand and stops polling
+func Stop() {
+	if stopPolling == nil {
+		return
+	}
+	log.Println("Shutting down mail ingest...")
+	stopPolling()
+
+	done := make(chan struct{})
+	go func() {
+		polling.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("Mail ingest stopped gracefully")
+	case <-time.After(30 * time.Second):
+		log.Println("Mail ingest stopped with deliveries in progress; their messages will be received again")
+	}
+}
+
+// poll receives notifications and deletes each one Process is done with. Messages it fails
+// on reappear once their visibility timeout lapses, so delivery is at least once.
+func poll(ctx context.Context, queue *sqs.Client, queueURL string, processor *Processor, timeout time.Duration) {
+	for ctx.Err() == nil {
+		out, err := queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: receiveBatch,
+			WaitTimeSeconds:     receiveWait,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("Failed to receive from the mail queue", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(receiveBackoff):
+			}
+			continue
+		}
+
+		for _, message := range out.Messages {
+			// A delivery in progress finishes even if Stop is called
+			deliveryCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+			err := processor.Process(deliveryCtx, aws.ToString(message.Body))
+			cancel()
+			if err != nil {
+				slog.Warn("Mail delivery failed; it will be retried", "message_id", aws.ToString(message.MessageId), "error", err)
+				continue
+			}
+			_, err = queue.DeleteMessage(context.WithoutCancel(ctx), &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(queueURL),
+				ReceiptHandle: message.ReceiptHandle,
+			})
+			if err != nil {
+				slog.Error("Failed to delete handled mail notification", "message_id", aws.ToString(message.MessageId), "error", err)
+			}
+		}
+	}
+}
+
+// awsConfig signs with LocalStack's fake credentials when an endpoint is set, and with
+// the default credential chain (environment, instance or task role) otherwise
+func awsConfig(cfg *config.Config) (aws.Config, error) {
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.AWSRegion)}
+	if cfg.SQSEndpoint != "" || cfg.S3Endpoint != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")))
+	}
+	return awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+}
+
+// S3Fetcher reads messages SES stored in S3
+type S3Fetcher struct {
+	client *s3.Client
+}
+
+func (f *S3Fetcher) Fetch(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if bucket == "" || key == "" {
+		return nil, errors.New("notification names no S3 object")
+	}
+	out, err := f.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+	}
+	return out.Body, nil
+}
@@ -0,0 +1,345 @@
+// Package registry is the one list of the API's routes and what each one requires. The
+// gateway and file service routers are built from it, the gateway middleware reads rate
+// tiers and deprecations from it, and openapi.json is checked against it (see CheckSpec).
+package registry
+
+import (
+	"strings"
+	"time"
+
+	"vibe-drop/internal/auth"
+)
+
+// Auth is what a caller must present to use a route
+type Auth string
+
+const (
+	AuthNone       Auth = "none"        // Public
+	AuthUser       Auth = "user"        // A JWT or API key carrying the route's Scope
+	AuthFullAccess Auth = "full-access" // A login token; scoped tokens are refused
+	AuthAPIKey     Auth = "api-key"     // An X-API-Key
+	AuthAdmin      Auth = "admin"       // The operator's X-Admin-Key, or an admin's login token
+)
+
+// RateTier is the per-IP rate limit the gateway applies to a route
+type RateTier string
+
+const (
+	TierStandard    RateTier = "standard"    // The default limit
+	TierCredentials RateTier = "credentials" // Tighter, for routes that check a password
+	TierExempt      RateTier = "exempt"      // Not limited: health checks and the spec
+)
+
+// UserLimit is the class of route a per-user rate limit applies to, when the gateway
+// limits authenticated requests by user rather than by IP
+type UserLimit string
+
+const (
+	LimitDefault  UserLimit = ""         // Routes in no other class
+	LimitAuth     UserLimit = "auth"     // Signing in, refreshing and issuing tokens
+	LimitUpload   UserLimit = "upload"   // Starting, resuming, completing and aborting uploads
+	LimitDownload UserLimit = "download" // Issuing download URLs
+)
+
+// Deprecation schedules a route for removal. It keeps working; the gateway marks its
+// responses deprecated and points at the successor.
+type Deprecation struct {
+	Deprecated time.Time // When the route was deprecated
+	Sunset     time.Time // When it will be removed; zero until that is decided
+	Successor  string    // Path template to use instead, with the same variables
+}
+
+// Route is one operation of the API
+type Route struct {
+	Name        string // The operation's operationId in openapi.json
+	Method      string
+	Path        string // Gateway path template, e.g. "/files/{id}"
+	ServicePath string // File service path template; empty if the gateway serves the route itself
+	Auth        Auth
+	Scope       string // The scope an AuthUser route needs (auth.Scope*)
+	RateTier    RateTier
+	UserLimit   UserLimit
+	Deprecation *Deprecation
+	Summary     string // The operation's summary in openapi.json
+}
+
+// Key identifies a route by method and gateway path template, e.g. "GET /files/{id}"
+func (r Route) Key() string {
+	return r.Method + " " + r.Path
+}
+
+// ServiceURL fills the file service path template with the request's path variables. The
+// templates may name variables differently but list them in the same order.
+func (r Route) ServiceURL(vars map[string]string) string {
+	names := pathVariables(r.Path)
+	serviceVars := make(map[string]string)
+	for i, name := range pathVariables(r.ServicePath) {
+		if i < len(names) {
+			serviceVars[name] = vars[names[i]]
+		}
+	}
+	return r.FillServicePath(serviceVars)
+}
+
+// FillServicePath fills the file service path template with variables named as in it
+func (r Route) FillServicePath(vars map[string]string) string {
+	url := r.ServicePath
+	for _, name := range pathVariables(r.ServicePath) {
+		if value, ok := vars[name]; ok {
+			url = strings.Replace(url, "{"+name+"}", value, 1)
+		}
+	}
+	return url
+}
+
+// MatchService returns the served route (see Served) a request to the file service is
+// for, with the path's variables named as in the route's service path
+func MatchService(method, path string) (Route, map[string]string, bool) {
+	segments := strings.Split(path, "/")
+	for _, route := range Served() {
+		if route.Method != method {
+			continue
+		}
+		if vars, ok := matchTemplate(route.ServicePath, segments); ok {
+			return route, vars, true
+		}
+	}
+	return Route{}, nil, false
+}
+
+// matchTemplate matches a path, split at its slashes, against a path template
+func matchTemplate(template string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(template, "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			if segments[i] == "" {
+				return nil, false
+			}
+			vars[part[1:len(part)-1]] = segments[i]
+		case part != segments[i]:
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// pathVariables returns the variable names in a path template, in order
+func pathVariables(template string) []string {
+	var names []string
+	for _, segment := range strings.Split(template, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, segment[1:len(segment)-1])
+		}
+	}
+	return names
+}
+
+// Lookup returns the route with the given key (see Route.Key)
+func Lookup(key string) (Route, bool) {
+	for _, route := range Routes {
+		if route.Key() == key {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// Served returns the routes the file service serves, once per method and service path. A
+// deprecated alias of a route is left out, since the service serves it as the successor.
+func Served() []Route {
+	current := make(map[string]bool)
+	for _, route := range Routes {
+		if route.Deprecation == nil {
+			current[route.Method+" "+route.ServicePath] = true
+		}
+	}
+	var served []Route
+	for _, route := range Routes {
+		if route.ServicePath == "" || (route.Deprecation != nil && current[route.Method+" "+route.ServicePath]) {
+			continue
+		}
+		served = append(served, route)
+	}
+	return served
+}
+
+// deprecatedOn is when the pre-"-url" upload and download routes were deprecated
+var deprecatedOn = time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+
+// Routes is every route of the API. Routers register them in this order, so a fixed path
+// must come before a variable one it would otherwise match (e.g. /files/recent before
+// /files/{id}). Add new routes here and to openapi.json; CheckSpec keeps the two in step.
+var Routes = []Route{
+	// System
+	{Name: "getHealth", Method: "GET", Path: "/health", Auth: AuthNone, RateTier: TierExempt,
+		Summary: "Health check for the API Gateway"},
+	{Name: "getLiveness", Method: "GET", Path: "/health/live", Auth: AuthNone, RateTier: TierExempt,
+		Summary: "Liveness probe: the gateway is serving"},
+	{Name: "getReadiness", Method: "GET", Path: "/health/ready", Auth: AuthNone, RateTier: TierExempt,
+		Summary: "Readiness probe: the gateway can reach the file service"},
+	{Name: "getAPISpec", Method: "GET", Path: "/openapi.json", Auth: AuthNone, RateTier: TierExempt,
+		Summary: "This OpenAPI document"},
+	{Name: "getJWKS", Method: "GET", Path: "/.well-known/jwks.json", ServicePath: "/.well-known/jwks.json", Auth: AuthNone, RateTier: TierExempt,
+		Summary: "Public keys that verify RS256 and ES256 access tokens"},
+
+	// Authentication
+	{Name: "register", Method: "POST", Path: "/auth/register", ServicePath: "/auth/register", Auth: AuthNone, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Register a new user account"},
+	{Name: "login", Method: "POST", Path: "/auth/login", ServicePath: "/auth/login", Auth: AuthNone, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Log in and receive a JWT"},
+	{Name: "refreshToken", Method: "POST", Path: "/auth/refresh", ServicePath: "/auth/refresh", Auth: AuthNone, RateTier: TierStandard, UserLimit: LimitAuth,
+		Summary: "Exchange a refresh token for a new access token and refresh token"},
+	{Name: "logout", Method: "POST", Path: "/auth/logout", ServicePath: "/auth/logout", Auth: AuthNone, RateTier: TierStandard, UserLimit: LimitAuth,
+		Summary: "Revoke a refresh token"},
+	{Name: "createScopedToken", Method: "POST", Path: "/auth/tokens", ServicePath: "/auth/tokens", Auth: AuthFullAccess, RateTier: TierStandard, UserLimit: LimitAuth,
+		Summary: "Issue a scoped token for integrations"},
+	{Name: "enrollTOTP", Method: "POST", Path: "/auth/2fa/enroll", ServicePath: "/auth/2fa/enroll", Auth: AuthFullAccess, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Start two-factor enrollment with a new TOTP secret"},
+	{Name: "verifyTOTP", Method: "POST", Path: "/auth/2fa/verify", ServicePath: "/auth/2fa/verify", Auth: AuthFullAccess, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Confirm two-factor enrollment with a TOTP code"},
+	{Name: "disableTOTP", Method: "POST", Path: "/auth/2fa/disable", ServicePath: "/auth/2fa/disable", Auth: AuthFullAccess, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Turn off two-factor authentication"},
+	{Name: "getAPIKeyUsage", Method: "GET", Path: "/api-keys/me/usage", Auth: AuthAPIKey, RateTier: TierStandard,
+		Summary: "Daily and monthly request quota usage for the calling API key"},
+	{Name: "getS3Credentials", Method: "GET", Path: "/api-keys/me/s3", Auth: AuthAPIKey, RateTier: TierStandard,
+		Summary: "S3 credentials and an rclone remote for the calling API key"},
+	{Name: "getUploadCallback", Method: "GET", Path: "/api-keys/me/callback", ServicePath: "/api-keys/me/callback", Auth: AuthAPIKey, RateTier: TierStandard,
+		Summary: "The URL the calling API key's completed uploads are reported to"},
+	{Name: "setUploadCallback", Method: "PUT", Path: "/api-keys/me/callback", ServicePath: "/api-keys/me/callback", Auth: AuthAPIKey, RateTier: TierStandard,
+		Summary: "Register a URL for the calling API key's completed uploads, getting a new signing secret"},
+	{Name: "deleteUploadCallback", Method: "DELETE", Path: "/api-keys/me/callback", ServicePath: "/api-keys/me/callback", Auth: AuthAPIKey, RateTier: TierStandard,
+		Summary: "Stop reporting the calling API key's completed uploads"},
+
+	// Files
+	{Name: "listFiles", Method: "GET", Path: "/files", ServicePath: "/files", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "List the user's files"},
+	{Name: "createUploadLegacy", Method: "POST", Path: "/files", ServicePath: "/files/upload-url", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Deprecation: &Deprecation{Deprecated: deprecatedOn, Successor: "/files/upload-url"},
+		Summary:     "Get presigned URL(s) for upload (use /files/upload-url)"},
+	{Name: "createUploadURL", Method: "POST", Path: "/files/upload-url", ServicePath: "/files/upload-url", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Get presigned URL(s) for a file upload"},
+	{Name: "listRecentFiles", Method: "GET", Path: "/files/recent", ServicePath: "/files/recent", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "List the most recently accessed files"},
+	{Name: "searchFiles", Method: "GET", Path: "/files/search", ServicePath: "/files/search", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "Search files by name, content type, size and upload time"},
+	{Name: "checkFileExists", Method: "POST", Path: "/files/exists", ServicePath: "/files/exists", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "Check whether the user already stores content with a given checksum and size"},
+	{Name: "getFile", Method: "GET", Path: "/files/{id}", ServicePath: "/files/{id}", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "Get file metadata"},
+	{Name: "updateFileTags", Method: "PUT", Path: "/files/{id}/tags", ServicePath: "/files/{id}/tags", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard,
+		Summary: "Replace a file's tags"},
+	{Name: "getDownloadURLLegacy", Method: "GET", Path: "/files/{id}/download", ServicePath: "/files/{id}/download-url", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard, UserLimit: LimitDownload,
+		Deprecation: &Deprecation{Deprecated: deprecatedOn, Successor: "/files/{id}/download-url"},
+		Summary:     "Get a presigned download URL (use /files/{id}/download-url)"},
+	{Name: "getDownloadURL", Method: "GET", Path: "/files/{id}/download-url", ServicePath: "/files/{id}/download-url", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard, UserLimit: LimitDownload,
+		Summary: "Get a presigned download URL"},
+	{Name: "getFileParts", Method: "GET", Path: "/files/{id}/parts", ServicePath: "/files/{fileId}/parts", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard, UserLimit: LimitDownload,
+		Summary: "Offset, size and SHA-256 of each part of a file, for parallel ranged downloads"},
+	{Name: "listChunks", Method: "GET", Path: "/files/{id}/chunks", ServicePath: "/files/{fileId}/chunks", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Status, size and ETag of each chunk of a multipart upload"},
+	{Name: "getUploadEvents", Method: "GET", Path: "/files/{id}/events", ServicePath: "/files/{fileId}/events", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "A multipart upload's progress, as a snapshot or an event stream of chunk completions"},
+	{Name: "getUploadStatus", Method: "GET", Path: "/files/{id}/upload-status", ServicePath: "/files/{fileId}/upload-status", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Resume a multipart upload: chunk statuses and new URLs for the chunks not yet uploaded"},
+	{Name: "refreshChunkURL", Method: "POST", Path: "/files/{id}/chunks/{chunkNumber}/refresh-url", ServicePath: "/files/{fileId}/chunks/{chunkNumber}/refresh-url", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Issue a new presigned URL for a chunk not yet uploaded"},
+	{Name: "completeChunk", Method: "POST", Path: "/files/{id}/chunks/{chunkNumber}/complete", ServicePath: "/files/{fileId}/chunks/{chunkNumber}/complete", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Mark a multipart chunk as uploaded"},
+	{Name: "completeUpload", Method: "POST", Path: "/files/{id}/complete", ServicePath: "/files/{fileId}/complete", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Complete a multipart upload"},
+	{Name: "abortUpload", Method: "DELETE", Path: "/files/{id}/upload", ServicePath: "/files/{fileId}/upload", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Abort an in-progress multipart upload"},
+	{Name: "getBlockManifest", Method: "GET", Path: "/files/{id}/blocks", ServicePath: "/files/{fileId}/blocks", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "Rolling and SHA-256 checksums of each block of a file, for planning a delta upload"},
+	{Name: "createDeltaUpload", Method: "POST", Path: "/files/{id}/delta", ServicePath: "/files/{fileId}/delta", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Start a new version of a file that reuses its unchanged blocks and uploads only the changed bytes"},
+	{Name: "deleteFile", Method: "DELETE", Path: "/files/{id}", ServicePath: "/files/{id}", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard,
+		Summary: "Delete a file and its metadata"},
+	{Name: "batchDeleteFiles", Method: "POST", Path: "/files/batch-delete", ServicePath: "/files/batch-delete", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard,
+		Summary: "Delete up to 1000 files at once, reporting each file"},
+
+	// Users
+	{Name: "getCurrentUser", Method: "GET", Path: "/users/me", ServicePath: "/users/me", Auth: AuthFullAccess, RateTier: TierStandard,
+		Summary: "Get the current user's account"},
+	{Name: "updateCurrentUser", Method: "PUT", Path: "/users/me", ServicePath: "/users/me", Auth: AuthFullAccess, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Change the current user's username, or start a change of email address"},
+	{Name: "deleteCurrentUser", Method: "DELETE", Path: "/users/me", ServicePath: "/users/me", Auth: AuthFullAccess, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Delete the current user's account and all their files"},
+	{Name: "verifyEmail", Method: "POST", Path: "/users/me/email/verify", ServicePath: "/users/me/email/verify", Auth: AuthFullAccess, RateTier: TierCredentials, UserLimit: LimitAuth,
+		Summary: "Confirm a change of email address with the token sent to it"},
+	{Name: "getUserAnalytics", Method: "GET", Path: "/users/me/analytics", ServicePath: "/users/me/analytics", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "Storage breakdown by content type, size and growth"},
+	{Name: "listUploadNotices", Method: "GET", Path: "/users/me/upload-notices", ServicePath: "/users/me/upload-notices", Auth: AuthUser, Scope: auth.ScopeFilesWrite, RateTier: TierStandard, UserLimit: LimitUpload,
+		Summary: "Uploads in progress that are taking long or have stalled, as a list or an event stream"},
+	{Name: "getUserUsage", Method: "GET", Path: "/users/me/usage", ServicePath: "/users/me/usage", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "Storage used against the user's quota"},
+	{Name: "getInbox", Method: "GET", Path: "/users/me/inbox", ServicePath: "/users/me/inbox", Auth: AuthUser, Scope: auth.ScopeFilesRead, RateTier: TierStandard,
+		Summary: "The address files can be emailed to and who may send them"},
+	{Name: "setInboxSenders", Method: "PUT", Path: "/users/me/inbox/senders", ServicePath: "/users/me/inbox/senders", Auth: AuthFullAccess, RateTier: TierStandard,
+		Summary: "Replace who may email files into the user's inbox"},
+	{Name: "getUserProfile", Method: "GET", Path: "/users/{id}", Auth: AuthUser, RateTier: TierStandard,
+		Summary: "Get a user profile (not yet implemented)"},
+	{Name: "updateUserProfile", Method: "PUT", Path: "/users/{id}", Auth: AuthUser, RateTier: TierStandard,
+		Summary: "Update a user profile (not yet implemented)"},
+
+	// Admin
+	{Name: "getAdminMetrics", Method: "GET", Path: "/admin/metrics", ServicePath: "/admin/metrics", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Operational metrics across all users"},
+	{Name: "getClientVersions", Method: "GET", Path: "/admin/client-versions", ServicePath: "/admin/client-versions", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Client versions behind recent uploads"},
+	{Name: "redriveUpload", Method: "POST", Path: "/admin/files/{id}/redrive", ServicePath: "/admin/files/{fileId}/redrive", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Re-drive a stuck multipart upload"},
+	{Name: "listIssuedURLs", Method: "GET", Path: "/admin/files/{id}/urls", ServicePath: "/admin/files/{fileId}/urls", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "List the presigned URLs issued for a file"},
+	{Name: "revokeFileURLs", Method: "POST", Path: "/admin/files/{id}/revoke-urls", ServicePath: "/admin/files/{fileId}/revoke-urls", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Revoke a file's outstanding presigned URLs by moving it to a new key"},
+	{Name: "releaseQuarantinedFile", Method: "POST", Path: "/admin/files/{id}/release", ServicePath: "/admin/files/{fileId}/release", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Release a quarantined file so its owner can download it again"},
+	{Name: "processS3Events", Method: "POST", Path: "/admin/s3-events", ServicePath: "/admin/s3-events", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Correlate S3 object-created events with background uploads to enforce their single-use URLs"},
+	{Name: "getReconciliationReport", Method: "GET", Path: "/admin/reconciliation", ServicePath: "/admin/reconciliation", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Latest S3/DynamoDB reconciliation report"},
+	{Name: "runReconciliation", Method: "POST", Path: "/admin/reconciliation", ServicePath: "/admin/reconciliation", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Run an S3/DynamoDB reconciliation now"},
+	{Name: "listAnomalies", Method: "GET", Path: "/admin/anomalies", ServicePath: "/admin/anomalies", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "List anomaly locks and recent detections"},
+	{Name: "unlockUser", Method: "DELETE", Path: "/admin/anomalies/locks/{id}", ServicePath: "/admin/anomalies/locks/{userId}", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Lift a user's anomaly lock"},
+	{Name: "unlockLogin", Method: "DELETE", Path: "/admin/login-locks/{id}", ServicePath: "/admin/login-locks/{userId}", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Lift the lock on a user's account after repeated failed sign-ins"},
+	{Name: "createOwnershipTransfer", Method: "POST", Path: "/admin/transfers", ServicePath: "/admin/transfers", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Queue a transfer of files from one user to another"},
+	{Name: "getOwnershipTransfer", Method: "GET", Path: "/admin/transfers/{id}", ServicePath: "/admin/transfers/{transferId}", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Get an ownership transfer and its progress"},
+	{Name: "getContentTypePolicy", Method: "GET", Path: "/admin/content-type-policy", ServicePath: "/admin/content-type-policy", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Get the content type policy uploads are checked against"},
+	{Name: "setContentTypePolicy", Method: "PUT", Path: "/admin/content-type-policy", ServicePath: "/admin/content-type-policy", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Replace the configured content type policy"},
+	{Name: "resetContentTypePolicy", Method: "DELETE", Path: "/admin/content-type-policy", ServicePath: "/admin/content-type-policy", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Go back to the configured content type policy"},
+	{Name: "listUsers", Method: "GET", Path: "/admin/users", ServicePath: "/admin/users", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "List every account"},
+	{Name: "getUserFilesAdmin", Method: "GET", Path: "/admin/users/{id}/files", ServicePath: "/admin/users/{userId}/files", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "List any user's files"},
+	{Name: "getUserUsageAdmin", Method: "GET", Path: "/admin/users/{id}/usage", ServicePath: "/admin/users/{userId}/usage", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Storage used against any user's quota"},
+	{Name: "suspendUser", Method: "PUT", Path: "/admin/users/{id}/suspension", ServicePath: "/admin/users/{userId}/suspension", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Suspend an account so it can't sign in"},
+	{Name: "unsuspendUser", Method: "DELETE", Path: "/admin/users/{id}/suspension", ServicePath: "/admin/users/{userId}/suspension", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Lift an account's suspension"},
+	{Name: "setUserRole", Method: "PUT", Path: "/admin/users/{id}/role", ServicePath: "/admin/users/{userId}/role", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Change a user's role"},
+	{Name: "forceDeleteFile", Method: "DELETE", Path: "/admin/files/{id}", ServicePath: "/admin/files/{fileId}", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Delete any user's file, whatever its status"},
+	{Name: "getBackendStatus", Method: "GET", Path: "/admin/backend", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Show the file service the gateway routes to"},
+	{Name: "switchBackend", Method: "PUT", Path: "/admin/backend", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Switch the gateway to another file service, draining the current one"},
+	{Name: "getRateLimitStatus", Method: "GET", Path: "/admin/rate-limits", Auth: AuthAdmin, RateTier: TierStandard,
+		Summary: "Show how many clients the gateway's rate limiters are tracking"},
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	"vibe-drop/internal/apigateway/openapi"
+	"vibe-drop/internal/codegen"
+)
+
+func TestSpecMatchesRegistry(t *testing.T) {
+	doc, err := codegen.Parse(openapi.Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSpec(doc); err != nil {
+		t.Errorf("openapi.json and the route registry disagree:\n%v", err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for _, route := range Routes {
+		if names[route.Name] || keys[route.Key()] {
+			t.Errorf("%s (%s) is registered twice", route.Key(), route.Name)
+		}
+		names[route.Name], keys[route.Key()] = true, true
+
+		if route.ServicePath != "" && len(pathVariables(route.ServicePath)) != len(pathVariables(route.Path)) {
+			t.Errorf("%s has different path variables from its service path %s", route.Key(), route.ServicePath)
+		}
+		if route.Auth == AuthUser && route.ServicePath != "" && route.Scope == "" {
+			t.Errorf("%s needs a user but no scope", route.Key())
+		}
+		if route.RateTier == "" {
+			t.Errorf("%s has no rate tier", route.Key())
+		}
+	}
+}
+
+func TestServiceURL(t *testing.T) {
+	route, ok := Lookup("POST /files/{id}/chunks/{chunkNumber}/complete")
+	if !ok {
+		t.Fatal("route not registered")
+	}
+	got := route.ServiceURL(map[string]string{"id": "file-1", "chunkNumber": "3"})
+	if want := "/files/file-1/chunks/3/complete"; got != want {
+		t.Errorf("ServiceURL = %q, want %q", got, want)
+	}
+
+	served := make(map[string]string)
+	for _, route := range Served() {
+		served[route.Method+" "+route.ServicePath] = route.Name
+	}
+	if served["POST /files/upload-url"] != "createUploadURL" || served["GET /files/{id}/download-url"] != "getDownloadURL" {
+		t.Errorf("Served() = %v, want deprecated aliases left to their successors", served)
+	}
+}
+
+func TestMatchService(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+		vars         map[string]string
+	}{
+		{"POST", "/files/file-1/chunks/3/complete", "completeChunk", map[string]string{"fileId": "file-1", "chunkNumber": "3"}},
+		{"GET", "/files/recent", "listRecentFiles", map[string]string{}},
+		{"GET", "/files/search", "searchFiles", map[string]string{}},
+		{"GET", "/files/file-1", "getFile", map[string]string{"id": "file-1"}},
+		{"PUT", "/files/file-1/tags", "updateFileTags", map[string]string{"id": "file-1"}},
+		{"POST", "/files/upload-url", "createUploadURL", map[string]string{}},
+		{"DELETE", "/files/recent/chunks", "", nil},
+		{"GET", "/health", "", nil},
+	}
+	for _, tt := range tests {
+		route, vars, ok := MatchService(tt.method, tt.path)
+		if ok != (tt.want != "") || route.Name != tt.want {
+			t.Errorf("MatchService(%s %s) = %q, %t, want %q", tt.method, tt.path, route.Name, ok, tt.want)
+			continue
+		}
+		if ok && fmt.Sprint(vars) != fmt.Sprint(tt.vars) {
+			t.Errorf("MatchService(%s %s) variables = %v, want %v", tt.method, tt.path, vars, tt.vars)
+		}
+		if ok && route.FillServicePath(vars) != tt.path {
+			t.Errorf("FillServicePath(%v) = %q, want %q back", vars, route.FillServicePath(vars), tt.path)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"vibe-drop/internal/codegen"
+)
+
+// CheckSpec reports every way an OpenAPI document disagrees with the registry: routes it
+// lacks or has in addition, and operations whose operationId, summary, deprecated flag or
+// security don't match the route. It returns nil if they agree.
+func CheckSpec(doc *codegen.Document) error {
+	var problems []error
+	documented := make(map[string]codegen.Endpoint)
+	for _, ep := range doc.Endpoints() {
+		documented[ep.Method+" "+ep.Path] = ep
+	}
+
+	for _, route := range Routes {
+		ep, ok := documented[route.Key()]
+		if !ok {
+			problems = append(problems, fmt.Errorf("%s is not documented", route.Key()))
+			continue
+		}
+		delete(documented, route.Key())
+
+		if ep.OperationID != route.Name {
+			problems = append(problems, fmt.Errorf("%s has operationId %q, want %q", route.Key(), ep.OperationID, route.Name))
+		}
+		if ep.Summary != route.Summary {
+			problems = append(problems, fmt.Errorf("%s has summary %q, want %q", route.Key(), ep.Summary, route.Summary))
+		}
+		if ep.Deprecated != (route.Deprecation != nil) {
+			problems = append(problems, fmt.Errorf("%s has deprecated %t, want %t", route.Key(), ep.Deprecated, route.Deprecation != nil))
+		}
+		if want := route.Auth.security(); !reflect.DeepEqual(ep.Security, want) {
+			problems = append(problems, fmt.Errorf("%s has security %v, want %v", route.Key(), ep.Security, want))
+		}
+	}
+	for key := range documented {
+		problems = append(problems, fmt.Errorf("%s is documented but not in the registry", key))
+	}
+	return errors.Join(problems...)
+}
+
+// security is the operation-level OpenAPI security an Auth is documented with. Nil means
+// the document's default (a bearer token or API key) applies.
+func (a Auth) security() []map[string][]string {
+	switch a {
+	case AuthNone:
+		return []map[string][]string{}
+	case AuthAPIKey:
+		return []map[string][]string{{"apiKey": {}}}
+	case AuthAdmin:
+		return []map[string][]string{{"adminKey": {}}, {"bearerAuth": {}}}
+	}
+	return nil
+}
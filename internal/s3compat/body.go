@@ -0,0 +1,138 @@
+package s3compat
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrContentMismatch is returned at the end of a body whose content doesn't match the
+// payload hash it was signed with
+var ErrContentMismatch = &Error{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The content doesn't match x-amz-content-sha256"}
+
+// Body returns a request's content and its length. Content sent in aws-chunked encoding,
+// as SDKs do to add a checksum trailer, is decoded; the trailer isn't checked. A payload
+// hash in x-amz-content-sha256 is checked as the content is read: the reader returns
+// ErrContentMismatch at the end if it doesn't match. Signed chunks aren't supported.
+func Body(r *http.Request) (io.Reader, int64, *Error) {
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	switch {
+	case payload == "STREAMING-UNSIGNED-PAYLOAD-TRAILER":
+		length, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || length < 0 {
+			return nil, 0, &Error{http.StatusLengthRequired, "MissingContentLength", "aws-chunked content needs x-amz-decoded-content-length"}
+		}
+		return &chunkedReader{r: bufio.NewReader(r.Body)}, length, nil
+	case strings.HasPrefix(payload, "STREAMING-"):
+		return nil, 0, &Error{http.StatusNotImplemented, "NotImplemented", "Signed payload chunks aren't supported; send the payload unsigned or hashed"}
+	}
+
+	if r.ContentLength < 0 {
+		return nil, 0, &Error{http.StatusLengthRequired, "MissingContentLength", "Send the content's length in Content-Length"}
+	}
+	if payload == "" || payload == "UNSIGNED-PAYLOAD" {
+		return r.Body, r.ContentLength, nil
+	}
+	want, err := hex.DecodeString(payload)
+	if err != nil || len(want) != sha256.Size {
+		return nil, 0, &Error{http.StatusBadRequest, "InvalidArgument", "x-amz-content-sha256 must be a SHA-256 or UNSIGNED-PAYLOAD"}
+	}
+	return &hashedReader{r: r.Body, hash: sha256.New(), want: want}, r.ContentLength, nil
+}
+
+// hashedReader fails at the end of its content if the content's hash isn't want
+type hashedReader struct {
+	r    io.Reader
+	hash hash.Hash
+	want []byte
+}
+
+func (h *hashedReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) && string(h.hash.Sum(nil)) != string(h.want) {
+		return n, ErrContentMismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes aws-chunked content: chunks of a hexadecimal length line and that
+// many bytes, each followed by a line break, ending with an empty chunk and trailer lines
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64 // Bytes left in the current chunk
+	started   bool
+	done      bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		if c.started {
+			if err := c.expectLineBreak(); err != nil {
+				return 0, err
+			}
+		}
+		c.started = true
+		line, err := c.line()
+		if err != nil {
+			return 0, err
+		}
+		size, _, _ := strings.Cut(line, ";")
+		c.remaining, err = strconv.ParseInt(size, 16, 64)
+		if err != nil || c.remaining < 0 {
+			return 0, fmt.Errorf("invalid aws-chunked chunk size %q", size)
+		}
+		if c.remaining == 0 {
+			// Trailer lines, such as a checksum, until an empty line
+			for {
+				line, err := c.line()
+				if err != nil {
+					return 0, err
+				}
+				if line == "" {
+					break
+				}
+			}
+			c.done = true
+			return 0, io.EOF
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (c *chunkedReader) line() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", io.ErrUnexpectedEOF
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *chunkedReader) expectLineBreak() error {
+	line, err := c.line()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return errors.New("aws-chunked chunk is longer than its stated size")
+	}
+	return nil
+}
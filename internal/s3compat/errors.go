@@ -0,0 +1,134 @@
+package s3compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"vibe-drop/internal/common"
+)
+
+// Error is an S3 error: the status it's sent with and S3's code for it
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+type errorDocument struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId,omitempty"`
+}
+
+// WriteError sends err as S3 clients expect it, as an XML error document
+func WriteError(w http.ResponseWriter, r *http.Request, err *Error) {
+	w.Header().Del("Content-Length")
+	WriteXML(w, err.Status, errorDocument{
+		Code:      err.Code,
+		Message:   err.Message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("X-Request-ID"),
+	})
+}
+
+// WriteXML sends v as an XML document with status
+func WriteXML(w http.ResponseWriter, status int, v any) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		status, body = http.StatusInternalServerError, []byte("<Error><Code>InternalError</Code></Error>")
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+// errorCodes are the S3 codes for the API's own error codes; others get a code by status
+var errorCodes = map[common.ErrorCode]string{
+	common.ErrorCodeNotFound:                 "NoSuchKey",
+	common.ErrorCodeUnauthorized:             "AccessDenied",
+	common.ErrorCodeReauthenticationRequired: "AccessDenied",
+	common.ErrorCodeForbidden:                "AccessDenied",
+	common.ErrorCodeFileQuarantined:          "AccessDenied",
+	common.ErrorCodeFileCorrupt:              "AccessDenied",
+	common.ErrorCodeFileInfected:             "AccessDenied",
+	common.ErrorCodeScanPending:              "InvalidObjectState",
+	common.ErrorCodeBadRequest:               "InvalidRequest",
+	common.ErrorCodeConflict:                 "OperationAborted",
+	common.ErrorCodeTooManyRequests:          "SlowDown",
+	common.ErrorCodeQuotaExceeded:            "QuotaExceeded",
+	common.ErrorCodeFileTooLarge:             "EntityTooLarge",
+	common.ErrorCodeMethodNotAllowed:         "MethodNotAllowed",
+	common.ErrorCodeServiceUnavailable:       "ServiceUnavailable",
+}
+
+// Errors sends the API's JSON error responses to S3 clients as S3 error documents, so
+// handlers and middleware shared with the rest of the API can answer S3 requests
+func Errors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		if !ew.held {
+			return
+		}
+
+		var response common.ErrorResponse
+		json.Unmarshal(ew.body.Bytes(), &response)
+		code, ok := errorCodes[response.Error.Code]
+		switch {
+		case ok:
+		case ew.status >= 500:
+			code = "InternalError"
+		default:
+			code = "InvalidArgument"
+		}
+		message := response.Error.Message
+		if response.Error.Details != "" {
+			message += ": " + response.Error.Details
+		}
+		WriteError(w, r, &Error{Status: ew.status, Code: code, Message: message})
+	})
+}
+
+// errorWriter holds back a JSON error response for Errors to rewrite
+type errorWriter struct {
+	http.ResponseWriter
+	held   bool
+	status int
+	body   bytes.Buffer
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.held, w.status = true, status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if w.held {
+		return w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush passes flushes on, except of a held response, which would go out as a 200
+func (w *errorWriter) Flush() {
+	if !w.held {
+		http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
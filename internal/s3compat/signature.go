@@ -0,0 +1,246 @@
+// Package s3compat is the S3-compatible API: enough of S3 for tools such as rclone to list,
+// get, put and delete a user's files as objects in one bucket. The gateway checks requests'
+// signatures, made with credentials derived from API keys, and the file service serves them.
+package s3compat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Path is where the API is served; buckets are named in the path, not the host
+	Path = "/s3"
+
+	// Bucket is the one bucket, holding the signed-in user's files
+	Bucket = "files"
+
+	// Region is the region clients are told to sign for. Signatures for any region are
+	// accepted, since there is only one.
+	Region = "us-east-1"
+
+	// maxClockSkew is how far a request's signing time may be from the server's, as on S3
+	maxClockSkew = 15 * time.Minute
+
+	amzDateFormat = "20060102T150405Z"
+	algorithm     = "AWS4-HMAC-SHA256"
+)
+
+// SplitPath returns the bucket and object key a request path under Path names
+func SplitPath(urlPath string) (bucket, key string) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(strings.TrimPrefix(urlPath, Path), "/"), "/")
+	return bucket, key
+}
+
+// SecretKey is the S3 secret access key for the API key with keyID and keyHash, signed with
+// secret. Its access key ID is keyID. Replacing a key changes its hash, so the secret key
+// changes with it.
+func SecretKey(secret []byte, keyID, keyHash string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(keyID + "\x00" + keyHash))
+	return hex.EncodeToString(mac.Sum(nil))[:40]
+}
+
+// Verify checks a request's AWS Signature Version 4 in its Authorization header, looking
+// up the secret key for the access key ID it names with secretKey, and returns that ID.
+// Every x-amz header must be signed, so the payload hash in x-amz-content-sha256 is the
+// client's; Body checks the content against it. Presigned URLs aren't supported.
+func Verify(r *http.Request, secretKey func(accessKeyID string) (string, bool), now time.Time) (string, *Error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+			return "", &Error{http.StatusForbidden, "AccessDenied", "Presigned URLs aren't supported; sign requests in the Authorization header"}
+		}
+		return "", &Error{http.StatusForbidden, "AccessDenied", "Requests must be signed with an API key's S3 credentials"}
+	}
+	fields, ok := strings.CutPrefix(header, algorithm+" ")
+	if !ok {
+		return "", &Error{http.StatusBadRequest, "InvalidArgument", "Only AWS Signature Version 4 (" + algorithm + ") is supported"}
+	}
+	var credential, signedHeaders, signature string
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			credential = value
+		case "SignedHeaders":
+			signedHeaders = value
+		case "Signature":
+			signature = value
+		}
+	}
+	// The access key ID comes first and may itself hold a slash
+	parts := strings.Split(credential, "/")
+	if len(parts) < 5 || signedHeaders == "" || signature == "" {
+		return "", &Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The Authorization header needs Credential, SignedHeaders and Signature"}
+	}
+	n := len(parts)
+	accessKeyID := strings.Join(parts[:n-4], "/")
+	date, region, service, terminal := parts[n-4], parts[n-3], parts[n-2], parts[n-1]
+	if service != "s3" || terminal != "aws4_request" {
+		return "", &Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The credential scope must be for the s3 service"}
+	}
+
+	signedAt, stamp, err := signingTime(r)
+	if err != nil {
+		return "", err
+	}
+	if skew := now.Sub(signedAt); skew > maxClockSkew || skew < -maxClockSkew {
+		return "", &Error{http.StatusForbidden, "RequestTimeTooSkewed", "The request was signed more than 15 minutes from the server's time"}
+	}
+	if date != stamp[:8] {
+		return "", &Error{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The credential scope's date isn't the request's"}
+	}
+
+	signed := strings.Split(signedHeaders, ";")
+	isSigned := make(map[string]bool, len(signed))
+	for _, name := range signed {
+		isSigned[name] = true
+	}
+	if !isSigned["host"] {
+		return "", &Error{http.StatusForbidden, "AccessDenied", "The Host header must be signed"}
+	}
+	for name := range r.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") && !isSigned[lower] {
+			return "", &Error{http.StatusForbidden, "AccessDenied", "Header " + lower + " isn't signed; every x-amz header must be"}
+		}
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return "", &Error{http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256"}
+	}
+
+	secret, ok := secretKey(accessKeyID)
+	if !ok {
+		return "", &Error{http.StatusForbidden, "InvalidAccessKeyId", "The access key ID isn't an API key's"}
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.RawQuery),
+		canonicalHeaders(r, signed),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := algorithm + "\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return "", &Error{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature doesn't match; check the secret access key"}
+	}
+	return accessKeyID, nil
+}
+
+// signingTime is when a request was signed, from X-Amz-Date or else Date, and that time as
+// signatures state it
+func signingTime(r *http.Request) (time.Time, string, *Error) {
+	if value := r.Header.Get("X-Amz-Date"); value != "" {
+		t, err := time.Parse(amzDateFormat, value)
+		if err != nil {
+			return time.Time{}, "", &Error{http.StatusForbidden, "AccessDenied", "X-Amz-Date isn't a valid time"}
+		}
+		return t, value, nil
+	}
+	t, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, "", &Error{http.StatusForbidden, "AccessDenied", "Signed requests need a valid X-Amz-Date or Date header"}
+	}
+	return t, t.UTC().Format(amzDateFormat), nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery is a query string as signed: each name and value encoded, sorted by name
+// and then value
+func canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params [][2]string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(param, "=")
+		// Signers encode spaces as %20, so a plus is a plus
+		if decoded, err := url.PathUnescape(name); err == nil {
+			name = decoded
+		}
+		if decoded, err := url.PathUnescape(value); err == nil {
+			value = decoded
+		}
+		params = append(params, [2]string{uriEncode(name, true), uriEncode(value, true)})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, param := range params {
+		encoded[i] = param[0] + "=" + param[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// canonicalHeaders lists the signed headers as signed: lower-cased names, each with its
+// values trimmed, their inner runs of spaces collapsed and joined by commas
+func canonicalHeaders(r *http.Request, names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = append([]string(nil), r.Header.Values(name)...)
+			if len(values) == 0 && r.ContentLength >= 0 {
+				values = []string{strconv.FormatInt(r.ContentLength, 10)}
+			}
+		default:
+			values = append([]string(nil), r.Header.Values(name)...)
+		}
+		for i, value := range values {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return b.String()
+}
+
+// uriEncode percent-encodes everything but unreserved characters, as SigV4 does; slashes
+// are left alone in paths
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
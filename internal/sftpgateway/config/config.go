@@ -0,0 +1,107 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	Environment string // dev, staging, prod
+
+	ListenAddr  string // Where SFTP clients connect
+	HostKeyFile string // PEM private key the server identifies itself with
+
+	// Sessions act through the public API at APIURL, as the signed-in user
+	APIURL string
+
+	// Signing in as this username takes an API key as the password, in place of an
+	// account's email address and password
+	APIKeyUser string
+
+	MaxUploadBytes int64         // Largest file a client may put; each is staged on disk first
+	IdleTimeout    time.Duration // Sessions waiting this long for a request are closed
+
+	LogLevel string // Least severe level logged: debug, info, warn or error
+}
+
+func Load() *Config {
+	// Load .env file if it exists (ignore errors for production)
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found or error loading .env file: %v", err)
+	}
+
+	cfg := &Config{
+		Environment: getEnv("ENVIRONMENT", "dev"),
+
+		ListenAddr:  getEnv("SFTP_LISTEN_ADDR", ":2022"),
+		HostKeyFile: os.Getenv("SFTP_HOST_KEY_FILE"),
+
+		APIURL:     getEnv("SFTP_API_URL", "http://localhost:8080"),
+		APIKeyUser: getEnv("SFTP_API_KEY_USER", "apikey"),
+
+		MaxUploadBytes: getInt64Env("SFTP_MAX_UPLOAD_SIZE", 5*1024*1024*1024),
+		IdleTimeout:    getDurationEnv("SFTP_IDLE_TIMEOUT", 15*time.Minute),
+
+		LogLevel: getEnv("LOG_LEVEL", "info"),
+	}
+
+	validateConfig(cfg)
+	return cfg
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid value for %s: must be a positive duration", key)
+	}
+	return duration
+}
+
+func getInt64Env(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 {
+		log.Fatalf("Invalid value for %s: must be a positive integer", key)
+	}
+	return n
+}
+
+func validateConfig(cfg *Config) {
+	var errors []string
+
+	// A key made up at startup changes on every restart, which clients report as an attack
+	if cfg.Environment != "dev" && cfg.HostKeyFile == "" {
+		errors = append(errors, "SFTP_HOST_KEY_FILE must be set outside dev")
+	}
+
+	if cfg.Environment != "dev" && !strings.HasPrefix(cfg.APIURL, "https://") {
+		errors = append(errors, "SFTP_API_URL should use https:// outside dev")
+	}
+
+	if strings.Contains(cfg.APIKeyUser, "@") {
+		errors = append(errors, "SFTP_API_KEY_USER can't be an email address, since users sign in with theirs")
+	}
+
+	if len(errors) > 0 {
+		log.Fatalf("Configuration validation failed:\n%s", strings.Join(errors, "\n"))
+	}
+}
@@ -0,0 +1,209 @@
+package sftpgateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"vibe-drop/pkg/vibedrop"
+)
+
+// APIDrive is a user's files through the public API, so files put over SFTP get the same
+// quota, content type, quarantine and scanning checks as any upload. Each name is shown
+// once, as its latest version.
+type APIDrive struct {
+	mu         sync.Mutex // Guards the client's tokens, which a refresh replaces
+	client     *vibedrop.Client
+	refreshing bool // Whether the client signed in with a password and can refresh its token
+}
+
+// NewAPIDrive creates a drive for a client signed in to the API. A client signed in with
+// a password is refreshed when its token expires.
+func NewAPIDrive(client *vibedrop.Client) *APIDrive {
+	return &APIDrive{client: client, refreshing: client.RefreshToken() != ""}
+}
+
+// call runs fn, refreshing the session's token and trying again if it has expired
+func (d *APIDrive) call(ctx context.Context, fn func() error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := fn()
+	var apiErr *vibedrop.APIError
+	if d.refreshing && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		if _, refreshErr := d.client.Refresh(ctx); refreshErr != nil {
+			return driveError(refreshErr)
+		}
+		err = fn()
+	}
+	return driveError(err)
+}
+
+// driveError describes an API error as SFTP clients expect: a 404 as a missing file and
+// auth failures as permission errors
+func driveError(err error) error {
+	var apiErr *vibedrop.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", fs.ErrNotExist, apiErr.Message)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", fs.ErrPermission, apiErr.Error())
+	}
+	return err
+}
+
+// versions returns the user's files by name, each name's versions together
+func (d *APIDrive) versions(ctx context.Context) (map[string][]vibedrop.File, error) {
+	var files []vibedrop.File
+	err := d.call(ctx, func() (err error) {
+		files, err = d.client.ListFiles(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]vibedrop.File)
+	for _, file := range files {
+		byName[file.Filename] = append(byName[file.Filename], file)
+	}
+	return byName, nil
+}
+
+// latest is the version of a file shown, the one with the highest version number
+func latest(versions []vibedrop.File) vibedrop.File {
+	newest := versions[0]
+	for _, file := range versions[1:] {
+		if file.Version > newest.Version {
+			newest = file
+		}
+	}
+	return newest
+}
+
+func (d *APIDrive) List(ctx context.Context) ([]Entry, error) {
+	byName, err := d.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(byName))
+	for name, versions := range byName {
+		file := latest(versions)
+		entries = append(entries, Entry{Name: name, Size: file.Size, ModTime: file.UploadedAt})
+	}
+	return entries, nil
+}
+
+// Open downloads a file through a download URL, refused for quarantined, corrupt or
+// unscanned files as it would be anywhere
+func (d *APIDrive) Open(ctx context.Context, name string, offset int64) (io.ReadCloser, error) {
+	byName, err := d.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions, ok := byName[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	var link *vibedrop.DownloadURL
+	err = d.call(ctx, func() (err error) {
+		link, err = d.client.DownloadURL(ctx, latest(versions).ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The download stops when the reader is closed
+	downloadCtx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := d.client.DownloadPresigned(downloadCtx, link.URL, offset, writer, nil)
+		writer.CloseWithError(err)
+	}()
+	return &pipedDownload{reader: reader, cancel: cancel}, nil
+}
+
+// pipedDownload is a download being streamed to its reader
+type pipedDownload struct {
+	reader *io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (d *pipedDownload) Read(p []byte) (int, error) { return d.reader.Read(p) }
+
+func (d *pipedDownload) Close() error {
+	d.cancel()
+	return d.reader.Close()
+}
+
+// Store uploads a file. A name already in use gets a new version or a renamed copy,
+// depending on the deployment's filename collision strategy.
+func (d *APIDrive) Store(ctx context.Context, name string, content io.ReaderAt, size int64) error {
+	var upload *vibedrop.UploadURLResponse
+	err := d.call(ctx, func() (err error) {
+		upload, err = d.client.RequestUpload(ctx, name, size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if upload.UploadType != "multipart" {
+		_, err := d.client.PutPresignedWithHeaders(ctx, upload.URL, upload.UploadHeaders, io.NewSectionReader(content, 0, size), size, nil)
+		return err
+	}
+	var offset int64
+	for _, chunk := range upload.Chunks {
+		if chunk.Size < 0 || offset+chunk.Size > size {
+			return fmt.Errorf("upload %s has chunks past the end of the file", upload.FileID)
+		}
+		etag, err := d.client.PutPresigned(ctx, chunk.URL, io.NewSectionReader(content, offset, chunk.Size), chunk.Size, nil)
+		if err != nil {
+			return err
+		}
+		err = d.call(ctx, func() error {
+			_, err := d.client.CompleteChunk(ctx, upload.FileID, chunk.ChunkNumber, etag)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		offset += chunk.Size
+	}
+	return d.call(ctx, func() error { return d.client.CompleteUpload(ctx, upload.FileID) })
+}
+
+// Remove deletes every version of a file, since listing would otherwise show the one before
+func (d *APIDrive) Remove(ctx context.Context, name string) error {
+	byName, err := d.versions(ctx)
+	if err != nil {
+		return err
+	}
+	versions, ok := byName[name]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	for _, file := range versions {
+		if err := d.call(ctx, func() error { return d.client.DeleteFile(ctx, file.ID) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close signs a password session out, revoking its refresh token
+func (d *APIDrive) Close(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.refreshing {
+		return nil
+	}
+	return d.client.Logout(ctx)
+}
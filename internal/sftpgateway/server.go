@@ -0,0 +1,301 @@
+package sftpgateway
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"vibe-drop/internal/common"
+	"vibe-drop/internal/sftpgateway/config"
+	"vibe-drop/pkg/vibedrop"
+)
+
+const (
+	handshakeTimeout = 30 * time.Second // Longest a client may take to connect and sign in
+	signInTimeout    = 15 * time.Second // Longest checking a password or API key may take
+	closeTimeout     = 10 * time.Second // Longest signing a session out may take
+)
+
+var (
+	listener    net.Listener
+	connections sync.WaitGroup
+
+	openMu sync.Mutex
+	open   = make(map[*ssh.ServerConn]struct{})
+)
+
+// Start serves SFTP clients until Stop is called
+func Start() {
+	cfg := config.Load()
+	if err := common.SetupLogging("vibe-drop-sftpgateway", cfg.LogLevel); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	hostKey, err := loadHostKey(cfg.HostKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load host key: %v", err)
+	}
+	g := &gateway{cfg: cfg, httpClient: &http.Client{Timeout: 0}} // Transfers can take hours
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: g.signIn,
+		ServerVersion:    "SSH-2.0-VibeDrop",
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	listener, err = net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.ListenAddr, err)
+	}
+	log.Printf("SFTP gateway listening on %s, serving %s", cfg.ListenAddr, cfg.APIURL)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("Failed to accept connection", "error", err)
+			continue
+		}
+		connections.Add(1)
+		go func() {
+			defer connections.Done()
+			g.serve(conn, serverConfig)
+		}()
+	}
+}
+
+// Stop stops accepting connections and waits for sessions to end, closing any still open
+// after 30 seconds. Uploads not yet closed by their client are lost.
+func Stop() {
+	if listener == nil {
+		return
+	}
+	log.Println("Shutting down SFTP gateway...")
+	listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		connections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("SFTP gateway stopped gracefully")
+	case <-time.After(30 * time.Second):
+		openMu.Lock()
+		for conn := range open {
+			conn.Close()
+		}
+		openMu.Unlock()
+		log.Println("SFTP gateway stopped with sessions open")
+	}
+}
+
+// loadHostKey reads the server's key from path. Without one, in dev, a key is made up
+// that lasts until the gateway restarts.
+func loadHostKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		log.Println("Warning: SFTP_HOST_KEY_FILE not set; using a temporary host key")
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.NewSignerFromKey(key)
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+type gateway struct {
+	cfg        *config.Config
+	httpClient *http.Client
+}
+
+// Credentials a signed-in connection carries, in its ssh.Permissions
+const (
+	permToken        = "token"
+	permRefreshToken = "refresh_token"
+	permAPIKey       = "api_key"
+)
+
+// client creates an API client for a connection from addr. The gateway sees every SFTP
+// client at this service's address, so the client's own is passed on in X-Forwarded-For.
+func (g *gateway) client(addr net.Addr, opts ...vibedrop.Option) *vibedrop.Client {
+	httpClient := *g.httpClient
+	httpClient.Transport = &forwardingTransport{base: http.DefaultTransport, forwardedFor: hostOf(addr)}
+	opts = append(opts, vibedrop.WithHTTPClient(&httpClient), vibedrop.WithClientInfo("vibedrop-sftpgateway", "1"))
+	return vibedrop.NewClient(g.cfg.APIURL, opts...)
+}
+
+// signIn checks a password with the API: an account's password for its email address, or,
+// signing in as the API key username, an API key. An account with two-factor
+// authentication is then asked for a code.
+func (g *gateway) signIn(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signInTimeout)
+	defer cancel()
+	address := hostOf(conn.RemoteAddr())
+
+	if conn.User() == g.cfg.APIKeyUser {
+		if _, err := g.client(conn.RemoteAddr(), vibedrop.WithAPIKey(string(password))).APIKeyUsage(ctx); err != nil {
+			slog.Warn("SFTP sign-in with API key failed", "security_event", "sftp_auth_failure", "client_address", address, "error", err)
+			return nil, errors.New("invalid API key")
+		}
+		slog.Info("SFTP sign-in with API key", "client_address", address)
+		return &ssh.Permissions{Extensions: map[string]string{permAPIKey: string(password)}}, nil
+	}
+
+	client := g.client(conn.RemoteAddr())
+	result, err := client.Login(ctx, conn.User(), string(password))
+	var apiErr *vibedrop.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == vibedrop.ErrTOTPRequired {
+		return nil, &ssh.PartialSuccessError{Next: ssh.ServerAuthCallbacks{
+			KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+				answers, err := challenge("", "", []string{"Two-factor code: "}, []bool{false})
+				if err != nil || len(answers) != 1 {
+					return nil, errors.New("no two-factor code")
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), signInTimeout)
+				defer cancel()
+				result, err := client.LoginWithTOTP(ctx, conn.User(), string(password), answers[0])
+				return g.signedIn(conn, result, err)
+			},
+		}}
+	}
+	return g.signedIn(conn, result, err)
+}
+
+func (g *gateway) signedIn(conn ssh.ConnMetadata, result *vibedrop.AuthResult, err error) (*ssh.Permissions, error) {
+	address := hostOf(conn.RemoteAddr())
+	if err != nil {
+		slog.Warn("SFTP sign-in failed", "security_event", "sftp_auth_failure", "email", conn.User(), "client_address", address, "error", err)
+		return nil, errors.New("sign-in failed")
+	}
+	slog.Info("SFTP sign-in", "user_id", result.User.UserID, "client_address", address)
+	return &ssh.Permissions{Extensions: map[string]string{permToken: result.Token, permRefreshToken: result.RefreshToken}}, nil
+}
+
+// serve runs one connection: its handshake, then its sessions until the client hangs up
+// or is idle for too long
+func (g *gateway) serve(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sconn, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		slog.Debug("SSH handshake failed", "client_address", hostOf(conn.RemoteAddr()), "error", err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	openMu.Lock()
+	open[sconn] = struct{}{}
+	openMu.Unlock()
+	defer func() {
+		openMu.Lock()
+		delete(open, sconn)
+		openMu.Unlock()
+	}()
+	go ssh.DiscardRequests(requests)
+
+	ext := sconn.Permissions.Extensions
+	drive := NewAPIDrive(g.client(sconn.RemoteAddr(), vibedrop.WithAPIKey(ext[permAPIKey]),
+		vibedrop.WithToken(ext[permToken]), vibedrop.WithRefreshToken(ext[permRefreshToken])))
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		if err := drive.Close(ctx); err != nil {
+			slog.Warn("Failed to sign SFTP session out", "error", err)
+		}
+	}()
+
+	// Connections are closed once they have waited IdleTimeout for a request
+	idle := time.AfterFunc(g.cfg.IdleTimeout, func() { sconn.Close() })
+	defer idle.Stop()
+
+	var sessions sync.WaitGroup
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			g.session(channel, channelRequests, drive, idle)
+		}()
+	}
+	sessions.Wait()
+}
+
+// session serves a channel once the client asks for the sftp subsystem. Shells and
+// commands, including scp's, are refused.
+func (g *gateway) session(channel ssh.Channel, requests <-chan *ssh.Request, drive *APIDrive, idle *time.Timer) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "subsystem" || string(req.Payload) != "\x00\x00\x00\x04sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+
+		err := ServeSFTP(context.Background(), &idleChannel{Channel: channel, idle: idle, timeout: g.cfg.IdleTimeout}, drive, g.cfg.MaxUploadBytes)
+		status := uint32(0)
+		if err != nil {
+			slog.Warn("SFTP session failed", "error", err)
+			status = 1
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		idle.Reset(g.cfg.IdleTimeout)
+		return
+	}
+}
+
+// idleChannel runs the idle timer only while waiting for a request
+type idleChannel struct {
+	ssh.Channel
+	idle    *time.Timer
+	timeout time.Duration
+}
+
+func (c *idleChannel) Read(p []byte) (int, error) {
+	c.idle.Reset(c.timeout)
+	n, err := c.Channel.Read(p)
+	c.idle.Stop()
+	return n, err
+}
+
+// forwardingTransport adds the SFTP client's address to API requests
+type forwardingTransport struct {
+	base         http.RoundTripper
+	forwardedFor string
+}
+
+func (t *forwardingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Forwarded-For", t.forwardedFor)
+	return t.base.RoundTrip(req)
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,555 @@
+package sftpgateway
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SFTP version 3 (draft-ietf-secsh-filexfer-02), the version every client speaks
+const sftpVersion = 3
+
+// Packet types
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+)
+
+// Status codes
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Open flags
+const (
+	fxfRead   = 0x01
+	fxfWrite  = 0x02
+	fxfAppend = 0x04
+)
+
+// Attribute flags
+const (
+	attrSize        = 0x01
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+)
+
+const (
+	// maxPacketSize bounds the packets a client may send: writes of up to 256 KiB, as
+	// OpenSSH's client sends at most, and their header
+	maxPacketSize = 256*1024 + 1024
+
+	// maxReadSize is the most a read returns; clients ask again for the rest
+	maxReadSize = 256 * 1024
+
+	// maxHandles bounds the files and listings a session holds open at once, since each
+	// file being written is staged on disk
+	maxHandles = 64
+)
+
+// Entry is a file in a drive
+type Entry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Drive is the files a session works on: one folder of files, with no subfolders
+type Drive interface {
+	// List returns the files, each name once
+	List(ctx context.Context) ([]Entry, error)
+	// Open reads a file's content from offset
+	Open(ctx context.Context, name string, offset int64) (io.ReadCloser, error)
+	// Store saves size bytes of content as a file
+	Store(ctx context.Context, name string, content io.ReaderAt, size int64) error
+	// Remove deletes a file
+	Remove(ctx context.Context, name string) error
+}
+
+// session serves one client's SFTP requests against a drive. Requests are answered in
+// order, one at a time.
+type session struct {
+	drive     Drive
+	maxUpload int64 // Largest file a client may write, staged on disk until closed
+	out       io.Writer
+
+	handles map[string]*handle
+	next    int
+}
+
+// handle is an open file being read or written, or an open listing
+type handle struct {
+	name string
+
+	// Reading: the file, and the download in progress at offset
+	entry   Entry
+	content io.ReadCloser
+	offset  int64
+
+	// Writing: the staged content, how far it reaches, and whether a write to it failed
+	staged *os.File
+	size   int64
+	failed bool
+
+	// Listing: the entries, until they have been returned
+	dir     bool
+	listing []Entry
+	listed  bool
+}
+
+// ServeSFTP answers SFTP requests on channel until the client closes it. Files written are
+// staged in the temporary directory and stored in drive when closed, up to maxUpload bytes.
+func ServeSFTP(ctx context.Context, channel io.ReadWriter, drive Drive, maxUpload int64) error {
+	s := &session{drive: drive, maxUpload: maxUpload, out: channel, handles: make(map[string]*handle)}
+	defer s.closeAll()
+
+	for {
+		packet, err := readPacket(channel)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := s.handle(ctx, packet); err != nil {
+			return err
+		}
+	}
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n == 0 || n > maxPacketSize {
+		return nil, fmt.Errorf("sftp packet of %d bytes", n)
+	}
+	packet := make([]byte, n)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// handle answers one packet. It only fails if the channel does.
+func (s *session) handle(ctx context.Context, packet []byte) error {
+	in := &decoder{buf: packet[1:]}
+	if packet[0] == fxpInit {
+		// Extensions the client offers are ignored
+		return s.send(fxpVersion, encoder{}.uint32(sftpVersion))
+	}
+
+	id := in.uint32()
+	if in.err != nil {
+		return s.status(id, fxBadMessage, "Packet too short")
+	}
+	switch packet[0] {
+	case fxpRealpath:
+		name := cleanPath(in.string())
+		return s.names(id, []nameEntry{{name: name, attrs: encoder{}.uint32(0)}})
+	case fxpStat, fxpLstat:
+		return s.stat(ctx, id, in.string())
+	case fxpOpendir:
+		return s.opendir(ctx, id, in.string())
+	case fxpReaddir:
+		return s.readdir(id, in.string())
+	case fxpOpen:
+		name, flags := in.string(), in.uint32()
+		return s.open(ctx, id, name, flags)
+	case fxpRead:
+		handleID, offset, length := in.string(), in.uint64(), in.uint32()
+		return s.read(ctx, id, handleID, int64(offset), length)
+	case fxpWrite:
+		handleID, offset, data := in.string(), in.uint64(), in.string()
+		if in.err != nil {
+			return s.status(id, fxBadMessage, "Malformed write")
+		}
+		return s.write(id, handleID, int64(offset), []byte(data))
+	case fxpFstat:
+		h, ok := s.handles[in.string()]
+		if !ok {
+			return s.status(id, fxFailure, "Invalid handle")
+		}
+		if h.staged != nil {
+			return s.send(fxpAttrs, encoder{}.uint32(id).append(fileAttrs(Entry{Name: h.name, Size: h.size, ModTime: time.Now()})))
+		}
+		if h.dir {
+			return s.send(fxpAttrs, encoder{}.uint32(id).append(dirAttrs()))
+		}
+		return s.send(fxpAttrs, encoder{}.uint32(id).append(fileAttrs(h.entry)))
+	case fxpClose:
+		return s.close(ctx, id, in.string())
+	case fxpRemove:
+		return s.remove(ctx, id, in.string())
+	case fxpSetstat, fxpFsetstat:
+		// Files keep the times and permissions the drive gives them. Clients set these after
+		// copying a file and most stop with an error if refused, so the request is accepted.
+		return s.status(id, fxOK, "")
+	default:
+		return s.status(id, fxOpUnsupported, "The drive has no folders or links and doesn't rename files")
+	}
+}
+
+// fileName returns the file a path names, "" for the drive itself. Paths into folders
+// name nothing, since there are none.
+func fileName(p string) (string, bool) {
+	name := strings.TrimPrefix(cleanPath(p), "/")
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// cleanPath makes p absolute: clients start in /, the drive
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// find looks up a file by name
+func (s *session) find(ctx context.Context, name string) (Entry, error) {
+	entries, err := s.drive.List(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+	return Entry{}, fs.ErrNotExist
+}
+
+func (s *session) stat(ctx context.Context, id uint32, p string) error {
+	name, ok := fileName(p)
+	if !ok {
+		return s.status(id, fxNoSuchFile, "No such file")
+	}
+	if name == "" {
+		return s.send(fxpAttrs, encoder{}.uint32(id).append(dirAttrs()))
+	}
+	entry, err := s.find(ctx, name)
+	if err != nil {
+		return s.error(id, err)
+	}
+	return s.send(fxpAttrs, encoder{}.uint32(id).append(fileAttrs(entry)))
+}
+
+func (s *session) opendir(ctx context.Context, id uint32, p string) error {
+	if name, ok := fileName(p); !ok || name != "" {
+		return s.status(id, fxNoSuchFile, "The drive has no folders")
+	}
+	entries, err := s.drive.List(ctx)
+	if err != nil {
+		return s.error(id, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return s.register(id, &handle{name: "/", dir: true, listing: entries})
+}
+
+// readdir returns the whole listing, then EOF
+func (s *session) readdir(id uint32, handleID string) error {
+	h, ok := s.handles[handleID]
+	if !ok || !h.dir {
+		return s.status(id, fxFailure, "Invalid handle")
+	}
+	if h.listed {
+		return s.status(id, fxEOF, "")
+	}
+	names := []nameEntry{
+		{name: ".", long: longName(".", 0, time.Now(), true), attrs: dirAttrs()},
+		{name: "..", long: longName("..", 0, time.Now(), true), attrs: dirAttrs()},
+	}
+	for _, entry := range h.listing {
+		names = append(names, nameEntry{name: entry.Name, long: longName(entry.Name, entry.Size, entry.ModTime, false), attrs: fileAttrs(entry)})
+	}
+	h.listing, h.listed = nil, true
+	return s.names(id, names)
+}
+
+// open starts reading a file or writing one. Writing always replaces the file: the drive
+// can't append to or change part of one.
+func (s *session) open(ctx context.Context, id uint32, p string, flags uint32) error {
+	name, ok := fileName(p)
+	if !ok || name == "" {
+		return s.status(id, fxNoSuchFile, "The drive has no folders")
+	}
+	switch {
+	case flags&fxfWrite != 0:
+		if flags&(fxfRead|fxfAppend) != 0 {
+			return s.status(id, fxOpUnsupported, "Files can only be written whole")
+		}
+		staged, err := os.CreateTemp("", "vibe-drop-sftp-")
+		if err != nil {
+			slog.Error("Failed to stage upload", "error", err)
+			return s.status(id, fxFailure, "Unable to stage the upload")
+		}
+		return s.register(id, &handle{name: name, staged: staged})
+	case flags&fxfRead != 0:
+		entry, err := s.find(ctx, name)
+		if err != nil {
+			return s.error(id, err)
+		}
+		return s.register(id, &handle{name: name, entry: entry})
+	default:
+		return s.status(id, fxBadMessage, "Open for neither reading nor writing")
+	}
+}
+
+// register registers an open handle and returns it to the client
+func (s *session) register(id uint32, h *handle) error {
+	if len(s.handles) >= maxHandles {
+		h.release()
+		return s.status(id, fxFailure, fmt.Sprintf("Too many open files; close some first (at most %d)", maxHandles))
+	}
+	s.next++
+	handleID := strconv.Itoa(s.next)
+	s.handles[handleID] = h
+	return s.send(fxpHandle, encoder{}.uint32(id).string(handleID))
+}
+
+// read returns content from offset. Clients read in order, so one download serves a whole
+// file; a read anywhere else starts another from there.
+func (s *session) read(ctx context.Context, id uint32, handleID string, offset int64, length uint32) error {
+	h, ok := s.handles[handleID]
+	if !ok || h.staged != nil || h.dir {
+		return s.status(id, fxFailure, "Invalid handle")
+	}
+	if offset >= h.entry.Size {
+		return s.status(id, fxEOF, "")
+	}
+	if h.content != nil && h.offset != offset {
+		h.content.Close()
+		h.content = nil
+	}
+	if h.content == nil {
+		content, err := s.drive.Open(ctx, h.name, offset)
+		if err != nil {
+			return s.error(id, err)
+		}
+		h.content, h.offset = content, offset
+	}
+
+	data := make([]byte, min(int64(length), maxReadSize, h.entry.Size-offset))
+	n, err := io.ReadFull(h.content, data)
+	h.offset += int64(n)
+	if n == 0 && err != nil {
+		h.content.Close()
+		h.content = nil
+		if errors.Is(err, io.EOF) {
+			return s.status(id, fxEOF, "")
+		}
+		slog.Warn("Failed to read file", "file", h.name, "error", err)
+		return s.status(id, fxFailure, "Download interrupted")
+	}
+	return s.send(fxpData, encoder{}.uint32(id).string(string(data[:n])))
+}
+
+func (s *session) write(id uint32, handleID string, offset int64, data []byte) error {
+	h, ok := s.handles[handleID]
+	if !ok || h.staged == nil {
+		return s.status(id, fxFailure, "Invalid handle")
+	}
+	end := offset + int64(len(data))
+	if offset < 0 || end > s.maxUpload {
+		h.failed = true
+		return s.status(id, fxFailure, fmt.Sprintf("Files may be at most %d bytes", s.maxUpload))
+	}
+	if _, err := h.staged.WriteAt(data, offset); err != nil {
+		h.failed = true
+		slog.Error("Failed to stage upload", "error", err)
+		return s.status(id, fxFailure, "Unable to stage the upload")
+	}
+	h.size = max(h.size, end)
+	return s.status(id, fxOK, "")
+}
+
+// close finishes with a handle. Closing a file being written stores it, and reports if
+// that fails, so the client knows the upload didn't happen.
+func (s *session) close(ctx context.Context, id uint32, handleID string) error {
+	h, ok := s.handles[handleID]
+	if !ok {
+		return s.status(id, fxFailure, "Invalid handle")
+	}
+	delete(s.handles, handleID)
+	defer h.release()
+	if h.failed {
+		return s.status(id, fxFailure, "A write failed, so the file wasn't stored")
+	}
+	if h.staged != nil {
+		if err := s.drive.Store(ctx, h.name, h.staged, h.size); err != nil {
+			return s.error(id, err)
+		}
+	}
+	return s.status(id, fxOK, "")
+}
+
+func (s *session) remove(ctx context.Context, id uint32, p string) error {
+	name, ok := fileName(p)
+	if !ok || name == "" {
+		return s.status(id, fxNoSuchFile, "No such file")
+	}
+	if err := s.drive.Remove(ctx, name); err != nil {
+		return s.error(id, err)
+	}
+	return s.status(id, fxOK, "")
+}
+
+// release frees what a handle holds: its download, or its staged content
+func (h *handle) release() {
+	if h.content != nil {
+		h.content.Close()
+	}
+	if h.staged != nil {
+		h.staged.Close()
+		os.Remove(h.staged.Name())
+	}
+}
+
+func (s *session) closeAll() {
+	for handleID, h := range s.handles {
+		h.release()
+		delete(s.handles, handleID)
+	}
+}
+
+// error reports a drive error to the client
+func (s *session) error(id uint32, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return s.status(id, fxNoSuchFile, "No such file")
+	case errors.Is(err, fs.ErrPermission):
+		return s.status(id, fxPermissionDenied, err.Error())
+	default:
+		return s.status(id, fxFailure, err.Error())
+	}
+}
+
+func (s *session) status(id uint32, code uint32, message string) error {
+	return s.send(fxpStatus, encoder{}.uint32(id).uint32(code).string(message).string("en"))
+}
+
+type nameEntry struct {
+	name, long string
+	attrs      encoder
+}
+
+func (s *session) names(id uint32, names []nameEntry) error {
+	out := encoder{}.uint32(id).uint32(uint32(len(names)))
+	for _, n := range names {
+		out = out.string(n.name).string(n.long).append(n.attrs)
+	}
+	return s.send(fxpName, out)
+}
+
+func (s *session) send(packetType byte, payload encoder) error {
+	packet := encoder{}.uint32(uint32(len(payload) + 1))
+	packet = append(packet, packetType)
+	_, err := s.out.Write(append(packet, payload...))
+	return err
+}
+
+func fileAttrs(entry Entry) encoder {
+	mtime := uint32(entry.ModTime.Unix())
+	return encoder{}.uint32(attrSize | attrPermissions | attrACModTime).uint64(uint64(entry.Size)).
+		uint32(0o100644).uint32(mtime).uint32(mtime)
+}
+
+func dirAttrs() encoder {
+	return encoder{}.uint32(attrPermissions).uint32(0o040755)
+}
+
+// longName is a file as ls -l would show it, which some clients display as is
+func longName(name string, size int64, modTime time.Time, dir bool) string {
+	mode := "-rw-r--r--"
+	if dir {
+		mode = "drwxr-xr-x"
+	}
+	stamp := modTime.Format("Jan _2 15:04")
+	if time.Since(modTime) > 180*24*time.Hour {
+		stamp = modTime.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s    1 vibe     vibe     %8d %s %s", mode, size, stamp, name)
+}
+
+// encoder appends SFTP wire values
+type encoder []byte
+
+func (e encoder) uint32(v uint32) encoder  { return binary.BigEndian.AppendUint32(e, v) }
+func (e encoder) uint64(v uint64) encoder  { return binary.BigEndian.AppendUint64(e, v) }
+func (e encoder) string(v string) encoder  { return append(e.uint32(uint32(len(v))), v...) }
+func (e encoder) append(v encoder) encoder { return append(e, v...) }
+
+// decoder reads SFTP wire values, remembering if it ran out
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || n < 0 || len(d.buf) < n {
+		d.err = errors.New("sftp packet too short")
+		return nil
+	}
+	taken := d.buf[:n]
+	d.buf = d.buf[n:]
+	return taken
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	if n > uint32(len(d.buf)) {
+		d.err = errors.New("sftp packet too short")
+		return ""
+	}
+	return string(d.take(int(n)))
+}
@@ -0,0 +1,223 @@
+package sftpgateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryDrive is a drive of files held in memory
+type memoryDrive struct {
+	files map[string]string
+	opens int // Downloads started
+}
+
+func (d *memoryDrive) List(ctx context.Context) ([]Entry, error) {
+	var entries []Entry
+	for name, content := range d.files {
+		entries = append(entries, Entry{Name: name, Size: int64(len(content)), ModTime: time.Unix(1700000000, 0)})
+	}
+	return entries, nil
+}
+
+func (d *memoryDrive) Open(ctx context.Context, name string, offset int64) (io.ReadCloser, error) {
+	content, ok := d.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	d.opens++
+	return io.NopCloser(strings.NewReader(content[offset:])), nil
+}
+
+func (d *memoryDrive) Store(ctx context.Context, name string, content io.ReaderAt, size int64) error {
+	data := make([]byte, size)
+	if _, err := content.ReadAt(data, 0); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if strings.HasSuffix(name, ".exe") {
+		return errors.New("Content type not allowed (400 CONTENT_TYPE_NOT_ALLOWED)")
+	}
+	d.files[name] = string(data)
+	return nil
+}
+
+func (d *memoryDrive) Remove(ctx context.Context, name string) error {
+	if _, ok := d.files[name]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(d.files, name)
+	return nil
+}
+
+// testClient sends SFTP requests to a session and reads its replies
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	id   uint32
+}
+
+func newTestClient(t *testing.T, drive Drive) *testClient {
+	server, conn := net.Pipe()
+	go ServeSFTP(context.Background(), server, drive, 16)
+	t.Cleanup(func() { conn.Close() })
+
+	c := &testClient{t: t, conn: conn}
+	c.write(fxpInit, encoder{}.uint32(sftpVersion))
+	if packetType, _ := c.read(); packetType != fxpVersion {
+		t.Fatalf("init: got packet type %d", packetType)
+	}
+	return c
+}
+
+func (c *testClient) write(packetType byte, payload encoder) {
+	packet := encoder{}.uint32(uint32(len(payload) + 1))
+	packet = append(append(packet, packetType), payload...)
+	if _, err := c.conn.Write(packet); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) read() (byte, *decoder) {
+	packet, err := readPacket(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return packet[0], &decoder{buf: packet[1:]}
+}
+
+// request sends a request and returns the reply, past its ID
+func (c *testClient) request(packetType byte, payload encoder) (byte, *decoder) {
+	c.id++
+	c.write(packetType, encoder{}.uint32(c.id).append(payload))
+	replyType, reply := c.read()
+	if id := reply.uint32(); id != c.id {
+		c.t.Fatalf("reply to request %d has ID %d", c.id, id)
+	}
+	return replyType, reply
+}
+
+// status sends a request expecting a status reply and returns its code and message
+func (c *testClient) status(packetType byte, payload encoder) (uint32, string) {
+	replyType, reply := c.request(packetType, payload)
+	if replyType != fxpStatus {
+		c.t.Fatalf("request type %d: got reply type %d, want a status", packetType, replyType)
+	}
+	return reply.uint32(), reply.string()
+}
+
+func (c *testClient) open(name string, flags uint32) string {
+	replyType, reply := c.request(fxpOpen, encoder{}.string(name).uint32(flags).uint32(0))
+	if replyType != fxpHandle {
+		code, message := reply.uint32(), reply.string()
+		c.t.Fatalf("open %s: status %d %s", name, code, message)
+	}
+	return reply.string()
+}
+
+func TestSFTPRoundTrip(t *testing.T) {
+	drive := &memoryDrive{files: map[string]string{"old.txt": "0123456789"}}
+	c := newTestClient(t, drive)
+
+	// Write in two pieces, out of order
+	handle := c.open("/notes.txt", fxfWrite|0x08|0x10)
+	if code, msg := c.status(fxpWrite, encoder{}.string(handle).uint64(5).string(" world")); code != fxOK {
+		t.Fatalf("write: %d %s", code, msg)
+	}
+	c.status(fxpWrite, encoder{}.string(handle).uint64(0).string("hello"))
+	if code, msg := c.status(fxpClose, encoder{}.string(handle)); code != fxOK {
+		t.Fatalf("close: %d %s", code, msg)
+	}
+	if drive.files["notes.txt"] != "hello world" {
+		t.Fatalf("stored %q", drive.files["notes.txt"])
+	}
+
+	// List the drive
+	replyType, reply := c.request(fxpOpendir, encoder{}.string("."))
+	if replyType != fxpHandle {
+		t.Fatalf("opendir: reply type %d", replyType)
+	}
+	dir := reply.string()
+	replyType, reply = c.request(fxpReaddir, encoder{}.string(dir))
+	if replyType != fxpName {
+		t.Fatalf("readdir: reply type %d", replyType)
+	}
+	var names []string
+	for n := reply.uint32(); n > 0; n-- {
+		names = append(names, reply.string())
+		reply.string() // Long name
+		if flags := reply.uint32(); flags&attrSize != 0 {
+			reply.uint64()
+			reply.uint32()
+			reply.uint32()
+			reply.uint32()
+		} else {
+			reply.uint32()
+		}
+	}
+	if got := strings.Join(names, ","); got != ".,..,notes.txt,old.txt" {
+		t.Errorf("listing: %s", got)
+	}
+	if code, _ := c.status(fxpReaddir, encoder{}.string(dir)); code != fxEOF {
+		t.Errorf("second readdir: status %d, want EOF", code)
+	}
+
+	// Read in order from one download, then from elsewhere with another
+	handle = c.open("old.txt", fxfRead)
+	var read []string
+	for _, offset := range []uint64{0, 4, 2} {
+		replyType, reply := c.request(fxpRead, encoder{}.string(handle).uint64(offset).uint32(4))
+		if replyType != fxpData {
+			t.Fatalf("read at %d: reply type %d", offset, replyType)
+		}
+		read = append(read, reply.string())
+	}
+	if got := strings.Join(read, ","); got != "0123,4567,2345" || drive.opens != 2 {
+		t.Errorf("reads %s from %d downloads", got, drive.opens)
+	}
+	if code, _ := c.status(fxpRead, encoder{}.string(handle).uint64(10).uint32(4)); code != fxEOF {
+		t.Errorf("read past the end: status %d, want EOF", code)
+	}
+	c.status(fxpClose, encoder{}.string(handle))
+
+	if code, _ := c.status(fxpRemove, encoder{}.string("/old.txt")); code != fxOK {
+		t.Errorf("remove: status %d", code)
+	}
+	if code, _ := c.status(fxpRemove, encoder{}.string("/old.txt")); code != fxNoSuchFile {
+		t.Errorf("remove again: status %d, want no such file", code)
+	}
+}
+
+func TestSFTPRefusals(t *testing.T) {
+	drive := &memoryDrive{files: map[string]string{}}
+	c := newTestClient(t, drive)
+
+	if code, _ := c.status(fxpOpen, encoder{}.string("/inbox/a.txt").uint32(fxfWrite).uint32(0)); code != fxNoSuchFile {
+		t.Errorf("open in a folder: status %d, want no such file", code)
+	}
+	if code, _ := c.status(18, encoder{}.string("/a.txt").string("/b.txt")); code != fxOpUnsupported {
+		t.Errorf("rename: status %d, want unsupported", code)
+	}
+
+	// Writing past the upload limit fails the write
+	handle := c.open("/big.bin", fxfWrite)
+	if code, _ := c.status(fxpWrite, encoder{}.string(handle).uint64(10).string("0123456789")); code != fxFailure {
+		t.Errorf("write past the limit: status %d, want failure", code)
+	}
+	c.status(fxpClose, encoder{}.string(handle))
+
+	// A file the API refuses fails on close, so the client reports it
+	handle = c.open("/setup.exe", fxfWrite)
+	c.status(fxpWrite, encoder{}.string(handle).uint64(0).string("MZ"))
+	code, message := c.status(fxpClose, encoder{}.string(handle))
+	if code != fxFailure || !strings.Contains(message, "CONTENT_TYPE_NOT_ALLOWED") {
+		t.Errorf("close of refused file: status %d %s", code, message)
+	}
+	if len(drive.files) != 0 {
+		t.Errorf("stored %v", drive.files)
+	}
+}
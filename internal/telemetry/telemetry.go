@@ -0,0 +1,82 @@
+// Package telemetry sets up OpenTelemetry tracing for the gateway and the file service. A
+// request gets one trace: the gateway starts it, propagates it to the file service with
+// W3C traceparent headers, and the file service adds spans for its handlers and its
+// DynamoDB, S3 and PostgreSQL calls.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// Config says where a service's spans are exported
+type Config struct {
+	ServiceName   string // Reported as service.name, e.g. vibe-drop-gateway
+	OTLPEndpoint  string // Base URL of an OTLP/HTTP collector, e.g. http://localhost:4318 (export disabled if empty)
+	SamplePercent int    // Share (0-100) of new traces that are recorded
+}
+
+// Setup installs the global tracer provider and W3C trace context propagation. Without an
+// endpoint nothing is recorded, but trace context is still passed on so a traced caller's
+// trace continues downstream. The returned function flushes buffered spans; call it on
+// shutdown.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// OTLP/HTTP collectors take traces under /v1/traces of their base URL
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.OTLPEndpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service for tracing: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// A request arriving with a sampling decision keeps it, so traces aren't cut short
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(cfg.SamplePercent)/100))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for each request, continuing the caller's trace when the
+// request carries one. Spans are named after the matched route's path template, so IDs in
+// the path don't make every span name unique.
+func Middleware(service string) func(http.Handler) http.Handler {
+	return otelhttp.NewMiddleware(service, otelhttp.WithSpanNameFormatter(spanName))
+}
+
+func spanName(_ string, r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+	return r.Method
+}
+
+// Transport wraps base so each outgoing request gets a client span and carries the
+// current trace context to the server
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method
+	}))
+}
@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTraceContinuesAcrossServices(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{ServiceName: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	var handled trace.SpanContext
+	r := mux.NewRouter()
+	r.Use(Middleware("fileservice"))
+	r.HandleFunc("/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handled = trace.SpanContextFromContext(r.Context())
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "gateway")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/files/file-1", nil)
+	resp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if handled.TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("handler ran in trace %s, want the caller's %s", handled.TraceID(), parent.SpanContext().TraceID())
+	}
+	names := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+	}
+	if !names["GET /files/{id}"] {
+		t.Errorf("spans %v, want the server span named after the route template", names)
+	}
+}
@@ -0,0 +1,615 @@
+// Package vibedrop is a Go client for the Vibe-Drop API Gateway.
+package vibedrop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Client talks to the Vibe-Drop API Gateway
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	token        string
+	refreshToken string
+	apiKey       string
+	clientInfo   string // Sent as X-Client-Info
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient overrides the HTTP client used for API and transfer requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets the bearer token used for authenticated requests
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRefreshToken sets the refresh token Refresh exchanges for a new token pair
+func WithRefreshToken(refreshToken string) Option {
+	return func(c *Client) {
+		c.refreshToken = refreshToken
+	}
+}
+
+// WithAPIKey authenticates with a gateway API key instead of a user token
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithClientInfo identifies the calling app and version, plus the platform it runs on, in
+// X-Client-Info on every API request so admins can see which versions are still in use.
+// Both values may only contain letters, digits and . _ + - / :
+func WithClientInfo(app, version string) Option {
+	return func(c *Client) {
+		c.clientInfo = fmt.Sprintf("app=%s; version=%s; platform=%s/%s", app, version, runtime.GOOS, runtime.GOARCH)
+	}
+}
+
+// NewClient creates a client for the gateway at baseURL (e.g. http://localhost:8080)
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 0}, // transfers can take hours; use contexts for deadlines
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetToken sets the bearer token used for authenticated requests
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Token returns the current bearer token
+func (c *Client) Token() string {
+	return c.token
+}
+
+// RefreshToken returns the refresh token from the last Register, Login or Refresh
+func (c *Client) RefreshToken() string {
+	return c.refreshToken
+}
+
+// APIError is an error response returned by the API
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Details    string `json:"details,omitempty"`
+
+	// Errors lists every field that failed validation, when the request was rejected as invalid
+	Errors []FieldError `json:"errors,omitempty"`
+
+	// Upstream lists the AWS requests a storage failure came from, to quote in a support case
+	Upstream []UpstreamRequest `json:"upstream,omitempty"`
+}
+
+// UpstreamRequest is a storage provider call a request failed in, with the IDs the
+// provider looks it up by
+type UpstreamRequest struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	RequestID string `json:"request_id"`
+	HostID    string `json:"host_id,omitempty"`
+}
+
+// FieldError describes one invalid field in a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%s (%d %s): %s", e.Message, e.StatusCode, e.Code, e.Details)
+	}
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// envelope is the standard response wrapper used by every endpoint
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   *APIError       `json:"error"`
+}
+
+// do sends a JSON API request and decodes the response data into out (if non-nil)
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var bodyReader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		bodyReader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.clientInfo != "" {
+		req.Header.Set("X-Client-Info", c.clientInfo)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		if resp.StatusCode >= 400 {
+			return &APIError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode), Message: "Request failed"}
+		}
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 || !env.Success {
+		apiErr := env.Error
+		if apiErr == nil {
+			apiErr = &APIError{Message: "Request failed"}
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if out != nil && len(env.Data) > 0 {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return fmt.Errorf("failed to decode response data: %w", err)
+		}
+	}
+	return nil
+}
+
+// Register creates a new account and stores the returned token on the client
+func (c *Client) Register(ctx context.Context, username, email, password string) (*AuthResult, error) {
+	var result AuthResult
+	body := map[string]string{"username": username, "email": email, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/auth/register", body, &result); err != nil {
+		return nil, err
+	}
+	c.token, c.refreshToken = result.Token, result.RefreshToken
+	return &result, nil
+}
+
+// Login authenticates and stores the returned token on the client. For an account with
+// two-factor authentication it fails with an APIError coded ErrTOTPRequired; sign in with
+// LoginWithTOTP instead.
+func (c *Client) Login(ctx context.Context, email, password string) (*AuthResult, error) {
+	return c.LoginWithTOTP(ctx, email, password, "")
+}
+
+// LoginWithTOTP is Login with a code from the user's authenticator app
+func (c *Client) LoginWithTOTP(ctx context.Context, email, password, code string) (*AuthResult, error) {
+	var result AuthResult
+	body := map[string]string{"email": email, "password": password}
+	if code != "" {
+		body["totp_code"] = code
+	}
+	if err := c.do(ctx, http.MethodPost, "/auth/login", body, &result); err != nil {
+		return nil, err
+	}
+	c.token, c.refreshToken = result.Token, result.RefreshToken
+	return &result, nil
+}
+
+// ErrTOTPRequired is the APIError code for a sign-in that needs a two-factor code
+const ErrTOTPRequired = "TOTP_REQUIRED"
+
+// Refresh exchanges the client's refresh token for a new token pair and stores both.
+// Call it when requests start failing with 401 or before AuthResult.ExpiresAt.
+func (c *Client) Refresh(ctx context.Context) (*AuthResult, error) {
+	var result AuthResult
+	body := map[string]string{"refresh_token": c.refreshToken}
+	if err := c.do(ctx, http.MethodPost, "/auth/refresh", body, &result); err != nil {
+		return nil, err
+	}
+	c.token, c.refreshToken = result.Token, result.RefreshToken
+	return &result, nil
+}
+
+// Logout revokes the client's refresh token and clears both tokens
+func (c *Client) Logout(ctx context.Context) error {
+	body := map[string]string{"refresh_token": c.refreshToken}
+	if err := c.do(ctx, http.MethodPost, "/auth/logout", body, nil); err != nil {
+		return err
+	}
+	c.token, c.refreshToken = "", ""
+	return nil
+}
+
+// CreateToken issues a token limited to the given scopes (e.g. "files:read") for integrations
+func (c *Client) CreateToken(ctx context.Context, scopes []string, expiresIn time.Duration) (*ScopedToken, error) {
+	var result ScopedToken
+	body := map[string]interface{}{"scopes": scopes, "expires_in": int64(expiresIn.Seconds())}
+	if err := c.do(ctx, http.MethodPost, "/auth/tokens", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EnrollTOTP starts two-factor enrollment, returning the secret for an authenticator app.
+// Confirm it with VerifyTOTP.
+func (c *Client) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	var result TOTPEnrollment
+	if err := c.do(ctx, http.MethodPost, "/auth/2fa/enroll", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// VerifyTOTP confirms enrollment with a code from the app, turning two-factor sign-in on
+func (c *Client) VerifyTOTP(ctx context.Context, code string) error {
+	return c.do(ctx, http.MethodPost, "/auth/2fa/verify", map[string]string{"code": code}, nil)
+}
+
+// DisableTOTP turns two-factor sign-in off, given a current code
+func (c *Client) DisableTOTP(ctx context.Context, code string) error {
+	return c.do(ctx, http.MethodPost, "/auth/2fa/disable", map[string]string{"code": code}, nil)
+}
+
+// RequestUpload asks for presigned upload URL(s) for a file of the given size
+func (c *Client) RequestUpload(ctx context.Context, filename string, size int64) (*UploadURLResponse, error) {
+	var result UploadURLResponse
+	body := map[string]interface{}{"filename": filename, "size": size}
+	if err := c.do(ctx, http.MethodPost, "/files/upload-url", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RequestUploadWithChecksum is RequestUpload declaring the whole file's checksum, base64
+// encoded, with algorithm "sha256" or "crc32c" (multipart uploads need "crc32c"). Single
+// uploads must then be PUT with the returned UploadHeaders, see PutPresignedWithHeaders.
+func (c *Client) RequestUploadWithChecksum(ctx context.Context, filename string, size int64, algorithm, checksum string) (*UploadURLResponse, error) {
+	var result UploadURLResponse
+	body := map[string]interface{}{"filename": filename, "size": size, "checksum_algorithm": algorithm, "checksum": checksum}
+	if err := c.do(ctx, http.MethodPost, "/files/upload-url", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RequestBackgroundUpload is RequestUpload for a mobile background transfer session that
+// can't refresh URLs mid-transfer. The URLs stay valid for as long as the deployment allows
+// (24 hours by default) but each accepts only one upload.
+func (c *Client) RequestBackgroundUpload(ctx context.Context, filename string, size int64) (*UploadURLResponse, error) {
+	var result UploadURLResponse
+	body := map[string]interface{}{"filename": filename, "size": size, "background": true}
+	if err := c.do(ctx, http.MethodPost, "/files/upload-url", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CompleteChunk reports a multipart chunk as uploaded with the ETag S3 returned
+func (c *Client) CompleteChunk(ctx context.Context, fileID string, chunkNumber int, etag string) (*ChunkCompletion, error) {
+	var result ChunkCompletion
+	body := map[string]string{"etag": etag, "status": "uploaded"}
+	path := "/files/" + url.PathEscape(fileID) + "/chunks/" + strconv.Itoa(chunkNumber) + "/complete"
+	if err := c.do(ctx, http.MethodPost, path, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RefreshChunkURL returns a new presigned URL for a chunk not yet uploaded, replacing one
+// that has expired or is about to
+func (c *Client) RefreshChunkURL(ctx context.Context, fileID string, chunkNumber int) (*ChunkURL, error) {
+	var result ChunkURL
+	path := "/files/" + url.PathEscape(fileID) + "/chunks/" + strconv.Itoa(chunkNumber) + "/refresh-url"
+	if err := c.do(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListChunks returns the server's record of each chunk of a multipart upload
+func (c *Client) ListChunks(ctx context.Context, fileID string) (*ChunkStatusList, error) {
+	var result ChunkStatusList
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/chunks", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UploadStatus returns a multipart upload's chunks along with new presigned URLs for the
+// chunks not yet uploaded, for resuming after the original URLs have expired
+func (c *Client) UploadStatus(ctx context.Context, fileID string) (*UploadStatus, error) {
+	var result UploadStatus
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/upload-status", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CompleteUpload finalises a multipart upload once every chunk is reported
+func (c *Client) CompleteUpload(ctx context.Context, fileID string) error {
+	return c.do(ctx, http.MethodPost, "/files/"+url.PathEscape(fileID)+"/complete", nil, nil)
+}
+
+// ListFiles returns the authenticated user's files
+func (c *Client) ListFiles(ctx context.Context) ([]File, error) {
+	var result struct {
+		Files []File `json:"files"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/files", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+// SearchFiles returns the authenticated user's files whose name contains query, ignoring
+// case, Unicode form and invisible characters
+func (c *Client) SearchFiles(ctx context.Context, query string) ([]File, error) {
+	var result struct {
+		Files []File `json:"files"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/files?q="+url.QueryEscape(query), nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+// FindExisting returns the authenticated user's newest file with the given size and
+// checksum, or nil if there is none, so a sync can skip uploading content already stored.
+// Only files uploaded with a checksum of the same algorithm are found.
+func (c *Client) FindExisting(ctx context.Context, size int64, algorithm, checksum string) (*File, error) {
+	var result struct {
+		File *File `json:"file"`
+	}
+	body := map[string]interface{}{"size": size, "checksum_algorithm": algorithm, "checksum": checksum}
+	if err := c.do(ctx, http.MethodPost, "/files/exists", body, &result); err != nil {
+		return nil, err
+	}
+	return result.File, nil
+}
+
+// GetFile returns a file's metadata
+func (c *Client) GetFile(ctx context.Context, fileID string) (*File, error) {
+	var result File
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTags replaces a file's tags, returning its updated metadata. No tags removes them all.
+func (c *Client) SetTags(ctx context.Context, fileID string, tags map[string]string) (*File, error) {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	var result File
+	body := map[string]interface{}{"tags": tags}
+	if err := c.do(ctx, http.MethodPut, "/files/"+url.PathEscape(fileID)+"/tags", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DownloadURL returns a presigned URL for downloading a file
+func (c *Client) DownloadURL(ctx context.Context, fileID string) (*DownloadURL, error) {
+	var result DownloadURL
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/download-url", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteFile removes a file and its metadata
+func (c *Client) DeleteFile(ctx context.Context, fileID string) error {
+	return c.do(ctx, http.MethodDelete, "/files/"+url.PathEscape(fileID), nil, nil)
+}
+
+// Inbox returns the address files can be emailed to and who may send them
+func (c *Client) Inbox(ctx context.Context) (*Inbox, error) {
+	var result Inbox
+	if err := c.do(ctx, http.MethodGet, "/users/me/inbox", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetInboxSenders replaces who may email files into the inbox. No senders turns upload by
+// email off.
+func (c *Client) SetInboxSenders(ctx context.Context, senders []string) (*Inbox, error) {
+	if senders == nil {
+		senders = []string{}
+	}
+	var result Inbox
+	body := map[string]interface{}{"allowed_senders": senders}
+	if err := c.do(ctx, http.MethodPut, "/users/me/inbox/senders", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// APIKeyUsage returns the calling API key's request quota usage. It needs a client
+// created WithAPIKey, and fails with a 401 APIError if the key isn't valid.
+func (c *Client) APIKeyUsage(ctx context.Context) (*APIKeyUsage, error) {
+	var result APIKeyUsage
+	if err := c.do(ctx, http.MethodGet, "/api-keys/me/usage", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AuthResult is returned by Register, Login and Refresh
+type AuthResult struct {
+	User         User      `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // When Token expires
+}
+
+// User is an account's public profile
+type User struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TOTPEnrollment is a new two-factor secret returned by EnrollTOTP
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`           // For typing into an authenticator app
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, to show as a QR code
+}
+
+// ScopedToken is a capability-limited token returned by CreateToken
+type ScopedToken struct {
+	Token     string    `json:"token"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UploadURLResponse describes how to upload a file: one URL, or one URL per chunk
+type UploadURLResponse struct {
+	URL        string             `json:"url,omitempty"`
+	ExpiresAt  time.Time          `json:"expires_at,omitempty"`
+	FileID     string             `json:"file_id"`
+	UploadType string             `json:"upload_type"` // "single" or "multipart"
+	Chunks     []ChunkURL         `json:"chunks,omitempty"`
+	Hints      *UploadHints       `json:"hints,omitempty"`     // Multipart only
+	Filename   string             `json:"filename"`            // The name stored, which a collision may have changed
+	Collision  *FilenameCollision `json:"collision,omitempty"` // Set if the name matched an existing file
+
+	UploadHeaders map[string]string `json:"upload_headers,omitempty"` // Headers the PUT to URL must send
+	Background    bool              `json:"background,omitempty"`     // The URLs are long-lived and single-use
+}
+
+// FilenameCollision reports how an upload's filename clashed with an existing file
+type FilenameCollision struct {
+	Strategy          string `json:"strategy"` // "rename" or "version"
+	RequestedFilename string `json:"requested_filename"`
+	ExistingFileID    string `json:"existing_file_id"`
+	Version           int    `json:"version,omitempty"` // For "version": the new upload's version number
+}
+
+// ChunkURL is the presigned URL for one part of a multipart upload
+type ChunkURL struct {
+	ChunkNumber int       `json:"chunk_number"`
+	URL         string    `json:"url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Size        int64     `json:"size"`
+}
+
+// ChunkCompletion is returned after reporting a chunk
+type ChunkCompletion struct {
+	ChunkNumber    int    `json:"chunk_number"`
+	Status         string `json:"status"`
+	UploadComplete bool   `json:"upload_complete"`
+}
+
+// ChunkStatus is a chunk's upload state as recorded by the server
+type ChunkStatus struct {
+	ChunkNumber int    `json:"chunk_number"`
+	Status      string `json:"status"` // "pending", "uploaded" or "failed"
+	Size        int64  `json:"size"`
+	ETag        string `json:"etag,omitempty"`
+}
+
+// ChunkStatusList is returned by ListChunks
+type ChunkStatusList struct {
+	FileID         string        `json:"file_id"`
+	Status         string        `json:"status"`
+	TotalChunks    int           `json:"total_chunks"`
+	UploadedChunks int           `json:"uploaded_chunks"`
+	Chunks         []ChunkStatus `json:"chunks"`
+}
+
+// UploadStatus is returned by UploadStatus
+type UploadStatus struct {
+	ChunkStatusList
+	TotalBytes     int64      `json:"total_bytes"`
+	BytesConfirmed int64      `json:"bytes_confirmed"`
+	RemainingURLs  []ChunkURL `json:"remaining_urls"`
+}
+
+// File is a file's metadata
+type File struct {
+	ID                string     `json:"id"`
+	Filename          string     `json:"filename"`
+	OriginalFilename  string     `json:"original_filename,omitempty"` // As uploaded, if normalizing changed it
+	Size              int64      `json:"size"`
+	ContentType       string     `json:"content_type"`
+	UploadedAt        time.Time  `json:"uploaded_at"`
+	UserID            string     `json:"user_id"`
+	LastAccessedAt    *time.Time `json:"last_accessed_at,omitempty"`
+	Version           int        `json:"version,omitempty"` // Set from version 2 onwards
+	PreviousVersionID string     `json:"previous_version_id,omitempty"`
+	QuarantineReason  string     `json:"quarantine_reason,omitempty"` // Set while the file is quarantined
+	ChecksumAlgorithm string     `json:"checksum_algorithm,omitempty"`
+	Checksum          string     `json:"checksum,omitempty"`
+	CorruptReason     string     `json:"corrupt_reason,omitempty"` // Set if the content failed checksum verification
+	ScanStatus        string     `json:"scan_status,omitempty"`    // pending, clean or infected, once queued for a virus scan
+	ScanSignature     string     `json:"scan_signature,omitempty"` // The virus found, if infected
+
+	Tags map[string]string `json:"tags,omitempty"` // A plain label has an empty value
+}
+
+// DownloadURL is a presigned download link
+type DownloadURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	FileID    string    `json:"file_id"`
+}
+
+// Inbox is where files can be emailed to. Attachments are stored tagged folder=inbox.
+type Inbox struct {
+	Address        string   `json:"address"`
+	AllowedSenders []string `json:"allowed_senders"` // Addresses, and "@domain" for everyone at a domain
+}
+
+// APIKeyUsage is an API key's use of its daily and monthly request quotas
+type APIKeyUsage struct {
+	KeyID  string       `json:"key_id"`
+	Tier   string       `json:"tier"`
+	Quotas []QuotaUsage `json:"quotas"`
+}
+
+// QuotaUsage is the requests used and left in one quota period
+type QuotaUsage struct {
+	Period    string    `json:"period"` // daily or monthly
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
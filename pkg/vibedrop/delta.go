@@ -0,0 +1,268 @@
+package vibedrop
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Sources of a delta upload's parts
+const (
+	DeltaSourceBase   = "base"   // Copied by the server from the base file
+	DeltaSourceUpload = "upload" // Sent by the client
+)
+
+const (
+	// minDeltaPartSize is S3's smallest part; only a delta upload's last part may be smaller
+	minDeltaPartSize = 5 * 1024 * 1024
+	// maxDeltaPartSize caps the parts PlanDelta makes, so a long run of new bytes is sent
+	// in pieces that can go in parallel and be retried cheaply
+	maxDeltaPartSize = 512 * 1024 * 1024
+)
+
+// BlockManifest is a file's checksums block by block, returned by BlockManifest
+type BlockManifest struct {
+	FileID    string          `json:"file_id"`
+	Size      int64           `json:"size"`
+	BlockSize int64           `json:"block_size"`
+	Blocks    []BlockChecksum `json:"blocks"`
+}
+
+// BlockChecksum is one block of a file: its weak rolling checksum and hex SHA-256
+type BlockChecksum struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+// DeltaPart is one part of a delta upload's new content, in order: bytes copied from the
+// base file at Offset, or Size bytes the client sends
+type DeltaPart struct {
+	Source string `json:"source"`
+	Offset int64  `json:"offset,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+// DeltaChunkURL is a part of a delta upload to send, and where its bytes start in the
+// new content
+type DeltaChunkURL struct {
+	ChunkURL
+	Offset int64 `json:"offset"`
+}
+
+// DeltaUploadResponse is a delta upload under way. The parts copied from the base are
+// already uploaded; each of Chunks is then sent and reported with CompleteChunk, and the
+// upload finished with CompleteUpload.
+type DeltaUploadResponse struct {
+	FileID       string          `json:"file_id"`
+	BaseFileID   string          `json:"base_file_id"`
+	Filename     string          `json:"filename"`
+	Version      int             `json:"version"`
+	Size         int64           `json:"size"`
+	UploadType   string          `json:"upload_type"`
+	TotalChunks  int             `json:"total_chunks"`
+	CopiedChunks int             `json:"copied_chunks"`
+	CopiedBytes  int64           `json:"copied_bytes"`
+	Chunks       []DeltaChunkURL `json:"chunks"`
+	Hints        *UploadHints    `json:"hints,omitempty"`
+}
+
+// BlockManifest returns a completed file's block manifest, to plan a delta upload of a
+// new version against it with PlanDelta
+func (c *Client) BlockManifest(ctx context.Context, fileID string) (*BlockManifest, error) {
+	var result BlockManifest
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/blocks", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RequestDeltaUpload starts a new version of a completed file from a plan of its parts,
+// as made by PlanDelta. The new version is stored under the base file's name.
+func (c *Client) RequestDeltaUpload(ctx context.Context, fileID string, parts []DeltaPart) (*DeltaUploadResponse, error) {
+	var result DeltaUploadResponse
+	body := map[string]interface{}{"parts": parts}
+	if err := c.do(ctx, http.MethodPost, "/files/"+url.PathEscape(fileID)+"/delta", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// WeakChecksum is the rolling checksum block manifests carry: with a the sum of data's
+// bytes and b the sum of each byte times its distance from the end, both modulo 2^16,
+// it is a | b<<16.
+func WeakChecksum(data []byte) uint32 {
+	var a, b uint32
+	n := uint32(len(data))
+	for i, c := range data {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a&0xffff | (b&0xffff)<<16
+}
+
+// deltaSegment is a run of new content: copied from the base at baseOffset, or literal
+type deltaSegment struct {
+	base       bool
+	baseOffset int64
+	size       int64
+}
+
+// PlanDelta reads size bytes of new content and plans it as parts of the file manifest
+// describes: every block of the base found anywhere in the content is copied, and the
+// bytes between are uploaded. Only full-size blocks are looked for. Parts are merged and
+// split so every part but the last is as large as S3 requires.
+func PlanDelta(content io.Reader, size int64, manifest *BlockManifest) ([]DeltaPart, error) {
+	blockSize := manifest.BlockSize
+	if blockSize < minDeltaPartSize {
+		return nil, fmt.Errorf("block size %d is below the %d byte minimum part", blockSize, minDeltaPartSize)
+	}
+	byWeak := make(map[uint32][]int)
+	strong := make([][sha256.Size]byte, len(manifest.Blocks))
+	for i, block := range manifest.Blocks {
+		if block.Size != blockSize {
+			continue
+		}
+		decoded, err := hex.DecodeString(block.Strong)
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("block %d has an invalid SHA-256 %q", i, block.Strong)
+		}
+		copy(strong[i][:], decoded)
+		byWeak[block.Weak] = append(byWeak[block.Weak], i)
+	}
+
+	var segments []deltaSegment
+	addLiteral := func(n int64) {
+		if n == 0 {
+			return
+		}
+		if last := len(segments) - 1; last >= 0 && !segments[last].base {
+			segments[last].size += n
+			return
+		}
+		segments = append(segments, deltaSegment{size: n})
+	}
+	addBase := func(offset int64) {
+		if last := len(segments) - 1; last >= 0 && segments[last].base && segments[last].baseOffset+segments[last].size == offset {
+			segments[last].size += blockSize
+			return
+		}
+		segments = append(segments, deltaSegment{base: true, baseOffset: offset, size: blockSize})
+	}
+
+	r := bufio.NewReaderSize(content, 1<<20)
+	window := make([]byte, blockSize) // A ring holding the blockSize bytes at pos, from head
+	var pos, head int64               // pos is where the window starts in the content
+	var sum uint32
+	filled := false
+	next := -1 // The block after the last matched, preferred when blocks repeat
+	for pos+blockSize <= size {
+		if !filled {
+			if _, err := io.ReadFull(r, window); err != nil {
+				return nil, fmt.Errorf("failed to read content at %d: %w", pos, err)
+			}
+			head, sum, filled = 0, WeakChecksum(window), true
+		}
+		if match, ok := matchBlock(byWeak[sum], strong, window, head, next); ok {
+			addBase(manifest.Blocks[match].Offset)
+			pos += blockSize
+			next, filled = match+1, false
+			continue
+		}
+		if pos+blockSize == size {
+			break // The window is the content's tail and matched nothing
+		}
+
+		// Roll the window on a byte, as in rsync; the byte leaving it is new content
+		in, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content at %d: %w", pos+blockSize, err)
+		}
+		out := uint32(window[head])
+		window[head] = in
+		head = (head + 1) % blockSize
+		a := (sum&0xffff - out + uint32(in)) & 0xffff
+		b := (sum>>16 - uint32(blockSize)*out + a) & 0xffff
+		sum = a | b<<16
+		addLiteral(1)
+		pos++
+	}
+	addLiteral(size - pos)
+	return deltaParts(segments, blockSize), nil
+}
+
+// matchBlock returns which of the candidate blocks the window's content is, confirming the
+// weak match with the SHA-256. Of identical blocks, next is taken so runs stay contiguous.
+func matchBlock(candidates []int, strong [][sha256.Size]byte, window []byte, head int64, next int) (int, bool) {
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	hash := sha256.New()
+	hash.Write(window[head:])
+	hash.Write(window[:head])
+	var sum [sha256.Size]byte
+	hash.Sum(sum[:0])
+
+	match, ok := 0, false
+	for _, i := range candidates {
+		if strong[i] == sum {
+			if i == next {
+				return i, true
+			}
+			if !ok {
+				match, ok = i, true
+			}
+		}
+	}
+	return match, ok
+}
+
+// deltaParts turns segments into parts. A literal run too small to be a part takes in the
+// next block, or all of the next literal run, until it is large enough; runs longer than
+// maxDeltaPartSize are split evenly.
+func deltaParts(segments []deltaSegment, blockSize int64) []DeltaPart {
+	var merged []deltaSegment
+	for i := 0; i < len(segments); i++ {
+		segment := segments[i]
+		for !segment.base && segment.size < minDeltaPartSize && i+1 < len(segments) {
+			following := &segments[i+1]
+			taken := following.size
+			if following.base {
+				taken = min(blockSize, following.size)
+			}
+			segment.size += taken
+			following.size -= taken
+			following.baseOffset += taken
+			if following.size == 0 {
+				i++
+			}
+		}
+		merged = append(merged, segment)
+	}
+
+	var parts []DeltaPart
+	for _, segment := range merged {
+		pieces := (segment.size + maxDeltaPartSize - 1) / maxDeltaPartSize
+		offset := segment.baseOffset
+		for p := int64(0); p < pieces; p++ {
+			// Even pieces, the remainder spread over the first, so none is small
+			n := segment.size / pieces
+			if p < segment.size%pieces {
+				n++
+			}
+			part := DeltaPart{Source: DeltaSourceUpload, Size: n}
+			if segment.base {
+				part.Source, part.Offset = DeltaSourceBase, offset
+			}
+			parts = append(parts, part)
+			offset += n
+		}
+	}
+	return parts
+}
@@ -0,0 +1,60 @@
+package vibedrop
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// UploadHints are the server's recommended settings for multipart transfers
+type UploadHints struct {
+	ChunkSize        int64       `json:"chunk_size"`
+	MaxParallelParts int         `json:"max_parallel_parts"`
+	URLTTLSeconds    int64       `json:"url_ttl_seconds"`
+	Retry            RetryPolicy `json:"retry"`
+}
+
+// DownloadHints are the server's recommended settings for parallel downloads
+type DownloadHints struct {
+	MaxParallelParts int         `json:"max_parallel_parts"`
+	Retry            RetryPolicy `json:"retry"`
+}
+
+// RetryPolicy describes how failed part transfers should be retried
+type RetryPolicy struct {
+	MaxAttempts          int   `json:"max_attempts"`
+	InitialBackoffMillis int64 `json:"initial_backoff_ms"`
+	MaxBackoffMillis     int64 `json:"max_backoff_ms"`
+	RetryableStatusCodes []int `json:"retryable_status_codes"`
+}
+
+// Backoff returns the delay before the given retry (1 for the first retry), doubling each time up to the maximum
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := time.Duration(p.InitialBackoffMillis) * time.Millisecond
+	limit := time.Duration(p.MaxBackoffMillis) * time.Millisecond
+	for i := 1; i < retry && (limit == 0 || delay < limit); i++ {
+		delay *= 2
+	}
+	if limit > 0 && delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// Retryable reports whether a failed transfer should be retried. Rejections are retried only
+// for the listed status codes; network errors and checksum mismatches always are.
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var transferErr *TransferError
+	if errors.As(err, &transferErr) {
+		for _, code := range p.RetryableStatusCodes {
+			if code == transferErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
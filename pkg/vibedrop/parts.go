@@ -0,0 +1,71 @@
+package vibedrop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// FilePartMap lays a file out as parts to download in parallel, returned by FileParts
+type FilePartMap struct {
+	FileID     string         `json:"file_id"`
+	Size       int64          `json:"size"`
+	PartSize   int64          `json:"part_size"` // Every part's size but the last
+	TotalParts int            `json:"total_parts"`
+	Parts      []FilePart     `json:"parts"`
+	Hints      *DownloadHints `json:"hints,omitempty"`
+}
+
+// FilePart is one range of a file and the hex SHA-256 of its bytes
+type FilePart struct {
+	PartNumber int    `json:"part_number"`
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+// FileParts returns a completed file's part map. Each part can then be fetched from a
+// DownloadURL with DownloadPart.
+func (c *Client) FileParts(ctx context.Context, fileID string) (*FilePartMap, error) {
+	var result FilePartMap
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/parts", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DownloadPart streams one part of a file from a presigned GET URL into w with a range
+// request, and checks its bytes against the part's SHA-256. On a mismatch what was written
+// is wrong and the part should be fetched again.
+func (c *Client) DownloadPart(ctx context.Context, presignedURL string, part FilePart, w io.Writer, progress ProgressFunc) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, presignedURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(part.Offset, 10)+"-"+strconv.FormatInt(part.Offset+part.Size-1, 10))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &TransferError{StatusCode: resp.StatusCode, Detail: strings.TrimSpace(string(detail))}
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(w, hash), &progressReader{r: resp.Body, progress: progress}, part.Size); err != nil {
+		return fmt.Errorf("download interrupted: %w", err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != part.SHA256 {
+		return fmt.Errorf("checksum mismatch: part %d has SHA-256 %s, want %s", part.PartNumber, got, part.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package vibedrop
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultChunkSize is the part size the file service uses for multipart uploads
+const DefaultChunkSize = 5 * 1024 * 1024 * 1024
+
+// TransferError is returned when storage rejects a presigned upload or ranged download
+type TransferError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *TransferError) Error() string {
+	return fmt.Sprintf("transfer rejected with status %d: %s", e.StatusCode, e.Detail)
+}
+
+// ProgressFunc is called with the number of bytes transferred since the last call
+type ProgressFunc func(n int64)
+
+// progressReader reports bytes read through it
+type progressReader struct {
+	r        io.Reader
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.progress != nil {
+		p.progress(int64(n))
+	}
+	return n, err
+}
+
+// PutPresigned uploads size bytes from body to a presigned PUT URL and verifies that
+// the ETag S3 returns matches the MD5 of what was sent. It returns the ETag.
+func (c *Client) PutPresigned(ctx context.Context, presignedURL string, body io.Reader, size int64, progress ProgressFunc) (string, error) {
+	return c.PutPresignedWithHeaders(ctx, presignedURL, nil, body, size, progress)
+}
+
+// PutPresignedWithHeaders is PutPresigned sending extra headers, such as the UploadHeaders
+// returned for an upload with a checksum
+func (c *Client) PutPresignedWithHeaders(ctx context.Context, presignedURL string, headers map[string]string, body io.Reader, size int64, progress ProgressFunc) (string, error) {
+	hash := md5.New()
+	reader := &progressReader{r: io.TeeReader(body, hash), progress: progress}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, presignedURL, reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", &TransferError{StatusCode: resp.StatusCode, Detail: strings.TrimSpace(string(detail))}
+	}
+
+	etag := resp.Header.Get("ETag")
+	if want := hex.EncodeToString(hash.Sum(nil)); strings.Trim(etag, `"`) != want {
+		return "", fmt.Errorf("checksum mismatch: sent md5 %s, storage reported ETag %s", want, etag)
+	}
+
+	return etag, nil
+}
+
+// DownloadPresigned streams a presigned GET URL into w starting at offset (for resuming).
+// It returns the object's ETag so callers can verify the completed file.
+func (c *Client) DownloadPresigned(ctx context.Context, presignedURL string, offset int64, w io.Writer, progress ProgressFunc) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, presignedURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+	case offset == 0 && resp.StatusCode == http.StatusOK:
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// Nothing left to download
+		return resp.Header.Get("ETag"), nil
+	default:
+		return "", fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	if _, err := io.Copy(w, &progressReader{r: resp.Body, progress: progress}); err != nil {
+		return "", fmt.Errorf("download interrupted: %w", err)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// ComputeETag calculates the S3 ETag for content read from r: the MD5 for single-part
+// objects, or the MD5 of part MD5s suffixed with "-N" for multipart objects
+func ComputeETag(r io.Reader, size, partSize int64, parts int) (string, error) {
+	if parts <= 1 {
+		hash := md5.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	combined := md5.New()
+	for remaining := size; remaining > 0; remaining -= partSize {
+		hash := md5.New()
+		if _, err := io.CopyN(hash, r, min(partSize, remaining)); err != nil {
+			return "", err
+		}
+		combined.Write(hash.Sum(nil))
+	}
+	return hex.EncodeToString(combined.Sum(nil)) + "-" + strconv.Itoa(parts), nil
+}
+
+// ParseETagParts returns the part count encoded in a multipart ETag (1 for single-part)
+func ParseETagParts(etag string) int {
+	etag = strings.Trim(etag, `"`)
+	if i := strings.LastIndex(etag, "-"); i >= 0 {
+		if n, err := strconv.Atoi(etag[i+1:]); err == nil {
+			return n
+		}
+	}
+	return 1
+}